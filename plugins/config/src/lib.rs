@@ -50,6 +50,8 @@ impl lifecycle::Guest for Component {
         editor::register_language("typescript", &["typescript-language-server"]);
         editor::register_language("nix", &["nil"]);
 
+        editor::register_formatter("go", "gofmt", &[]);
+
         editor::register_language_server("zls", "zls", &[]);
         editor::register_language_server("fsautocomplete", "fsautocomplete", &[]);
         editor::register_language_server("rust-analyzer", "lspmux", &["client"]);
@@ -1,6 +1,12 @@
+use crate::PointRange;
+
 #[derive(Debug, PartialEq, Eq, Clone, Default)]
 pub struct CompletionItem {
     pub label: String,
     pub filter_text: Option<String>,
     pub insert_text: Option<String>,
+    /// The range the insert text replaces, the word being completed if `None`.
+    pub replace_range: Option<PointRange>,
+    /// Whether the insert text is a snippet with `$1` or `${1:default}` style placeholders.
+    pub snippet: bool,
 }
@@ -41,6 +41,14 @@ pub enum Operator {
     Delete,
     Change,
     Yank,
+    /// Toggle comments, `gc`.
+    Comment,
+    /// Create a fold, `zf`.
+    Fold,
+    /// Surround with a pair of delimiters, `ys`.
+    Surround,
+    /// Filter lines through a shell command, `!`.
+    Filter,
 }
 
 slotmap::new_key_type! {
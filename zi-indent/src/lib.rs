@@ -3,32 +3,91 @@ use zi_text::TextSlice;
 
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
 pub enum Indent {
-    Bytes(usize),
+    /// The width of the indentation, a tab is as wide as the columns up to the next tab stop.
+    Columns(usize),
 }
 
+const OPENERS: [char; 3] = ['{', '(', '['];
+const CLOSERS: [char; 3] = ['}', ')', ']'];
+
+/// The indentation of the line based on the lines above it, for languages without an indent query.
+/// This is the indentation of the previous non-blank line, with an extra level if that line ends with an opening bracket.
+/// A line starting with a closing bracket is indented to match the line with its opening bracket instead.
 pub fn indent(config: Config, text: &(impl Text + ?Sized), line_idx: usize) -> Indent {
-    if line_idx == 0 {
-        return Indent::Bytes(0);
+    let closes = text
+        .line(line_idx)
+        .and_then(|line| line.chars().find(|c| !c.is_whitespace()))
+        .is_some_and(|c| CLOSERS.contains(&c));
+
+    if closes {
+        if let Some(opener) = opener_line(text, line_idx) {
+            return Indent::Columns(width(config, text, opener));
+        }
     }
 
-    let Some(line) = text.line(line_idx - 1) else {
-        return Indent::Bytes(0);
+    let Some(prev) = (0..line_idx)
+        .rev()
+        .find(|&idx| text.line(idx).is_some_and(|line| line.chars().any(|c| !c.is_whitespace())))
+    else {
+        return Indent::Columns(0);
     };
 
-    let mut indent = line.indent();
-    if line.chars().next_back() == Some('{') {
-        indent += config.tab_width as usize;
+    let mut indent = width(config, text, prev);
+    let opens = text
+        .line(prev)
+        .and_then(|line| line.chars().rev().find(|c| !c.is_whitespace()))
+        .is_some_and(|c| OPENERS.contains(&c));
+
+    match (opens, closes) {
+        (true, false) => indent += config.indent_width as usize,
+        // The opening bracket wasn't found, so just dedent it relative to the previous line.
+        (false, true) => indent = indent.saturating_sub(config.indent_width as usize),
+        _ => {}
     }
 
-    Indent::Bytes(indent)
+    Indent::Columns(indent)
+}
+
+/// The line of the unclosed opening bracket closest above the line.
+/// This is naive and counts brackets within strings and comments too.
+fn opener_line(text: &(impl Text + ?Sized), line_idx: usize) -> Option<usize> {
+    let mut depth = 0usize;
+    for idx in (0..line_idx).rev() {
+        let Some(line) = text.line(idx) else { continue };
+        for c in line.chars().rev() {
+            if CLOSERS.contains(&c) {
+                depth += 1;
+            } else if OPENERS.contains(&c) {
+                match depth.checked_sub(1) {
+                    Some(d) => depth = d,
+                    None => return Some(idx),
+                }
+            }
+        }
+    }
+
+    None
+}
+
+/// The width of the line's indentation in columns.
+fn width(config: Config, text: &(impl Text + ?Sized), line_idx: usize) -> usize {
+    let Some(line) = text.line(line_idx) else { return 0 };
+    let tab_width = config.tab_width.max(1) as usize;
+    line.chars().take_while(|c| c.is_whitespace() && *c != '\n').fold(0, |width, c| match c {
+        '\t' => (width / tab_width + 1) * tab_width,
+        _ => width + 1,
+    })
 }
 
+#[derive(Debug, Clone, Copy)]
 pub struct Config {
     pub tab_width: u8,
+    /// The width of a level of indentation, `shiftwidth`.
+    pub indent_width: u8,
 }
 
 impl Default for Config {
     fn default() -> Self {
-        Self { tab_width: 4 }
+        Self { tab_width: 4, indent_width: 4 }
     }
 }
@@ -7,20 +7,60 @@ fn check(text: impl Text, line_idx: usize, expected: Indent) {
 
 #[test]
 fn indent_smoke() {
-    check(r#""#, 0, Indent::Bytes(0));
+    check(r#""#, 0, Indent::Columns(0));
 
     check(
         r#"fn main() {
     let foo = 42;
 }"#,
-        2,
-        Indent::Bytes(4),
+        1,
+        Indent::Columns(4),
     );
 
     check(
         r#"fn main() {
 "#,
         1,
-        Indent::Bytes(4),
+        Indent::Columns(4),
+    );
+}
+
+#[test]
+fn indent_closing_bracket() {
+    check(
+        r#"fn main() {
+    let foo = 42;
+}"#,
+        2,
+        Indent::Columns(0),
     );
+
+    // Matches the line of the opening bracket rather than the previous line.
+    check(
+        r#"fn main() {
+    if foo {
+        bar(
+            1,
+            2,
+        )
+    }"#,
+        6,
+        Indent::Columns(4),
+    );
+
+    check("    foo\n    }", 1, Indent::Columns(0));
+}
+
+#[test]
+fn indent_skips_blank_lines() {
+    check("fn main() {\n\n   \n", 3, Indent::Columns(4));
+    check("    foo\n\n", 2, Indent::Columns(4));
+}
+
+#[test]
+fn indent_tabs() {
+    let config = Config { tab_width: 8, indent_width: 8 };
+    assert_eq!(indent(config, "\tif ok {\n", 1), Indent::Columns(16));
+    // Tabs align to the next tab stop.
+    assert_eq!(indent(config, "  \tfoo\n", 1), Indent::Columns(8));
 }
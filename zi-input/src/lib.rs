@@ -7,7 +7,20 @@ use chumsky::Parser;
 #[cfg_attr(feature = "arbitrary", derive(arbitrary::Arbitrary))]
 pub enum Event {
     Key(KeyEvent),
+    Mouse(MouseEvent),
     Resize(u16, u16),
+    /// Text pasted while bracketed paste mode is enabled, to be inserted literally.
+    Paste(String),
+    /// The terminal regained focus, only sent if focus reporting is enabled.
+    FocusGained,
+}
+
+impl Event {
+    /// Decode a bracketed paste of the form `ESC [ 200 ~ text ESC [ 201 ~`.
+    pub fn from_bracketed_paste(s: &str) -> Option<Self> {
+        let text = s.strip_prefix("\x1b[200~")?.strip_suffix("\x1b[201~")?;
+        Some(Event::Paste(text.to_owned()))
+    }
 }
 
 #[cfg(feature = "crossterm")]
@@ -28,12 +41,169 @@ impl TryFrom<crossterm::event::Event> for Event {
                 ))),
             },
 
+            crossterm::event::Event::Mouse(event) => Ok(Event::Mouse(event.try_into()?)),
             crossterm::event::Event::Resize(width, height) => Ok(Event::Resize(width, height)),
+            crossterm::event::Event::Paste(text) => Ok(Event::Paste(text)),
+            crossterm::event::Event::FocusGained => Ok(Event::FocusGained),
             _ => Err(()),
         }
     }
 }
 
+/// A mouse event, the coordinates are 0-indexed cells relative to the top-left of the terminal.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash)]
+#[cfg_attr(feature = "arbitrary", derive(arbitrary::Arbitrary))]
+pub struct MouseEvent {
+    kind: MouseEventKind,
+    column: u16,
+    row: u16,
+    modifiers: KeyModifiers,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash)]
+#[cfg_attr(feature = "arbitrary", derive(arbitrary::Arbitrary))]
+pub enum MouseEventKind {
+    Down(MouseButton),
+    Up(MouseButton),
+    Drag(MouseButton),
+    Moved,
+    ScrollUp,
+    ScrollDown,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash)]
+#[cfg_attr(feature = "arbitrary", derive(arbitrary::Arbitrary))]
+pub enum MouseButton {
+    Left,
+    Middle,
+    Right,
+}
+
+impl MouseEvent {
+    pub fn new(kind: MouseEventKind, column: u16, row: u16, modifiers: KeyModifiers) -> Self {
+        Self { kind, column, row, modifiers }
+    }
+
+    /// Decode an SGR (1006) mouse report of the form `ESC [ < Cb ; Cx ; Cy M` (or `m` for a release).
+    pub fn from_sgr(s: &str) -> Option<Self> {
+        let s = s.strip_prefix("\x1b[<")?;
+        let release = match s.as_bytes().last()? {
+            b'M' => false,
+            b'm' => true,
+            _ => return None,
+        };
+
+        let mut params = s[..s.len() - 1].split(';').map(|param| param.parse::<u16>().ok());
+        let (cb, cx, cy) = (params.next()??, params.next()??, params.next()??);
+        if params.next().is_some() {
+            return None;
+        }
+
+        let mut modifiers = KeyModifiers::empty();
+        if cb & 4 != 0 {
+            modifiers |= KeyModifiers::SHIFT;
+        }
+        if cb & 8 != 0 {
+            modifiers |= KeyModifiers::ALT;
+        }
+        if cb & 16 != 0 {
+            modifiers |= KeyModifiers::CONTROL;
+        }
+
+        let button = match cb & 3 {
+            0 => Some(MouseButton::Left),
+            1 => Some(MouseButton::Middle),
+            2 => Some(MouseButton::Right),
+            _ => None,
+        };
+
+        let kind = if cb & 64 != 0 {
+            match cb & 3 {
+                0 => MouseEventKind::ScrollUp,
+                1 => MouseEventKind::ScrollDown,
+                // Horizontal scrolling
+                _ => return None,
+            }
+        } else if cb & 32 != 0 {
+            button.map_or(MouseEventKind::Moved, MouseEventKind::Drag)
+        } else if release {
+            // Unlike the legacy encoding, SGR reports which button was released.
+            MouseEventKind::Up(button?)
+        } else {
+            MouseEventKind::Down(button?)
+        };
+
+        // The reported coordinates are 1-indexed.
+        Some(Self::new(kind, cx.checked_sub(1)?, cy.checked_sub(1)?, modifiers))
+    }
+
+    #[inline]
+    pub fn kind(&self) -> MouseEventKind {
+        self.kind
+    }
+
+    #[inline]
+    pub fn column(&self) -> u16 {
+        self.column
+    }
+
+    #[inline]
+    pub fn row(&self) -> u16 {
+        self.row
+    }
+
+    #[inline]
+    pub fn modifiers(&self) -> KeyModifiers {
+        self.modifiers
+    }
+}
+
+impl From<MouseEvent> for Event {
+    #[inline]
+    fn from(v: MouseEvent) -> Self {
+        Self::Mouse(v)
+    }
+}
+
+#[cfg(feature = "crossterm")]
+impl TryFrom<crossterm::event::MouseEvent> for MouseEvent {
+    type Error = ();
+
+    fn try_from(event: crossterm::event::MouseEvent) -> Result<Self, Self::Error> {
+        use crossterm::event::MouseEventKind as Kind;
+
+        let button = |button| match button {
+            crossterm::event::MouseButton::Left => MouseButton::Left,
+            crossterm::event::MouseButton::Middle => MouseButton::Middle,
+            crossterm::event::MouseButton::Right => MouseButton::Right,
+        };
+
+        let kind = match event.kind {
+            Kind::Down(b) => MouseEventKind::Down(button(b)),
+            Kind::Up(b) => MouseEventKind::Up(button(b)),
+            Kind::Drag(b) => MouseEventKind::Drag(button(b)),
+            Kind::Moved => MouseEventKind::Moved,
+            Kind::ScrollUp => MouseEventKind::ScrollUp,
+            Kind::ScrollDown => MouseEventKind::ScrollDown,
+            Kind::ScrollLeft | Kind::ScrollRight => return Err(()),
+        };
+
+        // Unlike keys, it's normal for mouse events to have multiple modifiers held.
+        let mut modifiers = KeyModifiers::empty();
+        for (from, to) in [
+            (crossterm::event::KeyModifiers::SHIFT, KeyModifiers::SHIFT),
+            (crossterm::event::KeyModifiers::CONTROL, KeyModifiers::CONTROL),
+            (crossterm::event::KeyModifiers::ALT, KeyModifiers::ALT),
+        ] {
+            if event.modifiers.contains(from) {
+                modifiers |= to;
+            }
+        }
+
+        Ok(Self::new(kind, event.column, event.row, modifiers))
+    }
+}
+
 #[derive(Debug, PartialEq, Eq, PartialOrd, Ord, Hash, Clone, Copy)]
 #[cfg_attr(feature = "arbitrary", derive(arbitrary::Arbitrary))]
 pub enum KeyCode {
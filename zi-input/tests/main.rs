@@ -50,3 +50,56 @@ fn parse_key_sequence() {
         assert_eq!(parsed, x.parse::<KeySequence>().unwrap(), "case: raw=`{s}` to_string=`{x}`",);
     }
 }
+
+#[test]
+fn decode_sgr_mouse() {
+    use zi_input::{KeyModifiers, MouseButton, MouseEvent, MouseEventKind};
+
+    for (s, expected) in [
+        ("\x1b[<0;1;1M", Some((MouseEventKind::Down(MouseButton::Left), 0, 0, KeyModifiers::NONE))),
+        ("\x1b[<0;10;5m", Some((MouseEventKind::Up(MouseButton::Left), 9, 4, KeyModifiers::NONE))),
+        (
+            "\x1b[<2;3;4M",
+            Some((MouseEventKind::Down(MouseButton::Right), 2, 3, KeyModifiers::NONE)),
+        ),
+        (
+            "\x1b[<32;7;2M",
+            Some((MouseEventKind::Drag(MouseButton::Left), 6, 1, KeyModifiers::NONE)),
+        ),
+        ("\x1b[<35;7;2M", Some((MouseEventKind::Moved, 6, 1, KeyModifiers::NONE))),
+        ("\x1b[<64;1;1M", Some((MouseEventKind::ScrollUp, 0, 0, KeyModifiers::NONE))),
+        ("\x1b[<65;1;1M", Some((MouseEventKind::ScrollDown, 0, 0, KeyModifiers::NONE))),
+        (
+            "\x1b[<20;2;2M",
+            Some((
+                MouseEventKind::Down(MouseButton::Left),
+                1,
+                1,
+                KeyModifiers::SHIFT | KeyModifiers::CONTROL,
+            )),
+        ),
+        ("\x1b[<0;0;1M", None),
+        ("\x1b[<0;1M", None),
+        ("\x1b[<0;1;1", None),
+        ("\x1b[M !!", None),
+    ] {
+        let expected = expected.map(|(kind, col, row, mods)| MouseEvent::new(kind, col, row, mods));
+        assert_eq!(MouseEvent::from_sgr(s), expected, "case: {s:?}");
+    }
+}
+
+#[test]
+fn decode_bracketed_paste() {
+    use zi_input::Event;
+
+    for (s, expected) in [
+        ("\x1b[200~hello\x1b[201~", Some("hello")),
+        ("\x1b[200~a\nb\x1b[201~", Some("a\nb")),
+        ("\x1b[200~\x1b[201~", Some("")),
+        ("\x1b[200~unterminated", None),
+        ("hello\x1b[201~", None),
+    ] {
+        let expected = expected.map(|text| Event::Paste(text.to_owned()));
+        assert_eq!(Event::from_bracketed_paste(s), expected, "case: {s:?}");
+    }
+}
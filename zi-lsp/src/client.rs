@@ -37,6 +37,20 @@ pub(crate) fn capabilities() -> lsp_types::ClientCapabilities {
             definition: GOTO_CAPABILITY,
             type_definition: GOTO_CAPABILITY,
             implementation: GOTO_CAPABILITY,
+            completion: Some(lsp_types::CompletionClientCapabilities {
+                completion_item: Some(lsp_types::CompletionItemCapability {
+                    snippet_support: Some(true),
+                    ..Default::default()
+                }),
+                ..Default::default()
+            }),
+            hover: Some(lsp_types::HoverClientCapabilities {
+                dynamic_registration: Some(false),
+                content_format: Some(vec![
+                    lsp_types::MarkupKind::Markdown,
+                    lsp_types::MarkupKind::PlainText,
+                ]),
+            }),
             diagnostic: Some(lsp_types::DiagnosticClientCapabilities {
                 related_document_support: Some(true),
                 ..Default::default()
@@ -149,17 +149,52 @@ pub fn completion_response(
 }
 
 pub fn completion_item(
-    _encoding: lstypes::PositionEncoding,
-    _text: &(impl Text + ?Sized),
+    encoding: lstypes::PositionEncoding,
+    text: &(impl Text + ?Sized),
     item: lsp_types::CompletionItem,
 ) -> Option<lstypes::CompletionItem> {
+    // The edit takes precedence over the insert text if both are present.
+    let (insert_text, replace_range) = match item.text_edit {
+        Some(lsp_types::CompletionTextEdit::Edit(edit)) => {
+            (Some(edit.new_text), Some(range(encoding, text, edit.range)?))
+        }
+        Some(lsp_types::CompletionTextEdit::InsertAndReplace(edit)) => {
+            (Some(edit.new_text), Some(range(encoding, text, edit.insert)?))
+        }
+        None => (item.insert_text, None),
+    };
+
     Some(lstypes::CompletionItem {
         label: item.label,
-        insert_text: item.insert_text,
+        insert_text,
         filter_text: item.filter_text,
+        replace_range,
+        snippet: item.insert_text_format == Some(lsp_types::InsertTextFormat::SNIPPET),
     })
 }
 
+pub fn hover(encoding: lstypes::PositionEncoding, hover: lsp_types::Hover) -> lstypes::Hover {
+    fn marked_string(s: lsp_types::MarkedString) -> String {
+        match s {
+            lsp_types::MarkedString::String(s) => s,
+            lsp_types::MarkedString::LanguageString(s) => {
+                format!("```{}\n{}\n```", s.language, s.value)
+            }
+        }
+    }
+
+    let contents = match hover.contents {
+        lsp_types::HoverContents::Scalar(s) => marked_string(s),
+        lsp_types::HoverContents::Array(xs) => {
+            xs.into_iter().map(marked_string).collect::<Vec<_>>().join("\n\n")
+        }
+        // Plaintext is valid markdown for our purposes.
+        lsp_types::HoverContents::Markup(markup) => markup.value,
+    };
+
+    lstypes::Hover { contents, range: hover.range.map(|range| encoded_range(encoding, range)) }
+}
+
 pub fn semantic_tokens(
     encoding: lstypes::PositionEncoding,
     text: &(impl Text + ?Sized),
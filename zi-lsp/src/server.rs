@@ -1,6 +1,6 @@
 use std::any::Any;
 use std::collections::HashMap;
-use std::sync::{Arc, OnceLock};
+use std::sync::{Arc, OnceLock, Weak};
 
 use async_lsp::lsp_types::{self, OneOf};
 use futures_util::future::BoxFuture;
@@ -133,9 +133,19 @@ impl zi::LanguageService for LanguageService {
         .then_some(())
     }
 
-    fn completion_capabilities(&self) -> Option<()> {
-        self.capabilities().completion_provider.as_ref()?;
-        Some(())
+    fn completion_capabilities(&self) -> Option<lstypes::CompletionCapabilities> {
+        let options = self.capabilities().completion_provider.as_ref()?;
+        // Only single character triggers are supported.
+        let trigger_characters = options
+            .trigger_characters
+            .iter()
+            .flatten()
+            .filter_map(|s| {
+                let mut chars = s.chars();
+                chars.next().filter(|_| chars.next().is_none())
+            })
+            .collect();
+        Some(lstypes::CompletionCapabilities { trigger_characters })
     }
 
     fn reference_capabilities(&self) -> Option<()> {
@@ -168,6 +178,14 @@ impl zi::LanguageService for LanguageService {
         Some(())
     }
 
+    fn hover_capabilities(&self) -> Option<()> {
+        (!matches!(
+            self.capabilities().hover_provider,
+            None | Some(lsp_types::HoverProviderCapability::Simple(false))
+        ))
+        .then_some(())
+    }
+
     fn initialize(&mut self, params: lstypes::InitializeParams) -> ResponseFuture<()> {
         let caps = Arc::clone(&self.capabilities);
         #[expect(deprecated)]
@@ -197,43 +215,66 @@ impl zi::LanguageService for LanguageService {
         })
     }
 
+    fn did_open(&mut self, params: lstypes::DidOpenParams) -> zi::Result<()> {
+        let version = params.version as i32;
+        self.texts.entry(params.url.clone()).or_insert((version, Rope::from(params.text.as_str())));
+        self.server.did_open(lsp_types::DidOpenTextDocumentParams {
+            text_document: lsp_types::TextDocumentItem {
+                uri: params.url,
+                language_id: params.language_id,
+                version,
+                text: params.text,
+            },
+        })?;
+        Ok(())
+    }
+
     fn initialized(&mut self) -> zi::Result<()> {
         self.server.initialized(lsp_types::InitializedParams {})?;
 
         // Setup relevant event handlers to create notifications to the language server.
         let service_id = self.service_id;
+        // The handlers must not outlive this instance, otherwise a restarted service with the same id
+        // would receive every notification twice.
+        let alive = Arc::downgrade(&self.capabilities);
+
+        zi::event::subscribe_with::<event::DidOpenBuffer>({
+            let alive = Weak::clone(&alive);
+            move |editor, event| {
+                if alive.strong_count() == 0 {
+                    return HandlerResult::Unsubscribe;
+                }
 
-        zi::event::subscribe_with::<event::DidOpenBuffer>(move |editor, event| {
-            let buf = event.buf;
-            let Some(url) = editor[buf].file_url().cloned() else { return HandlerResult::Continue };
-            let params = lsp_types::DidOpenTextDocumentParams {
-                text_document: lsp_types::TextDocumentItem {
-                    uri: url.clone(),
+                let buf = event.buf;
+                let Some(url) = editor[buf].file_url().cloned() else {
+                    return HandlerResult::Continue;
+                };
+                let params = lstypes::DidOpenParams {
+                    url,
                     language_id: editor[buf].file_type().to_string(),
-                    version: editor[buf].version() as i32,
+                    version: editor[buf].version(),
                     text: editor[buf].text().to_string(),
-                },
-            };
-
-            // TODO should ignore any open events not related to this language server.
-            // See below
+                };
 
-            if let Some(server) = editor.language_server(service_id) {
-                tracing::debug!(?event, ?service_id, "lsp buffer did open");
-                server.texts.entry(url).or_insert((
-                    params.text_document.version,
-                    Rope::from(params.text_document.text.as_str()),
-                ));
+                // TODO should ignore any open events not related to this language server.
+                // See below
 
-                if let Err(err) = server.server.did_open(params) {
-                    tracing::error!(?err, "lsp did_open notification failed");
+                if let Some(server) = editor.language_server(service_id) {
+                    tracing::debug!(?event, ?service_id, "lsp buffer did open");
+                    if let Err(err) = zi::LanguageService::did_open(server, params) {
+                        tracing::error!(?err, "lsp did_open notification failed");
+                    }
                 }
-            }
 
-            HandlerResult::Continue
+                HandlerResult::Continue
+            }
         });
 
         zi::event::subscribe_with::<event::DidChangeBuffer>(move |editor, event| {
+            if alive.strong_count() == 0 {
+                return HandlerResult::Unsubscribe;
+            }
+
             tracing::trace!(buf = ?event.buf, "buffer did change");
 
             let buf = &editor.buffers[event.buf];
@@ -481,6 +522,22 @@ impl zi::LanguageService for LanguageService {
             .boxed()
     }
 
+    fn hover(&mut self, params: lstypes::HoverParams) -> ResponseFuture<Option<lstypes::Hover>> {
+        let enc = self.position_encoding();
+        let Some(text) = self.text(&params.at.url).cloned() else {
+            return Box::pin(async { Ok(None) });
+        };
+
+        self.server
+            .hover(lsp_types::HoverParams {
+                text_document_position_params: to_proto::document_position(enc, &text, params.at),
+                work_done_progress_params: Default::default(),
+            })
+            .map(move |res| res.map(|opt| opt.map(|hover| from_proto::hover(enc, hover))))
+            .map_err(Into::into)
+            .boxed()
+    }
+
     fn semantic_tokens_full(
         &mut self,
         theme: Setting<Theme>,
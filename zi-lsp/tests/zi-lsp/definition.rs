@@ -131,3 +131,53 @@ async fn lsp_definition_cross_file() -> zi::Result<()> {
     cx.cleanup().await;
     Ok(())
 }
+
+#[tokio::test]
+async fn lsp_definition_other_file() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let main = cx.tempfile("foo();\n")?;
+    // `©` is 2 bytes in UTF-8 but a single UTF-16 code unit.
+    let target = cx.tempfile("// ©\nfn ©foo() {}\n")?;
+    let target_uri = Url::from_file_path(&target).unwrap();
+
+    cx.setup_lang_server(zi::filetype!(text), "test-server", (), |builder| {
+        builder
+            .request::<request::Initialize, _>(|_, _| async {
+                Ok(lsp_types::InitializeResult {
+                    capabilities: lsp_types::ServerCapabilities {
+                        position_encoding: Some(lsp_types::PositionEncodingKind::UTF16),
+                        definition_provider: Some(OneOf::Left(true)),
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                })
+            })
+            .request::<request::GotoDefinition, _>(move |_st: &mut (), _params| {
+                let uri = target_uri.clone();
+                async move {
+                    Ok(Some(lsp_types::GotoDefinitionResponse::Scalar(lsp_types::Location {
+                        uri,
+                        range: lsp_range!(1:4..1:7),
+                    })))
+                }
+            })
+    })
+    .await;
+
+    let main_buf = cx.open(&main, zi::OpenFlags::SPAWN_LANGUAGE_SERVICES).await?;
+    cx.with(move |editor| editor.goto_definition(zi::Active)).await.await?;
+    cx.with(move |editor| {
+        assert_ne!(editor.buffer(zi::Active).id(), main_buf);
+        assert_eq!(editor.buffer(zi::Active).text().to_string(), "// ©\nfn ©foo() {}\n");
+        assert_eq!(editor.view(zi::Active).cursor(), zi::Point::new(1, 5));
+        assert_eq!(editor.cursor_char(), Some('f'));
+
+        editor.jump_back(zi::Active);
+        assert_eq!(editor.buffer(zi::Active).id(), main_buf);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
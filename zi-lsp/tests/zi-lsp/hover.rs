@@ -0,0 +1,69 @@
+use super::*;
+
+async fn setup(cx: &TestContext, hover: Option<lsp_types::Hover>) -> zi::Result<()> {
+    let path = cx.tempfile("fn foo() {}\n")?;
+
+    cx.setup_lang_server(zi::filetype!(text), "test-server", (), |builder| {
+        builder
+            .request::<request::Initialize, _>(|_, _| async {
+                Ok(lsp_types::InitializeResult {
+                    capabilities: lsp_types::ServerCapabilities {
+                        position_encoding: Some(lsp_types::PositionEncodingKind::UTF8),
+                        hover_provider: Some(lsp_types::HoverProviderCapability::Simple(true)),
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                })
+            })
+            .request::<request::HoverRequest, _>(move |_st: &mut (), params| {
+                assert_eq!(params.text_document_position_params.position, lsp_pos!(0:3));
+                let hover = hover.clone();
+                async move { Ok(hover) }
+            })
+    })
+    .await;
+
+    cx.open(&path, zi::OpenFlags::SPAWN_LANGUAGE_SERVICES).await?;
+    cx.with(|editor| editor.set_cursor(zi::Active, zi::Point::new(0, 3))).await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn lsp_hover() -> zi::Result<()> {
+    let cx = new("").await;
+    setup(
+        &cx,
+        Some(lsp_types::Hover {
+            contents: lsp_types::HoverContents::Markup(lsp_types::MarkupContent {
+                kind: lsp_types::MarkupKind::Markdown,
+                value: "```rust\nfn foo()\n```\n\nDoes nothing.".into(),
+            }),
+            range: None,
+        }),
+    )
+    .await?;
+
+    cx.with(|editor| editor.hover(zi::Active)).await.await?;
+    cx.with(|editor| {
+        assert_eq!(editor.hover_text().as_deref(), Some("fn foo()\n\nDoes nothing."));
+        // Any key press dismisses the popup.
+        editor.input("l").unwrap();
+        assert_eq!(editor.hover_text(), None);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn lsp_hover_empty() -> zi::Result<()> {
+    let cx = new("").await;
+    setup(&cx, None).await?;
+
+    assert!(cx.with(|editor| editor.hover(zi::Active)).await.await.is_err());
+    cx.with(|editor| assert_eq!(editor.hover_text(), None)).await;
+
+    cx.cleanup().await;
+    Ok(())
+}
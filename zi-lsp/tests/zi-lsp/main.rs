@@ -16,6 +16,9 @@ use zi_test::{TestContext, new};
 mod definition;
 mod diagnostics;
 mod format;
+mod hover;
+mod references;
+mod restart;
 mod sync;
 
 // Utility type that can be referenced from within `Fn` closures.
@@ -0,0 +1,79 @@
+use zi::Url;
+
+use super::*;
+
+#[tokio::test]
+async fn lsp_references_quickfix() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let main = cx.tempfile("fn foo() {}\nfoo();\n")?;
+    // `©` is 2 bytes in UTF-8 but a single UTF-16 code unit.
+    let other = cx.tempfile("©©foo();\n")?;
+    let main_uri = Url::from_file_path(&main).unwrap();
+    let other_uri = Url::from_file_path(&other).unwrap();
+
+    cx.setup_lang_server(zi::filetype!(text), "test-server", (), |builder| {
+        builder
+            .request::<request::Initialize, _>(|_, _| async {
+                Ok(lsp_types::InitializeResult {
+                    capabilities: lsp_types::ServerCapabilities {
+                        position_encoding: Some(lsp_types::PositionEncodingKind::UTF16),
+                        references_provider: Some(OneOf::Left(true)),
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                })
+            })
+            .request::<request::References, _>(move |_st: &mut (), _params| {
+                let locations = vec![
+                    lsp_types::Location { uri: main_uri.clone(), range: lsp_range!(1:0..1:3) },
+                    lsp_types::Location { uri: other_uri.clone(), range: lsp_range!(0:2..0:5) },
+                ];
+                async move { Ok(Some(locations)) }
+            })
+    })
+    .await;
+
+    let main_buf = cx.open(&main, zi::OpenFlags::SPAWN_LANGUAGE_SERVICES).await?;
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, zi::Point::new(0, 3));
+        editor.goto_references(zi::Active)
+    })
+    .await
+    .await?;
+
+    cx.with(move |editor| {
+        assert_eq!(editor.quickfix_entries().len(), 2);
+        assert_eq!(editor.buffer(zi::Active).id(), main_buf);
+        assert_eq!(editor.view(zi::Active).cursor(), zi::Point::new(1, 0));
+    })
+    .await;
+
+    cx.with(|editor| editor.quickfix_next()).await?.await?;
+    let other_buf = cx
+        .with(move |editor| {
+            assert_eq!(editor.buffer(zi::Active).text().to_string(), "©©foo();\n");
+            editor.buffer(zi::Active).id()
+        })
+        .await;
+    cx.with(move |editor| {
+        assert_ne!(other_buf, main_buf);
+        assert_eq!(editor.view(zi::Active).cursor(), zi::Point::new(0, 4));
+        assert_eq!(editor.cursor_char(), Some('f'));
+        assert!(editor.quickfix_next().is_err());
+    })
+    .await;
+
+    cx.with(|editor| editor.quickfix_prev()).await?.await?;
+    cx.with(move |editor| {
+        assert_eq!(editor.buffer(zi::Active).id(), main_buf);
+        assert_eq!(editor.view(zi::Active).cursor(), zi::Point::new(1, 0));
+        // Each step through the list is a jump.
+        editor.jump_back(zi::Active);
+        assert_eq!(editor.buffer(zi::Active).id(), other_buf);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -0,0 +1,133 @@
+use std::time::Duration;
+
+use super::*;
+
+/// Wraps a fake server so that the first instance crashes shortly after starting.
+struct CrashOnce {
+    template: FakeLanguageServerTemplate<Arc<AtomicUsize>>,
+    spawns: AtomicUsize,
+}
+
+impl zi::LanguageServiceConfig for CrashOnce {
+    fn spawn(
+        &self,
+        cwd: &Path,
+        client: zi::LanguageClient,
+    ) -> anyhow::Result<(Box<dyn zi::LanguageService + Send>, BoxFuture<'static, anyhow::Result<()>>)>
+    {
+        let (service, fut) = self.template.spawn(cwd, client)?;
+        if self.spawns.fetch_add(1, atomic::Ordering::Relaxed) > 0 {
+            return Ok((service, fut));
+        }
+
+        Ok((
+            service,
+            Box::pin(async {
+                tokio::time::sleep(Duration::from_millis(50)).await;
+                anyhow::bail!("language server exited unexpectedly")
+            }),
+        ))
+    }
+}
+
+#[tokio::test]
+async fn lsp_restart_after_crash() -> zi::Result<()> {
+    let cx = new("").await;
+    let opens = Arc::new(AtomicUsize::new(0));
+
+    let template = FakeLanguageServer::builder()
+        .request::<request::Initialize, _>(|_, _| async {
+            Ok(lsp_types::InitializeResult::default())
+        })
+        .notification::<notification::Initialized>(|_st, _params| Ok(()))
+        .notification::<notification::DidOpenTextDocument>(|opens: &mut Arc<AtomicUsize>, _| {
+            opens.fetch_add(1, atomic::Ordering::Relaxed);
+            Ok(())
+        })
+        .finish(Arc::clone(&opens));
+
+    cx.with(|editor| {
+        editor
+            .language_config_mut()
+            .add_language(zi::filetype!(text), zi::LanguageConfig::new(["test-server".into()]))
+            .add_language_service(
+                "test-server",
+                CrashOnce { template, spawns: AtomicUsize::new(0) },
+            );
+    })
+    .await;
+
+    cx.open_tmp("abc", zi::OpenFlags::SPAWN_LANGUAGE_SERVICES).await?;
+
+    // The restarted server should be sent the open buffer again.
+    for _ in 0..50 {
+        if opens.load(atomic::Ordering::Relaxed) >= 2 {
+            break;
+        }
+        tokio::time::sleep(Duration::from_millis(10)).await;
+    }
+    assert_eq!(opens.load(atomic::Ordering::Relaxed), 2);
+
+    cx.with(|editor| {
+        assert!(editor.get_error().unwrap().contains("restarting"));
+        assert_eq!(editor.active_language_services.len(), 1);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn lsp_restart_does_not_reopen_in_other_services() -> zi::Result<()> {
+    let cx = new("").await;
+    let opens = Arc::new(AtomicUsize::new(0));
+    let other_opens = Arc::new(AtomicUsize::new(0));
+
+    let template = |opens: &Arc<AtomicUsize>| {
+        FakeLanguageServer::builder()
+            .request::<request::Initialize, _>(|_, _| async {
+                Ok(lsp_types::InitializeResult::default())
+            })
+            .notification::<notification::Initialized>(|_st, _params| Ok(()))
+            .notification::<notification::DidOpenTextDocument>(|opens: &mut Arc<AtomicUsize>, _| {
+                opens.fetch_add(1, atomic::Ordering::Relaxed);
+                Ok(())
+            })
+            .finish(Arc::clone(opens))
+    };
+
+    cx.with({
+        let crashing = template(&opens);
+        let other = template(&other_opens);
+        move |editor| {
+            editor
+                .language_config_mut()
+                .add_language(
+                    zi::filetype!(text),
+                    zi::LanguageConfig::new(["test-server".into(), "other-server".into()]),
+                )
+                .add_language_service(
+                    "test-server",
+                    CrashOnce { template: crashing, spawns: AtomicUsize::new(0) },
+                )
+                .add_language_service("other-server", other);
+        }
+    })
+    .await;
+
+    cx.open_tmp("abc", zi::OpenFlags::SPAWN_LANGUAGE_SERVICES).await?;
+
+    for _ in 0..50 {
+        if opens.load(atomic::Ordering::Relaxed) >= 2 {
+            break;
+        }
+        tokio::time::sleep(Duration::from_millis(10)).await;
+    }
+    assert_eq!(opens.load(atomic::Ordering::Relaxed), 2);
+    // Syncing the restarted server must not send the buffer to the server that stayed up.
+    assert_eq!(other_opens.load(atomic::Ordering::Relaxed), 1);
+
+    cx.cleanup().await;
+    Ok(())
+}
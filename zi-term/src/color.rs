@@ -0,0 +1,230 @@
+use std::collections::HashMap;
+use std::str::FromStr;
+use std::{fmt, io};
+
+use tui::backend::{Backend, ClearType, WindowSize};
+use tui::buffer::Cell;
+use tui::{Color, Rect};
+
+/// The color capabilities of the terminal.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum ColorSupport {
+    #[default]
+    TrueColor,
+    Ansi256,
+    Ansi16,
+}
+
+impl ColorSupport {
+    /// Detect the color support of the terminal from `$COLORTERM` and `$TERM`.
+    pub fn detect() -> Self {
+        Self::from_env(std::env::var("COLORTERM").ok(), std::env::var("TERM").ok())
+    }
+
+    pub fn from_env(colorterm: Option<String>, term: Option<String>) -> Self {
+        if let Some("truecolor" | "24bit") = colorterm.as_deref() {
+            return ColorSupport::TrueColor;
+        }
+
+        match term.as_deref() {
+            Some(term) if term.ends_with("-direct") || term.contains("truecolor") => {
+                ColorSupport::TrueColor
+            }
+            Some(term) if term.contains("256color") => ColorSupport::Ansi256,
+            // Most terminals support truecolor nowadays, so we assume it if we can't tell.
+            None => ColorSupport::TrueColor,
+            Some(_) => ColorSupport::Ansi16,
+        }
+    }
+}
+
+impl FromStr for ColorSupport {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "truecolor" | "24bit" => Ok(ColorSupport::TrueColor),
+            "256" => Ok(ColorSupport::Ansi256),
+            "16" => Ok(ColorSupport::Ansi16),
+            _ => anyhow::bail!("invalid color support: {s} (expected one of truecolor, 256, 16)"),
+        }
+    }
+}
+
+impl fmt::Display for ColorSupport {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            ColorSupport::TrueColor => write!(f, "truecolor"),
+            ColorSupport::Ansi256 => write!(f, "256"),
+            ColorSupport::Ansi16 => write!(f, "16"),
+        }
+    }
+}
+
+/// A backend wrapper that downsamples colors to what the terminal supports right before they are drawn.
+pub struct ColorBackend<B> {
+    backend: B,
+    support: ColorSupport,
+    // Cache of the nearest palette color for each color we've seen, the search is not free and
+    // there are very few distinct colors per frame.
+    cache: HashMap<Color, Color>,
+}
+
+impl<B> ColorBackend<B> {
+    pub fn new(backend: B, support: ColorSupport) -> Self {
+        Self { backend, support, cache: Default::default() }
+    }
+
+    pub fn support(&self) -> ColorSupport {
+        self.support
+    }
+
+    fn degrade(&mut self, color: Color) -> Color {
+        let support = self.support;
+        *self.cache.entry(color).or_insert_with(|| degrade(support, color))
+    }
+}
+
+fn degrade(support: ColorSupport, color: Color) -> Color {
+    match support {
+        ColorSupport::TrueColor => color,
+        ColorSupport::Ansi256 => match color {
+            Color::Rgb(r, g, b) => Color::Indexed(nearest_256((r, g, b))),
+            _ => color,
+        },
+        ColorSupport::Ansi16 => match color {
+            Color::Rgb(r, g, b) => nearest_16((r, g, b)),
+            Color::Indexed(i) if i >= 16 => nearest_16(indexed_to_rgb(i)),
+            Color::Indexed(i) => ANSI_16[i as usize].0,
+            _ => color,
+        },
+    }
+}
+
+type Rgb = (u8, u8, u8);
+
+const CUBE_LEVELS: [u8; 6] = [0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff];
+
+// The colors are the xterm defaults, terminals are free to choose their own so this is only an approximation.
+const ANSI_16: [(Color, Rgb); 16] = [
+    (Color::Black, (0x00, 0x00, 0x00)),
+    (Color::Red, (0x80, 0x00, 0x00)),
+    (Color::Green, (0x00, 0x80, 0x00)),
+    (Color::Yellow, (0x80, 0x80, 0x00)),
+    (Color::Blue, (0x00, 0x00, 0x80)),
+    (Color::Magenta, (0x80, 0x00, 0x80)),
+    (Color::Cyan, (0x00, 0x80, 0x80)),
+    (Color::Gray, (0xc0, 0xc0, 0xc0)),
+    (Color::DarkGray, (0x80, 0x80, 0x80)),
+    (Color::LightRed, (0xff, 0x00, 0x00)),
+    (Color::LightGreen, (0x00, 0xff, 0x00)),
+    (Color::LightYellow, (0xff, 0xff, 0x00)),
+    (Color::LightBlue, (0x00, 0x00, 0xff)),
+    (Color::LightMagenta, (0xff, 0x00, 0xff)),
+    (Color::LightCyan, (0x00, 0xff, 0xff)),
+    (Color::White, (0xff, 0xff, 0xff)),
+];
+
+fn distance((r1, g1, b1): Rgb, (r2, g2, b2): Rgb) -> u32 {
+    let d = |a: u8, b: u8| (a as i32 - b as i32).pow(2) as u32;
+    d(r1, r2) + d(g1, g2) + d(b1, b2)
+}
+
+fn indexed_to_rgb(i: u8) -> Rgb {
+    match i {
+        0..16 => ANSI_16[i as usize].1,
+        16..232 => {
+            let i = i - 16;
+            (
+                CUBE_LEVELS[(i / 36) as usize],
+                CUBE_LEVELS[(i / 6 % 6) as usize],
+                CUBE_LEVELS[(i % 6) as usize],
+            )
+        }
+        232.. => {
+            let v = 8 + 10 * (i - 232);
+            (v, v, v)
+        }
+    }
+}
+
+fn nearest_256(rgb: Rgb) -> u8 {
+    // Only consider the color cube and the grayscale ramp, the first 16 colors are commonly remapped by the terminal.
+    (16..=255).min_by_key(|&i| distance(rgb, indexed_to_rgb(i))).unwrap()
+}
+
+fn nearest_16(rgb: Rgb) -> Color {
+    ANSI_16.iter().min_by_key(|(_, c)| distance(rgb, *c)).unwrap().0
+}
+
+impl<B: Backend> Backend for ColorBackend<B> {
+    fn draw<'a, I>(&mut self, content: I) -> io::Result<()>
+    where
+        I: Iterator<Item = (u16, u16, &'a Cell)>,
+    {
+        if self.support == ColorSupport::TrueColor {
+            return self.backend.draw(content);
+        }
+
+        let cells = content
+            .map(|(x, y, cell)| {
+                let mut cell = cell.clone();
+                cell.fg = self.degrade(cell.fg);
+                cell.bg = self.degrade(cell.bg);
+                (x, y, cell)
+            })
+            .collect::<Vec<_>>();
+
+        self.backend.draw(cells.iter().map(|(x, y, cell)| (*x, *y, cell)))
+    }
+
+    fn append_lines(&mut self, n: u16) -> io::Result<()> {
+        self.backend.append_lines(n)
+    }
+
+    fn hide_cursor(&mut self) -> io::Result<()> {
+        self.backend.hide_cursor()
+    }
+
+    fn show_cursor(&mut self) -> io::Result<()> {
+        self.backend.show_cursor()
+    }
+
+    fn get_cursor(&mut self) -> io::Result<(u16, u16)> {
+        self.backend.get_cursor()
+    }
+
+    fn set_cursor(&mut self, x: u16, y: u16) -> io::Result<()> {
+        self.backend.set_cursor(x, y)
+    }
+
+    fn clear(&mut self) -> io::Result<()> {
+        self.backend.clear()
+    }
+
+    fn clear_region(&mut self, clear_type: ClearType) -> io::Result<()> {
+        self.backend.clear_region(clear_type)
+    }
+
+    fn size(&self) -> io::Result<Rect> {
+        self.backend.size()
+    }
+
+    fn window_size(&mut self) -> io::Result<WindowSize> {
+        self.backend.window_size()
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        Backend::flush(&mut self.backend)
+    }
+}
+
+impl<B: io::Write> io::Write for ColorBackend<B> {
+    fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+        self.backend.write(buf)
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        io::Write::flush(&mut self.backend)
+    }
+}
@@ -3,7 +3,10 @@ use std::io;
 use std::sync::mpsc::Receiver;
 
 use crossterm::cursor::SetCursorStyle;
-use crossterm::event::DisableMouseCapture;
+use crossterm::event::{
+    DisableBracketedPaste, DisableFocusChange, DisableMouseCapture, EnableBracketedPaste,
+    EnableFocusChange, EnableMouseCapture,
+};
 use crossterm::terminal::EnterAlternateScreen;
 use crossterm::{cursor, execute, terminal};
 use futures_util::Stream;
@@ -12,6 +15,10 @@ use tui::{Backend, Terminal};
 use zi::Editor;
 use zi::input::Event;
 
+pub use self::color::{ColorBackend, ColorSupport};
+
+mod color;
+
 #[global_allocator]
 static GLOBAL: MiMalloc = MiMalloc;
 
@@ -26,7 +33,15 @@ impl<B: Backend + io::Write> App<B> {
     }
 
     pub fn enter(&mut self) -> io::Result<()> {
-        execute!(self.term.backend_mut(), EnterAlternateScreen, DisableMouseCapture)?;
+        execute!(
+            self.term.backend_mut(),
+            EnterAlternateScreen,
+            EnableMouseCapture,
+            // Have the terminal mark pasted text so it's inserted literally rather than typed.
+            EnableBracketedPaste,
+            // Used to refresh state that may have changed while the editor was in the background (e.g. the git branch).
+            EnableFocusChange
+        )?;
         terminal::enable_raw_mode()?;
         Ok(())
     }
@@ -64,7 +79,13 @@ impl<B: Backend + io::Write> App<B> {
 
 impl<W: Backend + io::Write> Drop for App<W> {
     fn drop(&mut self) {
-        _ = execute!(self.term.backend_mut(), crossterm::terminal::LeaveAlternateScreen);
+        _ = execute!(
+            self.term.backend_mut(),
+            DisableBracketedPaste,
+            DisableFocusChange,
+            DisableMouseCapture,
+            crossterm::terminal::LeaveAlternateScreen
+        );
         _ = terminal::disable_raw_mode();
 
         if let Ok((panic, backtrace)) = self.panic_rx.try_recv() {
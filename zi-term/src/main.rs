@@ -19,6 +19,12 @@ struct Opts {
     path: Option<PathBuf>,
     #[clap(long)]
     readonly: bool,
+    /// Override the detected terminal color support (truecolor, 256, or 16).
+    #[clap(long)]
+    colors: Option<zi_term::ColorSupport>,
+    /// Restore a session saved with `:mksession`, the path is opened on top of it.
+    #[clap(short = 'S', long)]
+    session: Option<PathBuf>,
 }
 
 #[tokio::main]
@@ -41,12 +47,21 @@ async fn main() -> anyhow::Result<()> {
             .init();
     }
 
-    let stdout = io::stdout().lock();
-    let term = Terminal::new(CrosstermBackend::new(stdout))?;
+    // Buffer the output so each frame's diff is flushed to the terminal in a single write.
+    let stdout = io::BufWriter::new(io::stdout().lock());
+    let colors = opts.colors.unwrap_or_else(zi_term::ColorSupport::detect);
+    let term = Terminal::new(zi_term::ColorBackend::new(CrosstermBackend::new(stdout), colors))?;
     let (mut editor, tasks) = zi::Editor::new(zi_wasm::WasmBackend::default(), term.size()?);
 
     assert!(editor.register_plugin_manager(zi_wasm::PluginManager::default()).is_none());
 
+    // Don't refuse to start over a broken config, the error is shown in the status line instead.
+    if let Err(err) = editor.load_config(zi::dirs::config().join("config.toml")) {
+        editor.set_error(err);
+    }
+    editor.set_snippet_dir(zi::dirs::snippets());
+    editor.set_position_file(zi::dirs::positions());
+
     let init_path = zi::dirs::config().join("init.zi");
     if init_path.exists() {
         for cmd in std::fs::read_to_string(init_path)?.parse::<zi::Commands>()? {
@@ -69,6 +84,10 @@ async fn main() -> anyhow::Result<()> {
 
     let client = editor.client();
     tokio::spawn(async move {
+        if let Some(session) = opts.session {
+            client.with(move |editor| editor.load_session(session)).await?.await?;
+        }
+
         if let Some(path) = opts.path {
             if path.exists() && path.is_dir() {
                 std::env::set_current_dir(&path)?;
@@ -1,12 +1,15 @@
+use std::cell::RefCell;
 use std::fs::File;
 use std::future::Future;
-use std::io::{BufReader, Read};
+use std::io::{self, BufReader, Write};
 use std::path::{Path, PathBuf};
+use std::rc::Rc;
 
 use asciicast::Asciicast;
 use tui::Terminal;
-use tui::backend::CrosstermBackend;
+use tui::backend::{CrosstermBackend, TestBackend};
 use zi::OpenFlags;
+use zi_term::{ColorBackend, ColorSupport};
 
 #[tokio::test]
 async fn it_works() -> zi::Result<()> {
@@ -37,10 +40,111 @@ async fn syntax_highlight() -> anyhow::Result<()> {
     snapshot_path("multiline highlight", "tests/zi-term/testdata/multiline-highlight.rs").await?;
     snapshot_path("multiline highlight 2", "tests/zi-term/testdata/multiline-highlight-2.rs")
         .await?;
+    snapshot_path("html injection", "tests/zi-term/testdata/injection.html").await?;
 
     Ok(())
 }
 
+#[tokio::test]
+async fn injection_highlight() -> anyhow::Result<()> {
+    let (width, height) = (80, 20);
+    let (mut editor, tasks) = zi::Editor::new(zi_wasm::WasmBackend::default(), (width, height));
+    let client = editor.client();
+    tokio::spawn(async move {
+        editor.run(futures_util::stream::empty(), tasks, |_editor| Ok(())).await.unwrap()
+    });
+
+    client
+        .with(|editor| editor.open("tests/zi-term/testdata/injection.html", OpenFlags::empty()))
+        .await?
+        .await?;
+
+    let buffer = client
+        .with(move |editor| {
+            let mut term = Terminal::new(TestBackend::new(width, height))?;
+            term.draw(|f| editor.render(f))?;
+            Ok::<_, zi::Error>(term.backend().buffer().clone())
+        })
+        .await?;
+
+    // The color of the first cell of the word on the row.
+    let fg = |row: usize, word: &str| {
+        let cells = &buffer.content[row * width as usize..(row + 1) * width as usize];
+        let line = cells.iter().map(|cell| cell.symbol()).collect::<String>();
+        let col = line.find(word).unwrap_or_else(|| panic!("`{word}` not found in `{line}`"));
+        cells[col].fg
+    };
+
+    // The text of the `p` element isn't highlighted, the contents of the `style` element are highlighted as css.
+    let plain = fg(12, "hello");
+    assert_ne!(fg(6, "color"), plain, "the css property should be highlighted");
+    assert_ne!(fg(7, "auto"), plain, "the css value should be highlighted");
+
+    Ok(())
+}
+
+#[tokio::test]
+async fn color_support() -> anyhow::Result<()> {
+    for support in [ColorSupport::TrueColor, ColorSupport::Ansi256, ColorSupport::Ansi16] {
+        let name = format!("rust {support} colors");
+        let output = snapshot_with(&name, support, |client| async move {
+            client
+                .with(|editor| editor.open("tests/zi-term/testdata/main.rs", OpenFlags::empty()))
+                .await?
+                .await?;
+            Ok(())
+        })
+        .await?;
+
+        // Only the colors the terminal supports may be written, the casts alone would happily record any.
+        let truecolor = output.contains("38;2;") || output.contains("48;2;");
+        let indexed = indexed_colors(&output);
+        match support {
+            ColorSupport::TrueColor => assert!(truecolor, "truecolor output should use rgb colors"),
+            ColorSupport::Ansi256 => {
+                assert!(!truecolor, "256 color output shouldn't use rgb colors");
+                assert!(
+                    indexed.iter().any(|&i| i >= 16),
+                    "256 color output should use the palette"
+                );
+            }
+            ColorSupport::Ansi16 => {
+                assert!(!truecolor, "16 color output shouldn't use rgb colors");
+                assert!(indexed.iter().all(|&i| i < 16), "16 color output used {indexed:?}");
+            }
+        }
+    }
+
+    Ok(())
+}
+
+/// The palette indices of the `38;5;n` and `48;5;n` colors in the output.
+fn indexed_colors(output: &str) -> Vec<u8> {
+    ["38;5;", "48;5;"]
+        .iter()
+        .flat_map(|sgr| output.split(sgr).skip(1))
+        .filter_map(|rest| {
+            let end = rest.find(|c: char| !c.is_ascii_digit()).unwrap_or(rest.len());
+            rest[..end].parse().ok()
+        })
+        .collect()
+}
+
+#[test]
+fn color_support_detection() {
+    let detect = |colorterm: Option<&str>, term: Option<&str>| {
+        ColorSupport::from_env(colorterm.map(Into::into), term.map(Into::into))
+    };
+
+    assert_eq!(detect(Some("truecolor"), Some("xterm")), ColorSupport::TrueColor);
+    assert_eq!(detect(Some("24bit"), None), ColorSupport::TrueColor);
+    assert_eq!(detect(None, Some("xterm-direct")), ColorSupport::TrueColor);
+    assert_eq!(detect(None, Some("xterm-256color")), ColorSupport::Ansi256);
+    assert_eq!(detect(None, Some("screen-256color")), ColorSupport::Ansi256);
+    assert_eq!(detect(None, Some("xterm")), ColorSupport::Ansi16);
+    assert_eq!(detect(None, Some("linux")), ColorSupport::Ansi16);
+}
+
 #[tokio::test]
 async fn scroll() -> anyhow::Result<()> {
     snapshot("scroll text", |client| async move {
@@ -79,6 +183,120 @@ async fn scroll() -> anyhow::Result<()> {
     Ok(())
 }
 
+#[tokio::test]
+async fn syntax_fold() -> anyhow::Result<()> {
+    snapshot("fold go", |client| async move {
+        client
+            .with(|editor| editor.open("tests/zi-term/testdata/main.go", OpenFlags::empty()))
+            .await?
+            .await?;
+        client
+            .with(|editor| {
+                editor.set_cursor(zi::Active, (9, 0));
+                editor.input("za").unwrap();
+            })
+            .await;
+        Ok(())
+    })
+    .await?;
+
+    let (width, height) = (80, 50);
+    let (mut editor, tasks) = zi::Editor::new(zi_wasm::WasmBackend::default(), (width, height));
+    let client = editor.client();
+    tokio::spawn(async move {
+        editor.run(futures_util::stream::empty(), tasks, |_editor| Ok(())).await.unwrap()
+    });
+
+    client
+        .with(|editor| editor.open("tests/zi-term/testdata/main.go", OpenFlags::empty()))
+        .await?
+        .await?;
+
+    let (rows, buffer) = client
+        .with(move |editor| {
+            editor.set_cursor(zi::Active, (9, 0));
+            editor.input("za").unwrap();
+            let mut term = Terminal::new(TestBackend::new(width, height))?;
+            term.draw(|f| editor.render(f))?;
+            let buffer = term.backend().buffer().clone();
+            let rows = buffer
+                .content
+                .chunks(width as usize)
+                .map(|row| row.iter().map(|cell| cell.symbol()).collect::<String>())
+                .map(|row| row.trim_end().to_owned())
+                .collect::<Vec<_>>();
+            Ok::<_, zi::Error>((rows, buffer))
+        })
+        .await?;
+
+    // `main` spans lines 10 to 42 and is rendered as its first line.
+    assert_eq!(rows[8], "   9");
+    assert_eq!(rows[9], "  10 func main() { ... (33 lines)");
+    assert!(rows.iter().all(|row| !row.contains("ListenAndServe")), "{rows:#?}");
+
+    // The summary is drawn in the `ui.folded` color rather than the color of the code before it.
+    let cell = |col: usize| &buffer.content[9 * width as usize + col];
+    let summary = rows[9].find("...").unwrap();
+    assert_eq!(cell(summary).fg, tui::Color::Rgb(0x58, 0x6e, 0x75));
+    assert_ne!(cell(summary).fg, cell(rows[9].find("func").unwrap()).fg);
+
+    Ok(())
+}
+
+#[tokio::test]
+async fn incremental_redraw() -> anyhow::Result<()> {
+    let (mut editor, tasks) = zi::Editor::new(zi_wasm::WasmBackend::default(), (200, 50));
+    let client = editor.client();
+    tokio::spawn(async move {
+        editor.run(futures_util::stream::empty(), tasks, |_editor| Ok(())).await.unwrap()
+    });
+
+    client
+        .with(|editor| editor.open("tests/zi-term/testdata/numbers.txt", OpenFlags::empty()))
+        .await?
+        .await?;
+
+    let (full, incremental) = client
+        .with(|editor| {
+            let bytes = SharedWriter::default();
+            let mut term = Terminal::new(CrosstermBackend::new(bytes.clone()))?;
+            editor.input("i").unwrap();
+            term.draw(|f| editor.render(f))?;
+            let full = bytes.take().len();
+
+            editor.input("x").unwrap();
+            term.draw(|f| editor.render(f))?;
+            let incremental = bytes.take().len();
+            Ok::<_, zi::Error>((full, incremental))
+        })
+        .await?;
+
+    // Only the edited line and the statusline should be redrawn, not the entire screen.
+    assert!(incremental < 512, "incremental redraw wrote {incremental} bytes (full: {full})");
+    assert!(incremental * 10 < full, "incremental redraw wrote {incremental} bytes (full: {full})");
+
+    Ok(())
+}
+
+#[derive(Default, Clone)]
+struct SharedWriter(Rc<RefCell<Vec<u8>>>);
+
+impl SharedWriter {
+    fn take(&self) -> Vec<u8> {
+        std::mem::take(&mut self.0.borrow_mut())
+    }
+}
+
+impl Write for SharedWriter {
+    fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+        self.0.borrow_mut().write(buf)
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        Ok(())
+    }
+}
+
 async fn snapshot_path(name: &'static str, path: impl AsRef<Path>) -> anyhow::Result<()> {
     let path = path.as_ref().to_path_buf();
     snapshot(name, |client| async move {
@@ -89,6 +307,18 @@ async fn snapshot_path(name: &'static str, path: impl AsRef<Path>) -> anyhow::Re
 }
 
 async fn snapshot<Fut>(name: &'static str, f: impl FnOnce(zi::Client) -> Fut) -> anyhow::Result<()>
+where
+    Fut: Future<Output = zi::Result<()>>,
+{
+    snapshot_with(name, ColorSupport::TrueColor, f).await.map(drop)
+}
+
+/// Compare the rendered output to the cast of the same name, the output is returned to check against as well.
+async fn snapshot_with<Fut>(
+    name: &str,
+    support: ColorSupport,
+    f: impl FnOnce(zi::Client) -> Fut,
+) -> anyhow::Result<String>
 where
     Fut: Future<Output = zi::Result<()>>,
 {
@@ -101,13 +331,14 @@ where
     });
     f(client.clone()).await?;
 
-    let bytes = client
+    let output = client
         .with(move |editor| {
             let mut bytes = vec![];
-            let mut term = Terminal::new(CrosstermBackend::new(&mut bytes))?;
+            let mut term =
+                Terminal::new(ColorBackend::new(CrosstermBackend::new(&mut bytes), support))?;
             term.draw(|f| editor.render(f)).unwrap();
             drop(term);
-            Ok::<_, zi::Error>(bytes)
+            Ok::<_, zi::Error>(String::from_utf8(bytes)?)
         })
         .await?;
 
@@ -115,28 +346,21 @@ where
     let dir = PathBuf::from("tests/zi-term/asciicasts");
 
     let cast = Asciicast::new(width, height, [
-        asciicast::Event {
-            kind: asciicast::EventKind::Output(String::from_utf8(bytes).unwrap()),
-            time_us: 0,
-        },
+        asciicast::Event { kind: asciicast::EventKind::Output(output.clone()), time_us: 0 },
         asciicast::Event { kind: asciicast::EventKind::Output(String::from("\n")), time_us: 1 },
     ]);
 
     let path = dir.join(format!("{name}.cast"));
 
-    let mut expected = vec![];
-    if path.exists() {
-        File::open(&path)?.read_to_end(&mut expected)?;
-    } else {
-        return Ok(cast.write_to(File::create(&path)?)?);
-    }
-
+    // A missing cast fails rather than being recorded, otherwise a forgotten cast passes without checking anything.
     if std::env::var("UPDATE_EXPECT").is_ok() {
         cast.write_to(File::create(&path)?)?;
+    } else if !path.exists() {
+        anyhow::bail!("missing cast `{}`, run with `UPDATE_EXPECT=1` to record it", path.display());
     } else {
         let existing = Asciicast::read_from(BufReader::new(File::open(&path)?))?;
         assert_eq!(existing, cast);
     }
 
-    Ok(())
+    Ok(output)
 }
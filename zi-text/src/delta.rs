@@ -129,6 +129,82 @@ impl<'a> Deltas<'a> {
     pub fn to_owned(&self) -> Deltas<'static> {
         Deltas::new(self.deltas.iter().map(|d| d.to_owned()))
     }
+
+    /// The line-wise deltas that transform `old` into `new`, lines common to both are left untouched.
+    /// Identical texts produce no deltas.
+    pub fn diff(old: &str, new: &str) -> Deltas<'static> {
+        // Beyond this many lines squared, the changed region is replaced in one go rather than diffed.
+        const MAX_DIFF_CELLS: usize = 1 << 22;
+
+        let old_lines = old.split_inclusive('\n').collect::<Vec<_>>();
+        let new_lines = new.split_inclusive('\n').collect::<Vec<_>>();
+
+        let prefix = old_lines.iter().zip(&new_lines).take_while(|(a, b)| a == b).count();
+        let suffix = old_lines[prefix..]
+            .iter()
+            .rev()
+            .zip(new_lines[prefix..].iter().rev())
+            .take_while(|(a, b)| a == b)
+            .count();
+
+        let a = &old_lines[prefix..old_lines.len() - suffix];
+        let b = &new_lines[prefix..new_lines.len() - suffix];
+        let start = old_lines[..prefix].iter().map(|line| line.len()).sum::<usize>();
+        if a.is_empty() && b.is_empty() {
+            return Deltas::empty();
+        }
+
+        let (n, m) = (a.len(), b.len());
+        if n.saturating_mul(m) > MAX_DIFF_CELLS {
+            let len = a.iter().map(|line| line.len()).sum::<usize>();
+            return Deltas::single(start..start + len, b.concat());
+        }
+
+        // `lcs[i * (m + 1) + j]` is the length of the longest common subsequence of `a[i..]` and `b[j..]`.
+        let mut lcs = vec![0u32; (n + 1) * (m + 1)];
+        for i in (0..n).rev() {
+            for j in (0..m).rev() {
+                lcs[i * (m + 1) + j] = if a[i] == b[j] {
+                    lcs[(i + 1) * (m + 1) + j + 1] + 1
+                } else {
+                    lcs[(i + 1) * (m + 1) + j].max(lcs[i * (m + 1) + j + 1])
+                };
+            }
+        }
+
+        let mut deltas = vec![];
+        // The byte offset in `old` of `a[i]`, and where the current run of changed lines started.
+        let mut offset = start;
+        let mut gap: Option<(usize, usize)> = None;
+        let (mut i, mut j) = (0, 0);
+        loop {
+            let matched = i < n && j < m && a[i] == b[j];
+            if matched || (i == n && j == m) {
+                if let Some((gap_start, gap_j)) = gap.take() {
+                    deltas.push(Delta::new(gap_start..offset, b[gap_j..j].concat()));
+                }
+
+                if !matched {
+                    break;
+                }
+
+                offset += a[i].len();
+                i += 1;
+                j += 1;
+                continue;
+            }
+
+            gap.get_or_insert((offset, j));
+            if j == m || (i < n && lcs[(i + 1) * (m + 1) + j] >= lcs[i * (m + 1) + j + 1]) {
+                offset += a[i].len();
+                i += 1;
+            } else {
+                j += 1;
+            }
+        }
+
+        Deltas::new(deltas)
+    }
 }
 
 #[derive(Clone)]
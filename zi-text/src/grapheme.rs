@@ -0,0 +1,47 @@
+//! Grapheme cluster boundaries within a single line (excluding the newline).
+//! Offsets past the end of the line have no boundaries, the caller is expected to deal with the newline.
+
+use unicode_segmentation::GraphemeCursor;
+
+/// The start of the grapheme cluster containing `offset`.
+pub(crate) fn floor(line: &str, offset: usize) -> usize {
+    if offset >= line.len() {
+        return offset;
+    }
+
+    let offset = floor_char_boundary(line, offset);
+    let mut cursor = GraphemeCursor::new(offset, line.len(), true);
+    if let Ok(true) = cursor.is_boundary(line, 0) {
+        return offset;
+    }
+
+    cursor.prev_boundary(line, 0).ok().flatten().unwrap_or(0)
+}
+
+/// The end of the grapheme cluster containing `offset`, `None` if `offset` is not within the line.
+pub(crate) fn next(line: &str, offset: usize) -> Option<usize> {
+    if offset >= line.len() {
+        return None;
+    }
+
+    let mut cursor = GraphemeCursor::new(floor_char_boundary(line, offset), line.len(), true);
+    Some(cursor.next_boundary(line, 0).ok().flatten().unwrap_or(line.len()))
+}
+
+/// The start of the grapheme cluster before `offset`, `None` if `offset` is at the start of the line.
+pub(crate) fn prev(line: &str, offset: usize) -> Option<usize> {
+    if offset == 0 {
+        return None;
+    }
+
+    let offset = floor(line, offset.min(line.len()));
+    let mut cursor = GraphemeCursor::new(offset, line.len(), true);
+    Some(cursor.prev_boundary(line, 0).ok().flatten().unwrap_or(0))
+}
+
+fn floor_char_boundary(s: &str, mut offset: usize) -> usize {
+    while !s.is_char_boundary(offset) {
+        offset -= 1;
+    }
+    offset
+}
@@ -4,6 +4,8 @@ mod cow_str_impl;
 mod cursor;
 mod delta;
 mod ext;
+mod grapheme;
+mod piece;
 mod readonly;
 mod rope;
 mod str_impl;
@@ -21,6 +23,7 @@ use zi_core::{Line, Point, PointOrByte, PointRange};
 
 pub use self::delta::{Delta, DeltaRange, Deltas};
 pub use self::ext::*;
+pub use self::piece::{PieceSlice, PieceText};
 pub use self::readonly::ReadonlyText;
 
 /// Text that can be modified.
@@ -563,6 +566,33 @@ pub trait Text: TextBase {
         self.char_before_byte(self.point_to_byte(point))
     }
 
+    /// Returns the byte index of the end of the grapheme cluster at the given byte.
+    /// Grapheme clusters never span lines, a newline is a cluster by itself.
+    fn next_grapheme_boundary(&self, byte_idx: usize) -> usize {
+        let (line_start, line) = line_containing(self, byte_idx);
+        match grapheme::next(&line, byte_idx - line_start) {
+            Some(offset) => line_start + offset,
+            None => byte_idx + self.char_at_byte(byte_idx).map_or(0, |c| c.len_utf8()),
+        }
+    }
+
+    /// Returns the byte index of the start of the grapheme cluster before the given byte.
+    fn prev_grapheme_boundary(&self, byte_idx: usize) -> usize {
+        let (line_start, line) = line_containing(self, byte_idx);
+        match grapheme::prev(&line, byte_idx - line_start) {
+            Some(offset) => line_start + offset,
+            None => byte_idx - self.char_before_byte(byte_idx).map_or(0, |c| c.len_utf8()),
+        }
+    }
+
+    /// Returns the byte index of the start of the grapheme cluster containing the given byte.
+    /// This is useful for moving a byte index that may be in the middle of a cluster (or a
+    /// character) onto a valid cursor position.
+    fn grapheme_start(&self, byte_idx: usize) -> usize {
+        let (line_start, line) = line_containing(self, byte_idx);
+        line_start + grapheme::floor(&line, byte_idx - line_start)
+    }
+
     /// Returns the byte index of the first non-whitespace character on the line.
     #[inline]
     fn indent(&self) -> usize {
@@ -586,6 +616,13 @@ pub trait Text: TextBase {
     }
 }
 
+/// The start of the line containing the byte and its contents.
+fn line_containing<T: Text + ?Sized>(text: &T, byte_idx: usize) -> (usize, Cow<'_, str>) {
+    let line_idx = text.byte_to_line(byte_idx);
+    let line = text.line(line_idx).map(|line| line.to_cow()).unwrap_or_default();
+    (text.line_to_byte(line_idx), line)
+}
+
 /// The returned chunks are guaranteed to be single-line
 pub fn annotate<'a, S, A>(
     lines: impl Iterator<Item = S> + 'a,
@@ -860,15 +897,16 @@ impl<I> TextReader<'_, I> {
     }
 }
 
-impl<'a, I> Read for TextReader<'a, I>
+impl<'a, I, B> Read for TextReader<'a, I>
 where
-    I: Iterator<Item = &'a str>,
+    I: Iterator<Item = &'a B>,
+    B: AsRef<[u8]> + ?Sized + 'a,
 {
     #[inline]
     fn read(&mut self, buf: &mut [u8]) -> std::io::Result<usize> {
         if self.chunk.is_empty() {
             let Some(chunk) = self.chunks.next() else { return Ok(0) };
-            self.chunk = chunk.as_bytes();
+            self.chunk = chunk.as_ref();
         }
 
         let n = buf.len().min(self.chunk.len());
@@ -0,0 +1,693 @@
+use core::fmt;
+use std::borrow::Cow;
+use std::fs::File;
+use std::io::{self, Read};
+use std::ops::{self, Bound, RangeBounds};
+use std::path::Path;
+use std::sync::{Arc, OnceLock};
+use std::{iter, str};
+
+use memmap2::MmapOptions;
+
+use crate::delta::TextReplace;
+use crate::{AnyTextMut, Deltas, Text, TextBase, TextMut, TextReader, TextSlice};
+
+/// The number of bytes of the file that are loaded at a time.
+const CHUNK_SIZE: usize = 1 << 16;
+
+/// A piece table over a file that is too large to load up front.
+/// The file is memory mapped and only loaded a chunk at a time where the text is looked at, edits are kept as pieces
+/// of inserted text between the untouched parts of the file.
+/// Counting lines still reads through the file, but only the number of newlines in each chunk is kept.
+///
+/// This is meant for the occasional edit to a large file (e.g. a log), each edit adds pieces and most operations are
+/// linear in the number of pieces.
+#[derive(Clone)]
+pub struct PieceText {
+    original: Arc<Original>,
+    pieces: Vec<Piece>,
+    len: usize,
+}
+
+#[derive(Clone)]
+struct Piece {
+    source: Source,
+    /// The range of the source this piece is made of.
+    range: ops::Range<usize>,
+    /// The offset of the piece in the text.
+    offset: usize,
+}
+
+#[derive(Clone)]
+enum Source {
+    Original,
+    /// Text inserted by an edit.
+    Added(Arc<str>),
+}
+
+/// The file the text was created from.
+struct Original {
+    bytes: Box<dyn AsRef<[u8]> + Send + Sync>,
+    chunk_size: usize,
+    /// Set once the chunk has been checked to be utf-8, only checked chunks are handed out as `str`s.
+    /// A chunk that isn't utf-8 is replaced by a copy with `REPLACEMENT` in place of each invalid byte.
+    loaded: Box<[OnceLock<Option<Box<str>>>]>,
+    /// The number of newlines in each chunk, counted the first time they're needed.
+    newlines: Box<[OnceLock<usize>]>,
+}
+
+impl Original {
+    fn new(bytes: Box<dyn AsRef<[u8]> + Send + Sync>, chunk_size: usize) -> Self {
+        assert!(chunk_size >= 4, "chunks must be able to hold any char");
+        let n = (*bytes).as_ref().len().div_ceil(chunk_size);
+        Self {
+            bytes,
+            chunk_size,
+            loaded: (0..n).map(|_| OnceLock::new()).collect(),
+            newlines: (0..n).map(|_| OnceLock::new()).collect(),
+        }
+    }
+
+    #[inline]
+    fn bytes(&self) -> &[u8] {
+        (*self.bytes).as_ref()
+    }
+
+    /// The start of the chunk, chunks are moved forward onto a char boundary so they can be checked separately.
+    /// A char has at most three continuation bytes, any more are invalid anyway and the chunk starts among them.
+    fn chunk_start(&self, chunk: usize) -> usize {
+        let bytes = self.bytes();
+        if chunk == 0 {
+            return 0;
+        }
+
+        let start = (chunk * self.chunk_size).min(bytes.len());
+        let mut end = start;
+        while end < bytes.len() && end - start < 3 && is_continuation_byte(bytes[end]) {
+            end += 1;
+        }
+        end
+    }
+
+    #[inline]
+    fn chunk_range(&self, chunk: usize) -> ops::Range<usize> {
+        self.chunk_start(chunk)..self.chunk_start(chunk + 1)
+    }
+
+    /// The chunk containing the byte, which must be within bounds.
+    fn chunk_of(&self, byte_idx: usize) -> usize {
+        let chunk = byte_idx / self.chunk_size;
+        if byte_idx < self.chunk_start(chunk) { chunk - 1 } else { chunk }
+    }
+
+    /// The chunks overlapping the range.
+    fn chunks_in(&self, range: &ops::Range<usize>) -> ops::Range<usize> {
+        if range.is_empty() {
+            return 0..0;
+        }
+        self.chunk_of(range.start)..self.chunk_of(range.end - 1) + 1
+    }
+
+    /// The contents of the chunk, loading it if it hasn't been already.
+    fn chunk(&self, chunk: usize) -> &str {
+        let bytes = &self.bytes()[self.chunk_range(chunk)];
+        let replaced = self.loaded[chunk]
+            .get_or_init(|| str::from_utf8(bytes).is_err().then(|| replace_invalid(bytes)));
+        match replaced {
+            Some(replaced) => replaced,
+            // Safety: the chunk was checked to be utf-8 above.
+            None => unsafe { str::from_utf8_unchecked(bytes) },
+        }
+    }
+
+    /// The range split at chunk boundaries, a chunk is only loaded when the iterator reaches it.
+    fn strs(&self, range: ops::Range<usize>) -> impl DoubleEndedIterator<Item = &str> + Send + '_ {
+        self.chunks_in(&range).map(move |chunk| {
+            let chunk_range = self.chunk_range(chunk);
+            let start = range.start.max(chunk_range.start) - chunk_range.start;
+            let end = range.end.min(chunk_range.end) - chunk_range.start;
+            &self.chunk(chunk)[start..end]
+        })
+    }
+
+    fn chunk_newlines(&self, chunk: usize) -> usize {
+        *self.newlines[chunk].get_or_init(|| count_newlines(&self.bytes()[self.chunk_range(chunk)]))
+    }
+
+    /// The byte index of the `n`th newline in the range, or the number of newlines if there are fewer.
+    fn nth_newline(&self, range: ops::Range<usize>, n: usize) -> Result<usize, usize> {
+        let mut seen = 0;
+        for chunk in self.chunks_in(&range) {
+            let chunk_range = self.chunk_range(chunk);
+            let start = range.start.max(chunk_range.start);
+            let end = range.end.min(chunk_range.end);
+            // Whole chunks can be skipped using their count.
+            if (start..end) == chunk_range && seen + self.chunk_newlines(chunk) <= n {
+                seen += self.chunk_newlines(chunk);
+                continue;
+            }
+
+            match nth_newline(&self.bytes()[start..end], n - seen) {
+                Ok(i) => return Ok(start + i),
+                Err(count) => seen += count,
+            }
+        }
+
+        Err(seen)
+    }
+
+    fn count_newlines(&self, range: ops::Range<usize>) -> usize {
+        match self.nth_newline(range, usize::MAX) {
+            Ok(_) => unreachable!("there can't be that many newlines"),
+            Err(count) => count,
+        }
+    }
+}
+
+impl PieceText {
+    /// The bytes are expected to be utf-8, each byte of a chunk that isn't is shown as `REPLACEMENT`.
+    /// The invalid bytes are still there for [`Text::reader`], so writing the text out doesn't lose them.
+    pub fn new(bytes: impl AsRef<[u8]> + Send + Sync + 'static) -> Self {
+        Self::with_chunk_size(bytes, CHUNK_SIZE)
+    }
+
+    pub(crate) fn with_chunk_size(
+        bytes: impl AsRef<[u8]> + Send + Sync + 'static,
+        chunk_size: usize,
+    ) -> Self {
+        let original = Original::new(Box::new(bytes), chunk_size);
+        let len = original.bytes().len();
+        let pieces = match len {
+            0 => vec![],
+            _ => vec![Piece { source: Source::Original, range: 0..len, offset: 0 }],
+        };
+        Self { original: Arc::new(original), pieces, len }
+    }
+
+    /// Memory map the file.
+    ///
+    /// # Safety
+    ///
+    /// The file must not be modified while the text is alive, see [`memmap2::Mmap`].
+    /// Saving over it is fine as long as the new contents are written to a new file that replaces it.
+    pub unsafe fn open(path: impl AsRef<Path>) -> io::Result<Self> {
+        let file = File::open(path)?;
+        let map = unsafe { MmapOptions::new().map(&file)? };
+        Ok(Self::new(map))
+    }
+
+    /// Whether the chunk of the file containing the byte has been loaded.
+    /// The byte is an index into the file that was opened rather than into the edited text.
+    pub fn is_loaded(&self, byte_idx: usize) -> bool {
+        self.original.loaded[self.original.chunk_of(byte_idx)].get().is_some()
+    }
+
+    #[inline]
+    fn slice(&self) -> PieceSlice<'_> {
+        PieceSlice { text: self, range: 0..self.len }
+    }
+
+    #[inline]
+    fn source_bytes<'a>(&'a self, source: &'a Source) -> &'a [u8] {
+        match source {
+            Source::Original => self.original.bytes(),
+            Source::Added(text) => text.as_bytes(),
+        }
+    }
+
+    /// The parts of the pieces within the range, as the offset of the part in the text and its range of the source.
+    fn pieces_in(
+        &self,
+        range: ops::Range<usize>,
+    ) -> impl DoubleEndedIterator<Item = (usize, &Source, ops::Range<usize>)> + Send + '_ {
+        self.pieces.iter().filter_map(move |piece| {
+            let start = range.start.max(piece.offset);
+            let end = range.end.min(piece.offset + piece.range.len());
+            if start >= end {
+                return None;
+            }
+
+            let source_start = piece.range.start + start - piece.offset;
+            Some((start, &piece.source, source_start..source_start + end - start))
+        })
+    }
+
+    fn strs(&self, range: ops::Range<usize>) -> impl DoubleEndedIterator<Item = &str> + Send + '_ {
+        self.pieces_in(range).flat_map(move |(_, source, range)| match source {
+            Source::Original => Box::new(self.original.strs(range))
+                as Box<dyn DoubleEndedIterator<Item = &str> + Send + '_>,
+            Source::Added(text) => Box::new(iter::once(&text[range])),
+        })
+    }
+
+    fn byte(&self, byte_idx: usize) -> u8 {
+        let (_, source, range) =
+            self.pieces_in(byte_idx..byte_idx + 1).next().expect("byte index out of bounds");
+        self.source_bytes(source)[range.start]
+    }
+
+    /// The byte index of the `n`th newline in the range.
+    fn nth_newline(&self, range: ops::Range<usize>, n: usize) -> Option<usize> {
+        let mut seen = 0;
+        for (start, source, range) in self.pieces_in(range) {
+            let found = match source {
+                Source::Original => self.original.nth_newline(range.clone(), n - seen),
+                Source::Added(text) => {
+                    nth_newline(&text.as_bytes()[range.clone()], n - seen).map(|i| range.start + i)
+                }
+            };
+
+            match found {
+                Ok(i) => return Some(start + i - range.start),
+                Err(count) => seen += count,
+            }
+        }
+
+        None
+    }
+
+    fn rfind_newline(&self, range: ops::Range<usize>) -> Option<usize> {
+        self.pieces_in(range).rev().find_map(|(start, source, range)| {
+            self.source_bytes(source)[range].iter().rposition(|&b| b == b'\n').map(|i| start + i)
+        })
+    }
+
+    fn count_newlines(&self, range: ops::Range<usize>) -> usize {
+        self.pieces_in(range)
+            .map(|(_, source, range)| match source {
+                Source::Original => self.original.count_newlines(range),
+                Source::Added(text) => count_newlines(&text.as_bytes()[range]),
+            })
+            .sum()
+    }
+
+    /// The end of the line ending at the newline, excluding the carriage return of a `\r\n`.
+    fn line_end(&self, line_start: usize, newline: usize) -> usize {
+        if newline > line_start && self.byte(newline - 1) == b'\r' { newline - 1 } else { newline }
+    }
+
+    fn char_at(&self, byte_idx: usize) -> Option<char> {
+        // Only the chunk containing the byte is loaded as `strs` is lazy.
+        self.strs(byte_idx..self.len).next()?.chars().next()
+    }
+
+    /// The pieces covering the range, trimmed to it.
+    fn split(&self, range: ops::Range<usize>) -> impl Iterator<Item = Piece> + '_ {
+        self.pieces_in(range).map(|(_, source, range)| Piece {
+            source: source.clone(),
+            range,
+            offset: 0,
+        })
+    }
+}
+
+impl fmt::Display for PieceText {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        fmt::Display::fmt(&self.slice(), f)
+    }
+}
+
+impl fmt::Debug for PieceText {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        fmt::Display::fmt(self, f)
+    }
+}
+
+impl Text for PieceText {
+    type Slice<'a>
+        = PieceSlice<'a>
+    where
+        Self: 'a;
+
+    #[inline]
+    fn byte_slice(&self, byte_range: impl RangeBounds<usize>) -> Self::Slice<'_> {
+        self.slice().byte_slice(byte_range)
+    }
+
+    #[inline]
+    fn line_slice(&self, line_range: impl RangeBounds<usize>) -> Self::Slice<'_> {
+        self.slice().line_slice(line_range)
+    }
+
+    #[inline]
+    fn chars(&self) -> impl DoubleEndedIterator<Item = char> {
+        self.strs(0..self.len).flat_map(str::chars)
+    }
+
+    #[inline]
+    fn lines(&self) -> impl DoubleEndedIterator<Item = Self::Slice<'_>> {
+        Lines { text: self, front: 0, back: self.len }
+    }
+
+    #[inline]
+    fn line(&self, line_idx: usize) -> Option<Self::Slice<'_>> {
+        self.slice().line(line_idx)
+    }
+
+    #[inline]
+    fn reader(&self) -> impl Read + Send + '_ {
+        // The bytes rather than the chunks, which may have had invalid bytes replaced.
+        TextReader::new(
+            self.pieces_in(0..self.len).map(|(_, source, range)| &self.source_bytes(source)[range]),
+        )
+    }
+}
+
+impl TextBase for PieceText {
+    #[inline]
+    fn as_text_mut(&mut self) -> Option<&mut dyn AnyTextMut> {
+        Some(self)
+    }
+
+    #[inline]
+    fn len_lines(&self) -> usize {
+        self.slice().len_lines()
+    }
+
+    #[inline]
+    fn len_bytes(&self) -> usize {
+        self.len
+    }
+
+    #[inline]
+    fn len_utf16_cu(&self) -> usize {
+        self.slice().len_utf16_cu()
+    }
+
+    #[inline]
+    fn byte_to_line(&self, byte_idx: usize) -> usize {
+        self.slice().byte_to_line(byte_idx)
+    }
+
+    #[inline]
+    fn line_to_byte(&self, line_idx: usize) -> usize {
+        self.slice().line_to_byte(line_idx)
+    }
+
+    #[inline]
+    fn try_line_to_byte(&self, line_idx: usize) -> Option<usize> {
+        self.slice().try_line_to_byte(line_idx)
+    }
+
+    #[inline]
+    fn get_char(&self, byte_idx: usize) -> Option<char> {
+        self.slice().get_char(byte_idx)
+    }
+
+    #[inline]
+    fn byte_to_utf16_cu(&self, byte_idx: usize) -> usize {
+        self.slice().byte_to_utf16_cu(byte_idx)
+    }
+
+    #[inline]
+    fn utf16_cu_to_byte(&self, cu_idx: usize) -> usize {
+        self.slice().utf16_cu_to_byte(cu_idx)
+    }
+}
+
+impl TextMut for PieceText {
+    #[inline]
+    fn edit(&mut self, deltas: &Deltas<'_>) -> Deltas<'static> {
+        deltas.apply(self)
+    }
+}
+
+impl TextReplace for PieceText {
+    fn replace(&mut self, byte_range: impl RangeBounds<usize>, text: &str) {
+        let range = resolve(byte_range, self.len);
+        let mut pieces = self.split(0..range.start).collect::<Vec<_>>();
+        if !text.is_empty() {
+            pieces.push(Piece {
+                source: Source::Added(Arc::from(text)),
+                range: 0..text.len(),
+                offset: 0,
+            });
+        }
+        pieces.extend(self.split(range.end..self.len));
+
+        let mut offset = 0;
+        for piece in &mut pieces {
+            piece.offset = offset;
+            offset += piece.range.len();
+        }
+
+        self.pieces = pieces;
+        self.len = offset;
+    }
+}
+
+/// A slice of a [`PieceText`], this is only loaded as it's read.
+#[derive(Clone)]
+pub struct PieceSlice<'a> {
+    text: &'a PieceText,
+    range: ops::Range<usize>,
+}
+
+impl PieceSlice<'_> {
+    /// The start of the line relative to the slice, `None` if there is no such line.
+    fn line_start(&self, line_idx: usize) -> Option<usize> {
+        let start = match line_idx.checked_sub(1) {
+            None => 0,
+            Some(n) => self.text.nth_newline(self.range.clone(), n)? + 1 - self.range.start,
+        };
+        // A trailing newline doesn't start another line.
+        (start < self.range.len()).then_some(start)
+    }
+}
+
+impl fmt::Display for PieceSlice<'_> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        self.text.strs(self.range.clone()).try_for_each(|s| f.write_str(s))
+    }
+}
+
+impl fmt::Debug for PieceSlice<'_> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        fmt::Display::fmt(self, f)
+    }
+}
+
+impl<'a> TextSlice<'a> for PieceSlice<'a> {
+    type Slice = Self;
+
+    type Chunks = Box<dyn DoubleEndedIterator<Item = &'a str> + Send + 'a>;
+
+    fn to_cow(&self) -> Cow<'a, str> {
+        let mut strs = self.text.strs(self.range.clone());
+        match (strs.next(), strs.next()) {
+            (None, _) => Cow::Borrowed(""),
+            (Some(s), None) => Cow::Borrowed(s),
+            (Some(a), Some(b)) => {
+                let mut s = String::with_capacity(self.range.len());
+                s.push_str(a);
+                s.push_str(b);
+                strs.for_each(|t| s.push_str(t));
+                Cow::Owned(s)
+            }
+        }
+    }
+
+    fn byte_slice(&self, byte_range: impl RangeBounds<usize>) -> Self::Slice {
+        let range = resolve(byte_range, self.range.len());
+        PieceSlice {
+            text: self.text,
+            range: self.range.start + range.start..self.range.start + range.end,
+        }
+    }
+
+    fn line_slice(&self, line_range: impl RangeBounds<usize>) -> Self::Slice {
+        let start = line_range.start_bound().map(|&l| self.line_to_byte(l));
+        let end = line_range.end_bound().map(|&l| self.line_to_byte(l));
+        self.byte_slice((start, end))
+    }
+
+    fn chars(&self) -> impl DoubleEndedIterator<Item = char> + 'a {
+        self.text.strs(self.range.clone()).flat_map(str::chars)
+    }
+
+    fn lines(&self) -> impl DoubleEndedIterator<Item = Self::Slice> + 'a {
+        Lines { text: self.text, front: self.range.start, back: self.range.end }
+    }
+
+    fn chunks(&self) -> Self::Chunks {
+        Box::new(self.text.strs(self.range.clone()))
+    }
+
+    fn line(&self, line_idx: usize) -> Option<Self::Slice> {
+        let start = self.range.start + self.line_start(line_idx)?;
+        Lines { text: self.text, front: start, back: self.range.end }.next()
+    }
+}
+
+impl TextBase for PieceSlice<'_> {
+    #[inline]
+    fn as_text_mut(&mut self) -> Option<&mut dyn AnyTextMut> {
+        None
+    }
+
+    fn len_lines(&self) -> usize {
+        if self.range.is_empty() {
+            return 0;
+        }
+
+        let newlines = self.text.count_newlines(self.range.clone());
+        // The last line only counts if it's not empty.
+        match self.text.byte(self.range.end - 1) {
+            b'\n' => newlines,
+            _ => newlines + 1,
+        }
+    }
+
+    #[inline]
+    fn len_bytes(&self) -> usize {
+        self.range.len()
+    }
+
+    fn len_utf16_cu(&self) -> usize {
+        self.chars().map(char::len_utf16).sum()
+    }
+
+    fn byte_to_line(&self, byte_idx: usize) -> usize {
+        assert!(byte_idx <= self.range.len(), "byte_idx out of bounds: {byte_idx}");
+        self.text.count_newlines(self.range.start..self.range.start + byte_idx)
+    }
+
+    fn line_to_byte(&self, line_idx: usize) -> usize {
+        match line_idx.checked_sub(1) {
+            None => 0,
+            Some(n) => self
+                .text
+                .nth_newline(self.range.clone(), n)
+                .map_or(self.range.len(), |newline| newline + 1 - self.range.start),
+        }
+    }
+
+    #[inline]
+    fn try_line_to_byte(&self, line_idx: usize) -> Option<usize> {
+        self.line_start(line_idx)
+    }
+
+    fn get_char(&self, byte_idx: usize) -> Option<char> {
+        if byte_idx >= self.range.len() {
+            return None;
+        }
+
+        self.text.char_at(self.range.start + byte_idx)
+    }
+
+    fn byte_to_utf16_cu(&self, byte_idx: usize) -> usize {
+        self.byte_slice(..byte_idx).chars().map(char::len_utf16).sum()
+    }
+
+    fn utf16_cu_to_byte(&self, mut cu_idx: usize) -> usize {
+        let mut chars = self.chars();
+        let mut byte_idx = 0;
+        while cu_idx > 0 {
+            let cu = chars.next().expect("cu_idx out of bounds");
+            byte_idx += cu.len_utf8();
+            cu_idx = cu_idx.checked_sub(cu.len_utf16()).expect("cu_idx was not on a char boundary");
+        }
+        byte_idx
+    }
+}
+
+/// The lines of a range of the text, each line is found by scanning for the next newline so only the lines that
+/// are iterated over are loaded.
+struct Lines<'a> {
+    text: &'a PieceText,
+    front: usize,
+    back: usize,
+}
+
+impl<'a> Iterator for Lines<'a> {
+    type Item = PieceSlice<'a>;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        if self.front >= self.back {
+            return None;
+        }
+
+        let start = self.front;
+        let end = match self.text.nth_newline(start..self.back, 0) {
+            Some(newline) => {
+                self.front = newline + 1;
+                self.text.line_end(start, newline)
+            }
+            None => {
+                self.front = self.back;
+                self.back
+            }
+        };
+
+        Some(PieceSlice { text: self.text, range: start..end })
+    }
+}
+
+impl DoubleEndedIterator for Lines<'_> {
+    fn next_back(&mut self) -> Option<Self::Item> {
+        if self.front >= self.back {
+            return None;
+        }
+
+        let end = match self.text.byte(self.back - 1) {
+            b'\n' => self.text.line_end(self.front, self.back - 1),
+            _ => self.back,
+        };
+        let start =
+            self.text.rfind_newline(self.front..end).map_or(self.front, |newline| newline + 1);
+        self.back = start;
+
+        Some(PieceSlice { text: self.text, range: start..end })
+    }
+}
+
+/// Shown in place of each byte that isn't utf-8, a single byte so the text is as long as the file.
+const REPLACEMENT: char = '?';
+
+fn replace_invalid(bytes: &[u8]) -> Box<str> {
+    let mut s = String::with_capacity(bytes.len());
+    for chunk in bytes.utf8_chunks() {
+        s.push_str(chunk.valid());
+        s.extend(iter::repeat_n(REPLACEMENT, chunk.invalid().len()));
+    }
+    s.into_boxed_str()
+}
+
+#[inline]
+fn is_continuation_byte(b: u8) -> bool {
+    b & 0b1100_0000 == 0b1000_0000
+}
+
+fn count_newlines(bytes: &[u8]) -> usize {
+    bytes.iter().filter(|&&b| b == b'\n').count()
+}
+
+/// The index of the `n`th newline in the bytes, or the number of newlines if there are fewer.
+fn nth_newline(bytes: &[u8], n: usize) -> Result<usize, usize> {
+    let mut seen = 0;
+    for (i, &b) in bytes.iter().enumerate() {
+        if b == b'\n' {
+            if seen == n {
+                return Ok(i);
+            }
+            seen += 1;
+        }
+    }
+
+    Err(seen)
+}
+
+fn resolve(range: impl RangeBounds<usize>, len: usize) -> ops::Range<usize> {
+    let start = match range.start_bound() {
+        Bound::Included(&n) => n,
+        Bound::Excluded(&n) => n + 1,
+        Bound::Unbounded => 0,
+    };
+    let end = match range.end_bound() {
+        Bound::Included(&n) => n + 1,
+        Bound::Excluded(&n) => n,
+        Bound::Unbounded => len,
+    };
+    assert!(start <= end && end <= len, "byte range {start}..{end} out of bounds of length {len}");
+    start..end
+}
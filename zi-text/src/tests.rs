@@ -65,3 +65,106 @@ proptest! {
         assert_eq!(s, original, "applying the inverse delta should result in the original text");
     }
 }
+
+#[test]
+fn grapheme_boundaries() {
+    // A flag (two regional indicators), `e` with a combining acute accent, and a ZWJ family.
+    let text = "a🇯🇵e\u{301}👨\u{200d}👩\u{200d}👧b\nc";
+    let flag = 1..9;
+    let accent = 9..12;
+    let family = 12..30;
+    assert_eq!(&text[family.clone()], "👨\u{200d}👩\u{200d}👧");
+
+    for text in [&text as &dyn AnyText, &Rope::from(text)] {
+        assert_eq!(text.next_grapheme_boundary(0), flag.start);
+        assert_eq!(text.next_grapheme_boundary(flag.start), flag.end);
+        assert_eq!(text.next_grapheme_boundary(accent.start), accent.end);
+        assert_eq!(text.next_grapheme_boundary(family.start), family.end);
+        assert_eq!(text.next_grapheme_boundary(30), 31);
+        assert_eq!(text.next_grapheme_boundary(31), 32, "the newline is a cluster by itself");
+
+        assert_eq!(text.prev_grapheme_boundary(32), 31);
+        assert_eq!(text.prev_grapheme_boundary(31), 30);
+        assert_eq!(text.prev_grapheme_boundary(family.end), family.start);
+        assert_eq!(text.prev_grapheme_boundary(accent.end), accent.start);
+        assert_eq!(text.prev_grapheme_boundary(flag.end), flag.start);
+        assert_eq!(text.prev_grapheme_boundary(0), 0);
+
+        // Positions inside a cluster belong to the cluster.
+        assert_eq!(text.grapheme_start(5), flag.start);
+        assert_eq!(text.grapheme_start(10), accent.start);
+        assert_eq!(text.grapheme_start(20), family.start);
+        assert_eq!(text.next_grapheme_boundary(5), flag.end);
+        assert_eq!(text.prev_grapheme_boundary(10), flag.start);
+    }
+}
+
+#[test]
+fn piece_text_loads_lazily() {
+    let text = PieceText::with_chunk_size("abc\n".repeat(64), 16);
+    assert_eq!(text.len_lines(), 64);
+    assert!(!text.is_loaded(0), "counting lines shouldn't load anything");
+
+    assert_eq!(text.line(63).unwrap().to_string(), "abc");
+    assert!(text.is_loaded(255));
+    assert!(!text.is_loaded(128));
+}
+
+#[test]
+fn piece_text_invalid_utf8() {
+    // The `é` straddles the first chunk boundary, the second chunk has a byte that isn't utf-8.
+    let mut bytes = "abcdefghijklmnoé\n".as_bytes().to_vec();
+    bytes.extend_from_slice(b"x\xff\n");
+    bytes.extend_from_slice("abc\n".repeat(4).as_bytes());
+    let text = PieceText::with_chunk_size(bytes.clone(), 16);
+
+    assert_eq!(text.line(0).unwrap().to_string(), "abcdefghijklmnoé");
+    assert_eq!(text.line(1).unwrap().to_string(), "x?");
+    assert_eq!(text.len_bytes(), bytes.len());
+    assert!(!text.is_loaded(32), "a bad chunk shouldn't load the ones after it");
+
+    let mut read = vec![];
+    text.reader().read_to_end(&mut read).unwrap();
+    assert_eq!(read, bytes, "the invalid byte should be written back out as is");
+}
+
+proptest! {
+    #[test]
+    fn prop_piece_text(
+        s in "[a-cé\n]*",
+        edits in proptest::collection::vec(
+            (any::<prop::sample::Index>(), any::<prop::sample::Index>(), "[a-cé\n]{0,3}"),
+            0..8,
+        ),
+    ) {
+        // A tiny chunk size so the chunk boundaries are exercised, `é` is two bytes so a boundary can split it.
+        let mut text = PieceText::with_chunk_size(s.clone(), 4);
+        let mut reference = crop::Rope::from(s.as_str());
+        let boundaries = |rope: &crop::Rope| {
+            let s = rope.to_string();
+            s.char_indices().map(|(i, _)| i).chain([s.len()]).collect::<Vec<_>>()
+        };
+
+        for (a, b, insert) in edits {
+            let boundaries = boundaries(&reference);
+            let (a, b) = (*a.get(&boundaries), *b.get(&boundaries));
+            let deltas = Deltas::single(a.min(b)..a.max(b), insert);
+            deltas.apply(&mut text);
+            deltas.apply(&mut reference);
+        }
+
+        assert_eq!(text.to_string(), reference.to_string());
+        assert_eq!(text.len_lines(), reference.line_len());
+        assert!(text.lines().map(|l| l.to_string()).eq(reference.lines().map(|l| l.to_string())));
+        assert!(
+            text.lines().rev().map(|l| l.to_string()).eq(reference.lines().rev().map(|l| l.to_string()))
+        );
+        for line in 0..=reference.line_len() {
+            assert_eq!(text.line_to_byte(line), reference.line_to_byte(line));
+        }
+        for byte in boundaries(&reference) {
+            assert_eq!(text.byte_to_line(byte), reference.byte_to_line(byte));
+            assert_eq!(text.get_char(byte), reference.to_string()[byte..].chars().next());
+        }
+    }
+}
@@ -7,7 +7,7 @@ use proptest::{bool, proptest};
 use zi_core::*;
 use zi_text::*;
 
-fn mut_impls<'a>(s: &'a str) -> [Box<dyn AnyTextMut + 'a>; 2] {
+fn mut_impls<'a>(s: &'a str) -> [Box<dyn AnyTextMut + 'a>; 3] {
     [
         // could use crop::Rope::from directly, but using the building is more realistic
         Box::new({
@@ -16,6 +16,7 @@ fn mut_impls<'a>(s: &'a str) -> [Box<dyn AnyTextMut + 'a>; 2] {
             builder.build()
         }) as Box<dyn AnyTextMut>,
         Box::new(s.to_owned()),
+        Box::new(PieceText::new(s.to_owned())),
     ]
 }
 
@@ -27,7 +28,7 @@ fn text_edit() {
     }
 }
 
-fn impls<'a>(s: &'a str) -> [Box<dyn AnyText + 'a>; 3] {
+fn impls<'a>(s: &'a str) -> [Box<dyn AnyText + 'a>; 4] {
     [
         // could use crop::Rope::from directly, but using the building is more realistic
         Box::new({
@@ -36,6 +37,7 @@ fn impls<'a>(s: &'a str) -> [Box<dyn AnyText + 'a>; 3] {
             builder.build()
         }) as Box<dyn AnyText>,
         Box::new(ReadonlyText::new(s.as_bytes())),
+        Box::new(PieceText::new(s.to_owned())),
         Box::new(s),
     ]
 }
@@ -358,3 +360,71 @@ const x: &str = r#"
         "##]],
     );
 }
+
+#[test]
+fn diff() {
+    #[track_caller]
+    fn check(old: &str, new: &str, expected: Expect) {
+        let deltas = Deltas::diff(old, new);
+        let mut text = old.to_owned();
+        text.edit(&deltas);
+        assert_eq!(text, new);
+        expected.assert_debug_eq(&deltas.iter().rev().collect::<Vec<_>>());
+    }
+
+    check(
+        "a\nb\n",
+        "a\nb\n",
+        expect![[r#"
+            []
+        "#]],
+    );
+    check(
+        "",
+        "a\n",
+        expect![[r#"
+            [
+                0..0 => "a\n",
+            ]
+        "#]],
+    );
+    check(
+        "a\nb\nc\n",
+        "a\nx\nc\n",
+        expect![[r#"
+            [
+                2..4 => "x\n",
+            ]
+        "#]],
+    );
+    check(
+        "a\nb\nc\nd\n",
+        "x\nb\nd\ny\n",
+        expect![[r#"
+            [
+                0..2 => "x\n",
+                4..6 => "",
+                8..8 => "y\n",
+            ]
+        "#]],
+    );
+    check(
+        "a\nb",
+        "a\nb\n",
+        expect![[r#"
+            [
+                2..3 => "b\n",
+            ]
+        "#]],
+    );
+}
+
+proptest! {
+    #[test]
+    fn diff_applies(old in vec("[ab]{0,2}\n?", 0..10), new in vec("[ab]{0,2}\n?", 0..10)) {
+        let (old, new) = (old.concat(), new.concat());
+        let mut text = old.clone();
+        text.edit(&Deltas::diff(&old, &new));
+        assert_eq!(text, new);
+    }
+}
@@ -1,17 +1,37 @@
 use std::ops::Range;
 
-use zi_text::AnyText;
+use zi_text::{AnyText, Text as _, TextSlice as _};
 
 use crate::delimiter::Delimiter;
-use crate::{TextObject, TextObjectKind, Within};
+use crate::within::enclosing_pair;
+use crate::{TextObject, TextObjectKind};
 
 pub struct Around<D>(pub D);
 
 impl<D: Delimiter> TextObject for Around<D> {
     fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
-        let mut range = Within(&self.0).byte_range(text, byte)?;
-        range.start -= D::OPEN.len_utf8();
-        range.end += D::CLOSE.len_utf8();
+        let mut range = enclosing_pair::<D>(text, byte)?;
+        if D::OPEN == D::CLOSE {
+            // Like vim, quotes take the trailing whitespace, or the leading whitespace if there is none.
+            let is_blank = |c: &char| c.is_whitespace() && *c != '\n';
+            let trailing = text
+                .byte_slice(range.end..)
+                .chars()
+                .take_while(is_blank)
+                .map(char::len_utf8)
+                .sum::<usize>();
+            if trailing > 0 {
+                range.end += trailing;
+            } else {
+                range.start -= text
+                    .byte_slice(..range.start)
+                    .chars()
+                    .rev()
+                    .take_while(is_blank)
+                    .map(char::len_utf8)
+                    .sum::<usize>();
+            }
+        }
         Some(range)
     }
 
@@ -4,8 +4,11 @@ mod around;
 pub mod delimiter;
 mod matchit;
 pub mod motion;
+mod paragraph;
+mod tag;
 mod until;
 mod within;
+mod word;
 use std::ops;
 
 use zi_core::PointOrByte;
@@ -14,8 +17,11 @@ use zi_text::{AnyText, Text as _, TextSlice};
 pub use self::around::Around;
 pub use self::matchit::MatchIt;
 pub use self::motion::{Motion, MotionFlags};
+pub use self::paragraph::Paragraph;
+pub use self::tag::Tag;
 pub use self::until::Until;
-pub use self::within::Within;
+pub use self::within::{Within, enclosing_pair};
+pub use self::word::{Token, Word};
 
 /// Charwise textobjects affect a [start, end) byte-range where `start` is inclusive and `end` is exclusive.
 /// Linewise ranges will NOT be expanded to include the full start and end lines.
@@ -61,6 +67,35 @@ pub trait TextObject {
         TextObjectFlags::empty()
     }
 
+    /// Returns the byte range of the text object repeated `n` times starting at the given byte.
+    /// By default, each repetition starts where the previous one ended.
+    #[inline]
+    fn repeated_byte_range(
+        &self,
+        text: &dyn AnyText,
+        byte: usize,
+        n: usize,
+    ) -> Option<ops::Range<usize>> {
+        let first = self.byte_range(text, byte)?;
+        let mut start = first.start;
+        let mut end = first.end;
+        for _ in 1..n {
+            match self.byte_range(text, end) {
+                Some(next) => {
+                    start = start.min(next.start);
+                    // A repetition that doesn't get any further won't be followed by one that does,
+                    // stop early so a huge count is cut off at the end of the text.
+                    if next.end <= end {
+                        break;
+                    }
+                    end = next.end;
+                }
+                None => break,
+            }
+        }
+        Some(start..end)
+    }
+
     #[inline]
     fn repeat(self, n: usize) -> Repeat<Self>
     where
@@ -76,6 +111,16 @@ impl TextObject for &dyn Motion {
         (**self).byte_range(text, byte)
     }
 
+    #[inline]
+    fn repeated_byte_range(
+        &self,
+        text: &dyn AnyText,
+        byte: usize,
+        n: usize,
+    ) -> Option<ops::Range<usize>> {
+        (**self).repeated_byte_range(text, byte, n)
+    }
+
     #[inline]
     fn default_kind(&self) -> TextObjectKind {
         (**self).default_kind()
@@ -93,6 +138,16 @@ impl<O: TextObject> TextObject for &O {
         (*self).byte_range(text, byte)
     }
 
+    #[inline]
+    fn repeated_byte_range(
+        &self,
+        text: &dyn AnyText,
+        byte: usize,
+        n: usize,
+    ) -> Option<ops::Range<usize>> {
+        (*self).repeated_byte_range(text, byte, n)
+    }
+
     #[inline]
     fn default_kind(&self) -> TextObjectKind {
         (*self).default_kind()
@@ -151,19 +206,7 @@ pub struct Repeat<M> {
 impl<M: TextObject> TextObject for Repeat<M> {
     #[inline]
     fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<ops::Range<usize>> {
-        let first = self.inner.byte_range(text, byte)?;
-        let mut start = first.start;
-        let mut end = first.end;
-        for _ in 1..self.n {
-            match self.inner.byte_range(text, end) {
-                Some(next) => {
-                    start = start.min(next.start);
-                    end = end.max(next.end);
-                }
-                None => break,
-            }
-        }
-        Some(start..end)
+        self.inner.repeated_byte_range(text, byte, self.n)
     }
 
     #[inline]
@@ -446,9 +489,23 @@ pub struct NextLine;
 impl TextObject for NextLine {
     #[inline]
     fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<ops::Range<usize>> {
+        self.repeated_byte_range(text, byte, 1)
+    }
+
+    /// `d3j` deletes the current line and the 3 below it, not 3 pairs of lines.
+    fn repeated_byte_range(
+        &self,
+        text: &dyn AnyText,
+        byte: usize,
+        n: usize,
+    ) -> Option<ops::Range<usize>> {
         let line_idx = text.byte_to_line(byte);
         text.line(line_idx + 1)?;
-        Some(line_range_to_byte_range(text, line_idx..=line_idx + 1, Inclusivity::Inclusive))
+        let mut end = line_idx + 1;
+        while end - line_idx < n && text.line(end + 1).is_some() {
+            end += 1;
+        }
+        Some(line_range_to_byte_range(text, line_idx..=end, Inclusivity::Inclusive))
     }
 
     #[inline]
@@ -462,10 +519,20 @@ pub struct PrevLine;
 impl TextObject for PrevLine {
     #[inline]
     fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<ops::Range<usize>> {
+        self.repeated_byte_range(text, byte, 1)
+    }
+
+    fn repeated_byte_range(
+        &self,
+        text: &dyn AnyText,
+        byte: usize,
+        n: usize,
+    ) -> Option<ops::Range<usize>> {
         let line_idx = text.byte_to_line(byte);
+        line_idx.checked_sub(1)?;
         Some(line_range_to_byte_range(
             text,
-            line_idx.checked_sub(1)?..=line_idx,
+            line_idx.saturating_sub(n.max(1))..=line_idx,
             Inclusivity::Inclusive,
         ))
     }
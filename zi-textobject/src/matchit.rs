@@ -1,69 +1,122 @@
 use super::*;
 
-#[derive(Debug, Clone)]
-pub struct MatchIt;
+/// The pairs of brackets that match each other.
+const PAIRS: [(char, char); 3] = [('(', ')'), ('[', ']'), ('{', '}')];
 
-impl TextObject for MatchIt {
-    fn byte_range(&self, _text: &dyn AnyText, _byte: usize) -> Option<ops::Range<usize>> {
-        todo!()
-    }
+/// Jump to the bracket matching the one under the cursor, `%`.
+/// Like vim, a cursor that isn't on a bracket uses the next bracket on the line.
+#[derive(Debug, Clone, Default)]
+pub struct MatchIt {
+    /// The byte ranges of the strings and comments in the text, ordered by start.
+    /// A bracket within one only matches brackets within the same one, and brackets outside don't see it at all.
+    literals: Vec<ops::Range<usize>>,
+}
 
-    fn default_kind(&self) -> TextObjectKind {
-        TextObjectKind::Charwise
+impl MatchIt {
+    pub fn new(literals: Vec<ops::Range<usize>>) -> Self {
+        Self { literals }
     }
-}
 
-impl Motion for MatchIt {
-    fn motion(&self, text: &dyn AnyText, p: PointOrByte) -> PointOrByte {
-        let Some(a) = text.char_at_point_or_byte(p) else { return p };
-        let (target, forward) = match a {
-            // NOTE maybe can make sure of delimiter abstraction
-            '(' => (')', true),
-            ')' => ('(', false),
-            '[' => (']', true),
-            ']' => ('(', false),
-            '{' => ('}', true),
-            '}' => ('{', false),
-            '<' => ('>', true),
-            '>' => ('<', false),
-            _ => return p,
+    /// The byte of the bracket matching the bracket at `byte`, the search doesn't go outside `bounds`.
+    /// Returns `None` if there is no bracket at `byte` or it is unmatched.
+    pub fn matching_bracket(
+        &self,
+        text: &dyn AnyText,
+        byte: usize,
+        bounds: ops::Range<usize>,
+    ) -> Option<usize> {
+        let c = text.char_at_byte(byte)?;
+        let (open, close, forward) = PAIRS.iter().find_map(|&(open, close)| match c {
+            _ if c == open => Some((open, close, true)),
+            _ if c == close => Some((open, close, false)),
+            _ => None,
+        })?;
+
+        // Only brackets in the same string or comment (or in none) are counted.
+        let literal = self.literal_at(byte);
+        let bounds = match &literal {
+            Some(literal) => bounds.start.max(literal.start)..bounds.end.min(literal.end),
+            None => bounds,
         };
+        let counts = |byte: usize| self.literal_at(byte) == literal;
 
-        let mut depth = 0;
-        let mut byte = text.point_or_byte_to_byte(p);
-        match forward {
-            true => {
-                for c in text.byte_slice(byte..).chars() {
-                    if c == a {
+        let mut depth = 0usize;
+        if forward {
+            let mut byte = byte;
+            for c in text.byte_slice(byte..bounds.end.max(byte)).chars() {
+                if (c == open || c == close) && counts(byte) {
+                    if c == open {
                         depth += 1;
-                    } else if c == target {
-                        assert!(depth > 0);
+                    } else {
                         depth -= 1;
                         if depth == 0 {
-                            return byte.into();
+                            return Some(byte);
                         }
                     }
-
-                    byte += c.len_utf8();
                 }
+                byte += c.len_utf8();
             }
-            false => {
-                for c in text.byte_slice(..byte).chars().rev() {
-                    byte -= c.len_utf8();
-                    if c == target {
+        } else {
+            let mut byte = byte + c.len_utf8();
+            for c in text.byte_slice(bounds.start.min(byte)..byte).chars().rev() {
+                byte -= c.len_utf8();
+                if (c == open || c == close) && counts(byte) {
+                    if c == close {
+                        depth += 1;
+                    } else {
+                        depth -= 1;
                         if depth == 0 {
-                            return byte.into();
+                            return Some(byte);
                         }
-                        assert!(depth > 0);
-                        depth -= 1;
-                    } else if c == a {
-                        depth += 1;
                     }
                 }
             }
         }
 
-        // Otherwise not found, return the original point
-        p
+        None
+    }
+
+    /// The bracket at or after `byte` on its line, and the byte of the bracket matching it.
+    fn pair(&self, text: &dyn AnyText, byte: usize) -> Option<(usize, usize)> {
+        let line = text.byte_to_line(byte);
+        let line_end = text.try_line_to_byte(line + 1).unwrap_or(text.len_bytes());
+        let mut start = byte;
+        let bracket = text.byte_slice(byte..line_end).chars().find_map(|c| {
+            let b = start;
+            start += c.len_utf8();
+            PAIRS.iter().any(|&(open, close)| c == open || c == close).then_some(b)
+        })?;
+        Some((bracket, self.matching_bracket(text, bracket, 0..text.len_bytes())?))
+    }
+
+    fn literal_at(&self, byte: usize) -> Option<ops::Range<usize>> {
+        let idx = self.literals.partition_point(|range| range.start <= byte).checked_sub(1)?;
+        let range = &self.literals[idx];
+        range.contains(&byte).then(|| range.clone())
+    }
+}
+
+impl TextObject for MatchIt {
+    /// The range from the bracket to its match, including both.
+    fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<ops::Range<usize>> {
+        let (a, b) = self.pair(text, byte)?;
+        let end = a.max(b);
+        let end = end + text.char_at_byte(end).map_or(0, |c| c.len_utf8());
+        Some(byte.min(b)..end)
+    }
+
+    fn default_kind(&self) -> TextObjectKind {
+        TextObjectKind::Charwise
+    }
+}
+
+impl Motion for MatchIt {
+    fn motion(&self, text: &dyn AnyText, p: PointOrByte) -> PointOrByte {
+        let byte = text.point_or_byte_to_byte(p);
+        match self.pair(text, byte) {
+            Some((_, matching)) => matching.into(),
+            // Otherwise not found, return the original point
+            None => p,
+        }
     }
 }
@@ -49,7 +49,13 @@ impl<M: Motion> Motion for Repeat<M> {
     #[inline]
     fn motion(&self, text: &dyn AnyText, mut p: PointOrByte) -> PointOrByte {
         for _ in 0..self.n {
-            p = self.inner.motion(text, p);
+            let next = self.inner.motion(text, p);
+            // Motions are stateless, so once a motion gets stuck it stays stuck.
+            // Stopping early keeps a huge count from taking forever at the end of the text.
+            if next == p {
+                break;
+            }
+            p = next;
         }
 
         p
@@ -131,7 +137,7 @@ impl Motion for NextChar {
     fn motion(&self, text: &dyn AnyText, p: PointOrByte) -> PointOrByte {
         let byte = text.point_or_byte_to_byte(p);
         match text.char_at_byte(byte) {
-            Some(c) if c != '\n' => byte + c.len_utf8(),
+            Some(c) if c != '\n' => text.next_grapheme_boundary(byte),
             _ => byte,
         }
         .into()
@@ -148,7 +154,7 @@ impl Motion for PrevChar {
     fn motion(&self, text: &dyn AnyText, p: PointOrByte) -> PointOrByte {
         let byte = text.point_or_byte_to_byte(p);
         match text.char_before_byte(byte) {
-            Some(c) if c != '\n' => byte - c.len_utf8(),
+            Some(c) if c != '\n' => text.prev_grapheme_boundary(byte),
             _ => byte,
         }
         .into()
@@ -194,6 +200,26 @@ impl Motion for PrevLine {
     }
 }
 
+/// The first column of the line, `0`.
+pub struct LineStart;
+
+impl Motion for LineStart {
+    fn motion(&self, text: &dyn AnyText, p: PointOrByte) -> PointOrByte {
+        let line_idx = text.byte_to_line(text.point_or_byte_to_byte(p));
+        text.line_to_byte(line_idx).into()
+    }
+}
+
+impl TextObject for LineStart {
+    fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<ops::Range<usize>> {
+        Some(text.point_or_byte_to_byte(self.motion(text, byte.into()))..byte)
+    }
+
+    fn default_kind(&self) -> TextObjectKind {
+        TextObjectKind::Charwise
+    }
+}
+
 pub struct StartOfLine;
 
 impl Motion for StartOfLine {
@@ -0,0 +1,62 @@
+use std::ops::Range;
+
+use zi_text::{AnyText, Text as _, TextSlice as _};
+
+use crate::{Inclusivity, TextObject, TextObjectKind, line_range_to_byte_range};
+
+/// The paragraph under the cursor (`ip` and `ap`), a paragraph is a run of non-blank lines.
+/// On blank lines, the run of blank lines is the paragraph.
+pub struct Paragraph {
+    inclusivity: Inclusivity,
+}
+
+impl Paragraph {
+    pub fn inner() -> Self {
+        Self { inclusivity: Inclusivity::Exclusive }
+    }
+
+    /// Includes the blank lines after the paragraph, or before it if it is the last paragraph.
+    /// On blank lines, this is the blank lines and the following paragraph.
+    pub fn around() -> Self {
+        Self { inclusivity: Inclusivity::Inclusive }
+    }
+}
+
+impl TextObject for Paragraph {
+    fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
+        let is_blank =
+            |line_idx: usize| text.line(line_idx).map(|line| line.chars().all(char::is_whitespace));
+
+        let line_idx = text.byte_to_line(byte);
+        let blank = is_blank(line_idx)?;
+
+        let mut start = line_idx;
+        while start > 0 && is_blank(start - 1) == Some(blank) {
+            start -= 1;
+        }
+
+        let mut end = line_idx;
+        while is_blank(end + 1) == Some(blank) {
+            end += 1;
+        }
+
+        if self.inclusivity == Inclusivity::Inclusive {
+            if is_blank(end + 1).is_some() {
+                end += 1;
+                while is_blank(end + 1) == Some(!blank) {
+                    end += 1;
+                }
+            } else if !blank {
+                while start > 0 && is_blank(start - 1) == Some(true) {
+                    start -= 1;
+                }
+            }
+        }
+
+        Some(line_range_to_byte_range(text, start..=end, Inclusivity::Inclusive))
+    }
+
+    fn default_kind(&self) -> TextObjectKind {
+        TextObjectKind::Linewise
+    }
+}
@@ -0,0 +1,98 @@
+use std::ops::Range;
+
+use zi_text::{AnyText, Text as _, TextSlice as _};
+
+use crate::{Inclusivity, TextObject, TextObjectKind};
+
+/// The innermost HTML/XML element around the cursor (`it` and `at`).
+/// The matching is minimal: comments, self-closing tags and unmatched tags are skipped,
+/// and a closing tag closes any unclosed elements opened after its opening tag.
+pub struct Tag {
+    inclusivity: Inclusivity,
+}
+
+impl Tag {
+    /// The contents of the element, excluding the tags.
+    pub fn inner() -> Self {
+        Self { inclusivity: Inclusivity::Exclusive }
+    }
+
+    pub fn around() -> Self {
+        Self { inclusivity: Inclusivity::Inclusive }
+    }
+}
+
+impl TextObject for Tag {
+    fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
+        let src = text.byte_slice(..).to_cow();
+
+        let mut open = Vec::<(&str, Range<usize>)>::new();
+        let mut innermost: Option<(Range<usize>, Range<usize>)> = None;
+        for tag in tags(&src) {
+            if !tag.closing {
+                open.push((tag.name, tag.range));
+                continue;
+            }
+
+            let Some(i) = open.iter().rposition(|(name, _)| *name == tag.name) else { continue };
+            let start = open[i].1.clone();
+            open.truncate(i);
+
+            // Elements are closed innermost first, so the first one around the cursor is the innermost.
+            if start.start <= byte && byte < tag.range.end {
+                innermost = Some((start, tag.range));
+                break;
+            }
+        }
+
+        let (start, end) = innermost?;
+        Some(match self.inclusivity {
+            Inclusivity::Exclusive => start.end..end.start,
+            Inclusivity::Inclusive => start.start..end.end,
+        })
+    }
+
+    fn default_kind(&self) -> TextObjectKind {
+        TextObjectKind::Charwise
+    }
+}
+
+struct TagToken<'a> {
+    name: &'a str,
+    closing: bool,
+    range: Range<usize>,
+}
+
+fn tags(src: &str) -> impl Iterator<Item = TagToken<'_>> {
+    let mut pos = 0;
+    std::iter::from_fn(move || {
+        loop {
+            let start = pos + src[pos..].find('<')?;
+            if src[start..].starts_with("<!--") {
+                // An unterminated comment runs to the end of the text.
+                pos = start + 4 + src[start + 4..].find("-->")? + 3;
+                continue;
+            }
+
+            let rest = &src[start + 1..];
+            let (closing, rest) = match rest.strip_prefix('/') {
+                Some(rest) => (true, rest),
+                None => (false, rest),
+            };
+
+            let name_len = rest
+                .find(|c: char| !(c.is_alphanumeric() || matches!(c, '-' | '_' | ':' | '.')))
+                .unwrap_or(rest.len());
+            let name = &rest[..name_len];
+
+            let len = rest.find('>')?;
+            let end = start + 1 + closing as usize + len + 1;
+            pos = if name.is_empty() { start + 1 } else { end };
+
+            let self_closing = src[..end - 1].ends_with('/');
+            if !name.is_empty() && !self_closing {
+                return Some(TagToken { name, closing, range: start..end });
+            }
+        }
+    })
+}
@@ -9,26 +9,25 @@ pub struct Within<D>(pub D);
 
 impl<D: Delimiter> TextObject for Within<D> {
     fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
-        let mut start = byte;
-        let mut chars = text.byte_slice(..byte).chars().rev();
-        loop {
-            let c = chars.next()?;
-            if c == D::OPEN {
-                break;
+        let range = enclosing_pair::<D>(text, byte)?;
+        let mut start = range.start + D::OPEN.len_utf8();
+        let mut end = range.end - D::CLOSE.len_utf8();
+        if D::OPEN != D::CLOSE {
+            // Like vim, a block whose delimiters are on their own lines is the lines in between.
+            if text.char_at_byte(start) == Some('\n') {
+                start += 1;
             }
 
-            start -= c.len_utf8();
-        }
-
-        let mut end = byte;
-        let mut chars = text.byte_slice(byte..).chars();
-        loop {
-            let c = chars.next()?;
-            if c == D::CLOSE {
-                break;
+            let indent = text
+                .byte_slice(start..end)
+                .chars()
+                .rev()
+                .take_while(|&c| c.is_whitespace() && c != '\n')
+                .map(char::len_utf8)
+                .sum::<usize>();
+            if end - indent > start && text.char_at_byte(end - indent - 1) == Some('\n') {
+                end -= indent;
             }
-
-            end += c.len_utf8();
         }
 
         Some(start..end)
@@ -38,3 +37,80 @@ impl<D: Delimiter> TextObject for Within<D> {
         TextObjectKind::Charwise
     }
 }
+
+/// The range of the innermost pair of delimiters around `byte`, including the delimiters.
+/// A cursor on either delimiter belongs to that pair.
+pub fn enclosing_pair<D: Delimiter>(text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
+    if D::OPEN == D::CLOSE { quotes::<D>(text, byte) } else { brackets::<D>(text, byte) }
+}
+
+/// Brackets nest and may span lines.
+fn brackets<D: Delimiter>(text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
+    let start = match text.char_at_byte(byte) {
+        Some(c) if c == D::OPEN => byte,
+        _ => {
+            let mut start = byte;
+            let mut depth = 0;
+            let mut chars = text.byte_slice(..byte).chars().rev();
+            loop {
+                let c = chars.next()?;
+                start -= c.len_utf8();
+                if c == D::CLOSE {
+                    depth += 1;
+                } else if c == D::OPEN {
+                    if depth == 0 {
+                        break start;
+                    }
+                    depth -= 1;
+                }
+            }
+        }
+    };
+
+    let mut end = start + D::OPEN.len_utf8();
+    let mut depth = 0;
+    let mut chars = text.byte_slice(end..).chars();
+    loop {
+        let c = chars.next()?;
+        end += c.len_utf8();
+        if c == D::OPEN {
+            depth += 1;
+        } else if c == D::CLOSE {
+            if depth == 0 {
+                break Some(start..end);
+            }
+            depth -= 1;
+        }
+    }
+}
+
+/// Quotes don't nest, so they are paired up from the start of the line (ignoring escaped quotes).
+/// Like vim, if the cursor is before the first quote the first quoted string after it is used.
+fn quotes<D: Delimiter>(text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
+    let line_idx = text.byte_to_line(byte);
+    let line_start = text.line_to_byte(line_idx);
+    let line = text.line(line_idx)?.to_cow();
+    let offset = byte - line_start;
+
+    let mut escaped = false;
+    let quotes = line
+        .char_indices()
+        .filter(|&(_, c)| {
+            let is_quote = c == D::OPEN && !escaped;
+            escaped = c == '\\' && !escaped;
+            is_quote
+        })
+        .map(|(i, _)| i)
+        .collect::<Vec<_>>();
+
+    let (open, close) = match quotes.iter().position(|&i| i == offset) {
+        Some(i) if i % 2 == 0 => (quotes[i], *quotes.get(i + 1)?),
+        Some(i) => (quotes[i - 1], quotes[i]),
+        None => match quotes.partition_point(|&i| i < offset) {
+            0 => (*quotes.first()?, *quotes.get(1)?),
+            i => (quotes[i - 1], *quotes.get(i)?),
+        },
+    };
+
+    Some(line_start + open..line_start + close + D::CLOSE.len_utf8())
+}
@@ -0,0 +1,116 @@
+use std::ops::Range;
+
+use zi_text::{AnyText, Text as _, TextSlice as _};
+
+use crate::{Inclusivity, TextObject, TextObjectKind};
+
+/// The word under the cursor (`iw` and `aw`), the word characters are alphanumerics and `_` as in vim.
+/// Unlike the `w` motion, this does not stop at the humps in camel case.
+pub struct Word {
+    inclusivity: Inclusivity,
+}
+
+impl Word {
+    pub fn inner() -> Self {
+        Self { inclusivity: Inclusivity::Exclusive }
+    }
+
+    /// Includes the trailing whitespace, or the leading whitespace if there is none.
+    pub fn around() -> Self {
+        Self { inclusivity: Inclusivity::Inclusive }
+    }
+}
+
+impl TextObject for Word {
+    fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
+        word_range(text, byte, self.inclusivity, |c| match c {
+            c if c.is_whitespace() => Class::Whitespace,
+            c if c.is_alphanumeric() || c == '_' => Class::Word,
+            _ => Class::Punctuation,
+        })
+    }
+
+    fn default_kind(&self) -> TextObjectKind {
+        TextObjectKind::Charwise
+    }
+}
+
+/// The whitespace delimited word under the cursor (`iW` and `aW`).
+pub struct Token {
+    inclusivity: Inclusivity,
+}
+
+impl Token {
+    pub fn inner() -> Self {
+        Self { inclusivity: Inclusivity::Exclusive }
+    }
+
+    /// Includes the trailing whitespace, or the leading whitespace if there is none.
+    pub fn around() -> Self {
+        Self { inclusivity: Inclusivity::Inclusive }
+    }
+}
+
+impl TextObject for Token {
+    fn byte_range(&self, text: &dyn AnyText, byte: usize) -> Option<Range<usize>> {
+        word_range(text, byte, self.inclusivity, |c| match c {
+            c if c.is_whitespace() => Class::Whitespace,
+            _ => Class::Word,
+        })
+    }
+
+    fn default_kind(&self) -> TextObjectKind {
+        TextObjectKind::Charwise
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Class {
+    Whitespace,
+    Punctuation,
+    Word,
+}
+
+/// Words don't span lines, so this works within the line of `byte`.
+fn word_range(
+    text: &dyn AnyText,
+    byte: usize,
+    inclusivity: Inclusivity,
+    class: fn(char) -> Class,
+) -> Option<Range<usize>> {
+    let line_idx = text.byte_to_line(byte);
+    let line_start = text.line_to_byte(line_idx);
+    let line = text.line(line_idx)?.to_cow();
+    let offset = byte - line_start;
+    // There is nothing to select on the newline.
+    let c = line.get(offset..)?.chars().next()?;
+
+    let run = |s: &str, class_of: Class| {
+        s.chars().take_while(|&c| class(c) == class_of).map(char::len_utf8).sum::<usize>()
+    };
+    let run_back = |s: &str, class_of: Class| {
+        s.chars().rev().take_while(|&c| class(c) == class_of).map(char::len_utf8).sum::<usize>()
+    };
+
+    let cls = class(c);
+    let mut start = offset - run_back(&line[..offset], cls);
+    let mut end = offset + run(&line[offset..], cls);
+
+    if inclusivity == Inclusivity::Inclusive {
+        if cls == Class::Whitespace {
+            // On whitespace, `aw` is the whitespace and the word after it.
+            if let Some(next) = line[end..].chars().next() {
+                end += run(&line[end..], class(next));
+            }
+        } else {
+            let trailing = run(&line[end..], Class::Whitespace);
+            if trailing > 0 {
+                end += trailing;
+            } else {
+                start -= run_back(&line[..start], Class::Whitespace);
+            }
+        }
+    }
+
+    Some(line_start + start..line_start + end)
+}
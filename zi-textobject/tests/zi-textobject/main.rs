@@ -27,6 +27,16 @@ fn next_line_object() {
     check_range(&obj, "a\n", 1, None);
 }
 
+#[test]
+fn repeated_line_objects() {
+    check_range(&NextLine.repeat(2), "a\nb\nc\n", 0, Some(0..6));
+    check_range(&NextLine.repeat(5), "a\nb\nc\n", 0, Some(0..6));
+    check_range(&PrevLine.repeat(2), "a\nb\nc\n", 4, Some(0..6));
+    check_range(&PrevLine.repeat(5), "a\nb\nc\n", 2, Some(0..4));
+    check_range(&Line::inclusive().repeat(2), "a\nb\nc\n", 0, Some(0..4));
+    check_range(&Line::inclusive().repeat(usize::MAX), "a\nb\nc\n", 2, Some(2..6));
+}
+
 #[test]
 fn line_object() {
     let inc = Line::inclusive();
@@ -169,7 +179,30 @@ fn motion_next_char() {
     check(&motion, "\n\n\n", 1, 1);
     check(&motion, "\n\n\n", 0, 0);
 
+    // Grapheme clusters are moved over as a whole.
+    check(&motion, "🇯🇵a", 0, 8);
+    check(&motion, "e\u{301}x", 0, 3);
+    check(&motion, "👨\u{200d}👩x", 0, 11);
+
     check_range(&motion, "a", 0, Some(0..1));
+    check_range(&motion, "🇯🇵a", 0, Some(0..8));
+}
+
+#[test]
+fn motion_repeat() {
+    check(&NextChar.repeat(2), "abc", 0, 2);
+    // Stops as soon as the motion gets stuck.
+    check(&NextChar.repeat(usize::MAX), "abc", 0, 3);
+    check(&PrevChar.repeat(usize::MAX), "abc", 2, 0);
+}
+
+#[test]
+fn motion_line_start() {
+    let motion = motion::LineStart;
+    check(&motion, "ab\n  cd", 6, 3);
+    check(&motion, "ab\n  cd", 3, 3);
+    check(&motion, "ab", 1, 0);
+    check_range(&motion, "ab\n  cd", 6, Some(3..6));
 }
 
 #[test]
@@ -177,14 +210,16 @@ fn motion_prev_char() {
     let motion = PrevChar;
 
     check(&motion, "a", 1, 0);
-    check(&motion, "---------\u{a002d}-\u{fe2c}\0---\u{a05cc}\n", 25, 21)
+    check(&motion, "---------\u{a002d}-\u{fe2c}\0---\u{a05cc}\n", 25, 21);
+    check(&motion, "a🇯🇵", 9, 1);
+    check(&motion, "ae\u{301}", 4, 1);
 }
 
 #[test]
 fn matchit() {
     #[track_caller]
     fn chk(text: &str, p: impl Into<PointOrByte>, expected: impl Into<PointOrByte>) {
-        check(&MatchIt, text, p, expected);
+        check(&MatchIt::default(), text, p, expected);
     }
 
     chk("a", 0, 0);
@@ -197,4 +232,125 @@ fn matchit() {
     chk("((abc))", 5, 1);
     chk("(abc))", 5, 5);
     chk("((abc)", 0, 0);
+    chk("[a[b]c]", 6, 0);
+    chk("{a(b)c}", 0, 6);
+    // Brackets of another kind don't count towards the nesting.
+    chk("(a[b)c]", 0, 4);
+    chk("(a\n(b)\n)", 0, 7);
+    // Not on a bracket, the next bracket on the line is used.
+    chk("ab (c)", 0, 5);
+    chk("ab\n(c)", 0, 0);
+}
+
+#[test]
+fn matchit_literals() {
+    // `f("(", x)` with the string at 2..5.
+    let text = "f(\"(\", x)";
+    let matchit = MatchIt::new(vec![2..5]);
+    check(&matchit, text, 1, 8);
+    check(&matchit, text, 8, 1);
+    // A bracket in the string only matches within the string.
+    check(&matchit, text, 3, 3);
+    assert_eq!(matchit.matching_bracket(&text, 3, 0..text.len()), None);
+
+    let text = "(\"()\")";
+    let matchit = MatchIt::new(vec![1..5]);
+    check(&matchit, text, 2, 3);
+    check(&matchit, text, 0, 5);
+    // The search stays within the bounds.
+    assert_eq!(matchit.matching_bracket(&text, 0, 0..5), None);
+}
+
+#[test]
+fn matchit_range() {
+    check_range(&MatchIt::default(), "a(b)c", 1, Some(1..4));
+    check_range(&MatchIt::default(), "a(b)c", 3, Some(1..4));
+    // From the cursor to the match of the next bracket on the line.
+    check_range(&MatchIt::default(), "a(b)c", 0, Some(0..4));
+    check_range(&MatchIt::default(), "a(bc", 0, None);
+}
+
+#[test]
+fn within_brackets() {
+    let obj = Within(delimiter::Paren);
+    // The innermost pair around the cursor.
+    check_range(&obj, "f(a, (b), c)", 6, Some(6..7));
+    check_range(&obj, "f(a, (b), c)", 2, Some(2..11));
+    check_range(&obj, "f(a, (b), c)", 9, Some(2..11));
+    // On either delimiter
+    check_range(&obj, "f(a, (b), c)", 5, Some(6..7));
+    check_range(&obj, "f(a, (b), c)", 7, Some(6..7));
+    check_range(&obj, "f(a, (b), c)", 0, None);
+    check_range(&obj, "((a)", 0, None);
+    check_range(&obj, "()", 0, Some(1..1));
+    check_range(&obj, "(a\nb)", 2, Some(1..4));
+    // Delimiters on their own lines keep their lines
+    check_range(&Within(delimiter::Brace), "{\n    x\n}", 4, Some(2..8));
+    check_range(&Within(delimiter::Brace), "{\n    x\n    }", 4, Some(2..8));
+
+    let obj = Around(delimiter::Paren);
+    check_range(&obj, "f(a, (b), c)", 6, Some(5..8));
+    check_range(&obj, "f(a, (b), c)", 2, Some(1..12));
+    check_range(&obj, "()", 1, Some(0..2));
+}
+
+#[test]
+fn within_quotes() {
+    let obj = Within(delimiter::Quote);
+    check_range(&obj, r#"say "hi" and "yo""#, 5, Some(5..7));
+    check_range(&obj, r#"say "hi" and "yo""#, 4, Some(5..7));
+    check_range(&obj, r#"say "hi" and "yo""#, 7, Some(5..7));
+    check_range(&obj, r#"say "hi" and "yo""#, 13, Some(14..16));
+    // Before the first quote uses the first quoted string.
+    check_range(&obj, r#"say "hi" and "yo""#, 0, Some(5..7));
+    // Between quoted strings is the text between them, as in vim.
+    check_range(&obj, r#"say "hi" and "yo""#, 9, Some(8..13));
+    check_range(&obj, r#""a\"b""#, 1, Some(1..5));
+    check_range(&obj, r#""""#, 0, Some(1..1));
+    check_range(&obj, "\"a\nb\"", 1, None);
+
+    let obj = Around(delimiter::Quote);
+    check_range(&obj, r#"say "hi" and "yo""#, 5, Some(4..9));
+    check_range(&obj, r#"say "hi" and "yo""#, 14, Some(12..17));
+}
+
+#[test]
+fn word_object() {
+    check_range(&Word::inner(), "foo bar_baz, qux", 5, Some(4..11));
+    check_range(&Word::inner(), "foo bar_baz, qux", 3, Some(3..4));
+    check_range(&Word::inner(), "foo bar_baz, qux", 11, Some(11..12));
+    check_range(&Word::inner(), "a\nb", 1, None);
+
+    check_range(&Word::around(), "foo bar_baz, qux", 0, Some(0..4));
+    // No trailing whitespace, so the leading whitespace is included.
+    check_range(&Word::around(), "foo bar_baz, qux", 5, Some(3..11));
+    check_range(&Word::around(), "foo bar_baz, qux", 3, Some(3..11));
+
+    check_range(&Token::inner(), "foo bar_baz, qux", 5, Some(4..12));
+    check_range(&Token::around(), "foo bar_baz, qux", 5, Some(4..13));
+}
+
+#[test]
+fn paragraph_object() {
+    let text = "a\nb\n\n\nc\n";
+    check_range(&Paragraph::inner(), text, 0, Some(0..4));
+    check_range(&Paragraph::inner(), text, 4, Some(4..6));
+    check_range(&Paragraph::around(), text, 0, Some(0..6));
+    check_range(&Paragraph::around(), text, 4, Some(4..8));
+    // The last paragraph takes the preceding blank lines instead.
+    check_range(&Paragraph::around(), text, 6, Some(4..8));
+}
+
+#[test]
+fn tag_object() {
+    let text = "<a><b>x</b>y</a>";
+    check_range(&Tag::inner(), text, 6, Some(6..7));
+    check_range(&Tag::around(), text, 6, Some(3..11));
+    check_range(&Tag::inner(), text, 11, Some(3..12));
+    check_range(&Tag::around(), text, 11, Some(0..16));
+    // On the tag itself
+    check_range(&Tag::inner(), text, 1, Some(3..12));
+    check_range(&Tag::inner(), "<p>a<br/>b<!-- c --></p>", 3, Some(3..20));
+    check_range(&Tag::inner(), "<p><!-- <a> -->x</a></p>", 15, Some(3..20));
+    check_range(&Tag::inner(), "<a>x</b>", 3, None);
 }
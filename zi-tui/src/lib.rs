@@ -2,10 +2,11 @@ mod element;
 mod sequence;
 
 use std::borrow::Cow;
+use std::collections::BTreeMap;
+use std::fmt;
 use std::iter::Peekable;
 use std::marker::PhantomData;
 use std::str::FromStr;
-use std::{cmp, fmt};
 
 pub use ratatui::backend::Backend;
 pub use ratatui::buffer::Buffer;
@@ -17,6 +18,8 @@ pub use ratatui::widgets::{
     WidgetRef,
 };
 pub use ratatui::{Frame, Terminal, backend};
+use unicode_segmentation::UnicodeSegmentation;
+use unicode_width::UnicodeWidthStr;
 
 /// Convenience trait to allow replacing the frame with a faster implementation for testing.
 pub trait DynFrame {
@@ -94,12 +97,37 @@ where
 
 #[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
 pub enum LineNumberStyle {
-    Absolute,
     #[default]
+    Absolute,
+    /// The distance of each line from the cursor line, the cursor line is `0`.
     Relative,
+    /// Like `Relative`, but the cursor line shows its absolute line number.
+    Hybrid,
     None,
 }
 
+impl LineNumberStyle {
+    /// The style for the combination of vim's `number` and `relativenumber` options.
+    pub fn from_flags(number: bool, relative: bool) -> Self {
+        match (number, relative) {
+            (true, true) => Self::Hybrid,
+            (true, false) => Self::Absolute,
+            (false, true) => Self::Relative,
+            (false, false) => Self::None,
+        }
+    }
+
+    /// Whether the style shows absolute line numbers and relative line numbers respectively, the inverse of `from_flags`.
+    pub fn flags(self) -> (bool, bool) {
+        match self {
+            Self::Absolute => (true, false),
+            Self::Relative => (false, true),
+            Self::Hybrid => (true, true),
+            Self::None => (false, false),
+        }
+    }
+}
+
 impl FromStr for LineNumberStyle {
     type Err = anyhow::Error;
 
@@ -107,9 +135,10 @@ impl FromStr for LineNumberStyle {
         match s {
             "abs" | "absolute" => Ok(Self::Absolute),
             "rel" | "relative" => Ok(Self::Relative),
+            "hybrid" => Ok(Self::Hybrid),
             "none" | "off" => Ok(Self::None),
             _ => anyhow::bail!(
-                "unknown line number style: {s} (expected `absolute`, `none`, or `relative`)"
+                "unknown line number style: {s} (expected `absolute`, `hybrid`, `none`, or `relative`)"
             ),
         }
     }
@@ -120,6 +149,7 @@ impl fmt::Display for LineNumberStyle {
         match self {
             Self::Absolute => write!(f, "absolute"),
             Self::Relative => write!(f, "relative"),
+            Self::Hybrid => write!(f, "hybrid"),
             Self::None => write!(f, "none"),
         }
     }
@@ -132,6 +162,12 @@ pub struct Lines<'a, I: Iterator> {
     tab_width: u8,
     min_number_width: u8,
     cursor_line: usize,
+    /// Signs to render in the leftmost column keyed by 0-indexed line number
+    signs: BTreeMap<usize, (char, Style)>,
+    /// The 0-indexed line number displayed on each row, empty if the rows are consecutive lines from `line_offset`
+    rows: Vec<usize>,
+    /// Continue lines that don't fit on the following rows rather than cutting them off
+    wrap: bool,
     chunks: Peekable<I>,
     _marker: PhantomData<&'a ()>,
 }
@@ -151,10 +187,35 @@ impl<I: Iterator> Lines<'_, I> {
             tab_width,
             min_number_width,
             cursor_line,
+            signs: Default::default(),
+            rows: Default::default(),
+            wrap: false,
             chunks: chunks.peekable(),
             _marker: PhantomData,
         }
     }
+
+    /// Render a sign in the otherwise empty padding column to the left of the line numbers.
+    pub fn signs(mut self, signs: BTreeMap<usize, (char, Style)>) -> Self {
+        self.signs = signs;
+        self
+    }
+
+    /// The line number of each row for when the rows don't display consecutive lines (e.g. some lines are folded).
+    pub fn rows(mut self, rows: Vec<usize>) -> Self {
+        self.rows = rows;
+        self
+    }
+
+    /// Wrap lines that are wider than the area onto the following rows, as [`Wrap`] places them.
+    pub fn wrap(mut self, wrap: bool) -> Self {
+        self.wrap = wrap;
+        self
+    }
+
+    fn line_at_row(&self, row: usize) -> usize {
+        self.rows.get(row).copied().unwrap_or(self.line_offset + row)
+    }
 }
 
 impl<'a, I> Lines<'a, I>
@@ -163,39 +224,14 @@ where
 {
     /// Render the lines to the buffer returning the width of the line numbers.
     pub fn render_(mut self, area: Rect, buf: &mut Buffer) -> usize {
-        fn count_digits(n: usize) -> usize {
-            1 + n.abs_diff(0).checked_ilog10().unwrap_or_default() as usize
-        }
-
-        fn replace_tabs(tab_width: usize, span: &mut Span<'_>) {
-            if span.content.contains('\t') {
-                span.content =
-                    span.content.replace('\t', &format!("{:width$}", "", width = tab_width)).into();
-            }
-        }
-
         let mut lines = vec![];
-        const SPACE: &str = " ";
-        let mut number_width = match self.line_number_style {
-            LineNumberStyle::None => SPACE.len(),
-            _ => self.min_number_width as usize,
-        };
-
         while let Some(&(i, ..)) = self.chunks.peek() {
             if i >= area.height as usize {
                 break;
             }
 
-            // Include placeholder span to replace with line number.
-            let mut spans = vec![Span::raw("")];
-
-            number_width = number_width.max(
-                1 + match self.line_number_style {
-                    LineNumberStyle::None => 0,
-                    LineNumberStyle::Absolute => count_digits(self.line_offset + i + 1),
-                    LineNumberStyle::Relative => count_digits(self.cursor_line + 1),
-                },
-            );
+            // Include placeholder spans to replace with the sign and line number.
+            let mut spans = vec![Span::raw(""), Span::raw("")];
 
             while let Some(&(j, ref text, style)) = self.chunks.peek() {
                 if j != i {
@@ -209,38 +245,60 @@ where
 
             // Tabs are currently not rendered at all. We replace them with spaces for rendering purposes.
             // https://github.com/ratatui-org/ratatui/issues/876
-            spans.iter_mut().for_each(|span| replace_tabs(self.tab_width as usize, span));
+            for span in spans.iter_mut().filter(|span| span.content.contains('\t')) {
+                span.content =
+                    expand_tabs(&span.content, self.tab_width as usize).into_owned().into();
+            }
 
             lines.push(Line::default().spans(spans));
         }
 
+        let rows = (0..lines.len()).map(|i| self.line_at_row(i)).collect::<Vec<_>>();
+        let numbers = line_numbers(self.line_number_style, self.cursor_line, &rows);
+        let number_width = number_width(self.line_number_style, self.min_number_width, &numbers);
         assert!(number_width > 0, "number_width should include room for one space");
 
         for (i, line) in lines.iter_mut().enumerate() {
             // Set line number spans for each line.
             let style = Style::new().fg(Color::Rgb(0x58, 0x6e, 0x75));
-            let line_number_span = match self.line_number_style {
-                LineNumberStyle::Relative => {
-                    let number = match self.cursor_line.cmp(&(i + self.line_offset)) {
-                        cmp::Ordering::Less => i + self.line_offset - self.cursor_line,
-                        cmp::Ordering::Equal => self.cursor_line + 1,
-                        cmp::Ordering::Greater => self.cursor_line - i - self.line_offset,
-                    };
-
-                    Span::styled(format!(" {:width$} ", number, width = number_width - 1), style)
+            let line_idx = rows[i];
+            let line_number_span = match numbers[i] {
+                Some(number) => {
+                    Span::styled(format!("{:width$} ", number, width = number_width - 1), style)
                 }
-                LineNumberStyle::Absolute => Span::styled(
-                    format!(" {:width$} ", self.line_offset + i + 1, width = number_width - 1),
-                    style,
-                ),
-                LineNumberStyle::None => Span::styled("  ", style),
+                None => Span::styled(" ", style),
+            };
+
+            line.spans[0] = match self.signs.get(&line_idx) {
+                Some(&(sign, style)) => Span::styled(sign.to_string(), style),
+                None => Span::styled(SPACE, style),
             };
+            line.spans[1] = line_number_span;
+        }
 
-            line.spans[0] = line_number_span;
+        if self.wrap {
+            render_wrapped(&lines, 1 + number_width, area, buf);
+            return 1 + number_width;
         }
 
         lines.iter().enumerate().for_each(|(i, line)| {
-            buf.set_line(area.x, area.y + i as u16, line, area.width);
+            let y = area.y + i as u16;
+            buf.set_line(area.x, y, line, area.width);
+
+            // A wide grapheme that doesn't fit in the last column is not split in half.
+            // The column is padded in its place to show the line continues, as vim does.
+            let mut x = 0;
+            for grapheme in line.styled_graphemes(Style::default()) {
+                let width = grapheme.symbol.width() as u16;
+                x += width;
+                if x > area.width {
+                    if x - width < area.width {
+                        let style = Style::new().fg(Color::Rgb(0x58, 0x6e, 0x75));
+                        buf.set_string(area.x + area.width - 1, y, ">", style);
+                    }
+                    break;
+                }
+            }
         });
 
         // + 1 for the ever present left padding space
@@ -248,6 +306,158 @@ where
     }
 }
 
+const SPACE: &str = " ";
+
+/// Render each line from the first row after the previous one, continuing the text on as many rows as it takes.
+/// The continuation rows have an empty gutter.
+fn render_wrapped(lines: &[Line<'_>], gutter_width: usize, area: Rect, buf: &mut Buffer) {
+    let text_x = area.x + gutter_width as u16;
+    let text_width = area.width.saturating_sub(gutter_width as u16);
+    let mut y = area.y;
+    for line in lines {
+        let (gutter, text) = line.spans.split_at(2);
+        let rows = wrap_spans(text, text_width as usize);
+        for (i, row) in rows.iter().enumerate() {
+            if y >= area.bottom() {
+                return;
+            }
+
+            if i == 0 {
+                buf.set_line(area.x, y, &Line::default().spans(gutter.to_vec()), area.width);
+            }
+            let (x, _) = buf.set_line(text_x, y, &Line::default().spans(row.clone()), text_width);
+
+            // A wide grapheme that didn't fit on the row leaves a gap, which is marked as vim does.
+            if i + 1 < rows.len() && x < text_x + text_width {
+                let style = Style::new().fg(Color::Rgb(0x58, 0x6e, 0x75));
+                buf.set_string(text_x + text_width - 1, y, ">", style);
+            }
+            y += 1;
+        }
+    }
+}
+
+/// Split the spans of a line into the rows they are displayed on when wrapped at `width` cells.
+fn wrap_spans<'a>(spans: &[Span<'a>], width: usize) -> Vec<Vec<Span<'a>>> {
+    let mut wrap = Wrap::new(width);
+    let mut rows = vec![vec![]];
+    for span in spans {
+        let mut start = 0;
+        for (i, grapheme) in span.content.grapheme_indices(true) {
+            let (row, _) = wrap.place(grapheme.width());
+            if row == rows.len() {
+                if i > start {
+                    rows[row - 1]
+                        .push(Span::styled(span.content[start..i].to_string(), span.style));
+                }
+                rows.push(vec![]);
+                start = i;
+            }
+        }
+
+        if start < span.content.len() {
+            let row = rows.len() - 1;
+            rows[row].push(Span::styled(span.content[start..].to_string(), span.style));
+        }
+    }
+    rows
+}
+
+/// Places the graphemes of a line one after another when it is wrapped at `width` cells.
+/// A grapheme that doesn't fit on the rest of a row goes at the start of the next one,
+/// so a wide character is never split across rows.
+#[derive(Debug, Clone, Copy)]
+pub struct Wrap {
+    width: usize,
+    row: usize,
+    col: usize,
+}
+
+impl Wrap {
+    pub fn new(width: usize) -> Self {
+        Self { width, row: 0, col: 0 }
+    }
+
+    /// Place a grapheme `width` cells wide, returning the row and column of its first cell.
+    pub fn place(&mut self, width: usize) -> (usize, usize) {
+        if self.col > 0 && self.col + width > self.width {
+            self.row += 1;
+            self.col = 0;
+        }
+
+        let position = (self.row, self.col);
+        self.col += width;
+        position
+    }
+
+    /// The row and column of the cell after the last grapheme placed.
+    pub fn position(&self) -> (usize, usize) {
+        (self.row, self.col)
+    }
+
+    /// The number of rows the graphemes placed so far take up.
+    pub fn rows(&self) -> usize {
+        self.row + 1
+    }
+}
+
+/// Replace each tab with `tab_width` spaces, this is how `Lines` renders them.
+pub fn expand_tabs(text: &str, tab_width: usize) -> Cow<'_, str> {
+    if text.contains('\t') {
+        Cow::Owned(text.replace('\t', &SPACE.repeat(tab_width)))
+    } else {
+        Cow::Borrowed(text)
+    }
+}
+
+/// The width of the gutter `Lines` renders for the lines displayed on each row.
+/// This is the sign column followed by the line numbers and the space after them.
+pub fn gutter_width(
+    style: LineNumberStyle,
+    min_number_width: u8,
+    cursor_line: usize,
+    rows: &[usize],
+) -> usize {
+    // + 1 for the ever present left padding space
+    1 + number_width(style, min_number_width, &line_numbers(style, cursor_line, rows))
+}
+
+/// The number shown on each row, `rows` being the 0-indexed line displayed on each of them.
+fn line_numbers(style: LineNumberStyle, cursor_line: usize, rows: &[usize]) -> Vec<Option<usize>> {
+    // Relative numbers count rows rather than lines so a closed fold counts as one line, as it does for motions.
+    let cursor_row = rows.iter().position(|&line| line == cursor_line);
+    rows.iter()
+        .enumerate()
+        .map(|(i, &line)| {
+            let distance = match cursor_row {
+                Some(cursor_row) => i.abs_diff(cursor_row),
+                None => line.abs_diff(cursor_line),
+            };
+
+            match style {
+                LineNumberStyle::None => None,
+                LineNumberStyle::Absolute => Some(line + 1),
+                LineNumberStyle::Hybrid if distance == 0 => Some(line + 1),
+                LineNumberStyle::Relative | LineNumberStyle::Hybrid => Some(distance),
+            }
+        })
+        .collect()
+}
+
+/// The width of the numbers including the space after them.
+/// The gutter is as wide as the widest number in the viewport, so it widens as soon as a number gains a digit.
+fn number_width(style: LineNumberStyle, min_number_width: u8, numbers: &[Option<usize>]) -> usize {
+    fn count_digits(n: usize) -> usize {
+        1 + n.abs_diff(0).checked_ilog10().unwrap_or_default() as usize
+    }
+
+    let min = match style {
+        LineNumberStyle::None => SPACE.len(),
+        _ => min_number_width as usize,
+    };
+    numbers.iter().flatten().map(|&number| 1 + count_digits(number)).fold(min, usize::max)
+}
+
 impl<'a, I> Widget for Lines<'a, I>
 where
     I: Iterator<Item = (usize, Cow<'a, str>, Style)>,
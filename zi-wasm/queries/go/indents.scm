@@ -0,0 +1,23 @@
+[
+  (block)
+  (literal_value)
+  (argument_list)
+  (parameter_list)
+  (field_declaration_list)
+  (interface_type)
+  (import_spec_list)
+  (const_declaration)
+  (var_declaration)
+  (expression_case)
+  (type_case)
+  (default_case)
+  (communication_case)
+] @indent
+
+; The braces of a switch or select are left alone as gofmt lines the cases up with the statement itself.
+(block "}" @outdent)
+(literal_value "}" @outdent)
+(field_declaration_list "}" @outdent)
+(interface_type "}" @outdent)
+
+")" @outdent
@@ -16,7 +16,7 @@ use tokio_stream::wrappers::ReadDirStream;
 pub use wasmtime::Engine;
 use wasmtime::component::{Component, Linker, Resource, ResourceAny};
 use zi::command::{self, CommandRange, Handler, Word};
-use zi::{Active, BufferId, Client, LanguageConfig, Point, ViewId, dirs};
+use zi::{Active, BufferId, Client, Formatter, LanguageConfig, Point, ViewId, dirs};
 use zi_lsp::LanguageServerConfig;
 
 use crate::wit::Plugin;
@@ -283,6 +283,19 @@ impl api::editor::Host for HostState {
             })
             .await
     }
+
+    async fn register_formatter(&mut self, filetype: String, command: String, args: Vec<String>) {
+        self.client
+            .with(move |editor| {
+                editor
+                    .language_config_mut()
+                    .languages
+                    .entry(zi::FileType::from_name(&filetype))
+                    .or_default()
+                    .formatter = Some(Formatter::new(command, args));
+            })
+            .await
+    }
 }
 
 /// The plugin manager responsible for loading and running wasm plugins and keeping track of their state.
@@ -1,6 +1,8 @@
 use std::cell::RefCell;
+use std::cmp::Reverse;
 use std::collections::HashMap;
-use std::ops::Bound;
+use std::ops::{Bound, Range, RangeInclusive};
+use std::path::Path;
 use std::sync::OnceLock;
 
 use parking_lot::RwLock;
@@ -27,15 +29,8 @@ impl zi::Syntax for Syntax {
     /// Set the text of the syntax tree.
     /// Prefer using `edit` if you have a delta.
     fn set(&mut self, text: &dyn AnyText) {
-        self.tree = PARSER.with(|parser| {
-            let mut parser = parser.borrow_mut();
-            parser.set_language(&self.language).unwrap();
-            parser.parse_with_options(
-                &mut |byte, _point| text.byte_slice(byte..).chunks().next().unwrap_or(""),
-                None,
-                None,
-            )
-        });
+        self.tree = parse(&self.language, text, None, &self.ranges);
+        self.update_injections(text);
     }
 
     fn edit(
@@ -43,24 +38,18 @@ impl zi::Syntax for Syntax {
         text: &mut dyn AnyTextMut,
         deltas: &Deltas<'_>,
     ) -> (Deltas<'static>, Option<Tree>) {
-        let deltas = match &mut self.tree {
-            Some(tree) => apply_deltas(text, deltas, tree),
-            _ => text.edit(deltas).to_owned(),
+        // Since deltas are sorted in descending range and are disjoint, we can apply them in without interference.
+        let edits =
+            deltas.iter().map(|delta| delta_to_ts_edit(text.as_text(), delta)).collect::<Vec<_>>();
+        self.edit_trees(&edits);
+        let deltas = text.edit(deltas);
+
+        let prev_tree = match parse(&self.language, text.as_text(), self.tree.as_ref(), &[]) {
+            Some(tree) => self.tree.replace(tree),
+            None => self.tree.clone(),
         };
 
-        let prev_tree = PARSER.with(|parser| {
-            let mut parser = parser.borrow_mut();
-            parser.set_language(&self.language).unwrap();
-            if let Some(tree) = parser.parse_with_options(
-                &mut |byte, _point| text.byte_slice(byte..).chunks().next().unwrap_or(""),
-                self.tree.as_ref(),
-                None,
-            ) {
-                self.tree.replace(tree)
-            } else {
-                self.tree.clone()
-            }
-        });
+        self.update_injections(text.as_text());
 
         (deltas, prev_tree)
     }
@@ -85,13 +74,185 @@ impl zi::Syntax for Syntax {
             None => Box::new(Highlights::Empty),
         }
     }
+
+    fn injections(&self) -> Box<dyn Iterator<Item = &dyn zi::Syntax> + '_> {
+        Box::new(self.injections.iter().flat_map(|injection| {
+            std::iter::once(injection as &dyn zi::Syntax).chain(zi::Syntax::injections(injection))
+        }))
+    }
+
+    fn fold_ranges(&self) -> Vec<RangeInclusive<usize>> {
+        let Some(tree) = &self.tree else { return vec![] };
+
+        let mut ranges = vec![];
+        let mut cursor = tree.walk();
+        'walk: loop {
+            let node = cursor.node();
+            let start = node.start_position().row;
+            // A node ending at the start of a line (i.e. after a newline) doesn't include that line.
+            let end = match node.end_position() {
+                tree_sitter::Point { row, column: 0 } => row.saturating_sub(1),
+                point => point.row,
+            };
+
+            if end > start && node.is_named() && is_foldable(node.kind()) {
+                ranges.push(start..=end);
+            }
+
+            // Nothing within a single line node can be folded.
+            if end > start && cursor.goto_first_child() {
+                continue;
+            }
+
+            while !cursor.goto_next_sibling() {
+                if !cursor.goto_parent() {
+                    break 'walk;
+                }
+            }
+        }
+
+        // A function and its body usually span the same lines.
+        ranges.sort_by_key(|range| (*range.start(), Reverse(*range.end())));
+        ranges.dedup();
+        ranges
+    }
+
+    fn literal_ranges(&self, byte_range: Range<usize>) -> Vec<Range<usize>> {
+        let Some(tree) = &self.tree else { return vec![] };
+
+        let mut ranges = vec![];
+        let mut cursor = tree.walk();
+        'walk: loop {
+            let node = cursor.node();
+            let overlaps = node.start_byte() < byte_range.end && byte_range.start < node.end_byte();
+            if overlaps && is_literal(node.kind()) {
+                ranges.push(node.byte_range());
+            } else if overlaps && cursor.goto_first_child() {
+                // Nothing within a string or comment is another literal.
+                continue;
+            }
+
+            while !cursor.goto_next_sibling() {
+                if !cursor.goto_parent() {
+                    break 'walk;
+                }
+            }
+        }
+        ranges
+    }
+
+    /// Lines are indented once for each `@indent` node that starts on an earlier line and contains the line, nodes
+    /// starting on the same line only count once.
+    /// An `@outdent` node at the start of the line (e.g. the closing brace of a block) removes a level.
+    fn indent_level(&self, text: &dyn AnyText, line: usize) -> Option<usize> {
+        let (Some(tree), Some(query)) = (&self.tree, self.indents_query) else { return None };
+        let start = text.try_line_to_byte(line)? + text.line(line).map_or(0, |line| line.indent());
+
+        let root = tree.root_node();
+        let mut node = root.descendant_for_byte_range(start, start);
+        while let Some(n) = node {
+            if n.is_error() || n.is_missing() {
+                return None;
+            }
+            node = n.parent();
+        }
+
+        let indent_idx = query.capture_index_for_name("indent");
+        let outdent_idx = query.capture_index_for_name("outdent");
+
+        let mut rows = vec![];
+        let mut outdent = false;
+        let mut cursor = QueryCursor::new();
+        cursor.set_point_range(
+            tree_sitter::Point { row: line, column: 0 }..tree_sitter::Point {
+                row: line + 1,
+                column: 0,
+            },
+        );
+        let mut matches = cursor.matches(
+            query,
+            root,
+            TextProvider(text.dyn_byte_slice((Bound::Unbounded, Bound::Unbounded))),
+        );
+
+        while let Some(m) = matches.next() {
+            for capture in m.captures {
+                let node = capture.node;
+                if Some(capture.index) == indent_idx {
+                    let start_row = node.start_position().row;
+                    let end_row = match node.end_position() {
+                        tree_sitter::Point { row, column: 0 } => row.saturating_sub(1),
+                        point => point.row,
+                    };
+                    if start_row < line && line <= end_row {
+                        rows.push(start_row);
+                    }
+                } else if Some(capture.index) == outdent_idx && node.start_byte() == start {
+                    outdent = true;
+                }
+            }
+        }
+
+        rows.sort_unstable();
+        rows.dedup();
+        Some(rows.len().saturating_sub(outdent as usize))
+    }
+}
+
+/// Grammars don't come with fold queries, so nodes are folded based on their kind.
+/// These are substrings of the node kinds across grammars, e.g. `function_item` in Rust and `func_literal` in Go.
+const FOLDABLE_KINDS: &[&str] = &[
+    "func",
+    "method",
+    "closure",
+    "lambda",
+    "block",
+    "class",
+    "impl",
+    "trait",
+    "struct",
+    "enum",
+    "interface",
+    "module",
+    "mod_item",
+];
+
+fn is_foldable(kind: &str) -> bool {
+    !kind.contains("call") && FOLDABLE_KINDS.iter().any(|foldable| kind.contains(foldable))
+}
+
+/// Strings and comments are found by their node kind too, e.g. `string_literal` and `line_comment` in Rust and
+/// `raw_string_literal` in Go. Characters count as well so `'('` isn't matched.
+const LITERAL_KINDS: &[&str] = &["string", "comment", "char_literal", "rune_literal", "character"];
+
+fn is_literal(kind: &str) -> bool {
+    LITERAL_KINDS.iter().any(|literal| kind.contains(literal))
 }
 
 pub struct Syntax {
     file_type: FileType,
     language: tree_sitter::Language,
     highlights_query: &'static Query,
+    injections_query: Option<&'static Query>,
+    indents_query: Option<&'static Query>,
     tree: Option<Tree>,
+    /// The ranges of the text this tree covers if it is an injection, otherwise empty to cover the entire text.
+    ranges: Vec<tree_sitter::Range>,
+    /// The trees of the languages injected into this one.
+    injections: Vec<Syntax>,
+    /// How deeply nested this tree is within injections.
+    depth: usize,
+}
+
+/// Injections nested deeper than this are ignored, mostly to protect against languages that inject themselves.
+const MAX_INJECTION_DEPTH: usize = 4;
+
+#[derive(Clone)]
+struct Grammar {
+    language: tree_sitter::Language,
+    highlights_query: &'static Query,
+    injections_query: Option<&'static Query>,
+    indents_query: Option<&'static Query>,
 }
 
 /// The wasm engine to use for tree-sitter.
@@ -112,15 +273,14 @@ thread_local! {
 /// A cache of tree-sitter queries for each language.
 /// Creating a query and compiling a language is very expensive, so we cache them here forever.
 /// Not concerned about memory usage because these are not large, and there are not many languages.
-static QUERY_CACHE: OnceLock<RwLock<HashMap<FileType, (tree_sitter::Language, &'static Query)>>> =
-    OnceLock::new();
+static QUERY_CACHE: OnceLock<RwLock<HashMap<FileType, Grammar>>> = OnceLock::new();
 
 impl Syntax {
     #[tracing::instrument]
     pub fn for_file_type(file_type: FileType) -> anyhow::Result<Option<Self>> {
         let cache = QUERY_CACHE.get_or_init(Default::default);
         let read_guard = cache.read();
-        let (language, highlights_query) = match read_guard.get(&file_type) {
+        let grammar = match read_guard.get(&file_type) {
             Some(cached) => cached.clone(),
             None => {
                 drop(read_guard);
@@ -128,6 +288,8 @@ impl Syntax {
                 let grammar_dir = dirs::grammar().join(file_type);
                 let wasm_path = grammar_dir.join("language.wasm");
                 let highlights_path = grammar_dir.join("highlights.scm");
+                let injections_path = grammar_dir.join("injections.scm");
+                let indents_path = grammar_dir.join("indents.scm");
 
                 if !wasm_path.exists() || !highlights_path.exists() {
                     tracing::info!(?file_type, "no wasm or highlights file found for language");
@@ -150,15 +312,164 @@ impl Syntax {
                 let highlights_text = std::fs::read_to_string(highlights_path)?;
                 let highlights_query =
                     &*Box::leak(Box::new(Query::new(&language, &highlights_text)?));
-                cache.write().insert(file_type, (language.clone(), highlights_query));
-                (language, highlights_query)
+
+                // Injections and indents are optional, most languages don't have any injections.
+                let optional_query = |path: &Path| -> anyhow::Result<Option<&'static Query>> {
+                    if !path.exists() {
+                        return Ok(None);
+                    }
+                    let text = std::fs::read_to_string(path)?;
+                    Ok(Some(&*Box::leak(Box::new(Query::new(&language, &text)?))))
+                };
+                let injections_query = optional_query(&injections_path)?;
+                let indents_query = optional_query(&indents_path)?;
+
+                let grammar =
+                    Grammar { language, highlights_query, injections_query, indents_query };
+                cache.write().insert(file_type, grammar.clone());
+                grammar
             }
         };
 
-        Ok(Some(Self { file_type, language, highlights_query, tree: None }))
+        Ok(Some(Self {
+            file_type,
+            language: grammar.language,
+            highlights_query: grammar.highlights_query,
+            injections_query: grammar.injections_query,
+            indents_query: grammar.indents_query,
+            tree: None,
+            ranges: vec![],
+            injections: vec![],
+            depth: 0,
+        }))
+    }
+
+    fn edit_trees(&mut self, edits: &[InputEdit]) {
+        if let Some(tree) = &mut self.tree {
+            edits.iter().for_each(|edit| tree.edit(edit));
+        }
+
+        // Injected trees must be edited too so they can be reparsed incrementally.
+        // Their included ranges are recomputed after the parent is reparsed so we don't need to adjust them here.
+        self.injections.iter_mut().for_each(|injection| injection.edit_trees(edits));
+    }
+
+    /// Find the injected languages in the (already parsed) tree and parse each of them.
+    /// Injections marked with `injection.combined` are parsed as a single tree per language,
+    /// all other injections get a tree each.
+    fn update_injections(&mut self, text: &dyn AnyText) {
+        let (Some(tree), Some(query)) = (&self.tree, self.injections_query) else {
+            self.injections.clear();
+            return;
+        };
+
+        let Some(content_idx) = query.capture_index_for_name("injection.content") else {
+            return;
+        };
+        let language_idx = query.capture_index_for_name("injection.language");
+
+        if self.depth >= MAX_INJECTION_DEPTH {
+            return;
+        }
+
+        let mut layers = Vec::<(FileType, bool, Vec<tree_sitter::Range>)>::new();
+        let mut cursor = QueryCursor::new();
+        let mut matches = cursor.matches(
+            query,
+            tree.root_node(),
+            TextProvider(text.dyn_byte_slice((Bound::Unbounded, Bound::Unbounded))),
+        );
+
+        while let Some(m) = matches.next() {
+            let mut language = None;
+            let mut combined = false;
+            for property in query.property_settings(m.pattern_index) {
+                match &*property.key {
+                    "injection.language" => {
+                        language = property.value.as_deref().map(FileType::from_name)
+                    }
+                    "injection.combined" => combined = true,
+                    _ => {}
+                }
+            }
+
+            let mut ranges = vec![];
+            for capture in m.captures {
+                if Some(capture.index) == language_idx {
+                    let name = text
+                        .byte_slice(capture.node.byte_range())
+                        .chunks()
+                        .collect::<String>()
+                        .to_ascii_lowercase();
+                    language = Some(FileType::from_name(&name));
+                } else if capture.index == content_idx {
+                    ranges.push(capture.node.range());
+                }
+            }
+
+            let Some(language) = language else { continue };
+            if ranges.is_empty() {
+                continue;
+            }
+
+            match layers.iter_mut().find(|(ft, c, _)| combined && *c && *ft == language) {
+                Some((_, _, layer_ranges)) => layer_ranges.extend(ranges),
+                None => layers.push((language, combined, ranges)),
+            }
+        }
+
+        let mut prev = std::mem::take(&mut self.injections);
+        for (file_type, _, ranges) in layers {
+            // Reuse the previous tree of the same language if there is one for an incremental reparse.
+            let mut injection = match prev.iter().position(|syntax| syntax.file_type == file_type) {
+                Some(idx) => prev.swap_remove(idx),
+                None => match Self::for_file_type(file_type) {
+                    Ok(Some(mut syntax)) => {
+                        syntax.depth = self.depth + 1;
+                        syntax
+                    }
+                    Ok(None) => continue,
+                    Err(err) => {
+                        tracing::error!(%file_type, ?err, "failed to load injected language");
+                        continue;
+                    }
+                },
+            };
+
+            injection.tree = parse(&injection.language, text, injection.tree.as_ref(), &ranges);
+            injection.ranges = ranges;
+            injection.update_injections(text);
+            self.injections.push(injection);
+        }
     }
 }
 
+/// Parse the text, restricted to the given ranges if non-empty.
+fn parse(
+    language: &tree_sitter::Language,
+    text: &dyn AnyText,
+    old_tree: Option<&Tree>,
+    ranges: &[tree_sitter::Range],
+) -> Option<Tree> {
+    PARSER.with(|parser| {
+        let mut parser = parser.borrow_mut();
+        parser.set_language(language).unwrap();
+        if let Err(err) = parser.set_included_ranges(ranges) {
+            tracing::error!(?err, "invalid included ranges");
+            return None;
+        }
+
+        let tree = parser.parse_with_options(
+            &mut |byte, _point| text.byte_slice(byte..).chunks().next().unwrap_or(""),
+            old_tree,
+            None,
+        );
+
+        parser.set_included_ranges(&[]).expect("empty ranges are always valid");
+        tree
+    })
+}
+
 fn smallest_node_that_covers_range(tree: &Tree, range: PointRange) -> Node<'_> {
     let mut cursor = tree.walk();
     if cursor.goto_first_child_for_point(range.start().into()).is_none() {
@@ -177,16 +488,6 @@ fn smallest_node_that_covers_range(tree: &Tree, range: PointRange) -> Node<'_> {
     cursor.node()
 }
 
-fn apply_deltas(
-    text: &mut dyn AnyTextMut,
-    deltas: &Deltas<'_>,
-    tree: &mut Tree,
-) -> Deltas<'static> {
-    // Since deltas are sorted in descending range and are disjoint, we can apply them in without interference.
-    deltas.iter().for_each(|delta| tree.edit(&delta_to_ts_edit(text.as_text(), delta)));
-    text.edit(deltas)
-}
-
 // tree-sitter's `point.column` is byte-indexed, but very poorly documented
 fn delta_to_ts_edit(text: impl Text, delta: &Delta<'_>) -> InputEdit {
     let byte_range = delta.range();
@@ -257,6 +558,8 @@ impl<'a, 'tree: 'a> Iterator for Highlights<'a, 'tree> {
 
 #[cfg(test)]
 mod tests {
+    use zi::Syntax as _;
+
     use super::*;
 
     #[test]
@@ -339,4 +642,27 @@ mod tests {
             assert_eq!(edit, input);
         }
     }
+
+    #[test]
+    fn indent_level_go() -> anyhow::Result<()> {
+        // The grammar is installed by the Makefile, the query is loaded from the source tree so it is always the one
+        // being shipped.
+        let Some(mut syntax) = Syntax::for_file_type(FileType::from_name("go"))? else {
+            return Ok(());
+        };
+        syntax.indents_query = Some(Box::leak(Box::new(Query::new(
+            &syntax.language,
+            include_str!("../queries/go/indents.scm"),
+        )?)));
+
+        let text = "package main\n\nfunc main() {\n\tswitch x {\n\tcase 1:\n\t\tfoo(\n\t\t\ta,\n\t\t)\n\tdefault:\n\t}\n}\n";
+        syntax.set(&text);
+
+        let levels = (0..11).map(|line| syntax.indent_level(&text, line)).collect::<Vec<_>>();
+        assert_eq!(
+            levels,
+            [0, 0, 0, 1, 1, 2, 3, 2, 1, 1, 0].into_iter().map(Some).collect::<Vec<_>>()
+        );
+        Ok(())
+    }
 }
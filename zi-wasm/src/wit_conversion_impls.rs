@@ -39,6 +39,10 @@ impl From<zi::Operator> for api::editor::Operator {
             zi::Operator::Change => api::editor::Operator::Change,
             zi::Operator::Delete => api::editor::Operator::Delete,
             zi::Operator::Yank => api::editor::Operator::Yank,
+            zi::Operator::Comment => api::editor::Operator::Comment,
+            zi::Operator::Fold => api::editor::Operator::Fold,
+            zi::Operator::Surround => api::editor::Operator::Surround,
+            zi::Operator::Filter => api::editor::Operator::Filter,
         }
     }
 }
@@ -49,6 +53,10 @@ impl From<api::editor::Operator> for zi::Operator {
             api::editor::Operator::Change => zi::Operator::Change,
             api::editor::Operator::Delete => zi::Operator::Delete,
             api::editor::Operator::Yank => zi::Operator::Yank,
+            api::editor::Operator::Comment => zi::Operator::Comment,
+            api::editor::Operator::Fold => zi::Operator::Fold,
+            api::editor::Operator::Surround => zi::Operator::Surround,
+            api::editor::Operator::Filter => zi::Operator::Filter,
         }
     }
 }
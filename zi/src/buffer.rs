@@ -2,6 +2,8 @@ mod explorer;
 mod inspector;
 mod mark;
 pub mod picker;
+#[cfg(unix)]
+mod terminal;
 mod text;
 
 use std::any::Any;
@@ -10,7 +12,7 @@ use std::path::{Path, PathBuf};
 
 use stdx::sync::Cancel;
 use tree_sitter::QueryCursor;
-use unicode_width::UnicodeWidthChar;
+use unicode_width::UnicodeWidthStr;
 use zi_core::BufferId;
 use zi_text::{AnyText, Delta, Deltas};
 
@@ -19,13 +21,16 @@ pub use self::inspector::InspectorBuffer;
 use self::mark::Marks;
 pub use self::mark::{Mark, MarkBuilder, MarkId};
 pub use self::picker::PickerBuffer;
+#[cfg(unix)]
+pub use self::terminal::TerminalBuffer;
 pub use self::text::TextBuffer;
 use crate::config::Setting;
 use crate::editor::{Resource, Selector};
 use crate::keymap::Keymap;
 use crate::private::Internal;
 use crate::syntax::{HighlightId, Syntax, Theme};
-use crate::{Client, Editor, FileType, Point, PointRange, Size, Url, View};
+use crate::undo::UndoStep;
+use crate::{Client, Editor, Encoding, FileFormat, FileType, Point, PointRange, Size, Url, View};
 
 impl Selector<Self> for BufferId {
     #[inline]
@@ -40,6 +45,10 @@ bitflags::bitflags! {
         const READONLY = 1 << 0;
         const DIRTY = 1 << 1;
         const ENSURE_TRAILING_NEWLINE = 1 << 2;
+        /// The file was too large to load up front, see `Settings::large_file_threshold`.
+        const LARGE = 1 << 3;
+        /// The file had a mix of line endings, they're all written as `Settings::file_format` on the next save.
+        const MIXED_LINE_ENDINGS = 1 << 4;
     }
 
     #[derive(Debug, Clone, Copy)]
@@ -60,6 +69,10 @@ pub struct Settings {
     pub tab_width: Setting<u8>,
     pub indent: Setting<IndentSettings>,
     pub format_on_save: Setting<bool>,
+    /// The encoding the file is written in, this is detected when the file is opened.
+    pub encoding: Setting<Encoding>,
+    /// The line ending the file is written with, this is detected when the file is opened.
+    pub file_format: Setting<FileFormat>,
 }
 
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
@@ -68,12 +81,37 @@ pub enum IndentSettings {
     Tabs,
 }
 
+impl IndentSettings {
+    /// The width of a level of indentation, this is just a tab when indenting with tabs.
+    pub fn width(self, tab_width: u8) -> u8 {
+        match self {
+            IndentSettings::Spaces(n) => n,
+            IndentSettings::Tabs => tab_width,
+        }
+    }
+
+    /// The whitespace for indentation that is `width` columns wide.
+    pub fn whitespace(self, tab_width: u8, width: usize) -> String {
+        match self {
+            IndentSettings::Spaces(_) => " ".repeat(width),
+            IndentSettings::Tabs => {
+                let tab_width = tab_width.max(1) as usize;
+                let mut s = "\t".repeat(width / tab_width);
+                s.push_str(&" ".repeat(width % tab_width));
+                s
+            }
+        }
+    }
+}
+
 impl Default for Settings {
     fn default() -> Self {
         Self {
             tab_width: Setting::new(4),
             indent: Setting::new(IndentSettings::Spaces(4)),
             format_on_save: Setting::new(true),
+            encoding: Setting::new(Encoding::default()),
+            file_format: Setting::new(FileFormat::default()),
         }
     }
 }
@@ -89,6 +127,8 @@ pub struct SyntaxHighlight {
     pub range: PointRange,
     pub id: HighlightId,
     pub capture_idx: u32,
+    /// The language of the query the capture index belongs to, this differs from the buffer's for injected languages.
+    pub file_type: FileType,
 }
 
 impl Resource for Buffer {
@@ -111,6 +151,8 @@ impl Resource for Buffer {
 pub struct UndoEntry {
     pub changes: Box<[Change]>,
     pub cursor: Option<Point>,
+    /// All cursors (primary first) prior to the change if it was made with multiple cursors.
+    pub cursors: Option<Box<[Point]>>,
 }
 
 #[derive(Clone, Debug)]
@@ -128,11 +170,24 @@ pub(crate) trait BufferHistory {
     /// Return the next redo entry (without applying it)
     fn redo(&mut self) -> Option<UndoEntry>;
 
+    /// Return the entries to undo and redo (without applying them) to go `count` revisions back in time
+    fn earlier(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>>;
+
+    /// Return the entries to undo and redo (without applying them) to go `count` revisions forward in time
+    fn later(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>>;
+
+    /// A textual representation of the undo tree for debugging
+    fn undo_tree(&self) -> String;
+
     fn clear(&mut self);
 
     fn snapshot(&mut self, flags: SnapshotFlags);
 
     fn snapshot_cursor(&mut self, cursor: Point);
+
+    /// Save the cursors to restore on undo.
+    /// Unlike `snapshot_cursor`, only the first call before the next snapshot has any effect.
+    fn snapshot_cursors(&mut self, cursors: Box<[Point]>);
 }
 
 // This wraps the trait to provide common functionality and to make it easier to control method privacy.
@@ -225,6 +280,10 @@ impl Buffer {
         self.inner.snapshot_cursor(cursor);
     }
 
+    pub(crate) fn snapshot_cursors(&mut self, cursors: Box<[Point]>) {
+        self.inner.snapshot_cursors(cursors);
+    }
+
     pub(crate) fn undo(&mut self) -> Option<UndoEntry> {
         self.inner.undo()
     }
@@ -233,6 +292,18 @@ impl Buffer {
         self.inner.redo()
     }
 
+    pub(crate) fn earlier(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>> {
+        self.inner.earlier(count)
+    }
+
+    pub(crate) fn later(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>> {
+        self.inner.later(count)
+    }
+
+    pub(crate) fn undo_tree(&mut self) -> Option<String> {
+        self.inner.undo_tree()
+    }
+
     pub(crate) fn clear_undo(&mut self) {
         self.inner.clear_undo();
     }
@@ -259,11 +330,14 @@ impl Buffer {
         self.inner.syntax()
     }
 
-    pub(crate) fn char_width(&self, c: char) -> usize {
-        c.width().unwrap_or(match c {
-            '\t' => *self.settings().tab_width.read() as usize,
-            _ => 0,
-        })
+    /// The number of cells a grapheme cluster takes up when rendered.
+    /// Wide characters (e.g. CJK and most emoji) take two cells while combining marks and joiners
+    /// don't add to the width of the cluster they are part of.
+    pub(crate) fn grapheme_width(&self, grapheme: &str) -> usize {
+        match grapheme {
+            "\t" => *self.settings().tab_width.read() as usize,
+            _ => grapheme.width(),
+        }
     }
 }
 
@@ -379,6 +453,21 @@ impl dyn BufferInternal + '_ {
         self.history_mut(Internal(())).and_then(|h| h.undo())
     }
 
+    #[inline]
+    pub(crate) fn earlier(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>> {
+        self.history_mut(Internal(())).map(|h| h.earlier(count)).unwrap_or_default()
+    }
+
+    #[inline]
+    pub(crate) fn later(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>> {
+        self.history_mut(Internal(())).map(|h| h.later(count)).unwrap_or_default()
+    }
+
+    #[inline]
+    pub(crate) fn undo_tree(&mut self) -> Option<String> {
+        self.history_mut(Internal(())).map(|h| h.undo_tree())
+    }
+
     #[inline]
     pub(crate) fn clear_undo(&mut self) {
         if let Some(h) = self.history_mut(Internal(())) {
@@ -399,6 +488,13 @@ impl dyn BufferInternal + '_ {
             h.snapshot_cursor(cursor)
         }
     }
+
+    #[inline]
+    pub(crate) fn snapshot_cursors(&mut self, cursors: Box<[Point]>) {
+        if let Some(h) = self.history_mut(Internal(())) {
+            h.snapshot_cursors(cursors)
+        }
+    }
 }
 
 // NOTE: remember to add all the methods to the Box<dyn Buffer> impl below, including default methods
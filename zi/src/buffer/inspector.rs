@@ -88,9 +88,13 @@ impl BufferInternal for InspectorBuffer {
                     .find(|hl| hl.range.contains(&cursor))
                 {
                     Some(hl) => {
-                        let capture_name = target_buffer
+                        let syntax = target_buffer
                             .syntax()
-                            .expect("if buffer has syntax highlights it must have syntax")
+                            .expect("if buffer has syntax highlights it must have syntax");
+                        let capture_name = std::iter::once(syntax)
+                            .chain(syntax.injections())
+                            .find(|syntax| syntax.file_type() == hl.file_type)
+                            .expect("highlight must come from the syntax or one of its injections")
                             .capture_index_to_name(hl.capture_idx);
                         match hl.id.style(&editor.theme().read()) {
                             Some(style) => format!("{capture_name} -> {style}"),
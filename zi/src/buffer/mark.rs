@@ -46,6 +46,11 @@ impl Buffer {
     ) -> impl Iterator<Item = (NamespaceId, Range<usize>, &Mark)> + '_ {
         self.marks.iter(range)
     }
+
+    /// The current range of the mark, `None` if it has been deleted.
+    pub(crate) fn get_mark(&self, ns: NamespaceId, id: MarkId) -> Option<Range<usize>> {
+        self.marks.get(ns, id)
+    }
 }
 
 #[derive(Debug, Default)]
@@ -91,6 +96,10 @@ impl PerNs {
         id
     }
 
+    fn get(&self, id: MarkId) -> Option<Range<usize>> {
+        self.marks.contains_key(id).then(|| self.tree.get(id)).flatten()
+    }
+
     fn delete(&mut self, id: MarkId) -> Option<(Range<usize>, Mark)> {
         let mark = self.marks.remove(id)?;
         let range = self.tree.delete(id).expect("if map contains mark, tree should too");
@@ -160,6 +169,10 @@ impl Marks {
         self.namespaces.get_mut(&ns).and_then(|ns| ns.delete(id))
     }
 
+    pub fn get(&self, ns: NamespaceId, id: MarkId) -> Option<Range<usize>> {
+        self.namespaces.get(&ns).and_then(|ns| ns.get(id))
+    }
+
     pub fn drain(&mut self, ns: NamespaceId, range: impl RangeBounds<usize>) {
         if let Some(per_ns) = self.namespaces.get_mut(&ns) {
             per_ns.drain(range)
@@ -111,7 +111,7 @@ where
         let fut = match editor.open(path, OpenFlags::READONLY | OpenFlags::BACKGROUND) {
             Ok(fut) => fut,
             Err(err) if err.kind() == std::io::ErrorKind::InvalidData => {
-                // Probably due to non-utf8 data, show an empty buffer
+                // Probably binary data, show an empty buffer
                 editor.set_buffer(self.preview, editor.empty_buffer());
                 return;
             }
@@ -0,0 +1,210 @@
+use std::io::{self, Read as _};
+use std::thread;
+
+use anyhow::bail;
+use zi_input::KeyEvent;
+
+use super::*;
+use crate::editor::Active;
+use crate::terminal::{Pty, Terminal, encode_key};
+use crate::{Mode, filetype};
+
+/// A process running in a pseudo terminal, the text is the scrollback followed by the screen.
+/// The process is killed when the buffer is closed.
+pub struct TerminalBuffer {
+    id: BufferId,
+    url: Url,
+    text: String,
+    version: u32,
+    cursor: Point,
+    terminal: Terminal,
+    pty: Pty,
+    exited: bool,
+    config: Settings,
+}
+
+impl TerminalBuffer {
+    /// Run the command, or the user's shell, in a terminal of the given size.
+    pub(crate) fn new(
+        id: BufferId,
+        client: Client,
+        command: Option<&str>,
+        size: Size,
+    ) -> io::Result<Self> {
+        let (rows, cols) = (size.height.max(1), size.width.max(1));
+        let pty = Pty::spawn(command, rows, cols)?;
+        let reader = pty.reader()?;
+        thread::Builder::new()
+            .name("terminal".into())
+            .spawn(move || read_output(reader, client, id))?;
+
+        Ok(Self {
+            id,
+            url: Url::parse("buffer://terminal").unwrap(),
+            text: "\n".into(),
+            version: 0,
+            cursor: Point::default(),
+            terminal: Terminal::new(rows as usize, cols as usize),
+            pty,
+            exited: false,
+            config: Default::default(),
+        })
+    }
+
+    /// Where the process has put the cursor.
+    pub(crate) fn cursor(&self) -> Point {
+        self.cursor
+    }
+
+    pub(crate) fn send_key(&mut self, key: &KeyEvent) -> crate::Result<()> {
+        if self.exited {
+            bail!("terminal process has exited")
+        }
+
+        if let Some(input) = encode_key(key) {
+            self.pty.write(&input)?;
+        }
+        Ok(())
+    }
+
+    fn output(&mut self, output: &[u8]) -> io::Result<()> {
+        self.terminal.advance(output);
+        let replies = self.terminal.take_replies();
+        if !replies.is_empty() && !self.exited {
+            self.pty.write(&replies)?;
+        }
+
+        (self.text, self.cursor) = self.terminal.render();
+        self.version += 1;
+        Ok(())
+    }
+
+    fn exit(&mut self) -> io::Result<()> {
+        let status = match self.pty.try_wait()? {
+            Some(status) => {
+                status.code().map_or_else(|| status.to_string(), |code| code.to_string())
+            }
+            None => "unknown".to_string(),
+        };
+        self.exited = true;
+        let newline = if self.cursor.col() > 0 { "\r\n" } else { "" };
+        self.output(format!("{newline}[process exited {status}]").as_bytes())
+    }
+}
+
+/// Forward the output of the process to the buffer until the process exits.
+fn read_output(mut reader: std::fs::File, client: Client, buf: BufferId) {
+    let mut bytes = [0; 4096];
+    loop {
+        match reader.read(&mut bytes) {
+            Ok(0) => break,
+            Ok(n) => {
+                let output = bytes[..n].to_vec();
+                client.send(move |editor| {
+                    terminal_mut(editor, buf).output(&output)?;
+                    follow_cursor(editor, buf);
+                    Ok(())
+                });
+            }
+            Err(err) if err.kind() == io::ErrorKind::Interrupted => continue,
+            // Linux reports `EIO` rather than the end of the file once the process has exited.
+            Err(_) => break,
+        }
+    }
+
+    client.send(move |editor| {
+        terminal_mut(editor, buf).exit()?;
+        follow_cursor(editor, buf);
+        Ok(())
+    });
+}
+
+fn terminal_mut(editor: &mut Editor, buf: BufferId) -> &mut TerminalBuffer {
+    editor.buffer_mut(buf).as_any_mut(Internal(())).downcast_mut::<TerminalBuffer>().unwrap()
+}
+
+/// Keep the cursor where the process put it while typing into the terminal.
+/// Otherwise, the cursor is left alone so the scrollback can be read in normal mode.
+fn follow_cursor(editor: &mut Editor, buf: BufferId) {
+    let cursor = terminal_mut(editor, buf).cursor;
+    let active = Active.select(editor);
+    for view in editor.views_into_buf(buf) {
+        let point = if view == active && editor.mode() == Mode::Insert {
+            cursor
+        } else {
+            // Clamp the cursor in case the text got shorter.
+            editor.view(view).cursor()
+        };
+        editor.set_cursor(view, point);
+    }
+}
+
+impl BufferInternal for TerminalBuffer {
+    fn id(&self) -> BufferId {
+        self.id
+    }
+
+    fn flags(&self) -> BufferFlags {
+        BufferFlags::READONLY
+    }
+
+    fn flushed(&mut self, _: Internal) {
+        panic!("terminal buffer has no backing file")
+    }
+
+    fn url(&self) -> &Url {
+        &self.url
+    }
+
+    fn file_url(&self) -> Option<&Url> {
+        None
+    }
+
+    fn file_type(&self) -> FileType {
+        filetype!(text)
+    }
+
+    fn settings(&self) -> &Settings {
+        &self.config
+    }
+
+    fn text(&self) -> &(dyn AnyText + 'static) {
+        &self.text
+    }
+
+    fn version(&self) -> u32 {
+        self.version
+    }
+
+    fn as_any(&self) -> &dyn Any {
+        self
+    }
+
+    fn as_any_mut(&mut self, _: Internal) -> &mut dyn Any {
+        self
+    }
+
+    fn edit_flags(&mut self, _: Internal, _deltas: &Deltas<'_>, _flags: EditFlags) {
+        panic!("is readonly")
+    }
+
+    fn pre_render(&mut self, _: Internal, _client: &Client, _view: &View, area: tui::Rect) {
+        let (rows, cols) = (area.height.max(1), area.width.max(1));
+        if self.terminal.size() == (rows as usize, cols as usize) {
+            return;
+        }
+
+        self.terminal.resize(rows as usize, cols as usize);
+        (self.text, self.cursor) = self.terminal.render();
+        self.version += 1;
+        if !self.exited {
+            if let Err(err) = self.pty.resize(rows, cols) {
+                tracing::error!(%err, "failed to resize terminal");
+            }
+        }
+    }
+
+    fn on_leave(&mut self, _: Internal) {
+        self.pty.kill();
+    }
+}
@@ -1,10 +1,14 @@
+use std::collections::HashMap;
 use std::mem;
 
+use itertools::Itertools;
+use parking_lot::RwLock;
+use tree_sitter::QueryCapture;
 use zi_text::{AnyTextSlice, Text, TextMut, TextSlice};
 
 use super::*;
 use crate::syntax::{HighlightMap, HighlightName};
-use crate::undo::UndoTree;
+use crate::undo::{UndoStep, UndoTree};
 
 pub struct TextBuffer<X> {
     id: BufferId,
@@ -17,12 +21,15 @@ pub struct TextBuffer<X> {
     language_id: FileType,
     syntax: Option<Box<dyn Syntax>>,
     highlight_map: HighlightMap,
+    /// Highlight maps for injected languages, created lazily as injections are discovered during edits.
+    injection_highlight_maps: RwLock<HashMap<FileType, HighlightMap>>,
     version: u32,
     config: Settings,
     undo_tree: UndoTree<UndoEntry>,
     /// Changes to the buffer that have not been saved to the undo tree
     changes: Vec<Change>,
     saved_cursor: Option<Point>,
+    saved_cursors: Option<Box<[Point]>>,
 }
 
 impl<X: Text + Clone + 'static> BufferHistory for TextBuffer<X> {
@@ -43,6 +50,28 @@ impl<X: Text + Clone + 'static> BufferHistory for TextBuffer<X> {
         self.undo_tree.redo().cloned()
     }
 
+    fn earlier(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>> {
+        if self.text.as_text_mut().is_none() {
+            return vec![];
+        }
+
+        self.snapshot(SnapshotFlags::empty());
+        self.undo_tree.earlier(count).into_iter().map(|step| step.map(Clone::clone)).collect()
+    }
+
+    fn later(&mut self, count: usize) -> Vec<UndoStep<UndoEntry>> {
+        if self.text.as_text_mut().is_none() {
+            return vec![];
+        }
+
+        self.snapshot(SnapshotFlags::empty());
+        self.undo_tree.later(count).into_iter().map(|step| step.map(Clone::clone)).collect()
+    }
+
+    fn undo_tree(&self) -> String {
+        self.undo_tree.to_string()
+    }
+
     fn clear(&mut self) {
         self.changes.clear();
         self.undo_tree.clear();
@@ -57,13 +86,20 @@ impl<X: Text + Clone + 'static> BufferHistory for TextBuffer<X> {
         let changes = mem::take(&mut self.changes);
         tracing::debug!(?flags, ?changes, "snapshot buffer");
 
-        self.undo_tree
-            .push(UndoEntry { changes: changes.into(), cursor: self.saved_cursor.take() });
+        self.undo_tree.push(UndoEntry {
+            changes: changes.into(),
+            cursor: self.saved_cursor.take(),
+            cursors: self.saved_cursors.take(),
+        });
     }
 
     fn snapshot_cursor(&mut self, cursor: Point) {
         self.saved_cursor = Some(cursor);
     }
+
+    fn snapshot_cursors(&mut self, cursors: Box<[Point]>) {
+        self.saved_cursors.get_or_insert(cursors);
+    }
 }
 
 impl<X: Text + Clone + Send + 'static> BufferInternal for TextBuffer<X> {
@@ -79,7 +115,7 @@ impl<X: Text + Clone + Send + 'static> BufferInternal for TextBuffer<X> {
 
     #[inline]
     fn flushed(&mut self, _: Internal) {
-        self.flags.remove(BufferFlags::DIRTY);
+        self.flags.remove(BufferFlags::DIRTY | BufferFlags::MIXED_LINE_ENDINGS);
     }
 
     #[inline]
@@ -134,25 +170,36 @@ impl<X: Text + Clone + Send + 'static> BufferInternal for TextBuffer<X> {
             return Box::new(std::iter::empty());
         };
 
-        Box::new(syntax.highlights(cursor, &self.text, range).flat_map(move |capture| {
-            let range = capture.node.range();
-            let id = self.highlight_map.get(capture.index);
-            // Split multi-line highlights into single-line highlights
-            (range.start_point.row..=range.end_point.row).map(move |idx| {
-                let start = if idx == range.start_point.row { range.start_point.column } else { 0 };
-                let end = if idx == range.end_point.row {
-                    range.end_point.column
-                } else {
-                    self.text.byte_slice(..).dyn_line(idx).unwrap().len_bytes()
-                };
+        let highlights = self.capture_highlights(
+            syntax.file_type(),
+            self.highlight_map.clone(),
+            syntax.highlights(cursor, &self.text, range),
+        );
 
-                SyntaxHighlight {
-                    range: PointRange::new(Point::new(idx, start), Point::new(idx, end)),
-                    capture_idx: capture.index,
-                    id,
-                }
+        // Each injection needs its own query cursor, so we can't lazily interleave them.
+        // Injections are usually small and restricted to the range so collecting them is fine.
+        let mut injected = syntax
+            .injections()
+            .flat_map(|injection| {
+                let highlight_map = self.injection_highlight_map(injection);
+                let mut cursor = QueryCursor::new();
+                cursor.set_point_range(range.start().into()..range.end().into());
+                self.capture_highlights(
+                    injection.file_type(),
+                    highlight_map,
+                    injection.highlights(&mut cursor, &self.text, range),
+                )
+                .collect::<Vec<_>>()
             })
-        }))
+            .collect::<Vec<_>>();
+
+        if injected.is_empty() {
+            return Box::new(highlights);
+        }
+
+        // Injected highlights go after the host highlights that start at the same point so they take precedence.
+        injected.sort_by_key(|hl| hl.range.start());
+        Box::new(highlights.merge_by(injected, |a, b| a.range.start() <= b.range.start()))
     }
 
     fn overlay_highlights(
@@ -199,7 +246,6 @@ impl<X: Text + Clone> TextBuffer<X> {
         ft: FileType,
         path: impl AsRef<Path>,
         mut text: X,
-        theme: &Theme,
         mut syntax: Option<Box<dyn Syntax>>,
     ) -> Self {
         let flags = flags | BufferFlags::ENSURE_TRAILING_NEWLINE;
@@ -231,10 +277,8 @@ impl<X: Text + Clone> TextBuffer<X> {
             syntax.set(&text);
         }
 
-        let highlight_map = HighlightMap::new(
-            syntax.as_ref().map_or(&[][..], |syntax| syntax.capture_names()),
-            theme,
-        );
+        let highlight_map =
+            HighlightMap::new(syntax.as_ref().map_or(&[][..], |syntax| syntax.capture_names()));
 
         Self {
             id,
@@ -245,12 +289,53 @@ impl<X: Text + Clone> TextBuffer<X> {
             syntax,
             language_id: ft,
             highlight_map,
+            injection_highlight_maps: Default::default(),
             config: Default::default(),
             changes: Default::default(),
             version: Default::default(),
             undo_tree: Default::default(),
             saved_cursor: Default::default(),
+            saved_cursors: Default::default(),
+        }
+    }
+
+    fn capture_highlights<'a, 'tree: 'a>(
+        &'a self,
+        file_type: FileType,
+        highlight_map: HighlightMap,
+        captures: impl Iterator<Item = QueryCapture<'tree>> + 'a,
+    ) -> impl Iterator<Item = SyntaxHighlight> + 'a {
+        captures.flat_map(move |capture| {
+            let range = capture.node.range();
+            let id = highlight_map.get(capture.index);
+            // Split multi-line highlights into single-line highlights
+            (range.start_point.row..=range.end_point.row).map(move |idx| {
+                let start = if idx == range.start_point.row { range.start_point.column } else { 0 };
+                let end = if idx == range.end_point.row {
+                    range.end_point.column
+                } else {
+                    self.text.byte_slice(..).dyn_line(idx).unwrap().len_bytes()
+                };
+
+                SyntaxHighlight {
+                    range: PointRange::new(Point::new(idx, start), Point::new(idx, end)),
+                    capture_idx: capture.index,
+                    file_type,
+                    id,
+                }
+            })
+        })
+    }
+
+    fn injection_highlight_map(&self, syntax: &dyn Syntax) -> HighlightMap {
+        let file_type = syntax.file_type();
+        if let Some(highlight_map) = self.injection_highlight_maps.read().get(&file_type) {
+            return highlight_map.clone();
         }
+
+        let highlight_map = HighlightMap::new(syntax.capture_names());
+        self.injection_highlight_maps.write().insert(file_type, highlight_map.clone());
+        highlight_map
     }
 
     fn edit(&mut self, deltas: &Deltas<'_>, flags: EditFlags) {
@@ -0,0 +1,299 @@
+//! Providers for the system clipboard, backing the `+` and `*` registers.
+
+use std::io::{self, Write};
+use std::path::Path;
+use std::process::{Command, Stdio};
+use std::str::FromStr;
+use std::{env, fmt};
+
+use anyhow::{Context as _, bail};
+use base64::Engine as _;
+
+pub trait ClipboardProvider: Send {
+    fn name(&self) -> &'static str;
+
+    /// Read the clipboard, returns `None` if the provider can't read it (e.g. OSC 52 is write-only).
+    fn get(&mut self) -> crate::Result<Option<String>>;
+
+    fn set(&mut self, text: &str) -> crate::Result<()>;
+}
+
+/// Which clipboard provider to use, set with `:set clipboard <backend>`.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum ClipboardBackend {
+    /// OSC 52 over SSH, otherwise the first of `Command` and `System` that is available.
+    #[default]
+    Auto,
+    /// Send OSC 52 escape sequences to the terminal, this works over SSH but can't paste.
+    Osc52,
+    /// Shell out to `pbcopy`, `wl-copy`, `xclip` or `xsel`.
+    Command,
+    /// Talk to the OS clipboard directly.
+    System,
+    /// Only use the editor's registers.
+    None,
+}
+
+impl FromStr for ClipboardBackend {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "auto" => Ok(Self::Auto),
+            "osc52" => Ok(Self::Osc52),
+            "command" => Ok(Self::Command),
+            "system" => Ok(Self::System),
+            "none" | "off" => Ok(Self::None),
+            _ => bail!(
+                "unknown clipboard backend: {s} (expected `auto`, `osc52`, `command`, `system`, or `none`)"
+            ),
+        }
+    }
+}
+
+impl fmt::Display for ClipboardBackend {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Auto => write!(f, "auto"),
+            Self::Osc52 => write!(f, "osc52"),
+            Self::Command => write!(f, "command"),
+            Self::System => write!(f, "system"),
+            Self::None => write!(f, "none"),
+        }
+    }
+}
+
+impl ClipboardBackend {
+    pub(crate) fn provider(self) -> Box<dyn ClipboardProvider> {
+        match self {
+            Self::Auto
+                if env::var_os("SSH_TTY").is_some() || env::var_os("SSH_CONNECTION").is_some() =>
+            {
+                Box::new(Osc52::stdout())
+            }
+            Self::Auto => match ExternalCommand::detect() {
+                Some(cmd) => Box::new(cmd),
+                None => match arboard::Clipboard::new() {
+                    Ok(cb) => Box::new(System(cb)),
+                    Err(err) => {
+                        tracing::info!(%err, "no system clipboard available, using registers only");
+                        Box::new(NoClipboard)
+                    }
+                },
+            },
+            Self::Osc52 => Box::new(Osc52::stdout()),
+            Self::Command => match ExternalCommand::detect() {
+                Some(cmd) => Box::new(cmd),
+                None => Box::new(Unavailable("no clipboard command found")),
+            },
+            Self::System => match arboard::Clipboard::new() {
+                Ok(cb) => Box::new(System(cb)),
+                Err(_) => Box::new(Unavailable("system clipboard is not available")),
+            },
+            Self::None => Box::new(NoClipboard),
+        }
+    }
+}
+
+/// Copies by writing an OSC 52 escape sequence for the terminal to put into the clipboard.
+pub struct Osc52 {
+    writer: Box<dyn Write + Send>,
+    /// Whether to wrap the sequence so tmux passes it through to the outer terminal.
+    tmux: bool,
+}
+
+impl Osc52 {
+    /// Terminals cap the size of the sequences they accept, this is a conservative limit on the base64 payload.
+    pub const MAX_PAYLOAD: usize = 100_000;
+
+    pub fn new(writer: impl Write + Send + 'static) -> Self {
+        Self { writer: Box::new(writer), tmux: false }
+    }
+
+    fn stdout() -> Self {
+        Self { writer: Box::new(io::stdout()), tmux: env::var_os("TMUX").is_some() }
+    }
+
+    /// The escape sequence that sets the clipboard to `text`.
+    /// Errors rather than send a sequence that is too large, as terminals silently drop those.
+    pub fn sequence(text: &str, tmux: bool) -> crate::Result<String> {
+        let payload = base64::engine::general_purpose::STANDARD.encode(text);
+        if payload.len() > Self::MAX_PAYLOAD {
+            bail!(
+                "selection is too large to copy with OSC 52 ({} bytes encoded, the limit is {})",
+                payload.len(),
+                Self::MAX_PAYLOAD
+            );
+        }
+
+        let seq = format!("\x1b]52;c;{payload}\x07");
+        if tmux {
+            // Escapes within a tmux passthrough sequence must be doubled.
+            return Ok(format!("\x1bPtmux;{}\x1b\\", seq.replace('\x1b', "\x1b\x1b")));
+        }
+
+        Ok(seq)
+    }
+}
+
+impl ClipboardProvider for Osc52 {
+    fn name(&self) -> &'static str {
+        "osc52"
+    }
+
+    fn get(&mut self) -> crate::Result<Option<String>> {
+        // Reading the clipboard requires querying the terminal and parsing the response from stdin,
+        // which most terminals disable anyway.
+        Ok(None)
+    }
+
+    fn set(&mut self, text: &str) -> crate::Result<()> {
+        let seq = Self::sequence(text, self.tmux)?;
+        self.writer.write_all(seq.as_bytes())?;
+        self.writer.flush()?;
+        Ok(())
+    }
+}
+
+/// Copies and pastes by running a clipboard tool such as `pbcopy` or `xclip`.
+#[derive(Debug)]
+struct ExternalCommand {
+    copy: &'static [&'static str],
+    paste: &'static [&'static str],
+}
+
+impl ExternalCommand {
+    fn detect() -> Option<Self> {
+        let candidates: [(bool, Self); 4] = [
+            (cfg!(target_os = "macos"), Self { copy: &["pbcopy"], paste: &["pbpaste"] }),
+            (
+                env::var_os("WAYLAND_DISPLAY").is_some(),
+                Self { copy: &["wl-copy"], paste: &["wl-paste", "--no-newline"] },
+            ),
+            (
+                env::var_os("DISPLAY").is_some(),
+                Self {
+                    copy: &["xclip", "-selection", "clipboard"],
+                    paste: &["xclip", "-selection", "clipboard", "-o"],
+                },
+            ),
+            (
+                env::var_os("DISPLAY").is_some(),
+                Self {
+                    copy: &["xsel", "--clipboard", "--input"],
+                    paste: &["xsel", "--clipboard", "--output"],
+                },
+            ),
+        ];
+
+        candidates
+            .into_iter()
+            .find(|(applicable, cmd)| *applicable && in_path(cmd.copy[0]) && in_path(cmd.paste[0]))
+            .map(|(_, cmd)| cmd)
+    }
+}
+
+fn in_path(bin: &str) -> bool {
+    env::var_os("PATH")
+        .is_some_and(|path| env::split_paths(&path).any(|dir| Path::new(&dir).join(bin).is_file()))
+}
+
+impl ClipboardProvider for ExternalCommand {
+    fn name(&self) -> &'static str {
+        self.copy[0]
+    }
+
+    fn get(&mut self) -> crate::Result<Option<String>> {
+        let output = Command::new(self.paste[0])
+            .args(&self.paste[1..])
+            .stdin(Stdio::null())
+            .stderr(Stdio::null())
+            .output()
+            .with_context(|| format!("failed to run `{}`", self.paste[0]))?;
+        if !output.status.success() {
+            bail!("`{}` exited with {}", self.paste[0], output.status);
+        }
+
+        Ok(Some(String::from_utf8(output.stdout)?))
+    }
+
+    fn set(&mut self, text: &str) -> crate::Result<()> {
+        let mut child = Command::new(self.copy[0])
+            .args(&self.copy[1..])
+            .stdin(Stdio::piped())
+            .stdout(Stdio::null())
+            .stderr(Stdio::null())
+            .spawn()
+            .with_context(|| format!("failed to run `{}`", self.copy[0]))?;
+        // Take stdin so it's closed before waiting, otherwise the command waits for more input forever.
+        child.stdin.take().expect("stdin is piped").write_all(text.as_bytes())?;
+        let status = child.wait()?;
+        if !status.success() {
+            bail!("`{}` exited with {status}", self.copy[0]);
+        }
+        Ok(())
+    }
+}
+
+struct System(arboard::Clipboard);
+
+impl ClipboardProvider for System {
+    fn name(&self) -> &'static str {
+        "system"
+    }
+
+    fn get(&mut self) -> crate::Result<Option<String>> {
+        Ok(Some(self.0.get_text()?))
+    }
+
+    fn set(&mut self, text: &str) -> crate::Result<()> {
+        Ok(self.0.set_text(text)?)
+    }
+}
+
+struct NoClipboard;
+
+impl ClipboardProvider for NoClipboard {
+    fn name(&self) -> &'static str {
+        "none"
+    }
+
+    fn get(&mut self) -> crate::Result<Option<String>> {
+        Ok(None)
+    }
+
+    fn set(&mut self, _text: &str) -> crate::Result<()> {
+        Ok(())
+    }
+}
+
+/// An explicitly requested provider that isn't available, this reports why on use.
+struct Unavailable(&'static str);
+
+impl ClipboardProvider for Unavailable {
+    fn name(&self) -> &'static str {
+        "unavailable"
+    }
+
+    fn get(&mut self) -> crate::Result<Option<String>> {
+        bail!("{}", self.0)
+    }
+
+    fn set(&mut self, _text: &str) -> crate::Result<()> {
+        bail!("{}", self.0)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn osc52_sequence() {
+        assert_eq!(Osc52::sequence("hello", false).unwrap(), "\x1b]52;c;aGVsbG8=\x07");
+        assert_eq!(Osc52::sequence("hi", true).unwrap(), "\x1bPtmux;\x1b\x1b]52;c;aGk=\x07\x1b\\");
+
+        let large = "x".repeat(Osc52::MAX_PAYLOAD);
+        assert!(Osc52::sequence(&large, false).is_err());
+    }
+}
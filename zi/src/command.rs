@@ -1,8 +1,12 @@
+use std::borrow::Borrow;
 use std::collections::HashMap;
 use std::fmt;
 use std::future::Future;
 use std::ops::{Bound, Deref, RangeBounds, RangeInclusive};
+use std::path::PathBuf;
 use std::str::FromStr;
+use std::sync::Arc;
+use std::time::Duration;
 
 use chumsky::Parser;
 use chumsky::primitive::end;
@@ -11,8 +15,11 @@ use futures_core::future::BoxFuture;
 use futures_util::{FutureExt, future};
 use smol_str::SmolStr;
 
+use crate::buffer::IndentSettings;
 use crate::editor::{SaveFlags, Selector};
-use crate::{Active, BufferFlags, Client, Editor, Error, OpenFlags, ViewId};
+use crate::{
+    Active, BufferFlags, Client, Direction, Editor, Error, LineNumberStyle, OpenFlags, ViewId,
+};
 
 pub struct Commands(Box<[Command]>);
 
@@ -68,12 +75,95 @@ impl FromStr for Commands {
     }
 }
 
-#[derive(Clone)]
-pub enum CommandRange {}
+/// The lines a command applies to, e.g. `%`, `.,$`, `'a,'b` or `.,+2`.
+#[derive(Clone, PartialEq, Eq)]
+pub enum CommandRange {
+    /// `%`, every line in the buffer
+    Full,
+    /// A single line or an inclusive range of lines
+    Lines(LineAddress, Option<LineAddress>),
+}
 
 impl fmt::Debug for CommandRange {
-    fn fmt(&self, _f: &mut fmt::Formatter<'_>) -> fmt::Result {
-        match *self {}
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            CommandRange::Full => write!(f, "%"),
+            CommandRange::Lines(start, None) => write!(f, "{start:?}"),
+            CommandRange::Lines(start, Some(end)) => write!(f, "{start:?},{end:?}"),
+        }
+    }
+}
+
+#[derive(Clone, Copy, PartialEq, Eq)]
+pub struct LineAddress {
+    pub base: LineBase,
+    /// A relative offset from the base, e.g. the `+2` in `.+2`
+    pub offset: isize,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum LineBase {
+    /// `.`
+    Current,
+    /// `$`
+    Last,
+    /// A 1-indexed line number
+    Absolute(usize),
+    /// `'a`
+    Mark(char),
+}
+
+impl fmt::Debug for LineAddress {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self.base {
+            LineBase::Current => write!(f, ".")?,
+            LineBase::Last => write!(f, "$")?,
+            LineBase::Absolute(line) => write!(f, "{line}")?,
+            LineBase::Mark(mark) => write!(f, "'{mark}")?,
+        }
+
+        match self.offset {
+            0 => Ok(()),
+            offset if offset > 0 => write!(f, "+{offset}"),
+            offset => write!(f, "{offset}"),
+        }
+    }
+}
+
+impl CommandRange {
+    /// Resolve the range to 0-indexed, inclusive line numbers.
+    /// `cursor_line` is the line of the cursor, and `last_line` is the last line in the buffer.
+    pub fn resolve(
+        &self,
+        cursor_line: usize,
+        last_line: usize,
+        mark: impl Fn(char) -> Option<usize>,
+    ) -> Result<RangeInclusive<usize>, Error> {
+        let resolve = |addr: &LineAddress| -> Result<usize, Error> {
+            let base = match addr.base {
+                LineBase::Current => cursor_line,
+                LineBase::Last => last_line,
+                LineBase::Absolute(line) => line.saturating_sub(1),
+                LineBase::Mark(c) => match mark(c) {
+                    Some(line) => line,
+                    None => anyhow::bail!("mark not set: {c}"),
+                },
+            };
+
+            match base.checked_add_signed(addr.offset) {
+                Some(line) if line <= last_line => Ok(line),
+                _ => anyhow::bail!("invalid range"),
+            }
+        };
+
+        let (start, end) = match self {
+            CommandRange::Full => return Ok(0..=last_line),
+            CommandRange::Lines(start, None) => (resolve(start)?, resolve(start)?),
+            CommandRange::Lines(start, Some(end)) => (resolve(start)?, resolve(end)?),
+        };
+
+        // Backwards ranges are swapped rather than rejected.
+        Ok(start.min(end)..=start.max(end))
     }
 }
 
@@ -136,23 +226,103 @@ fn commands() -> impl Parser<char, Commands, Error = chumsky::error::Simple<char
 }
 
 fn command() -> impl Parser<char, Command, Error = chumsky::error::Simple<char>> {
-    command_kind().map(|kind| Command { range: None, kind })
+    range().or_not().then(command_kind()).map(|(range, kind)| Command { range, kind })
+}
+
+// The range parsers are built from `filter`s rather than `just` so they don't add to the expected
+// tokens in error messages of commands without a range.
+fn range() -> impl Parser<char, CommandRange, Error = chumsky::error::Simple<char>> {
+    use chumsky::prelude::*;
+
+    let lines = line_address()
+        .then(filter(|&c| c == ',').ignore_then(line_address()).or_not())
+        .map(|(start, end)| CommandRange::Lines(start, end));
+    filter(|&c| c == '%').to(CommandRange::Full).or(lines)
+}
+
+fn line_address() -> impl Parser<char, LineAddress, Error = chumsky::error::Simple<char>> {
+    use chumsky::prelude::*;
+
+    let number = digits(10).try_map(|digits: String, span| {
+        digits.parse::<usize>().map_err(|err| Simple::custom(span, err.to_string()))
+    });
+
+    let base = choice((
+        filter(|&c| c == '.').to(LineBase::Current),
+        filter(|&c| c == '$').to(LineBase::Last),
+        // `'<` and `'>` are the start and end of the last visual selection.
+        filter(|&c| c == '\'')
+            .ignore_then(filter(|&c: &char| c.is_ascii_alphabetic() || matches!(c, '<' | '>')))
+            .map(LineBase::Mark),
+        number.clone().map(LineBase::Absolute),
+    ));
+
+    let offset = filter(|&c| c == '+' || c == '-').then(number.or_not()).map(|(sign, n)| {
+        let n = n.unwrap_or(1) as isize;
+        if sign == '-' { -n } else { n }
+    });
+
+    // The base defaults to the current line if there is an offset, e.g. `+2` is the same as `.+2`.
+    let sum = |offsets: Vec<isize>| offsets.into_iter().sum::<isize>();
+    base.then(offset.clone().repeated().map(sum))
+        .or(offset.repeated().at_least(1).map(sum).map(|offset| (LineBase::Current, offset)))
+        .map(|(base, offset)| LineAddress { base, offset })
 }
 
 fn command_kind() -> impl Parser<char, CommandKind, Error = chumsky::error::Simple<char>> {
+    shell()
+        .map(CommandKind::Shell)
+        .or(substitute().map(CommandKind::Substitute))
+        .or(generic_command())
+}
+
+/// `!command`, the rest of the line is the shell command.
+fn shell() -> impl Parser<char, String, Error = chumsky::error::Simple<char>> {
+    use chumsky::prelude::*;
+
+    filter(|c: &char| c.is_whitespace() && *c != '\n')
+        .repeated()
+        .ignore_then(filter(|&c| c == '!'))
+        .ignore_then(filter(|&c| c != '\n').repeated().collect::<String>())
+        .try_map(|command, span| match command.trim() {
+            "" => Err(Simple::custom(span, "expected a shell command")),
+            command => Ok(command.to_string()),
+        })
+}
+
+/// `s/pattern/replacement/flags`, the rest of the line is parsed by [`Substitute::parse`].
+fn substitute() -> impl Parser<char, Substitute, Error = chumsky::error::Simple<char>> {
     use chumsky::prelude::*;
 
-    ident()
-        .or(digits(10))
-        .separated_by(filter(|&c: &char| c.is_whitespace() && c != '\n').ignored().repeated())
+    filter(|c: &char| c.is_whitespace() && *c != '\n')
+        .repeated()
+        .ignore_then(filter(|&c| c == 's'))
+        .ignore_then(filter(|&c| Substitute::is_delimiter(c)))
+        .then(filter(|&c| c != '\n').repeated().collect::<String>())
+        .try_map(|(delimiter, rest), span| {
+            Substitute::parse(delimiter, &rest).map_err(|err| Simple::custom(span, err))
+        })
+}
+
+fn generic_command() -> impl Parser<char, CommandKind, Error = chumsky::error::Simple<char>> {
+    use chumsky::prelude::*;
+
+    let space = filter(|&c: &char| c.is_whitespace() && c != '\n').ignored().repeated();
+    // Arguments can be anything without whitespace (e.g. paths), except for the `;` separating commands.
+    let arg = filter(|&c: &char| !c.is_whitespace() && !matches!(c, ';' | '!'))
+        .repeated()
         .at_least(1)
-        .allow_leading()
-        .allow_trailing()
+        .collect::<String>();
+
+    space
+        .clone()
+        .ignore_then(ident().or(digits(10)))
+        .then(space.clone().at_least(1).ignore_then(arg).repeated())
+        .then_ignore(space)
         .then(just('!').or_not())
-        .map(|(words, bang)| {
-            let mut words = words.into_iter().map(|s| Word::try_from(s).unwrap());
-            let cmd = words.next().expect("expect at least 1 word");
-            let args = words.collect::<Box<_>>();
+        .map(|((cmd, args), bang)| {
+            let cmd = Word::try_from(cmd).unwrap();
+            let args = args.into_iter().map(|s| Word::try_from(s).unwrap()).collect::<Box<_>>();
             CommandKind::Generic { cmd, args, force: bang.is_some() }
         })
 }
@@ -177,6 +347,13 @@ impl Deref for Word {
     }
 }
 
+impl Borrow<str> for Word {
+    #[inline]
+    fn borrow(&self) -> &str {
+        &self.0
+    }
+}
+
 impl From<&Word> for String {
     fn from(value: &Word) -> Self {
         value.0.clone().into()
@@ -217,6 +394,161 @@ impl TryFrom<&str> for Word {
 
 pub enum CommandKind {
     Generic { cmd: Word, args: Box<[Word]>, force: bool },
+    Substitute(Substitute),
+    /// `!command`, the lines of the range are filtered through the shell command.
+    Shell(String),
+}
+
+bitflags::bitflags! {
+    #[derive(Debug, Clone, Copy, PartialEq, Eq)]
+    pub struct SubstituteFlags: u8 {
+        /// `g`, replace every match in the line rather than just the first
+        const GLOBAL = 1 << 0;
+        /// `c`, confirm each replacement
+        const CONFIRM = 1 << 1;
+        /// `i`, ignore case
+        const IGNORE_CASE = 1 << 2;
+        /// `I`, don't ignore case
+        const MATCH_CASE = 1 << 3;
+    }
+}
+
+#[derive(Clone, PartialEq, Eq)]
+pub struct Substitute {
+    pub pattern: String,
+    /// The replacement in vim syntax, `&` and `\0` refer to the whole match and `\1` to `\9` to the capture groups
+    pub replacement: String,
+    pub flags: SubstituteFlags,
+}
+
+impl Substitute {
+    fn is_delimiter(c: char) -> bool {
+        !c.is_alphanumeric() && !c.is_whitespace() && !matches!(c, '\\' | '"' | '|')
+    }
+
+    /// Parse `pattern/replacement/flags` where `/` is the delimiter.
+    /// The delimiter can be escaped with a backslash, the trailing delimiter and the flags are optional.
+    fn parse(delimiter: char, s: &str) -> Result<Self, String> {
+        let mut parts = vec![String::new()];
+        let mut chars = s.chars();
+        while let Some(c) = chars.next() {
+            let part = parts.last_mut().unwrap();
+            match c {
+                '\\' => match chars.next() {
+                    Some(c) if c == delimiter => part.push(c),
+                    Some(c) => {
+                        part.push('\\');
+                        part.push(c);
+                    }
+                    None => part.push('\\'),
+                },
+                c if c == delimiter && parts.len() < 3 => parts.push(String::new()),
+                c => part.push(c),
+            }
+        }
+
+        let mut parts = parts.into_iter();
+        let pattern = parts.next().unwrap_or_default();
+        let replacement = parts.next().unwrap_or_default();
+        let flags = parts.next().unwrap_or_default();
+
+        if pattern.is_empty() {
+            return Err("empty substitute pattern".into());
+        }
+
+        let flags = flags.trim_end().chars().try_fold(SubstituteFlags::empty(), |flags, c| {
+            Ok(flags
+                | match c {
+                    'g' => SubstituteFlags::GLOBAL,
+                    'c' => SubstituteFlags::CONFIRM,
+                    'i' => SubstituteFlags::IGNORE_CASE,
+                    'I' => SubstituteFlags::MATCH_CASE,
+                    _ => return Err(format!("invalid substitute flag: {c}")),
+                })
+        })?;
+
+        Ok(Self { pattern, replacement, flags })
+    }
+}
+
+impl fmt::Debug for Substitute {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "s/{}/{}/", self.pattern, self.replacement)?;
+        for (flag, c) in [
+            (SubstituteFlags::GLOBAL, 'g'),
+            (SubstituteFlags::CONFIRM, 'c'),
+            (SubstituteFlags::IGNORE_CASE, 'i'),
+            (SubstituteFlags::MATCH_CASE, 'I'),
+        ] {
+            if self.flags.contains(flag) {
+                write!(f, "{c}")?;
+            }
+        }
+        Ok(())
+    }
+}
+
+bitflags::bitflags! {
+    #[derive(Debug, Clone, Copy, PartialEq, Eq)]
+    pub struct SortFlags: u8 {
+        /// `n`, sort by the first number in the line, lines without one go first
+        const NUMERIC = 1 << 0;
+        /// `r`, sort in reverse
+        const REVERSE = 1 << 1;
+        /// `i`, ignore case
+        const IGNORE_CASE = 1 << 2;
+        /// `u`, only keep the first of each run of identical lines
+        const UNIQUE = 1 << 3;
+    }
+}
+
+/// The arguments of `:sort`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Sort {
+    pub flags: SortFlags,
+    /// Sort by the match of the pattern (or its first capture group) rather than the whole line.
+    /// Lines that don't match sort as if they were empty.
+    pub pattern: Option<String>,
+}
+
+impl Sort {
+    /// Parse flags and an optional `/pattern/` in any order, e.g. `n /\d+$/`.
+    /// As in `:s`, the pattern can be delimited by any punctuation and the trailing delimiter is optional.
+    fn parse(s: &str) -> Result<Self, Error> {
+        let mut flags = SortFlags::empty();
+        let mut pattern = None;
+        let mut chars = s.chars();
+        while let Some(c) = chars.next() {
+            flags |= match c {
+                'n' => SortFlags::NUMERIC,
+                'r' => SortFlags::REVERSE,
+                'i' => SortFlags::IGNORE_CASE,
+                'u' => SortFlags::UNIQUE,
+                c if c.is_whitespace() => continue,
+                c if Substitute::is_delimiter(c) && pattern.is_none() => {
+                    let mut pat = String::new();
+                    while let Some(next) = chars.next() {
+                        match next {
+                            '\\' if chars.clone().next() == Some(c) => {
+                                pat.push(chars.next().unwrap())
+                            }
+                            next if next == c => break,
+                            next => pat.push(next),
+                        }
+                    }
+
+                    if pat.is_empty() {
+                        anyhow::bail!("empty sort pattern");
+                    }
+                    pattern = Some(pat);
+                    continue;
+                }
+                _ => anyhow::bail!("invalid sort flag: {c}"),
+            };
+        }
+
+        Ok(Self { flags, pattern })
+    }
 }
 
 impl fmt::Debug for CommandKind {
@@ -231,16 +563,37 @@ impl fmt::Debug for CommandKind {
                     write!(f, " {arg}")?;
                 }
             }
+            CommandKind::Substitute(sub) => write!(f, "{sub:?}")?,
+            CommandKind::Shell(command) => write!(f, "!{command}")?,
         }
         Ok(())
     }
 }
 
+#[derive(Clone)]
 pub struct Handler {
     name: Word,
+    /// Other names for the command, usually abbreviations such as `w` for `write`.
+    aliases: Vec<Word>,
     arity: Arity,
     opts: CommandFlags,
-    executor: Box<dyn Executor>,
+    completion: ArgCompletion,
+    executor: Arc<dyn Executor>,
+}
+
+/// What the arguments of a command complete to in the command line.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum ArgCompletion {
+    #[default]
+    None,
+    Path,
+    /// The paths of the open buffers.
+    Buffer,
+    /// The name of a setting followed by its value, as taken by `:set`.
+    Setting,
+    /// `default` and the themes in the themes directory.
+    Theme,
+    Words(&'static [&'static str]),
 }
 
 pub trait Executor: Send + Sync {
@@ -305,7 +658,25 @@ impl Handler {
         opts: CommandFlags,
         executor: impl Executor + 'static,
     ) -> Self {
-        Self { name: name.into(), arity, opts, executor: Box::new(executor) }
+        Self {
+            name: name.into(),
+            aliases: vec![],
+            arity,
+            opts,
+            completion: ArgCompletion::None,
+            executor: Arc::new(executor),
+        }
+    }
+
+    pub fn with_aliases(mut self, aliases: impl IntoIterator<Item = &'static str>) -> Self {
+        self.aliases
+            .extend(aliases.into_iter().map(|alias| Word::try_from(alias).expect("invalid alias")));
+        self
+    }
+
+    pub fn with_completion(mut self, completion: ArgCompletion) -> Self {
+        self.completion = completion;
+        self
     }
 
     pub fn execute(
@@ -345,6 +716,18 @@ impl Handler {
     pub fn name(&self) -> Word {
         Word::clone(&self.name)
     }
+
+    pub fn aliases(&self) -> &[Word] {
+        &self.aliases
+    }
+
+    pub fn arity(&self) -> &Arity {
+        &self.arity
+    }
+
+    pub fn completion(&self) -> ArgCompletion {
+        self.completion
+    }
 }
 
 impl Arity {
@@ -356,9 +739,9 @@ impl Arity {
 }
 
 pub(crate) fn builtin_handlers() -> HashMap<Word, Handler> {
-    [
+    let handlers = [
         Handler::new(
-            Word::try_from("q").unwrap(),
+            Word::try_from("quit").unwrap(),
             Arity::ZERO,
             CommandFlags::empty(),
             executor_fn(|client, range, args, _force| async move {
@@ -367,9 +750,10 @@ pub(crate) fn builtin_handlers() -> HashMap<Word, Handler> {
                 close_view(&client, Active).await;
                 Ok(())
             }),
-        ),
+        )
+        .with_aliases(["q"]),
         Handler::new(
-            Word::try_from("w").unwrap(),
+            Word::try_from("write").unwrap(),
             Arity::ZERO,
             CommandFlags::empty(),
             executor_fn(|client, range, args, force| async move {
@@ -377,9 +761,27 @@ pub(crate) fn builtin_handlers() -> HashMap<Word, Handler> {
                 assert!(args.is_empty());
                 save(&client, Active, force).await
             }),
+        )
+        .with_aliases(["w"]),
+        Handler::new(
+            Word::try_from("SudoWrite").unwrap(),
+            Arity::ZERO,
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                assert!(args.is_empty());
+                // Typing the password can take longer than a command is given, so the write outlives the command.
+                let save = client.with(|editor| editor.save(Active, SaveFlags::SUDO)).await;
+                tokio::spawn(async move {
+                    if let Err(err) = save.await {
+                        client.send(move |_| Err(err));
+                    }
+                });
+                Ok(())
+            }),
         ),
         Handler::new(
-            Word::try_from("wa").unwrap(),
+            Word::try_from("wall").unwrap(),
             Arity::ZERO,
             CommandFlags::empty(),
             executor_fn(|client, range, args, force| async move {
@@ -387,7 +789,8 @@ pub(crate) fn builtin_handlers() -> HashMap<Word, Handler> {
                 assert!(args.is_empty());
                 save_all(&client, force).await
             }),
-        ),
+        )
+        .with_aliases(["wa"]),
         Handler::new(
             Word::try_from("wq").unwrap(),
             Arity::ZERO,
@@ -401,7 +804,7 @@ pub(crate) fn builtin_handlers() -> HashMap<Word, Handler> {
             }),
         ),
         Handler::new(
-            Word::try_from("x").unwrap(),
+            Word::try_from("xit").unwrap(),
             Arity::ZERO,
             CommandFlags::empty(),
             executor_fn(|client, range, args, force| async move {
@@ -411,17 +814,44 @@ pub(crate) fn builtin_handlers() -> HashMap<Word, Handler> {
                 close_view(&client, Active).await;
                 Ok(())
             }),
-        ),
+        )
+        .with_aliases(["x"]),
         Handler::new(
-            Word::try_from("e").unwrap(),
+            Word::try_from("format").unwrap(),
             Arity::ZERO,
             CommandFlags::empty(),
             executor_fn(|client, range, args, _force| async move {
                 assert!(range.is_none());
                 assert!(args.is_empty());
-                reload(&client).await
+                client.with(|editor| editor.format(Active)).await.await
             }),
-        ),
+        )
+        .with_aliases(["fmt"]),
+        Handler::new(
+            Word::try_from("edit").unwrap(),
+            Arity::from(0..=1),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                match args.first() {
+                    Some(path) => edit(&client, PathBuf::from(path.as_str())).await,
+                    None => reload(&client).await,
+                }
+            }),
+        )
+        .with_aliases(["e"])
+        .with_completion(ArgCompletion::Path),
+        Handler::new(
+            Word::try_from("buffer").unwrap(),
+            Arity::exact(1),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                client.with(move |editor| editor.switch_to_buffer(Active, &args[0])).await
+            }),
+        )
+        .with_aliases(["b"])
+        .with_completion(ArgCompletion::Buffer),
         Handler::new(
             Word::try_from("jumps").unwrap(),
             Arity::ZERO,
@@ -456,21 +886,338 @@ pub(crate) fn builtin_handlers() -> HashMap<Word, Handler> {
                 Ok(())
             }),
         ),
+        Handler::new(
+            Word::try_from("undotree").unwrap(),
+            Arity::ZERO,
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                assert!(args.is_empty());
+                client.with(|editor| editor.open_undo_tree(Active)).await;
+                Ok(())
+            }),
+        ),
+        split_handler("split", Direction::Down).with_aliases(["sp"]),
+        split_handler("vsplit", Direction::Right).with_aliases(["vs"]),
+        quickfix_handler("cnext", QuickfixDirection::Next).with_aliases(["cn"]),
+        quickfix_handler("cprev", QuickfixDirection::Prev).with_aliases(["cp"]),
+        Handler::new(
+            Word::try_from("cc").unwrap(),
+            Arity::from(0..=1),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                // The entries are numbered from 1 as in vim, without a number the current entry is jumped to again.
+                let nr = args.first().map(|nr| nr.parse::<usize>()).transpose()?;
+                client
+                    .with(move |editor| {
+                        let idx = match nr {
+                            Some(0) => anyhow::bail!("quickfix entries are numbered from 1"),
+                            Some(nr) => nr - 1,
+                            None => editor.quickfix_index().unwrap_or(0),
+                        };
+                        editor.quickfix_goto(idx)
+                    })
+                    .await?
+                    .await
+            }),
+        ),
+        Handler::new(
+            Word::try_from("copen").unwrap(),
+            Arity::ZERO,
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                assert!(args.is_empty());
+                client.with(|editor| editor.open_quickfix()).await;
+                Ok(())
+            }),
+        )
+        .with_aliases(["cope"]),
+        Handler::new(
+            Word::try_from("diagnostics").unwrap(),
+            Arity::ZERO,
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                assert!(args.is_empty());
+                client.with(|editor| editor.open_diagnostics()).await;
+                Ok(())
+            }),
+        ),
+        Handler::new(
+            Word::try_from("cdiagnostics").unwrap(),
+            Arity::ZERO,
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                assert!(args.is_empty());
+                client
+                    .with(|editor| {
+                        editor.set_quickfix_diagnostics();
+                        if editor.quickfix_entries().is_empty() {
+                            anyhow::bail!("no diagnostics");
+                        }
+                        Ok(())
+                    })
+                    .await
+            }),
+        )
+        .with_aliases(["cdiag"]),
+        Handler::new(
+            Word::try_from("grep").unwrap(),
+            Arity::from(1..=u8::MAX),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, force| async move {
+                assert!(range.is_none());
+                // `:grep!` doesn't jump to the first match, as in vim.
+                let args = args.iter().map(|arg| arg.to_string()).collect::<Vec<_>>();
+                client.with(move |editor| editor.grep(args, !force)).await?.await
+            }),
+        )
+        .with_aliases(["gr"]),
+        Handler::new(
+            Word::try_from("reverthunk").unwrap(),
+            Arity::ZERO,
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                assert!(args.is_empty());
+                client.with(|editor| editor.revert_hunk(Active)).await
+            }),
+        ),
+        Handler::new(
+            Word::try_from("config").unwrap(),
+            Arity::exact(1),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                match args[0].as_str() {
+                    "reload" => client.with(|editor| editor.reload_config()).await,
+                    arg => anyhow::bail!("unknown argument: `{arg}` (expected `reload`)"),
+                }
+            }),
+        )
+        .with_completion(ArgCompletion::Words(&["reload"])),
+        Handler::new(
+            Word::try_from("theme").unwrap(),
+            Arity::from(0..=1),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                // Without a name the current theme is reloaded, so edits to it can be seen immediately.
+                if args.is_empty() {
+                    client.with(|editor| editor.reload_theme()).await
+                } else {
+                    client.with(move |editor| editor.set_theme(args[0].as_str())).await
+                }
+            }),
+        )
+        .with_completion(ArgCompletion::Theme),
+        Handler::new(
+            Word::try_from("sort").unwrap(),
+            Arity::from(0..=u8::MAX),
+            CommandFlags::RANGE,
+            executor_fn(|client, range, args, force| async move {
+                let args = args.iter().map(|arg| arg.as_str()).collect::<Vec<_>>().join(" ");
+                let mut sort = Sort::parse(&args)?;
+                // `:sort!` is how vim reverses.
+                if force {
+                    sort.flags |= SortFlags::REVERSE;
+                }
+                client
+                    .with(move |editor| {
+                        // Without a range, like vim, the whole buffer is sorted.
+                        let lines =
+                            editor.command_lines(range.as_ref().unwrap_or(&CommandRange::Full))?;
+                        editor.sort_lines(Active, lines, &sort)
+                    })
+                    .await
+            }),
+        )
+        .with_aliases(["sor"]),
+        Handler::new(
+            Word::try_from("mksession").unwrap(),
+            Arity::from(0..=1),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, force| async move {
+                assert!(range.is_none());
+                let path = PathBuf::from(args.first().map_or(SESSION_PATH, |path| path.as_str()));
+                if path.exists() && !force {
+                    anyhow::bail!("`{}` already exists (add ! to overwrite)", path.display());
+                }
+                client.with(move |editor| editor.save_session(path)).await
+            }),
+        )
+        .with_aliases(["mks"])
+        .with_completion(ArgCompletion::Path),
+        Handler::new(
+            Word::try_from("source").unwrap(),
+            Arity::from(0..=1),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                let path = PathBuf::from(args.first().map_or(SESSION_PATH, |path| path.as_str()));
+                client.with(move |editor| editor.load_session(path)).await?.await
+            }),
+        )
+        .with_aliases(["so"])
+        .with_completion(ArgCompletion::Path),
+        Handler::new(
+            Word::try_from("iabbrev").unwrap(),
+            // The expansion is the rest of the line, like `:set` values.
+            Arity::from(2..=u8::MAX),
+            CommandFlags::empty(),
+            executor_fn(|client, range, args, _force| async move {
+                assert!(range.is_none());
+                let expansion =
+                    args[1..].iter().map(|arg| arg.as_str()).collect::<Vec<_>>().join(" ");
+                client
+                    .with(move |editor| editor.add_abbreviation(None, args[0].as_str(), &expansion))
+                    .await
+            }),
+        )
+        .with_aliases(["iab"]),
         Handler::new(
             Word::try_from("set").unwrap(),
-            Arity::exact(2),
+            // The value is the rest of the line, so values containing whitespace don't need quoting.
+            Arity::from(1..=u8::MAX),
             CommandFlags::empty(),
             executor_fn(|client, range, args, _force| async move {
                 assert!(range.is_none());
-                assert!(args.len() == 2);
+                assert!(!args.is_empty());
 
-                client.with(move |editor| set_option(editor, &args[0], &args[1])).await
+                // A boolean setting on its own turns it on, e.g. `:set list`.
+                if args.len() == 1 && setting_values(args[0].as_str()) != ["true", "false"] {
+                    anyhow::bail!("expected a value for `{}`", args[0])
+                }
+                let value = match &args[1..] {
+                    [] => "true".to_string(),
+                    args => args.iter().map(|arg| arg.as_str()).collect::<Vec<_>>().join(" "),
+                };
+                client.with(move |editor| set_option(editor, &args[0], &value)).await
             }),
-        ),
-    ]
-    .into_iter()
-    .map(|handler| (handler.name.clone(), handler))
-    .collect()
+        )
+        .with_completion(ArgCompletion::Setting),
+    ];
+
+    #[cfg(unix)]
+    let handlers = handlers.into_iter().chain([terminal_handler()]);
+
+    handlers
+        .into_iter()
+        .flat_map(|handler| {
+            let names = iter::once(handler.name()).chain(handler.aliases().iter().cloned());
+            names.collect::<Vec<_>>().into_iter().map(move |name| (name, handler.clone()))
+        })
+        .collect()
+}
+
+/// Where `:mksession` and `:source` save and load the session if no path is given, like vim's `Session.vim`.
+const SESSION_PATH: &str = "Session.toml";
+
+/// Terminals run their process in a pty, which is only supported on unix.
+#[cfg(unix)]
+fn terminal_handler() -> Handler {
+    Handler::new(
+        Word::try_from("terminal").unwrap(),
+        Arity::from(0..=u8::MAX),
+        CommandFlags::empty(),
+        executor_fn(|client, range, args, _force| async move {
+            assert!(range.is_none());
+            // The rest of the line is the command for the shell to run.
+            let command = args.iter().map(|arg| arg.as_str()).collect::<Vec<_>>().join(" ");
+            client
+                .with(move |editor| {
+                    editor.open_terminal((!command.is_empty()).then_some(command.as_str()))?;
+                    Ok(())
+                })
+                .await
+        }),
+    )
+    .with_aliases(["ter", "term"])
+}
+
+fn split_handler(name: &str, direction: Direction) -> Handler {
+    Handler::new(
+        Word::try_from(name).unwrap(),
+        Arity::ZERO,
+        CommandFlags::empty(),
+        executor_fn(move |client, range, args, _force| async move {
+            assert!(range.is_none());
+            assert!(args.is_empty());
+            client
+                .with(move |editor| {
+                    editor.split(Active, direction, tui::Constraint::Fill(1));
+                })
+                .await;
+            Ok(())
+        }),
+    )
+}
+
+#[derive(Clone, Copy)]
+enum QuickfixDirection {
+    Next,
+    Prev,
+}
+
+fn quickfix_handler(name: &str, direction: QuickfixDirection) -> Handler {
+    Handler::new(
+        Word::try_from(name).unwrap(),
+        Arity::ZERO,
+        CommandFlags::empty(),
+        executor_fn(move |client, range, args, _force| async move {
+            assert!(range.is_none());
+            assert!(args.is_empty());
+            client
+                .with(move |editor| match direction {
+                    QuickfixDirection::Next => editor.quickfix_next().map(FutureExt::boxed),
+                    QuickfixDirection::Prev => editor.quickfix_prev().map(FutureExt::boxed),
+                })
+                .await?
+                .await
+        }),
+    )
+}
+
+/// The settings `:set` takes and their abbreviations, this must be kept in sync with `set_option`.
+pub(crate) const SETTINGS: &[(&str, &[&str])] = &[
+    ("tabstop", &["ts", "tabwidth"]),
+    ("shiftwidth", &["sw"]),
+    ("expandtab", &["et"]),
+    ("numberwidth", &["nuw"]),
+    ("numberstyle", &["nus"]),
+    ("number", &["nu"]),
+    ("relativenumber", &["rnu"]),
+    ("clipboard", &["cb"]),
+    ("timeoutlen", &["tm"]),
+    ("formatonsave", &["fos"]),
+    ("statusline", &["stl"]),
+    ("encoding", &["enc"]),
+    ("fileformat", &["ff"]),
+    ("grepprg", &["gp"]),
+    ("restorecursor", &["rc"]),
+    ("list", &[]),
+    ("listchars", &["lcs"]),
+    ("scrolloff", &["so"]),
+    ("wrap", &[]),
+];
+
+/// The values a setting completes to, if there are a fixed set of them.
+pub(crate) fn setting_values(name: &str) -> &'static [&'static str] {
+    match name {
+        "numberstyle" | "nus" => &["absolute", "relative", "hybrid", "none"],
+        "number" | "nu" | "relativenumber" | "rnu" => &["true", "false"],
+        "clipboard" | "cb" => &["auto", "osc52", "command", "system", "none"],
+        "formatonsave" | "fos" => &["true", "false"],
+        "expandtab" | "et" => &["true", "false"],
+        "encoding" | "enc" => &["utf-8", "utf-8-bom", "utf-16le", "utf-16be", "latin1"],
+        "fileformat" | "ff" => &["unix", "dos", "mac"],
+        "restorecursor" | "rc" => &["true", "false"],
+        "list" | "wrap" => &["true", "false"],
+        _ => &[],
+    }
 }
 
 pub fn set_option(editor: &Editor, key: &str, value: &str) -> crate::Result<()> {
@@ -479,8 +1226,44 @@ pub fn set_option(editor: &Editor, key: &str, value: &str) -> crate::Result<()>
 
     match key {
         "tabstop" | "ts" | "tabwidth" => buf.tab_width.write(value.parse()?),
+        "shiftwidth" | "sw" => match *buf.indent.read() {
+            IndentSettings::Spaces(_) => buf.indent.write(IndentSettings::Spaces(value.parse()?)),
+            IndentSettings::Tabs => anyhow::bail!("indenting with tabs, set `tabstop` instead"),
+        },
+        // Spaces keep the width of a tab so the indentation looks the same either way.
+        "expandtab" | "et" => match (value.parse::<bool>()?, *buf.indent.read()) {
+            (true, IndentSettings::Tabs) => {
+                buf.indent.write(IndentSettings::Spaces(*buf.tab_width.read()))
+            }
+            (false, _) => buf.indent.write(IndentSettings::Tabs),
+            (true, IndentSettings::Spaces(_)) => {}
+        },
         "numberwidth" | "nuw" => view.line_number_width.write(value.parse()?),
         "numberstyle" | "nus" => view.line_number_style.write(value.parse()?),
+        // These toggle half of the style each, both together is the hybrid style as in vim.
+        "number" | "nu" => {
+            let (_, relative) = view.line_number_style.read().flags();
+            view.line_number_style.write(LineNumberStyle::from_flags(value.parse()?, relative))
+        }
+        "relativenumber" | "rnu" => {
+            let (number, _) = view.line_number_style.read().flags();
+            view.line_number_style.write(LineNumberStyle::from_flags(number, value.parse()?))
+        }
+        "clipboard" | "cb" => editor.settings().clipboard.write(value.parse()?),
+        "timeoutlen" | "tm" => {
+            editor.settings().key_timeout.write(Duration::from_millis(value.parse()?))
+        }
+        "formatonsave" | "fos" => buf.format_on_save.write(value.parse()?),
+        "statusline" | "stl" => editor.settings().statusline.write(value.parse()?),
+        // This only changes how the buffer is written, the text was already decoded when it was read.
+        "encoding" | "enc" => buf.encoding.write(value.parse()?),
+        "fileformat" | "ff" => buf.file_format.write(value.parse()?),
+        "grepprg" | "gp" => editor.settings().grep_program.write(value.to_string()),
+        "restorecursor" | "rc" => editor.settings().restore_cursor.write(value.parse()?),
+        "list" => view.list.write(value.parse()?),
+        "listchars" | "lcs" => view.listchars.write(value.parse()?),
+        "scrolloff" | "so" => view.scrolloff.write(value.parse()?),
+        "wrap" => view.wrap.write(value.parse()?),
         _ => anyhow::bail!("unknown parameter: `{key}`"),
     }
     Ok(())
@@ -522,6 +1305,11 @@ pub async fn save_all(client: &Client, force: bool) -> crate::Result<()> {
     Ok(())
 }
 
+pub async fn edit(client: &Client, path: PathBuf) -> crate::Result<()> {
+    client.with(move |editor| editor.open(path, OpenFlags::empty())).await?.await?;
+    Ok(())
+}
+
 pub async fn reload(client: &Client) -> crate::Result<()> {
     client
         .with(|editor| {
@@ -43,6 +43,12 @@ fn parse_command() {
         ("set x y", expect![[r#"
                 set x y
             "#]]),
+        ("e ../src/main.rs", expect![[r#"
+            e ../src/main.rs
+        "#]]),
+        ("w!", expect![[r#"
+            w!
+        "#]]),
         (":extra colon", expect![[r#"found ":""#]]),
         (" \n", expect![[r#"found "\n""#]]),
     ] {
@@ -52,3 +58,41 @@ fn parse_command() {
         };
     }
 }
+
+#[test]
+fn parse_range_and_substitute() {
+    for (src, expect) in [
+        ("%s/a/b/g", expect![[r#"
+            % s/a/b/g
+        "#]]),
+        (".,$s#a#b#", expect![[r#"
+            .,$ s/a/b/
+        "#]]),
+        (r"'a,'b-1s/\//x/", expect![[r#"
+            'a,'b-1 s///x/
+        "#]]),
+        (r"+2,$-1s/(\w+) (\w+)/\2 \1/cI", expect![[r#"
+            .+2,$-1 s/(\w+) (\w+)/\2 \1/cI
+        "#]]),
+        ("3s/x", expect![[r#"
+            3 s/x//
+        "#]]),
+        ("%foo", expect![[r#"
+            % foo
+        "#]]),
+        ("sp", expect![[r#"
+            sp
+        "#]]),
+        ("%!sort", expect![[r#"
+            % !sort
+        "#]]),
+        ("'<,'>! prettier --parser babel", expect![[r#"
+            '<,'> !prettier --parser babel
+        "#]]),
+    ] {
+        match src.parse::<Command>() {
+            Ok(cmd) => expect.assert_debug_eq(&cmd),
+            Err(err) => expect.assert_eq(&err.to_string()),
+        };
+    }
+}
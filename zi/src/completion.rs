@@ -5,8 +5,9 @@ use futures_core::future::BoxFuture;
 use nucleo::Utf32Str;
 use nucleo::pattern::{Atom, AtomKind, CaseMatching, Normalization};
 use zi_core::CompletionItem;
-use zi_text::{Delta, DeltaRange};
+use zi_text::{AnyText, Delta, DeltaRange, Text as _};
 
+use crate::snippet::Snippet;
 use crate::{Editor, Result, lstypes};
 
 // FIXME this can maybe merge with `LanguageService` now
@@ -33,6 +34,8 @@ pub(crate) struct ActiveCompletionState {
     matches: Vec<nucleo::Match>,
     matcher: nucleo::Matcher,
     query: String,
+    /// The request the items are awaited from, responses to any other request are for an outdated prefix.
+    request: u64,
 }
 
 impl Completion {
@@ -40,19 +43,24 @@ impl Completion {
         *self = Completion::Inactive;
     }
 
-    pub(super) fn activate(&mut self, at: usize, trigger: Option<char>) {
-        if let Completion::Inactive = self {
-            let (query, replacement_range) = match trigger {
-                Some(c) if c.is_alphabetic() => (c.to_string(), at - c.len_utf8()..at),
-                _ => (String::new(), at..at),
-            };
-
-            tracing::debug!(initial_query = ?query, trigger = ?trigger, range = ?replacement_range, "activating completion");
-            *self = Completion::Active(ActiveCompletionState {
-                query,
-                replacement_range,
-                ..Default::default()
-            });
+    /// Start completing at `at`, or if completion is already active, wait for the items of `request` instead.
+    pub(super) fn activate(&mut self, at: usize, trigger: Option<char>, request: u64) {
+        match self {
+            Completion::Active(state) => state.request = request,
+            Completion::Inactive => {
+                let (query, replacement_range) = match trigger {
+                    Some(c) if c.is_alphabetic() => (c.to_string(), at - c.len_utf8()..at),
+                    _ => (String::new(), at..at),
+                };
+
+                tracing::debug!(initial_query = ?query, trigger = ?trigger, range = ?replacement_range, "activating completion");
+                *self = Completion::Active(ActiveCompletionState {
+                    query,
+                    replacement_range,
+                    request,
+                    ..Default::default()
+                });
+            }
         }
     }
 
@@ -98,17 +106,46 @@ impl ActiveCompletionState {
     }
 
     fn select(&mut self) -> Option<Delta<'static>> {
-        let item = self
-            .widget_state
-            .borrow()
-            .selected()
-            .and_then(|idx| self.matches.get(idx))
-            .and_then(|m| self.options.get(m.idx as usize))?;
-
-        let replacement_text = item.insert_text.as_deref().unwrap_or(&item.label);
+        let item = self.selected()?;
+        // Edits reaching outside the completed word and snippets are only applied on accepting the item.
+        let replacement_text = match item {
+            CompletionItem {
+                replace_range: None, snippet: false, insert_text: Some(text), ..
+            } => text,
+            _ => &item.label,
+        };
         Some(self.generate_delta(replacement_text.to_owned()))
     }
 
+    fn selected(&self) -> Option<&CompletionItem> {
+        let idx = self.widget_state.borrow().selected()?;
+        self.matches.get(idx).and_then(|m| self.options.get(m.idx as usize))
+    }
+
+    /// The range to replace to accept the selected item and the snippet to replace it with, `None` if nothing is
+    /// selected. The range covers what [`Self::select_next`] or [`Self::select_prev`] inserted for the item.
+    pub fn accept(&self, text: &dyn AnyText) -> Option<(DeltaRange, Snippet)> {
+        let item = self.selected()?;
+        let insert_text = item.insert_text.as_deref().unwrap_or(&item.label);
+        let snippet = if item.snippet {
+            Snippet::parse(insert_text)
+        } else {
+            Snippet::plain(insert_text.to_owned())
+        };
+        // The range is relative to the text when completion was requested.
+        // Since then only the word being completed has changed, so the start is still valid.
+        let start = item
+            .replace_range
+            .map(|range| text.point_to_byte(range.start()))
+            .filter(|&start| start <= self.replacement_range.start)
+            .unwrap_or(self.replacement_range.start);
+        Some((start..self.replacement_range.end, snippet))
+    }
+
+    pub fn request(&self) -> u64 {
+        self.request
+    }
+
     fn generate_delta(&mut self, replacement: impl Into<String>) -> Delta<'static> {
         let replacement = replacement.into();
         let n = replacement.len();
@@ -126,20 +163,24 @@ impl ActiveCompletionState {
         self.compute_matches();
     }
 
-    pub fn update_query(&mut self, c: Option<char>) {
+    /// Extend the query with the typed character, or remove the last character if `None`.
+    /// Returns `false` if the query was already empty, i.e. the cursor moved before the completed word.
+    pub fn update_query(&mut self, c: Option<char>) -> bool {
         match c {
             Some(c) => {
                 self.query.push(c);
                 self.replacement_range.end = self.replacement_range.start + self.query.len();
             }
             None => {
-                if self.query.pop().is_some() {
-                    self.replacement_range.end = self.replacement_range.start + self.query.len();
+                if self.query.pop().is_none() {
+                    return false;
                 }
+                self.replacement_range.end = self.replacement_range.start + self.query.len();
             }
         }
 
         self.compute_matches();
+        true
     }
 
     pub fn matches(&self) -> impl ExactSizeIterator<Item = &CompletionItem> {
@@ -166,8 +207,19 @@ impl ActiveCompletionState {
                 )
                 .map(|score| nucleo::Match { idx: idx as u32, score: score as u32 })
         }));
-        self.matches.sort_by_key(|m| std::cmp::Reverse(m.score));
+        // Prefix matches rank first, otherwise the order of the providers is kept on ties.
+        let options = &self.options;
+        let query = &self.query;
+        self.matches.sort_by_key(|m| {
+            let item = &options[m.idx as usize];
+            let text = item.filter_text.as_ref().unwrap_or(&item.label);
+            (!starts_with_ignore_case(text, query), std::cmp::Reverse(m.score))
+        });
 
         self.widget_state.borrow_mut().select(None);
     }
 }
+
+fn starts_with_ignore_case(s: &str, prefix: &str) -> bool {
+    s.get(..prefix.len()).is_some_and(|start| start.eq_ignore_ascii_case(prefix))
+}
@@ -0,0 +1,234 @@
+//! Digraphs in the style of vim's `:digraphs`, two keys that stand for a character that isn't on the keyboard.
+//! Most of them are from RFC 1345, the first key is the base character and the second is the accent or variant,
+//! e.g. `a:` is `ä`, `e'` is `é` and `a*` is `α`.
+
+/// The digraphs by their two keys.
+const DIGRAPHS: &[(&str, char)] = &[
+    ("A'", 'Á'),
+    ("A!", 'À'),
+    ("A>", 'Â'),
+    ("A:", 'Ä'),
+    ("A?", 'Ã'),
+    ("a'", 'á'),
+    ("a!", 'à'),
+    ("a>", 'â'),
+    ("a:", 'ä'),
+    ("a?", 'ã'),
+    ("E'", 'É'),
+    ("E!", 'È'),
+    ("E>", 'Ê'),
+    ("E:", 'Ë'),
+    ("E?", 'Ẽ'),
+    ("e'", 'é'),
+    ("e!", 'è'),
+    ("e>", 'ê'),
+    ("e:", 'ë'),
+    ("e?", 'ẽ'),
+    ("I'", 'Í'),
+    ("I!", 'Ì'),
+    ("I>", 'Î'),
+    ("I:", 'Ï'),
+    ("I?", 'Ĩ'),
+    ("i'", 'í'),
+    ("i!", 'ì'),
+    ("i>", 'î'),
+    ("i:", 'ï'),
+    ("i?", 'ĩ'),
+    ("O'", 'Ó'),
+    ("O!", 'Ò'),
+    ("O>", 'Ô'),
+    ("O:", 'Ö'),
+    ("O?", 'Õ'),
+    ("o'", 'ó'),
+    ("o!", 'ò'),
+    ("o>", 'ô'),
+    ("o:", 'ö'),
+    ("o?", 'õ'),
+    ("U'", 'Ú'),
+    ("U!", 'Ù'),
+    ("U>", 'Û'),
+    ("U:", 'Ü'),
+    ("U?", 'Ũ'),
+    ("u'", 'ú'),
+    ("u!", 'ù'),
+    ("u>", 'û'),
+    ("u:", 'ü'),
+    ("u?", 'ũ'),
+    ("Y'", 'Ý'),
+    ("Y!", 'Ỳ'),
+    ("Y>", 'Ŷ'),
+    ("Y:", 'Ÿ'),
+    ("Y?", 'Ỹ'),
+    ("y'", 'ý'),
+    ("y!", 'ỳ'),
+    ("y>", 'ŷ'),
+    ("y:", 'ÿ'),
+    ("y?", 'ỹ'),
+    ("N'", 'Ń'),
+    ("N!", 'Ǹ'),
+    ("N?", 'Ñ'),
+    ("n'", 'ń'),
+    ("n!", 'ǹ'),
+    ("n?", 'ñ'),
+    ("C'", 'Ć'),
+    ("C>", 'Ĉ'),
+    ("c'", 'ć'),
+    ("c>", 'ĉ'),
+    ("Aa", 'Å'),
+    ("aa", 'å'),
+    ("C,", 'Ç'),
+    ("c,", 'ç'),
+    ("AE", 'Æ'),
+    ("ae", 'æ'),
+    ("O/", 'Ø'),
+    ("o/", 'ø'),
+    ("ss", 'ß'),
+    ("OE", 'Œ'),
+    ("oe", 'œ'),
+    ("D-", 'Đ'),
+    ("d-", 'đ'),
+    ("TH", 'Þ'),
+    ("th", 'þ'),
+    ("A*", 'Α'),
+    ("a*", 'α'),
+    ("B*", 'Β'),
+    ("b*", 'β'),
+    ("G*", 'Γ'),
+    ("g*", 'γ'),
+    ("D*", 'Δ'),
+    ("d*", 'δ'),
+    ("E*", 'Ε'),
+    ("e*", 'ε'),
+    ("Z*", 'Ζ'),
+    ("z*", 'ζ'),
+    ("Y*", 'Η'),
+    ("y*", 'η'),
+    ("H*", 'Θ'),
+    ("h*", 'θ'),
+    ("I*", 'Ι'),
+    ("i*", 'ι'),
+    ("K*", 'Κ'),
+    ("k*", 'κ'),
+    ("L*", 'Λ'),
+    ("l*", 'λ'),
+    ("M*", 'Μ'),
+    ("m*", 'μ'),
+    ("N*", 'Ν'),
+    ("n*", 'ν'),
+    ("C*", 'Ξ'),
+    ("c*", 'ξ'),
+    ("O*", 'Ο'),
+    ("o*", 'ο'),
+    ("P*", 'Π'),
+    ("p*", 'π'),
+    ("R*", 'Ρ'),
+    ("r*", 'ρ'),
+    ("S*", 'Σ'),
+    ("s*", 'σ'),
+    ("T*", 'Τ'),
+    ("t*", 'τ'),
+    ("U*", 'Υ'),
+    ("u*", 'υ'),
+    ("F*", 'Φ'),
+    ("f*", 'φ'),
+    ("X*", 'Χ'),
+    ("x*", 'χ'),
+    ("Q*", 'Ψ'),
+    ("q*", 'ψ'),
+    ("W*", 'Ω'),
+    ("w*", 'ω'),
+    ("*s", 'ς'),
+    ("NS", '\u{a0}'),
+    ("!I", '¡'),
+    ("Ct", '¢'),
+    ("Pd", '£'),
+    ("Eu", '€'),
+    ("Ye", '¥'),
+    ("SE", '§'),
+    ("Co", '©'),
+    ("Rg", '®'),
+    ("TM", '™'),
+    ("DG", '°'),
+    ("+-", '±'),
+    ("1S", '¹'),
+    ("2S", '²'),
+    ("3S", '³'),
+    ("My", 'µ'),
+    ("PI", '¶'),
+    (".M", '·'),
+    ("<<", '«'),
+    (">>", '»'),
+    ("14", '¼'),
+    ("12", '½'),
+    ("34", '¾'),
+    ("?I", '¿'),
+    ("*X", '×'),
+    ("-:", '÷'),
+    ("-N", '–'),
+    ("-M", '—'),
+    ("'6", '‘'),
+    ("'9", '’'),
+    ("\"6", '“'),
+    ("\"9", '”'),
+    (",.", '…'),
+    ("<-", '←'),
+    ("->", '→'),
+    ("-!", '↑'),
+    ("-v", '↓'),
+    ("<>", '↔'),
+    ("=>", '⇒'),
+    ("==", '⇔'),
+    ("FA", '∀'),
+    ("dP", '∂'),
+    ("TE", '∃'),
+    ("/0", '∅'),
+    ("(-", '∈'),
+    ("*P", '∏'),
+    ("+Z", '∑'),
+    ("RT", '√'),
+    ("00", '∞'),
+    ("AN", '∧'),
+    ("OR", '∨'),
+    ("(U", '∩'),
+    (")U", '∪'),
+    ("In", '∫'),
+    ("!=", '≠'),
+    ("=3", '≡'),
+    ("=<", '≤'),
+    (">=", '≥'),
+    ("OK", '✓'),
+    ("XX", '✗'),
+];
+
+/// The character for the two keys, they can be typed in either order.
+pub(crate) fn digraph(first: char, second: char) -> Option<char> {
+    let find = |a: char, b: char| {
+        DIGRAPHS.iter().find(|(keys, _)| keys.chars().eq([a, b])).map(|&(_, c)| c)
+    };
+    find(first, second).or_else(|| find(second, first))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::digraph;
+
+    #[test]
+    fn digraphs() {
+        assert_eq!(digraph('a', ':'), Some('ä'));
+        assert_eq!(digraph(':', 'a'), Some('ä'));
+        assert_eq!(digraph('E', '\''), Some('É'));
+        assert_eq!(digraph('l', '*'), Some('λ'));
+        assert_eq!(digraph('E', 'u'), Some('€'));
+        assert_eq!(digraph('-', '>'), Some('→'));
+        assert_eq!(digraph('q', 'q'), None);
+    }
+
+    #[test]
+    fn digraphs_are_unique() {
+        let mut keys = super::DIGRAPHS.iter().map(|(keys, _)| keys).collect::<Vec<_>>();
+        keys.sort();
+        let len = keys.len();
+        keys.dedup();
+        assert_eq!(keys.len(), len);
+    }
+}
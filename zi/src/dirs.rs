@@ -7,6 +7,9 @@ struct Dirs {
     grammar_dir: PathBuf,
     plugin_dirs: &'static [PathBuf],
     config_dir: PathBuf,
+    theme_dir: PathBuf,
+    snippet_dir: PathBuf,
+    position_file: PathBuf,
 }
 
 fn dirs() -> &'static Dirs {
@@ -17,6 +20,9 @@ fn dirs() -> &'static Dirs {
         let grammar_dir = data.join("grammars");
         let plugin_dir = data.join("plugins");
         let config_dir = dirs.config_dir().join("zi");
+        let theme_dir = config_dir.join("themes");
+        let snippet_dir = config_dir.join("snippets");
+        let position_file = data.join("positions.toml");
 
         if !grammar_dir.exists() {
             std::fs::create_dir_all(&grammar_dir).expect("couldn't create grammar directory");
@@ -33,7 +39,7 @@ fn dirs() -> &'static Dirs {
         let plugin_path = std::env::var("ZI_PLUGIN_PATH").ok().unwrap_or_default();
         let plugin_dirs = Box::leak(plugin_path.split(':').map(PathBuf::from).collect::<Box<_>>());
 
-        Dirs { grammar_dir, plugin_dirs, config_dir }
+        Dirs { grammar_dir, plugin_dirs, config_dir, theme_dir, snippet_dir, position_file }
     })
 }
 
@@ -48,3 +54,16 @@ pub fn plugin() -> impl Iterator<Item = &'static Path> {
 pub fn config() -> &'static Path {
     &dirs().config_dir
 }
+
+pub fn theme() -> &'static Path {
+    &dirs().theme_dir
+}
+
+pub fn snippets() -> &'static Path {
+    &dirs().snippet_dir
+}
+
+/// The file the cursor position in each file is saved to.
+pub fn positions() -> &'static Path {
+    &dirs().position_file
+}
@@ -1,26 +1,53 @@
+mod abbrev;
+mod command_completion;
+mod comment;
 mod completion;
 
 mod config;
 pub(crate) mod cursor;
 mod default_keymap;
 mod diagnostics;
+mod digraph;
 mod dot;
 mod errors;
 mod events;
+mod filter;
+mod fold;
+mod format;
+mod git;
+mod hover;
+mod indent;
+mod keymap_config;
 mod lsp_requests;
+mod macros;
 mod marks;
+mod matchit;
+mod mouse;
 mod pickers;
+mod positions;
+mod quickfix;
 mod register;
 mod render;
 mod search;
+mod session;
+mod snippet;
+mod sort;
 mod state;
+mod statusline;
+mod substitute;
+mod sudo;
+mod surround;
+#[cfg(unix)]
+mod terminal;
+mod theme;
 pub mod visual;
+mod watcher;
 
 use std::any::Any;
-use std::collections::{BTreeMap, HashMap};
+use std::collections::{BTreeMap, HashMap, HashSet};
 use std::fs::File;
 use std::future::Future;
-use std::ops::{self, Deref, Index, IndexMut};
+use std::ops::{self, Deref, Index, IndexMut, RangeInclusive};
 use std::path::{Path, PathBuf};
 use std::pin::{Pin, pin};
 use std::sync::{Arc, OnceLock};
@@ -29,41 +56,51 @@ use std::time::{Duration, Instant};
 use std::{cmp, fmt, io, mem};
 
 use anyhow::{anyhow, bail};
-use arboard::Clipboard;
 use futures_util::stream::FuturesUnordered;
 use futures_util::{Stream, StreamExt};
 use ignore::WalkState;
 use slotmap::SlotMap;
 use stdx::path::{PathExt, Relative};
-use tokio::io::{AsyncBufReadExt, AsyncWriteExt};
+use tokio::io::AsyncWriteExt;
 use tokio::select;
 use tokio::sync::mpsc::{Receiver, Sender, UnboundedReceiver, UnboundedSender};
 use tokio::sync::{Notify, oneshot};
 use ustr::Ustr;
 use zi_core::{PointOrByte, PointRange, Size};
-use zi_indent::Indent;
 use zi_input::{Event, KeyCode, KeyEvent, KeySequence};
-use zi_text::{
-    AnyText, Delta, Deltas, ReadonlyText, Rope, RopeBuilder, RopeCursor, Text, TextSlice,
-};
+use zi_text::{AnyText, Delta, Deltas, PieceText, ReadonlyText, Rope, RopeCursor, Text, TextSlice};
 use zi_textobject::motion::{self, Motion, MotionFlags};
 use zi_textobject::{TextObject, TextObjectFlags, TextObjectKind};
 
+use self::abbrev::Abbreviations;
+use self::command_completion::buffer_name;
 use self::config::Settings;
 use self::diagnostics::BufferDiagnostics;
+use self::digraph::CharPending;
 use self::dot::Dot;
 pub use self::errors::EditError;
-use self::register::Registers;
+use self::git::GitDiff;
+pub use self::git::{Hunk, HunkKind};
+use self::keymap_config::KeymapConfig;
+use self::macros::Macros;
+use self::marks::{MarkPending, NamedMarks};
+use self::mouse::MouseState;
+use self::quickfix::Quickfix;
+pub use self::quickfix::QuickfixEntry;
 pub use self::register::{Register, RegisterKind};
 pub use self::search::Match;
 use self::search::SearchState;
+use self::snippet::Snippets;
 use self::state::{OperatorPendingState, State};
+use self::surround::SurroundPending;
+use self::watcher::FileWatcher;
 use crate::buffer::picker::{BufferPicker, BufferPickerEntry, DynamicHandler, Picker};
 use crate::buffer::{
     Buffer, BufferFlags, EditFlags, ExplorerBuffer, IndentSettings, Injector, InspectorBuffer,
-    PickerBuffer, SnapshotFlags, TextBuffer,
+    PickerBuffer, SnapshotFlags, TextBuffer, UndoEntry,
 };
-use crate::command::{self, Command, CommandKind, Handler, Word};
+use crate::clipboard::{ClipboardBackend, ClipboardProvider};
+use crate::command::{self, Command, CommandKind, CommandRange, Handler, Word};
 use crate::completion::Completion;
 use crate::event::EventHandler;
 use crate::keymap::{DynKeymap, Keymap, TrieResult};
@@ -71,11 +108,12 @@ use crate::language_service::LanguageServiceInstance;
 use crate::layout::Layer;
 use crate::plugin::PluginManager;
 use crate::syntax::{HighlightId, Syntax, Theme};
+use crate::undo::UndoStep;
 use crate::view::{SetCursorFlags, ViewGroup};
 use crate::{
-    BufferId, Direction, Error, FileType, LanguageService, LanguageServiceId, Location, Mode,
-    Namespace, NamespaceId, Operator, Point, Result, Setting, Url, VerticalAlignment, View,
-    ViewGroupId, ViewId, event, filetype, language, layout,
+    BufferId, Direction, Encoding, Error, FileFormat, FileType, LanguageService, LanguageServiceId,
+    Location, Mode, Namespace, NamespaceId, Operator, Point, Result, Setting, Url,
+    VerticalAlignment, View, ViewGroupId, ViewId, event, filetype, language, layout,
 };
 
 bitflags::bitflags! {
@@ -92,26 +130,17 @@ bitflags::bitflags! {
 
     #[derive(Default, Clone, Copy, PartialEq, Eq)]
     pub struct SaveFlags: u32 {
-        /// Flush the buffer to disk even if it's not dirty
+        /// Flush the buffer to disk even if it's not dirty, or if the file is readonly
         const FORCE = 1 << 0;
+        /// Retry a write that is denied permission through the `sudo_write_program`, `:SudoWrite`.
+        const SUDO = 1 << 1;
     }
-}
 
-// Ergonomic closure like clipboard access macro.
-// This exists for two reasons:
-// - We don't use a function so we can do partial borrows of `self`
-// - We want to hide the `Arc` error handling boilerplate. The arc is necessary as the error is not clone.
-macro_rules! with_clipboard {
-    ($self:expr, |$cb:ident| $body:expr) => {
-        match &mut $self.clipboard {
-            Ok(cb) => {
-                let $cb = cb;
-                let res = $body;
-                res.map_err(Arc::new)
-            }
-            Err(err) => Err(Arc::clone(err)),
-        }
-    };
+    #[derive(Default, Clone, Copy, PartialEq, Eq)]
+    struct InsertFlags: u8 {
+        /// Insert the text as is without adjusting the indentation of the lines.
+        const NO_AUTOINDENT = 1 << 0;
+    }
 }
 
 fn pool() -> &'static rayon::ThreadPool {
@@ -128,6 +157,21 @@ impl Backend for DummyBackend {
     }
 }
 
+// Ergonomic closure like clipboard access macro.
+// This exists for two reasons:
+// - We don't use a function so we can do partial borrows of `self`
+// - We want to hide the lazy (re)creation of the provider when the `clipboard` setting changes.
+macro_rules! with_clipboard {
+    ($self:expr, |$cb:ident| $body:expr) => {{
+        let backend = *$self.settings.clipboard.read();
+        if !matches!(&$self.clipboard, Some((current, _)) if *current == backend) {
+            $self.clipboard = Some((backend, backend.provider()));
+        }
+        let $cb = &mut $self.clipboard.as_mut().expect("just set").1;
+        $body
+    }};
+}
+
 pub trait Backend: Send + Sync + 'static {
     fn new_syntax(&mut self, ft: FileType) -> io::Result<Option<Box<dyn Syntax>>>;
 }
@@ -145,25 +189,62 @@ pub struct Editor {
     // We key diagnostics by `path` instead of `BufferId` as it is valid to send diagnostics for an unloaded buffer.
     // The per-buffer diagnostics are sorted by range.
     diagnostics: HashMap<PathBuf, BufferDiagnostics>,
+    /// Buffers with a debounced diagnostics refresh in flight.
+    pending_diagnostic_refreshes: HashSet<BufferId>,
+    /// How many times each language service has been restarted after crashing.
+    language_service_restarts: HashMap<LanguageServiceId, usize>,
     empty_buffer: BufferId,
     settings: Settings,
     search_state: SearchState,
     state: State,
     keymap: Keymap,
+    /// The config file the keymap was loaded from, reloaded by `:config reload`.
+    config_path: Option<PathBuf>,
+    /// The file the current theme was loaded from, `None` for the builtin theme.
+    theme_path: Option<PathBuf>,
+    /// When the pending key sequence gives up waiting for more keys.
+    key_deadline: Option<Instant>,
     active_language_services_by_ft: HashMap<FileType, Vec<LanguageServiceId>>,
     callbacks_tx: CallbacksSender,
     requests_tx: tokio::sync::mpsc::Sender<Request>,
     tree: layout::ViewTree,
     /// error to be displayed in the status line
     status_error: Option<String>,
+    /// An informational message for the status line, cleared on the next key press like `status_error`.
+    status_message: Option<String>,
+    hover: Option<HoverPopup>,
+    substitute: Option<PendingSubstitute>,
+    mouse: MouseState,
     command_handlers: HashMap<Word, Handler>,
     // plugins: Plugins,
     notify_quit: Notify,
     backend: Box<dyn Backend>,
     plugin_managers: BTreeMap<&'static str, Arc<dyn PluginManager + Send + Sync>>,
-    clipboard: Result<Clipboard, Arc<arboard::Error>>,
+    /// The clipboard provider, created on first use and recreated if the `clipboard` setting changes.
+    clipboard: Option<(ClipboardBackend, Box<dyn ClipboardProvider>)>,
     dot: Dot,
     count: Option<usize>,
+    /// The register selected with `"` for the next yank, delete or paste.
+    register: Option<char>,
+    /// Set when the next key is the name of a register.
+    register_pending: Option<RegisterPending>,
+    /// Set when the next key is the name of a mark.
+    mark_pending: Option<MarkPending>,
+    /// Set when the next keys name the delimiters for `ys`, `ds` or `cs`.
+    surround_pending: Option<SurroundPending>,
+    /// Set when the next keys name a character to insert, a digraph or a code point.
+    char_pending: Option<CharPending>,
+    named_marks: NamedMarks,
+    macros: Macros,
+    quickfix: Quickfix,
+    /// The checked out git branch shown in the status line, see `refresh_git_branch`.
+    git_branch: Option<String>,
+    git_diffs: HashMap<BufferId, GitDiff>,
+    file_watcher: FileWatcher,
+    snippets: Snippets,
+    abbreviations: Abbreviations,
+    /// Where the cursor position in each file is saved, see `set_position_file`.
+    position_file: Option<PathBuf>,
 }
 
 macro_rules! mode {
@@ -418,7 +499,6 @@ impl Editor {
         let size = size.into();
         let settings = Settings::default();
         let mut buffers = SlotMap::default();
-        let theme = settings.theme.read();
         let scratch_buffer = buffers.insert_with_key(|id| {
             Buffer::new(TextBuffer::new(
                 id,
@@ -426,7 +506,6 @@ impl Editor {
                 filetype!(text),
                 "scratch",
                 Rope::new(),
-                &theme,
                 None,
             ))
         });
@@ -443,7 +522,6 @@ impl Editor {
                 filetype!(text),
                 "empty",
                 "",
-                &theme,
                 None,
             ))
         });
@@ -457,7 +535,6 @@ impl Editor {
         //     callbacks_tx: callbacks_tx.clone(),
         // });
 
-        drop(theme);
         let mut editor = Self {
             buffers,
             views,
@@ -468,13 +545,18 @@ impl Editor {
             // plugins,
             empty_buffer,
             settings,
-            clipboard: Clipboard::new().map_err(Arc::new),
+            clipboard: None,
             backend: Box::new(backend),
             keymap: default_keymap::new(),
+            config_path: None,
+            theme_path: None,
+            key_deadline: None,
             tree: layout::ViewTree::new(size, active_view),
             command_handlers: command::builtin_handlers(),
             registers: Default::default(),
             diagnostics: Default::default(),
+            pending_diagnostic_refreshes: Default::default(),
+            language_service_restarts: Default::default(),
             notify_quit: Default::default(),
             view_groups: Default::default(),
             language_config: Default::default(),
@@ -483,13 +565,32 @@ impl Editor {
             state: Default::default(),
             search_state: Default::default(),
             status_error: Default::default(),
+            status_message: Default::default(),
+            hover: None,
+            substitute: None,
+            mouse: Default::default(),
             plugin_managers: Default::default(),
             dot: Default::default(),
             count: None,
+            register: None,
+            register_pending: None,
+            mark_pending: None,
+            surround_pending: None,
+            char_pending: None,
+            named_marks: Default::default(),
+            macros: Default::default(),
+            quickfix: Default::default(),
+            git_branch: None,
+            git_diffs: Default::default(),
+            file_watcher: Default::default(),
+            snippets: Default::default(),
+            abbreviations: Default::default(),
+            position_file: None,
         };
 
         let notify_redraw = NOTIFY_REDRAW.get_or_init(Default::default);
         editor.resize(size);
+        editor.refresh_git_branch();
         Self::subscribe_sync_hooks();
 
         (
@@ -524,7 +625,12 @@ impl Editor {
         self.tree.size()
     }
 
-    fn check_open(&self, path: &mut PathBuf, open_flags: OpenFlags) -> io::Result<()> {
+    /// Returns the encoding guessed from the start of the file if it exists.
+    fn check_open(
+        &self,
+        path: &mut PathBuf,
+        open_flags: OpenFlags,
+    ) -> io::Result<Option<Encoding>> {
         if path.exists() && !path.is_file() {
             return Err(io::Error::new(io::ErrorKind::InvalidInput, "not a file"));
         }
@@ -533,23 +639,20 @@ impl Editor {
             return Err(io::Error::new(io::ErrorKind::NotFound, "file not found"));
         }
 
-        if path.exists() {
-            // Try ensure that the file does not contains non-utf8 data.
-            use std::io::Read;
-            let mut buf = [0u8; 1024];
-            let n = File::open(path.as_path())?.read(&mut buf)?;
-            match content_inspector::inspect(&buf[..n]) {
-                content_inspector::ContentType::UTF_8
-                | content_inspector::ContentType::UTF_8_BOM => {}
-                _ => {
-                    return Err(io::Error::new(io::ErrorKind::InvalidData, "non-utf8 data"));
-                }
-            }
-
-            *path = path.canonicalize()?;
+        if !path.exists() {
+            return Ok(None);
         }
 
-        Ok(())
+        // Try ensure that the file is text.
+        use std::io::Read;
+        let mut buf = [0u8; 1024];
+        let n = File::open(path.as_path())?.read(&mut buf)?;
+        let Some(encoding) = Encoding::detect(&buf[..n]) else {
+            return Err(io::Error::new(io::ErrorKind::InvalidData, "binary data"));
+        };
+
+        *path = path.canonicalize()?;
+        Ok(Some(encoding))
     }
 
     fn buffer_at_path(&self, path: &Path) -> Option<BufferId> {
@@ -561,12 +664,17 @@ impl Editor {
         path: impl AsRef<Path>,
         open_flags: OpenFlags,
     ) -> io::Result<impl Future<Output = Result<BufferId>> + 'static> {
-        let theme = self.theme().clone();
         let mut path = path.as_ref().to_path_buf();
-        self.check_open(&mut path, open_flags)?;
+        let sniffed = self.check_open(&mut path, open_flags)?;
 
         let ft = FileType::detect(&path);
-        let syntax = self.backend.new_syntax(ft)?;
+        // Large files are mapped and loaded as they're viewed, parsing them would defeat the point.
+        let threshold = *self.settings.large_file_threshold.read();
+        // Only utf-8 can be mapped, other encodings have to be decoded up front.
+        let utf8 = sniffed == Some(Encoding::Utf8);
+        let large =
+            utf8 && std::fs::metadata(&path).is_ok_and(|metadata| metadata.len() >= threshold);
+        let syntax = if large { None } else { self.backend.new_syntax(ft)? };
 
         let existing_buf = self.buffer_at_path(&path);
 
@@ -596,14 +704,12 @@ impl Editor {
 
         let client = self.client();
         Ok(async move {
-            #[allow(clippy::too_many_arguments)]
             async fn execute<T: Text + Clone + 'static>(
                 client: &Client,
                 plan: Plan,
                 ft: FileType,
                 path: &Path,
                 text: T,
-                theme: Setting<Theme>,
                 flags: BufferFlags,
                 syntax: Option<Box<dyn Syntax>>,
             ) -> BufferId {
@@ -611,28 +717,13 @@ impl Editor {
                 client
                     .with(move |editor| match plan {
                         Plan::Replace(id) => {
-                            let buf = Buffer::new(TextBuffer::new(
-                                id,
-                                flags,
-                                ft,
-                                &path,
-                                text,
-                                &theme.read(),
-                                syntax,
-                            ));
+                            let buf =
+                                Buffer::new(TextBuffer::new(id, flags, ft, &path, text, syntax));
                             editor.buffers[id] = buf;
                             id
                         }
                         Plan::Insert => editor.buffers.insert_with_key(|id| {
-                            Buffer::new(TextBuffer::new(
-                                id,
-                                flags,
-                                ft,
-                                &path,
-                                text,
-                                &theme.read(),
-                                syntax,
-                            ))
+                            Buffer::new(TextBuffer::new(id, flags, ft, &path, text, syntax))
                         }),
                         Plan::Existing(_) => unreachable!(),
                     })
@@ -640,29 +731,64 @@ impl Editor {
             }
 
             let start = Instant::now();
-            let buf = if let Plan::Existing(id) = plan {
-                id
-            } else if open_flags.contains(OpenFlags::READONLY) {
+            // Mapped files are always utf-8, which is the default, and keep their line endings as they are.
+            let (buf, detected) = if let Plan::Existing(id) = plan {
+                (id, None)
+            } else if large {
+                let mut flags = BufferFlags::LARGE;
+                if open_flags.contains(OpenFlags::READONLY) {
+                    flags |= BufferFlags::READONLY;
+                }
+                // Safety: saving a large file replaces the file instead of writing to the mapped one.
+                let text = unsafe { PieceText::open(&path) }?;
+                (execute(&client, plan, ft, &path, text, flags, syntax).await, None)
+            } else if open_flags.contains(OpenFlags::READONLY) && utf8 {
                 debug_assert!(path.exists() && path.is_file());
                 // Safety: hmm mmap is tricky, maybe we should try advisory lock the file at least
                 let text = unsafe { ReadonlyText::open(&path) }?;
-                execute(&client, plan, ft, &path, text, theme, BufferFlags::READONLY, syntax).await
+                (execute(&client, plan, ft, &path, text, BufferFlags::READONLY, syntax).await, None)
             } else {
-                let rope = if path.exists() {
-                    rope_from_reader(tokio::fs::File::open(&path).await?).await?
+                let mut flags = BufferFlags::empty();
+                if open_flags.contains(OpenFlags::READONLY) {
+                    flags |= BufferFlags::READONLY;
+                }
+
+                let (rope, encoding, file_format) = if path.exists() {
+                    let bytes = tokio::fs::read(&path).await?;
+                    // The start of the file is not always enough to tell utf-8 and latin-1 apart.
+                    let encoding = Encoding::detect(&bytes).unwrap_or_default();
+                    let text = encoding.decode(&bytes);
+                    let (file_format, mixed) = FileFormat::detect(&text);
+                    if mixed {
+                        flags |= BufferFlags::MIXED_LINE_ENDINGS;
+                    }
+                    (Rope::from(file_format.normalize(&text).as_ref()), encoding, file_format)
                 } else {
-                    Rope::new()
+                    (Rope::new(), Encoding::default(), FileFormat::default())
                 };
-                execute(&client, plan, ft, &path, rope, theme, BufferFlags::empty(), syntax).await
+
+                let buf = execute(&client, plan, ft, &path, rope, flags, syntax).await;
+                (buf, Some((encoding, file_format)))
             };
 
             client
                 .with(move |editor| {
+                    if let Some((encoding, file_format)) = detected {
+                        let settings = editor[buf].settings();
+                        settings.encoding.write(encoding);
+                        settings.file_format.write(file_format);
+                        if editor[buf].flags().contains(BufferFlags::MIXED_LINE_ENDINGS) {
+                            editor.status_message = Some(format!(
+                                "mixed line endings, they will be written as `{file_format}`"
+                            ));
+                        }
+                    }
+
                     if !open_flags.contains(OpenFlags::BACKGROUND) {
                         editor.set_buffer(Active, buf);
                     }
 
-                    if open_flags.contains(OpenFlags::SPAWN_LANGUAGE_SERVICES) {
+                    if open_flags.contains(OpenFlags::SPAWN_LANGUAGE_SERVICES) && !large {
                         editor.spawn_language_services_for_ft(buf, ft)?;
                     }
 
@@ -678,9 +804,39 @@ impl Editor {
     }
 
     pub fn register_command(&mut self, handler: Handler) -> Option<Handler> {
+        for alias in handler.aliases() {
+            self.command_handlers.insert(alias.clone(), handler.clone());
+        }
         self.command_handlers.insert(handler.name(), handler)
     }
 
+    /// Show the buffer whose path contains `name` in the view, as done by `:b`.
+    pub fn switch_to_buffer(&mut self, selector: impl Selector<ViewId>, name: &str) -> Result<()> {
+        let view = selector.select(self);
+        let named = self
+            .buffers
+            .values()
+            .filter_map(|buf| Some((buf.id(), buffer_name(buf)?)))
+            .collect::<Vec<_>>();
+
+        // An exact match wins, otherwise the name must pick out a single buffer.
+        let buf = match named.iter().find(|(_, buf_name)| buf_name == name) {
+            Some(&(buf, _)) => buf,
+            None => match &named
+                .iter()
+                .filter(|(_, buf_name)| buf_name.contains(name))
+                .collect::<Vec<_>>()[..]
+            {
+                [(buf, _)] => *buf,
+                [] => bail!("no matching buffer for {name}"),
+                _ => bail!("more than one match for {name}"),
+            },
+        };
+
+        self.set_buffer(view, buf);
+        Ok(())
+    }
+
     pub(crate) fn empty_buffer(&self) -> BufferId {
         self.empty_buffer
     }
@@ -692,7 +848,19 @@ impl Editor {
     pub fn set_buffer(&mut self, view: impl Selector<ViewId>, buf: impl Selector<BufferId>) {
         let view = view.select(self);
         let buf = buf.select(self);
+        if self.views[view].buffer() == buf {
+            return;
+        }
+
+        // Pickers show their previews in a view of their own, where the cursor ends up there doesn't matter.
+        let remember = self.views[view].group().is_none();
+        if remember {
+            self.save_position(view);
+        }
         self.views[view].set_buffer(buf);
+        if remember {
+            self.restore_position(view);
+        }
     }
 
     pub fn highlight_id_by_name(&self, name: impl AsRef<str>) -> HighlightId {
@@ -725,6 +893,10 @@ impl Editor {
         self.status_error.as_deref()
     }
 
+    pub fn get_message(&self) -> Option<&str> {
+        self.status_message.as_deref()
+    }
+
     pub fn set_error(&mut self, error: impl fmt::Display) {
         // TODO push all the corresponding tracing error in here
         set_error!(self, error);
@@ -738,7 +910,7 @@ impl Editor {
 
         let (view, buf) = get_ref!(self);
         let area = self.tree.view_area(view.id());
-        let (x, y) = view.cursor_viewport_coords(buf);
+        let (x, y) = view.cursor_viewport_coords(buf, area);
         (x + area.x, y + area.y)
     }
 
@@ -756,7 +928,16 @@ impl Editor {
     pub fn handle_input(&mut self, event: impl Into<Event>) {
         match event.into() {
             Event::Key(key) => self.handle_key_event(key),
+            Event::Mouse(mouse) => self.handle_mouse_event(mouse),
             Event::Resize(width, height) => self.resize(Size::new(width, height)),
+            Event::FocusGained => self.refresh_git_branch(),
+            Event::Paste(text) => {
+                // A paste interrupts any partially typed key sequence, resolve it as if it timed out.
+                if self.key_deadline.is_some() {
+                    self.timeout_pending_keys();
+                }
+                set_error_if!(self: self.paste(Active, &text));
+            }
         }
     }
 
@@ -797,9 +978,16 @@ impl Editor {
 
         let mut events = pin!(events);
         loop {
+            let key_deadline = self.key_deadline.map(tokio::time::Instant::from_std);
             select! {
                 biased;
                 Some(event) = events.next() => self.handle_input(event?),
+                () = async {
+                    match key_deadline {
+                        Some(deadline) => tokio::time::sleep_until(deadline).await,
+                        None => std::future::pending().await,
+                    }
+                } => self.timeout_pending_keys(),
                 () = notify_redraw.notified() => tracing::debug!("redrawing due to request"),
                 f = callbacks.select_next_some() => match f {
                     Ok(f) => if let Err(err) = f(self) {
@@ -849,6 +1037,8 @@ impl Editor {
         let active_buffer = self[view].buffer();
 
         let State::Command(state) = &mut self.state else { return };
+        let origin =
+            state.search_origin.filter(|loc| loc.buf == active_buffer).map(|loc| loc.point);
 
         let (k, query) = state.buffer().split_at(1);
         match k {
@@ -865,7 +1055,14 @@ impl Editor {
                     return;
                 }
 
-                let regex = match Regex::new(query) {
+                // Smartcase, the search is case insensitive unless the query contains an uppercase character.
+                let regex = if query.chars().any(char::is_uppercase) {
+                    Regex::new(query)
+                } else {
+                    Regex::new(&format!("(?i){query}"))
+                };
+
+                let regex = match regex {
                     Ok(regex) => regex,
                     Err(err) => return set_error!(self, err),
                 };
@@ -876,8 +1073,9 @@ impl Editor {
                 let input = Input::new(RopeCursor::new(text.byte_slice(..)));
 
                 let start_time = Instant::now();
+                // Search from where the search started, not from the match we moved to for the previous query.
                 self.search_state.set_matches(
-                    text.point_to_byte(view.cursor()),
+                    text.point_to_byte(origin.unwrap_or(view.cursor())),
                     regex
                         .find_iter(input)
                         // This is run synchronously, so we add a strict limit to prevent noticable latency.
@@ -893,17 +1091,32 @@ impl Editor {
                         .collect::<Box<_>>(),
                 );
 
-                self.goto_match(|s| s.current_match());
+                self.goto_match(|s| s.current_match(), "");
             }
             _ => unreachable!(),
         }
     }
 
     fn handle_insert(&mut self, c: char) -> Result<(), EditError> {
+        self.expand_abbreviation(Active, c)?;
+        self.handle_insert_literal(c)
+    }
+
+    /// Insert the character as typed without expanding an abbreviation before it, `<C-v>{char}`.
+    fn handle_insert_literal(&mut self, c: char) -> Result<(), EditError> {
         match &mut self.state {
-            State::Insert(..) => self.insert_char(Active, c),
+            State::Insert(..) => {
+                // Typing over a selected snippet placeholder replaces it.
+                self.take_snippet_placeholder(Active)?;
+                let byte = self.cursor_byte(Active);
+                if let State::Insert(state) = &mut self.state {
+                    state.start.get_or_insert(byte);
+                }
+                self.insert_char(Active, c)
+            }
             State::Command(state) => {
                 state.buffer.push(c);
+                state.completion = None;
                 self.update_search();
                 Ok(())
             }
@@ -912,8 +1125,85 @@ impl Editor {
     }
 
     #[inline]
+    fn run_action(&mut self, mode: Mode, f: Action) {
+        f(self);
+        if mode == Mode::Normal
+            && mode!(self) == Mode::Normal
+            && self.count.is_none()
+            && self.register_pending.is_none()
+        {
+            // A selected register only lasts for the command following it.
+            self.register = None;
+            self.dot.clear_normal_keys();
+        }
+    }
+
+    fn start_key_timeout(&mut self) {
+        self.key_deadline = Some(Instant::now() + *self.settings.key_timeout.read());
+    }
+
+    /// Stop waiting for the rest of the pending key sequence, as if its timeout elapsed.
+    /// This runs the binding of the keys typed so far if there is one, otherwise they are inserted as text in
+    /// insert and command mode and dropped in the other modes.
+    pub fn timeout_pending_keys(&mut self) {
+        self.key_deadline = None;
+        let mode = mode!(self);
+        let mut empty = Keymap::default();
+        let (_, buf) = get!(self);
+        let mut keymap = self.keymap.pair(buf.keymap().unwrap_or(&mut empty));
+        match keymap.on_timeout(mode) {
+            (Some(f), _) => self.run_action(mode, f),
+            (None, buffered) if matches!(mode, Mode::Insert | Mode::Command) => {
+                for event in buffered {
+                    if let KeyCode::Char(c) = event.code() {
+                        set_error_if!(self: self.handle_insert(c));
+                    }
+                }
+            }
+            (None, _) => (),
+        }
+    }
+
+    /// Load the keymap from the `[keys]` table of a TOML config file on top of the default keymap.
+    /// A missing file is not an error, it can be created later and loaded with `:config reload`.
+    pub fn load_config(&mut self, path: impl Into<PathBuf>) -> Result<()> {
+        self.config_path = Some(path.into());
+        self.reload_config()
+    }
+
+    /// Rebuild the keymap and abbreviations from the defaults and the config file.
+    /// The current keymap is kept if the config is invalid.
+    pub fn reload_config(&mut self) -> Result<()> {
+        let mut keymap = default_keymap::new();
+        let mut abbreviations = Abbreviations::default();
+        let src = match &self.config_path {
+            Some(path) => match std::fs::read_to_string(path) {
+                Ok(src) => Some(src),
+                Err(err) if err.kind() == io::ErrorKind::NotFound => None,
+                Err(err) => return Err(anyhow!("failed to read {}: {err}", path.display())),
+            },
+            None => None,
+        };
+
+        if let Some(src) = src {
+            let config = KeymapConfig::parse(&src)?;
+            config.apply(&mut keymap);
+            if let Some(timeout) = config.timeout {
+                self.settings.key_timeout.write(timeout);
+            }
+            abbreviations = Abbreviations::parse(&src)?;
+        }
+
+        self.keymap = keymap;
+        self.abbreviations = abbreviations;
+        Ok(())
+    }
+
     fn handle_key_event(&mut self, key: KeyEvent) {
         self.status_error = None;
+        self.status_message = None;
+        self.hover = None;
+        self.key_deadline = None;
         let mode = mode!(self);
 
         // Save the key if we're in Normal mode (it might be the start of a change)
@@ -926,6 +1216,57 @@ impl Editor {
         }
 
         self.dot.maybe_record(&key);
+        self.macros.maybe_record(&key);
+
+        if self.is_reload_pending() {
+            return self.confirm_reload(&key);
+        }
+
+        if self.substitute.is_some() {
+            return self.confirm_substitute(&key);
+        }
+
+        if let Some(pending) = self.register_pending.take() {
+            let KeyCode::Char(c) = key.code() else { return };
+            match pending {
+                RegisterPending::Select if Registers::is_valid(c) => self.register = Some(c),
+                RegisterPending::Record if c.is_ascii_alphanumeric() => {
+                    // Neither `qa` nor `@a` should become part of a dot repeat.
+                    self.dot.clear_normal_keys();
+                    self.macros.start_recording(c);
+                }
+                RegisterPending::Replay => {
+                    self.dot.clear_normal_keys();
+                    set_error_if!(self: self.replay_macro(c));
+                }
+                _ => (),
+            }
+            return;
+        }
+
+        if let Some(pending) = self.mark_pending.take() {
+            let KeyCode::Char(c) = key.code() else { return };
+            match pending {
+                MarkPending::Set => set_error_if!(self: self.set_mark(Active, c)),
+                MarkPending::Goto { linewise } => set_error_if!(self: self.goto_mark(c, linewise)),
+            }
+            return;
+        }
+
+        if let Some(pending) = self.surround_pending.take() {
+            set_error_if!(self: self.surround_key(pending, &key));
+            return;
+        }
+
+        if let Some(pending) = self.char_pending.take() {
+            set_error_if!(self: self.char_pending_key(pending, &key));
+            return;
+        }
+
+        #[cfg(unix)]
+        if mode == Mode::Insert && self.terminal_key(&key) {
+            return;
+        }
 
         let mut empty = Keymap::default();
         let (_, buf) = get!(self);
@@ -944,7 +1285,8 @@ impl Editor {
                 let (res, buffered) = keymap.on_key(mode, key);
                 match res {
                     TrieResult::Found(f) => f(self),
-                    TrieResult::Partial | TrieResult::Nothing => (),
+                    TrieResult::Partial => self.start_key_timeout(),
+                    TrieResult::Nothing => (),
                 }
 
                 for event in buffered {
@@ -959,13 +1301,8 @@ impl Editor {
                 }
             }
             _ => match keymap.on_key(mode, key).0 {
-                TrieResult::Found(f) => {
-                    f(self);
-                    if mode == Mode::Normal && mode!(self) == Mode::Normal && self.count.is_none() {
-                        self.dot.clear_normal_keys();
-                    }
-                }
-                TrieResult::Partial => (),
+                TrieResult::Found(f) => self.run_action(mode, f),
+                TrieResult::Partial => self.start_key_timeout(),
                 TrieResult::Nothing => {
                     self.count = None;
                     if matches!(mode, Mode::OperatorPending(_) | Mode::ReplacePending) {
@@ -981,12 +1318,86 @@ impl Editor {
         mode!(self)
     }
 
+    pub(crate) fn has_count(&self) -> bool {
+        self.count.is_some()
+    }
+
     pub(crate) fn take_count(&mut self) -> Option<usize> {
         self.count.take()
     }
 
     pub(crate) fn update_count(&mut self, f: impl FnOnce(Option<usize>) -> usize) {
-        self.count = Some(f(self.count));
+        let count = f(self.count);
+        self.count = Some(count);
+        self.dot.save_count(mode!(self), count);
+    }
+
+    /// Use the register named by the next key for the following command.
+    pub fn select_register(&mut self) {
+        self.register_pending = Some(RegisterPending::Select);
+    }
+
+    pub(crate) fn take_register(&mut self) -> Option<char> {
+        self.register.take()
+    }
+
+    /// Start recording a macro into the register named by the next key,
+    /// or stop recording if a macro is already being recorded.
+    pub fn toggle_macro_recording(&mut self) {
+        match self.macros.stop_recording() {
+            Some((register, mut keys)) => {
+                // Drop the `q` that stopped the recording.
+                keys.pop();
+                self.registers.record(register, keys);
+            }
+            None => self.register_pending = Some(RegisterPending::Record),
+        }
+    }
+
+    /// The register a macro is currently being recorded into, if any.
+    pub fn recording_macro(&self) -> Option<char> {
+        self.macros.recording()
+    }
+
+    /// Replay the macro in the register named by the next key.
+    pub fn select_macro(&mut self) {
+        self.register_pending = Some(RegisterPending::Replay);
+    }
+
+    /// Replay the keys in the given register as if they were typed, `count` times.
+    /// `@` replays the last replayed macro.
+    /// The replay is aborted if any key results in an error.
+    pub fn replay_macro(&mut self, register: char) -> Result<()> {
+        let register = match register {
+            '@' => self.macros.last().ok_or_else(|| anyhow!("no previously used macro"))?,
+            _ => register,
+        };
+
+        let n = self.take_count().unwrap_or(1);
+
+        if self.macros.depth() >= Macros::MAX_DEPTH {
+            bail!("macro recursion limit reached")
+        }
+
+        let Some(keys) = self.register(register).and_then(|reg| reg.keys()) else {
+            bail!("register `{register}` does not contain a macro")
+        };
+
+        self.macros.start_replaying(register);
+
+        let mut res = Ok(());
+        'outer: for _ in 0..n {
+            for key in keys.clone() {
+                self.handle_key_event(key);
+                if let Some(err) = self.status_error.take() {
+                    res = Err(anyhow!("macro @{register} aborted: {err}"));
+                    break 'outer;
+                }
+            }
+        }
+
+        self.macros.stop_replaying();
+        res
     }
 
     pub fn visual_anchor(&self) -> Option<Point> {
@@ -1004,16 +1415,77 @@ impl Editor {
             Mode::VisualLine => {
                 Some(visual::Selection::Line { start_line: start.line(), end_line: end.line() })
             }
-            Mode::VisualBlock => Some(visual::Selection::Block {
-                start_line: start.line(),
-                end_line: end.line(),
-                start_col: start.col().min(end.col()),
-                end_col: start.col().max(end.col()),
-            }),
+            Mode::VisualBlock => {
+                let buf = &self[self[view].buffer()];
+                let tab_width = *buf.settings().tab_width.read() as usize;
+                let cells = |point: Point| {
+                    let line = buf.text().line(point.line()).map(|line| line.to_string());
+                    visual::cells(&line.unwrap_or_default(), point.col(), tab_width)
+                };
+                let (anchor, cursor) = (cells(anchor), cells(cursor));
+                let start_col = anchor.start.min(cursor.start);
+                Some(visual::Selection::Block {
+                    start_line: start.line(),
+                    end_line: end.line(),
+                    start_col,
+                    // The cursor may be past the end of an empty line, it still covers a cell.
+                    end_col: anchor.end.max(cursor.end).max(start_col + 1) - 1,
+                    tab_width,
+                })
+            }
             _ => None,
         }
     }
 
+    /// The selections of all the cursors in visual or visual line mode.
+    /// Only the primary cursor has a selection in visual block mode, so this is `None` then.
+    pub fn visual_selections(
+        &self,
+        selector: impl Selector<ViewId>,
+    ) -> Option<visual::MultiSelection> {
+        let anchor = self.state.visual_anchor()?;
+        let linewise = match mode!(self) {
+            Mode::Visual => false,
+            Mode::VisualLine => true,
+            _ => return None,
+        };
+
+        let view = &self[selector.select(self)];
+        Some(visual::MultiSelection::new(
+            linewise,
+            (anchor, view.cursor()),
+            view.secondary_selections(),
+        ))
+    }
+
+    /// Merge the selections of the cursors that overlap after they moved in visual mode.
+    fn merge_visual_selections(&mut self, view: ViewId) {
+        let Some(selections) = self.visual_selections(view) else { return };
+        if selections.len() == self[view].cursors().count() {
+            return;
+        }
+
+        let (anchor, cursor) = selections.primary();
+        if let Some(state) = self.state.visual_state_mut() {
+            state.anchor = anchor;
+        }
+
+        let mode = mode!(self);
+        let area = self.tree.view_area(view);
+        let (view, buf) = get!(self: view);
+        let flags = SetCursorFlags::NO_FORCE_UPDATE_TARGET;
+        if view.cursor() != cursor {
+            view.set_cursor_linewise(mode, area, buf, cursor, flags);
+        }
+        view.set_secondary_selections(
+            mode,
+            area,
+            buf,
+            selections.secondary().iter().copied(),
+            flags,
+        );
+    }
+
     /// Replay the last change (dot repeat)
     pub fn dot_repeat(&mut self) {
         // Collect the events to replay (we can't borrow self.dot while replaying)
@@ -1023,8 +1495,15 @@ impl Editor {
             return;
         }
 
+        // A count given to `.` replaces the count of the change, e.g. `3.` after `2dd` deletes 3 lines.
+        if let Some(count) = self.take_count() {
+            self.dot.replace_count(count);
+        }
+        let count = self.dot.count();
+
         // Mark that we're replaying to prevent recording during the replay
         self.dot.start_replaying();
+        self.count = count;
 
         // Replay each recorded event
         for event in events {
@@ -1050,16 +1529,59 @@ impl Editor {
                     anyhow::bail!("unknown command: {cmd}")
                 }
             }
+            CommandKind::Substitute(sub) => {
+                let lines = match range {
+                    Some(range) => self.command_lines(range)?,
+                    None => {
+                        let cursor_line = self.view(Active).cursor().line();
+                        cursor_line..=cursor_line
+                    }
+                };
+                self.substitute(Active, lines, sub)?;
+            }
+            CommandKind::Shell(command) => {
+                let Some(range) = range else {
+                    anyhow::bail!("expected a range of lines to filter, e.g. `:%!{command}`")
+                };
+                let lines = self.command_lines(range)?;
+                let fut = self.filter_lines(Active, lines, command);
+                self.spawn("filter", fut);
+            }
         }
 
         Ok(())
     }
 
+    /// Resolve the range of a command to the 0-indexed, inclusive lines of the active buffer.
+    pub(crate) fn command_lines(&self, range: &CommandRange) -> Result<RangeInclusive<usize>> {
+        let (view, buf) = get_ref!(self);
+        let text = buf.text();
+        let last_line = text.len_lines().saturating_sub(1);
+        let cursor_line = view.cursor().line();
+        let mark_line = |mark| {
+            self.mark_location(buf.id(), mark)
+                .filter(|loc| loc.buf == buf.id())
+                .map(|loc| loc.point.line())
+        };
+        range.resolve(cursor_line, last_line, mark_line)
+    }
+
     fn execute_buffered_command(&mut self) -> Result<()> {
         let State::Command(state) = &mut self.state else { return Ok(()) };
 
-        if state.buffer.starts_with('/') {
+        if let Some(query) = state.buffer.strip_prefix('/') {
+            let query = query.to_string();
+            let origin = state.search_origin;
+            if !query.is_empty() {
+                self.registers.get_or_insert(Registers::SEARCH).set(RegisterKind::Charwise, &query);
+            }
             self.set_mode(Mode::Normal);
+            if let Some(origin) = origin {
+                self.record_jump(origin);
+            }
+            if !query.is_empty() && self.search_state.matches().is_empty() {
+                bail!("pattern not found: {query}")
+            }
             return Ok(());
         }
 
@@ -1080,7 +1602,20 @@ impl Editor {
         let from = mode!(self);
 
         self.dispatch(event::WillChangeMode { from, to });
+        if to != from {
+            self.set_visual_marks();
+        }
         self.state = State::new(self, to);
+        // Like the primary selection, the selection of each of the other cursors starts at the cursor.
+        if self.state.visual_anchor().is_some() {
+            self.view_mut(Active).reset_secondary_anchors();
+        }
+        // A count typed before an operator or insert belongs to it, any count typed after is separate.
+        match &mut self.state {
+            State::OperatorPending(state) => state.count = self.count.take(),
+            State::Insert(state) => state.count = self.count.take(),
+            _ => {}
+        }
 
         self.dispatch(event::DidChangeMode { from, to });
     }
@@ -1088,6 +1623,9 @@ impl Editor {
     fn insert_to_normal(&mut self) {
         assert_eq!(self.mode(), Mode::Insert);
         let (view, buf) = self.get(Active);
+        set_error_if!(self: self.finish_block_insert(view));
+        self.finish_snippet();
+        set_error_if!(self: self.repeat_insert(view));
 
         {
             // Clear any whitespace at the end of the cursor line when exiting insert mode
@@ -1119,6 +1657,25 @@ impl Editor {
         self.spawn("pull diagnostics", fut);
     }
 
+    /// Insert the text typed since entering insert mode again until it has been inserted `count` times.
+    fn repeat_insert(&mut self, view: ViewId) -> Result<()> {
+        let State::Insert(state) = &self.state else { return Ok(()) };
+        let (Some(n @ 2..), Some(start)) = (state.count, state.start) else { return Ok(()) };
+
+        let cursor = self.cursor_byte(view);
+        // The cursor was moved back before where the typing started, there's nothing sensible to repeat.
+        if cursor <= start {
+            return Ok(());
+        }
+
+        let buf = self[view].buffer();
+        let text = self[buf].text().byte_slice(start..cursor).to_cow().into_owned();
+        let Some(len) = text.len().checked_mul(n - 1) else { bail!("count is too large") };
+        self.edit(buf, &Deltas::insert_at(cursor, text.repeat(n - 1)))?;
+        self.set_cursor_bytewise(view, cursor + len);
+        Ok(())
+    }
+
     #[inline]
     pub fn view(&self, selector: impl Selector<ViewId>) -> &View {
         self.views.get(selector.select(self)).expect("bad view id")
@@ -1189,6 +1746,30 @@ impl Editor {
         self.tree.focus_direction(direction)
     }
 
+    /// Grow the view by `width` columns and `height` lines, negative values shrink it.
+    /// The space is taken from the neighbouring views, no view is made smaller than the minimum size.
+    pub fn resize_view(&mut self, selector: impl Selector<ViewId>, width: i32, height: i32) {
+        let view = selector.select(self);
+        if width != 0 {
+            self.tree.resize_view(view, tui::Direction::Horizontal, width);
+        }
+        if height != 0 {
+            self.tree.resize_view(view, tui::Direction::Vertical, height);
+        }
+        request_redraw();
+    }
+
+    /// Make all the views in each split the same size.
+    pub fn equalize_views(&mut self) {
+        self.tree.equalize();
+        request_redraw();
+    }
+
+    /// The area of the terminal the view is drawn in.
+    pub fn view_area(&self, selector: impl Selector<ViewId>) -> tui::Rect {
+        self.tree.view_area(selector.select(self))
+    }
+
     pub fn repeat_last_insert(&mut self) -> Result<(), EditError> {
         for kev in self.dot.events().to_vec() {
             self.handle_key_event(kev);
@@ -1203,14 +1784,20 @@ impl Editor {
         match &mut self.state {
             State::Command(state) => {
                 state.buffer.pop();
+                state.completion = None;
                 if state.buffer.is_empty() {
-                    self.set_mode(Mode::Normal);
+                    self.cancel_command();
                 }
                 self.update_search();
                 Ok(())
             }
             _ => {
                 let view = selector.select(self);
+                // Deleting a selected snippet placeholder is the whole backspace.
+                if self.take_snippet_placeholder(view)? {
+                    return Ok(());
+                }
+
                 let (view, buf) = get!(self: view);
                 if buf.flags().contains(BufferFlags::READONLY) {
                     return Err(EditError::Readonly);
@@ -1219,13 +1806,31 @@ impl Editor {
                 let cursor = view.cursor();
                 let text = buf.text();
                 let byte_idx = text.point_to_byte(cursor);
-                let Some(c) = text.byte_slice(..byte_idx).chars().next_back() else {
+
+                if view.secondary_cursors().next().is_some() {
+                    let cursors = view.cursors().collect::<Box<[_]>>();
+                    let deltas = Deltas::new(cursors.iter().filter_map(|&point| {
+                        let byte = text.point_to_byte(point);
+                        (byte > 0).then(|| Delta::delete(text.prev_grapheme_boundary(byte)..byte))
+                    }));
+                    let byte = cursor::shift_byte(&deltas, byte_idx);
+                    buf.snapshot_cursors(cursors);
+
+                    let view = view.id();
+                    self.edit(view, &deltas)?;
+                    self.set_cursor_bytewise(view, byte);
+                    self.dispatch(event::DidDeleteChar { view });
                     return Ok(());
-                };
-                let start_byte_idx =
-                    byte_idx.checked_sub(c.len_utf8()).expect("just checked there's a char here");
+                }
+
+                if byte_idx == 0 {
+                    return Ok(());
+                }
+                // Delete the whole grapheme cluster, e.g. both regional indicators of a flag.
+                let start_byte_idx = text.prev_grapheme_boundary(byte_idx);
 
-                buf.edit(&Deltas::delete(start_byte_idx..byte_idx));
+                let deltas = Deltas::delete(start_byte_idx..byte_idx);
+                buf.edit(&deltas);
 
                 view.set_cursor_bytewise(
                     mode!(self),
@@ -1235,7 +1840,8 @@ impl Editor {
                     SetCursorFlags::empty(),
                 );
 
-                let view = view.id();
+                let (view, buf) = (view.id(), buf.id());
+                self.shift_snippet(buf, &deltas);
                 self.dispatch(event::DidDeleteChar { view });
 
                 Ok(())
@@ -1248,24 +1854,53 @@ impl Editor {
         selector: impl Selector<ViewId>,
         c: char,
     ) -> Result<(), EditError> {
+        self.insert_char_flags(selector, c, InsertFlags::empty())
+    }
+
+    fn insert_char_flags(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        c: char,
+        flags: InsertFlags,
+    ) -> Result<(), EditError> {
+        let autoindent = !flags.contains(InsertFlags::NO_AUTOINDENT);
         let mut cbuf = [0; 4];
+        let s = &*c.encode_utf8(&mut cbuf);
         let view = self.view(selector);
-        let cursor = view.cursor();
-
-        let cursor_byte = self[view.buffer()].text().point_to_byte(cursor);
         let view_id = view.id();
-        self.edit(view_id, &Deltas::insert_at(cursor_byte, &*c.encode_utf8(&mut cbuf)))?;
+        let buf = view.buffer();
+
+        let cursors = view.cursors().collect::<Box<[_]>>();
+        let at = view.cursor();
+        let text = self[buf].text();
+        let deltas = Deltas::new(
+            cursors.iter().map(|&point| Delta::insert_at(text.point_to_byte(point), s)),
+        );
+        if cursors.len() > 1 {
+            self[buf].snapshot_cursors(cursors);
+        }
+        self.edit(view_id, &deltas)?;
 
         let (view, buf) = get!(self);
         let area = self.tree.view_area(view_id);
         match c {
             '\n' => {
-                let cursor = view.move_cursor(mode!(self), area, buf, Direction::Down, 1);
-                self.indent_newline(view_id)?;
-                cursor
+                let mode = mode!(self);
+                view.move_cursor(mode, area, buf, Direction::Down, 1);
+                view.for_each_secondary_cursor(|view| {
+                    view.move_cursor(mode, area, buf, Direction::Down, 1);
+                });
+                if autoindent {
+                    self.indent_newline(view_id, at)?;
+                }
             }
-            _ => self.motion(Active, motion::NextChar)?,
-        };
+            _ => {
+                self.motion(Active, motion::NextChar)?;
+                if autoindent {
+                    self.indent_electric_char(view_id, c)?;
+                }
+            }
+        }
 
         self.dispatch(event::DidInsertChar { view: view_id, char: c });
 
@@ -1283,7 +1918,7 @@ impl Editor {
                     if let Some(delta) = state.select_next() {
                         self.apply_completion_delta(delta);
                     }
-                } else {
+                } else if !self.next_tabstop(Active) && !self.expand_snippet_trigger(Active)? {
                     let (view, buf) = self.get(Active);
                     let indent = *self[buf].settings().indent.read();
                     match indent {
@@ -1294,11 +1929,14 @@ impl Editor {
                 }
                 Ok(())
             }
+            State::Command(..) => {
+                self.cycle_command_completion(false);
+                Ok(())
+            }
             // TODO
             State::Visual(..)
             | State::VisualLine(..)
             | State::VisualBlock(..)
-            | State::Command(..)
             | State::OperatorPending(_)
             | State::ReplacePending => Ok(()),
         }
@@ -1316,41 +1954,23 @@ impl Editor {
                         self.apply_completion_delta(delta);
                     }
                 } else {
-                    // TODO
+                    self.prev_tabstop(Active);
                 }
                 Ok(())
             }
+            State::Command(..) => {
+                self.cycle_command_completion(true);
+                Ok(())
+            }
             // TODO
             State::Visual(..)
             | State::VisualLine(..)
             | State::VisualBlock(..)
-            | State::Command(..)
             | State::OperatorPending(_)
             | State::ReplacePending => Ok(()),
         }
     }
 
-    fn indent_newline(&mut self, selector: impl Selector<ViewId>) -> Result<(), EditError> {
-        let (view, buf) = self.get(selector);
-        let text = self[buf].text();
-        let cursor = self[view].cursor();
-        if cursor.col() > 0 || !text.line(cursor.line()).unwrap().is_empty() {
-            // Simple heuristics to determine if we should indent the new line
-            return Ok(());
-        }
-
-        let tab_width = *self[buf].settings().tab_width.read();
-        match zi_indent::indent(zi_indent::Config { tab_width }, text, cursor.line()) {
-            Indent::Bytes(bytes) => {
-                let start_byte = text.line_to_byte(cursor.line());
-                let deltas = Deltas::insert_at(start_byte, " ".repeat(bytes));
-                self.edit(buf, &deltas)?;
-                self.set_cursor(view, cursor.right(bytes));
-                Ok(())
-            }
-        }
-    }
-
     fn get(&self, selector: impl Selector<ViewId>) -> (ViewId, BufferId) {
         let view = selector.select(self);
         let buf = self[view].buffer();
@@ -1440,20 +2060,81 @@ impl Editor {
             self.dispatch(event::DidChangeBuffer { buf, old_text, deltas: newline_deltas });
         }
 
+        // Secondary cursors are shifted by the edit, so we need their byte offsets in the old text.
+        let secondary_cursors = self
+            .views_into_buf(buf)
+            .filter(|&view| self[view].secondary_cursors().next().is_some())
+            .map(|view| {
+                let text = self[buf].text();
+                let bytes = self[view]
+                    .secondary_cursors()
+                    .map(|point| text.point_to_byte(point))
+                    .collect::<Vec<_>>();
+                (view, bytes)
+            })
+            .collect::<Vec<_>>();
+
+        // Cursors of other views are shifted so they stay on the same text when the edit happens above them.
+        // The active view's cursor is left to the caller, as are cursors within the edited range.
+        let active = self.tree.active();
+        let other_cursors = self
+            .views_into_buf(buf)
+            .filter(|&view| view != active)
+            .filter_map(|view| {
+                let byte = self[buf].text().point_to_byte(self[view].cursor());
+                let within = deltas.iter().any(|delta| {
+                    let range = delta.range();
+                    range.start < byte && byte < range.end
+                });
+                (!within).then_some((view, byte))
+            })
+            .collect::<HashMap<_, _>>();
+
         let old_text = dyn_clone::clone_box(self[buf].text());
         self[buf].edit_flags(deltas, flags);
 
+        // Views that aren't visible have folds too.
+        self.views
+            .values_mut()
+            .filter(|view| view.buffer() == buf)
+            .for_each(|view| view.folds_mut().edit(&*old_text, deltas));
+
         // set the cursor again in relevant views as it may be out of bounds after the edit
         for view in self.views_into_buf(buf) {
-            let cursor = self[view].cursor();
+            let cursor = match other_cursors.get(&view) {
+                Some(&byte) => {
+                    let text = self[buf].text();
+                    text.byte_to_point(cursor::shift_byte(deltas, byte).min(text.len_bytes()))
+                }
+                None => self[view].cursor(),
+            };
             self.set_cursor_flags(view, cursor, SetCursorFlags::NO_FORCE_UPDATE_TARGET);
         }
 
+        for (view, bytes) in secondary_cursors {
+            let area = self.tree.view_area(view);
+            let (view, buf) = get!(self: view);
+            let text = buf.text();
+            let points = bytes
+                .into_iter()
+                .map(|byte| {
+                    text.byte_to_point(cursor::shift_byte(deltas, byte).min(text.len_bytes()))
+                })
+                .collect::<Vec<_>>();
+            view.set_secondary_cursors(
+                mode!(self),
+                area,
+                buf,
+                points,
+                SetCursorFlags::NO_FORCE_UPDATE_TARGET,
+            );
+        }
+
         self.dispatch(event::DidChangeBuffer { buf, old_text, deltas: deltas.to_owned() });
         Ok(())
     }
 
-    fn views_into_buf(&self, buf: BufferId) -> impl Iterator<Item = ViewId> + 'static {
+    pub(crate) fn views_into_buf(&self, buf: BufferId) -> impl Iterator<Item = ViewId> + 'static {
         self.tree
             .views()
             .filter(move |&view| self[view].buffer() == buf)
@@ -1466,14 +2147,76 @@ impl Editor {
         event::dispatch(self, event);
     }
 
+    /// Insert the text at the cursor as is, unlike typed characters it isn't auto-indented.
     pub fn insert(&mut self, selector: impl Selector<ViewId>, text: &str) -> Result<(), EditError> {
         let view = selector.select(self);
         for c in text.chars() {
-            self.insert_char(view, c)?;
+            self.insert_char_flags(view, c, InsertFlags::NO_AUTOINDENT)?;
         }
         Ok(())
     }
 
+    /// Insert pasted text literally at each cursor as a single edit (and undo step).
+    /// Unlike typed text this skips the keymap, auto-indentation and completion.
+    /// In command mode the text is appended to the command line instead.
+    pub fn paste(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        content: &str,
+    ) -> Result<(), EditError> {
+        // Terminals send carriage returns for the newlines in pasted text.
+        let content = content.replace("\r\n", "\n").replace('\r', "\n");
+
+        let mode = mode!(self);
+        match &mut self.state {
+            State::Command(state) => {
+                state.buffer.extend(content.chars().filter(|&c| c != '\n'));
+                state.completion = None;
+                self.update_search();
+                return Ok(());
+            }
+            State::Insert(..) | State::Normal(..) => {}
+            _ => return Ok(()),
+        }
+
+        if content.is_empty() {
+            return Ok(());
+        }
+
+        let view = self.view(selector);
+        let view_id = view.id();
+        let buf = view.buffer();
+
+        let cursors = view.cursors().collect::<Box<[_]>>();
+        let text = self[buf].text();
+        let bytes = cursors.iter().map(|&point| text.point_to_byte(point)).collect::<Vec<_>>();
+        let deltas =
+            Deltas::new(bytes.iter().map(|&byte| Delta::insert_at(byte, content.as_str())));
+
+        self[buf].snapshot(SnapshotFlags::empty());
+        if cursors.len() > 1 {
+            self[buf].snapshot_cursors(cursors);
+        }
+        self.edit(view_id, &deltas)?;
+        self[buf].snapshot(SnapshotFlags::empty());
+
+        // `edit` leaves the cursors at the start of their copy of the text, move them past it.
+        let area = self.tree.view_area(view_id);
+        let (view, buf) = get!(self: view_id);
+        let text = buf.text();
+        let mut ends = bytes.iter().map(|&byte| cursor::shift_byte(&deltas, byte) + content.len());
+        let primary = ends.next().expect("there is always a primary cursor");
+        // Normal mode rests on the last pasted character rather than after it.
+        let primary = match mode {
+            Mode::Insert => primary,
+            _ => text.prev_grapheme_boundary(primary),
+        };
+        let points = ends.map(|byte| text.byte_to_point(byte)).collect::<Vec<_>>();
+        view.set_secondary_cursors(mode, area, buf, points, SetCursorFlags::empty());
+        view.set_cursor_bytewise(mode, area, buf, primary, SetCursorFlags::empty());
+        Ok(())
+    }
+
     // This and `cursor_char` won't make sense with visual mode
     // Used for tests for now
     #[doc(hidden)]
@@ -1501,23 +2244,77 @@ impl Editor {
         let Some(sel) = self.visual_selection(selector) else { return };
         let view = selector.select(self);
         let buf = self[view].buffer();
-        let content = sel.content(self[buf].text());
+
+        if operator == Operator::Filter {
+            // Leaving visual mode sets the `'<` and `'>` marks to the selection.
+            self.select_filter_command("'<,'>");
+            return;
+        }
+
+        if matches!(operator, Operator::Comment | Operator::Fold | Operator::Surround) {
+            let ranges = sel.byte_ranges(self[buf].text());
+            let range = ranges[0].start..ranges[ranges.len() - 1].end;
+            if operator == Operator::Fold {
+                self.create_fold(view, range);
+            } else if operator == Operator::Surround {
+                self.select_surround_to_add(range);
+            } else {
+                // Only a charwise selection can be a block comment, the lines of a block selection are commented.
+                let kind = match sel {
+                    visual::Selection::Charwise { .. } => TextObjectKind::Charwise,
+                    _ => TextObjectKind::Linewise,
+                };
+                set_error_if!(self: self.toggle_comment(view, range, kind));
+            }
+            self.set_mode(Mode::Normal);
+            return;
+        }
+
+        // The selections of the other cursors are yanked, deleted or changed along with the primary selection.
+        let multi = self.visual_selections(view).filter(|selections| selections.len() > 1);
+        let content = match &multi {
+            Some(selections) => selections.content(self[buf].text()),
+            None => sel.content(self[buf].text()),
+        };
         let kind = sel.register_kind();
 
-        if let Err(err) = with_clipboard!(self, |cb| cb.set_text(content.clone())) {
-            set_error!(self, err);
+        let register = self.take_register();
+        if Registers::uses_clipboard(register, operator) {
+            if let Err(err) = with_clipboard!(self, |cb| cb.set(&content)) {
+                set_error!(self, err);
+            }
         }
-        self.registers.get_or_insert(Registers::UNNAMED).set(kind, content);
 
-        if matches!(operator, Operator::Delete | Operator::Change) {
+        match operator {
+            Operator::Yank => self.registers.yank(register, kind, content),
+            Operator::Delete | Operator::Change => self.registers.delete(register, kind, content),
+            Operator::Comment | Operator::Fold | Operator::Surround | Operator::Filter => {
+                unreachable!("handled above")
+            }
+        }
+
+        if let (Operator::Delete | Operator::Change, Some(selections)) = (operator, &multi) {
+            set_error_if!(self: self.delete_selections(view, operator, selections));
+        } else if matches!(operator, Operator::Delete | Operator::Change) {
             let byte_ranges = sel.byte_ranges(self[buf].text());
-            let start_point = sel.start_point();
+            let start_point = sel.start_point(self[buf].text());
 
             if operator == Operator::Change {
                 self[buf].snapshot_cursor(start_point);
                 self[buf].snapshot(SnapshotFlags::empty());
             }
 
+            // Changing a block inserts the typed text on every line that had part of the block.
+            let block_lines = match sel {
+                visual::Selection::Block { start_col, tab_width, .. } => {
+                    let text = self[buf].text();
+                    let lines =
+                        byte_ranges.iter().rev().map(|range| text.byte_to_line(range.start));
+                    Some((lines.collect::<Vec<_>>(), start_col, tab_width))
+                }
+                _ => None,
+            };
+
             let is_linewise_change =
                 operator == Operator::Change && matches!(sel, visual::Selection::Line { .. });
             for range in &byte_ranges {
@@ -1532,6 +2329,11 @@ impl Editor {
                 }
             }
 
+            if let (Operator::Change, Some((lines, col, tab_width))) = (operator, block_lines) {
+                set_error_if!(self: self.start_block_insert(view, lines, col, tab_width));
+                return;
+            }
+
             let target_mode =
                 if operator == Operator::Change { Mode::Insert } else { Mode::Normal };
             let (view, buf) = get!(self: view);
@@ -1549,9 +2351,21 @@ impl Editor {
             );
             self.set_mode(target_mode);
         } else {
-            let start_point = sel.start_point();
+            let start_point = sel.start_point(self[buf].text());
             let (view, buf) = get!(self: view);
             let area = self.tree.view_area(view.id());
+            if let Some(selections) = &multi {
+                let text = buf.text();
+                let starts = selections.selections().skip(1).map(|sel| sel.start_point(text));
+                let starts = starts.collect::<Vec<_>>();
+                view.set_secondary_cursors(
+                    Mode::Normal,
+                    area,
+                    buf,
+                    starts,
+                    SetCursorFlags::empty(),
+                );
+            }
             view.set_cursor_bytewise(
                 Mode::Normal,
                 area,
@@ -1575,25 +2389,88 @@ impl Editor {
         self.visual_op(Operator::Change, selector);
     }
 
-    pub fn register(&self, name: char) -> Option<&register::Register> {
-        self.registers.get(name)
+    pub fn visual_comment(&mut self, selector: impl Selector<ViewId> + Copy) {
+        self.visual_op(Operator::Comment, selector);
+    }
+
+    pub fn visual_fold(&mut self, selector: impl Selector<ViewId> + Copy) {
+        self.visual_op(Operator::Fold, selector);
+    }
+
+    pub fn visual_filter(&mut self, selector: impl Selector<ViewId> + Copy) {
+        self.visual_op(Operator::Filter, selector);
+    }
+
+    /// Enter command mode from visual mode, the command applies to the selected lines, `:'<,'>`.
+    pub fn visual_command_mode(&mut self) {
+        self.command_mode_with(":'<,'>".to_string());
+    }
+
+    pub fn visual_surround(&mut self, selector: impl Selector<ViewId> + Copy) {
+        self.visual_op(Operator::Surround, selector);
+    }
+
+    pub fn register(&self, name: char) -> Option<Register> {
+        match name {
+            Registers::FILENAME => {
+                let path = self.buffer(Active).file_path()?;
+                Some(Register::new(RegisterKind::Charwise, path.display().to_string()))
+            }
+            _ => self.registers.get(name).cloned(),
+        }
+    }
+
+    /// Use a different clipboard provider until the `clipboard` setting changes.
+    pub fn set_clipboard(&mut self, provider: impl ClipboardProvider + 'static) {
+        let backend = *self.settings.clipboard.read();
+        self.clipboard = Some((backend, Box::new(provider)));
+    }
+
+    /// Update the clipboard register with the contents of the system clipboard if the provider can read it,
+    /// otherwise the register keeps the text we last copied.
+    fn read_clipboard(&mut self, name: char) {
+        match with_clipboard!(self, |cb| cb.get()) {
+            Ok(Some(text)) => {
+                let reg = self.registers.get_or_insert(name);
+                // Leave the register alone if it still holds what we copied so it keeps its kind.
+                if reg.content != text {
+                    let kind = if text.ends_with('\n') {
+                        RegisterKind::Linewise
+                    } else {
+                        RegisterKind::Charwise
+                    };
+                    reg.set(kind, text);
+                }
+            }
+            Ok(None) => {}
+            Err(err) => set_error!(self, err),
+        }
     }
 
     pub fn paste_after(&mut self, selector: impl Selector<ViewId>) -> Result<(), EditError> {
         // FIXME very naive implementation.
-        let Some(reg) = self.registers.get(Registers::UNNAMED).cloned() else {
+        let name = self.take_register().unwrap_or(Registers::UNNAMED);
+        if Registers::is_clipboard(name) {
+            self.read_clipboard(name);
+        }
+
+        let Some(reg) = self.register(name) else {
             return Ok(());
         };
 
         match reg.kind {
             register::RegisterKind::Charwise => self.insert(selector, &reg.content),
+            register::RegisterKind::Blockwise => self.paste_block(selector, &reg.content),
             register::RegisterKind::Linewise => {
                 let (view, buf) = self.get(selector);
                 let cursor = self[view].cursor();
                 let text = self[buf].text();
                 let line_start_byte = text.line_to_byte(cursor.line() + 1).min(text.len_bytes());
-                let deltas =
-                    Deltas::new([Delta::insert_at(line_start_byte, format!("{}\n", &reg.content))]);
+                let mut content = reg.content;
+                if !content.ends_with('\n') {
+                    content.push('\n');
+                }
+                let deltas = Deltas::new([Delta::insert_at(line_start_byte, content)]);
                 self.edit(buf, &deltas)?;
                 self.move_cursor(view, Direction::Down, 1);
                 Ok(())
@@ -1609,14 +2486,20 @@ impl Editor {
         selector: impl Selector<ViewId>,
         obj: impl TextObject,
     ) -> Result<(), EditError> {
-        let n = self.take_count().unwrap_or(1);
+        // The counts before and after the operator multiply, `2d3w` deletes 6 words.
+        let op_count = match &self.state {
+            State::OperatorPending(state) => state.count,
+            _ => None,
+        };
+        let n = op_count.unwrap_or(1).saturating_mul(self.take_count().unwrap_or(1));
         let obj = obj.repeat(n);
+        let register = self.take_register();
         let (view, buf) = self.get(selector);
 
         // text objects only have meaning in operator pending mode
         let State::OperatorPending(state) = &self.state else { return Ok(()) };
 
-        let &OperatorPendingState { operator } = state;
+        let &OperatorPendingState { operator, .. } = state;
 
         let mut obj_kind = obj.default_kind();
         let flags = obj.flags();
@@ -1636,6 +2519,36 @@ impl Editor {
             return Ok(());
         };
 
+        // None of the special cases below apply to comments, folds, surrounds or filters.
+        match operator {
+            Operator::Comment => {
+                self.set_mode(Mode::Normal);
+                return self.toggle_comment(view, range, obj_kind);
+            }
+            Operator::Fold => {
+                self.set_mode(Mode::Normal);
+                self.create_fold(view, range);
+                return Ok(());
+            }
+            Operator::Surround => {
+                self.set_mode(Mode::Normal);
+                self.select_surround_to_add(range);
+                return Ok(());
+            }
+            Operator::Filter => {
+                // Filters work on whole lines, the end of an exclusive range at the start of a line isn't part of it.
+                let start_line = text.byte_to_line(range.start);
+                let end_line = text.byte_to_line(range.end.saturating_sub(1).max(range.start));
+                self.set_cursor(view, Point::new(start_line, 0));
+                match end_line - start_line {
+                    0 => self.select_filter_command("."),
+                    n => self.select_filter_command(&format!(".,.+{n}")),
+                }
+                return Ok(());
+            }
+            Operator::Delete | Operator::Change | Operator::Yank => {}
+        }
+
         let start_char = text.char_at_byte(range.start);
 
         let start_point = text.byte_to_point(range.start);
@@ -1694,6 +2607,13 @@ impl Editor {
 
         let (deltas, new_cursor) = match operator {
             Operator::Delete | Operator::Change => {
+                let deleted = text.byte_slice(range.clone()).to_cow();
+                if Registers::uses_clipboard(register, operator) {
+                    if let Err(err) = with_clipboard!(self, |cb| cb.set(&deleted)) {
+                        set_error!(self, err);
+                    }
+                }
+                self.registers.delete(register, obj_kind, deleted);
                 let deltas = Deltas::delete(range.clone());
                 let cursor = match obj_kind {
                     // linewise deletions move the line but maintain the column
@@ -1707,12 +2627,17 @@ impl Editor {
             }
             Operator::Yank => {
                 let text = text.byte_slice(range.clone()).to_cow();
-                if let Err(err) = with_clipboard!(self, |cb| cb.set_text(text.clone())) {
-                    set_error!(self, err);
+                if Registers::uses_clipboard(register, operator) {
+                    if let Err(err) = with_clipboard!(self, |cb| cb.set(&text)) {
+                        set_error!(self, err);
+                    }
                 }
-                self.registers.get_or_insert(Registers::UNNAMED).set(obj_kind, text);
+                self.registers.yank(register, obj_kind, text);
                 (Deltas::empty(), None)
             }
+            Operator::Comment | Operator::Fold | Operator::Surround | Operator::Filter => {
+                unreachable!("handled above")
+            }
         };
 
         match operator {
@@ -1725,7 +2650,12 @@ impl Editor {
                 self.set_mode(Mode::Normal);
                 return Ok(());
             }
-            Operator::Yank | Operator::Delete => {}
+            Operator::Yank
+            | Operator::Delete
+            | Operator::Comment
+            | Operator::Fold
+            | Operator::Surround
+            | Operator::Filter => {}
         }
 
         self.edit(view, &deltas)?;
@@ -1748,7 +2678,11 @@ impl Editor {
                 }
                 self.set_mode(Mode::Normal)
             }
-            Operator::Yank => self.set_mode(Mode::Normal),
+            Operator::Yank
+            | Operator::Comment
+            | Operator::Fold
+            | Operator::Surround
+            | Operator::Filter => self.set_mode(Mode::Normal),
         }
 
         if let Some(new_cursor) = new_cursor {
@@ -1781,7 +2715,12 @@ impl Editor {
         }
 
         match operator {
-            Operator::Delete | Operator::Change => {}
+            Operator::Delete
+            | Operator::Change
+            | Operator::Comment
+            | Operator::Fold
+            | Operator::Surround
+            | Operator::Filter => {}
             Operator::Yank => self.dispatch(event::DidYankText { buf, range }),
         }
 
@@ -1793,42 +2732,44 @@ impl Editor {
         selector: impl Selector<ViewId>,
         motion: impl Motion,
     ) -> Result<Point, EditError> {
-        let motion = motion.repeat(self.take_count().unwrap_or(1));
         let view = selector.select(self);
-        let (view, buf) = get!(self: view);
-        let view_id = view.id();
-        match mode!(self) {
-            Mode::OperatorPending(_) => {
-                self.text_object(view_id, motion)?;
-                Ok(self[view_id].cursor())
-            }
-            _ => {
-                self.search_state.hlsearch = false;
+        if let Mode::OperatorPending(_) = mode!(self) {
+            // The text object applies the count, multiplied by the count given before the operator.
+            self.text_object(view, motion)?;
+            return Ok(self[view].cursor());
+        }
 
-                let text = buf.text();
-                let area = self.tree.view_area(view.id());
-                let motion_flags = motion.motion_flags();
+        let motion = motion.repeat(self.take_count().unwrap_or(1));
+        let (view, buf) = get!(self: view);
+        self.search_state.hlsearch = false;
 
-                let mut flags = SetCursorFlags::empty();
-                if motion_flags.contains(MotionFlags::NO_FORCE_UPDATE_TARGET) {
-                    flags |= SetCursorFlags::NO_FORCE_UPDATE_TARGET;
-                }
+        let text = buf.text();
+        let area = self.tree.view_area(view.id());
+        let motion_flags = motion.motion_flags();
 
-                if motion_flags.contains(MotionFlags::USE_TARGET_COLUMN) {
-                    flags |= SetCursorFlags::USE_TARGET_COLUMN;
-                }
+        let mut flags = SetCursorFlags::empty();
+        if motion_flags.contains(MotionFlags::NO_FORCE_UPDATE_TARGET) {
+            flags |= SetCursorFlags::NO_FORCE_UPDATE_TARGET;
+        }
 
-                let point = match motion.motion(text, view.cursor().into()) {
-                    PointOrByte::Point(point) => {
-                        view.set_cursor_linewise(mode!(self), area, buf, point, flags)
-                    }
-                    PointOrByte::Byte(byte) => {
-                        view.set_cursor_bytewise(mode!(self), area, buf, byte, flags)
-                    }
-                };
-                Ok(point)
-            }
+        if motion_flags.contains(MotionFlags::USE_TARGET_COLUMN) {
+            flags |= SetCursorFlags::USE_TARGET_COLUMN;
         }
+
+        let mode = mode!(self);
+        let apply = |view: &mut View| match motion.motion(text, view.cursor().into()) {
+            PointOrByte::Point(point) => view.set_cursor_linewise(mode, area, buf, point, flags),
+            PointOrByte::Byte(byte) => view.set_cursor_bytewise(mode, area, buf, byte, flags),
+        };
+
+        apply(view);
+        view.for_each_secondary_cursor(|view| {
+            apply(view);
+        });
+
+        let view = view.id();
+        self.merge_visual_selections(view);
+        Ok(self[view].cursor())
     }
 
     pub fn redo(&mut self, selector: impl Selector<BufferId>) -> Result<bool, EditError> {
@@ -1839,6 +2780,58 @@ impl Editor {
         self.undoredo(selector, true)
     }
 
+    /// Go back `count` revisions in time, unlike `undo` this may move to another branch of the undo tree.
+    pub fn undo_earlier(
+        &mut self,
+        selector: impl Selector<BufferId>,
+        count: usize,
+    ) -> Result<bool, EditError> {
+        let buf = selector.select(self);
+        let steps = self[buf].earlier(count);
+        self.apply_undo_steps(buf, steps)
+    }
+
+    /// Go forward `count` revisions in time, unlike `redo` this may move to another branch of the undo tree.
+    pub fn undo_later(
+        &mut self,
+        selector: impl Selector<BufferId>,
+        count: usize,
+    ) -> Result<bool, EditError> {
+        let buf = selector.select(self);
+        let steps = self[buf].later(count);
+        self.apply_undo_steps(buf, steps)
+    }
+
+    /// A textual representation of the undo tree of the buffer for debugging.
+    pub fn undo_tree(&mut self, selector: impl Selector<BufferId>) -> Option<String> {
+        self.buffer_mut(selector).undo_tree()
+    }
+
+    /// Open a split displaying the undo tree of the buffer.
+    pub fn open_undo_tree(&mut self, selector: impl Selector<ViewId>) {
+        let view = self.view(selector).id();
+        let buf = self[view].buffer();
+        let tree = self.undo_tree(buf).unwrap_or_default();
+        self.split(view, Direction::Up, tui::Constraint::Percentage(50));
+        let tree_buf = self.create_readonly_buffer("undotree", tree.into_bytes());
+        self.set_buffer(view, tree_buf);
+    }
+
+    fn apply_undo_steps(
+        &mut self,
+        buf: BufferId,
+        steps: Vec<UndoStep<UndoEntry>>,
+    ) -> Result<bool, EditError> {
+        let mut changed = false;
+        for step in steps {
+            changed |= match step {
+                UndoStep::Undo(entry) => self.apply_undo_entry(buf, entry, true)?,
+                UndoStep::Redo(entry) => self.apply_undo_entry(buf, entry, false)?,
+            };
+        }
+        Ok(changed)
+    }
+
     fn undoredo(
         &mut self,
         selector: impl Selector<BufferId>,
@@ -1849,6 +2842,15 @@ impl Editor {
             return Ok(false);
         };
 
+        self.apply_undo_entry(buf, entry, undo)
+    }
+
+    fn apply_undo_entry(
+        &mut self,
+        buf: BufferId,
+        entry: UndoEntry,
+        undo: bool,
+    ) -> Result<bool, EditError> {
         if undo {
             for change in entry.changes.iter().rev() {
                 self.edit_flags(
@@ -1867,7 +2869,13 @@ impl Editor {
             }
         }
 
-        let cursor = match (entry.cursor, entry.changes.first()) {
+        // Restore all the cursors if the change was made with multiple cursors.
+        let (cursor, secondary_cursors) = match entry.cursors.as_deref() {
+            Some([primary, secondary @ ..]) => (Some(*primary), secondary),
+            _ => (entry.cursor, &[][..]),
+        };
+
+        let cursor = match (cursor, entry.changes.first()) {
             (Some(cursor), _) => cursor.into(),
             (_, Some(fst)) => match fst.deltas.iter().next() {
                 Some(delta) => delta.range().start.into(),
@@ -1887,6 +2895,16 @@ impl Editor {
                     view.set_cursor_bytewise(mode!(self), area, buf, byte, SetCursorFlags::empty())
                 }
             };
+
+            if !secondary_cursors.is_empty() {
+                view.set_secondary_cursors(
+                    mode!(self),
+                    area,
+                    buf,
+                    secondary_cursors.iter().copied(),
+                    SetCursorFlags::empty(),
+                );
+            }
         }
 
         Ok(true)
@@ -1938,30 +2956,88 @@ impl Editor {
             event::dispatch_async(&client, event::WillSaveBuffer { buf }).await?;
 
             // Need to refetch flags as the hooks may have updated them
-            let (flags, text) = client
+            let (flags, text, encoding, file_format) = client
                 .with(move |editor| {
                     let buf = &editor[buf];
-                    (buf.flags(), dyn_clone::clone_box(buf.text()))
+                    let settings = buf.settings();
+                    let (encoding, file_format) =
+                        (*settings.encoding.read(), *settings.file_format.read());
+                    (buf.flags(), dyn_clone::clone_box(buf.text()), encoding, file_format)
                 })
                 .await;
 
-            if !flags.contains(BufferFlags::DIRTY) && !save_flags.contains(SaveFlags::FORCE) {
+            // Writing a file with mixed line endings normalizes them, so it's worth doing even if it's not dirty.
+            if !flags.intersects(BufferFlags::DIRTY | BufferFlags::MIXED_LINE_ENDINGS)
+                && !save_flags.contains(SaveFlags::FORCE)
+            {
                 tracing::info!("buffer is not dirty, skipping write");
                 return Ok(());
             }
 
-            use tokio_util::compat::FuturesAsyncReadCompatExt;
-            let mut file = tokio::fs::File::create(path).await?;
-            let mut reader = futures_util::io::AllowStdIo::new(text.reader()).compat();
-            let mut writer = tokio::io::BufWriter::new(&mut file);
-            tokio::io::copy(&mut reader, &mut writer).await?;
-            writer.flush().await?;
-            file.flush().await?;
+            // Utf-8 with unix line endings is the buffer's own format and is streamed as is, anything else is
+            // converted up front so the file is left alone if the text can't be encoded.
+            let encoded = match (encoding, file_format) {
+                (Encoding::Utf8, FileFormat::Unix) => None,
+                _ => {
+                    let text = file_format.denormalize(&text.to_string()).into_owned();
+                    Some(encoding.encode(&text)?.into_owned())
+                }
+            };
+
+            // A large file is still mapped by the buffer so it can't be truncated. The text is streamed to a
+            // temporary file instead which then replaces it, the mapping keeps the old file alive.
+            let large = flags.contains(BufferFlags::LARGE);
+            let target = match large {
+                false => path.clone(),
+                true => path.with_file_name(format!(
+                    ".{}.zi-save",
+                    path.file_name().unwrap_or_default().to_string_lossy()
+                )),
+            };
+
+            // Like vim, a file without write permission is only written with `!`, even by a user who could.
+            let readonly = tokio::fs::metadata(&path)
+                .await
+                .is_ok_and(|metadata| metadata.permissions().readonly());
+            let written = match readonly && !save_flags.contains(SaveFlags::FORCE) {
+                true => Err(io::Error::new(
+                    io::ErrorKind::PermissionDenied,
+                    format!("`{}` is readonly (add ! to override)", path.display()),
+                )),
+                false => write_file(&target, &*text, encoded.as_deref()).await,
+            };
+
+            match written {
+                // Only a write that was denied permission is retried, anything else would fail the same way.
+                // A large file is replaced by a temporary file rather than written in place, so it isn't retried.
+                Err(err)
+                    if err.kind() == io::ErrorKind::PermissionDenied
+                        && save_flags.contains(SaveFlags::SUDO)
+                        && !large =>
+                {
+                    let program = client
+                        .with(|editor| editor.settings().sudo_write_program.read().clone())
+                        .await;
+                    sudo::write_file(&program, &path, &*text, encoded.as_deref()).await?;
+                }
+                written => written?,
+            }
+
+            if large {
+                if let Ok(metadata) = tokio::fs::metadata(&path).await {
+                    tokio::fs::set_permissions(&target, metadata.permissions()).await?;
+                }
+                tokio::fs::rename(&target, &path).await?;
+            }
 
             tracing::info!("buffer written to disk");
 
             client
                 .with(move |editor| {
+                    if flags.contains(BufferFlags::MIXED_LINE_ENDINGS) {
+                        editor.status_message =
+                            Some(format!("mixed line endings were written as `{file_format}`"));
+                    }
                     editor[buf].flushed();
                     editor.dispatch(event::DidSaveBuffer { buf });
                 })
@@ -1978,6 +3054,9 @@ impl Editor {
         }
 
         self.dispatch(event::DidCloseView { view });
+        if self.views[view].group().is_none() {
+            self.save_position(view);
+        }
 
         // TODO work on a scheme to cleanup views and buffers automatically
         self.close_buffer(self.views[view].buffer());
@@ -2042,8 +3121,6 @@ impl Editor {
         path: impl AsRef<Path>,
         s: impl Deref<Target = [u8]> + Send + Sync + 'static,
     ) -> BufferId {
-        let theme = self.theme();
-        let theme = theme.read();
         self.buffers.insert_with_key(|id| {
             Buffer::new(TextBuffer::new(
                 id,
@@ -2051,7 +3128,6 @@ impl Editor {
                 filetype!(text),
                 path,
                 ReadonlyText::new(s),
-                &theme,
                 None,
             ))
         })
@@ -2087,6 +3163,14 @@ impl Editor {
         self.goto(to);
     }
 
+    /// Record a jump from `from` if the cursor has since moved away from it,
+    /// for motions that have already moved the cursor.
+    pub(crate) fn record_jump(&mut self, from: Location) {
+        if from != self.current_location() {
+            self.view_mut(Active).jump_list_mut().push(from);
+        }
+    }
+
     pub(crate) fn goto(&mut self, Location { buf, point }: Location) {
         // FIXME what if buffer is gone
         self.set_buffer(Active, buf);
@@ -2103,16 +3187,35 @@ impl Editor {
     }
 
     pub(crate) fn search_mode(&mut self) {
+        let origin = self.current_location();
         self.set_mode(Mode::Command);
         match &mut self.state {
             State::Command(state) => {
                 state.buffer.clear();
                 state.buffer.push('/');
+                state.search_origin = Some(origin);
             }
             _ => unreachable!(),
         }
     }
 
+    /// Leave command mode without executing the command.
+    /// A cancelled search returns the cursor to where the search started.
+    pub(crate) fn cancel_command(&mut self) {
+        let origin = match &self.state {
+            State::Command(state) => state.search_origin,
+            _ => None,
+        };
+
+        self.set_mode(Mode::Normal);
+        if let Some(origin) = origin {
+            self.search_state.hlsearch = false;
+            if origin.buf == self.buffer(Active).id() {
+                self.set_cursor(Active, origin.point);
+            }
+        }
+    }
+
     pub fn jump_forward(&mut self, selector: impl Selector<ViewId>) -> Option<Location> {
         let loc = self.view_mut(selector).jump_list_mut().next().copied()?;
         self.goto(loc);
@@ -2126,8 +3229,13 @@ impl Editor {
         Some(loc)
     }
 
-    fn goto_match(&mut self, f: impl FnOnce(&mut SearchState) -> Option<&Match>) -> Option<Match> {
+    fn goto_match(
+        &mut self,
+        f: impl FnOnce(&mut SearchState) -> Option<&Match>,
+        wrapped_message: &str,
+    ) -> Option<Match> {
         self.update_search();
+        self.search_state.take_wrapped();
 
         // reselect the current match if the search is not active
         let mat = if self.search_state.hlsearch {
@@ -2137,17 +3245,27 @@ impl Editor {
         }?
         .clone();
 
+        if self.search_state.take_wrapped() {
+            self.status_message = Some(wrapped_message.to_string());
+        }
+
         self.search_state.hlsearch = true;
         self.reveal(Active, mat.range().start, VerticalAlignment::Center);
         Some(mat)
     }
 
     pub fn goto_next_match(&mut self) -> Option<Match> {
-        self.goto_match(|s| s.next_match())
+        let from = self.current_location();
+        let mat = self.goto_match(|s| s.next_match(), "search hit BOTTOM, continuing at TOP");
+        self.record_jump(from);
+        mat
     }
 
     pub fn goto_prev_match(&mut self) -> Option<Match> {
-        self.goto_match(|s| s.prev_match())
+        let from = self.current_location();
+        let mat = self.goto_match(|s| s.prev_match(), "search hit TOP, continuing at BOTTOM");
+        self.record_jump(from);
+        mat
     }
 
     // Bit odd for a method with this name to require a mutable reference.
@@ -2203,44 +3321,6 @@ impl Editor {
     }
 }
 
-async fn rope_from_reader(reader: impl tokio::io::AsyncRead + Unpin) -> io::Result<Rope> {
-    let mut reader = tokio::io::BufReader::new(reader);
-    let mut builder = RopeBuilder::new();
-
-    // Handle utf-8 byte order mark.
-    // Not supporting other encodings for now.
-    let buf = reader.fill_buf().await?;
-    if let [0xEF, 0xBB, 0xBF, ..] = buf {
-        // Skip the BOM before decoding. This means we won't preserve it on save but we don't care.
-        reader.consume(3)
-    };
-
-    loop {
-        let buf = reader.fill_buf().await?;
-        if buf.is_empty() {
-            break;
-        }
-
-        let s = match std::str::from_utf8(buf) {
-            Ok(s) => s,
-            Err(err) => {
-                let n = err.valid_up_to();
-                if n == 0 {
-                    return Err(io::Error::new(io::ErrorKind::InvalidData, err));
-                }
-                unsafe { std::str::from_utf8_unchecked(&buf[..n]) }
-            }
-        };
-
-        builder.append(s);
-
-        let n = s.len();
-        reader.consume(n);
-    }
-
-    Ok(builder.build())
-}
-
 pub trait Selector<T> {
     fn select(&self, editor: &Editor) -> T;
 }
@@ -2271,6 +3351,22 @@ impl Selector<BufferId> for Active {
     }
 }
 
+/// Write the text to the file, `encoded` is the text already encoded if it isn't written as is.
+async fn write_file(path: &Path, text: &dyn AnyText, encoded: Option<&[u8]>) -> io::Result<()> {
+    use tokio_util::compat::FuturesAsyncReadCompatExt;
+    let mut file = tokio::fs::File::create(path).await?;
+    let mut writer = tokio::io::BufWriter::new(&mut file);
+    match encoded {
+        Some(bytes) => writer.write_all(bytes).await?,
+        None => {
+            let mut reader = futures_util::io::AllowStdIo::new(text.reader()).compat();
+            tokio::io::copy(&mut reader, &mut writer).await?;
+        }
+    }
+    writer.flush().await?;
+    file.flush().await
+}
+
 fn callback<R: Send + 'static>(
     tx: &CallbacksSender,
     desc: impl fmt::Display + Send + 'static,
@@ -0,0 +1,143 @@
+//! Insert mode abbreviations, a word typed followed by a non-keyword character is replaced by its expansion,
+//! e.g. `teh ` becomes `the `. They are added with `:iabbrev` or loaded from the `[abbreviations]` table of
+//! `config.toml`.
+//!
+//! ```toml
+//! [abbreviations]
+//! teh = "the"
+//!
+//! # Only expanded in rust buffers, these take precedence over the abbreviations for every file type.
+//! [abbreviations.rust]
+//! dbg = "dbg!()"
+//! ```
+
+use std::collections::HashMap;
+
+use anyhow::bail;
+use zi_text::{Deltas, Text as _, TextSlice as _};
+
+use super::state::State;
+use super::{Result, Selector};
+use crate::{EditError, Editor, FileType, ViewId};
+
+#[derive(Debug, Default)]
+pub(super) struct Abbreviations {
+    /// The abbreviations expanded in every buffer by their trigger.
+    global: HashMap<String, String>,
+    by_ft: HashMap<FileType, HashMap<String, String>>,
+}
+
+impl Abbreviations {
+    /// Parse the `[abbreviations]` table of the config, a missing table has no abbreviations.
+    pub fn parse(src: &str) -> Result<Self> {
+        let config = toml::from_str::<toml::Table>(src)?;
+        let mut abbreviations = Self::default();
+        let Some(table) = config.get("abbreviations") else { return Ok(abbreviations) };
+        let Some(table) = table.as_table() else { bail!("`abbreviations` must be a table") };
+
+        for (key, value) in table {
+            match value {
+                toml::Value::String(expansion) => {
+                    check_trigger(key)?;
+                    abbreviations.global.insert(key.clone(), expansion.clone());
+                }
+                toml::Value::Table(table) => {
+                    let by_ft = abbreviations.by_ft.entry(FileType::from_name(key)).or_default();
+                    for (trigger, expansion) in table {
+                        let Some(expansion) = expansion.as_str() else {
+                            bail!("`abbreviations.{key}.{trigger}` must be a string")
+                        };
+                        check_trigger(trigger)?;
+                        by_ft.insert(trigger.clone(), expansion.to_string());
+                    }
+                }
+                _ => bail!("`abbreviations.{key}` must be a string or a table of abbreviations"),
+            }
+        }
+
+        Ok(abbreviations)
+    }
+
+    fn get(&self, ft: FileType, trigger: &str) -> Option<&str> {
+        self.by_ft
+            .get(&ft)
+            .and_then(|abbreviations| abbreviations.get(trigger))
+            .or_else(|| self.global.get(trigger))
+            .map(String::as_str)
+    }
+}
+
+/// The characters of a word, typing any other character after an abbreviation expands it.
+fn is_keyword(c: char) -> bool {
+    c.is_alphanumeric() || c == '_'
+}
+
+/// A trigger is a single word, otherwise it could never be typed as a whole word.
+fn check_trigger(trigger: &str) -> Result<()> {
+    if trigger.is_empty() || !trigger.chars().all(is_keyword) {
+        bail!("invalid abbreviation `{trigger}`, it must be a single word");
+    }
+    Ok(())
+}
+
+impl Editor {
+    /// Add an insert mode abbreviation, `:iabbrev {trigger} {expansion}`.
+    /// Without a file type it's expanded in every buffer, otherwise only in buffers of the file type.
+    pub fn add_abbreviation(
+        &mut self,
+        ft: Option<FileType>,
+        trigger: &str,
+        expansion: &str,
+    ) -> Result<()> {
+        check_trigger(trigger)?;
+        let abbreviations = match ft {
+            Some(ft) => self.abbreviations.by_ft.entry(ft).or_default(),
+            None => &mut self.abbreviations.global,
+        };
+        abbreviations.insert(trigger.to_string(), expansion.to_string());
+        Ok(())
+    }
+
+    /// Replace the abbreviation before the cursor with its expansion if `c` is about to be typed after it.
+    /// Like vim, only a whole word typed in this insert expands, so neither the end of a longer word
+    /// nor text that was already there does.
+    pub(super) fn expand_abbreviation(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        c: char,
+    ) -> Result<(), EditError> {
+        let State::Insert(state) = &self.state else { return Ok(()) };
+        let Some(insert_start) = state.start else { return Ok(()) };
+        let view = selector.select(self);
+        // The expansion only replaces the word before the primary cursor.
+        if is_keyword(c) || self[view].secondary_cursors().next().is_some() {
+            return Ok(());
+        }
+
+        let buf = self[view].buffer();
+        let end = self.cursor_byte(view);
+        let text = self[buf].text();
+        let line_start = text.line_to_byte(text.byte_to_line(end));
+        let before = text.byte_slice(line_start..end).to_cow();
+        let Some(word_start) =
+            before.char_indices().rev().take_while(|&(_, c)| is_keyword(c)).last().map(|(i, _)| i)
+        else {
+            return Ok(());
+        };
+
+        let start = line_start + word_start;
+        if start < insert_start {
+            return Ok(());
+        }
+
+        let Some(expansion) = self.abbreviations.get(self[buf].file_type(), &before[word_start..])
+        else {
+            return Ok(());
+        };
+
+        let expansion = expansion.to_string();
+        self.edit(buf, &Deltas::single(start..end, expansion.clone()))?;
+        self.set_cursor(view, start + expansion.len());
+        Ok(())
+    }
+}
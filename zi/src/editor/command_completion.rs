@@ -0,0 +1,209 @@
+use std::path::Path;
+use std::{env, fs, iter};
+
+use super::State;
+use crate::Editor;
+use crate::buffer::Buffer;
+use crate::command::{self, ArgCompletion};
+
+/// Cycling through the completions of the last word in the command line with `<Tab>` and `<S-Tab>`.
+#[derive(Debug)]
+pub(super) struct CommandCompletion {
+    /// The command line as it was typed.
+    original: String,
+    /// Where the word being completed starts in the command line.
+    start: usize,
+    candidates: Vec<String>,
+    /// `None` while the command line shows the original text, which sits between the last and the first candidate.
+    selected: Option<usize>,
+}
+
+impl CommandCompletion {
+    pub(super) fn start(&self) -> usize {
+        self.start
+    }
+
+    pub(super) fn candidates(&self) -> &[String] {
+        &self.candidates
+    }
+
+    pub(super) fn selected(&self) -> Option<usize> {
+        self.selected
+    }
+
+    fn step(&mut self, backwards: bool) {
+        let n = self.candidates.len();
+        self.selected = match (self.selected, backwards) {
+            (None, false) => Some(0),
+            (None, true) => Some(n - 1),
+            (Some(i), false) => (i + 1 < n).then_some(i + 1),
+            (Some(i), true) => i.checked_sub(1),
+        };
+    }
+
+    fn line(&self) -> String {
+        match self.selected {
+            Some(i) => format!("{}{}", &self.original[..self.start], self.candidates[i]),
+            None => self.original.clone(),
+        }
+    }
+}
+
+/// How a buffer is named in the command line, its path relative to the current directory.
+pub(super) fn buffer_name(buf: &Buffer) -> Option<String> {
+    let path = buf.file_path()?;
+    let cwd = env::current_dir().ok();
+    let relative = cwd.as_deref().and_then(|cwd| path.strip_prefix(cwd).ok()).unwrap_or(&path);
+    Some(relative.display().to_string())
+}
+
+fn complete_path(word: &str) -> Vec<String> {
+    let (dir, prefix) = match word.rfind('/') {
+        Some(i) => word.split_at(i + 1),
+        None => ("", word),
+    };
+
+    let Ok(entries) = fs::read_dir(if dir.is_empty() { Path::new(".") } else { Path::new(dir) })
+    else {
+        return vec![];
+    };
+
+    let mut candidates = entries
+        .filter_map(Result::ok)
+        .filter_map(|entry| {
+            let name = entry.file_name().into_string().ok()?;
+            // Hidden files are only completed once the `.` is typed.
+            if !name.starts_with(prefix) || (name.starts_with('.') && !prefix.starts_with('.')) {
+                return None;
+            }
+
+            let sep = if entry.path().is_dir() { "/" } else { "" };
+            Some(format!("{dir}{name}{sep}"))
+        })
+        .collect::<Vec<_>>();
+    candidates.sort();
+    candidates
+}
+
+fn complete_words<'a>(words: impl IntoIterator<Item = &'a str>, word: &str) -> Vec<String> {
+    words.into_iter().filter(|w| w.starts_with(word)).map(String::from).collect()
+}
+
+impl Editor {
+    /// The completions of the last word of a partial command (without the leading `:`).
+    /// Returns the byte offset in `input` of the word the candidates replace and the candidates.
+    /// Command names complete to their canonical name even when an alias is typed, e.g. `vs` to `vsplit`.
+    pub fn command_completions(&self, input: &str) -> (usize, Vec<String>) {
+        let start = input
+            .char_indices()
+            .rfind(|(_, c)| c.is_whitespace())
+            .map_or(0, |(i, c)| i + c.len_utf8());
+        let word = &input[start..];
+
+        let mut words = input[..start].split_whitespace();
+        let Some(cmd) = words.next() else { return (start, self.complete_command_name(word)) };
+        let preceding = words.collect::<Vec<_>>();
+
+        let Some(handler) = self.command_handlers.get(cmd.trim_end_matches('!')) else {
+            return (start, vec![]);
+        };
+
+        if preceding.len() >= handler.arity().max as usize {
+            return (start, vec![]);
+        }
+
+        let candidates = match handler.completion() {
+            ArgCompletion::None => vec![],
+            ArgCompletion::Path => complete_path(word),
+            ArgCompletion::Buffer => {
+                let mut names = self
+                    .buffers
+                    .values()
+                    .filter_map(buffer_name)
+                    .filter(|name| name.contains(word))
+                    .collect::<Vec<_>>();
+                names.sort();
+                names
+            }
+            ArgCompletion::Setting => match preceding[..] {
+                [] => command::SETTINGS
+                    .iter()
+                    .filter(|(name, aliases)| {
+                        iter::once(name).chain(aliases.iter()).any(|name| name.starts_with(word))
+                    })
+                    .map(|(name, _)| name.to_string())
+                    .collect(),
+                [setting] => complete_words(command::setting_values(setting).iter().copied(), word),
+                _ => vec![],
+            },
+            ArgCompletion::Theme => {
+                let names = super::theme::theme_names();
+                complete_words(iter::once("default").chain(names.iter().map(String::as_str)), word)
+            }
+            ArgCompletion::Words(words) => complete_words(words.iter().copied(), word),
+        };
+
+        (start, candidates)
+    }
+
+    fn complete_command_name(&self, word: &str) -> Vec<String> {
+        let mut names = self
+            .command_handlers
+            .values()
+            .filter(|handler| {
+                iter::once(handler.name())
+                    .chain(handler.aliases().iter().cloned())
+                    .any(|name| name.starts_with(word))
+            })
+            .map(|handler| handler.name().to_string())
+            .collect::<Vec<_>>();
+        names.sort();
+        names.dedup();
+        names
+    }
+
+    /// Complete the last word in the command line, or move on to the next (or previous) candidate.
+    /// A lone candidate is accepted immediately.
+    pub(super) fn cycle_command_completion(&mut self, backwards: bool) {
+        let State::Command(state) = &self.state else { return };
+        if state.completion.is_none() {
+            // Searches don't complete.
+            let Some(input) = state.buffer.strip_prefix(':') else { return };
+            let input = input.to_string();
+            let (start, candidates) = self.command_completions(&input);
+
+            let State::Command(state) = &mut self.state else { unreachable!() };
+            match &candidates[..] {
+                [] => return,
+                [candidate] => {
+                    state.buffer = format!(":{}{candidate}", &input[..start]);
+                    // Leave a space to carry on with the arguments of the command.
+                    let is_command_name = input[..start].trim().is_empty();
+                    if is_command_name
+                        && self
+                            .command_handlers
+                            .get(candidate.as_str())
+                            .is_some_and(|h| h.arity().max > 0)
+                    {
+                        state.buffer.push(' ');
+                    }
+                    return;
+                }
+                _ => {
+                    state.completion = Some(CommandCompletion {
+                        original: state.buffer.clone(),
+                        // Account for the `:`.
+                        start: start + 1,
+                        candidates,
+                        selected: None,
+                    })
+                }
+            }
+        }
+
+        let State::Command(state) = &mut self.state else { unreachable!() };
+        let completion = state.completion.as_mut().expect("just checked");
+        completion.step(backwards);
+        state.buffer = completion.line();
+    }
+}
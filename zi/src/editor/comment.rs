@@ -0,0 +1,143 @@
+use std::ops::Range;
+
+use zi_text::{AnyText, Delta, Deltas, Text as _, TextSlice as _};
+use zi_textobject::TextObjectKind;
+
+use super::{EditError, Selector, cursor};
+use crate::buffer::SnapshotFlags;
+use crate::{CommentTokens, Editor, ViewId};
+
+impl Editor {
+    /// Comment out the range, or uncomment it if it is already commented.
+    /// Each line is commented with a line comment unless the range is charwise and the language has block comments,
+    /// in which case the range is wrapped in a block comment.
+    pub(super) fn toggle_comment(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        range: Range<usize>,
+        kind: TextObjectKind,
+    ) -> Result<(), EditError> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let file_type = self[buf].file_type();
+        let text = self[buf].text();
+
+        let deltas = match (kind, file_type.comment_tokens()) {
+            (TextObjectKind::Charwise, CommentTokens { block: Some((open, close)), .. }) => {
+                toggle_block(text, range.clone(), open, close)
+            }
+            (_, CommentTokens { line: Some(token), .. }) => {
+                toggle_lines(text, range.clone(), token, "")
+            }
+            // Without line comments, each line gets its own block comment.
+            (_, CommentTokens { block: Some((open, close)), .. }) => {
+                toggle_lines(text, range.clone(), open, close)
+            }
+            (_, CommentTokens { line: None, block: None }) => {
+                self.set_error(format!("no comment syntax for filetype `{file_type}`"));
+                return Ok(());
+            }
+        };
+
+        if deltas.is_empty() {
+            return Ok(());
+        }
+
+        // The cursor moves to the first line of the range, as with the other operators.
+        let cursor = text.point_to_byte(self[view].cursor());
+        let cursor = if text.byte_to_line(cursor) == text.byte_to_line(range.start) {
+            cursor
+        } else {
+            range.start
+        };
+
+        self.edit(view, &deltas)?;
+        self[buf].snapshot(SnapshotFlags::empty());
+        self.set_cursor(view, cursor::shift_byte(&deltas, cursor));
+        Ok(())
+    }
+}
+
+/// Toggle a comment on each line of the range, leaving blank lines alone.
+/// The range is uncommented if every line is already commented.
+/// The comment goes after the indentation of each line, so mixed indentation is preserved.
+/// `close` is empty unless block comments are standing in for line comments.
+fn toggle_lines(
+    text: &dyn AnyText,
+    range: Range<usize>,
+    open: &str,
+    close: &str,
+) -> Deltas<'static> {
+    let start_line = text.byte_to_line(range.start);
+    // The range is exclusive, so a range ending at the start of a line doesn't include that line.
+    let end_line = text.byte_to_line(range.end.saturating_sub(1).max(range.start));
+
+    // The byte each line starts at, the length of its indentation, and the line itself.
+    let lines = (start_line..=end_line)
+        .filter_map(|line_idx| {
+            let line = text.line(line_idx)?.to_cow();
+            let indent = line.len() - line.trim_start().len();
+            (indent < line.len()).then(|| (text.line_to_byte(line_idx), indent, line))
+        })
+        .collect::<Vec<_>>();
+
+    let commented = !lines.is_empty()
+        && lines.iter().all(|(_, indent, line)| {
+            let body = line[*indent..].trim_end();
+            body.len() >= open.len() + close.len()
+                && body.starts_with(open)
+                && body.ends_with(close)
+        });
+
+    let mut deltas = vec![];
+    for (line_start, indent, line) in &lines {
+        let start = line_start + indent;
+        let body = line[*indent..].trim_end();
+        if commented {
+            // Remove the space the comment was padded with too.
+            let open_len = open.len() + body[open.len()..].starts_with(' ') as usize;
+            deltas.push(Delta::delete(start..start + open_len));
+            if !close.is_empty() {
+                let close_start = body.len() - close.len();
+                let pad = (close_start > open_len && body[..close_start].ends_with(' ')) as usize;
+                deltas.push(Delta::delete(start + close_start - pad..start + body.len()));
+            }
+        } else {
+            deltas.push(Delta::insert_at(start, format!("{open} ")));
+            if !close.is_empty() {
+                deltas.push(Delta::insert_at(start + body.len(), format!(" {close}")));
+            }
+        }
+    }
+
+    Deltas::new(deltas)
+}
+
+/// Wrap the range in a block comment, or unwrap it if it already is one.
+/// Surrounding whitespace is left outside the comment, e.g. `gcw` doesn't comment the space after the word.
+fn toggle_block(
+    text: &dyn AnyText,
+    range: Range<usize>,
+    open: &str,
+    close: &str,
+) -> Deltas<'static> {
+    let s = text.byte_slice(range.clone()).to_cow();
+    let body = s.trim();
+    if body.is_empty() {
+        return Deltas::empty();
+    }
+
+    let start = range.start + s.len() - s.trim_start().len();
+    let end = start + body.len();
+    if body.len() >= open.len() + close.len() && body.starts_with(open) && body.ends_with(close) {
+        let inner = &body[open.len()..body.len() - close.len()];
+        let open_len = open.len() + inner.starts_with(' ') as usize;
+        let close_len = close.len() + (inner.len() > 1 && inner.ends_with(' ')) as usize;
+        Deltas::new([Delta::delete(start..start + open_len), Delta::delete(end - close_len..end)])
+    } else {
+        Deltas::new([
+            Delta::insert_at(start, format!("{open} ")),
+            Delta::insert_at(end, format!(" {close}")),
+        ])
+    }
+}
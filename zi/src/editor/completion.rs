@@ -1,5 +1,7 @@
 use std::any::TypeId;
+use std::collections::BTreeSet;
 use std::future::Future;
+use std::sync::atomic::{AtomicU64, Ordering};
 use std::sync::{Arc, OnceLock};
 
 use futures_core::future::BoxFuture;
@@ -7,7 +9,7 @@ use futures_util::{StreamExt, TryFutureExt, TryStreamExt, stream};
 use parking_lot::RwLock;
 use rustc_hash::FxHashMap;
 use zi_core::CompletionItem;
-use zi_text::{Delta, Deltas};
+use zi_text::{Delta, Deltas, Text as _, TextSlice as _};
 
 use super::{Selector, State, active_servers_of};
 use crate::completion::{Completion, CompletionProvider};
@@ -16,6 +18,11 @@ use crate::{Active, Editor, LanguageServiceId, Result, ViewId, lstypes};
 static COMPLETION_PROVIDERS: OnceLock<RwLock<FxHashMap<TypeId, Arc<dyn CompletionProvider>>>> =
     OnceLock::new();
 
+static NEXT_REQUEST: AtomicU64 = AtomicU64::new(0);
+
+/// Buffers larger than this are not scraped for words to complete.
+const MAX_WORD_SOURCE_LEN: usize = 1 << 20;
+
 impl Editor {
     pub fn register_completion_provider<P: CompletionProvider + 'static>(&mut self, provider: P) {
         COMPLETION_PROVIDERS
@@ -38,20 +45,48 @@ impl Editor {
     pub fn trigger_completion(&mut self, trigger: Option<char>) {
         let fut = self.request_completions(Active);
         let at = self.cursor_byte(Active);
+        let request = NEXT_REQUEST.fetch_add(1, Ordering::Relaxed);
 
         let State::Insert(state) = &mut self.state else { return };
-        state.completion.activate(at, trigger);
+        state.completion.activate(at, trigger, request);
 
         self.callback("completions", fut.map_err(Into::into), move |editor, items| {
             let State::Insert(state) = &mut editor.state else { return Ok(()) };
-            if let Completion::Active(state) = &mut state.completion {
-                state.set_items(items);
+            match &mut state.completion {
+                Completion::Active(state) if state.request() == request => state.set_items(items),
+                // The prefix has changed since, a newer request is in flight or completion has ended.
+                _ => tracing::debug!(request, "discarding stale completion response"),
             }
 
             Ok(())
         });
     }
 
+    /// Whether typing `c` should open completion, as declared by the language servers of the active buffer.
+    pub fn is_completion_trigger(&self, c: char) -> bool {
+        active_servers_of!(self, Active).any(|server| {
+            self.active_language_services[server]
+                .completion_capabilities()
+                .is_some_and(|caps| caps.trigger_characters.contains(&c))
+        })
+    }
+
+    /// Accept the selected completion, applying its edit and expanding any snippet.
+    /// Returns `false` if there is no selected completion.
+    pub fn accept_completion(&mut self) -> bool {
+        let State::Insert(state) = &self.state else { return false };
+        let Completion::Active(completion) = &state.completion else { return false };
+        let Some((range, mut snippet)) = completion.accept(self.text(Active)) else { return false };
+        if let State::Insert(state) = &mut self.state {
+            state.completion.deactivate();
+        }
+
+        let view = Active.select(self);
+        self.indent_snippet(view, range.start, &mut snippet);
+        self.expand_snippet(view, range, snippet).expect("valid range");
+        true
+    }
+
     pub(super) fn apply_completion_delta(&mut self, delta: Delta<'_>) {
         let delta = delta.to_owned();
         let new_cursor = delta.range().start + delta.text().len();
@@ -111,15 +146,65 @@ impl Editor {
             })
             .collect::<Vec<_>>();
 
+        let words = self.buffer_words(view);
+
         async move {
-            stream::iter(futs)
+            let mut items = stream::iter(futs)
                 .buffered(16)
                 .try_fold(vec![], |mut acc, res| async move {
                     acc.extend(res.items);
                     Ok(acc)
                 })
-                .await
+                .await?;
+
+            // Words from the buffers are a fallback, they come after anything the providers know about.
+            let labels = items.iter().map(|item| item.label.clone()).collect::<BTreeSet<_>>();
+            items.extend(
+                words
+                    .into_iter()
+                    .filter(|word| !labels.contains(word))
+                    .map(|word| CompletionItem { label: word, ..Default::default() }),
+            );
+            Ok(items)
+        }
+    }
+
+    /// The words in the open files, except for the word being typed.
+    fn buffer_words(&self, view: ViewId) -> BTreeSet<String> {
+        let is_word = |c: char| c.is_alphanumeric() || c == '_';
+
+        let mut words = BTreeSet::new();
+        // Only files, the other buffers (pickers, the explorer, etc.) are not something to complete from.
+        for buf in self.buffers.values().filter(|buf| buf.file_path().is_some()) {
+            let text = buf.text();
+            if text.len_bytes() > MAX_WORD_SOURCE_LEN {
+                continue;
+            }
+
+            for line in text.lines() {
+                let line = line.to_cow();
+                words.extend(
+                    line.split(|c: char| !is_word(c))
+                        .filter(|word| word.chars().count() > 1)
+                        .map(String::from),
+                );
+            }
         }
+
+        let buf = self[view].buffer();
+        let cursor = self[view].cursor();
+        if let Some(line) = self[buf].text().line(cursor.line()) {
+            let line = line.to_cow();
+            let before = &line[..cursor.col().min(line.len())];
+            let start = before
+                .char_indices()
+                .rfind(|&(_, c)| !is_word(c))
+                .map_or(0, |(i, c)| i + c.len_utf8());
+            let end = line[start..].find(|c: char| !is_word(c)).map_or(line.len(), |i| start + i);
+            words.remove(&line[start..end]);
+        }
+
+        words
     }
 }
 
@@ -1,23 +1,52 @@
+use std::time::Duration;
+
+use crate::clipboard::ClipboardBackend;
 use crate::config::Setting;
+use crate::statusline::StatusLine;
 use crate::syntax::Theme;
 
 /// Global editor configuration shared between all views/buffers
 pub struct Settings {
     pub file_picker_split_ratio: Setting<(u16, u16)>,
+    /// The maximum number of files the file picker will walk to keep matching responsive in large trees
+    pub file_picker_max_entries: Setting<usize>,
     pub generic_picker_split_ratio: Setting<(u16, u16)>,
     pub diagnostics_picker_split_ratio: Setting<(u16, u16)>,
     pub global_search_split_ratio: Setting<(u16, u16)>,
     pub theme: Setting<Theme>,
+    pub clipboard: Setting<ClipboardBackend>,
+    /// How long to wait for the rest of a key sequence before giving up on it
+    pub key_timeout: Setting<Duration>,
+    pub statusline: Setting<StatusLine>,
+    /// Files of at least this many bytes are opened as large files, which are loaded as they're viewed and don't get
+    /// syntax highlighting, language services or git signs.
+    pub large_file_threshold: Setting<u64>,
+    /// The command `:grep` runs with its arguments appended, it should print `path:line:col:text` for each match.
+    pub grep_program: Setting<String>,
+    /// Reopening a file moves the cursor back to where it was left, see `Editor::set_position_file`.
+    pub restore_cursor: Setting<bool>,
+    /// The command `:SudoWrite` pipes the buffer to with the path appended if writing the file is denied
+    /// permission, like vim's `:w !sudo tee %`. The editor holds the terminal, so sudo asks for the password
+    /// with the `SUDO_ASKPASS` helper (`-A`) rather than prompting on it.
+    pub sudo_write_program: Setting<String>,
 }
 
 impl Default for Settings {
     fn default() -> Self {
         Self {
             file_picker_split_ratio: Setting::new((1, 2)),
+            file_picker_max_entries: Setting::new(100_000),
             generic_picker_split_ratio: Setting::new((1, 1)),
             diagnostics_picker_split_ratio: Setting::new((2, 1)),
             global_search_split_ratio: Setting::new((1, 2)),
             theme: Setting::new(Theme::default()),
+            clipboard: Setting::new(ClipboardBackend::default()),
+            key_timeout: Setting::new(Duration::from_millis(1000)),
+            statusline: Setting::new(StatusLine::default()),
+            large_file_threshold: Setting::new(64 * 1024 * 1024),
+            grep_program: Setting::new("rg --vimgrep --smart-case".to_string()),
+            restore_cursor: Setting::new(true),
+            sudo_write_program: Setting::new("sudo -A tee".to_string()),
         }
     }
 }
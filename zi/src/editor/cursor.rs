@@ -1,4 +1,5 @@
 use zi_core::PointOrByte;
+use zi_text::Deltas;
 use zi_textobject::{TextObject, motion};
 
 use super::{Selector, get, get_ref, mode};
@@ -74,4 +75,62 @@ impl Editor {
         let area = self.tree.view_area(view.id());
         view.set_cursor_bytewise(mode!(self), area, buf, byte, SetCursorFlags::empty());
     }
+
+    /// Add a cursor on the line below the last cursor.
+    pub fn add_cursor_down(&mut self, selector: impl Selector<ViewId>) {
+        let view_id = selector.select(self);
+        let (view, buf) = get!(self: view_id);
+        let area = self.tree.view_area(view.id());
+        let last = view.cursors().max().expect("there is always a primary cursor");
+        let target = last.down(1).with_col(view.cursor_target_col());
+        view.add_cursor(mode!(self), area, buf, target, SetCursorFlags::empty());
+        self.merge_visual_selections(view_id);
+    }
+
+    /// Add a cursor at the start of every search match in the view's buffer.
+    pub fn add_cursors_at_matches(&mut self, selector: impl Selector<ViewId>) {
+        let view_id = selector.select(self);
+        let (view, buf) = get!(self: view_id);
+        if self.search_state.last_update.0 != buf.id() {
+            return;
+        }
+
+        let area = self.tree.view_area(view.id());
+        let text = buf.text();
+        let points = self
+            .search_state
+            .matches()
+            .iter()
+            .map(|mat| text.byte_to_point(mat.byte_range.start))
+            .collect::<Vec<_>>();
+
+        for point in points {
+            view.add_cursor(mode!(self), area, buf, point, SetCursorFlags::empty());
+        }
+        self.merge_visual_selections(view_id);
+    }
+
+    #[inline]
+    pub fn clear_secondary_cursors(&mut self, selector: impl Selector<ViewId>) {
+        let view_id = selector.select(self);
+        self.views[view_id].clear_secondary_cursors();
+    }
+}
+
+/// Shift a byte offset in the old text to the corresponding offset after applying `deltas`.
+/// An insertion exactly at `byte` does not move it, matching how edits don't move the primary cursor.
+pub(crate) fn shift_byte(deltas: &Deltas<'_>, byte: usize) -> usize {
+    let mut new_byte = byte;
+    let mut shift = 0isize;
+    for delta in deltas.iter() {
+        let range = delta.range();
+        if range.end < byte || (range.end == byte && !range.is_empty()) {
+            shift += delta.text().len() as isize - range.len() as isize;
+        } else if range.start < byte {
+            // The byte was within the replaced range, move it to the start of the range.
+            new_byte = range.start;
+        }
+    }
+
+    new_byte.checked_add_signed(shift).expect("shifted byte should be non-negative")
 }
@@ -1,27 +1,52 @@
+use std::collections::HashMap;
 use std::sync::OnceLock;
 
 use stdx::merge::Merge;
 use zi_input::KeyEvent;
-use zi_textobject::{Around, Within, delimiter};
+use zi_textobject::{Around, Paragraph, Tag, Token, Within, Word, delimiter};
 
 use crate::editor::{Action, SaveFlags, set_error_if};
 use crate::keymap::Keymap;
 use crate::{
-    Active, Direction, Editor, Mark, Mode, Operator, VerticalAlignment, hashmap, motion, trie,
+    Active, Direction, Editor, Mode, Operator, Point, VerticalAlignment, hashmap, motion, trie,
 };
 
 pub(super) fn new() -> Keymap {
-    static KEYMAP: OnceLock<Keymap<Mode, KeyEvent, Action>> = OnceLock::new();
+    defaults().keymap.clone()
+}
+
+/// Look up an action of the default keymap by name (e.g. `goto_definition`) to bind it to other keys.
+pub(super) fn action(name: &str) -> Option<Action> {
+    defaults().actions.get(name).copied()
+}
+
+struct Defaults {
+    keymap: Keymap<Mode, KeyEvent, Action>,
+    actions: HashMap<&'static str, Action>,
+}
+
+fn defaults() -> &'static Defaults {
+    static DEFAULTS: OnceLock<Defaults> = OnceLock::new();
 
     macro_rules! count_fn {
         ($name:ident, $digit:expr) => {
             fn $name(editor: &mut Editor) {
-                editor.update_count(|count| count.unwrap_or(0) * 10 + $digit);
+                editor.update_count(|count| {
+                    count.unwrap_or(0).saturating_mul(10).saturating_add($digit)
+                });
             }
         };
     }
 
-    count_fn!(count_0, 0);
+    // `0` only continues a count, on its own it moves to the start of the line.
+    fn count_0(editor: &mut Editor) {
+        if editor.has_count() {
+            editor.update_count(|count| count.unwrap_or(0).saturating_mul(10));
+        } else {
+            set_error_if!(editor: editor.motion(Active, motion::LineStart));
+        }
+    }
+
     count_fn!(count_1, 1);
     count_fn!(count_2, 2);
     count_fn!(count_3, 3);
@@ -44,6 +69,32 @@ pub(super) fn new() -> Keymap {
         editor.set_mode(Mode::OperatorPending(Operator::Yank));
     }
 
+    fn comment_operator_pending(editor: &mut Editor) {
+        editor.set_mode(Mode::OperatorPending(Operator::Comment));
+    }
+
+    fn fold_operator_pending(editor: &mut Editor) {
+        editor.set_mode(Mode::OperatorPending(Operator::Fold));
+    }
+
+    fn surround_operator_pending(editor: &mut Editor) {
+        editor.set_mode(Mode::OperatorPending(Operator::Surround));
+    }
+
+    fn filter_operator_pending(editor: &mut Editor) {
+        editor.set_mode(Mode::OperatorPending(Operator::Filter));
+    }
+
+    fn delete_surround(editor: &mut Editor) {
+        editor.set_mode(Mode::Normal);
+        editor.select_surround_to_delete();
+    }
+
+    fn change_surround(editor: &mut Editor) {
+        editor.set_mode(Mode::Normal);
+        editor.select_surround_to_change();
+    }
+
     fn delete_till_end_of_line(editor: &mut Editor) {
         delete_operator_pending(editor);
         set_error_if!(editor: editor.text_object(Active, zi_textobject::Until('\n')));
@@ -76,13 +127,20 @@ pub(super) fn new() -> Keymap {
     }
 
     fn insert_newline(editor: &mut Editor) {
-        set_error_if!(editor: editor.insert_char(Active, '\n'));
+        if !editor.accept_completion() {
+            set_error_if!(editor: editor.expand_abbreviation(Active, '\n'));
+            set_error_if!(editor: editor.insert_char(Active, '\n'));
+        }
     }
 
     fn normal_mode(editor: &mut Editor) {
         editor.set_mode(Mode::Normal);
     }
 
+    fn cancel_command(editor: &mut Editor) {
+        editor.cancel_command();
+    }
+
     fn visual_mode(editor: &mut Editor) {
         editor.set_mode(Mode::Visual);
     }
@@ -107,6 +165,34 @@ pub(super) fn new() -> Keymap {
         editor.visual_change(Active);
     }
 
+    fn visual_comment(editor: &mut Editor) {
+        editor.visual_comment(Active);
+    }
+
+    fn visual_surround(editor: &mut Editor) {
+        editor.visual_surround(Active);
+    }
+
+    fn visual_block_insert(editor: &mut Editor) {
+        set_error_if!(editor: editor.visual_block_insert(Active, false));
+    }
+
+    fn visual_block_append(editor: &mut Editor) {
+        set_error_if!(editor: editor.visual_block_insert(Active, true));
+    }
+
+    fn visual_fold(editor: &mut Editor) {
+        editor.visual_fold(Active);
+    }
+
+    fn visual_filter(editor: &mut Editor) {
+        editor.visual_filter(Active);
+    }
+
+    fn visual_command_mode(editor: &mut Editor) {
+        editor.visual_command_mode();
+    }
+
     fn prev_line(editor: &mut Editor) {
         set_error_if!(editor: editor.motion(Active, motion::PrevLine))
     }
@@ -179,6 +265,38 @@ pub(super) fn new() -> Keymap {
         set_error_if!(editor: editor.text_object(Active, Around(delimiter::AngleBracket)));
     }
 
+    fn inside_word(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Word::inner()));
+    }
+
+    fn inside_token(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Token::inner()));
+    }
+
+    fn inside_paragraph(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Paragraph::inner()));
+    }
+
+    fn inside_tag(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Tag::inner()));
+    }
+
+    fn around_word(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Word::around()));
+    }
+
+    fn around_token(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Token::around()));
+    }
+
+    fn around_paragraph(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Paragraph::around()));
+    }
+
+    fn around_tag(editor: &mut Editor) {
+        set_error_if!(editor: editor.text_object(Active, Tag::around()));
+    }
+
     fn goto_definition(editor: &mut Editor) {
         let fut = editor.goto_definition(Active);
         editor.spawn("go to definition", fut);
@@ -204,12 +322,21 @@ pub(super) fn new() -> Keymap {
         editor.spawn("find references", fut);
     }
 
+    fn hover(editor: &mut Editor) {
+        let fut = editor.hover(Active);
+        editor.spawn("hover", fut);
+    }
+
     fn goto_start(editor: &mut Editor) {
+        let from = editor.current_location();
         editor.scroll(Active, Direction::Up, usize::MAX);
+        editor.record_jump(from);
     }
 
     fn goto_end(editor: &mut Editor) {
+        let from = editor.current_location();
         editor.scroll(Active, Direction::Down, usize::MAX);
+        editor.record_jump(from);
     }
 
     fn align_view_top(editor: &mut Editor) {
@@ -227,6 +354,18 @@ pub(super) fn new() -> Keymap {
         editor.align_view(view, VerticalAlignment::Bottom);
     }
 
+    fn toggle_fold(editor: &mut Editor) {
+        editor.toggle_fold(Active);
+    }
+
+    fn open_all_folds(editor: &mut Editor) {
+        editor.open_all_folds(Active);
+    }
+
+    fn close_all_folds(editor: &mut Editor) {
+        editor.close_all_folds(Active);
+    }
+
     fn open_newline(editor: &mut Editor) {
         editor.set_mode(Mode::Insert);
         editor.set_cursor(Active, editor.cursor(Active).with_col(usize::MAX));
@@ -235,9 +374,19 @@ pub(super) fn new() -> Keymap {
 
     fn open_newline_above(editor: &mut Editor) {
         editor.set_mode(Mode::Insert);
-        editor.set_cursor(Active, editor.cursor(Active).with_col(0));
-        set_error_if!(editor: editor.insert_char(Active, '\n'));
-        set_error_if!(editor: editor.motion(Active, motion::PrevLine));
+        let cursor = editor.cursor(Active);
+        match cursor.line().checked_sub(1) {
+            // Open the line from the end of the line above so it's indented like any other new line.
+            Some(line) => {
+                editor.set_cursor(Active, Point::new(line, usize::MAX));
+                set_error_if!(editor: editor.insert_char(Active, '\n'));
+            }
+            None => {
+                editor.set_cursor(Active, cursor.with_col(0));
+                set_error_if!(editor: editor.insert_char(Active, '\n'));
+                set_error_if!(editor: editor.motion(Active, motion::PrevLine));
+            }
+        }
     }
 
     fn next_token(editor: &mut Editor) {
@@ -257,7 +406,7 @@ pub(super) fn new() -> Keymap {
     }
 
     fn matchit(editor: &mut Editor) {
-        set_error_if!(editor: editor.motion(Active, motion::MatchIt))
+        set_error_if!(editor: editor.goto_matching_bracket(Active))
     }
 
     fn text_object_current_line_inclusive(editor: &mut Editor) {
@@ -280,11 +429,13 @@ pub(super) fn new() -> Keymap {
     }
 
     fn scroll_line_down(editor: &mut Editor) {
-        editor.scroll(Active, Direction::Down, 1);
+        let n = editor.take_count().unwrap_or(1);
+        editor.scroll(Active, Direction::Down, n);
     }
 
     fn scroll_line_up(editor: &mut Editor) {
-        editor.scroll(Active, Direction::Up, 1);
+        let n = editor.take_count().unwrap_or(1);
+        editor.scroll(Active, Direction::Up, n);
     }
 
     fn scroll_down(editor: &mut Editor) {
@@ -329,6 +480,30 @@ pub(super) fn new() -> Keymap {
         editor.split(Active, Direction::Down, tui::Constraint::Fill(1));
     }
 
+    fn grow_width(editor: &mut Editor) {
+        let n = i32::try_from(editor.take_count().unwrap_or(1)).unwrap_or(i32::MAX);
+        editor.resize_view(Active, n, 0);
+    }
+
+    fn shrink_width(editor: &mut Editor) {
+        let n = i32::try_from(editor.take_count().unwrap_or(1)).unwrap_or(i32::MAX);
+        editor.resize_view(Active, -n, 0);
+    }
+
+    fn grow_height(editor: &mut Editor) {
+        let n = i32::try_from(editor.take_count().unwrap_or(1)).unwrap_or(i32::MAX);
+        editor.resize_view(Active, 0, n);
+    }
+
+    fn shrink_height(editor: &mut Editor) {
+        let n = i32::try_from(editor.take_count().unwrap_or(1)).unwrap_or(i32::MAX);
+        editor.resize_view(Active, 0, -n);
+    }
+
+    fn equalize_views(editor: &mut Editor) {
+        editor.equalize_views();
+    }
+
     fn focus_left(editor: &mut Editor) {
         editor.focus_direction(Direction::Left);
     }
@@ -357,6 +532,38 @@ pub(super) fn new() -> Keymap {
         set_error_if!(editor: editor.redo(Active))
     }
 
+    fn undo_earlier(editor: &mut Editor) {
+        set_error_if!(editor: editor.undo_earlier(Active, 1))
+    }
+
+    fn undo_later(editor: &mut Editor) {
+        set_error_if!(editor: editor.undo_later(Active, 1))
+    }
+
+    fn add_cursor_down(editor: &mut Editor) {
+        editor.add_cursor_down(Active);
+    }
+
+    fn add_cursors_at_matches(editor: &mut Editor) {
+        editor.add_cursors_at_matches(Active);
+    }
+
+    fn clear_secondary_cursors(editor: &mut Editor) {
+        editor.clear_secondary_cursors(Active);
+    }
+
+    fn select_register(editor: &mut Editor) {
+        editor.select_register();
+    }
+
+    fn toggle_macro_recording(editor: &mut Editor) {
+        editor.toggle_macro_recording();
+    }
+
+    fn select_macro(editor: &mut Editor) {
+        editor.select_macro();
+    }
+
     fn dot_repeat(editor: &mut Editor) {
         editor.dot_repeat();
     }
@@ -398,6 +605,10 @@ pub(super) fn new() -> Keymap {
         editor.open_marks(Active);
     }
 
+    fn open_quickfix(editor: &mut Editor) {
+        editor.open_quickfix();
+    }
+
     fn tab(editor: &mut Editor) {
         set_error_if!(editor: editor.tab())
     }
@@ -415,256 +626,517 @@ pub(super) fn new() -> Keymap {
     }
 
     fn goto_next_match(editor: &mut Editor) {
-        editor.goto_next_match();
+        if editor.goto_next_match().is_none() {
+            editor.set_error("pattern not found");
+        }
     }
 
     fn goto_prev_match(editor: &mut Editor) {
-        editor.goto_prev_match();
+        if editor.goto_prev_match().is_none() {
+            editor.set_error("pattern not found");
+        }
     }
 
-    fn tmp_create_mark_test(editor: &mut Editor) {
-        let cursor = editor.cursor(Active);
-        let byte = editor.buffer(Active).text().point_to_byte(cursor);
-        let hl = editor.highlight_id_by_name(crate::syntax::HighlightName::ERROR);
-        editor.create_mark(
-            Active,
-            editor.default_namespace(),
-            Mark::builder(byte).hl(hl).width(5).start_bias(zi_marktree::Bias::Left),
-        );
+    fn goto_next_hunk(editor: &mut Editor) {
+        set_error_if!(editor: editor.goto_next_hunk(Active));
+    }
+
+    fn goto_prev_hunk(editor: &mut Editor) {
+        set_error_if!(editor: editor.goto_prev_hunk(Active));
+    }
+
+    fn goto_next_diagnostic(editor: &mut Editor) {
+        set_error_if!(editor: editor.goto_next_diagnostic(Active));
+    }
+
+    fn goto_prev_diagnostic(editor: &mut Editor) {
+        set_error_if!(editor: editor.goto_prev_diagnostic(Active));
+    }
+
+    fn insert_digraph(editor: &mut Editor) {
+        editor.select_digraph();
+    }
+
+    fn insert_literal(editor: &mut Editor) {
+        editor.select_literal();
+    }
+
+    fn set_mark(editor: &mut Editor) {
+        editor.select_mark_to_set();
+    }
+
+    fn goto_mark(editor: &mut Editor) {
+        editor.select_mark_to_goto(false);
+    }
+
+    fn goto_mark_line(editor: &mut Editor) {
+        editor.select_mark_to_goto(true);
+    }
+
+    macro_rules! actions {
+        ($($name:ident,)*) => {
+            hashmap! { $(stringify!($name) => $name as Action,)* }
+        };
     }
 
     // Apparently the key event parser is slow, so we need to cache the keymap to help fuzzing run faster.
-    KEYMAP
-        .get_or_init(|| {
-            let count_trie = trie!({
-                "0" => count_0,
-                "1" => count_1,
-                "2" => count_2,
-                "3" => count_3,
-                "4" => count_4,
-                "5" => count_5,
-                "6" => count_6,
-                "7" => count_7,
-                "8" => count_8,
-                "9" => count_9,
-            });
-
-            let operator_pending_trie = trie!({
+    DEFAULTS.get_or_init(|| {
+        let actions = actions! {
+            delete_operator_pending,
+            change_operator_pending,
+            yank_operator_pending,
+            comment_operator_pending,
+            fold_operator_pending,
+            surround_operator_pending,
+            filter_operator_pending,
+            delete_surround,
+            change_surround,
+            delete_till_end_of_line,
+            change_till_end_of_line,
+            paste,
+            insert_mode,
+            replace_pending,
+            insert_start_of_line,
+            command_mode,
+            insert_newline,
+            normal_mode,
+            cancel_command,
+            visual_mode,
+            visual_line_mode,
+            visual_block_mode,
+            visual_yank,
+            visual_delete,
+            visual_change,
+            visual_comment,
+            visual_surround,
+            visual_block_insert,
+            visual_block_append,
+            visual_fold,
+            visual_filter,
+            visual_command_mode,
+            prev_line,
+            next_line,
+            prev_char,
+            next_char,
+            inside_paren,
+            inside_bracket,
+            inside_brace,
+            inside_quote,
+            inside_apostrophe,
+            inside_backtick,
+            inside_angle_bracket,
+            around_paren,
+            around_bracket,
+            around_brace,
+            around_quote,
+            around_apostrophe,
+            around_backtick,
+            around_angle_bracket,
+            inside_word,
+            inside_token,
+            inside_paragraph,
+            inside_tag,
+            around_word,
+            around_token,
+            around_paragraph,
+            around_tag,
+            goto_definition,
+            goto_declaration,
+            goto_implementation,
+            goto_type_definition,
+            find_references,
+            hover,
+            goto_start,
+            goto_end,
+            align_view_top,
+            align_view_center,
+            align_view_bottom,
+            toggle_fold,
+            open_all_folds,
+            close_all_folds,
+            open_newline,
+            open_newline_above,
+            next_token,
+            prev_token,
+            next_word,
+            prev_word,
+            matchit,
+            text_object_current_line_inclusive,
+            text_object_current_line_exclusive,
+            append_eol,
+            append,
+            scroll_line_down,
+            scroll_line_up,
+            scroll_down,
+            scroll_up,
+            open_file_picker,
+            open_file_picker_here,
+            open_global_search,
+            open_file_explorer,
+            split_vertical,
+            split_horizontal,
+            focus_left,
+            focus_right,
+            focus_up,
+            focus_down,
+            grow_width,
+            shrink_width,
+            grow_height,
+            shrink_height,
+            equalize_views,
+            view_only,
+            undo,
+            redo,
+            undo_earlier,
+            undo_later,
+            add_cursor_down,
+            add_cursors_at_matches,
+            clear_secondary_cursors,
+            select_register,
+            toggle_macro_recording,
+            select_macro,
+            dot_repeat,
+            search,
+            save,
+            backspace,
+            jump_forward,
+            jump_back,
+            set_mark,
+            goto_mark,
+            goto_mark_line,
+            inspect,
+            open_jump_list,
+            open_diagnostics,
+            open_marks,
+            open_quickfix,
+            tab,
+            backtab,
+            trigger_completion,
+            execute_buffered_command,
+            goto_next_match,
+            goto_prev_match,
+            goto_next_hunk,
+            goto_prev_hunk,
+            goto_next_diagnostic,
+            goto_prev_diagnostic,
+            insert_digraph,
+            insert_literal,
+        };
+
+        let count_trie = trie!({
+            "0" => count_0,
+            "1" => count_1,
+            "2" => count_2,
+            "3" => count_3,
+            "4" => count_4,
+            "5" => count_5,
+            "6" => count_6,
+            "7" => count_7,
+            "8" => count_8,
+            "9" => count_9,
+        });
+
+        let operator_pending_trie = trie!({
+            "<ESC>" | "<C-c>" => normal_mode,
+            "w" => next_word,
+            "W" => next_token,
+            "b" => prev_word,
+            "B" => prev_token,
+            "h" => prev_char,
+            "k" => prev_line,
+            "j" => next_line,
+            "l" => next_char,
+            "%" => matchit,
+            "i" => {
+                "b" => inside_paren,
+                "(" => inside_paren,
+                ")" => inside_paren,
+
+                "B" => inside_brace,
+                "{" => inside_brace,
+                "}" => inside_brace,
+
+                "<" => inside_angle_bracket,
+                ">" => inside_angle_bracket,
+
+                "[" => inside_bracket,
+                "]" => inside_bracket,
+
+                "'" => inside_apostrophe,
+                "\"" => inside_quote,
+                "`" => inside_backtick,
+
+                "w" => inside_word,
+                "W" => inside_token,
+                "p" => inside_paragraph,
+                "t" => inside_tag,
+            },
+            "a" => {
+                "b" => around_paren,
+                "(" => around_paren,
+                ")" => around_paren,
+
+                "B" => around_brace,
+                "{" => around_brace,
+                "}" => around_brace,
+
+                "<" => around_angle_bracket,
+                ">" => around_angle_bracket,
+                "[" => around_bracket,
+                "]" => around_bracket,
+                "'" => around_apostrophe,
+                "\"" => around_quote,
+                "`" => around_backtick,
+
+                "w" => around_word,
+                "W" => around_token,
+                "p" => around_paragraph,
+                "t" => around_tag,
+            },
+        });
+
+        let keymap = Keymap::from(hashmap! {
+            Mode::Command => trie!({
+                "<ESC>" | "<C-c>" => cancel_command,
+                "<BS>" => backspace,
+                "<CR>" => execute_buffered_command,
+                "<Tab>" => tab,
+                "<S-Tab>" => backtab,
+            }),
+            Mode::Insert => trie!({
+                "<ESC>" | "<C-c>" => normal_mode,
+                "<C-Space>" => trigger_completion,
+                "<CR>" => insert_newline,
+                "<BS>" => backspace,
+                "<Tab>" => tab,
+                "<S-Tab>" => backtab,
+                "<C-k>" => insert_digraph,
+                "<C-v>" => insert_literal,
+                "f" => {
+                    "d" => normal_mode,
+                },
+            }),
+            Mode::OperatorPending(Operator::Delete) => count_trie.clone().merge(operator_pending_trie.clone()).merge(trie!({
+                "d" => text_object_current_line_inclusive,
+                "s" => delete_surround,
+            })),
+            Mode::OperatorPending(Operator::Change) => count_trie.clone().merge(operator_pending_trie.clone()).merge(trie!({
+                "c" => text_object_current_line_exclusive,
+                "s" => change_surround,
+            })),
+            Mode::OperatorPending(Operator::Yank) => count_trie.clone().merge(operator_pending_trie.clone()).merge(trie!({
+                "y" => text_object_current_line_exclusive,
+                "s" => surround_operator_pending,
+            })),
+            Mode::OperatorPending(Operator::Comment) => count_trie.clone().merge(operator_pending_trie.clone()).merge(trie!({
+                "c" => text_object_current_line_inclusive,
+            })),
+            Mode::OperatorPending(Operator::Fold) => count_trie.clone().merge(operator_pending_trie.clone()),
+            Mode::OperatorPending(Operator::Surround) => count_trie.clone().merge(operator_pending_trie.clone()).merge(trie!({
+                "s" => text_object_current_line_exclusive,
+            })),
+            Mode::OperatorPending(Operator::Filter) => count_trie.clone().merge(operator_pending_trie).merge(trie!({
+                "!" => text_object_current_line_inclusive,
+            })),
+            Mode::ReplacePending => trie!({
                 "<ESC>" | "<C-c>" => normal_mode,
+            }),
+            Mode::Visual => count_trie.clone().merge(trie!({
+                "<ESC>" | "<C-c>" => normal_mode,
+                "h" => prev_char,
+                "l" => next_char,
+                "j" => next_line,
+                "k" => prev_line,
                 "w" => next_word,
-                "W" => next_token,
                 "b" => prev_word,
+                "W" => next_token,
                 "B" => prev_token,
-                "h" => prev_char,
+                "%" => matchit,
+                "G" => goto_end,
+                "\"" => select_register,
+                "y" => visual_yank,
+                "d" | "x" => visual_delete,
+                "c" => visual_change,
+                "!" => visual_filter,
+                ":" => visual_command_mode,
+                "S" => visual_surround,
+                "V" => visual_line_mode,
+                "<C-v>" => visual_block_mode,
+                "g" => {
+                    "g" => goto_start,
+                    "c" => visual_comment,
+                },
+                "z" => {
+                    "f" => visual_fold,
+                },
+            })),
+            Mode::VisualLine => count_trie.clone().merge(trie!({
+                "<ESC>" | "<C-c>" => normal_mode,
+                "j" => next_line,
                 "k" => prev_line,
+                "G" => goto_end,
+                "\"" => select_register,
+                "y" => visual_yank,
+                "d" | "x" => visual_delete,
+                "c" => visual_change,
+                "!" => visual_filter,
+                ":" => visual_command_mode,
+                "S" => visual_surround,
+                "v" => visual_mode,
+                "<C-v>" => visual_block_mode,
+                "g" => {
+                    "g" => goto_start,
+                    "c" => visual_comment,
+                },
+                "z" => {
+                    "f" => visual_fold,
+                },
+            })),
+            Mode::VisualBlock => count_trie.clone().merge(trie!({
+                "<ESC>" | "<C-c>" => normal_mode,
+                "h" => prev_char,
+                "l" => next_char,
                 "j" => next_line,
+                "k" => prev_line,
+                "w" => next_word,
+                "b" => prev_word,
+                "W" => next_token,
+                "B" => prev_token,
+                "G" => goto_end,
+                "\"" => select_register,
+                "y" => visual_yank,
+                "d" | "x" => visual_delete,
+                "c" => visual_change,
+                "!" => visual_filter,
+                ":" => visual_command_mode,
+                "I" => visual_block_insert,
+                "A" => visual_block_append,
+                "v" => visual_mode,
+                "V" => visual_line_mode,
+                "g" => {
+                    "g" => goto_start,
+                    "c" => visual_comment,
+                },
+                "z" => {
+                    "f" => visual_fold,
+                },
+            })),
+            Mode::Normal => count_trie.merge(trie!({
+                "<ESC>" => clear_secondary_cursors,
+                "<C-down>" => add_cursor_down,
+                "<C-n>" => add_cursors_at_matches,
+                "<C-s>" => save,
+                "<C-o>" => jump_back,
+                "<C-i>" => jump_forward,
+                "<C-d>" => scroll_down,
+                "<C-u>" => scroll_up,
+                "<C-e>" => scroll_line_down,
+                "<C-y>" => scroll_line_up,
+                "<Tab>" => tab,
+                "r" => replace_pending,
+                "\"" => select_register,
+                "q" => toggle_macro_recording,
+                "@" => select_macro,
+                "m" => set_mark,
+                "`" => goto_mark,
+                "'" => goto_mark_line,
+                "d" => delete_operator_pending,
+                "c" => change_operator_pending,
+                "y" => yank_operator_pending,
+                "C" => change_till_end_of_line,
+                "D" => delete_till_end_of_line,
+                "!" => filter_operator_pending,
+                "%" => matchit,
+                "]" => {
+                    "c" => goto_next_hunk,
+                    "d" => goto_next_diagnostic,
+                },
+                "[" => {
+                    "c" => goto_prev_hunk,
+                    "d" => goto_prev_diagnostic,
+                },
+                ":" => command_mode,
+                "/" => search,
+                "v" => visual_mode,
+                "V" => visual_line_mode,
+                "<C-v>" => visual_block_mode,
+                "i" => insert_mode,
+                "I" => insert_start_of_line,
+                "h" => prev_char,
                 "l" => next_char,
-                "i" => {
-                    "b" => inside_paren,
-                    "(" => inside_paren,
-                    ")" => inside_paren,
-
-                    "B" => inside_bracket,
-                    "{" => inside_brace,
-                    "}" => inside_brace,
-
-                    "<" => inside_angle_bracket,
-                    ">" => inside_angle_bracket,
-
-                    "[" => inside_bracket,
-                    "]" => inside_bracket,
-
-                    "'" => inside_apostrophe,
-                    "\"" => inside_quote,
-                    "`" => inside_backtick,
+                "j" => next_line,
+                "k" => prev_line,
+                "o" => open_newline,
+                "O" => open_newline_above,
+                "p" => paste,
+                "w" => next_word,
+                "b" => prev_word,
+                "W" => next_token,
+                "B" => prev_token,
+                "a" => append,
+                "A" => append_eol,
+                "u" => undo,
+                "<C-r>" => redo,
+                "." => dot_repeat,
+                "<C-h>" => focus_left,
+                "<C-j>" => focus_down,
+                "<C-k>" => focus_up,
+                "<C-l>" => focus_right,
+                "-" => open_file_explorer,
+                "n" => goto_next_match,
+                "N" => goto_prev_match,
+                "G" => goto_end,
+                "K" => hover,
+                "<space>" => {
+                    "e" => open_file_explorer,
+                    "o" => open_file_picker,
+                    "f" => open_file_picker_here,
+                    "j" => open_jump_list,
+                    "l" => open_diagnostics,
+                    "m" => open_marks,
+                    "q" => open_quickfix,
+                    "/" => open_global_search,
+                },
+                "g" => {
+                    "d" => goto_definition,
+                    "D" => goto_declaration,
+                    "i" => goto_implementation,
+                    "t" => goto_type_definition,
+                    "r" => find_references,
+                    "g" => goto_start,
+                    "c" => comment_operator_pending,
+                    "-" => undo_earlier,
+                    "+" => undo_later,
+                },
+                "t" => {
+                    "s" => inspect,
                 },
-                "a" => {
-                    "b" => around_paren,
-                    "(" => around_paren,
-                    ")" => around_paren,
-
-                    "B" => around_brace,
-                    "{" => around_brace,
-                    "}" => around_brace,
-
-                    "<" => around_angle_bracket,
-                    ">" => around_angle_bracket,
-                    "[" => around_bracket,
-                    "]" => around_bracket,
-                    "'" => around_apostrophe,
-                    "\"" => around_quote,
-                    "`" => around_backtick,
+                "z" => {
+                    "t" => align_view_top,
+                    "z" => align_view_center,
+                    "b" => align_view_bottom,
+                    "f" => fold_operator_pending,
+                    "a" => toggle_fold,
+                    "R" => open_all_folds,
+                    "M" => close_all_folds,
                 },
-            });
-
-            Keymap::from(hashmap! {
-                Mode::Command => trie!({
-                    "<ESC>" | "<C-c>" => normal_mode,
-                    "<BS>" => backspace,
-                    "<CR>" => execute_buffered_command,
-                }),
-                Mode::Insert => trie!({
-                    "<ESC>" | "<C-c>" => normal_mode,
-                    "<C-Space>" => trigger_completion,
-                    "<CR>" => insert_newline,
-                    "<BS>" => backspace,
-                    "<Tab>" => tab,
-                    "<S-Tab>" => backtab,
-                    "f" => {
-                        "d" => normal_mode,
-                    },
-                }),
-                Mode::OperatorPending(Operator::Delete) => count_trie.clone().merge(operator_pending_trie.clone()).merge(trie!({
-                    "d" => text_object_current_line_inclusive,
-                })),
-                Mode::OperatorPending(Operator::Change) => count_trie.clone().merge(operator_pending_trie.clone()).merge(trie!({
-                    "c" => text_object_current_line_exclusive,
-                })),
-                Mode::OperatorPending(Operator::Yank) => count_trie.clone().merge(operator_pending_trie).merge(trie!({
-                    "y" => text_object_current_line_exclusive,
-                })),
-                Mode::ReplacePending => trie!({
-                    "<ESC>" | "<C-c>" => normal_mode,
-                }),
-                Mode::Visual => count_trie.clone().merge(trie!({
-                    "<ESC>" | "<C-c>" => normal_mode,
-                    "h" => prev_char,
-                    "l" => next_char,
-                    "j" => next_line,
-                    "k" => prev_line,
-                    "w" => next_word,
-                    "b" => prev_word,
-                    "W" => next_token,
-                    "B" => prev_token,
-                    "%" => matchit,
-                    "G" => goto_end,
-                    "y" => visual_yank,
-                    "d" | "x" => visual_delete,
-                    "c" => visual_change,
-                    "V" => visual_line_mode,
-                    "<C-v>" => visual_block_mode,
-                    "g" => {
-                        "g" => goto_start,
-                    },
-                })),
-                Mode::VisualLine => count_trie.clone().merge(trie!({
-                    "<ESC>" | "<C-c>" => normal_mode,
-                    "j" => next_line,
-                    "k" => prev_line,
-                    "G" => goto_end,
-                    "y" => visual_yank,
-                    "d" | "x" => visual_delete,
-                    "c" => visual_change,
-                    "v" => visual_mode,
-                    "<C-v>" => visual_block_mode,
-                    "g" => {
-                        "g" => goto_start,
-                    },
-                })),
-                Mode::VisualBlock => count_trie.clone().merge(trie!({
-                    "<ESC>" | "<C-c>" => normal_mode,
-                    "h" => prev_char,
-                    "l" => next_char,
-                    "j" => next_line,
-                    "k" => prev_line,
-                    "w" => next_word,
-                    "b" => prev_word,
-                    "W" => next_token,
-                    "B" => prev_token,
-                    "G" => goto_end,
-                    "y" => visual_yank,
-                    "d" | "x" => visual_delete,
-                    "c" => visual_change,
-                    "v" => visual_mode,
-                    "V" => visual_line_mode,
-                    "g" => {
-                        "g" => goto_start,
-                    },
-                })),
-                Mode::Normal => count_trie.merge(trie!({
-                    "<C-s>" => save,
-                    "<C-o>" => jump_back,
-                    "<C-i>" => jump_forward,
-                    "<C-d>" => scroll_down,
-                    "<C-u>" => scroll_up,
-                    "<C-e>" => scroll_line_down,
-                    "<C-y>" => scroll_line_up,
-                    "<Tab>" => tab,
-                    "r" => replace_pending,
-                    "m" => tmp_create_mark_test,
-                    "d" => delete_operator_pending,
-                    "c" => change_operator_pending,
-                    "y" => yank_operator_pending,
-                    "C" => change_till_end_of_line,
-                    "D" => delete_till_end_of_line,
-                    "%" => matchit,
-                    ":" => command_mode,
-                    "/" => search,
-                    "v" => visual_mode,
-                    "V" => visual_line_mode,
-                    "<C-v>" => visual_block_mode,
-                    "i" => insert_mode,
-                    "I" => insert_start_of_line,
-                    "h" => prev_char,
-                    "l" => next_char,
-                    "j" => next_line,
-                    "k" => prev_line,
-                    "o" => open_newline,
-                    "O" => open_newline_above,
-                    "p" => paste,
-                    "w" => next_word,
-                    "b" => prev_word,
-                    "W" => next_token,
-                    "B" => prev_token,
-                    "a" => append,
-                    "A" => append_eol,
-                    "u" => undo,
-                    "<C-r>" => redo,
-                    "." => dot_repeat,
-                    "<C-h>" => focus_left,
-                    "<C-j>" => focus_down,
-                    "<C-k>" => focus_up,
-                    "<C-l>" => focus_right,
-                    "-" => open_file_explorer,
-                    "n" => goto_next_match,
-                    "N" => goto_prev_match,
-                    "G" => goto_end,
-                    "<space>" => {
-                        "e" => open_file_explorer,
-                        "o" => open_file_picker,
-                        "f" => open_file_picker_here,
-                        "j" => open_jump_list,
-                        "l" => open_diagnostics,
-                        "m" => open_marks,
-                        "/" => open_global_search,
-                    },
-                    "g" => {
-                        "d" => goto_definition,
-                        "D" => goto_declaration,
-                        "i" => goto_implementation,
-                        "t" => goto_type_definition,
-                        "r" => find_references,
-                        "g" => goto_start,
-                    },
-                    "t" => {
-                        "s" => inspect,
-                    },
-                    "z" => {
-                        "t" => align_view_top,
-                        "z" => align_view_center,
-                        "b" => align_view_bottom,
-                    },
-                    "<C-w>" => {
-                        "o" => view_only,
-                        "v" | "<C-v>" => split_vertical,
-                        "s" | "<C-s>" => split_horizontal,
-                        "h" | "<C-h>" => focus_left,
-                        "k" | "<C-k>" => focus_up,
-                        "j" | "<C-j>" => focus_down,
-                        "l" | "<C-l>" => focus_right,
-                    },
-                })),
-            })
-        })
-        .clone()
+                "<C-w>" => {
+                    "o" => view_only,
+                    "v" | "<C-v>" => split_vertical,
+                    "s" | "<C-s>" => split_horizontal,
+                    "h" | "<C-h>" => focus_left,
+                    "k" | "<C-k>" => focus_up,
+                    "j" | "<C-j>" => focus_down,
+                    "l" | "<C-l>" => focus_right,
+                    ">" => grow_width,
+                    "<" => shrink_width,
+                    "+" => grow_height,
+                    "-" => shrink_height,
+                    "=" => equalize_views,
+                },
+            })),
+        });
+
+        Defaults { keymap, actions }
+    })
 }
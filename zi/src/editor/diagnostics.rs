@@ -1,15 +1,24 @@
-use std::collections::HashMap;
+use std::collections::{BTreeMap, HashMap};
+use std::ops::Range;
 use std::path::PathBuf;
+use std::time::Duration;
 
+use anyhow::bail;
 use zi_text::PointRangeExt;
 
-use super::request_redraw;
+use super::{Resource, Result, Selector, request_redraw};
 use crate::lstypes::{self, Diagnostic, Severity};
 use crate::syntax::HighlightName;
-use crate::{BufferId, Editor, Mark, Setting};
+use crate::{BufferId, Editor, Mark, Point, PointRange, Setting, ViewId};
 
 pub(super) type BufferDiagnostics = Setting<(u32, Box<[Diagnostic]>)>;
 
+/// Language servers tend to publish diagnostics in bursts (e.g. one per keystroke).
+/// Wait for this long after the first diagnostics arrive before updating the buffer.
+const DIAGNOSTICS_DEBOUNCE: Duration = Duration::from_millis(50);
+
+const DIAGNOSTICS_NAMESPACE: &str = "lsp-diagnostics";
+
 impl Editor {
     /// Return the current state of the raw diagnostics returned by the language servers.
     pub fn diagnostics(&self) -> &HashMap<PathBuf, BufferDiagnostics> {
@@ -34,13 +43,162 @@ impl Editor {
         self.diagnostics.entry(path).or_default().write((version, diagnostics));
 
         if let Some(buf) = buf {
-            self.refresh_diagnostic_marks(self[buf].id());
-            request_redraw();
+            self.schedule_diagnostics_refresh(buf);
+        }
+    }
+
+    /// Move the cursor to the start of the next diagnostic, `]d`.
+    /// Only the most severe diagnostics in the buffer are visited, e.g. warnings are skipped while there are errors.
+    pub fn goto_next_diagnostic(&mut self, selector: impl Selector<ViewId>) -> Result<()> {
+        self.goto_diagnostic(selector, |cursor, starts| {
+            starts.iter().copied().find(|&start| start > cursor)
+        })
+    }
+
+    /// Move the cursor to the start of the previous diagnostic, `[d`.
+    pub fn goto_prev_diagnostic(&mut self, selector: impl Selector<ViewId>) -> Result<()> {
+        self.goto_diagnostic(selector, |cursor, starts| {
+            starts.iter().rev().copied().find(|&start| start < cursor)
+        })
+    }
+
+    fn goto_diagnostic(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        find: impl FnOnce(Point, &[Point]) -> Option<Point>,
+    ) -> Result<()> {
+        let view = selector.select(self);
+        let diagnostics = self.buffer_diagnostics(self[view].buffer());
+        let Some(severity) = diagnostics.iter().map(|(_, diag)| diag.severity).max() else {
+            bail!("no diagnostics")
+        };
+
+        let starts = diagnostics
+            .iter()
+            .filter(|(_, diag)| diag.severity == severity)
+            .map(|(range, _)| range.start())
+            .collect::<Vec<_>>();
+        let Some(target) = find(self[view].cursor(), &starts) else { bail!("no more diagnostics") };
+
+        let from = self.current_location();
+        self.set_cursor(view, target);
+        self.record_jump(from);
+        Ok(())
+    }
+
+    /// The diagnostics of the buffer in the order they appear in the text.
+    /// Diagnostics for a different version of the text are ignored as they may point anywhere.
+    fn buffer_diagnostics(&self, buf: BufferId) -> Vec<(PointRange, Diagnostic)> {
+        let Some(diagnostics) = self[buf].file_path().and_then(|path| self.diagnostics.get(&path))
+        else {
+            return vec![];
+        };
+
+        let guard = diagnostics.read();
+        let (version, diags) = &*guard;
+        if *version != self[buf].version() {
+            return vec![];
         }
+
+        let text = self[buf].text();
+        // The diagnostics are sorted as they're stored.
+        diags.iter().filter_map(|diag| Some((diag.range.decode(text)?, diag.clone()))).collect()
+    }
+
+    /// The message of the most severe diagnostic on the cursor line, it's shown after the end of the line.
+    pub(super) fn diagnostic_virtual_text(&self, view: ViewId) -> Option<(String, Severity)> {
+        let line = self[view].cursor().line();
+        self.buffer_diagnostics(self[view].buffer())
+            .into_iter()
+            .filter(|(range, _)| (range.start().line()..=range.end().line()).contains(&line))
+            // The first of the most severe diagnostics.
+            .rev()
+            .max_by_key(|(_, diag)| diag.severity)
+            .map(|(_, diag)| {
+                let message = diag.message.lines().next().unwrap_or_default().to_string();
+                (message, diag.severity)
+            })
+    }
+
+    fn schedule_diagnostics_refresh(&mut self, buf: BufferId) {
+        // A refresh is already scheduled, it will pick up the newer diagnostics.
+        if !self.pending_diagnostic_refreshes.insert(buf) {
+            return;
+        }
+
+        self.callback(
+            "refresh diagnostics",
+            async {
+                tokio::time::sleep(DIAGNOSTICS_DEBOUNCE).await;
+                Ok(())
+            },
+            move |editor, ()| {
+                editor.pending_diagnostic_refreshes.remove(&buf);
+                // The buffer may have been closed in the meantime.
+                if editor.buffers.contains_key(buf) {
+                    editor.refresh_diagnostic_marks(buf);
+                    request_redraw();
+                }
+                Ok(())
+            },
+        );
+    }
+
+    /// The gutter sign for each line with a diagnostic in the given byte range.
+    /// Only the most severe diagnostic on each line is shown.
+    /// These are derived from the diagnostic marks so they move along with edits.
+    pub(super) fn diagnostic_signs(
+        &self,
+        buf: BufferId,
+        byte_range: Range<usize>,
+    ) -> BTreeMap<usize, (char, tui::Style)> {
+        let Some(ns) =
+            self.namespaces.values().find(|ns| ns.name().as_str() == DIAGNOSTICS_NAMESPACE)
+        else {
+            return Default::default();
+        };
+
+        let severities = [
+            (HighlightName::ERROR, Severity::Error),
+            (HighlightName::WARNING, Severity::Warning),
+            (HighlightName::INFO, Severity::Info),
+            (HighlightName::HINT, Severity::Hint),
+        ]
+        .map(|(name, severity)| (self.highlight_id_by_name(name), severity));
+
+        let buf = &self[buf];
+        let text = buf.text();
+        let mut lines = BTreeMap::<usize, Severity>::new();
+        for (_, range, mark) in buf.marks(byte_range).filter(|(id, ..)| *id == ns.id()) {
+            let Some(&(_, severity)) = severities.iter().find(|(hl, _)| *hl == mark.highlight())
+            else {
+                continue;
+            };
+
+            let line = text.byte_to_line(range.start);
+            let max = lines.entry(line).or_insert(severity);
+            *max = (*max).max(severity);
+        }
+
+        let theme = self.theme();
+        let theme = theme.read();
+        lines
+            .into_iter()
+            .filter_map(|(line, severity)| {
+                let (sign, hl_name) = match severity {
+                    Severity::Error => ('E', HighlightName::ERROR_SIGN),
+                    Severity::Warning => ('W', HighlightName::WARNING_SIGN),
+                    Severity::Info => ('I', HighlightName::INFO_SIGN),
+                    Severity::Hint => ('H', HighlightName::HINT_SIGN),
+                };
+                let style = self.highlight_id_by_name(hl_name).style(&theme)?;
+                Some((line, (sign, style.into())))
+            })
+            .collect()
     }
 
     fn refresh_diagnostic_marks(&mut self, buf: BufferId) {
-        let ns = self.create_namespace("lsp-diagnostics".to_string());
+        let ns = self.create_namespace(DIAGNOSTICS_NAMESPACE);
 
         let Some(diagnostics) =
             self.buffer(buf).file_path().and_then(|path| self.diagnostics.get(&path))
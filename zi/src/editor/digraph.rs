@@ -0,0 +1,78 @@
+use anyhow::{anyhow, bail};
+use zi_input::{KeyCode, KeyEvent};
+
+use super::{Result, mode};
+use crate::digraph::digraph;
+use crate::{Editor, Mode};
+
+/// Waiting for the keys naming a character to insert, `<C-k>` or `<C-v>` in insert mode.
+#[derive(Debug, Clone)]
+pub(super) enum CharPending {
+    /// The two keys of a digraph, `<C-k>{char}{char}`.
+    Digraph(Option<char>),
+    /// `<C-v>`, the next key is inserted as is unless it starts a code point.
+    Literal,
+    /// The hex digits of a code point, 4 for `<C-v>u` and 8 for `<C-v>U`.
+    CodePoint { digits: String, len: usize },
+}
+
+impl Editor {
+    /// Wait for the two keys of a digraph to insert, `<C-k>`.
+    pub fn select_digraph(&mut self) {
+        self.char_pending = Some(CharPending::Digraph(None));
+        self.status_message = Some("^K".to_string());
+    }
+
+    /// Wait for a key to insert literally or the hex digits of a code point, `<C-v>`.
+    pub fn select_literal(&mut self) {
+        self.char_pending = Some(CharPending::Literal);
+        self.status_message = Some("^V".to_string());
+    }
+
+    /// Handle the next key after `<C-k>` or `<C-v>`.
+    /// Any key that doesn't fit the sequence cancels it without inserting anything.
+    pub(super) fn char_pending_key(&mut self, pending: CharPending, key: &KeyEvent) -> Result<()> {
+        if mode!(self) != Mode::Insert {
+            return Ok(());
+        }
+
+        let c = match (pending, key.code()) {
+            (_, KeyCode::Esc) => return Ok(()),
+            (CharPending::Digraph(None), KeyCode::Char(c)) => {
+                self.status_message = Some(format!("^K{c}"));
+                self.char_pending = Some(CharPending::Digraph(Some(c)));
+                return Ok(());
+            }
+            (CharPending::Digraph(Some(first)), KeyCode::Char(c)) => {
+                digraph(first, c).ok_or_else(|| anyhow!("unknown digraph `{first}{c}`"))?
+            }
+            (CharPending::Literal, KeyCode::Char(c @ ('u' | 'U'))) => {
+                let len = if c == 'u' { 4 } else { 8 };
+                self.status_message = Some(format!("^V{c}"));
+                self.char_pending = Some(CharPending::CodePoint { digits: String::new(), len });
+                return Ok(());
+            }
+            (CharPending::Literal, KeyCode::Char(c)) => c,
+            (CharPending::Literal, KeyCode::Tab) => '\t',
+            (CharPending::CodePoint { mut digits, len }, KeyCode::Char(c))
+                if c.is_ascii_hexdigit() =>
+            {
+                digits.push(c);
+                if digits.len() < len {
+                    let prefix = if len == 4 { 'u' } else { 'U' };
+                    self.status_message = Some(format!("^V{prefix}{digits}"));
+                    self.char_pending = Some(CharPending::CodePoint { digits, len });
+                    return Ok(());
+                }
+
+                let n = u32::from_str_radix(&digits, 16).expect("just checked the digits");
+                char::from_u32(n).ok_or_else(|| anyhow!("invalid code point U+{n:04X}"))?
+            }
+            (CharPending::CodePoint { .. }, _) => bail!("expected a hex digit"),
+            _ => return Ok(()),
+        };
+
+        self.handle_insert_literal(c)?;
+        Ok(())
+    }
+}
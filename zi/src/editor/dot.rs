@@ -13,6 +13,13 @@ pub(super) struct Dot {
     replaying: bool,
     /// Keys pressed in Normal mode before a recording starts
     normal_keys: Vec<KeyEvent>,
+    /// The count typed in Normal mode before a recording starts.
+    /// Counts aren't recorded as keys, so a count given to `.` can replace the count of the change.
+    normal_count: Option<usize>,
+    /// The count typed before the last change, e.g. the `2` of `2dw`
+    count: Option<usize>,
+    /// The count typed after the operator of the last change, e.g. the `3` of `d3w`
+    operator_count: Option<usize>,
 }
 
 impl Dot {
@@ -20,6 +27,8 @@ impl Dot {
     pub(super) fn start_recording(&mut self) {
         self.events.clear();
         self.events.append(&mut self.normal_keys);
+        self.count = self.normal_count.take();
+        self.operator_count = None;
         self.recording = true;
     }
 
@@ -32,6 +41,26 @@ impl Dot {
 
     pub(super) fn clear_normal_keys(&mut self) {
         self.normal_keys.clear();
+        self.normal_count = None;
+    }
+
+    /// Save the count just updated by a digit key in place of the key itself.
+    pub(super) fn save_count(&mut self, mode: Mode, count: usize) {
+        if self.replaying {
+            return;
+        }
+
+        match mode {
+            Mode::Normal => {
+                self.normal_keys.pop();
+                self.normal_count = Some(count);
+            }
+            Mode::OperatorPending(_) if self.recording => {
+                self.events.pop();
+                self.operator_count = Some(count);
+            }
+            _ => (),
+        }
     }
 
     /// Finalize recording of a Normal mode change
@@ -75,6 +104,22 @@ impl Dot {
         &self.events
     }
 
+    /// Replace the count of the last change, the next `.` repeats it with the count given to this one.
+    pub(super) fn replace_count(&mut self, count: usize) {
+        self.count = Some(count);
+        self.operator_count = None;
+    }
+
+    /// The count of the last change, the counts before and after its operator multiply like they did for the change.
+    pub(super) fn count(&self) -> Option<usize> {
+        match (self.count, self.operator_count) {
+            (None, None) => None,
+            (count, operator_count) => {
+                Some(count.unwrap_or(1).saturating_mul(operator_count.unwrap_or(1)))
+            }
+        }
+    }
+
     /// Check if a mode transition should start recording
     pub(super) fn should_start_recording(from: Mode, to: Mode) -> bool {
         matches!(
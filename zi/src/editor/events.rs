@@ -10,6 +10,14 @@ impl Editor {
 
         event::subscribe_with::<event::DidSaveBuffer>(|editor, event| {
             editor.refresh_semantic_tokens(event.buf);
+            editor.schedule_git_refresh(event.buf);
+            editor.watch_file(event.buf);
+            HandlerResult::Continue
+        });
+
+        event::subscribe_with::<event::DidOpenBuffer>(|editor, event| {
+            editor.schedule_git_refresh(event.buf);
+            editor.watch_file(event.buf);
             HandlerResult::Continue
         });
 
@@ -26,6 +34,11 @@ impl Editor {
                 editor.refresh_semantic_tokens(Active.select(editor))
             }
 
+            #[cfg(unix)]
+            if event.to == Mode::Insert {
+                editor.follow_terminal_cursor(Active);
+            }
+
             // Handle dot repeat recording based on mode transitions
             if !editor.dot.is_replaying() {
                 if Dot::should_start_recording(event.from, event.to) {
@@ -43,14 +56,17 @@ impl Editor {
                 return HandlerResult::Continue;
             }
 
+            let is_trigger = editor.is_completion_trigger(event.char);
             let State::Insert(state) = &mut editor.state else { return HandlerResult::Continue };
 
             match event.char {
                 'a'..='z' | 'A'..='Z' | '0'..='9' | '_' => match &mut state.completion {
-                    Completion::Active(state) => state.update_query(Some(event.char)),
+                    Completion::Active(state) => {
+                        state.update_query(Some(event.char));
+                    }
                     Completion::Inactive => editor.trigger_completion(Some(event.char)),
                 },
-                '.' | ':' => {
+                _ if is_trigger => {
                     state.completion.deactivate();
                     editor.trigger_completion(Some(event.char));
                 }
@@ -69,19 +85,30 @@ impl Editor {
                 return HandlerResult::Continue;
             };
 
-            if let Completion::Active(state) = &mut state.completion {
-                state.update_query(None)
+            // Deleting past the start of the completed word ends the completion.
+            if let Completion::Active(active) = &mut state.completion {
+                if !active.update_query(None) {
+                    state.completion.deactivate();
+                }
             }
 
             HandlerResult::Continue
         });
 
         // Detect normal mode changes for dot repeat
-        event::subscribe_with::<event::DidChangeBuffer>(|editor, _event| {
+        event::subscribe_with::<event::DidChangeBuffer>(|editor, event| {
             if editor.mode() == Mode::Normal && !editor.dot.is_replaying() {
                 editor.dot.finalize_normal_mode_change();
             }
 
+            editor.schedule_git_diff(event.buf);
+
+            HandlerResult::Continue
+        });
+
+        // Keep the tabstops of the snippet being filled in over the text they cover.
+        event::subscribe_with::<event::DidChangeBuffer>(|editor, event| {
+            editor.shift_snippet(event.buf, &event.deltas);
             HandlerResult::Continue
         });
     }
@@ -0,0 +1,165 @@
+use std::future::Future;
+use std::io;
+use std::ops::RangeInclusive;
+use std::path::{Path, PathBuf};
+use std::process::Stdio;
+
+use anyhow::{Context as _, bail};
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+use zi_text::{AnyText, Deltas, Text as _, TextSlice as _};
+
+use super::state::State;
+use super::{Result, Selector};
+use crate::buffer::SnapshotFlags;
+use crate::{BufferId, Editor, Error, Mode, Point, ViewId};
+
+/// The number of lines written to the filter at a time.
+const FILTER_BATCH_LINES: usize = 1024;
+
+/// The most output a filter can write, it's held in memory until it replaces the lines in one edit.
+const FILTER_MAX_OUTPUT: u64 = 1 << 30;
+
+impl Editor {
+    /// Replace the given lines (0-indexed, inclusive) of the buffer in the view with the output of the shell command,
+    /// the lines are its input. The replacement is a single undo step.
+    /// The buffer is left alone if the command fails or the buffer changes before the command finishes.
+    pub fn filter_lines(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        lines: RangeInclusive<usize>,
+        command: &str,
+    ) -> impl Future<Output = Result<()>> + Send + 'static {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let buffer = &self[buf];
+        let version = buffer.version();
+        // The lines are streamed to the command from a snapshot, so the buffer isn't held up in the meantime.
+        let text = dyn_clone::clone_box(buffer.text());
+        let dir = buffer.file_path().and_then(|path| path.parent().map(Path::to_path_buf));
+        let command = command.to_string();
+        let client = self.client();
+        async move {
+            let output = run_filter(&command, dir, &*text, lines.clone()).await?;
+            client
+                .with(move |editor| editor.apply_filtered(view, buf, version, lines, output))
+                .await
+        }
+    }
+
+    /// Start typing the command to filter the lines through, `!{motion}` or `!` in visual mode.
+    /// Like vim, the command line starts with the range of the lines, e.g. `:.,.+2!`.
+    pub(super) fn select_filter_command(&mut self, range: &str) {
+        self.command_mode_with(format!(":{range}!"));
+    }
+
+    /// Enter command mode with the command line already started.
+    pub(super) fn command_mode_with(&mut self, buffer: String) {
+        self.set_mode(Mode::Command);
+        let State::Command(state) = &mut self.state else { unreachable!("just set command mode") };
+        state.buffer = buffer;
+    }
+
+    fn apply_filtered(
+        &mut self,
+        view: ViewId,
+        buf: BufferId,
+        version: u32,
+        lines: RangeInclusive<usize>,
+        mut output: String,
+    ) -> Result<()> {
+        if self[buf].version() != version {
+            bail!("the buffer changed while it was being filtered, the output was discarded");
+        }
+
+        let text = self[buf].text();
+        let start = text.line_to_byte(*lines.start());
+        let end = text.try_line_to_byte(lines.end() + 1).unwrap_or(text.len_bytes());
+        // The newline after the last line is kept, so a command that doesn't end its output with one doesn't join
+        // the lines after.
+        if text.char_before_byte(end) == Some('\n') && !output.is_empty() && !output.ends_with('\n')
+        {
+            output.push('\n');
+        }
+
+        self.edit(buf, &Deltas::single(start..end, output))?;
+        self[buf].snapshot(SnapshotFlags::empty());
+
+        if self.views.get(view).is_some_and(|view| view.buffer() == buf) {
+            self.set_cursor(view, Point::new(*lines.start(), 0));
+        }
+        Ok(())
+    }
+}
+
+/// Run the shell command with the lines of the text as its input returning its output, the error contains its stderr
+/// if it fails. The lines are written a batch at a time as the command reads them rather than copied out up front.
+/// The output is read as it's written, the command is killed if it writes more than `FILTER_MAX_OUTPUT` bytes.
+async fn run_filter(
+    command: &str,
+    dir: Option<PathBuf>,
+    text: &dyn AnyText,
+    lines: RangeInclusive<usize>,
+) -> Result<String> {
+    let mut cmd = tokio::process::Command::new("sh");
+    cmd.arg("-c")
+        .arg(command)
+        .stdin(Stdio::piped())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::piped())
+        .kill_on_drop(true);
+    if let Some(dir) = dir {
+        cmd.current_dir(dir);
+    }
+
+    let mut child = cmd.spawn().with_context(|| format!("failed to run `{command}`"))?;
+    let mut stdin = child.stdin.take().expect("stdin is piped");
+    let stdout = child.stdout.take().expect("stdout is piped");
+    let mut stderr = child.stderr.take().expect("stderr is piped");
+    // Write while the output is read, the command may fill the stdout pipe before it's read all its input.
+    // Stdin is dropped after writing so the command sees the end of its input.
+    let write = async move {
+        let mut line = *lines.start();
+        while line <= *lines.end() {
+            let next = lines.end().saturating_add(1).min(line + FILTER_BATCH_LINES);
+            let start = text.line_to_byte(line);
+            let end = text.try_line_to_byte(next).unwrap_or(text.len_bytes());
+            let batch = text.byte_slice(start..end).to_cow();
+            match stdin.write_all(batch.as_bytes()).await {
+                // Commands that don't need their input (e.g. `date`) may exit without reading it.
+                Err(err) if err.kind() == io::ErrorKind::BrokenPipe => break,
+                written => written.with_context(|| format!("failed to write to `{command}`"))?,
+            }
+            line = next;
+        }
+        Ok::<_, Error>(())
+    };
+
+    // Reading one byte past the limit tells a command that wrote too much apart from one that wrote just enough.
+    let read = async move {
+        let mut output = vec![];
+        stdout.take(FILTER_MAX_OUTPUT + 1).read_to_end(&mut output).await?;
+        if output.len() as u64 > FILTER_MAX_OUTPUT {
+            bail!(
+                "`{command}` wrote more than {} MiB, the lines were left alone",
+                FILTER_MAX_OUTPUT >> 20
+            );
+        }
+        Ok::<_, Error>(output)
+    };
+
+    let read_stderr = async move {
+        let mut output = vec![];
+        stderr.read_to_end(&mut output).await?;
+        Ok::<_, Error>(output)
+    };
+
+    // The first error stops the others, the command is killed when it's dropped.
+    let ((), stdout, stderr) = tokio::try_join!(write, read, read_stderr)?;
+    let status = child.wait().await?;
+    if !status.success() {
+        let stderr = String::from_utf8_lossy(&stderr);
+        bail!("`{command}` exited with {status}: {}", stderr.trim());
+    }
+
+    String::from_utf8(stdout).with_context(|| format!("`{command}` wrote invalid utf-8"))
+}
@@ -0,0 +1,75 @@
+use std::ops::Range;
+
+use zi_text::Text as _;
+
+use super::Selector;
+use crate::view::{FoldKind, Folds, SetCursorFlags};
+use crate::{Editor, Point, ViewId};
+
+impl Editor {
+    #[inline]
+    pub fn folds(&self, selector: impl Selector<ViewId>) -> &Folds {
+        self.view(selector).folds()
+    }
+
+    /// Create a closed fold over the lines of the byte range, `zf`.
+    pub(super) fn create_fold(&mut self, selector: impl Selector<ViewId>, range: Range<usize>) {
+        let view = selector.select(self);
+        let text = self[self[view].buffer()].text();
+        let start = text.byte_to_line(range.start);
+        // The range is exclusive, so a range ending at the start of a line doesn't include that line.
+        let end = text.byte_to_line(range.end.saturating_sub(1).max(range.start));
+
+        if self[view].folds_mut().add(start..=end, FoldKind::Manual) {
+            self.update_cursor_for_folds(view);
+        }
+    }
+
+    /// Open the closed fold under the cursor, or close the innermost fold under the cursor, `za`.
+    pub fn toggle_fold(&mut self, selector: impl Selector<ViewId>) {
+        let view = selector.select(self);
+        self.refresh_syntax_folds(view);
+
+        let line = self[view].cursor().line();
+        if !self[view].folds_mut().toggle(line) {
+            self.set_error("no fold found");
+            return;
+        }
+
+        self.update_cursor_for_folds(view);
+    }
+
+    /// Open every fold in the view, `zR`.
+    pub fn open_all_folds(&mut self, selector: impl Selector<ViewId>) {
+        let view = selector.select(self);
+        self.refresh_syntax_folds(view);
+        self[view].folds_mut().open_all();
+        self.update_cursor_for_folds(view);
+    }
+
+    /// Close every fold in the view, `zM`.
+    pub fn close_all_folds(&mut self, selector: impl Selector<ViewId>) {
+        let view = selector.select(self);
+        self.refresh_syntax_folds(view);
+        self[view].folds_mut().close_all();
+        self.update_cursor_for_folds(view);
+    }
+
+    /// The syntax folds are recomputed from the syntax tree on demand rather than on every edit.
+    fn refresh_syntax_folds(&mut self, view: ViewId) {
+        let buf = self[view].buffer();
+        let ranges = self[buf].syntax().map(|syntax| syntax.fold_ranges()).unwrap_or_default();
+        self[view].folds_mut().set_syntax(ranges);
+    }
+
+    /// A cursor hidden by a closed fold moves to the first line of the fold, and the view is scrolled to keep it visible.
+    fn update_cursor_for_folds(&mut self, view: ViewId) {
+        let cursor = self[view].cursor();
+        let line = self[view].folds().row_start(cursor.line());
+        self.set_cursor_flags(
+            view,
+            Point::new(line, cursor.col()),
+            SetCursorFlags::NO_FORCE_UPDATE_TARGET,
+        );
+    }
+}
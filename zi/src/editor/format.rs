@@ -0,0 +1,170 @@
+use std::future::Future;
+use std::path::{Path, PathBuf};
+use std::process::Stdio;
+
+use anyhow::{Context as _, bail};
+use futures_core::future::BoxFuture;
+use futures_util::{FutureExt, TryFutureExt};
+use tokio::io::AsyncWriteExt;
+use zi_text::{Deltas, Text as _, TextMut as _};
+
+use super::{Result, Selector, active_servers_of, cursor};
+use crate::buffer::SnapshotFlags;
+use crate::event::{self, AsyncEventHandler};
+use crate::language_service::{ResponseFuture, lstypes};
+use crate::{BufferId, Editor, Formatter};
+
+impl Editor {
+    /// Format the buffer with the formatter configured for its language, or a language service if there is none.
+    /// The formatted text is applied as a line diff so the cursor and marks on unchanged lines stay put.
+    /// Nothing is formatted if the buffer changes before the formatter finishes.
+    pub fn format(
+        &mut self,
+        selector: impl Selector<BufferId>,
+    ) -> impl Future<Output = Result<()>> + Send + 'static {
+        let buf = selector.select(self);
+        let buffer = &self[buf];
+        let version = buffer.version();
+        let text = buffer.text().to_string();
+        let formatter = self
+            .language_config
+            .languages
+            .get(&buffer.file_type())
+            .and_then(|config| config.formatter.clone());
+
+        let fut: BoxFuture<'static, Result<Option<String>>> = if text.trim().is_empty() {
+            // Formatters tend to reject empty input (`gofmt` wants a package clause), there is nothing to format anyway.
+            async { Ok(None) }.boxed()
+        } else if let Some(formatter) = formatter {
+            let dir = buffer.file_path().and_then(|path| path.parent().map(Path::to_path_buf));
+            run_formatter(formatter, dir, text.clone()).map_ok(Some).boxed()
+        } else if let Some(fut) = self.request_format(buf) {
+            let mut formatted = text.clone();
+            async move {
+                let Some(deltas) = fut.await? else { return Ok(None) };
+                formatted.edit(&deltas);
+                Ok(Some(formatted))
+            }
+            .boxed()
+        } else {
+            async { Ok(None) }.boxed()
+        };
+
+        let client = self.client();
+        async move {
+            let Some(formatted) = fut.await? else { return Ok(()) };
+            client.with(move |editor| editor.apply_formatted(buf, version, &text, formatted)).await
+        }
+    }
+
+    fn request_format(&mut self, buf: BufferId) -> Option<ResponseFuture<Option<Deltas<'static>>>> {
+        let tab_size = *self[buf].settings().tab_width.read() as u32;
+        let url = self[buf].file_url().cloned()?;
+        let server = active_servers_of!(self, buf).copied().find(|server| {
+            self.active_language_services[server].formatting_capabilities().is_some()
+        })?;
+
+        let server = self.active_language_services.get_mut(&server).unwrap();
+        Some(server.format(lstypes::DocumentFormattingParams {
+            url,
+            options: lstypes::FormattingOptions { tab_size },
+        }))
+    }
+
+    fn apply_formatted(
+        &mut self,
+        buf: BufferId,
+        version: u32,
+        text: &str,
+        mut formatted: String,
+    ) -> Result<()> {
+        if self[buf].version() != version {
+            assert!(self[buf].version() > version, "version has gone down?");
+            tracing::info!(
+                "buffer version changed, skipping formatting: {} > {version}",
+                self[buf].version(),
+            );
+            return Ok(());
+        }
+
+        if text.ends_with('\n') && !formatted.ends_with('\n') {
+            formatted.push('\n');
+        }
+
+        // An unchanged buffer shouldn't get an undo entry or be marked dirty.
+        let deltas = Deltas::diff(text, &formatted);
+        if deltas.is_empty() {
+            return Ok(());
+        }
+
+        // The edit takes care of the other views, the active one is left to us.
+        // Its cursor stays on the same text if its line is unchanged, and at the same point otherwise.
+        let view = self.tree.active();
+        let cursor = (self[view].buffer() == buf).then(|| {
+            let point = self[view].cursor();
+            let byte = self[buf].text().point_to_byte(point);
+            let within = deltas.iter().any(|delta| delta.range().contains(&byte));
+            (point, byte, within)
+        });
+
+        self.edit(buf, &deltas)?;
+        self[buf].snapshot(SnapshotFlags::empty());
+
+        match cursor {
+            Some((point, _, true)) => self.set_cursor(view, point),
+            Some((_, byte, false)) => self.set_cursor(view, cursor::shift_byte(&deltas, byte)),
+            None => {}
+        }
+        Ok(())
+    }
+
+    /// Format the buffer before it's written if `format_on_save` is set.
+    /// A failing formatter fails the save, its error is better than silently writing unformatted text.
+    pub(super) fn format_before_save() -> impl AsyncEventHandler<Event = event::WillSaveBuffer> {
+        event::async_handler::<event::WillSaveBuffer, _>(|client, event| async move {
+            let fut = client
+                .with(move |editor| {
+                    let format = *editor[event.buf].settings().format_on_save.read();
+                    format.then(|| editor.format(event.buf))
+                })
+                .await;
+
+            if let Some(fut) = fut {
+                fut.await?;
+            }
+
+            Ok(event::HandlerResult::Continue)
+        })
+    }
+}
+
+/// Pipe the text through the formatter, the error contains its stderr if it fails.
+async fn run_formatter(formatter: Formatter, dir: Option<PathBuf>, text: String) -> Result<String> {
+    let mut cmd = tokio::process::Command::new(&formatter.command);
+    cmd.args(&formatter.args)
+        .stdin(Stdio::piped())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::piped())
+        .kill_on_drop(true);
+    if let Some(dir) = dir {
+        cmd.current_dir(dir);
+    }
+
+    let mut child =
+        cmd.spawn().with_context(|| format!("failed to run `{}`", formatter.command))?;
+    let mut stdin = child.stdin.take().expect("stdin is piped");
+    // Write while the output is read, the formatter may fill the stdout pipe before it's read all its input.
+    // Stdin is dropped after writing so the formatter sees the end of its input.
+    let write = async move { stdin.write_all(text.as_bytes()).await };
+    let (written, output) = tokio::join!(write, child.wait_with_output());
+    let output = output?;
+    if !output.status.success() {
+        let stderr = String::from_utf8_lossy(&output.stderr);
+        bail!("`{}` exited with {}: {}", formatter.command, output.status, stderr.trim());
+    }
+
+    // The formatter exiting successfully without reading all of its input is suspicious.
+    written.with_context(|| format!("failed to write to `{}`", formatter.command))?;
+    String::from_utf8(output.stdout)
+        .with_context(|| format!("`{}` wrote invalid utf-8", formatter.command))
+}
@@ -0,0 +1,358 @@
+use std::collections::BTreeMap;
+use std::ffi::{OsStr, OsString};
+use std::future::Future;
+use std::mem;
+use std::ops::Range;
+use std::path::Path;
+use std::process::Stdio;
+use std::sync::Arc;
+use std::time::Duration;
+
+use anyhow::{Context as _, bail};
+use zi_text::{Deltas, Text as _};
+
+use super::{Result, Selector, request_redraw};
+use crate::buffer::SnapshotFlags;
+use crate::syntax::HighlightName;
+use crate::{BufferFlags, BufferId, Editor, Point, ViewId};
+
+/// Rediffing on every keystroke is wasteful, wait for this long after the first edit before rediffing the buffer.
+const GIT_DIFF_DEBOUNCE: Duration = Duration::from_millis(100);
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum HunkKind {
+    Added,
+    Changed,
+    Deleted,
+}
+
+/// A run of lines that differ between the buffer and the git index.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Hunk {
+    kind: HunkKind,
+    /// The lines of the buffer, this is empty for deletions.
+    lines: Range<usize>,
+    /// The lines of the file in the index, this is empty for additions.
+    base: Range<usize>,
+}
+
+impl Hunk {
+    #[inline]
+    pub fn kind(&self) -> HunkKind {
+        self.kind
+    }
+
+    #[inline]
+    pub fn lines(&self) -> Range<usize> {
+        self.lines.clone()
+    }
+
+    /// The first line with a sign, deleted lines are marked on the line above them.
+    #[inline]
+    pub fn first_line(&self) -> usize {
+        match self.kind {
+            HunkKind::Deleted => self.lines.start.saturating_sub(1),
+            HunkKind::Added | HunkKind::Changed => self.lines.start,
+        }
+    }
+
+    fn contains(&self, line: usize) -> bool {
+        self.lines.contains(&line) || self.first_line() == line
+    }
+}
+
+/// The diff of a buffer against the git index.
+/// Buffers without a file in a git repository don't have one.
+#[derive(Debug, Default)]
+pub(super) struct GitDiff {
+    /// The contents of the file in the index, this is empty for untracked files.
+    base: Arc<str>,
+    hunks: Vec<Hunk>,
+    /// A rediff is already scheduled.
+    pending: bool,
+}
+
+impl Editor {
+    /// The hunks of the buffer's diff against the git index, in order.
+    pub fn git_hunks(&self, selector: impl Selector<BufferId>) -> &[Hunk] {
+        let buf = selector.select(self);
+        self.git_diffs.get(&buf).map_or(&[], |diff| &diff.hunks)
+    }
+
+    /// Reread the buffer's file from the git index and rediff the buffer against it.
+    /// Buffers without a file in a git repository have no hunks, this isn't an error.
+    pub fn refresh_git_diff(
+        &mut self,
+        selector: impl Selector<BufferId>,
+    ) -> impl Future<Output = Result<()>> + Send + 'static {
+        let buf = selector.select(self);
+        let fut = self.read_git_index(buf);
+        let client = self.client();
+        async move {
+            let base = fut.await?;
+            client.with(move |editor| editor.set_git_base(buf, base)).await;
+            Ok(())
+        }
+    }
+
+    /// Refresh the diff in the background, this is done when a buffer is opened or saved.
+    pub(super) fn schedule_git_refresh(&mut self, buf: BufferId) {
+        let fut = self.read_git_index(buf);
+        self.callback("refresh git diff", fut, move |editor, base| {
+            editor.set_git_base(buf, base);
+            request_redraw();
+            Ok(())
+        });
+    }
+
+    /// Rediff the buffer against the index it was last diffed against after an edit.
+    pub(super) fn schedule_git_diff(&mut self, buf: BufferId) {
+        let Some(diff) = self.git_diffs.get_mut(&buf) else { return };
+        if mem::replace(&mut diff.pending, true) {
+            return;
+        }
+
+        self.callback(
+            "update git diff",
+            async {
+                tokio::time::sleep(GIT_DIFF_DEBOUNCE).await;
+                Ok(())
+            },
+            move |editor, ()| {
+                if let Some(diff) = editor.git_diffs.get_mut(&buf) {
+                    diff.pending = false;
+                    editor.update_git_hunks(buf);
+                    request_redraw();
+                }
+                Ok(())
+            },
+        );
+    }
+
+    fn read_git_index(
+        &self,
+        buf: BufferId,
+    ) -> impl Future<Output = Result<Option<String>>> + Send + 'static {
+        // Diffing needs the whole text in memory which defeats the point of a large file buffer.
+        let path =
+            self[buf].file_path().filter(|_| !self[buf].flags().contains(BufferFlags::LARGE));
+        async move {
+            match path {
+                Some(path) => read_git_index(&path).await,
+                None => Ok(None),
+            }
+        }
+    }
+
+    fn set_git_base(&mut self, buf: BufferId, base: Option<String>) {
+        // The buffer may have been closed in the meantime.
+        match base {
+            Some(base) if self.buffers.contains_key(buf) => {
+                self.git_diffs.entry(buf).or_default().base = base.into();
+                self.update_git_hunks(buf);
+            }
+            _ => {
+                self.git_diffs.remove(&buf);
+            }
+        }
+    }
+
+    fn update_git_hunks(&mut self, buf: BufferId) {
+        if !self.buffers.contains_key(buf) {
+            self.git_diffs.remove(&buf);
+            return;
+        }
+
+        let Some(diff) = self.git_diffs.get_mut(&buf) else { return };
+        let text = self.buffers[buf].text().to_string();
+        diff.hunks = hunks(&diff.base, &text);
+    }
+
+    /// The gutter sign for each line of a hunk within the given lines.
+    pub(super) fn git_signs(
+        &self,
+        buf: BufferId,
+        lines: Range<usize>,
+    ) -> BTreeMap<usize, (char, tui::Style)> {
+        let theme = self.theme();
+        let theme = theme.read();
+        let mut signs = BTreeMap::new();
+        for hunk in self.git_hunks(buf) {
+            let (sign, hl_name, range) = match hunk.kind {
+                HunkKind::Added => ('+', HighlightName::GIT_ADDED_SIGN, hunk.lines()),
+                HunkKind::Changed => ('~', HighlightName::GIT_CHANGED_SIGN, hunk.lines()),
+                // There is no line above a deletion at the start of the file, so it's marked on the first line instead.
+                HunkKind::Deleted if hunk.lines.start == 0 => {
+                    ('‾', HighlightName::GIT_DELETED_SIGN, 0..1)
+                }
+                HunkKind::Deleted => {
+                    ('_', HighlightName::GIT_DELETED_SIGN, hunk.first_line()..hunk.lines.start)
+                }
+            };
+
+            let Some(style) = self.highlight_id_by_name(hl_name).style(&theme) else { continue };
+            let style = tui::Style::from(style);
+            for line in range.start.max(lines.start)..range.end.min(lines.end) {
+                signs.insert(line, (sign, style));
+            }
+        }
+
+        signs
+    }
+
+    /// Move the cursor to the start of the next hunk, `]c`.
+    pub fn goto_next_hunk(&mut self, selector: impl Selector<ViewId>) -> Result<()> {
+        self.goto_hunk(selector, |line, hunks| {
+            hunks.iter().map(Hunk::first_line).find(|&start| start > line)
+        })
+    }
+
+    /// Move the cursor to the start of the previous hunk, `[c`.
+    pub fn goto_prev_hunk(&mut self, selector: impl Selector<ViewId>) -> Result<()> {
+        self.goto_hunk(selector, |line, hunks| {
+            hunks.iter().rev().map(Hunk::first_line).find(|&start| start < line)
+        })
+    }
+
+    fn goto_hunk(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        find: impl FnOnce(usize, &[Hunk]) -> Option<usize>,
+    ) -> Result<()> {
+        let view = selector.select(self);
+        let line = self[view].cursor().line();
+        let Some(target) = find(line, self.git_hunks(self[view].buffer())) else {
+            bail!("no more hunks")
+        };
+
+        let from = self.current_location();
+        self.set_cursor(view, Point::new(target, 0));
+        self.record_jump(from);
+        Ok(())
+    }
+
+    /// Replace the hunk under the cursor with the lines from the index, `:reverthunk`.
+    pub fn revert_hunk(&mut self, selector: impl Selector<ViewId>) -> Result<()> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let line = self[view].cursor().line();
+        // The hunks may be stale if a rediff is pending.
+        self.update_git_hunks(buf);
+
+        let Some(diff) = self.git_diffs.get(&buf) else {
+            bail!("buffer is not in a git repository")
+        };
+        let Some(hunk) = diff.hunks.iter().find(|hunk| hunk.contains(line)) else {
+            bail!("no hunk under the cursor")
+        };
+
+        let text = self[buf].text();
+        let byte = |line| text.try_line_to_byte(line).unwrap_or(text.len_bytes());
+        let range = byte(hunk.lines.start)..byte(hunk.lines.end);
+        let base = diff
+            .base
+            .split_inclusive('\n')
+            .skip(hunk.base.start)
+            .take(hunk.base.len())
+            .collect::<String>();
+
+        self.edit(buf, &Deltas::single(range, base))?;
+        self[buf].snapshot(SnapshotFlags::empty());
+        self.update_git_hunks(buf);
+        Ok(())
+    }
+}
+
+/// The hunks that turn `base` into `text`.
+fn hunks(base: &str, text: &str) -> Vec<Hunk> {
+    let mut hunks = vec![];
+    // The difference between the buffer and index line numbers after the hunks so far.
+    let mut shift = 0isize;
+    let mut base_line = 0;
+    let mut base_byte = 0;
+    let deltas = Deltas::diff(base, text);
+    // The deltas are ordered by their start descending, but the line numbers are counted from the top.
+    let mut deltas = deltas.iter().collect::<Vec<_>>();
+    deltas.reverse();
+    for delta in deltas {
+        let range = delta.range();
+        base_line += base[base_byte..range.start].matches('\n').count();
+        base_byte = range.start;
+
+        let removed = base[range].split_inclusive('\n').count();
+        let added = delta.text().split_inclusive('\n').count();
+        let kind = match (removed, added) {
+            (0, _) => HunkKind::Added,
+            (_, 0) => HunkKind::Deleted,
+            _ => HunkKind::Changed,
+        };
+
+        let line = (base_line as isize + shift) as usize;
+        hunks.push(Hunk { kind, lines: line..line + added, base: base_line..base_line + removed });
+        shift += added as isize - removed as isize;
+    }
+
+    hunks
+}
+
+/// The contents of the file in the git index.
+/// Returns `None` if the file isn't in a git repository (or git isn't installed), and an empty string if the file is
+/// untracked so every line is an addition.
+async fn read_git_index(path: &Path) -> Result<Option<String>> {
+    let (Some(dir), Some(name)) = (path.parent(), path.file_name()) else { return Ok(None) };
+    let git = |args: &[&OsStr]| {
+        let mut cmd = tokio::process::Command::new("git");
+        cmd.args(args)
+            .current_dir(dir)
+            .stdin(Stdio::null())
+            .stdout(Stdio::piped())
+            .stderr(Stdio::null())
+            .kill_on_drop(true);
+        async move { cmd.output().await }
+    };
+
+    let Ok(output) = git(&[OsStr::new("rev-parse"), OsStr::new("--is-inside-work-tree")]).await
+    else {
+        return Ok(None);
+    };
+    if !output.status.success() || output.stdout.trim_ascii() != b"true" {
+        return Ok(None);
+    }
+
+    // `:./path` is the path relative to the current directory in the index.
+    let mut spec = OsString::from(":./");
+    spec.push(name);
+    let output =
+        git(&[OsStr::new("show"), spec.as_os_str()]).await.context("failed to run `git show`")?;
+    if !output.status.success() {
+        return Ok(Some(String::new()));
+    }
+
+    String::from_utf8(output.stdout).map(Some).context("file in the git index is not valid utf-8")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{Hunk, HunkKind, hunks};
+
+    #[test]
+    fn multiple_hunks() {
+        let hunk = |kind, lines, base| Hunk { kind, lines, base };
+        assert_eq!(
+            hunks("a\nb\nc\nd\ne\nf\n", "a\nB\nc\nd\nnew\ne\n"),
+            [
+                hunk(HunkKind::Changed, 1..2, 1..2),
+                hunk(HunkKind::Added, 4..5, 4..4),
+                hunk(HunkKind::Deleted, 6..6, 5..6),
+            ]
+        );
+        assert_eq!(
+            hunks("a\nb\nc\n", "x\ny\na\nc\nz\n"),
+            [
+                hunk(HunkKind::Added, 0..2, 0..0),
+                hunk(HunkKind::Deleted, 3..3, 1..2),
+                hunk(HunkKind::Added, 4..5, 3..3),
+            ]
+        );
+    }
+}
@@ -0,0 +1,188 @@
+use std::future::Future;
+
+use anyhow::bail;
+use stdx::merge::Merge;
+use tui::{Rect, Widget as _};
+
+use super::{Result, Selector, State, active_servers_of, get};
+use crate::syntax::HighlightName;
+use crate::{Editor, Point, ViewId, lstypes};
+
+/// The contents of a hover request displayed in a popup next to the cursor.
+/// The popup is dismissed by the next key press.
+#[derive(Debug)]
+pub(super) struct HoverPopup {
+    view: ViewId,
+    point: Point,
+    lines: Vec<HoverLine>,
+}
+
+#[derive(Debug, PartialEq, Eq)]
+struct HoverLine {
+    text: String,
+    /// Whether the line is within a fenced code block.
+    code: bool,
+}
+
+impl HoverPopup {
+    const MAX_WIDTH: u16 = 80;
+    const MAX_HEIGHT: u16 = 20;
+
+    fn new(view: ViewId, point: Point, markdown: &str) -> Self {
+        Self { view, point, lines: parse_markdown(markdown) }
+    }
+}
+
+/// A very rough markdown renderer, we only strip the code fences and tell apart the code blocks.
+fn parse_markdown(markdown: &str) -> Vec<HoverLine> {
+    let mut code = false;
+    let mut lines = vec![];
+    for line in markdown.lines() {
+        if line.trim_start().starts_with("```") {
+            code = !code;
+            continue;
+        }
+
+        // Collapse consecutive blank lines.
+        if line.trim().is_empty() && lines.last().is_none_or(|l: &HoverLine| l.text.is_empty()) {
+            continue;
+        }
+
+        lines.push(HoverLine { text: line.trim_end().to_string(), code });
+    }
+
+    while lines.last().is_some_and(|l| l.text.is_empty()) {
+        lines.pop();
+    }
+
+    lines
+}
+
+impl Editor {
+    /// Request hover information for the cursor position and display it in a popup.
+    pub fn hover(&mut self, selector: impl Selector<ViewId>) -> impl Future<Output = Result<()>> {
+        let view = selector.select(self);
+        let req = active_servers_of!(self, view)
+            .find(|server_id| {
+                self.active_language_services[server_id].hover_capabilities().is_some()
+            })
+            .copied()
+            .and_then(|server_id| {
+                let (view, buf) = get!(self: view);
+                let url = buf.file_url().cloned()?;
+                let point = view.cursor();
+                let server = self.active_language_services.get_mut(&server_id).unwrap();
+                tracing::debug!(%url, %point, "language request hover");
+                let fut = server.hover(lstypes::HoverParams {
+                    at: lstypes::TextDocumentPointParams { url, point },
+                });
+                Some((point, fut))
+            });
+
+        let client = self.client();
+        async move {
+            let Some((point, fut)) = req else {
+                bail!("no language server supports textDocument/hover")
+            };
+
+            let Some(hover) = fut.await? else { bail!("no hover information available") };
+            client
+                .with(move |editor| {
+                    // Don't show a stale popup if the cursor moved while the request was in flight.
+                    if editor[view].cursor() != point {
+                        return;
+                    }
+
+                    let popup = HoverPopup::new(view, point, &hover.contents);
+                    if !popup.lines.is_empty() {
+                        editor.hover = Some(popup);
+                    }
+                })
+                .await;
+            Ok(())
+        }
+    }
+
+    /// The text of the visible hover popup, if any.
+    pub fn hover_text(&self) -> Option<String> {
+        let popup = self.hover.as_ref()?;
+        Some(popup.lines.iter().map(|line| line.text.as_str()).collect::<Vec<_>>().join("\n"))
+    }
+
+    pub(super) fn render_hover(&self, view_area: Rect, surface: &mut tui::Buffer, view: ViewId) {
+        let Some(popup) = &self.hover else { return };
+        if popup.view != view || !matches!(self.state, State::Normal(..)) {
+            return;
+        }
+
+        let offset = self[view].offset();
+        if popup.point.line() < offset.line {
+            return;
+        }
+
+        let theme = self.theme();
+        let theme = theme.read();
+        let style = self
+            .highlight_id_by_name(HighlightName::HOVER)
+            .style(&theme)
+            .unwrap_or_else(|| theme.default_style());
+        let code_style = self
+            .highlight_id_by_name(HighlightName::STRING)
+            .style(&theme)
+            .map_or(style, |code| style.merge(code));
+
+        let width = popup
+            .lines
+            .iter()
+            .map(|line| line.text.chars().count() as u16 + 2)
+            .max()
+            .unwrap_or_default()
+            .min(HoverPopup::MAX_WIDTH);
+        let height = (popup.lines.len() as u16).min(HoverPopup::MAX_HEIGHT);
+
+        let x = view_area.x
+            + self[view].number_width.get()
+            + (popup.point.col().saturating_sub(offset.col)) as u16;
+        let cursor_y = view_area.y + (popup.point.line() - offset.line) as u16;
+        // Prefer showing the popup below the cursor, but go above if there is more room there.
+        let below = view_area.bottom().saturating_sub(cursor_y + 1);
+        let above = cursor_y.saturating_sub(view_area.y);
+        let (y, height) = if below >= height || below >= above {
+            (cursor_y + 1, height.min(below))
+        } else {
+            (cursor_y - height.min(above), height.min(above))
+        };
+
+        let area = Rect { x, y, width, height }.intersection(view_area);
+        tui::Clear.render(area, surface);
+        surface.set_style(area, style);
+        for (i, line) in popup.lines.iter().take(area.height as usize).enumerate() {
+            let style = if line.code { code_style } else { style };
+            surface.set_stringn(
+                area.x + 1,
+                area.y + i as u16,
+                &line.text,
+                area.width.saturating_sub(2) as usize,
+                style,
+            );
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn markdown_hover_lines() {
+        let lines = parse_markdown("```rust\nfn foo()\n```\n\n\n\nDocs for `foo`.\n\n");
+        assert_eq!(
+            lines,
+            vec![
+                HoverLine { text: "fn foo()".into(), code: true },
+                HoverLine { text: "".into(), code: false },
+                HoverLine { text: "Docs for `foo`.".into(), code: false },
+            ]
+        );
+    }
+}
@@ -0,0 +1,106 @@
+use zi_indent::Indent;
+use zi_text::{Deltas, Text as _, TextSlice as _};
+
+use super::{EditError, Selector};
+use crate::{BufferId, Editor, Point, ViewId};
+
+/// Typing one of these as the first character of a line reindents the line to match its opening bracket.
+const ELECTRIC_CHARS: [char; 3] = ['}', ')', ']'];
+
+impl Editor {
+    /// The width of the line's indentation, from the language's indent query if it has one and otherwise guessed from
+    /// the lines above it.
+    fn line_indent(&self, buf: BufferId, line: usize) -> usize {
+        let buf = &self[buf];
+        let tab_width = *buf.settings().tab_width.read();
+        let indent_width = buf.settings().indent.read().width(tab_width);
+        if let Some(level) = buf.syntax().and_then(|syntax| syntax.indent_level(buf.text(), line)) {
+            return level * indent_width as usize;
+        }
+
+        let config = zi_indent::Config { tab_width, indent_width };
+        match zi_indent::indent(config, buf.text(), line) {
+            Indent::Columns(width) => width,
+        }
+    }
+
+    /// Replace the indentation of the cursor line with the computed indentation, the cursor stays on the same character
+    /// or moves to the end of the indentation if it was within it.
+    fn reindent(&mut self, selector: impl Selector<ViewId>) -> Result<(), EditError> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let cursor = self[view].cursor();
+        let Some(current) = self[buf].text().line(cursor.line()).map(|line| line.indent()) else {
+            return Ok(());
+        };
+
+        let width = self.line_indent(buf, cursor.line());
+        let settings = self[buf].settings();
+        let indent = settings.indent.read().whitespace(*settings.tab_width.read(), width);
+
+        let text = self[buf].text();
+        let start = text.line_to_byte(cursor.line());
+        if text.byte_slice(start..start + current).to_cow() != indent {
+            self.edit(buf, &Deltas::single(start..start + current, indent.as_str()))?;
+        }
+
+        let col = indent.len() + cursor.col().saturating_sub(current);
+        self.set_cursor(view, Point::new(cursor.line(), col));
+        Ok(())
+    }
+
+    /// Indent the line opened by inserting a newline at `at`, the cursor is expected to be on that line.
+    /// The line that was left is trimmed if it's only indentation so blank lines don't keep the whitespace.
+    pub(super) fn indent_newline(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        at: Point,
+    ) -> Result<(), EditError> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+
+        // A newline at the start of a line moves the whole line down, its indentation is already right.
+        let moved = at.col() == 0
+            && self[buf]
+                .text()
+                .line(at.line() + 1)
+                .is_some_and(|line| line.chars().any(|c| !c.is_whitespace()));
+        if !moved {
+            // The rest of the split line keeps its text but not its leading whitespace.
+            self.set_cursor(view, Point::new(at.line() + 1, 0));
+            self.reindent(view)?;
+        }
+
+        let text = self[buf].text();
+        if let Some(line) = text.line(at.line()) {
+            if line.len_bytes() > 0 && line.chars().all(char::is_whitespace) {
+                let start = text.line_to_byte(at.line());
+                let end = start + line.len_bytes();
+                self.edit(buf, &Deltas::delete(start..end))?;
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Reindent the cursor line if the character just typed is the first on the line and dedents, e.g. `}`.
+    pub(super) fn indent_electric_char(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        c: char,
+    ) -> Result<(), EditError> {
+        if !ELECTRIC_CHARS.contains(&c) {
+            return Ok(());
+        }
+
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let cursor = self[view].cursor();
+        let Some(line) = self[buf].text().line(cursor.line()) else { return Ok(()) };
+        if line.indent() + c.len_utf8() != cursor.col() {
+            return Ok(());
+        }
+
+        self.reindent(view)
+    }
+}
@@ -0,0 +1,139 @@
+//! User keymaps, loaded from the `[keys]` table of `config.toml`.
+//!
+//! ```toml
+//! [keys]
+//! # How long to wait for the rest of a key sequence in milliseconds, defaults to 1000.
+//! timeout = 500
+//!
+//! [keys.normal]
+//! "<space>w" = "save"
+//! # Unbind a default, this also unbinds every sequence starting with it.
+//! "K" = "none"
+//!
+//! [keys.insert]
+//! "jk" = "normal_mode"
+//! ```
+//!
+//! The commands are the names of the actions of the default keymap.
+//! Each mode is `normal`, `insert`, `visual` (which covers all the visual modes) or `command`.
+
+use std::collections::HashMap;
+use std::time::Duration;
+
+use anyhow::bail;
+use zi_input::{KeyEvent, KeySequence};
+
+use super::{Action, Result, default_keymap};
+use crate::Mode;
+use crate::keymap::Keymap;
+
+pub(super) struct KeymapConfig {
+    pub timeout: Option<Duration>,
+    bindings: Vec<Binding>,
+}
+
+struct Binding {
+    modes: &'static [Mode],
+    keys: Vec<KeyEvent>,
+    /// `None` unbinds the keys.
+    action: Option<Action>,
+}
+
+impl KeymapConfig {
+    /// Parse the config, reporting every invalid or conflicting binding at once.
+    pub fn parse(src: &str) -> Result<Self> {
+        let config = toml::from_str::<toml::Table>(src)?;
+        let Some(keys) = config.get("keys") else {
+            return Ok(Self { timeout: None, bindings: vec![] });
+        };
+        let Some(keys) = keys.as_table() else { bail!("`keys` must be a table") };
+
+        let mut errors = vec![];
+        let mut timeout = None;
+        let mut bindings = vec![];
+        for (section, value) in keys {
+            if section == "timeout" {
+                match value.as_integer().and_then(|ms| u64::try_from(ms).ok()) {
+                    Some(ms) => timeout = Some(Duration::from_millis(ms)),
+                    None => {
+                        errors.push("`keys.timeout` must be a number of milliseconds".to_string())
+                    }
+                }
+                continue;
+            }
+
+            let modes: &'static [Mode] = match section.as_str() {
+                "normal" => &[Mode::Normal],
+                "insert" => &[Mode::Insert],
+                "visual" => &[Mode::Visual, Mode::VisualLine, Mode::VisualBlock],
+                "command" => &[Mode::Command],
+                _ => {
+                    errors.push(format!("unknown mode `{section}`"));
+                    continue;
+                }
+            };
+
+            let Some(table) = value.as_table() else {
+                errors.push(format!("`keys.{section}` must be a table"));
+                continue;
+            };
+
+            // Different spellings of the same keys, e.g. `<space>` and ` `, would silently override each other.
+            let mut seen = HashMap::<Vec<KeyEvent>, &str>::new();
+            for (src, command) in table {
+                let Ok(keys) = src.parse::<KeySequence>() else {
+                    errors.push(format!("invalid key sequence `{src}`"));
+                    continue;
+                };
+                let keys = keys.into_iter().collect::<Vec<_>>();
+
+                if let Some(prev) = seen.insert(keys.clone(), src) {
+                    errors.push(format!(
+                        "conflicting bindings for `{prev}` and `{src}` in {section} mode"
+                    ));
+                    continue;
+                }
+
+                let action = match command.as_str() {
+                    Some("none") => None,
+                    Some(name) => match default_keymap::action(name) {
+                        Some(action) => Some(action),
+                        None => {
+                            errors.push(format!("unknown command `{name}` for `{src}`"));
+                            continue;
+                        }
+                    },
+                    None => {
+                        errors.push(format!("the command for `{src}` must be a string"));
+                        continue;
+                    }
+                };
+
+                bindings.push(Binding { modes, keys, action });
+            }
+        }
+
+        if !errors.is_empty() {
+            bail!("{}", errors.join("; "));
+        }
+
+        Ok(Self { timeout, bindings })
+    }
+
+    /// Apply the bindings on top of the given keymap.
+    /// Unbinding happens first so a default can be unbound and then rebound with longer sequences.
+    pub fn apply(&self, keymap: &mut Keymap) {
+        for binding in self.bindings.iter().filter(|binding| binding.action.is_none()) {
+            for &mode in binding.modes {
+                keymap.remove(mode, binding.keys.iter().cloned());
+            }
+        }
+
+        for binding in &self.bindings {
+            let Some(action) = binding.action else { continue };
+            for &mode in binding.modes {
+                keymap.insert(mode, binding.keys.iter().cloned(), action);
+            }
+        }
+    }
+}
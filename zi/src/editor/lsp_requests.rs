@@ -7,7 +7,7 @@ use futures_core::future::BoxFuture;
 use futures_util::FutureExt;
 use url::Url;
 
-use super::{Result, Selector, active_servers_of, callback, event, get};
+use super::{Resource, Result, Selector, active_servers_of, callback, event, get};
 use crate::buffer::picker::{BufferPicker, BufferPickerEntry};
 use crate::language_service::{LanguageServiceInstance, lstypes};
 use crate::lstypes::{TextExt, WorkspaceFolder};
@@ -16,6 +16,9 @@ use crate::{
     OpenFlags, ViewId,
 };
 
+/// Give up on restarting a language service that keeps crashing.
+const MAX_LANGUAGE_SERVICE_RESTARTS: usize = 3;
+
 impl Editor {
     pub fn goto_definition(
         &mut self,
@@ -45,11 +48,28 @@ impl Editor {
         self.goto_definition_(selector, |editor, view| editor.find_implementations(view))
     }
 
+    /// Populate the quickfix list with the references to the symbol under the cursor and jump to the first.
     pub fn goto_references(
         &mut self,
         selector: impl Selector<ViewId>,
     ) -> impl Future<Output = Result<()>> {
-        self.goto_definition_(selector, |editor, view| editor.find_references(view))
+        let view = selector.select(self);
+        let fut = self.find_references(view);
+        let client = self.client();
+        async move {
+            let lstypes::GotoDefinitionResponse::Array(locations) = fut.await?;
+            if locations.is_empty() {
+                bail!("no references found");
+            }
+
+            client
+                .with(|editor| {
+                    editor.set_quickfix_locations(locations);
+                    editor.quickfix_next()
+                })
+                .await?
+                .await
+        }
     }
 
     fn goto_definition_<Fut>(
@@ -208,7 +228,19 @@ impl Editor {
                 let workspace_root = self.lsp_workspace_root(service_id);
                 let (service, fut) = self.language_config.language_services[&service_id]
                     .spawn(&root_path, client)?;
-                let handle = tokio::spawn(fut);
+                let client = self.client();
+                let handle = tokio::spawn(async move {
+                    let res = fut.await;
+                    if let Err(err) = &res {
+                        tracing::error!(%service_id, error = &**err, "language service crashed");
+                        let reason = err.to_string();
+                        client.send(move |editor| {
+                            editor.restart_language_service(service_id, reason);
+                            Ok(())
+                        });
+                    }
+                    res
+                });
                 let mut service = LanguageServiceInstance::new(service, handle);
 
                 callback(
@@ -239,8 +271,31 @@ impl Editor {
                             .or_default()
                             .push(service_id);
 
-                        // Fire an extra open event for the new language service.
-                        editor.dispatch(event::DidOpenBuffer { buf });
+                        // Sync any buffers that were opened (or edited) before the new language
+                        // service was ready. Only the new service is notified, the other services
+                        // already have these buffers open.
+                        let bufs = editor
+                            .buffers
+                            .values()
+                            .filter(|b| b.id() == buf || b.file_type() == ft)
+                            .filter_map(|b| {
+                                let url = b.file_url()?.clone();
+                                Some((b.id(), lstypes::DidOpenParams {
+                                    url,
+                                    language_id: b.file_type().to_string(),
+                                    version: b.version(),
+                                    text: b.text().to_string(),
+                                }))
+                            })
+                            .collect::<Vec<_>>();
+                        for (buf, params) in bufs {
+                            editor
+                                .active_language_services
+                                .get_mut(&service_id)
+                                .expect("just inserted")
+                                .did_open(params)?;
+                            editor.refresh_semantic_tokens(buf);
+                        }
                         editor.dispatch(event::DidInitializeLanguageService { service_id });
 
                         Ok(())
@@ -252,6 +307,40 @@ impl Editor {
         Ok(())
     }
 
+    /// Respawn a language service that exited unexpectedly, the open buffers are synced again once it is initialized.
+    fn restart_language_service(&mut self, service_id: LanguageServiceId, reason: String) {
+        // The service was already removed, we're probably shutting down.
+        if self.active_language_services.remove(&service_id).is_none() {
+            return;
+        }
+
+        for services in self.active_language_services_by_ft.values_mut() {
+            services.retain(|&id| id != service_id);
+        }
+
+        let restarts = self.language_service_restarts.entry(service_id).or_default();
+        *restarts += 1;
+        if *restarts > MAX_LANGUAGE_SERVICE_RESTARTS {
+            self.set_error(format!(
+                "language service `{service_id}` crashed too many times, not restarting: {reason}"
+            ));
+            return;
+        }
+
+        self.set_error(format!("language service `{service_id}` crashed, restarting: {reason}"));
+
+        let Some((buf, ft)) = self.buffers.values().find_map(|buf| {
+            let config = self.language_config.languages.get(&buf.file_type())?;
+            config.language_services.contains(&service_id).then(|| (buf.id(), buf.file_type()))
+        }) else {
+            return;
+        };
+
+        if let Err(err) = self.spawn_language_services_for_ft(buf, ft) {
+            self.set_error(err);
+        }
+    }
+
     fn jump_to_definition(
         &mut self,
         res: lstypes::GotoDefinitionResponse,
@@ -0,0 +1,58 @@
+use zi_input::KeyEvent;
+
+/// Keyboard macro recording state
+#[derive(Debug, Default)]
+pub(super) struct Macros {
+    /// The register being recorded into and the keys recorded so far
+    recording: Option<(char, Vec<KeyEvent>)>,
+    /// The register of the last replayed macro for `@@`
+    last: Option<char>,
+    /// How many macros are currently being replayed (macros may invoke other macros)
+    depth: usize,
+}
+
+impl Macros {
+    /// Avoid overflowing the stack with recursive macros
+    pub(super) const MAX_DEPTH: usize = 100;
+
+    pub(super) fn start_recording(&mut self, register: char) {
+        self.recording = Some((register, vec![]));
+    }
+
+    /// Stop recording and return the register and recorded keys
+    pub(super) fn stop_recording(&mut self) -> Option<(char, Vec<KeyEvent>)> {
+        self.recording.take()
+    }
+
+    pub(super) fn recording(&self) -> Option<char> {
+        self.recording.as_ref().map(|(register, _)| *register)
+    }
+
+    /// Record a key event if we're currently recording and not replaying
+    pub(super) fn maybe_record(&mut self, key: &KeyEvent) {
+        if self.depth > 0 {
+            return;
+        }
+
+        if let Some((_, keys)) = &mut self.recording {
+            keys.push(key.clone());
+        }
+    }
+
+    pub(super) fn last(&self) -> Option<char> {
+        self.last
+    }
+
+    pub(super) fn start_replaying(&mut self, register: char) {
+        self.last = Some(register);
+        self.depth += 1;
+    }
+
+    pub(super) fn stop_replaying(&mut self) {
+        self.depth -= 1;
+    }
+
+    pub(super) fn depth(&self) -> usize {
+        self.depth
+    }
+}
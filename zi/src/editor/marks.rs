@@ -1,7 +1,40 @@
+use std::collections::HashMap;
 use std::ops::{Range, RangeBounds};
+use std::path::PathBuf;
 
-use super::{Editor, Selector};
-use crate::{BufferId, Mark, MarkBuilder, MarkId, NamespaceId};
+use anyhow::{anyhow, bail};
+use zi_text::Text as _;
+use zi_textobject::motion;
+
+use super::{Editor, Resource, Result, Selector};
+use crate::{Active, BufferId, Location, Mark, MarkBuilder, MarkId, NamespaceId, ViewId};
+
+/// The namespace of the extmarks backing the marks set with `m`.
+const NAMESPACE: &str = "marks";
+
+/// What to do with the mark named by the next key.
+#[derive(Debug, Clone, Copy)]
+pub(super) enum MarkPending {
+    /// Set the mark at the cursor.
+    Set,
+    /// Jump to the mark, or to the first non-blank of its line if `linewise`.
+    Goto { linewise: bool },
+}
+
+/// The marks set with `m`, each is an extmark so it follows edits to the buffer.
+/// Lowercase marks are local to a buffer, uppercase marks are global and remember the file they were set in.
+#[derive(Debug, Default)]
+pub(super) struct NamedMarks {
+    local: HashMap<(BufferId, char), MarkId>,
+    global: HashMap<char, GlobalMark>,
+}
+
+#[derive(Debug)]
+struct GlobalMark {
+    buf: BufferId,
+    id: MarkId,
+    path: Option<PathBuf>,
+}
 
 impl Editor {
     #[inline]
@@ -44,4 +77,107 @@ impl Editor {
         let namespace = namespace.select(self);
         self.buffer_mut(selector).delete_mark(namespace, mark);
     }
+
+    /// Set the mark `name` at the cursor, replacing the mark if it is already set.
+    pub fn set_mark(&mut self, selector: impl Selector<ViewId>, name: char) -> Result<()> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let byte = self[buf].text().point_to_byte(self[view].cursor());
+        self.set_mark_at(buf, name, byte)
+    }
+
+    /// Set the mark `name` at the byte in the buffer, replacing the mark if it is already set.
+    pub(super) fn set_mark_at(&mut self, buf: BufferId, name: char, byte: usize) -> Result<()> {
+        let ns = self.create_namespace(NAMESPACE);
+
+        let prev = match name {
+            'a'..='z' | '<' | '>' => {
+                self.named_marks.local.remove(&(buf, name)).map(|id| (buf, id))
+            }
+            'A'..='Z' => self.named_marks.global.remove(&name).map(|mark| (mark.buf, mark.id)),
+            _ => bail!("invalid mark: {name}"),
+        };
+
+        if let Some((buf, id)) = prev {
+            self[buf].delete_mark(ns, id);
+        }
+
+        let id = self[buf].create_mark(ns, Mark::builder(byte));
+        if !name.is_ascii_uppercase() {
+            self.named_marks.local.insert((buf, name), id);
+        } else {
+            let path = self[buf].file_path();
+            self.named_marks.global.insert(name, GlobalMark { buf, id, path });
+        }
+
+        Ok(())
+    }
+
+    /// Set the `'<` and `'>` marks to the start and end of the selection when leaving visual mode.
+    pub(super) fn set_visual_marks(&mut self) {
+        let Some(anchor) = self.state.visual_anchor() else { return };
+        let view = Active.select(self);
+        let buf = self[view].buffer();
+        let cursor = self[view].cursor();
+        let (start, end) = if anchor <= cursor { (anchor, cursor) } else { (cursor, anchor) };
+        let text = self[buf].text();
+        let (start, end) = (text.point_to_byte(start), text.point_to_byte(end));
+        for (name, byte) in [('<', start), ('>', end)] {
+            self.set_mark_at(buf, name, byte).expect("visual marks are valid mark names");
+        }
+    }
+
+    /// Where the mark `name` currently is, lowercase marks are looked up in the given buffer.
+    pub fn mark_location(&self, selector: impl Selector<BufferId>, name: char) -> Option<Location> {
+        let (buf, id) = match name {
+            'a'..='z' | '<' | '>' => {
+                let buf = selector.select(self);
+                (buf, *self.named_marks.local.get(&(buf, name))?)
+            }
+            'A'..='Z' => {
+                let mark = self.named_marks.global.get(&name)?;
+                // The buffer may have been reused for another file since the mark was set.
+                if self[mark.buf].file_path() != mark.path {
+                    return None;
+                }
+                (mark.buf, mark.id)
+            }
+            _ => return None,
+        };
+
+        let ns = self.namespaces.values().find(|ns| ns.name().as_str() == NAMESPACE)?.id();
+        let range = self[buf].get_mark(ns, id)?;
+        Some(Location::new(buf, self[buf].text().byte_to_point(range.start)))
+    }
+
+    /// Every mark that is set and where it currently is.
+    pub(super) fn named_mark_locations(&self) -> Vec<(char, Location)> {
+        let local = self.named_marks.local.keys().copied();
+        let global = self.named_marks.global.iter().map(|(&name, mark)| (mark.buf, name));
+        local
+            .chain(global)
+            .filter_map(|(buf, name)| Some((name, self.mark_location(buf, name)?)))
+            .collect()
+    }
+
+    /// Jump to the mark `name`, or to the first non-blank of its line if `linewise`.
+    pub fn goto_mark(&mut self, name: char, linewise: bool) -> Result<()> {
+        let loc =
+            self.mark_location(Active, name).ok_or_else(|| anyhow!("mark not set: {name}"))?;
+        self.jump_to(loc);
+        if linewise {
+            self.motion(Active, motion::StartOfLine)?;
+        }
+        Ok(())
+    }
+
+    /// Set the mark named by the next key at the cursor.
+    pub fn select_mark_to_set(&mut self) {
+        self.mark_pending = Some(MarkPending::Set);
+    }
+
+    /// Jump to the mark named by the next key.
+    pub fn select_mark_to_goto(&mut self, linewise: bool) {
+        self.mark_pending = Some(MarkPending::Goto { linewise });
+    }
 }
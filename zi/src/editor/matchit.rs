@@ -0,0 +1,51 @@
+use std::ops::Range;
+
+use zi_text::Text as _;
+use zi_textobject::MatchIt;
+
+use super::{EditError, Selector, mode};
+use crate::{BufferId, Editor, Mode, Point, ViewId};
+
+impl Editor {
+    /// Jump to the bracket matching the one under the cursor, or the next bracket on the line, `%`.
+    /// Brackets in strings and comments only match each other if the buffer has a syntax tree.
+    pub fn goto_matching_bracket(
+        &mut self,
+        selector: impl Selector<ViewId>,
+    ) -> Result<Point, EditError> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let matchit = self.matchit(buf, 0..self[buf].text().len_bytes());
+        self.motion(view, matchit)
+    }
+
+    /// The bracket the cursor is on and the bracket matching it, these are highlighted.
+    /// In insert mode, the cursor is also on the bracket just before it, so a bracket is highlighted as it's closed.
+    /// Only brackets in view are matched, the highlight doesn't scan the whole buffer on every render.
+    pub fn matching_brackets(&self, selector: impl Selector<ViewId>) -> Option<(Point, Point)> {
+        let view = &self[selector.select(self)];
+        let buf = view.buffer();
+        let text = self[buf].text();
+        let start = text.try_line_to_byte(view.offset().line)?;
+        let height = self.tree.view_area(view.id()).height as usize;
+        let end = text.try_line_to_byte(view.offset().line + height).unwrap_or(text.len_bytes());
+
+        let matchit = self.matchit(buf, start..end);
+        let cursor = text.point_to_byte(view.cursor());
+        let matching =
+            |byte: usize| Some((byte, matchit.matching_bracket(text, byte, start..end)?));
+        let (byte, matching) = matching(cursor).or_else(|| match mode!(self) {
+            Mode::Insert => {
+                matching(cursor.checked_sub(text.char_before_byte(cursor)?.len_utf8())?)
+            }
+            _ => None,
+        })?;
+        Some((text.byte_to_point(byte), text.byte_to_point(matching)))
+    }
+
+    fn matchit(&self, buf: BufferId, byte_range: Range<usize>) -> MatchIt {
+        let literals =
+            self[buf].syntax().map_or_else(Vec::new, |syntax| syntax.literal_ranges(byte_range));
+        MatchIt::new(literals)
+    }
+}
@@ -0,0 +1,160 @@
+use std::time::{Duration, Instant};
+
+use zi_input::{MouseButton, MouseEvent, MouseEventKind};
+use zi_text::{Text as _, TextSlice as _};
+
+use crate::{Active, Direction, Editor, Mode, Point, ViewId};
+
+/// Remembers the last click to tell apart single, double and triple clicks.
+#[derive(Debug, Default)]
+pub(super) struct MouseState {
+    last_click: Option<Click>,
+}
+
+#[derive(Debug, Clone, Copy)]
+struct Click {
+    time: Instant,
+    column: u16,
+    row: u16,
+    count: u8,
+}
+
+impl MouseState {
+    const MULTI_CLICK_INTERVAL: Duration = Duration::from_millis(400);
+
+    /// Record a click and return how many consecutive clicks there have been on the same cell (cycling 1 to 3).
+    fn click(&mut self, column: u16, row: u16) -> u8 {
+        let now = Instant::now();
+        let count = match self.last_click {
+            Some(last)
+                if (last.column, last.row) == (column, row)
+                    && now.duration_since(last.time) < Self::MULTI_CLICK_INTERVAL =>
+            {
+                last.count % 3 + 1
+            }
+            _ => 1,
+        };
+
+        self.last_click = Some(Click { time: now, column, row, count });
+        count
+    }
+}
+
+impl Editor {
+    const SCROLL_LINES: usize = 3;
+
+    pub(super) fn handle_mouse_event(&mut self, event: MouseEvent) {
+        // Don't interfere with the command line or a pending operator.
+        if !matches!(
+            self.mode(),
+            Mode::Normal | Mode::Insert | Mode::Visual | Mode::VisualLine | Mode::VisualBlock
+        ) {
+            return;
+        }
+
+        let (column, row) = (event.column(), event.row());
+        match event.kind() {
+            MouseEventKind::Down(MouseButton::Left) => {
+                let Some(view) = self.view_at(column, row) else { return };
+                self.hover = None;
+                self.focus(view);
+                let point = self.point_at(view, column, row);
+                match self.mouse.click(column, row) {
+                    // Selections are only made from normal or visual mode.
+                    _ if self.mode() == Mode::Insert => self.set_cursor(view, point),
+                    1 => {
+                        self.exit_visual();
+                        self.set_cursor(view, point)
+                    }
+                    2 => self.select_word(view, point),
+                    _ => {
+                        self.exit_visual();
+                        self.set_cursor(view, point);
+                        self.set_mode(Mode::VisualLine);
+                    }
+                }
+            }
+            MouseEventKind::Drag(MouseButton::Left) => {
+                // Dragging out of the view extends the selection to its edge.
+                let view = self.tree.active();
+                let point = self.point_at(view, column, row);
+                if self.mode() == Mode::Normal {
+                    self.set_mode(Mode::Visual);
+                }
+                self.set_cursor(view, point);
+            }
+            MouseEventKind::ScrollUp => self.scroll(Active, Direction::Up, Self::SCROLL_LINES),
+            MouseEventKind::ScrollDown => self.scroll(Active, Direction::Down, Self::SCROLL_LINES),
+            _ => (),
+        }
+    }
+
+    fn exit_visual(&mut self) {
+        if matches!(self.mode(), Mode::Visual | Mode::VisualLine | Mode::VisualBlock) {
+            self.set_mode(Mode::Normal);
+        }
+    }
+
+    /// Visually select the word (or run of punctuation or whitespace) under the point.
+    fn select_word(&mut self, view: ViewId, point: Point) {
+        #[derive(PartialEq)]
+        enum Class {
+            Word,
+            Whitespace,
+            Punctuation,
+        }
+
+        let class = |c: char| match c {
+            c if c.is_alphanumeric() || c == '_' => Class::Word,
+            c if c.is_whitespace() => Class::Whitespace,
+            _ => Class::Punctuation,
+        };
+
+        let buf = self[view].buffer();
+        let Some(line) = self.text(buf).line(point.line()) else { return };
+        let chars = line
+            .chars()
+            .take_while(|&c| c != '\n')
+            .scan(0, |col, c| {
+                let start = *col;
+                *col += c.len_utf8();
+                Some((start, c))
+            })
+            .collect::<Vec<_>>();
+
+        let Some(idx) = chars.iter().position(|&(col, _)| col == point.col()) else {
+            // An empty line, there is nothing to select.
+            return self.set_cursor(view, point);
+        };
+
+        let target = class(chars[idx].1);
+        let start = chars[..idx].iter().rev().take_while(|&&(_, c)| class(c) == target).count();
+        let end = chars[idx..].iter().take_while(|&&(_, c)| class(c) == target).count();
+
+        self.exit_visual();
+        self.set_cursor(view, point.with_col(chars[idx - start].0));
+        self.set_mode(Mode::Visual);
+        self.set_cursor(view, point.with_col(chars[idx + end - 1].0));
+    }
+
+    /// The view in the top layer that contains the given cell.
+    fn view_at(&self, column: u16, row: u16) -> Option<ViewId> {
+        self.tree.top().views().find(|&view| {
+            let area = self.tree.view_area(view);
+            (area.left()..area.right()).contains(&column)
+                && (area.top()..area.bottom()).contains(&row)
+        })
+    }
+
+    /// The point in the view's buffer displayed at the given cell, cells outside the view are clamped to its edges.
+    fn point_at(&self, view: ViewId, column: u16, row: u16) -> Point {
+        let area = self.tree.view_area(view);
+        let x = column.saturating_sub(area.x).min(area.width.saturating_sub(1));
+        let y = row.saturating_sub(area.y).min(area.height.saturating_sub(1));
+
+        let view = &self[view];
+        // Clicks on the line numbers go to the start of the line.
+        let x = x.saturating_sub(view.number_width.get());
+        view.viewport_coords_to_point(self.buffer(view.buffer()), area, (x, y))
+    }
+}
@@ -129,8 +129,6 @@ impl Editor {
         }));
 
         let display_view = self.split(Active, Direction::Left, tui::Constraint::Fill(1));
-        let theme = self.theme();
-        let theme = theme.read();
         self.views[display_view].set_buffer(self.buffers.insert_with_key(|id| {
             Buffer::new(TextBuffer::new(
                 id,
@@ -138,7 +136,6 @@ impl Editor {
                 filetype!(text),
                 path,
                 Rope::new(),
-                &theme,
                 None,
             ))
         }));
@@ -225,13 +222,15 @@ impl Editor {
     pub fn open_file_picker(&mut self, path: impl AsRef<Path>) -> ViewGroupId {
         let path = path.as_ref();
         let split_ratio = *self.settings().file_picker_split_ratio.read();
+        let max_entries = *self.settings().file_picker_max_entries.read();
         self.open_static_picker::<BufferPicker<stdx::path::Display>>(
             Url::parse("view-group://files").unwrap(),
             path,
             split_ratio,
             |_editor, injector| {
-                let mut entries =
-                    ignore::WalkBuilder::new(path).build().filter_map(|entry| match entry {
+                let mut entries = ignore::WalkBuilder::new(path)
+                    .build()
+                    .filter_map(|entry| match entry {
                         Ok(entry) => match entry.file_type() {
                             Some(ft) if ft.is_file() => Some(entry),
                             _ => None,
@@ -240,7 +239,8 @@ impl Editor {
                             tracing::error!(%err, "file picker error");
                             None
                         }
-                    });
+                    })
+                    .take(max_entries);
 
                 let deadline = std::time::Instant::now() + std::time::Duration::from_millis(50);
                 for entry in entries.by_ref() {
@@ -322,12 +322,19 @@ impl Editor {
         struct DiagnosticEntry {
             path: PathBuf,
             range: lstypes::EncodedRange,
+            severity: lstypes::Severity,
             message: String,
         }
 
         impl fmt::Display for DiagnosticEntry {
             fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
-                write!(f, "{}:{}: {}", self.path.display(), self.range, self.message)
+                let severity = match self.severity {
+                    lstypes::Severity::Error => "error",
+                    lstypes::Severity::Warning => "warning",
+                    lstypes::Severity::Info => "info",
+                    lstypes::Severity::Hint => "hint",
+                };
+                write!(f, "{}:{}: {severity}: {}", self.path.display(), self.range, self.message)
             }
         }
 
@@ -349,15 +356,29 @@ impl Editor {
             "diagnostics",
             split_ratio,
             |editor, injector| {
-                for (path, server_diags) in editor.diagnostics.iter() {
-                    for diag in &server_diags.read().1 {
-                        if let Err(()) = injector.push(DiagnosticEntry {
-                            path: path.clone(),
-                            range: diag.range.clone(),
-                            message: diag.message.clone(),
-                        }) {
-                            break;
-                        }
+                let mut entries = editor
+                    .diagnostics
+                    .iter()
+                    .flat_map(|(path, server_diags)| {
+                        server_diags
+                            .read()
+                            .1
+                            .iter()
+                            .map(|diag| DiagnosticEntry {
+                                path: path.clone(),
+                                range: diag.range.clone(),
+                                severity: diag.severity,
+                                message: diag.message.clone(),
+                            })
+                            .collect::<Vec<_>>()
+                    })
+                    .collect::<Vec<_>>();
+                // Listed by file and then position, not in whatever order the files were reported in.
+                entries.sort_by(|a, b| (&a.path, a.range.start()).cmp(&(&b.path, b.range.start())));
+
+                for entry in entries {
+                    if let Err(()) = injector.push(entry) {
+                        break;
                     }
                 }
             },
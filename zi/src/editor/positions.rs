@@ -0,0 +1,187 @@
+//! The last cursor position in each file, so reopening a file picks up where it was left.
+//! The position is saved whenever a view stops showing the file, i.e. when the view is closed or shows another file.
+//!
+//! ```toml
+//! [[files]]
+//! path = "/home/user/project/src/main.rs"
+//! cursor = [10, 4]
+//! # The first line in view.
+//! scroll = 2
+//! # The size of the file and when it was last modified in seconds since the epoch, as of when it was left.
+//! len = 1024
+//! modified = 1700000000
+//! ```
+//!
+//! The most recently left files come first, only the last `MAX_FILES` are remembered.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::UNIX_EPOCH;
+
+use anyhow::bail;
+
+use super::Result;
+use super::session::{get_point, get_str, get_usize, path_value, point_value};
+use crate::{Direction, Editor, Point, ViewId};
+
+const MAX_FILES: usize = 1000;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct FilePosition {
+    path: PathBuf,
+    cursor: Point,
+    /// The first line in view.
+    scroll: usize,
+    stamp: Stamp,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+struct Stamp {
+    len: u64,
+    modified: u64,
+}
+
+impl Stamp {
+    fn of(path: &Path) -> Option<Self> {
+        let metadata = fs::metadata(path).ok()?;
+        let modified = metadata.modified().ok()?.duration_since(UNIX_EPOCH).ok()?.as_secs();
+        Some(Self { len: metadata.len(), modified })
+    }
+
+    /// Whether a position from when the file had this stamp is likely to still point at the same text.
+    /// A file that was edited elsewhere is still close enough unless its size changed by more than half.
+    fn is_close_to(&self, other: &Stamp) -> bool {
+        self == other || self.len.abs_diff(other.len) <= self.len / 2
+    }
+}
+
+impl Editor {
+    /// Set the file the cursor position in each file is saved to, see the module docs for the format.
+    pub fn set_position_file(&mut self, path: impl Into<PathBuf>) {
+        self.position_file = Some(path.into());
+    }
+
+    /// Save the cursor position and scroll offset of the view's file, this is done when the view leaves the file.
+    pub(super) fn save_position(&mut self, view: ViewId) {
+        let Some(store) = self.position_store() else { return };
+        let Some(path) = self[self[view].buffer()].file_path() else { return };
+        // The file was never written, there's nothing to come back to.
+        let Some(stamp) = Stamp::of(&path) else { return };
+
+        let position = FilePosition {
+            path,
+            cursor: self[view].cursor(),
+            scroll: self[view].offset().line,
+            stamp,
+        };
+        if let Err(err) = save_position(&store, position) {
+            tracing::warn!(?err, store = %store.display(), "failed to save cursor position");
+        }
+    }
+
+    /// Move the view to where its file was last left, if the file hasn't changed too much since.
+    /// A cursor past the end of the file is moved to the last line.
+    pub(super) fn restore_position(&mut self, view: ViewId) {
+        let Some(store) = self.position_store() else { return };
+        let Some(path) = self[self[view].buffer()].file_path() else { return };
+        let position = match load_positions(&store) {
+            Ok(positions) => positions.into_iter().find(|position| position.path == path),
+            Err(err) => {
+                tracing::warn!(?err, store = %store.display(), "failed to load cursor positions");
+                return;
+            }
+        };
+
+        let Some(position) = position else { return };
+        if !Stamp::of(&path).is_some_and(|stamp| position.stamp.is_close_to(&stamp)) {
+            return;
+        }
+
+        // Scroll first so the cursor only moves the view if the file has shrunk.
+        self.scroll(view, Direction::Down, position.scroll);
+        self.set_cursor(view, position.cursor);
+    }
+
+    fn position_store(&self) -> Option<PathBuf> {
+        if !*self.settings.restore_cursor.read() {
+            return None;
+        }
+        self.position_file.clone()
+    }
+}
+
+fn load_positions(store: &Path) -> Result<Vec<FilePosition>> {
+    let src = match fs::read_to_string(store) {
+        Ok(src) => src,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => return Ok(vec![]),
+        Err(err) => return Err(err.into()),
+    };
+
+    let table = toml::from_str::<toml::Table>(&src)?;
+    let Some(files) = table.get("files") else { return Ok(vec![]) };
+    let Some(files) = files.as_array() else { bail!("`files` must be an array") };
+    files
+        .iter()
+        .map(|file| {
+            let Some(file) = file.as_table() else { bail!("each file must be a table") };
+            Ok(FilePosition {
+                path: PathBuf::from(get_str(file, "path")?),
+                cursor: get_point(file, "cursor")?,
+                scroll: get_usize(file, "scroll")?,
+                stamp: Stamp {
+                    len: get_usize(file, "len")? as u64,
+                    modified: get_usize(file, "modified")? as u64,
+                },
+            })
+        })
+        .collect()
+}
+
+/// Save the position as the most recent one, the file is reread first to keep the positions saved by other editors.
+fn save_position(store: &Path, position: FilePosition) -> Result<()> {
+    // An unreadable store is started over rather than never saving anything again.
+    let mut positions = load_positions(store).unwrap_or_default();
+    positions.retain(|p| p.path != position.path);
+    positions.insert(0, position);
+    positions.truncate(MAX_FILES);
+
+    let files = positions
+        .iter()
+        .map(|position| {
+            let mut table = toml::Table::new();
+            table.insert("path".into(), path_value(&position.path));
+            table.insert("cursor".into(), point_value(position.cursor));
+            table.insert("scroll".into(), toml::Value::Integer(position.scroll as i64));
+            table.insert("len".into(), toml::Value::Integer(position.stamp.len as i64));
+            table.insert("modified".into(), toml::Value::Integer(position.stamp.modified as i64));
+            toml::Value::Table(table)
+        })
+        .collect();
+    let mut table = toml::Table::new();
+    table.insert("files".into(), toml::Value::Array(files));
+
+    if let Some(dir) = store.parent() {
+        fs::create_dir_all(dir)?;
+    }
+    // Write to a temporary file first so a crash midway doesn't lose all the positions.
+    let tmp = store.with_extension(format!("{}.tmp", std::process::id()));
+    fs::write(&tmp, table.to_string())?;
+    fs::rename(&tmp, store)?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::Stamp;
+
+    #[test]
+    fn stamp_is_close_to() {
+        let stamp = Stamp { len: 100, modified: 10 };
+        assert!(stamp.is_close_to(&Stamp { len: 100, modified: 10 }));
+        assert!(!stamp.is_close_to(&Stamp { len: 500, modified: 10 }));
+        assert!(stamp.is_close_to(&Stamp { len: 60, modified: 20 }));
+        assert!(stamp.is_close_to(&Stamp { len: 150, modified: 20 }));
+        assert!(!stamp.is_close_to(&Stamp { len: 40, modified: 20 }));
+        assert!(!stamp.is_close_to(&Stamp { len: 151, modified: 20 }));
+    }
+}
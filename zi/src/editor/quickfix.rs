@@ -0,0 +1,365 @@
+use std::ffi::OsStr;
+use std::future::Future;
+use std::path::{Path, PathBuf};
+use std::process::Stdio;
+use std::time::{Duration, Instant};
+use std::{env, fmt, mem};
+
+use anyhow::{Context as _, bail};
+use tokio::io::{AsyncBufReadExt as _, AsyncReadExt as _, BufReader};
+use url::Url;
+
+use super::Result;
+use crate::buffer::picker::{BufferPicker, BufferPickerEntry, Picker};
+use crate::lstypes::{self, TextExt};
+use crate::{BufferId, Client, Editor, Location, OpenFlags, ViewGroupId, ViewId};
+
+/// Matches are added to the quickfix list in batches of at most this many as they stream in.
+const GREP_BATCH_SIZE: usize = 1000;
+
+/// How long matches are held back to be added in one batch.
+const GREP_BATCH_INTERVAL: Duration = Duration::from_millis(50);
+
+/// An ordered list of locations to step through, populated by commands such as find references.
+#[derive(Debug, Default)]
+pub(super) struct Quickfix {
+    entries: Vec<QuickfixEntry>,
+    /// The index of the entry last jumped to.
+    idx: Option<usize>,
+    /// Bumped whenever the list is replaced so a stale `:grep` stops adding to the new list.
+    generation: u64,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct QuickfixEntry {
+    pub path: PathBuf,
+    /// The position may be in a different encoding to ours, it's decoded once the file is open.
+    pub point: lstypes::EncodedPoint,
+    pub message: String,
+}
+
+impl QuickfixEntry {
+    /// Parse a line of `grep -n` or `rg --vimgrep` output, `path:line[:col]:message` with 1-indexed positions.
+    /// Relative paths are relative to `dir`.
+    fn parse_grep(line: &str, dir: &Path) -> Option<Self> {
+        let (path, rest) = line.split_once(':')?;
+        let (line, rest) = rest.split_once(':')?;
+        let line = line.parse::<usize>().ok()?.checked_sub(1)?;
+        let col = rest
+            .split_once(':')
+            .and_then(|(col, message)| Some((col.parse::<usize>().ok()?, message)));
+        let (col, message) = match col {
+            Some((col, message)) => (col.saturating_sub(1), message),
+            None => (0, rest),
+        };
+
+        Some(Self {
+            path: dir.join(path),
+            point: lstypes::Point::new(line, col).into(),
+            message: message.trim().to_string(),
+        })
+    }
+}
+
+impl fmt::Display for QuickfixEntry {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}:{}", self.path.display(), self.point)?;
+        if !self.message.is_empty() {
+            write!(f, ": {}", self.message)?;
+        }
+        Ok(())
+    }
+}
+
+impl Quickfix {
+    fn step(&mut self, offset: isize) -> Result<usize> {
+        if self.entries.is_empty() {
+            bail!("quickfix list is empty");
+        }
+
+        let idx = match self.idx {
+            None => 0,
+            Some(idx) => match idx.checked_add_signed(offset) {
+                Some(idx) if idx < self.entries.len() => idx,
+                _ if offset > 0 => bail!("no more items"),
+                _ => bail!("already at the first item"),
+            },
+        };
+
+        Ok(idx)
+    }
+}
+
+impl Editor {
+    pub fn quickfix_entries(&self) -> &[QuickfixEntry] {
+        &self.quickfix.entries
+    }
+
+    /// The index of the entry last jumped to.
+    pub fn quickfix_index(&self) -> Option<usize> {
+        self.quickfix.idx
+    }
+
+    pub fn set_quickfix(&mut self, entries: impl IntoIterator<Item = QuickfixEntry>) {
+        let generation = self.quickfix.generation + 1;
+        self.quickfix = Quickfix { entries: entries.into_iter().collect(), idx: None, generation };
+    }
+
+    pub(super) fn set_quickfix_locations(&mut self, locations: Vec<lstypes::Location>) {
+        self.set_quickfix(locations.into_iter().filter_map(|loc| {
+            let path = loc.url.to_file_path().ok()?;
+            Some(QuickfixEntry { path, point: loc.range.start(), message: String::new() })
+        }))
+    }
+
+    /// Populate the quickfix list with the diagnostics of every file, sorted by path.
+    pub fn set_quickfix_diagnostics(&mut self) {
+        let mut paths = self.diagnostics.keys().cloned().collect::<Vec<_>>();
+        paths.sort();
+        let entries = paths
+            .into_iter()
+            .flat_map(|path| {
+                let diags = self.diagnostics[&path].read().1.to_vec();
+                diags.into_iter().map(move |diag| QuickfixEntry {
+                    path: path.clone(),
+                    point: diag.range.start(),
+                    message: diag.message.lines().next().unwrap_or_default().to_string(),
+                })
+            })
+            .collect::<Vec<_>>();
+        self.set_quickfix(entries);
+    }
+
+    /// Jump to the next entry in the quickfix list (or the first if we haven't jumped to any yet).
+    pub fn quickfix_next(&mut self) -> Result<impl Future<Output = Result<()>> + 'static> {
+        let idx = self.quickfix.step(1)?;
+        self.quickfix_goto(idx)
+    }
+
+    pub fn quickfix_prev(&mut self) -> Result<impl Future<Output = Result<()>> + 'static> {
+        let idx = self.quickfix.step(-1)?;
+        self.quickfix_goto(idx)
+    }
+
+    /// Jump to the entry at `idx` (0-indexed) in the quickfix list.
+    /// The entry becomes the current one even if its file has since been deleted, so stepping skips past it.
+    pub fn quickfix_goto(
+        &mut self,
+        idx: usize,
+    ) -> Result<impl Future<Output = Result<()>> + 'static> {
+        let Some(QuickfixEntry { path, point, .. }) = self.quickfix.entries.get(idx).cloned()
+        else {
+            bail!("no item {} in the quickfix list of {}", idx + 1, self.quickfix.entries.len())
+        };
+        self.quickfix.idx = Some(idx);
+
+        if !path.exists() && self.buffer_at_path(&path).is_none() {
+            bail!("`{}` no longer exists", path.display());
+        }
+
+        let from = self.current_location();
+        let open_fut =
+            self.open(path, OpenFlags::SPAWN_LANGUAGE_SERVICES | OpenFlags::BACKGROUND)?;
+        let client = self.client();
+        Ok(async move {
+            let buf = open_fut.await?;
+            client
+                .with(move |editor| {
+                    let Some(point) = editor.text(buf).decode_point(point) else {
+                        bail!("quickfix entry is out of bounds")
+                    };
+                    editor.jump(from, Location::new(buf, point));
+                    Ok(())
+                })
+                .await
+        })
+    }
+
+    /// Run `grepprg` with the arguments and replace the quickfix list with the matches as they stream in.
+    /// If `jump` is set, the first match is jumped to as soon as it's found.
+    pub fn grep(
+        &mut self,
+        args: impl IntoIterator<Item = impl AsRef<OsStr>>,
+        jump: bool,
+    ) -> Result<impl Future<Output = Result<()>> + 'static> {
+        let program = self.settings().grep_program.read().clone();
+        let mut words = program.split_whitespace();
+        let Some(command) = words.next().map(str::to_string) else { bail!("`grepprg` is empty") };
+
+        let mut cmd = tokio::process::Command::new(&command);
+        cmd.args(words)
+            .args(args)
+            .stdin(Stdio::null())
+            .stdout(Stdio::piped())
+            .stderr(Stdio::piped())
+            .kill_on_drop(true);
+        let mut child = cmd.spawn().with_context(|| format!("failed to run `{command}`"))?;
+
+        let dir = env::current_dir()?;
+        self.set_quickfix([]);
+        let generation = self.quickfix.generation;
+        let client = self.client();
+        Ok(async move {
+            let stdout = child.stdout.take().expect("stdout is piped");
+            let mut stderr = child.stderr.take().expect("stderr is piped");
+            // Read stderr alongside stdout so neither pipe can fill up and block the process.
+            let stderr = tokio::spawn(async move {
+                let mut buf = String::new();
+                stderr.read_to_string(&mut buf).await.map(|_| buf)
+            });
+
+            let mut lines = BufReader::new(stdout).lines();
+            let mut batch = vec![];
+            let mut matches = 0;
+            let mut last_flush = Instant::now();
+            loop {
+                let line = lines.next_line().await?;
+                if let Some(line) = &line {
+                    batch.extend(QuickfixEntry::parse_grep(line, &dir));
+                }
+
+                // The first match is added immediately so it can be jumped to while the rest stream in.
+                let flush = line.is_none()
+                    || matches == 0 && !batch.is_empty()
+                    || batch.len() >= GREP_BATCH_SIZE
+                    || last_flush.elapsed() >= GREP_BATCH_INTERVAL;
+                if flush && !batch.is_empty() {
+                    let first = matches == 0;
+                    matches += batch.len();
+                    last_flush = Instant::now();
+
+                    let batch = mem::take(&mut batch);
+                    let current = client
+                        .with(move |editor| {
+                            let current = editor.quickfix.generation == generation;
+                            if current {
+                                editor.quickfix.entries.extend(batch);
+                            }
+                            current
+                        })
+                        .await;
+                    // The list was replaced, stop adding to it which also kills the process.
+                    if !current {
+                        return Ok(());
+                    }
+
+                    if first && jump {
+                        // Failing to jump shouldn't stop the rest of the matches from coming in.
+                        if let Err(err) = jump_to_first(&client, generation).await {
+                            client.with(move |editor| editor.set_error(err)).await;
+                        }
+                    }
+                }
+
+                if line.is_none() {
+                    break;
+                }
+            }
+
+            let status = child.wait().await?;
+            let stderr = stderr.await??;
+            // `grep` and `rg` exit with 1 if there are no matches.
+            if !status.success() && status.code() != Some(1) {
+                bail!("`{command}` exited with {status}: {}", stderr.trim());
+            }
+
+            if matches == 0 {
+                bail!("no matches");
+            }
+
+            Ok(())
+        })
+    }
+
+    /// List the quickfix entries in a picker, selecting one jumps to it.
+    pub fn open_quickfix(&mut self) -> ViewGroupId {
+        let split_ratio = *self.settings().diagnostics_picker_split_ratio.read();
+        self.open_static_picker::<QuickfixPicker>(
+            Url::parse("view-group://quickfix").unwrap(),
+            "quickfix",
+            split_ratio,
+            |editor, injector| {
+                for (idx, entry) in editor.quickfix.entries.iter().enumerate() {
+                    if let Err(()) =
+                        injector.push(QuickfixPickerEntry { idx, entry: entry.clone() })
+                    {
+                        break;
+                    }
+                }
+            },
+        )
+    }
+}
+
+/// Jump to the first match unless the list has been replaced or an entry has been jumped to already.
+async fn jump_to_first(client: &Client, generation: u64) -> Result<()> {
+    let fut = client
+        .with(move |editor| {
+            if editor.quickfix.generation != generation || editor.quickfix.idx.is_some() {
+                return Ok(None);
+            }
+            editor.quickfix_goto(0).map(Some)
+        })
+        .await?;
+
+    match fut {
+        Some(fut) => fut.await,
+        None => Ok(()),
+    }
+}
+
+#[derive(Debug, Clone)]
+struct QuickfixPickerEntry {
+    idx: usize,
+    entry: QuickfixEntry,
+}
+
+impl fmt::Display for QuickfixPickerEntry {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}", self.entry)
+    }
+}
+
+impl BufferPickerEntry for QuickfixPickerEntry {
+    #[inline]
+    fn buffer_or_path(&self) -> Result<BufferId, &Path> {
+        Err(&self.entry.path)
+    }
+
+    #[inline]
+    fn point(&self) -> Option<lstypes::EncodedPoint> {
+        Some(self.entry.point.clone())
+    }
+}
+
+/// Previews like any other file picker, but confirming makes the entry the current one so `:cn` carries on from it.
+#[derive(Clone, Copy)]
+struct QuickfixPicker {
+    preview: ViewId,
+    buffer_picker: BufferPicker<QuickfixPickerEntry>,
+}
+
+impl Picker for QuickfixPicker {
+    type Entry = QuickfixPickerEntry;
+
+    fn new(preview: ViewId) -> Self {
+        Self { preview, buffer_picker: BufferPicker::new(preview) }
+    }
+
+    fn config(self) -> nucleo::Config {
+        self.buffer_picker.config()
+    }
+
+    fn select(self, editor: &mut Editor, entry: Self::Entry) {
+        self.buffer_picker.select(editor, entry)
+    }
+
+    fn confirm(self, editor: &mut Editor, entry: Self::Entry) {
+        // We can close any of the views, they are all in the same group
+        editor.close_view(self.preview);
+        match editor.quickfix_goto(entry.idx) {
+            Ok(fut) => editor.callback("jump to quickfix entry", fut, |_, ()| Ok(())),
+            Err(err) => editor.set_error(err),
+        }
+    }
+}
@@ -1,7 +1,21 @@
 use std::collections::BTreeMap;
 
+use zi_input::{KeyEvent, KeySequence};
 use zi_textobject::TextObjectKind;
 
+use crate::Operator;
+
+/// What to do with the register named by the next key.
+#[derive(Debug, Clone, Copy)]
+pub(super) enum RegisterPending {
+    /// Use the register for the next yank, delete or paste.
+    Select,
+    /// Record a macro into the register.
+    Record,
+    /// Replay the macro in the register.
+    Replay,
+}
+
 #[derive(Default)]
 pub struct Registers {
     registers: BTreeMap<char, Register>,
@@ -9,26 +23,173 @@ pub struct Registers {
 
 impl Registers {
     pub const UNNAMED: char = '"';
+    /// Contains the most recently yanked text.
+    pub const YANK: char = '0';
+    /// Readonly register containing the path of the current buffer.
+    pub const FILENAME: char = '%';
+    /// Contains the most recent search pattern.
+    pub const SEARCH: char = '/';
+    /// Writing to this register does nothing.
+    pub const BLACKHOLE: char = '_';
+    /// Mirrors the system clipboard.
+    pub const CLIPBOARD: char = '+';
+    /// The primary selection on X11, this shares the clipboard everywhere else.
+    pub const SELECTION: char = '*';
 
     pub fn get(&self, name: char) -> Option<&Register> {
-        self.registers.get(&name)
+        self.registers.get(&name.to_ascii_lowercase())
     }
 
     pub(crate) fn get_or_insert(&mut self, name: char) -> &mut Register {
         self.registers.entry(name).or_default()
     }
+
+    pub(crate) fn is_valid(name: char) -> bool {
+        name.is_ascii_alphanumeric()
+            || matches!(name, Self::UNNAMED | Self::FILENAME | Self::SEARCH | Self::BLACKHOLE)
+            || Self::is_clipboard(name)
+    }
+
+    pub(crate) fn is_clipboard(name: char) -> bool {
+        matches!(name, Self::CLIPBOARD | Self::SELECTION)
+    }
+
+    /// Whether text yanked or deleted into the register should also be copied to the system clipboard.
+    /// Plain yanks are copied too, as if vim's `clipboard=unnamedplus` were set.
+    pub(crate) fn uses_clipboard(name: Option<char>, operator: Operator) -> bool {
+        match name {
+            Some(name) => Self::is_clipboard(name),
+            None => operator == Operator::Yank,
+        }
+    }
+
+    /// Save yanked text to the given register, or the yank register if none is given.
+    /// The unnamed register always ends up with the yanked text.
+    pub(crate) fn yank(
+        &mut self,
+        name: Option<char>,
+        kind: impl Into<RegisterKind>,
+        content: impl Into<String>,
+    ) {
+        let kind = kind.into();
+        let content = content.into();
+        match name {
+            None => {
+                self.get_or_insert(Self::YANK).set(kind, content.clone());
+                // This was copied to the clipboard, so `"+p` should paste it even if the clipboard can't be read.
+                self.get_or_insert(Self::CLIPBOARD).set(kind, content.clone());
+            }
+            Some(Self::UNNAMED) => self.get_or_insert(Self::YANK).set(kind, content.clone()),
+            Some(name) => {
+                if !self.write(name, kind, &content) {
+                    return;
+                }
+            }
+        }
+
+        self.get_or_insert(Self::UNNAMED).set(kind, content);
+    }
+
+    /// Save deleted text to the given register.
+    /// If no register is given, the numbered registers are shifted to make space for the deleted text in `"1`.
+    /// The unnamed register always ends up with the deleted text.
+    pub(crate) fn delete(
+        &mut self,
+        name: Option<char>,
+        kind: impl Into<RegisterKind>,
+        content: impl Into<String>,
+    ) {
+        let kind = kind.into();
+        let content = content.into();
+        match name {
+            None | Some(Self::UNNAMED) => {
+                for i in (1..9).rev() {
+                    if let Some(reg) = self.registers.remove(&digit(i)) {
+                        self.registers.insert(digit(i + 1), reg);
+                    }
+                }
+                self.get_or_insert(digit(1)).set(kind, content.clone());
+            }
+            Some(name) => {
+                if !self.write(name, kind, &content) {
+                    return;
+                }
+            }
+        }
+
+        self.get_or_insert(Self::UNNAMED).set(kind, content);
+    }
+
+    /// Save the keys of a recorded macro.
+    /// Uppercase registers append the keys to the existing macro.
+    pub(crate) fn record(&mut self, name: char, keys: Vec<KeyEvent>) {
+        let mut keys = keys;
+        if name.is_ascii_uppercase() {
+            if let Some(existing) = self.get(name).and_then(Register::keys) {
+                keys.splice(0..0, existing);
+            }
+        }
+
+        let reg = self.get_or_insert(name.to_ascii_lowercase());
+        let keys = keys.into_iter().collect::<KeySequence>();
+        reg.set(RegisterKind::Charwise, keys.to_string());
+        reg.keys = Some(keys);
+    }
+
+    /// Returns whether the register was written to.
+    fn write(&mut self, name: char, kind: RegisterKind, content: &str) -> bool {
+        match name {
+            Self::BLACKHOLE | Self::FILENAME | Self::SEARCH => false,
+            // Uppercase registers append to their lowercase counterpart.
+            'A'..='Z' => {
+                let reg = self.get_or_insert(name.to_ascii_lowercase());
+                if kind == RegisterKind::Linewise || reg.kind == RegisterKind::Linewise {
+                    if !reg.content.is_empty() && !reg.content.ends_with('\n') {
+                        reg.content.push('\n');
+                    }
+                    reg.kind = RegisterKind::Linewise;
+                }
+                reg.content.push_str(content);
+                true
+            }
+            _ => {
+                self.get_or_insert(name).set(kind, content);
+                true
+            }
+        }
+    }
+}
+
+fn digit(i: u32) -> char {
+    char::from_digit(i, 10).expect("numbered registers are single digits")
 }
 
-#[derive(Default, Clone)]
+#[derive(Debug, Default, Clone)]
 pub struct Register {
     pub kind: RegisterKind,
     pub content: String,
+    /// The exact keys if the register was filled by recording a macro.
+    /// The content is not guaranteed to parse back into the same key sequence.
+    keys: Option<KeySequence>,
 }
 
 impl Register {
+    pub(crate) fn new(kind: impl Into<RegisterKind>, content: impl Into<String>) -> Self {
+        Self { kind: kind.into(), content: content.into(), keys: None }
+    }
+
     pub(crate) fn set(&mut self, kind: impl Into<RegisterKind>, content: impl Into<String>) {
         self.kind = kind.into();
         self.content = content.into();
+        self.keys = None;
+    }
+
+    /// The keys to execute when the register is replayed as a macro.
+    pub(crate) fn keys(&self) -> Option<KeySequence> {
+        match &self.keys {
+            Some(keys) => Some(keys.clone()),
+            None => self.content.parse().ok(),
+        }
     }
 }
 
@@ -37,6 +198,8 @@ pub enum RegisterKind {
     #[default]
     Charwise,
     Linewise,
+    /// A rectangle yanked in visual block mode, each line of the content is pasted on its own line.
+    Blockwise,
 }
 
 impl From<TextObjectKind> for RegisterKind {
@@ -1,17 +1,19 @@
 use std::borrow::Cow;
-use std::fmt;
 
 use stdx::iter::IteratorExt;
 use stdx::merge::Merge;
 use tui::{Rect, StatefulWidget, Widget as _};
+use unicode_width::{UnicodeWidthChar, UnicodeWidthStr};
+use zi_core::style::Style;
 use zi_core::{IteratorRangeExt, Offset, PointRange};
-use zi_text::{AnyTextSlice, PointRangeExt, Text, TextSlice};
+use zi_text::{AnyText, AnyTextSlice, PointRangeExt, Text, TextSlice};
 
-use super::{Editor, State, get_ref};
+use super::{Editor, State};
 use crate::completion::Completion;
 use crate::editor::Resource;
-use crate::syntax::HighlightName;
-use crate::{Active, ViewId};
+use crate::lstypes::Severity;
+use crate::syntax::{HighlightName, Theme};
+use crate::{Active, ListChars, ViewId};
 
 impl Editor {
     pub fn render(&mut self, frame: &mut impl tui::DynFrame) {
@@ -34,50 +36,49 @@ impl Editor {
         self.tree.render(self, frame.buffer_mut());
 
         // HACK probably there is a nicer way to not special case the cmd and statusline
-        let (view, buf) = get_ref!(self);
-        let path = buf.file_path();
-        let path = path.as_ref().map(|p| p.display());
-        let display = path
-            .as_ref()
-            .map_or_else(|| buf.url() as &dyn fmt::Display, |p| p as &dyn fmt::Display);
-
-        let mut status_spans = vec![tui::Span::styled(
-            format!("{}:{}:{} ", display, view.cursor().line() + 1_usize, view.cursor().col()),
-            tui::Style::new()
-                .fg(tui::Color::Rgb(0x88, 0x88, 0x88))
-                .bg(tui::Color::Rgb(0x07, 0x36, 0x42)),
-        )];
+        let theme = self.theme();
+        let theme = theme.read();
+        let status_style = self.ui_style(&theme, HighlightName::STATUSLINE);
+        let style = tui::Style::from(status_style);
+        let width = tree_area.width as usize;
+        let (left, right) = self.render_status_line(width);
+        let mut status_spans = vec![tui::Span::styled(format!("{left} "), style)];
 
         // The error should probably go in the cmd line not the status line.
         if let Some(error) = &self.status_error {
             status_spans.push(tui::Span::styled(
                 error,
-                tui::Style::new()
-                    .fg(tui::Color::Rgb(0xff, 0x00, 0x00))
-                    .bg(tui::Color::Rgb(0x07, 0x36, 0x42)),
+                self.ui_style_over(&theme, status_style, HighlightName::STATUSLINE_ERROR),
+            ));
+        } else if let Some(message) = &self.status_message {
+            status_spans.push(tui::Span::styled(
+                message,
+                self.ui_style_over(&theme, status_style, HighlightName::STATUSLINE_MESSAGE),
             ));
         }
 
-        // FIXME probably a better way than manually padding the right
+        // Pad the remaining width so the right aligned segments end at the edge of the screen.
+        let used = status_spans.iter().map(|span| span.width()).sum::<usize>();
         status_spans.push(tui::Span::styled(
-            " ".repeat(tree_area.width as usize),
-            tui::Style::new()
-                .fg(tui::Color::Rgb(0x88, 0x88, 0x88))
-                .bg(tui::Color::Rgb(0x07, 0x36, 0x42)),
+            " ".repeat(width.saturating_sub(used + right.width()).max(1)),
+            style,
         ));
+        status_spans.push(tui::Span::styled(right, style));
 
         let status = tui::Line::default().spans(status_spans);
 
         let cmd = tui::Text::styled(
             match &self.state {
                 State::Command(state) => Cow::Borrowed(state.buffer.as_str()),
-                State::Normal(..) | State::OperatorPending(..) => Cow::Borrowed(""),
+                State::Normal(..) | State::OperatorPending(..) => match self.macros.recording() {
+                    Some(register) => Cow::Owned(format!("recording @{register}")),
+                    None => Cow::Borrowed(""),
+                },
                 state => Cow::Owned(format!("-- {} --", state.mode())),
             },
-            tui::Style::new()
-                .fg(tui::Color::Rgb(0x88, 0x88, 0x88))
-                .bg(tui::Color::Rgb(0x00, 0x2b, 0x36)),
+            self.ui_style(&theme, HighlightName::CMDLINE),
         );
+        drop(theme);
 
         let widget = tui::vstack([tui::Constraint::Max(1), tui::Constraint::Max(1)], (status, cmd));
 
@@ -91,13 +92,15 @@ impl Editor {
             frame.buffer_mut(),
         );
 
+        self.render_command_completion(tree_area, frame.buffer_mut());
+
         let (x, y) = self.cursor_viewport_coords();
         let offset = match &self.state {
             State::Command(state) => {
                 state.buffer.len().checked_sub(1).expect("should have a preceding `/` or `:`")
                     as u16
             }
-            _ => view.number_width.get(),
+            _ => self[self.tree.active()].number_width.get(),
         };
 
         frame.set_cursor(x + offset, y);
@@ -120,6 +123,32 @@ impl Editor {
 
         if view == self.view(Active).id() {
             self.render_completion(area, surface, view);
+            self.render_hover(area, surface, view);
+        }
+    }
+
+    /// Draw the border between two views of a split, `direction` is the direction of the split.
+    pub(crate) fn render_split_border(
+        &self,
+        area: Rect,
+        direction: tui::Direction,
+        surface: &mut tui::Buffer,
+    ) {
+        let theme = self.theme();
+        let theme = theme.read();
+        let style = self
+            .highlight_id_by_name(HighlightName::WINDOW_SEPARATOR)
+            .style(&theme)
+            .unwrap_or_else(|| theme.default_style());
+        let symbol = match direction {
+            tui::Direction::Horizontal => "│",
+            tui::Direction::Vertical => "─",
+        };
+
+        for y in area.top()..area.bottom() {
+            for x in area.left()..area.right() {
+                surface.set_string(x, y, symbol, style);
+            }
         }
     }
 
@@ -143,24 +172,61 @@ impl Editor {
         }
         .intersection(view_area);
 
+        let (menu, selected) = self.menu_styles();
         tui::Clear.render(area, surface);
         let list = tui::List::new(state.matches().map(|item| {
-            tui::ListItem::new(tui::Text::from(&*item.label).left_aligned()).style(
-                tui::Style::default()
-                    .bg(tui::Color::Rgb(0x07, 0x36, 0x42))
-                    .fg(tui::Color::Rgb(0x88, 0x88, 0x88)),
-            )
+            tui::ListItem::new(tui::Text::from(&*item.label).left_aligned()).style(menu)
         }))
         .scroll_padding(3)
-        .highlight_style(
-            tui::Style::default()
-                .bg(tui::Color::Rgb(0x00, 0x2b, 0x36))
-                .fg(tui::Color::Rgb(0x88, 0x88, 0x88)),
-        );
+        .highlight_style(selected);
 
         StatefulWidget::render(list, area, surface, &mut state.widget_state());
     }
 
+    /// Show the command line completion candidates just above the status line.
+    fn render_command_completion(&self, tree_area: Rect, surface: &mut tui::Buffer) {
+        let State::Command(state) = &self.state else { return };
+        let Some(completion) = &state.completion else { return };
+
+        let candidates = completion.candidates();
+        let height = candidates.len().min(10) as u16;
+        let width = candidates.iter().map(|c| c.chars().count()).max().unwrap_or(0) as u16 + 2;
+        let area = Rect {
+            x: completion.start().saturating_sub(1) as u16,
+            y: tree_area.height.saturating_sub(height),
+            height,
+            width,
+        }
+        .intersection(tree_area);
+
+        let (menu, selected) = self.menu_styles();
+        tui::Clear.render(area, surface);
+        let list = tui::List::new(candidates.iter().map(|candidate| {
+            tui::ListItem::new(tui::Text::from(format!(" {candidate}")).left_aligned()).style(menu)
+        }))
+        .highlight_style(selected);
+
+        let mut list_state = tui::ListState::default().with_selected(completion.selected());
+        StatefulWidget::render(list, area, surface, &mut list_state);
+    }
+
+    fn ui_style(&self, theme: &Theme, name: HighlightName) -> Style {
+        self.highlight_id_by_name(name).style(theme).unwrap_or_else(|| theme.default_style())
+    }
+
+    /// The style of a more specific UI element drawn on top of `base`, e.g. an error in the status line.
+    fn ui_style_over(&self, theme: &Theme, base: Style, name: HighlightName) -> Style {
+        self.highlight_id_by_name(name).style(theme).map_or(base, |style| base.merge(style))
+    }
+
+    /// The styles of the items and the selected item of a completion menu.
+    fn menu_styles(&self) -> (Style, Style) {
+        let theme = self.theme();
+        let theme = theme.read();
+        let menu = self.ui_style(&theme, HighlightName::MENU);
+        (menu, self.ui_style_over(&theme, menu, HighlightName::MENU_SELECTED))
+    }
+
     fn render_view_content(&self, area: Rect, surface: &mut tui::Buffer, view: ViewId) -> usize {
         let theme = self.theme();
         let theme = theme.read();
@@ -169,13 +235,19 @@ impl Editor {
         let view = &self[view];
         let buf = self.buffer(view.buffer());
         let text = buf.text();
+        let folds = view.folds();
 
-        let line_offset = view.offset().line;
-        let relevant_point_range =
-            PointRange::new((line_offset, 0usize), (line_offset + area.height as usize, 0usize));
+        // The offset may be within a fold that was closed after scrolling, the fold is displayed from its first line.
+        let line_offset = folds.row_start(view.offset().line);
+        // The line displayed on each row, a closed fold displays its first line in place of all of its lines.
+        let rows = folds.rows(line_offset).take(area.height as usize).collect::<Vec<_>>();
+        // The line after the last row, including the lines hidden by a fold on the last row.
+        let end_line = rows.last().map_or(line_offset, |&line| folds.next_row(line));
+
+        let relevant_point_range = PointRange::new((line_offset, 0usize), (end_line, 0usize));
         let relevant_byte_range = {
             let start_byte = text.line_to_byte(line_offset);
-            let end_byte = match text.try_line_to_byte(line_offset + area.height as usize) {
+            let end_byte = match text.try_line_to_byte(end_line) {
                 Some(end) => end + text.line(line_offset).unwrap().len_bytes(),
                 None => text.len_bytes(),
             };
@@ -188,7 +260,7 @@ impl Editor {
             .filter_map(|hl| Some((hl.range, hl.id.style(&theme)?)));
 
         let mark_highlights = buf
-            .marks(relevant_byte_range)
+            .marks(relevant_byte_range.clone())
             .filter(|(_, range, _)| !range.is_empty())
             .filter_map(|(_, byte_range, mark)| {
                 let style = mark.highlight().style(&theme)?;
@@ -236,20 +308,78 @@ impl Editor {
             Some((range, style))
         });
 
-        let visual_highlights: Vec<(PointRange, _)> =
-            if let Some(sel) = self.visual_selection(view.id()) {
-                let style = self
-                    .highlight_id_by_name(HighlightName::VISUAL)
-                    .style(&theme)
-                    .unwrap_or_else(|| theme.default_style());
-                sel.point_ranges(text).into_iter().map(|r| (r, style)).collect()
-            } else {
-                vec![]
+        // The selections of the other cursors are highlighted along with the primary selection.
+        let selections = match self.visual_selections(view.id()) {
+            Some(selections) => selections.selections().collect(),
+            None => self.visual_selection(view.id()).into_iter().collect::<Vec<_>>(),
+        };
+        let visual_ranges = match &selections[..] {
+            [sel] => sel.point_ranges(text),
+            // The selections never overlap, they only need sorting.
+            [_, ..] => {
+                let mut ranges =
+                    selections.iter().flat_map(|sel| sel.point_ranges(text)).collect::<Vec<_>>();
+                ranges.sort_by_key(|range| range.start());
+                ranges
+            }
+            // A selected snippet placeholder is highlighted as if it were selected in visual mode.
+            [] => {
+                let mut ranges = self
+                    .snippet_selection(view.id())
+                    .iter()
+                    .filter(|range| !range.is_empty() && range.end <= text.len_bytes())
+                    .flat_map(|range| text.byte_range_to_point_range(range).explode(text))
+                    .collect::<Vec<_>>();
+                ranges.sort_by_key(|range| range.start());
+                ranges
+            }
+        };
+
+        let visual_highlights: Vec<(PointRange, _)> = if visual_ranges.is_empty() {
+            vec![]
+        } else {
+            let style = self
+                .highlight_id_by_name(HighlightName::VISUAL)
+                .style(&theme)
+                .unwrap_or_else(|| theme.default_style());
+            visual_ranges.into_iter().map(|r| (r, style)).collect()
+        };
+
+        // The primary cursor is drawn by the terminal, secondary cursors are drawn as highlights.
+        let cursor_highlights =
+            match self.highlight_id_by_name(HighlightName::SECONDARY_CURSOR).style(&theme) {
+                Some(style) => view
+                    .secondary_cursors()
+                    .filter(|point| (line_offset..end_line).contains(&point.line()))
+                    .map(|point| {
+                        let byte = text.point_to_byte(point);
+                        let width = match text.char_at_byte(byte) {
+                            Some(_) => text.next_grapheme_boundary(byte) - byte,
+                            None => 1,
+                        };
+                        (PointRange::new(point, point.right(width)), style)
+                    })
+                    .collect::<Vec<_>>(),
+                None => vec![],
             };
 
+        let mut bracket_highlights =
+            match self.highlight_id_by_name(HighlightName::MATCHING_BRACKET).style(&theme) {
+                Some(style) => self
+                    .matching_brackets(view.id())
+                    .into_iter()
+                    .flat_map(|(a, b)| [a, b])
+                    .map(|point| (PointRange::new(point, point.right(1)), style))
+                    .collect::<Vec<_>>(),
+                None => vec![],
+            };
+        bracket_highlights.sort_by_key(|(range, _)| range.start());
+
         let highlights = view_highlights
             .range_merge(search_highlights)
             .range_merge(visual_highlights.into_iter())
+            .range_merge(cursor_highlights.into_iter())
+            .range_merge(bracket_highlights.into_iter())
             .map(|(range, style)| (range - Offset::new(line_offset, 0), style));
 
         let text = buf.text();
@@ -260,6 +390,86 @@ impl Editor {
             .default_if_empty(|| Box::new("") as Box<dyn AnyTextSlice<'_>>);
 
         let chunks = zi_text::annotate(lines, highlights);
+        let chunks: Box<dyn Iterator<Item = _> + '_> = if *view.settings().list.read() {
+            let whitespace = self.highlight_id_by_name(HighlightName::WHITESPACE).style(&theme);
+            Box::new(show_whitespace(
+                chunks,
+                text,
+                line_offset,
+                view.settings().listchars.read().clone(),
+                *buf.settings().tab_width.read() as usize,
+                whitespace,
+            ))
+        } else {
+            Box::new(chunks)
+        };
+
+        let mut chunks = chunks
+            .take_while(|&(line, ..)| line_offset + line < end_line)
+            // Move each line to the row it is displayed on, dropping the lines hidden by closed folds.
+            .filter_map(|(line, text, style)| {
+                Some((rows.binary_search(&(line_offset + line)).ok()?, text, style))
+            })
+            .peekable();
+
+        // The first line of a closed fold is followed by the number of lines in the fold.
+        let folded_style = self.highlight_id_by_name(HighlightName::FOLDED).style(&theme);
+        let mut summaries = rows
+            .iter()
+            .enumerate()
+            .filter_map(|(row, &line)| {
+                let fold = folds.closed_at(line)?;
+                let summary = format!(" ... ({} lines)", fold.end() - fold.start() + 1);
+                Some((row, Cow::Owned(summary), folded_style))
+            })
+            .collect::<Vec<_>>();
+
+        // The diagnostic on the cursor line is shown after the text of the line, so it doesn't move any columns.
+        let cursor_line = view.cursor().line();
+        if let (Some((message, severity)), Ok(row), None) = (
+            self.diagnostic_virtual_text(view.id()),
+            rows.binary_search(&cursor_line),
+            folds.closed_at(cursor_line),
+        ) {
+            let tab_width = *buf.settings().tab_width.read() as usize;
+            let line_width = text.line(cursor_line).map_or(0, |line| {
+                tui::expand_tabs(line.to_cow().trim_end_matches('\n'), tab_width).width()
+            });
+            // Work out the width of the gutter as `Lines` will, the one from the previous render may be stale.
+            // Only the rows up to the end of the text are rendered.
+            let line_count =
+                text.line_slice(line_offset..).lines().take(end_line - line_offset).count().max(1);
+            let shown = rows.iter().take_while(|&&line| line < line_offset + line_count).count();
+            let gutter_width = tui::gutter_width(
+                *view.settings().line_number_style.read(),
+                *view.settings().line_number_width.read(),
+                cursor_line,
+                &rows[..shown],
+            );
+            let available = (area.width as usize).saturating_sub(gutter_width + line_width);
+            let hl_name = match severity {
+                Severity::Error => HighlightName::ERROR_SIGN,
+                Severity::Warning => HighlightName::WARNING_SIGN,
+                Severity::Info => HighlightName::INFO_SIGN,
+                Severity::Hint => HighlightName::HINT_SIGN,
+            };
+            if let Some(virtual_text) = truncate(&format!("  {message}"), available) {
+                let style = self.highlight_id_by_name(hl_name).style(&theme);
+                summaries.push((row, Cow::Owned(virtual_text), style));
+                summaries.sort_by_key(|&(row, ..)| row);
+            }
+        }
+        let mut summaries = summaries.into_iter().peekable();
+
+        let chunks = std::iter::from_fn(move || match (chunks.peek(), summaries.peek()) {
+            (Some(&(row, ..)), Some(&(summary_row, ..))) if row > summary_row => summaries.next(),
+            (None, Some(_)) => summaries.next(),
+            _ => chunks.next(),
+        });
+
+        // Diagnostics are more pressing than changes, so they replace the git signs on the same line.
+        let mut signs = self.git_signs(buf.id(), line_offset..end_line);
+        signs.extend(self.diagnostic_signs(buf.id(), relevant_byte_range));
 
         let lines = tui::Lines::new(
             line_offset,
@@ -275,8 +485,98 @@ impl Editor {
                     (line, text, style.into())
                 },
             ),
-        );
+        )
+        .signs(signs)
+        .rows(rows.clone())
+        .wrap(*view.settings().wrap.read());
 
         lines.render_(area, surface)
     }
 }
+
+/// Replace the whitespace in the chunks with the glyphs of `listchars`, styled as whitespace.
+/// Each glyph takes up as many cells as the character it stands in for, so nothing after it moves.
+fn show_whitespace<'a>(
+    chunks: impl Iterator<Item = (usize, Cow<'a, str>, Option<Style>)> + 'a,
+    text: &'a dyn AnyText,
+    line_offset: usize,
+    listchars: ListChars,
+    tab_width: usize,
+    whitespace: Option<Style>,
+) -> impl Iterator<Item = (usize, Cow<'a, str>, Option<Style>)> + 'a {
+    // The line of the current chunk, where the chunk starts in it and where the trailing spaces of the line start.
+    let mut line = usize::MAX;
+    let mut col = 0;
+    let mut trail = 0;
+    chunks.flat_map(move |(i, chunk, style)| {
+        if i != line {
+            line = i;
+            col = 0;
+            let content =
+                text.line(line_offset + i).map_or(Cow::Borrowed(""), |line| line.to_cow());
+            trail = content.trim_end_matches('\n').trim_end_matches(' ').len();
+        }
+        let start = col;
+        col += chunk.len();
+
+        if !chunk.contains(['\t', ' ', '\u{a0}', '\n']) {
+            return vec![(i, chunk, style)];
+        }
+
+        let glyph_style = match (style, whitespace) {
+            (Some(style), Some(whitespace)) => Some(style.merge(whitespace)),
+            (style, whitespace) => whitespace.or(style),
+        };
+        let mut chunks = vec![];
+        let mut plain = String::new();
+        for (j, c) in chunk.char_indices() {
+            let glyph = match c {
+                '\t' => listchars.tab(tab_width),
+                ' ' if start + j >= trail => listchars.trail.map(String::from),
+                '\u{a0}' => listchars.nbsp.map(String::from),
+                '\n' => listchars.eol.map(|eol| format!("{eol}\n")),
+                _ => None,
+            };
+            match glyph {
+                Some(glyph) => {
+                    if !plain.is_empty() {
+                        chunks.push((i, Cow::Owned(std::mem::take(&mut plain)), style));
+                    }
+                    chunks.push((i, Cow::Owned(glyph), glyph_style));
+                }
+                None => plain.push(c),
+            }
+        }
+        if !plain.is_empty() {
+            chunks.push((i, Cow::Owned(plain), style));
+        }
+        chunks
+    })
+}
+
+/// Cut the text down to `width` columns, marking where it was cut with an ellipsis.
+/// Returns `None` if there isn't room for any of it.
+fn truncate(text: &str, width: usize) -> Option<String> {
+    if text.width() <= width {
+        return Some(text.to_string());
+    }
+
+    // Not worth showing a couple of characters that don't say anything.
+    const MIN_WIDTH: usize = 8;
+    if width < MIN_WIDTH {
+        return None;
+    }
+
+    let mut truncated = String::new();
+    let mut used = 0;
+    for c in text.chars() {
+        let w = c.width().unwrap_or(0);
+        if used + w + 1 > width {
+            break;
+        }
+        used += w;
+        truncated.push(c);
+    }
+    truncated.push('…');
+    Some(truncated)
+}
@@ -15,6 +15,8 @@ pub(super) struct SearchState {
     pub(super) hlsearch: bool,
     matches: Vec<Match>,
     match_idx: usize,
+    /// Whether the last move to the next or previous match wrapped around the buffer
+    wrapped: bool,
 }
 
 impl SearchState {
@@ -52,11 +54,17 @@ impl SearchState {
             return None;
         }
 
+        self.wrapped = self.match_idx + 1 == self.matches.len();
         self.match_idx = (self.match_idx + 1) % self.matches.len();
         self.matches.get(self.match_idx)
     }
 
     pub(super) fn prev_match(&mut self) -> Option<&Match> {
+        if self.matches.is_empty() {
+            return None;
+        }
+
+        self.wrapped = self.match_idx == 0;
         if self.match_idx == 0 {
             self.match_idx = self.matches.len() - 1;
         } else {
@@ -65,6 +73,10 @@ impl SearchState {
 
         self.matches.get(self.match_idx)
     }
+
+    pub(super) fn take_wrapped(&mut self) -> bool {
+        std::mem::take(&mut self.wrapped)
+    }
 }
 
 #[derive(Debug, Clone, PartialEq, Eq)]
@@ -0,0 +1,381 @@
+//! Sessions save the open files, the layout of the views, the marks and the working directory,
+//! so `:source` can pick up where `:mksession` left off.
+//!
+//! ```toml
+//! # The index of the active view, counting the views depth first.
+//! active = 1
+//! cwd = "/home/user/project"
+//!
+//! [layout]
+//! direction = "horizontal"
+//!
+//! [[layout.children]]
+//! constraint = "fill:1"
+//! cursor = [10, 4]
+//! path = "/home/user/project/src/main.rs"
+//! # The first line in view.
+//! scroll = 2
+//!
+//! [[layout.children]]
+//! constraint = "percentage:30"
+//! cursor = [0, 0]
+//! path = "/home/user/project/README.md"
+//! scroll = 0
+//!
+//! [[marks]]
+//! name = "A"
+//! path = "/home/user/project/src/main.rs"
+//! point = [10, 0]
+//! ```
+//!
+//! A view that isn't showing a file, such as the scratch buffer, has no `path` and is restored empty.
+
+use std::collections::{BTreeSet, HashMap};
+use std::future::Future;
+use std::path::{Path, PathBuf};
+use std::{env, fmt, fs};
+
+use anyhow::{anyhow, bail};
+use tui::Constraint;
+use zi_text::{Text as _, TextBase as _};
+
+use super::Result;
+use crate::layout::Splits;
+use crate::{BufferId, Direction, Editor, OpenFlags, Point, View};
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Session {
+    cwd: PathBuf,
+    layout: Splits<SessionView>,
+    /// The index of the active view in `layout`, counting depth first.
+    active: usize,
+    marks: Vec<SessionMark>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct SessionView {
+    path: Option<PathBuf>,
+    cursor: Point,
+    /// The first line in view.
+    scroll: usize,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct SessionMark {
+    name: char,
+    path: PathBuf,
+    point: Point,
+}
+
+impl Editor {
+    /// Save the session to `path`, see the module docs for the format.
+    pub fn save_session(&self, path: impl AsRef<Path>) -> Result<()> {
+        fs::write(path, self.session()?.to_string())?;
+        Ok(())
+    }
+
+    /// Restore the session saved at `path`, replacing the current layout.
+    /// Files that no longer exist are skipped with a warning and their views are left empty.
+    pub fn load_session(
+        &mut self,
+        path: impl AsRef<Path>,
+    ) -> Result<impl Future<Output = Result<()>> + 'static> {
+        let session = Session::parse(&fs::read_to_string(path)?)?;
+
+        let mut warnings = vec![];
+        if let Err(err) = env::set_current_dir(&session.cwd) {
+            warnings
+                .push(format!("failed to change directory to `{}`: {err}", session.cwd.display()));
+        }
+
+        let paths = session
+            .layout
+            .views()
+            .into_iter()
+            .filter_map(|view| view.path.as_ref())
+            .chain(session.marks.iter().map(|mark| &mark.path))
+            .cloned()
+            .collect::<BTreeSet<_>>();
+
+        let mut opens = vec![];
+        for path in paths {
+            if !path.exists() {
+                tracing::warn!(path = %path.display(), "skipping missing file in session");
+                warnings.push(format!("skipped missing file `{}`", path.display()));
+                continue;
+            }
+
+            let fut = self
+                .open(path.clone(), OpenFlags::SPAWN_LANGUAGE_SERVICES | OpenFlags::BACKGROUND)?;
+            opens.push((path, fut));
+        }
+
+        let client = self.client();
+        Ok(async move {
+            let mut bufs = HashMap::new();
+            for (path, fut) in opens {
+                bufs.insert(path, fut.await?);
+            }
+
+            client.with(move |editor| editor.restore_session(session, &bufs, warnings)).await
+        })
+    }
+
+    fn session(&self) -> Result<Session> {
+        let (splits, active) = self.tree.splits();
+        let active = splits
+            .views()
+            .into_iter()
+            .position(|&view| view == active)
+            .expect("active view is in the splits");
+
+        let layout = splits.map(&mut |view| SessionView {
+            path: self[self[view].buffer()].file_path(),
+            cursor: self[view].cursor(),
+            scroll: self[view].offset().line,
+        });
+
+        let mut marks = self
+            .named_mark_locations()
+            .into_iter()
+            .filter_map(|(name, loc)| {
+                Some(SessionMark { name, path: self[loc.buf].file_path()?, point: loc.point })
+            })
+            .collect::<Vec<_>>();
+        marks.sort_by(|a, b| (a.name, &a.path).cmp(&(b.name, &b.path)));
+
+        Ok(Session { cwd: env::current_dir()?, layout, active, marks })
+    }
+
+    fn restore_session(
+        &mut self,
+        session: Session,
+        bufs: &HashMap<PathBuf, BufferId>,
+        warnings: Vec<String>,
+    ) -> Result<()> {
+        let mut views = vec![];
+        let splits = session.layout.map(&mut |view| {
+            let buf = view.path.as_ref().and_then(|path| bufs.get(path)).copied();
+            let buf = buf.unwrap_or(self.empty_buffer);
+            let id = self.views.insert_with_key(|id| View::new(id, buf));
+            views.push((id, view));
+            id
+        });
+
+        let (active, _) =
+            views.get(session.active).or(views.last()).expect("splits are never empty");
+        self.tree.set_splits(splits, *active);
+
+        for (id, view) in views {
+            // Scroll first so the cursor only moves the view if the file has changed since.
+            self.scroll(id, Direction::Down, view.scroll);
+            self.set_cursor(id, view.cursor);
+        }
+
+        for mark in session.marks {
+            let Some(&buf) = bufs.get(&mark.path) else { continue };
+            let text = self[buf].text();
+            let Some(len) = text.line(mark.point.line()).map(|line| line.len_bytes()) else {
+                continue;
+            };
+            let byte = text.line_to_byte(mark.point.line()) + mark.point.col().min(len);
+            self.set_mark_at(buf, mark.name, byte)?;
+        }
+
+        if !warnings.is_empty() {
+            self.set_error(warnings.join("; "));
+        }
+
+        Ok(())
+    }
+}
+
+impl Session {
+    fn parse(src: &str) -> Result<Self> {
+        let table = toml::from_str::<toml::Table>(src)?;
+        let cwd = PathBuf::from(get_str(&table, "cwd")?);
+        let active = get_usize(&table, "active")?;
+        let Some(layout) = table.get("layout").and_then(|layout| layout.as_table()) else {
+            bail!("`layout` must be a table")
+        };
+        let layout = parse_splits(layout)?;
+
+        let mut marks = vec![];
+        if let Some(values) = table.get("marks") {
+            let Some(values) = values.as_array() else { bail!("`marks` must be an array") };
+            for value in values {
+                let Some(mark) = value.as_table() else { bail!("each mark must be a table") };
+                let mut name = get_str(mark, "name")?.chars();
+                let (Some(name), None) = (name.next(), name.next()) else {
+                    bail!("`name` must be a single character")
+                };
+                let path = PathBuf::from(get_str(mark, "path")?);
+                marks.push(SessionMark { name, path, point: get_point(mark, "point")? });
+            }
+        }
+
+        Ok(Self { cwd, layout, active, marks })
+    }
+}
+
+fn parse_splits(table: &toml::Table) -> Result<Splits<SessionView>> {
+    let Some(children) = table.get("children") else {
+        let path = match table.get("path") {
+            Some(_) => Some(PathBuf::from(get_str(table, "path")?)),
+            None => None,
+        };
+        return Ok(Splits::View(SessionView {
+            path,
+            cursor: get_point(table, "cursor")?,
+            scroll: get_usize(table, "scroll")?,
+        }));
+    };
+
+    let direction = match get_str(table, "direction")? {
+        "horizontal" => tui::Direction::Horizontal,
+        "vertical" => tui::Direction::Vertical,
+        direction => bail!("invalid direction `{direction}`"),
+    };
+
+    let Some(children) = children.as_array().filter(|children| !children.is_empty()) else {
+        bail!("`children` must be a non-empty array")
+    };
+
+    let children = children
+        .iter()
+        .map(|child| -> Result<_> {
+            let Some(child) = child.as_table() else { bail!("each child must be a table") };
+            Ok((parse_constraint(get_str(child, "constraint")?)?, parse_splits(child)?))
+        })
+        .collect::<Result<_>>()?;
+
+    Ok(Splits::Split { direction, children })
+}
+
+fn parse_constraint(s: &str) -> Result<Constraint> {
+    let invalid = || anyhow!("invalid constraint `{s}`");
+    let (kind, n) = s.split_once(':').ok_or_else(invalid)?;
+    let constraint = match kind {
+        "ratio" => {
+            let (a, b) = n.split_once('/').ok_or_else(invalid)?;
+            Constraint::Ratio(a.parse().map_err(|_| invalid())?, b.parse().map_err(|_| invalid())?)
+        }
+        _ => {
+            let n = n.parse().map_err(|_| invalid())?;
+            match kind {
+                "min" => Constraint::Min(n),
+                "max" => Constraint::Max(n),
+                "length" => Constraint::Length(n),
+                "percentage" => Constraint::Percentage(n),
+                "fill" => Constraint::Fill(n),
+                _ => return Err(invalid()),
+            }
+        }
+    };
+    Ok(constraint)
+}
+
+fn constraint_to_string(constraint: Constraint) -> String {
+    match constraint {
+        Constraint::Min(n) => format!("min:{n}"),
+        Constraint::Max(n) => format!("max:{n}"),
+        Constraint::Length(n) => format!("length:{n}"),
+        Constraint::Percentage(n) => format!("percentage:{n}"),
+        Constraint::Ratio(a, b) => format!("ratio:{a}/{b}"),
+        Constraint::Fill(n) => format!("fill:{n}"),
+    }
+}
+
+pub(super) fn get_str<'a>(table: &'a toml::Table, key: &str) -> Result<&'a str> {
+    table
+        .get(key)
+        .and_then(|value| value.as_str())
+        .ok_or_else(|| anyhow!("`{key}` must be a string"))
+}
+
+pub(super) fn get_usize(table: &toml::Table, key: &str) -> Result<usize> {
+    table
+        .get(key)
+        .and_then(|value| value.as_integer())
+        .and_then(|n| usize::try_from(n).ok())
+        .ok_or_else(|| anyhow!("`{key}` must be a non-negative integer"))
+}
+
+pub(super) fn get_point(table: &toml::Table, key: &str) -> Result<Point> {
+    let point = table.get(key).and_then(|value| value.as_array()).and_then(|point| {
+        let [line, col] = point.as_slice() else { return None };
+        let line = usize::try_from(line.as_integer()?).ok()?;
+        let col = usize::try_from(col.as_integer()?).ok()?;
+        Some(Point::new(line, col))
+    });
+    point.ok_or_else(|| anyhow!("`{key}` must be a `[line, col]` pair"))
+}
+
+pub(super) fn path_value(path: &Path) -> toml::Value {
+    toml::Value::String(path.display().to_string())
+}
+
+pub(super) fn point_value(point: Point) -> toml::Value {
+    toml::Value::Array(vec![
+        toml::Value::Integer(point.line() as i64),
+        toml::Value::Integer(point.col() as i64),
+    ])
+}
+
+fn splits_table(splits: &Splits<SessionView>) -> toml::Table {
+    let mut table = toml::Table::new();
+    match splits {
+        Splits::View(view) => {
+            if let Some(path) = &view.path {
+                table.insert("path".into(), path_value(path));
+            }
+            table.insert("cursor".into(), point_value(view.cursor));
+            table.insert("scroll".into(), toml::Value::Integer(view.scroll as i64));
+        }
+        Splits::Split { direction, children } => {
+            let direction = match direction {
+                tui::Direction::Horizontal => "horizontal",
+                tui::Direction::Vertical => "vertical",
+            };
+            table.insert("direction".into(), toml::Value::String(direction.into()));
+
+            let children = children
+                .iter()
+                .map(|(constraint, child)| {
+                    let mut child = splits_table(child);
+                    let constraint = constraint_to_string(*constraint);
+                    child.insert("constraint".into(), toml::Value::String(constraint));
+                    toml::Value::Table(child)
+                })
+                .collect();
+            table.insert("children".into(), toml::Value::Array(children));
+        }
+    }
+    table
+}
+
+impl fmt::Display for Session {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let mut table = toml::Table::new();
+        table.insert("cwd".into(), path_value(&self.cwd));
+        table.insert("active".into(), toml::Value::Integer(self.active as i64));
+        table.insert("layout".into(), toml::Value::Table(splits_table(&self.layout)));
+
+        if !self.marks.is_empty() {
+            let marks = self
+                .marks
+                .iter()
+                .map(|mark| {
+                    let mut table = toml::Table::new();
+                    table.insert("name".into(), toml::Value::String(mark.name.to_string()));
+                    table.insert("path".into(), path_value(&mark.path));
+                    table.insert("point".into(), point_value(mark.point));
+                    toml::Value::Table(table)
+                })
+                .collect();
+            table.insert("marks".into(), toml::Value::Array(marks));
+        }
+
+        write!(f, "{table}")
+    }
+}
@@ -0,0 +1,318 @@
+use std::collections::HashMap;
+use std::mem;
+use std::ops::Range;
+use std::path::PathBuf;
+
+use zi_text::{Delta, Deltas, Text as _, TextSlice as _};
+
+use super::{Selector, get, mode, set_error};
+use crate::snippet::{Snippet, load_snippets};
+use crate::view::SetCursorFlags;
+use crate::{BufferId, EditError, Editor, FileType, Mode, ViewId};
+
+#[derive(Debug, Default)]
+pub(super) struct Snippets {
+    /// The directory with the user snippets of each language, `<dir>/<filetype>.toml`.
+    dir: Option<PathBuf>,
+    /// The user snippets of each file type by their trigger, loaded when the file type is first expanded in.
+    by_ft: HashMap<FileType, HashMap<String, String>>,
+    active: Option<ActiveSnippet>,
+}
+
+/// An expanded snippet whose tabstops are being filled in.
+#[derive(Debug)]
+struct ActiveSnippet {
+    view: ViewId,
+    buf: BufferId,
+    /// The byte ranges of each tabstop and its mirrors, kept up to date as the buffer is edited.
+    tabstops: Vec<Vec<Range<usize>>>,
+    /// The index of the current tabstop.
+    idx: usize,
+    /// The placeholder of the current tabstop is selected, typing replaces it.
+    selected: bool,
+}
+
+impl Editor {
+    /// Set the directory the user snippets are loaded from, the snippets of each language are in
+    /// `<dir>/<filetype>.toml`. Any snippets loaded from the previous directory are forgotten.
+    pub fn set_snippet_dir(&mut self, dir: impl Into<PathBuf>) {
+        self.snippets.dir = Some(dir.into());
+        self.snippets.by_ft.clear();
+    }
+
+    /// Replace the byte range of the view's buffer with the snippet and move to its first tabstop.
+    pub fn insert_snippet(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        range: Range<usize>,
+        snippet: &str,
+    ) -> Result<(), EditError> {
+        let view = selector.select(self);
+        let mut snippet = Snippet::parse(snippet);
+        self.indent_snippet(view, range.start, &mut snippet);
+        self.expand_snippet(view, range, snippet)
+    }
+
+    /// Indent the snippet to match the line it's inserted on.
+    pub(super) fn indent_snippet(&self, view: ViewId, at: usize, snippet: &mut Snippet) {
+        let text = self[self[view].buffer()].text();
+        if let Some(line) = text.line(text.byte_to_line(at)) {
+            let indent = line.chars().take_while(|&c| c == ' ' || c == '\t').collect::<String>();
+            snippet.indent(&indent);
+        }
+    }
+
+    pub(super) fn expand_snippet(
+        &mut self,
+        view: ViewId,
+        range: Range<usize>,
+        snippet: Snippet,
+    ) -> Result<(), EditError> {
+        let buf = self[view].buffer();
+        let start = range.start;
+        let Snippet { text, tabstops } = snippet;
+        // The new snippet takes over from any snippet that's being filled in.
+        self.snippets.active = None;
+        self.edit(buf, &Deltas::single(range, text))?;
+
+        let tabstops = tabstops
+            .into_iter()
+            .map(|ranges| ranges.into_iter().map(|r| start + r.start..start + r.end).collect())
+            .collect();
+        self.snippets.active = Some(ActiveSnippet { view, buf, tabstops, idx: 0, selected: false });
+        self.goto_tabstop(0);
+        Ok(())
+    }
+
+    /// Expand the user snippet whose trigger is the word before the cursor.
+    /// Returns `false` if there is no such snippet.
+    pub(super) fn expand_snippet_trigger(
+        &mut self,
+        selector: impl Selector<ViewId>,
+    ) -> Result<bool, EditError> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let cursor = self[view].cursor();
+        let Some(line) = self[buf].text().line(cursor.line()) else { return Ok(false) };
+        let line = line.to_cow();
+        let before = &line[..cursor.col().min(line.len())];
+        let word = before
+            .char_indices()
+            .rev()
+            .take_while(|&(_, c)| c.is_alphanumeric() || c == '_')
+            .last()
+            .map_or("", |(i, _)| &before[i..])
+            .to_string();
+        if word.is_empty() {
+            return Ok(false);
+        }
+
+        let ft = self[buf].file_type();
+        let Some(body) = self.user_snippets(ft).get(&word).cloned() else { return Ok(false) };
+        let end = self.cursor_byte(view);
+        let start = end - word.len();
+        let mut snippet = Snippet::parse(&body);
+        self.indent_snippet(view, start, &mut snippet);
+        self.expand_snippet(view, start..end, snippet)?;
+        Ok(true)
+    }
+
+    fn user_snippets(&mut self, ft: FileType) -> &HashMap<String, String> {
+        if !self.snippets.by_ft.contains_key(&ft) {
+            let path = self.snippets.dir.as_ref().map(|dir| dir.join(format!("{ft}.toml")));
+            let snippets = match path.map(|path| load_snippets(&path)).transpose() {
+                Ok(snippets) => snippets.unwrap_or_default(),
+                Err(err) => {
+                    set_error!(self, err);
+                    HashMap::new()
+                }
+            };
+            self.snippets.by_ft.insert(ft, snippets);
+        }
+        &self.snippets.by_ft[&ft]
+    }
+
+    /// Move to the next tabstop of the snippet in the view, the snippet is done once the last one is reached.
+    /// Returns `false` if no snippet is being filled in.
+    pub(super) fn next_tabstop(&mut self, selector: impl Selector<ViewId>) -> bool {
+        let view = selector.select(self);
+        match &self.snippets.active {
+            Some(snippet) if snippet.view == view => {
+                self.goto_tabstop(snippet.idx + 1);
+                true
+            }
+            _ => false,
+        }
+    }
+
+    pub(super) fn prev_tabstop(&mut self, selector: impl Selector<ViewId>) -> bool {
+        let view = selector.select(self);
+        match &self.snippets.active {
+            Some(snippet) if snippet.view == view => {
+                self.goto_tabstop(snippet.idx.saturating_sub(1));
+                true
+            }
+            _ => false,
+        }
+    }
+
+    /// Put a cursor at the start of each range of the tabstop, the mirrors are typed into along with it.
+    fn goto_tabstop(&mut self, idx: usize) {
+        let Some(snippet) = &mut self.snippets.active else { return };
+        let (view, buf) = (snippet.view, snippet.buf);
+        let ranges = snippet.tabstops[idx].clone();
+        snippet.idx = idx;
+        snippet.selected = ranges.iter().any(|range| !range.is_empty());
+        if idx + 1 == snippet.tabstops.len() {
+            self.snippets.active = None;
+        }
+
+        let text = self[buf].text();
+        let len = text.len_bytes();
+        let points =
+            ranges.iter().map(|range| text.byte_to_point(range.start.min(len))).collect::<Vec<_>>();
+        self.set_cursor_bytewise(view, ranges[0].start.min(len));
+
+        let (view, buf) = get!(self: view);
+        let area = self.tree.view_area(view.id());
+        view.set_secondary_cursors(
+            mode!(self),
+            area,
+            buf,
+            points[1..].iter().copied(),
+            SetCursorFlags::empty(),
+        );
+    }
+
+    /// If the placeholder of the current tabstop is selected, delete it and its mirrors so typing replaces them.
+    /// Returns whether the placeholder was deleted.
+    pub(super) fn take_snippet_placeholder(
+        &mut self,
+        selector: impl Selector<ViewId>,
+    ) -> Result<bool, EditError> {
+        let view = selector.select(self);
+        if mode!(self) != Mode::Insert {
+            return Ok(false);
+        }
+
+        let Some(snippet) = &mut self.snippets.active else { return Ok(false) };
+        if snippet.view != view || !mem::take(&mut snippet.selected) {
+            return Ok(false);
+        }
+
+        let (buf, idx) = (snippet.buf, snippet.idx);
+        let mut ranges = snippet.tabstops[idx].clone();
+        // The cursor has been moved away from the placeholder since it was selected.
+        if self.cursor_byte(view) != ranges[0].start {
+            return Ok(false);
+        }
+
+        ranges.retain(|range| !range.is_empty());
+        ranges.sort_by_key(|range| range.start);
+        ranges.dedup_by(|range, prev| range.start < prev.end);
+        self.edit(buf, &Deltas::new(ranges.into_iter().map(Delta::delete)))?;
+        self.goto_tabstop(idx);
+        Ok(true)
+    }
+
+    /// The ranges of the selected placeholder in the view, they are highlighted as if selected in visual mode.
+    pub(super) fn snippet_selection(&self, view: ViewId) -> &[Range<usize>] {
+        match &self.snippets.active {
+            Some(snippet) if snippet.view == view && snippet.selected => {
+                &snippet.tabstops[snippet.idx]
+            }
+            _ => &[],
+        }
+    }
+
+    /// Stop filling in the snippet, this happens on leaving insert mode.
+    pub(super) fn finish_snippet(&mut self) {
+        let Some(snippet) = self.snippets.active.take() else { return };
+        // The cursors on the mirrors were only there to type into them.
+        if snippet.tabstops[snippet.idx].len() > 1 {
+            self.clear_secondary_cursors(snippet.view);
+        }
+    }
+
+    /// Shift the tabstops to cover the same text after the edit.
+    pub(super) fn shift_snippet(&mut self, buf: BufferId, deltas: &Deltas<'_>) {
+        let Some(snippet) = &mut self.snippets.active else { return };
+        if snippet.buf != buf {
+            return;
+        }
+
+        let current = snippet.tabstops[snippet.idx].clone();
+        for (idx, ranges) in snippet.tabstops.iter_mut().enumerate() {
+            for range in ranges {
+                // Typing into the current tabstop also types into the placeholders it's nested in.
+                let grow = idx == snippet.idx
+                    || (!range.is_empty()
+                        && current.iter().any(|c| range.start <= c.start && c.end <= range.end));
+                for delta in deltas.iter() {
+                    shift_range(range, delta.range(), delta.text().len(), grow);
+                }
+            }
+        }
+    }
+}
+
+/// Shift a range of the old text to cover the same text after replacing `edit` with `len` bytes.
+/// If `grow` is set, an edit touching either end of the range is part of it, otherwise the range is left as is
+/// by an edit at its end and moved by an edit at its start.
+fn shift_range(range: &mut Range<usize>, edit: Range<usize>, len: usize, grow: bool) {
+    let diff = len as isize - edit.len() as isize;
+    let (before, after) = if grow {
+        (edit.end < range.start, edit.start > range.end)
+    } else {
+        (edit.end <= range.start, edit.start >= range.end)
+    };
+
+    if before {
+        range.start = range.start.saturating_add_signed(diff);
+        range.end = range.end.saturating_add_signed(diff);
+    } else if !after {
+        // The edit overlaps the range, the range now covers whatever replaced the overlapping part.
+        range.start = range.start.min(edit.start);
+        range.end = range.end.max(edit.end).saturating_add_signed(diff);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use std::ops::Range;
+
+    use super::shift_range;
+
+    #[track_caller]
+    fn check(
+        range: Range<usize>,
+        edit: Range<usize>,
+        len: usize,
+        grow: bool,
+        expected: Range<usize>,
+    ) {
+        let mut range = range;
+        shift_range(&mut range, edit, len, grow);
+        assert_eq!(range, expected);
+    }
+
+    #[test]
+    fn shift_tabstop_range() {
+        // Edits before and after the range.
+        check(4..6, 0..1, 3, false, 6..8);
+        check(4..6, 2..4, 0, false, 2..4);
+        check(4..6, 7..8, 3, true, 4..6);
+        check(4..6, 6..7, 0, false, 4..6);
+        // Typing at either end of the range.
+        check(4..6, 6..6, 1, true, 4..7);
+        check(4..6, 6..6, 1, false, 4..6);
+        check(4..6, 4..4, 1, true, 4..7);
+        check(4..6, 4..4, 1, false, 5..7);
+        check(4..4, 4..4, 2, true, 4..6);
+        check(4..4, 4..4, 2, false, 6..6);
+        // Replacing the placeholder or part of it.
+        check(4..6, 4..6, 0, true, 4..4);
+        check(4..6, 5..6, 3, false, 4..8);
+        check(4..6, 3..5, 1, false, 3..5);
+    }
+}
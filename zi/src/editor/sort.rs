@@ -0,0 +1,89 @@
+use std::ops::RangeInclusive;
+
+use regex::Regex;
+use zi_text::{Deltas, Text as _, TextSlice as _};
+
+use super::{Result, Selector};
+use crate::buffer::SnapshotFlags;
+use crate::command::{Sort, SortFlags};
+use crate::{Editor, Point, ViewId};
+
+/// The part of the line to sort by, the match of the pattern or its first capture group.
+fn sort_key<'a>(line: &'a str, pattern: Option<&Regex>) -> &'a str {
+    let Some(pattern) = pattern else { return line };
+    match pattern.captures(line) {
+        Some(captures) => captures.get(1).or_else(|| captures.get(0)).map_or("", |m| m.as_str()),
+        None => "",
+    }
+}
+
+/// The first (possibly negative) integer in the key, too large numbers saturate.
+fn parse_number(key: &str) -> Option<i64> {
+    let start = key.find(|c: char| c.is_ascii_digit())?;
+    let len = key[start..].find(|c: char| !c.is_ascii_digit()).unwrap_or(key.len() - start);
+    let negative = key[..start].ends_with('-');
+    let n = key[start..start + len].parse::<i64>().unwrap_or(i64::MAX);
+    Some(if negative { -n } else { n })
+}
+
+impl Editor {
+    /// Sort the given lines (0-indexed, inclusive) of the buffer in the view as a single undo step.
+    /// The sort is stable, so lines that compare equal (e.g. lines without a number in a numeric sort) keep their
+    /// order.
+    pub fn sort_lines(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        lines: RangeInclusive<usize>,
+        sort: &Sort,
+    ) -> Result<()> {
+        let pattern = sort.pattern.as_deref().map(Regex::new).transpose()?;
+        let ignore_case = sort.flags.contains(SortFlags::IGNORE_CASE);
+
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let text = self[buf].text();
+        let start = text.line_to_byte(*lines.start());
+        let end = text.try_line_to_byte(lines.end() + 1).unwrap_or(text.len_bytes());
+        let region = text.byte_slice(start..end).to_cow();
+
+        // The newline after the last line is kept where it is, so a missing final newline stays missing.
+        let (content, newline) = match region.strip_suffix('\n') {
+            Some(content) => (content, "\n"),
+            None => (&region[..], ""),
+        };
+
+        let mut sorted = content
+            .split('\n')
+            .map(|line| {
+                let key = sort_key(line, pattern.as_ref());
+                let key = if ignore_case { key.to_lowercase() } else { key.to_string() };
+                (line, key)
+            })
+            .collect::<Vec<_>>();
+
+        sorted.sort_by(|(_, a), (_, b)| {
+            let ordering = if sort.flags.contains(SortFlags::NUMERIC) {
+                parse_number(a).cmp(&parse_number(b))
+            } else {
+                a.cmp(b)
+            };
+
+            if sort.flags.contains(SortFlags::REVERSE) { ordering.reverse() } else { ordering }
+        });
+
+        if sort.flags.contains(SortFlags::UNIQUE) {
+            sorted.dedup_by(|(a, _), (b, _)| {
+                if ignore_case { a.to_lowercase() == b.to_lowercase() } else { a == b }
+            });
+        }
+
+        let new = sorted.into_iter().map(|(line, _)| line).collect::<Vec<_>>().join("\n") + newline;
+        if new != region {
+            self.edit(buf, &Deltas::single(start..end, new))?;
+            self[buf].snapshot(SnapshotFlags::empty());
+        }
+
+        self.set_cursor(view, Point::new(*lines.start(), 0));
+        Ok(())
+    }
+}
@@ -1,6 +1,8 @@
+use super::command_completion::CommandCompletion;
+use super::visual::BlockInsert;
 use super::{Active, Editor};
 use crate::completion::Completion;
-use crate::{Mode, Operator, Point};
+use crate::{Location, Mode, Operator, Point};
 
 /// Per mode state
 #[derive(Debug)]
@@ -56,6 +58,13 @@ impl State {
             _ => None,
         }
     }
+
+    pub(super) fn visual_state_mut(&mut self) -> Option<&mut VisualState> {
+        match self {
+            State::Visual(s) | State::VisualLine(s) | State::VisualBlock(s) => Some(s),
+            _ => None,
+        }
+    }
 }
 
 #[derive(Debug, Default)]
@@ -64,12 +73,22 @@ pub(super) struct NormalState {}
 #[derive(Debug, Default)]
 pub(super) struct InsertState {
     pub(super) completion: Completion,
+    /// Set if insert mode was entered from visual block mode to insert on every line of the block.
+    pub(super) block: Option<BlockInsert>,
+    /// The count insert mode was entered with, the inserted text is repeated that many times, e.g. `3ihi<Esc>`.
+    pub(super) count: Option<usize>,
+    /// The byte the first character was inserted at.
+    pub(super) start: Option<usize>,
 }
 
 #[derive(Debug)]
 pub(super) struct CommandState {
     /// Stores the command currently in the command line
     pub(super) buffer: String,
+    /// The cursor position when a search was started, restored if the search is cancelled
+    pub(super) search_origin: Option<Location>,
+    /// The candidates being cycled through with `<Tab>`, cleared on any other edit
+    pub(super) completion: Option<CommandCompletion>,
 }
 
 impl CommandState {
@@ -80,7 +99,7 @@ impl CommandState {
 
 impl Default for CommandState {
     fn default() -> Self {
-        Self { buffer: String::from(":") }
+        Self { buffer: String::from(":"), search_origin: None, completion: None }
     }
 }
 
@@ -92,10 +111,12 @@ pub(super) struct VisualState {
 #[derive(Debug)]
 pub(super) struct OperatorPendingState {
     pub(crate) operator: Operator,
+    /// The count given before the operator, it multiplies the count given to the text object, e.g. `2d3w`.
+    pub(crate) count: Option<usize>,
 }
 
 impl OperatorPendingState {
     pub(super) fn new(operator: Operator) -> Self {
-        Self { operator }
+        Self { operator, count: None }
     }
 }
@@ -0,0 +1,69 @@
+use std::path::{Path, PathBuf};
+use std::{env, fs};
+
+use super::{active_servers_of, get_ref};
+use crate::statusline::Segment;
+use crate::{BufferFlags, Editor, Mode};
+
+impl Editor {
+    /// The left and right aligned parts of the status line of the active view.
+    pub(super) fn render_status_line(&self, width: usize) -> (String, String) {
+        self.settings.statusline.read().render(width, |segment| self.status_segment(segment))
+    }
+
+    fn status_segment(&self, segment: Segment) -> String {
+        let (view, buf) = get_ref!(self);
+        match segment {
+            Segment::Mode => match self.mode() {
+                Mode::Normal | Mode::OperatorPending(_) | Mode::ReplacePending => "NORMAL".into(),
+                mode => mode.to_string(),
+            },
+            Segment::File => match buf.file_path() {
+                Some(path) => path.display().to_string(),
+                None => buf.url().to_string(),
+            },
+            Segment::Modified => {
+                let dirty = if buf.flags().contains(BufferFlags::DIRTY) { "[+]" } else { "" };
+                let deleted = if self.is_deleted_on_disk(buf.id()) { "[deleted]" } else { "" };
+                format!("{dirty}{deleted}")
+            }
+            Segment::Line => (view.cursor().line() + 1).to_string(),
+            Segment::Col => view.cursor().col().to_string(),
+            Segment::Encoding => buf.settings().encoding.read().to_string(),
+            Segment::FileFormat => buf.settings().file_format.read().to_string(),
+            Segment::Branch => self.git_branch.clone().unwrap_or_default(),
+            Segment::Lsp => active_servers_of!(self, buf.id())
+                .map(|server| server.as_str())
+                .collect::<Vec<_>>()
+                .join(","),
+        }
+    }
+
+    /// Reread the checked out branch, this is done on startup and whenever the terminal regains focus
+    /// rather than on every render as the branch is unlikely to change while the editor has focus.
+    pub(crate) fn refresh_git_branch(&mut self) {
+        self.git_branch = env::current_dir().ok().and_then(|dir| git_branch(&dir));
+    }
+}
+
+/// The branch checked out in the repository containing `dir`, or the abbreviated commit if the head is detached.
+fn git_branch(dir: &Path) -> Option<String> {
+    let head = dir.ancestors().find_map(|dir| {
+        let git = dir.join(".git");
+        // In a worktree or submodule `.git` is a file pointing to the actual git directory.
+        let git = match fs::read_to_string(&git) {
+            Ok(contents) => dir.join(PathBuf::from(contents.strip_prefix("gitdir:")?.trim())),
+            Err(_) if git.is_dir() => git,
+            Err(_) => return None,
+        };
+        fs::read_to_string(git.join("HEAD")).ok()
+    })?;
+
+    let head = head.trim();
+    match head.strip_prefix("ref: ") {
+        Some(reference) => {
+            Some(reference.strip_prefix("refs/heads/").unwrap_or(reference).to_string())
+        }
+        None => Some(head.get(..7).unwrap_or(head).to_string()),
+    }
+}
@@ -0,0 +1,195 @@
+use std::collections::VecDeque;
+use std::ops::{Range, RangeInclusive};
+
+use anyhow::bail;
+use regex::{Captures, RegexBuilder};
+use zi_input::{KeyCode, KeyEvent};
+use zi_text::{AnyText, Delta, Deltas, Text as _, TextSlice as _};
+
+use super::{Result, Selector, set_error};
+use crate::buffer::SnapshotFlags;
+use crate::command::{Substitute, SubstituteFlags};
+use crate::{BufferId, Editor, VerticalAlignment, ViewId};
+
+/// A `:s///c` waiting for each match to be confirmed.
+/// While this is set, key presses answer the prompt rather than going through the keymap.
+#[derive(Debug)]
+pub(super) struct PendingSubstitute {
+    view: ViewId,
+    buf: BufferId,
+    /// The remaining matches and their expanded replacements, as byte ranges of the original text.
+    matches: VecDeque<(Range<usize>, String)>,
+    /// The difference in length between the current and the original text due to the replacements made so far.
+    shift: isize,
+}
+
+impl PendingSubstitute {
+    fn prompt(&self) -> Option<String> {
+        let (_, replacement) = self.matches.front()?;
+        Some(format!("replace with {replacement} (y/n/a/q)?"))
+    }
+}
+
+/// Find the matches of the substitution in the given lines and expand their replacements.
+fn find_matches(
+    text: &dyn AnyText,
+    lines: RangeInclusive<usize>,
+    sub: &Substitute,
+) -> Result<Vec<(Range<usize>, String)>> {
+    let ignore_case = if sub.flags.contains(SubstituteFlags::IGNORE_CASE) {
+        true
+    } else if sub.flags.contains(SubstituteFlags::MATCH_CASE) {
+        false
+    } else {
+        // Smartcase, the same as `/`.
+        !sub.pattern.chars().any(char::is_uppercase)
+    };
+
+    let regex =
+        RegexBuilder::new(&sub.pattern).multi_line(true).case_insensitive(ignore_case).build()?;
+
+    let start = text.line_to_byte(*lines.start());
+    let end = text.try_line_to_byte(lines.end() + 1).unwrap_or(text.len_bytes());
+    let haystack = text.byte_slice(start..end).to_cow();
+
+    let mut matches = vec![];
+    // The line (relative to the start of the range) of the last match, and the byte we've counted newlines up to.
+    let mut last_line = None;
+    let (mut line, mut counted) = (0, 0);
+    for captures in regex.captures_iter(&haystack) {
+        let m = captures.get(0).unwrap();
+        // A match at the very end of the range is on the line that follows it, e.g. `^` after the final newline.
+        if m.start() == haystack.len() && haystack.ends_with('\n') {
+            break;
+        }
+
+        line += haystack[counted..m.start()].matches('\n').count();
+        counted = m.start();
+        if !sub.flags.contains(SubstituteFlags::GLOBAL) && last_line == Some(line) {
+            continue;
+        }
+
+        last_line = Some(line);
+        matches.push((
+            start + m.start()..start + m.end(),
+            expand_replacement(&sub.replacement, &captures),
+        ));
+    }
+
+    Ok(matches)
+}
+
+/// Expand a replacement in vim syntax.
+/// `&` and `\0` are the whole match, `\1` to `\9` are the capture groups, `\n` and `\t` are a newline and a tab,
+/// and any other escaped character is taken literally.
+fn expand_replacement(replacement: &str, captures: &Captures<'_>) -> String {
+    let group = |i: usize| captures.get(i).map_or("", |m| m.as_str());
+
+    let mut expanded = String::new();
+    let mut chars = replacement.chars();
+    while let Some(c) = chars.next() {
+        match c {
+            '&' => expanded.push_str(group(0)),
+            '\\' => match chars.next() {
+                Some(d @ '0'..='9') => expanded.push_str(group(d as usize - '0' as usize)),
+                Some('n') => expanded.push('\n'),
+                Some('t') => expanded.push('\t'),
+                Some(c) => expanded.push(c),
+                None => expanded.push('\\'),
+            },
+            c => expanded.push(c),
+        }
+    }
+    expanded
+}
+
+impl Editor {
+    /// Run a `:s` over the given lines (0-indexed, inclusive) of the buffer in the view.
+    /// All the replacements are a single undo step, including the ones confirmed one by one.
+    pub(super) fn substitute(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        lines: RangeInclusive<usize>,
+        sub: &Substitute,
+    ) -> Result<()> {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        let matches = find_matches(self.text(buf), lines, sub)?;
+        if matches.is_empty() {
+            bail!("pattern not found: {}", sub.pattern)
+        }
+
+        if sub.flags.contains(SubstituteFlags::CONFIRM) {
+            let pending = PendingSubstitute { view, buf, matches: matches.into(), shift: 0 };
+            self.substitute = Some(pending);
+            self.advance_substitute();
+            return Ok(());
+        }
+
+        let last = matches.last().map(|(range, _)| range.start).unwrap();
+        let deltas = Deltas::new(matches.into_iter().map(|(range, text)| Delta::new(range, text)));
+        self.edit(buf, &deltas)?;
+        self[buf].snapshot(SnapshotFlags::empty());
+
+        // Like vim, leave the cursor at the start of the line of the last substitution.
+        let text = self.text(buf);
+        let byte = text.line_to_byte(text.byte_to_line(last.min(text.len_bytes())));
+        self.set_cursor(view, byte);
+        Ok(())
+    }
+
+    /// Answer the prompt of a pending `:s///c` with `y`, `n`, `a`, `l` (replace this match and stop) or `q`.
+    pub(super) fn confirm_substitute(&mut self, key: &KeyEvent) {
+        let Some(pending) = &mut self.substitute else { return };
+        match key.code() {
+            KeyCode::Char('y') => self.replace_next_match(),
+            KeyCode::Char('n') => drop(pending.matches.pop_front()),
+            KeyCode::Char('a') => {
+                while self.substitute.as_ref().is_some_and(|pending| !pending.matches.is_empty()) {
+                    self.replace_next_match();
+                }
+            }
+            KeyCode::Char('l') => {
+                self.replace_next_match();
+                self.finish_substitute();
+            }
+            KeyCode::Char('q') | KeyCode::Esc => self.finish_substitute(),
+            // Keep asking.
+            _ => (),
+        }
+
+        self.advance_substitute();
+    }
+
+    fn replace_next_match(&mut self) {
+        let Some(pending) = &mut self.substitute else { return };
+        let Some((range, replacement)) = pending.matches.pop_front() else { return };
+
+        let range = range.start.saturating_add_signed(pending.shift)
+            ..range.end.saturating_add_signed(pending.shift);
+        pending.shift += replacement.len() as isize - range.len() as isize;
+
+        let buf = pending.buf;
+        if let Err(err) = self.edit(buf, &Deltas::single(range, replacement)) {
+            self.finish_substitute();
+            set_error!(self, err);
+        }
+    }
+
+    /// Move the cursor to the next match to confirm and prompt for it, or finish if there are none left.
+    fn advance_substitute(&mut self) {
+        let Some(pending) = &self.substitute else { return };
+        let Some(prompt) = pending.prompt() else { return self.finish_substitute() };
+
+        let (view, start) = (pending.view, pending.matches[0].0.start);
+        let byte = start.saturating_add_signed(pending.shift);
+        self.reveal(view, byte, VerticalAlignment::Center);
+        self.status_message = Some(prompt);
+    }
+
+    fn finish_substitute(&mut self) {
+        if let Some(pending) = self.substitute.take() {
+            self[pending.buf].snapshot(SnapshotFlags::empty());
+        }
+    }
+}
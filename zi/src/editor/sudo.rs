@@ -0,0 +1,53 @@
+use std::path::Path;
+use std::process::Stdio;
+
+use anyhow::{Context as _, bail};
+use tokio::io::AsyncWriteExt;
+use tokio_util::compat::FuturesAsyncReadCompatExt;
+use zi_text::{AnyText, Text as _};
+
+use super::Result;
+
+/// Write the text to the file by piping it to the program with the path appended, e.g. `sudo -A tee <path>`.
+/// The file is written in place by the program, so it keeps its permissions and owner.
+/// `encoded` is the text already encoded if it isn't written as is.
+pub(super) async fn write_file(
+    program: &str,
+    path: &Path,
+    text: &dyn AnyText,
+    encoded: Option<&[u8]>,
+) -> Result<()> {
+    let mut words = program.split_whitespace();
+    let Some(command) = words.next() else { bail!("`sudo_write_program` is empty") };
+    let mut cmd = tokio::process::Command::new(command);
+    cmd.args(words)
+        .arg(path)
+        .stdin(Stdio::piped())
+        // `tee` echoes its input, which would otherwise be drawn over the editor.
+        .stdout(Stdio::null())
+        .stderr(Stdio::piped())
+        .kill_on_drop(true);
+
+    let mut child = cmd.spawn().with_context(|| format!("failed to run `{program}`"))?;
+    let mut stdin = child.stdin.take().expect("stdin is piped");
+    // Stdin is dropped after writing so the program sees the end of its input.
+    let write = async move {
+        match encoded {
+            Some(bytes) => stdin.write_all(bytes).await?,
+            None => {
+                let mut reader = futures_util::io::AllowStdIo::new(text.reader()).compat();
+                tokio::io::copy(&mut reader, &mut stdin).await?;
+            }
+        }
+        stdin.flush().await
+    };
+
+    let (written, output) = tokio::join!(write, child.wait_with_output());
+    let output = output?;
+    if !output.status.success() {
+        let stderr = String::from_utf8_lossy(&output.stderr);
+        bail!("`{program}` exited with {}: {}", output.status, stderr.trim());
+    }
+
+    written.with_context(|| format!("failed to write to `{program}`"))
+}
@@ -0,0 +1,204 @@
+use std::ops::Range;
+
+use anyhow::{anyhow, bail};
+use zi_input::{KeyCode, KeyEvent};
+use zi_text::{AnyText, Delta, Deltas, Text as _, TextSlice as _};
+use zi_textobject::{Tag, TextObject as _, delimiter, enclosing_pair};
+
+use super::Result;
+use crate::buffer::SnapshotFlags;
+use crate::{Active, Editor};
+
+/// Waiting for the delimiters named by the next keys, like tpope's vim-surround.
+#[derive(Debug, Clone)]
+pub(super) enum SurroundPending {
+    /// Surround the byte range with the next delimiter, `ys{motion}`.
+    Add(Range<usize>),
+    /// Delete the delimiters around the cursor named by the next key, `ds`.
+    Delete,
+    /// Change the delimiters around the cursor named by the next key, `cs`.
+    Change,
+    /// Replace the target delimiters around the cursor with the next delimiter, `cs{target}`.
+    Replace(char),
+    /// A tag name is being typed, it's finished by `>` or enter.
+    Tag { name: String, then: Box<SurroundPending> },
+}
+
+/// The text to insert before and after.
+#[derive(Debug, PartialEq, Eq)]
+struct Pair {
+    open: String,
+    close: String,
+}
+
+impl Pair {
+    fn new(open: impl Into<String>, close: impl Into<String>) -> Self {
+        Self { open: open.into(), close: close.into() }
+    }
+
+    /// The pair named by the key, `None` if it's a tag which has to be typed.
+    /// Like vim-surround, the opening bracket pads with spaces and the closing bracket doesn't.
+    fn from_key(c: char) -> Result<Option<Pair>> {
+        let pair = match c {
+            ')' | 'b' => Pair::new("(", ")"),
+            '(' => Pair::new("( ", " )"),
+            '}' | 'B' => Pair::new("{", "}"),
+            '{' => Pair::new("{ ", " }"),
+            ']' | 'r' => Pair::new("[", "]"),
+            '[' => Pair::new("[ ", " ]"),
+            '>' | 'a' => Pair::new("<", ">"),
+            '<' | 't' => return Ok(None),
+            c if c.is_ascii_punctuation() => Pair::new(c, c),
+            _ => bail!("not a surrounding delimiter: `{c}`"),
+        };
+        Ok(Some(pair))
+    }
+
+    /// The element typed as `<{tag}>`, the closing tag is only the name without any attributes.
+    fn tag(tag: &str) -> Pair {
+        let name = tag.split_whitespace().next().unwrap_or_default();
+        Pair::new(format!("<{tag}>"), format!("</{name}>"))
+    }
+}
+
+/// The byte ranges of the delimiters named by the key around the byte.
+/// An opening bracket includes any whitespace between the delimiters and the contents.
+fn find_delimiters(
+    text: &dyn AnyText,
+    byte: usize,
+    c: char,
+) -> Option<(Range<usize>, Range<usize>)> {
+    let pair = match c {
+        '(' | ')' | 'b' => enclosing_pair::<delimiter::Paren>(text, byte),
+        '{' | '}' | 'B' => enclosing_pair::<delimiter::Brace>(text, byte),
+        '[' | ']' | 'r' => enclosing_pair::<delimiter::Bracket>(text, byte),
+        '<' | '>' | 'a' => enclosing_pair::<delimiter::AngleBracket>(text, byte),
+        '"' => enclosing_pair::<delimiter::Quote>(text, byte),
+        '\'' => enclosing_pair::<delimiter::Apostrophe>(text, byte),
+        '`' => enclosing_pair::<delimiter::Backtick>(text, byte),
+        't' => {
+            let outer = Tag::around().byte_range(text, byte)?;
+            let inner = Tag::inner().byte_range(text, byte)?;
+            return Some((outer.start..inner.start, inner.end..outer.end));
+        }
+        _ => None,
+    }?;
+
+    // All the delimiters are a single byte.
+    let (mut open, mut close) = (pair.start..pair.start + 1, pair.end - 1..pair.end);
+    if matches!(c, '(' | '{' | '[' | '<') {
+        let is_blank = |c: &char| c.is_whitespace() && *c != '\n';
+        let inner = text.byte_slice(open.end..close.start);
+        let leading = inner.chars().take_while(is_blank).map(char::len_utf8).sum::<usize>();
+        let trailing = inner.chars().rev().take_while(is_blank).map(char::len_utf8).sum::<usize>();
+        open.end += leading;
+        close.start = (close.start - trailing).max(open.end);
+    }
+    Some((open, close))
+}
+
+impl Editor {
+    /// Wait for the delimiter to surround the byte range with, `ys`.
+    pub(super) fn select_surround_to_add(&mut self, range: Range<usize>) {
+        self.surround_pending = Some(SurroundPending::Add(range));
+    }
+
+    /// Wait for the delimiters around the cursor to delete, `ds`.
+    pub fn select_surround_to_delete(&mut self) {
+        self.surround_pending = Some(SurroundPending::Delete);
+    }
+
+    /// Wait for the delimiters around the cursor to change and what to change them to, `cs`.
+    pub fn select_surround_to_change(&mut self) {
+        self.surround_pending = Some(SurroundPending::Change);
+    }
+
+    /// Handle the next key after `ys{motion}`, `ds` or `cs`.
+    pub(super) fn surround_key(&mut self, pending: SurroundPending, key: &KeyEvent) -> Result<()> {
+        if let SurroundPending::Tag { mut name, then } = pending {
+            match key.code() {
+                KeyCode::Char('>') | KeyCode::Enter => {
+                    return self.surround_with(*then, Pair::tag(&name));
+                }
+                KeyCode::Char(c) => name.push(c),
+                KeyCode::Backspace => {
+                    name.pop();
+                }
+                _ => return Ok(()),
+            }
+            self.status_message = Some(format!("<{name}"));
+            self.surround_pending = Some(SurroundPending::Tag { name, then });
+            return Ok(());
+        }
+
+        let KeyCode::Char(c) = key.code() else { return Ok(()) };
+        match pending {
+            SurroundPending::Delete => self.surround_replace(c, Pair::new("", "")),
+            SurroundPending::Change => {
+                self.surround_pending = Some(SurroundPending::Replace(c));
+                Ok(())
+            }
+            SurroundPending::Add(_) | SurroundPending::Replace(_) => match Pair::from_key(c)? {
+                Some(pair) => self.surround_with(pending, pair),
+                None => {
+                    self.status_message = Some("<".to_string());
+                    let name = String::new();
+                    self.surround_pending =
+                        Some(SurroundPending::Tag { name, then: Box::new(pending) });
+                    Ok(())
+                }
+            },
+            SurroundPending::Tag { .. } => unreachable!("handled above"),
+        }
+    }
+
+    fn surround_with(&mut self, pending: SurroundPending, pair: Pair) -> Result<()> {
+        match pending {
+            SurroundPending::Add(range) => self.surround_add(range, pair),
+            SurroundPending::Replace(target) => self.surround_replace(target, pair),
+            SurroundPending::Delete | SurroundPending::Change | SurroundPending::Tag { .. } => {
+                unreachable!("not waiting for a delimiter to insert")
+            }
+        }
+    }
+
+    /// Surround the range with the pair, excluding any whitespace at either end of the range.
+    fn surround_add(&mut self, range: Range<usize>, pair: Pair) -> Result<()> {
+        let (view, buf) = self.get(Active);
+        let text = self[buf].text();
+        let slice = text.byte_slice(range.clone());
+        let leading = slice.chars().take_while(|c| c.is_whitespace()).map(char::len_utf8);
+        let trailing = slice.chars().rev().take_while(|c| c.is_whitespace()).map(char::len_utf8);
+        let start = range.start + leading.sum::<usize>();
+        let end = (range.end - trailing.sum::<usize>()).max(start);
+
+        let deltas = if start == end {
+            Deltas::insert_at(start, pair.open + &pair.close)
+        } else {
+            Deltas::new([Delta::insert_at(start, pair.open), Delta::insert_at(end, pair.close)])
+        };
+        self.edit(buf, &deltas)?;
+        self[buf].snapshot(SnapshotFlags::empty());
+
+        let point = self[buf].text().byte_to_point(start);
+        self.set_cursor(view, point);
+        Ok(())
+    }
+
+    /// Replace the delimiters named by `target` around the cursor with the pair.
+    fn surround_replace(&mut self, target: char, pair: Pair) -> Result<()> {
+        let (view, buf) = self.get(Active);
+        let text = self[buf].text();
+        let byte = text.point_to_byte(self[view].cursor());
+        let (open, close) = find_delimiters(text, byte, target)
+            .ok_or_else(|| anyhow!("no surrounding `{target}` found"))?;
+
+        let start = open.start;
+        self.edit(buf, &Deltas::new([Delta::new(open, pair.open), Delta::new(close, pair.close)]))?;
+        self[buf].snapshot(SnapshotFlags::empty());
+
+        let point = self[buf].text().byte_to_point(start);
+        self.set_cursor(view, point);
+        Ok(())
+    }
+}
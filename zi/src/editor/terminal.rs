@@ -0,0 +1,55 @@
+use zi_input::{KeyCode, KeyEvent, KeyModifiers};
+
+use super::{Result, Selector, set_error_if};
+use crate::buffer::{Buffer, TerminalBuffer};
+use crate::private::Internal;
+use crate::{Active, Direction, Editor, Mode, View, ViewId};
+
+impl Editor {
+    /// Run the command, or the user's shell, in a terminal in a new split and start typing into it.
+    /// Normal mode navigates the scrollback, `<C-\>` leaves insert mode as everything else goes to the process.
+    pub fn open_terminal(&mut self, command: Option<&str>) -> Result<ViewId> {
+        let active = self.tree.active();
+        let area = self.tree.view_area(active);
+        let client = self.client();
+        // The terminal is resized to fit the split when it's rendered.
+        let size = crate::Size::new(area.width, area.height / 2);
+        let buf = self.buffers.try_insert_with_key(|id| {
+            TerminalBuffer::new(id, client, command, size).map(Buffer::new)
+        })?;
+
+        let view = self.views.insert_with_key(|id| View::new(id, buf));
+        self[view].settings().line_number_style.write(tui::LineNumberStyle::None);
+        self.tree.split(active, view, Direction::Up, tui::Constraint::Percentage(50));
+        self.set_mode(Mode::Insert);
+        Ok(view)
+    }
+
+    /// Send the key to the process if the active buffer is a terminal, returns whether it was handled.
+    pub(super) fn terminal_key(&mut self, key: &KeyEvent) -> bool {
+        let buf = self.view(Active).buffer();
+        if !self[buf].as_any().is::<TerminalBuffer>() {
+            return false;
+        }
+
+        if key.code() == KeyCode::Char('\\') && key.modifiers() == KeyModifiers::CONTROL {
+            self.set_mode(Mode::Normal);
+            return true;
+        }
+
+        let terminal = self[buf].as_any_mut(Internal(())).downcast_mut::<TerminalBuffer>().unwrap();
+        let res = terminal.send_key(key);
+        set_error_if!(self: res);
+        true
+    }
+
+    /// Move the cursor to where the process put it if the view is showing a terminal.
+    pub(super) fn follow_terminal_cursor(&mut self, selector: impl Selector<ViewId>) {
+        let view = selector.select(self);
+        let buf = self[view].buffer();
+        if let Some(terminal) = self[buf].as_any().downcast_ref::<TerminalBuffer>() {
+            let cursor = terminal.cursor();
+            self.set_cursor(view, cursor);
+        }
+    }
+}
@@ -0,0 +1,67 @@
+use std::path::{Path, PathBuf};
+
+use anyhow::anyhow;
+
+use super::{Result, request_redraw};
+use crate::Editor;
+use crate::syntax::Theme;
+
+impl Editor {
+    /// Switch to the theme `name`, which is `default` for the builtin theme, a path to a theme file, or the name of a
+    /// theme in the themes directory (`<config>/themes/<name>.toml`).
+    /// The current theme is kept if the theme fails to load.
+    pub fn set_theme(&mut self, name: &str) -> Result<()> {
+        if name == "default" {
+            self.theme_path = None;
+            self.settings().theme.write(Theme::default());
+            request_redraw();
+            return Ok(());
+        }
+
+        let path = if name.contains('/') || name.ends_with(".toml") {
+            PathBuf::from(name)
+        } else {
+            crate::dirs::theme().join(name).with_extension("toml")
+        };
+
+        self.load_theme(&path)?;
+        self.theme_path = Some(path);
+        Ok(())
+    }
+
+    /// Reload the current theme from its file, changes to the file show without a restart.
+    pub fn reload_theme(&mut self) -> Result<()> {
+        match self.theme_path.clone() {
+            Some(path) => self.load_theme(&path),
+            None => Ok(()),
+        }
+    }
+
+    fn load_theme(&mut self, path: &Path) -> Result<()> {
+        let src = std::fs::read_to_string(path)
+            .map_err(|err| anyhow!("failed to read theme {}: {err}", path.display()))?;
+        let theme = src
+            .parse::<Theme>()
+            .map_err(|err| anyhow!("invalid theme {}: {err}", path.display()))?;
+        self.settings().theme.write(theme);
+        // Highlights refer to scopes rather than styles, so a repaint is enough to pick up the new theme.
+        request_redraw();
+        Ok(())
+    }
+}
+
+/// The names of the themes in the themes directory, without the `.toml` extension.
+pub(super) fn theme_names() -> Vec<String> {
+    let Ok(entries) = std::fs::read_dir(crate::dirs::theme()) else { return vec![] };
+    let mut names = entries
+        .filter_map(|entry| {
+            let path = entry.ok()?.path();
+            if path.extension()? != "toml" {
+                return None;
+            }
+            Some(path.file_stem()?.to_str()?.to_string())
+        })
+        .collect::<Vec<_>>();
+    names.sort();
+    names
+}
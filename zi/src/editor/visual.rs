@@ -1,15 +1,36 @@
 use std::ops::Range;
 
+use unicode_segmentation::UnicodeSegmentation;
+use unicode_width::UnicodeWidthStr;
 use zi_core::{Point, PointRange};
-use zi_text::{PointRangeExt, Text, TextBase, TextSlice};
+use zi_text::{Delta, Deltas, PointRangeExt, Text, TextBase, TextSlice};
 
 use super::register::RegisterKind;
+use super::state::State;
+use super::{EditError, Selector, cursor, get};
+use crate::buffer::SnapshotFlags;
+use crate::view::SetCursorFlags;
+use crate::{BufferId, Editor, Mode, Operator, ViewId};
 
 #[derive(Debug, Clone)]
 pub enum Selection {
-    Charwise { start: Point, end: Point },
-    Line { start_line: usize, end_line: usize },
-    Block { start_line: usize, end_line: usize, start_col: usize, end_col: usize },
+    Charwise {
+        start: Point,
+        end: Point,
+    },
+    Line {
+        start_line: usize,
+        end_line: usize,
+    },
+    /// The columns are inclusive and in cells rather than bytes, so the block is a rectangle on screen even if the
+    /// lines contain tabs or wide characters. A grapheme is in the block if any of its cells are.
+    Block {
+        start_line: usize,
+        end_line: usize,
+        start_col: usize,
+        end_col: usize,
+        tab_width: usize,
+    },
 }
 
 impl Selection {
@@ -17,8 +38,8 @@ impl Selection {
         match self {
             Self::Charwise { start, end } => {
                 let start_byte = text.point_to_byte(*start);
-                let end_byte =
-                    text.point_to_byte(*end) + text.char_at_point(*end).map_or(0, |c| c.len_utf8());
+                // The end is inclusive, so include all of the grapheme cluster under it.
+                let end_byte = text.next_grapheme_boundary(text.point_to_byte(*end));
                 text.byte_slice(start_byte..end_byte).to_cow().into_owned()
             }
             Self::Line { start_line, end_line } => {
@@ -27,31 +48,22 @@ impl Selection {
                     text.try_line_to_byte(*end_line + 1).unwrap_or_else(|| text.len_bytes());
                 text.byte_slice(start_byte..end_byte).to_cow().into_owned()
             }
-            Self::Block { start_line, end_line, start_col, end_col } => {
-                let mut content = String::new();
-                for line_idx in *start_line..=*end_line {
-                    if let Some(line) = text.line(line_idx) {
-                        if !content.is_empty() {
-                            content.push('\n');
-                        }
-                        let extracted: String = line
-                            .chars()
-                            .filter(|c| *c != '\n')
-                            .skip(*start_col)
-                            .take(*end_col - *start_col + 1)
-                            .collect();
-                        content.push_str(&extracted);
-                    }
-                }
-                content
-            }
+            Self::Block { .. } => self
+                .block_ranges(text)
+                .map(|(_, range)| match range {
+                    Some(range) => text.byte_slice(range).to_cow().into_owned(),
+                    None => String::new(),
+                })
+                .collect::<Vec<_>>()
+                .join("\n"),
         }
     }
 
     pub fn register_kind(&self) -> RegisterKind {
         match self {
-            Self::Charwise { .. } | Self::Block { .. } => RegisterKind::Charwise,
+            Self::Charwise { .. } => RegisterKind::Charwise,
             Self::Line { .. } => RegisterKind::Linewise,
+            Self::Block { .. } => RegisterKind::Blockwise,
         }
     }
 
@@ -59,8 +71,7 @@ impl Selection {
         match self {
             Self::Charwise { start, end } => {
                 let start_byte = text.point_to_byte(*start);
-                let end_byte =
-                    text.point_to_byte(*end) + text.char_at_point(*end).map_or(0, |c| c.len_utf8());
+                let end_byte = text.next_grapheme_boundary(text.point_to_byte(*end));
                 vec![start_byte..end_byte]
             }
             Self::Line { start_line, end_line } => {
@@ -69,36 +80,38 @@ impl Selection {
                     text.try_line_to_byte(*end_line + 1).unwrap_or_else(|| text.len_bytes());
                 vec![start_byte..end_byte]
             }
-            Self::Block { start_line, end_line, start_col, end_col } => {
-                let mut ranges = Vec::new();
-                for line_idx in (*start_line..=*end_line).rev() {
-                    if let Some(line) = text.line(line_idx) {
-                        let line_len = line.len_bytes().saturating_sub(1);
-                        if *start_col > line_len {
-                            continue;
-                        }
-                        let line_start = text.line_to_byte(line_idx);
-                        let col_end = (*end_col + 1).min(line_len);
-                        ranges.push((line_start + *start_col)..(line_start + col_end));
-                    }
-                }
+            // In reverse so deleting them in order doesn't shift the ranges that are left.
+            Self::Block { .. } => {
+                let mut ranges =
+                    self.block_ranges(text).filter_map(|(_, range)| range).collect::<Vec<_>>();
+                ranges.reverse();
                 ranges
             }
         }
     }
 
-    pub fn start_point(&self) -> Point {
+    pub fn start_point(&self, text: &(impl Text + ?Sized)) -> Point {
         match self {
             Self::Charwise { start, .. } => *start,
             Self::Line { start_line, .. } => Point::new(*start_line, 0),
-            Self::Block { start_line, start_col, .. } => Point::new(*start_line, *start_col),
+            // The first line may not reach the block, in which case this is the end of the line.
+            Self::Block { start_line, start_col, tab_width, .. } => {
+                let line = text.line(*start_line).map(|line| line.to_string()).unwrap_or_default();
+                let col = line_range(&line, *start_col..*start_col + 1, *tab_width)
+                    .map_or(line.len(), |range| range.start);
+                Point::new(*start_line, col)
+            }
         }
     }
 
     pub fn point_ranges(&self, text: &(impl Text + ?Sized)) -> Vec<PointRange> {
         match self {
             Self::Charwise { start, end } => {
-                let end_col = end.col() + text.char_at_point(*end).map_or(1, |c| c.len_utf8());
+                let end_byte = text.point_to_byte(*end);
+                let end_col = match text.char_at_byte(end_byte) {
+                    Some(_) => end.col() + text.next_grapheme_boundary(end_byte) - end_byte,
+                    None => end.col() + 1,
+                };
                 let range = PointRange::new(*start, Point::new(end.line(), end_col));
                 range.explode(text).collect()
             }
@@ -108,23 +121,418 @@ impl Selection {
                     PointRange::new(Point::new(line, 0), Point::new(line, line_len))
                 })
                 .collect(),
-            Self::Block { start_line, end_line, start_col, end_col } => {
-                let max_col = *end_col + 1;
-                (*start_line..=*end_line)
-                    .filter_map(|line| {
-                        let line_len =
-                            text.line(line).map(|l| l.len_bytes().saturating_sub(1)).unwrap_or(0);
-                        if *start_col > line_len {
-                            return None;
-                        }
-                        let clamped_end = max_col.min(line_len + 1);
-                        Some(PointRange::new(
-                            Point::new(line, *start_col),
-                            Point::new(line, clamped_end),
-                        ))
-                    })
-                    .collect()
+            Self::Block { .. } => self
+                .block_ranges(text)
+                .filter_map(|(line, range)| {
+                    let range = range?;
+                    let line_start = text.line_to_byte(line);
+                    Some(PointRange::new(
+                        Point::new(line, range.start - line_start),
+                        Point::new(line, range.end - line_start),
+                    ))
+                })
+                .collect(),
+        }
+    }
+
+    /// The byte range of the block on each of its lines, `None` if the line doesn't reach the block.
+    fn block_ranges<'a, T: Text + ?Sized>(
+        &self,
+        text: &'a T,
+    ) -> impl Iterator<Item = (usize, Option<Range<usize>>)> + 'a {
+        let &Self::Block { start_line, end_line, start_col, end_col, tab_width } = self else {
+            panic!("not a block selection")
+        };
+
+        (start_line..=end_line).filter(|&line| line < text.len_lines()).map(move |line| {
+            let line_start = text.line_to_byte(line);
+            let content = text.line(line).map(|line| line.to_string()).unwrap_or_default();
+            let range = line_range(&content, start_col..end_col + 1, tab_width)
+                .map(|range| line_start + range.start..line_start + range.end);
+            (line, range)
+        })
+    }
+}
+
+/// The selections of every cursor in visual or visual line mode, each given as its anchor and cursor.
+/// Selections that overlap are merged into one, which is the primary selection if any of them were.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct MultiSelection {
+    linewise: bool,
+    primary: (Point, Point),
+    /// The other selections in order.
+    secondary: Vec<(Point, Point)>,
+}
+
+impl MultiSelection {
+    pub fn new(
+        linewise: bool,
+        primary: (Point, Point),
+        secondary: impl IntoIterator<Item = (Point, Point)>,
+    ) -> Self {
+        struct Part {
+            start: Point,
+            end: Point,
+            /// The cursor is before the anchor.
+            backwards: bool,
+            primary: bool,
+        }
+
+        let mut parts = std::iter::once((primary, true))
+            .chain(secondary.into_iter().map(|selection| (selection, false)))
+            .map(|((anchor, cursor), primary)| Part {
+                start: anchor.min(cursor),
+                end: anchor.max(cursor),
+                backwards: cursor < anchor,
+                primary,
+            })
+            .collect::<Vec<_>>();
+        parts.sort_by_key(|part| part.start);
+
+        // Visual line selections overlap if they share a line.
+        let overlaps = |a: &Part, b: &Part| match linewise {
+            true => b.start.line() <= a.end.line(),
+            false => b.start <= a.end,
+        };
+
+        let mut merged = Vec::<Part>::with_capacity(parts.len());
+        for part in parts {
+            match merged.last_mut() {
+                Some(last) if overlaps(last, &part) => {
+                    last.end = last.end.max(part.end);
+                    // The primary selection keeps its direction.
+                    if part.primary {
+                        last.backwards = part.backwards;
+                        last.primary = true;
+                    }
+                }
+                _ => merged.push(part),
+            }
+        }
+
+        let ends = |part: &Part| match part.backwards {
+            true => (part.end, part.start),
+            false => (part.start, part.end),
+        };
+        let primary =
+            merged.iter().find(|part| part.primary).map(ends).expect("primary was merged");
+        let secondary = merged.iter().filter(|part| !part.primary).map(ends).collect();
+        Self { linewise, primary, secondary }
+    }
+
+    /// The anchor and cursor of the primary selection.
+    pub fn primary(&self) -> (Point, Point) {
+        self.primary
+    }
+
+    /// The anchor and cursor of each of the other selections in order.
+    pub fn secondary(&self) -> &[(Point, Point)] {
+        &self.secondary
+    }
+
+    pub fn len(&self) -> usize {
+        1 + self.secondary.len()
+    }
+
+    /// The selections, starting with the primary selection followed by the others in order.
+    pub fn selections(&self) -> impl Iterator<Item = Selection> + '_ {
+        std::iter::once(self.primary).chain(self.secondary.iter().copied()).map(
+            |(anchor, cursor)| {
+                let (start, end) = (anchor.min(cursor), anchor.max(cursor));
+                match self.linewise {
+                    true => Selection::Line { start_line: start.line(), end_line: end.line() },
+                    false => Selection::Charwise { start, end },
+                }
+            },
+        )
+    }
+
+    /// The text of all the selections in the order they are in the buffer.
+    /// Charwise selections are put on separate lines, the lines of linewise selections are already.
+    pub fn content(&self, text: &(impl Text + ?Sized)) -> String {
+        let mut selections = self.selections().collect::<Vec<_>>();
+        selections.sort_by_key(|selection| selection.start_point(text));
+        let contents = selections.iter().map(|selection| selection.content(text));
+        match self.linewise {
+            true => contents.collect(),
+            false => contents.collect::<Vec<_>>().join("\n"),
+        }
+    }
+}
+
+/// Text typed on the first line of a block insert is repeated on the other lines of the block when leaving insert
+/// mode.
+#[derive(Debug)]
+pub(super) struct BlockInsert {
+    /// Where typing started on the first line.
+    start: Point,
+    /// The other lines the text is inserted on.
+    lines: Vec<usize>,
+    /// The column (in cells) the text is inserted at, lines that are shorter are padded with spaces.
+    col: usize,
+    tab_width: usize,
+}
+
+impl Editor {
+    /// Delete (or change) the selections of all the cursors at once, leaving each cursor at the start of its
+    /// selection. Undo restores the cursors to the same places.
+    pub(super) fn delete_selections(
+        &mut self,
+        view: ViewId,
+        operator: Operator,
+        selections: &MultiSelection,
+    ) -> Result<(), EditError> {
+        let buf = self[view].buffer();
+        let text = self[buf].text();
+        let starts = selections.selections().map(|sel| sel.start_point(text)).collect::<Box<[_]>>();
+        let primary = text.point_to_byte(starts[0]);
+
+        // A linewise change leaves an empty line in place of each selection to type on.
+        let replacement = match operator == Operator::Change && selections.linewise {
+            true => "\n",
+            false => "",
+        };
+        let mut ranges =
+            selections.selections().flat_map(|sel| sel.byte_ranges(text)).collect::<Vec<_>>();
+        ranges.sort_by_key(|range| range.start);
+        let deltas = Deltas::new(ranges.into_iter().map(|range| Delta::new(range, replacement)));
+
+        if operator == Operator::Change {
+            self[buf].snapshot(SnapshotFlags::empty());
+        }
+        self[buf].snapshot_cursors(starts.clone());
+
+        // The edit shifts the secondary cursors along with the text, so put them at the start of their selections.
+        let target_mode = if operator == Operator::Change { Mode::Insert } else { Mode::Normal };
+        let area = self.tree.view_area(view);
+        let (v, b) = get!(self: view);
+        v.set_secondary_cursors(
+            target_mode,
+            area,
+            b,
+            starts[1..].iter().copied(),
+            SetCursorFlags::empty(),
+        );
+        self.edit(view, &deltas)?;
+
+        let (v, b) = get!(self: view);
+        let byte = cursor::shift_byte(&deltas, primary);
+        v.set_cursor_bytewise(target_mode, area, b, byte, SetCursorFlags::empty());
+        if operator == Operator::Delete {
+            b.snapshot(SnapshotFlags::empty());
+        }
+        self.set_mode(target_mode);
+        Ok(())
+    }
+
+    /// Insert (`I`) or append (`A`) text on every line of the block selection. The text is typed on the first line and
+    /// repeated on the others when leaving insert mode.
+    /// Inserting skips lines that don't reach the block, appending pads them with spaces instead.
+    pub fn visual_block_insert(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        append: bool,
+    ) -> Result<(), EditError> {
+        let view = selector.select(self);
+        let Some(Selection::Block { start_line, end_line, start_col, end_col, tab_width }) =
+            self.visual_selection(view)
+        else {
+            return Ok(());
+        };
+
+        let buf = self[view].buffer();
+        let col = if append { end_col + 1 } else { start_col };
+        let text = self[buf].text();
+        let lines = (start_line..=end_line)
+            .filter(|&line| line < text.len_lines())
+            .filter(|&line| append || line_width(text, line, tab_width) > col)
+            .collect::<Vec<_>>();
+
+        self[buf].snapshot(SnapshotFlags::empty());
+        self.start_block_insert(view, lines, col, tab_width)
+    }
+
+    /// Enter insert mode at the column (in cells) of the first of the lines, the text typed is repeated on the rest
+    /// of the lines when leaving insert mode.
+    pub(super) fn start_block_insert(
+        &mut self,
+        view: ViewId,
+        mut lines: Vec<usize>,
+        col: usize,
+        tab_width: usize,
+    ) -> Result<(), EditError> {
+        if lines.is_empty() {
+            self.set_mode(Mode::Normal);
+            return Ok(());
+        }
+
+        let buf = self[view].buffer();
+        let first = lines.remove(0);
+        let byte = self.block_column(buf, first, col, tab_width)?;
+        let start = Point::new(first, byte - self[buf].text().line_to_byte(first));
+        let block = BlockInsert { start, lines, col, tab_width };
+
+        self.set_mode(Mode::Insert);
+        let area = self.tree.view_area(view);
+        let buf = &self.buffers[buf];
+        self.views[view].set_cursor_bytewise(
+            Mode::Insert,
+            area,
+            buf,
+            byte,
+            SetCursorFlags::empty(),
+        );
+        if let State::Insert(state) = &mut self.state {
+            state.block = Some(block);
+        }
+        Ok(())
+    }
+
+    /// Repeat the text typed since starting a block insert on the rest of the block's lines.
+    /// Nothing is repeated if the cursor left the line or went before where typing started.
+    pub(super) fn finish_block_insert(&mut self, view: ViewId) -> Result<(), EditError> {
+        let State::Insert(state) = &mut self.state else { return Ok(()) };
+        let Some(block) = state.block.take() else { return Ok(()) };
+
+        let buf = self[view].buffer();
+        let cursor = self[view].cursor();
+        if cursor.line() != block.start.line() || cursor.col() <= block.start.col() {
+            return Ok(());
+        }
+
+        let text = self[buf].text();
+        let line_start = text.line_to_byte(cursor.line());
+        let inserted =
+            text.byte_slice(line_start + block.start.col()..line_start + cursor.col()).to_string();
+        for &line in &block.lines {
+            let byte = self.block_column(buf, line, block.col, block.tab_width)?;
+            self.edit(buf, &Deltas::insert_at(byte, inserted.clone()))?;
+        }
+        Ok(())
+    }
+
+    /// Paste a block yanked in visual block mode as a rectangle after the cursor, adding lines past the end of the
+    /// buffer if necessary.
+    pub(super) fn paste_block(
+        &mut self,
+        selector: impl Selector<ViewId>,
+        content: &str,
+    ) -> Result<(), EditError> {
+        let (view, buf) = self.get(selector);
+        let cursor = self[view].cursor();
+        let tab_width = *self[buf].settings().tab_width.read() as usize;
+        let text = self[buf].text();
+        let line = text.line(cursor.line()).map(|line| line.to_string()).unwrap_or_default();
+        let col = cells(&line, cursor.col(), tab_width).end;
+
+        let pieces = content.split('\n').collect::<Vec<_>>();
+        let width = pieces.iter().map(|piece| str_width(piece, tab_width)).max().unwrap_or(0);
+
+        let missing = (cursor.line() + pieces.len()).saturating_sub(text.len_lines());
+        if missing > 0 {
+            // Without a trailing newline the first newline only ends the last line.
+            let newlines = missing + usize::from(text.chars().next_back() != Some('\n'));
+            let len = text.len_bytes();
+            self.edit(buf, &Deltas::insert_at(len, "\n".repeat(newlines)))?;
+        }
+
+        let mut start = None;
+        for (i, piece) in pieces.into_iter().enumerate() {
+            let line = cursor.line() + i;
+            let byte = self.block_column(buf, line, col, tab_width)?;
+            let text = self[buf].text();
+            let line_end =
+                text.line_to_byte(line) + text.line(line).map_or(0, |line| line.len_bytes());
+            // Pad the piece if the line continues after it so the rest of the block stays aligned.
+            let mut piece = piece.to_string();
+            if byte < line_end {
+                piece.push_str(&" ".repeat(width - str_width(&piece, tab_width)));
             }
+
+            start.get_or_insert(byte);
+            self.edit(buf, &Deltas::insert_at(byte, piece))?;
         }
+
+        if let Some(byte) = start {
+            let point = self[buf].text().byte_to_point(byte);
+            self.set_cursor(view, point);
+        }
+        Ok(())
+    }
+
+    /// The byte offset of the first grapheme on the line that starts at or after the column (in cells).
+    /// Lines that don't reach the column are padded with spaces.
+    fn block_column(
+        &mut self,
+        buf: BufferId,
+        line: usize,
+        col: usize,
+        tab_width: usize,
+    ) -> Result<usize, EditError> {
+        let text = self[buf].text();
+        let line_start = text.line_to_byte(line);
+        let content = text.line(line).map(|line| line.to_string()).unwrap_or_default();
+
+        let mut cell = 0;
+        for (byte, grapheme) in content.grapheme_indices(true) {
+            if cell >= col {
+                return Ok(line_start + byte);
+            }
+            cell += grapheme_width(grapheme, tab_width);
+        }
+
+        let line_end = line_start + content.len();
+        if cell < col {
+            self.edit(buf, &Deltas::insert_at(line_end, " ".repeat(col - cell)))?;
+        }
+        Ok(line_end + col.saturating_sub(cell))
+    }
+}
+
+/// The cells (half-open) of the grapheme at the byte column of the line, an empty range past the end of the line.
+pub(super) fn cells(line: &str, byte_col: usize, tab_width: usize) -> Range<usize> {
+    let mut cell = 0;
+    for (byte, grapheme) in line.grapheme_indices(true) {
+        let width = grapheme_width(grapheme, tab_width);
+        if byte >= byte_col {
+            return cell..cell + width;
+        }
+        cell += width;
+    }
+    cell..cell
+}
+
+/// The byte range within the line of the graphemes that overlap the cells, `None` if there are none.
+fn line_range(line: &str, cols: Range<usize>, tab_width: usize) -> Option<Range<usize>> {
+    let mut cell = 0;
+    let mut range: Option<Range<usize>> = None;
+    for (byte, grapheme) in line.grapheme_indices(true) {
+        if cell >= cols.end {
+            break;
+        }
+
+        let width = grapheme_width(grapheme, tab_width);
+        if cell + width > cols.start {
+            let end = byte + grapheme.len();
+            range = Some(range.map_or(byte..end, |range| range.start..end));
+        }
+        cell += width;
+    }
+    range
+}
+
+fn line_width(text: &(impl Text + ?Sized), line: usize, tab_width: usize) -> usize {
+    text.line(line).map_or(0, |line| str_width(&line.to_string(), tab_width))
+}
+
+fn str_width(s: &str, tab_width: usize) -> usize {
+    s.graphemes(true).map(|grapheme| grapheme_width(grapheme, tab_width)).sum()
+}
+
+/// This matches `Buffer::grapheme_width`, tabs are always as wide as the tab width.
+fn grapheme_width(grapheme: &str, tab_width: usize) -> usize {
+    match grapheme {
+        "\t" => tab_width,
+        _ => grapheme.width(),
     }
 }
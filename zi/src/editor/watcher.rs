@@ -0,0 +1,263 @@
+use std::collections::{HashMap, HashSet, VecDeque};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::{Duration, SystemTime};
+
+use notify::Watcher as _;
+use tokio::sync::mpsc;
+use zi_core::Offset;
+use zi_input::{KeyCode, KeyEvent};
+use zi_text::{Deltas, Text as _};
+
+use super::{Selector, request_redraw, set_error};
+use crate::buffer::{EditFlags, SnapshotFlags};
+use crate::{
+    BufferFlags, BufferId, Client, Editor, Encoding, Error, FileFormat, OpenFlags, Point, ViewId,
+};
+
+/// Formatters and `git checkout` can write a file in several steps, wait for this long after the first change
+/// before looking at the files so they're only read once the writer is done.
+const WATCH_DEBOUNCE: Duration = Duration::from_millis(50);
+
+/// Watches the files of the open buffers for changes made by other processes.
+#[derive(Default)]
+pub(super) struct FileWatcher {
+    /// Created when the first file is watched.
+    watcher: Option<notify::RecommendedWatcher>,
+    /// The parent directories of the files are watched rather than the files themselves.
+    /// This takes a single watch for all the files in a directory and still sees files that are replaced by a rename.
+    dirs: HashSet<PathBuf>,
+    /// The size and modification time of each file as of when we last read or wrote it, to ignore our own writes.
+    stamps: HashMap<PathBuf, Stamp>,
+    /// Buffers whose file has been deleted, this is shown in the status line.
+    deleted: HashSet<BufferId>,
+    /// Modified buffers whose file changed, waiting to be told whether to reload them.
+    prompts: VecDeque<BufferId>,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+struct Stamp {
+    len: u64,
+    modified: Option<SystemTime>,
+}
+
+impl Stamp {
+    fn of(path: &Path) -> Option<Self> {
+        let metadata = fs::metadata(path).ok()?;
+        Some(Self { len: metadata.len(), modified: metadata.modified().ok() })
+    }
+}
+
+impl Editor {
+    /// Whether the buffer's file has been deleted by another process since it was opened.
+    pub fn is_deleted_on_disk(&self, selector: impl Selector<BufferId>) -> bool {
+        let buf = selector.select(self);
+        self.file_watcher.deleted.contains(&buf)
+    }
+
+    /// Remember the state of the buffer's file and watch it for changes, this is done whenever it's opened or saved.
+    pub(super) fn watch_file(&mut self, buf: BufferId) {
+        let Some(path) = self[buf].file_path() else { return };
+        let client = self.client();
+        let watcher = &mut self.file_watcher;
+        watcher.deleted.remove(&buf);
+        match Stamp::of(&path) {
+            Some(stamp) => watcher.stamps.insert(path.clone(), stamp),
+            None => watcher.stamps.remove(&path),
+        };
+
+        let Some(dir) = path.parent() else { return };
+        if watcher.dirs.contains(dir) {
+            return;
+        }
+
+        if watcher.watcher.is_none() {
+            match spawn_watcher(client) {
+                Ok(w) => watcher.watcher = Some(w),
+                Err(err) => {
+                    tracing::warn!(?err, "failed to create file watcher");
+                    return;
+                }
+            }
+        }
+
+        // The directory of a new file might not exist yet, it's watched once the file is saved.
+        match watcher.watcher.as_mut().unwrap().watch(dir, notify::RecursiveMode::NonRecursive) {
+            Ok(()) => {
+                watcher.dirs.insert(dir.to_path_buf());
+            }
+            Err(err) => tracing::debug!(?dir, ?err, "failed to watch directory"),
+        }
+    }
+
+    /// Look at the files that changed on disk.
+    /// Unmodified buffers are reloaded, modified ones ask first so the changes aren't lost.
+    fn check_files(&mut self, paths: HashSet<PathBuf>) {
+        for path in paths {
+            let Some(buf) = self.buffer_at_path(&path) else { continue };
+            let watcher = &mut self.file_watcher;
+            let Some(stamp) = Stamp::of(&path) else {
+                if watcher.stamps.remove(&path).is_some() {
+                    tracing::info!(?path, "file deleted on disk");
+                    watcher.deleted.insert(buf);
+                }
+                continue;
+            };
+
+            watcher.deleted.remove(&buf);
+            // Either our own write or nothing actually changed.
+            if watcher.stamps.insert(path.clone(), stamp) == Some(stamp) {
+                continue;
+            }
+
+            tracing::info!(?path, "file changed on disk");
+            if !self[buf].flags().contains(BufferFlags::DIRTY) {
+                self.reload_buffer(buf);
+            } else if !self.file_watcher.prompts.contains(&buf) {
+                self.file_watcher.prompts.push_back(buf);
+            }
+        }
+
+        self.advance_reload_prompt();
+        request_redraw();
+    }
+
+    /// Reread the buffer from disk, the views showing it keep their cursors and scroll positions where the new text allows.
+    /// The new text is applied as a diff in a single edit, so the reload can be undone to get the old text back.
+    fn reload_buffer(&mut self, buf: BufferId) {
+        let Some(path) = self[buf].file_path() else { return };
+        let views = self.view_positions(buf);
+
+        // Mapped and readonly buffers can't be edited, so they're replaced by opening the file again.
+        if self[buf].flags().intersects(BufferFlags::LARGE | BufferFlags::READONLY) {
+            let mut flags = OpenFlags::FORCE | OpenFlags::BACKGROUND;
+            if self[buf].flags().contains(BufferFlags::READONLY) {
+                flags |= OpenFlags::READONLY;
+            }
+
+            let fut = match self.open(path, flags) {
+                Ok(fut) => fut,
+                Err(err) => {
+                    set_error!(self, err);
+                    return;
+                }
+            };
+
+            self.callback("reload buffer", fut, move |editor, buf| {
+                editor.restore_view_positions(buf, views);
+                request_redraw();
+                Ok(())
+            });
+            return;
+        }
+
+        let fut = async move {
+            let bytes = tokio::fs::read(&path).await?;
+            let encoding = Encoding::detect(&bytes).unwrap_or_default();
+            let text = encoding.decode(&bytes);
+            let (file_format, _) = FileFormat::detect(&text);
+            Ok::<_, Error>((file_format.normalize(&text).into_owned(), encoding, file_format))
+        };
+
+        self.callback("reload buffer", fut, move |editor, (text, encoding, file_format)| {
+            // The buffer now matches the file, whether or not it had changes of its own.
+            let deltas = Deltas::diff(&editor[buf].text().to_string(), &text);
+            if !deltas.is_empty() {
+                editor.edit_flags(buf, &deltas, EditFlags::NO_ENSURE_TRAILING_NEWLINE)?;
+                editor[buf].snapshot(SnapshotFlags::empty());
+            }
+            editor[buf].flushed();
+
+            let settings = editor[buf].settings();
+            settings.encoding.write(encoding);
+            settings.file_format.write(file_format);
+
+            editor.restore_view_positions(buf, views);
+            request_redraw();
+            Ok(())
+        });
+    }
+
+    fn view_positions(&self, buf: BufferId) -> Vec<(ViewId, Point, Offset)> {
+        self.views()
+            .filter(|view| view.buffer() == buf)
+            .map(|view| (view.id(), view.cursor(), view.offset()))
+            .collect()
+    }
+
+    /// Scroll each view back to where it was before setting its cursor, which is clamped to the new text.
+    fn restore_view_positions(&mut self, buf: BufferId, views: Vec<(ViewId, Point, Offset)>) {
+        let last_line = self[buf].text().len_lines().saturating_sub(1);
+        for (view, cursor, offset) in views {
+            if self[view].buffer() == buf {
+                self.view_mut(view).set_offset(Offset::new(offset.line.min(last_line), offset.col));
+                self.set_cursor(view, cursor);
+            }
+        }
+    }
+
+    pub(super) fn is_reload_pending(&self) -> bool {
+        !self.file_watcher.prompts.is_empty()
+    }
+
+    /// Answer the prompt for a modified buffer whose file changed, `y` reloads it and `n` keeps the changes.
+    pub(super) fn confirm_reload(&mut self, key: &KeyEvent) {
+        let Some(&buf) = self.file_watcher.prompts.front() else { return };
+        match key.code() {
+            KeyCode::Char('y') => {
+                self.file_watcher.prompts.pop_front();
+                self.reload_buffer(buf);
+            }
+            KeyCode::Char('n') | KeyCode::Esc => {
+                self.file_watcher.prompts.pop_front();
+            }
+            // Keep asking.
+            _ => (),
+        }
+
+        self.advance_reload_prompt();
+    }
+
+    fn advance_reload_prompt(&mut self) {
+        let Some(&buf) = self.file_watcher.prompts.front() else { return };
+        let path = self[buf].file_path().unwrap_or_default();
+        self.status_message = Some(format!(
+            "`{}` changed on disk, reload and discard your changes (y/n)?",
+            path.display()
+        ));
+    }
+}
+
+/// Create a watcher that sends the paths that change, a burst of changes is checked together.
+fn spawn_watcher(client: Client) -> notify::Result<notify::RecommendedWatcher> {
+    let (tx, mut rx) = mpsc::unbounded_channel();
+    let watcher =
+        notify::recommended_watcher(move |res: notify::Result<notify::Event>| match res {
+            // Reading a file doesn't change it.
+            Ok(event) if event.kind.is_access() => {}
+            Ok(event) => {
+                for path in event.paths {
+                    let _ = tx.send(path);
+                }
+            }
+            Err(err) => tracing::warn!(?err, "file watcher error"),
+        })?;
+
+    // This stops once the sender is dropped along with the watcher.
+    tokio::spawn(async move {
+        while let Some(path) = rx.recv().await {
+            tokio::time::sleep(WATCH_DEBOUNCE).await;
+            let mut paths = HashSet::from([path]);
+            while let Ok(path) = rx.try_recv() {
+                paths.insert(path);
+            }
+
+            client.send(move |editor| {
+                editor.check_files(paths);
+                Ok(())
+            });
+        }
+    });
+
+    Ok(watcher)
+}
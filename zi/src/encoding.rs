@@ -0,0 +1,181 @@
+//! Files are decoded into utf-8 when they're opened and encoded back into their original encoding when saved.
+//! Bytes that aren't valid in the encoding are decoded as the replacement character `�` so they're visible, this
+//! does mean they're not preserved on save.
+
+use std::borrow::Cow;
+use std::fmt;
+use std::str::FromStr;
+
+use anyhow::bail;
+
+const UTF8_BOM: &[u8] = &[0xEF, 0xBB, 0xBF];
+const UTF16LE_BOM: &[u8] = &[0xFF, 0xFE];
+const UTF16BE_BOM: &[u8] = &[0xFE, 0xFF];
+
+/// How much of the file is looked at to guess whether it's utf-16 without a byte order mark.
+const SNIFF_LEN: usize = 4096;
+
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum Encoding {
+    #[default]
+    Utf8,
+    /// Utf-8 with a byte order mark.
+    Utf8Bom,
+    /// Utf-16 is always written with a byte order mark.
+    Utf16Le,
+    Utf16Be,
+    Latin1,
+}
+
+impl Encoding {
+    /// Guess the encoding of the bytes, returns `None` if they look like binary data.
+    /// A byte order mark is trusted if there is one. Otherwise, text that is mostly ascii with a null byte in every
+    /// other position is assumed to be utf-16, and text that isn't valid utf-8 is assumed to be latin-1 unless it's
+    /// mostly valid utf-8 with the odd invalid sequence.
+    pub fn detect(bytes: &[u8]) -> Option<Encoding> {
+        if bytes.starts_with(UTF8_BOM) {
+            return Some(Encoding::Utf8Bom);
+        } else if bytes.starts_with(UTF16LE_BOM) {
+            return Some(Encoding::Utf16Le);
+        } else if bytes.starts_with(UTF16BE_BOM) {
+            return Some(Encoding::Utf16Be);
+        }
+
+        let prefix = &bytes[..bytes.len().min(SNIFF_LEN) & !1];
+        let nulls =
+            |parity: usize| prefix.iter().skip(parity).step_by(2).filter(|&&b| b == 0).count();
+        let (even, odd) = (nulls(0), nulls(1));
+        let pairs = prefix.len() / 2;
+        if pairs > 0 && odd * 2 > pairs && even == 0 {
+            return Some(Encoding::Utf16Le);
+        } else if pairs > 0 && even * 2 > pairs && odd == 0 {
+            return Some(Encoding::Utf16Be);
+        } else if even + odd > 0 {
+            return None;
+        }
+
+        let (valid, invalid) = utf8_sequences(bytes);
+        if invalid == 0 || valid > invalid { Some(Encoding::Utf8) } else { Some(Encoding::Latin1) }
+    }
+
+    /// Decode the bytes, including any byte order mark. Invalid sequences are replaced with `�`.
+    pub fn decode(self, bytes: &[u8]) -> Cow<'_, str> {
+        match self {
+            Encoding::Utf8 => String::from_utf8_lossy(bytes),
+            Encoding::Utf8Bom => {
+                String::from_utf8_lossy(bytes.strip_prefix(UTF8_BOM).unwrap_or(bytes))
+            }
+            Encoding::Utf16Le => {
+                decode_utf16(bytes.strip_prefix(UTF16LE_BOM).unwrap_or(bytes), u16::from_le_bytes)
+            }
+            Encoding::Utf16Be => {
+                decode_utf16(bytes.strip_prefix(UTF16BE_BOM).unwrap_or(bytes), u16::from_be_bytes)
+            }
+            Encoding::Latin1 if bytes.is_ascii() => String::from_utf8_lossy(bytes),
+            Encoding::Latin1 => Cow::Owned(bytes.iter().map(|&b| char::from(b)).collect()),
+        }
+    }
+
+    /// Encode the text, including a byte order mark if the encoding has one.
+    /// Fails if the text contains characters that the encoding can't represent.
+    pub fn encode(self, text: &str) -> crate::Result<Cow<'_, [u8]>> {
+        let bytes = match self {
+            Encoding::Utf8 => Cow::Borrowed(text.as_bytes()),
+            Encoding::Utf8Bom => Cow::Owned([UTF8_BOM, text.as_bytes()].concat()),
+            Encoding::Utf16Le => Cow::Owned(
+                UTF16LE_BOM
+                    .iter()
+                    .copied()
+                    .chain(text.encode_utf16().flat_map(u16::to_le_bytes))
+                    .collect(),
+            ),
+            Encoding::Utf16Be => Cow::Owned(
+                UTF16BE_BOM
+                    .iter()
+                    .copied()
+                    .chain(text.encode_utf16().flat_map(u16::to_be_bytes))
+                    .collect(),
+            ),
+            Encoding::Latin1 => {
+                let mut bytes = Vec::with_capacity(text.len());
+                for (line, s) in text.split('\n').enumerate() {
+                    if line > 0 {
+                        bytes.push(b'\n');
+                    }
+
+                    for c in s.chars() {
+                        match u8::try_from(c) {
+                            Ok(b) => bytes.push(b),
+                            Err(_) => bail!(
+                                "line {} contains `{c}` which can't be encoded as {self}, `:set encoding utf-8` to save as utf-8",
+                                line + 1
+                            ),
+                        }
+                    }
+                }
+                Cow::Owned(bytes)
+            }
+        };
+        Ok(bytes)
+    }
+}
+
+/// The number of valid multi-byte sequences and the number of invalid sequences in possibly utf-8 bytes.
+fn utf8_sequences(mut bytes: &[u8]) -> (usize, usize) {
+    let multibyte = |s: &str| s.chars().filter(|c| !c.is_ascii()).count();
+    let (mut valid, mut invalid) = (0, 0);
+    loop {
+        match std::str::from_utf8(bytes) {
+            Ok(s) => return (valid + multibyte(s), invalid),
+            Err(err) => {
+                let (s, rest) = bytes.split_at(err.valid_up_to());
+                valid += multibyte(std::str::from_utf8(s).unwrap());
+                // A sequence cut off at the end is only incomplete, the bytes may have been truncated.
+                let Some(len) = err.error_len() else { return (valid, invalid) };
+                invalid += 1;
+                bytes = &rest[len..];
+            }
+        }
+    }
+}
+
+fn decode_utf16(bytes: &[u8], from_bytes: fn([u8; 2]) -> u16) -> Cow<'static, str> {
+    let units = bytes.chunks_exact(2).map(|pair| from_bytes([pair[0], pair[1]]));
+    let mut s = char::decode_utf16(units)
+        .map(|c| c.unwrap_or(char::REPLACEMENT_CHARACTER))
+        .collect::<String>();
+    // An odd trailing byte is half a code unit.
+    if bytes.len() % 2 == 1 {
+        s.push(char::REPLACEMENT_CHARACTER);
+    }
+    Cow::Owned(s)
+}
+
+impl fmt::Display for Encoding {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Encoding::Utf8 => write!(f, "utf-8"),
+            Encoding::Utf8Bom => write!(f, "utf-8-bom"),
+            Encoding::Utf16Le => write!(f, "utf-16le"),
+            Encoding::Utf16Be => write!(f, "utf-16be"),
+            Encoding::Latin1 => write!(f, "latin1"),
+        }
+    }
+}
+
+impl FromStr for Encoding {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_ascii_lowercase().as_str() {
+            "utf-8" | "utf8" => Ok(Encoding::Utf8),
+            "utf-8-bom" | "utf8-bom" => Ok(Encoding::Utf8Bom),
+            "utf-16le" | "utf16le" => Ok(Encoding::Utf16Le),
+            "utf-16be" | "utf16be" => Ok(Encoding::Utf16Be),
+            "latin1" | "latin-1" | "iso-8859-1" => Ok(Encoding::Latin1),
+            _ => bail!(
+                "unknown encoding: {s} (expected `utf-8`, `utf-8-bom`, `utf-16le`, `utf-16be`, or `latin1`)"
+            ),
+        }
+    }
+}
@@ -0,0 +1,75 @@
+//! Buffers always separate lines with `\n`, the line endings of the file are converted when it's read and written.
+
+use std::borrow::Cow;
+use std::fmt;
+use std::str::FromStr;
+
+use anyhow::bail;
+
+/// The line ending of a file, named after vim's `fileformat`.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum FileFormat {
+    /// `\n`
+    #[default]
+    Unix,
+    /// `\r\n`
+    Dos,
+    /// `\r`, only if there are no `\n`s at all as a lone `\r` is otherwise more likely part of a line.
+    Mac,
+}
+
+impl FileFormat {
+    /// The most common line ending in the text, and whether there's a mix of line endings.
+    pub fn detect(text: &str) -> (FileFormat, bool) {
+        let lf = text.matches('\n').count();
+        let crlf = text.matches("\r\n").count();
+        match (lf - crlf, crlf) {
+            (0, 0) if text.contains('\r') => (FileFormat::Mac, false),
+            (unix, dos) if dos > unix => (FileFormat::Dos, unix > 0),
+            (_, dos) => (FileFormat::Unix, dos > 0),
+        }
+    }
+
+    /// Convert the line endings in the text read from a file into `\n`, including any that don't match the format.
+    pub fn normalize(self, text: &str) -> Cow<'_, str> {
+        match self {
+            FileFormat::Unix | FileFormat::Dos if text.contains("\r\n") => {
+                Cow::Owned(text.replace("\r\n", "\n"))
+            }
+            FileFormat::Unix | FileFormat::Dos => Cow::Borrowed(text),
+            FileFormat::Mac => Cow::Owned(text.replace('\r', "\n")),
+        }
+    }
+
+    /// Convert the `\n`s in the buffer's text into the format's line ending.
+    pub fn denormalize(self, text: &str) -> Cow<'_, str> {
+        match self {
+            FileFormat::Unix => Cow::Borrowed(text),
+            FileFormat::Dos => Cow::Owned(text.replace('\n', "\r\n")),
+            FileFormat::Mac => Cow::Owned(text.replace('\n', "\r")),
+        }
+    }
+}
+
+impl fmt::Display for FileFormat {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            FileFormat::Unix => write!(f, "unix"),
+            FileFormat::Dos => write!(f, "dos"),
+            FileFormat::Mac => write!(f, "mac"),
+        }
+    }
+}
+
+impl FromStr for FileFormat {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "unix" => Ok(FileFormat::Unix),
+            "dos" => Ok(FileFormat::Dos),
+            "mac" => Ok(FileFormat::Mac),
+            _ => bail!("unknown file format: {s} (expected `unix`, `dos`, or `mac`)"),
+        }
+    }
+}
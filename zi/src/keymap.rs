@@ -1,6 +1,6 @@
 use std::collections::HashMap;
 use std::hash::Hash;
-use std::{fmt, iter};
+use std::{fmt, iter, mem};
 
 use stdx::merge::Merge;
 use zi_input::KeyEvent;
@@ -12,6 +12,10 @@ mod macros;
 
 pub trait DynKeymap<M = Mode, K = KeyEvent, V = Action> {
     fn on_key(&mut self, mode: M, key: K) -> (TrieResult<V>, Vec<K>);
+
+    /// Give up waiting for the rest of a key sequence.
+    /// Returns the binding of the keys pressed so far if there is one, otherwise the discarded keys.
+    fn on_timeout(&mut self, mode: M) -> (Option<V>, Vec<K>);
 }
 
 #[derive(Debug, Clone)]
@@ -37,6 +41,10 @@ where
     fn on_key(&mut self, mode: M, key: K) -> (TrieResult<V>, Vec<K>) {
         self.on_key(mode, key)
     }
+
+    fn on_timeout(&mut self, mode: M) -> (Option<V>, Vec<K>) {
+        self.on_timeout(mode)
+    }
 }
 
 impl<M, K, V> Keymap<M, K, V>
@@ -45,12 +53,31 @@ where
     K: Eq + Hash + Clone,
     V: Clone,
 {
-    // This method should be useful eventually, just cfg it to hide warnings
-    #[cfg(test)]
+    /// Bind the key sequence, returning the previous binding of exactly that sequence.
     pub fn insert(&mut self, mode: M, keys: impl IntoIterator<Item = K>, value: V) -> Option<V> {
         self.maps.entry(mode).or_default().insert(keys.into_iter().peekable(), value)
     }
 
+    /// Unbind the key sequence and every longer sequence starting with it.
+    /// Returns whether anything was bound.
+    pub fn remove(&mut self, mode: M, keys: impl IntoIterator<Item = K>) -> bool {
+        self.maps.get_mut(&mode).is_some_and(|trie| trie.remove(keys.into_iter()))
+    }
+
+    pub fn on_timeout(&mut self, mode: M) -> (Option<V>, Vec<K>) {
+        let keys = mem::take(&mut self.buffer);
+        let value = self
+            .maps
+            .get(&mode)
+            .and_then(|trie| trie.get_trie(keys.iter()))
+            .and_then(|trie| trie.value.as_ref());
+
+        match value {
+            Some(v) => (Some(v.clone()), vec![]),
+            None => (None, keys),
+        }
+    }
+
     /// Returns the result of the key sequence and the keys that were discarded
     pub fn on_key(&mut self, mode: M, key: K) -> (TrieResult<V>, Vec<K>) {
         if let Some(last_mode) = &self.last_mode {
@@ -116,19 +143,21 @@ impl<M, K, V> Default for Keymap<M, K, V> {
 
 #[derive(Debug, Clone)]
 pub struct Trie<K, V> {
+    /// The binding of the key sequence leading to this trie, used if no further key is pressed in time.
+    value: Option<V>,
     children: HashMap<K, TrieNode<K, V>>,
 }
 
 impl<K: Eq + Hash, V> Merge for Trie<K, V> {
     fn merge(self, other: Self) -> Self {
         let children = self.children.merge(other.children);
-        Self { children }
+        Self { value: other.value.or(self.value), children }
     }
 }
 
 impl<K, V> Trie<K, V> {
     pub(crate) fn new(children: HashMap<K, TrieNode<K, V>>) -> Self {
-        Self { children }
+        Self { value: None, children }
     }
 }
 
@@ -159,7 +188,19 @@ where
         }
     }
 
-    #[cfg(test)]
+    /// The trie reached by following the keys, `self` if there are none.
+    fn get_trie<'a>(&self, mut keys: impl Iterator<Item = &'a K>) -> Option<&Self>
+    where
+        K: 'a,
+    {
+        let Some(k) = keys.next() else { return Some(self) };
+        match self.children.get(k)? {
+            TrieNode::Trie(trie) => trie.get_trie(keys),
+            TrieNode::Value(_) => None,
+        }
+    }
+
+    /// Extending a bound sequence or binding a prefix of existing sequences keeps both bindings.
     fn insert<I: Iterator<Item = K>>(
         &mut self,
         mut keys: std::iter::Peekable<I>,
@@ -178,13 +219,22 @@ where
             }
         };
 
+        let is_last = keys.peek().is_none();
         match self.children.entry(k) {
             Entry::Occupied(mut entry) => match entry.get_mut() {
+                TrieNode::Trie(trie) if is_last => trie.value.replace(value),
                 TrieNode::Trie(trie) => trie.insert(keys, value),
-                TrieNode::Value(_) => match entry.insert(mk_new_node(keys, value)) {
-                    TrieNode::Value(v) => Some(v),
-                    _ => unreachable!("we know it's a value"),
-                },
+                TrieNode::Value(v) if is_last => Some(mem::replace(v, value)),
+                TrieNode::Value(_) => {
+                    let TrieNode::Value(prev) = entry.insert(mk_new_node(keys, value)) else {
+                        unreachable!("we know it's a value")
+                    };
+                    let TrieNode::Trie(trie) = entry.get_mut() else {
+                        unreachable!("there were more keys")
+                    };
+                    trie.value = Some(prev);
+                    None
+                }
             },
             Entry::Vacant(entry) => {
                 entry.insert(mk_new_node(keys, value));
@@ -192,11 +242,30 @@ where
             }
         }
     }
+
+    /// Returns whether anything was removed. Tries left without bindings are removed too.
+    fn remove(&mut self, mut keys: impl Iterator<Item = K>) -> bool {
+        let Some(k) = keys.next() else { return false };
+        let mut keys = keys.peekable();
+        if keys.peek().is_none() {
+            return self.children.remove(&k).is_some();
+        }
+
+        let Some(TrieNode::Trie(trie)) = self.children.get_mut(&k) else { return false };
+        let removed = trie.remove(keys);
+        if trie.children.is_empty() {
+            match trie.value.take() {
+                Some(value) => self.children.insert(k, TrieNode::Value(value)),
+                None => self.children.remove(&k),
+            };
+        }
+        removed
+    }
 }
 
 impl<K, V> Default for Trie<K, V> {
     fn default() -> Self {
-        Self { children: Default::default() }
+        Self { value: None, children: Default::default() }
     }
 }
 
@@ -289,6 +358,17 @@ where
         self.state = state;
         (v, buf)
     }
+
+    fn on_timeout(&mut self, mode: M) -> (Option<V>, Vec<K>) {
+        let (lhs, lbuf) = self.a.on_timeout(mode.clone());
+        let (rhs, rbuf) = self.b.on_timeout(mode);
+        self.state = State::Both;
+        match (lhs, rhs) {
+            (_, Some(v)) | (Some(v), None) => (Some(v), vec![]),
+            // Whichever side got further holds all the keys that were pressed.
+            (None, None) => (None, if rbuf.len() > lbuf.len() { rbuf } else { lbuf }),
+        }
+    }
 }
 
 #[cfg(test)]
@@ -41,8 +41,8 @@ fn keymap() {
     assert_eq!(keymap.on_key(Mode::Normal, 'f'), (Partial, vec![]));
     assert_eq!(keymap.on_key(Mode::Normal, 'd'), (Found(3), vec![]));
 
-    // Overwrite with longer key sequence
-    assert_eq!(keymap.insert(Mode::Normal, ['f', 'd', 'd'], 5), Some(3));
+    // Extend with a longer key sequence, `fd` keeps its binding for when no `d` follows
+    assert_eq!(keymap.insert(Mode::Normal, ['f', 'd', 'd'], 5), None);
     assert_eq!(keymap.on_key(Mode::Normal, 'f'), (Partial, vec![]));
     assert_eq!(keymap.on_key(Mode::Normal, 'd'), (Partial, vec![]));
     assert_eq!(keymap.on_key(Mode::Normal, 'd'), (Found(5), vec![]));
@@ -115,3 +115,69 @@ fn keymap_pair() {
     assert_eq!(c.on_key(Mode::Normal, 'b'), (Partial, vec![]));
     assert_eq!(c.on_key(Mode::Normal, 'c'), (Found(14), vec![]));
 }
+
+#[test]
+fn keymap_prefix_resolution() {
+    let mut keymap = Keymap::<Mode, char, u32>::default();
+    assert!(keymap.insert(Mode::Normal, ['g', 'd'], 1).is_none());
+    assert!(keymap.insert(Mode::Normal, ['g', 'g'], 2).is_none());
+    // Binding the prefix itself doesn't replace the longer sequences.
+    assert!(keymap.insert(Mode::Normal, ['g'], 3).is_none());
+
+    assert_eq!(keymap.on_key(Mode::Normal, 'g'), (Partial, vec![]));
+    assert_eq!(keymap.on_key(Mode::Normal, 'd'), (Found(1), vec![]));
+    assert_eq!(keymap.on_key(Mode::Normal, 'g'), (Partial, vec![]));
+    assert_eq!(keymap.on_key(Mode::Normal, 'g'), (Found(2), vec![]));
+
+    // Rebinding an exact sequence replaces it.
+    assert_eq!(keymap.insert(Mode::Normal, ['g', 'd'], 4), Some(1));
+    assert_eq!(keymap.on_key(Mode::Normal, 'g'), (Partial, vec![]));
+    assert_eq!(keymap.on_key(Mode::Normal, 'd'), (Found(4), vec![]));
+}
+
+#[test]
+fn keymap_timeout() {
+    let mut keymap = Keymap::<Mode, char, u32>::default();
+    assert!(keymap.insert(Mode::Normal, ['g'], 1).is_none());
+    assert!(keymap.insert(Mode::Normal, ['g', 'd'], 2).is_none());
+    assert!(keymap.insert(Mode::Insert, ['j', 'k'], 3).is_none());
+
+    // The prefix's own binding runs if nothing follows in time.
+    assert_eq!(keymap.on_key(Mode::Normal, 'g'), (Partial, vec![]));
+    assert_eq!(keymap.on_timeout(Mode::Normal), (Some(1), vec![]));
+    // The buffer is reset by the timeout.
+    assert_eq!(keymap.on_key(Mode::Normal, 'd'), (Nothing, vec!['d']));
+
+    // Without a binding for the prefix, the keys are handed back.
+    assert_eq!(keymap.on_key(Mode::Insert, 'j'), (Partial, vec![]));
+    assert_eq!(keymap.on_timeout(Mode::Insert), (None, vec!['j']));
+    assert_eq!(keymap.on_key(Mode::Insert, 'k'), (Nothing, vec!['k']));
+
+    // Nothing pending.
+    assert_eq!(keymap.on_timeout(Mode::Normal), (None, vec![]));
+}
+
+#[test]
+fn keymap_override_and_remove() {
+    let mut default = Keymap::<Mode, char, u32>::default();
+    assert!(default.insert(Mode::Normal, ['x'], 1).is_none());
+    assert!(default.insert(Mode::Normal, ['z', 'a'], 2).is_none());
+    assert!(default.insert(Mode::Normal, ['z', 'b'], 3).is_none());
+
+    assert_eq!(default.insert(Mode::Normal, ['x'], 10), Some(1));
+    assert_eq!(default.on_key(Mode::Normal, 'x'), (Found(10), vec![]));
+
+    assert!(default.remove(Mode::Normal, ['z', 'a']));
+    assert!(!default.remove(Mode::Normal, ['z', 'a']));
+    assert_eq!(default.on_key(Mode::Normal, 'z'), (Partial, vec![]));
+    assert_eq!(default.on_key(Mode::Normal, 'a'), (Nothing, vec!['z', 'a']));
+
+    // Removing the last binding under a prefix removes the prefix too.
+    assert!(default.remove(Mode::Normal, ['z', 'b']));
+    assert_eq!(default.on_key(Mode::Normal, 'z'), (Nothing, vec!['z']));
+
+    // Removing a prefix removes everything under it.
+    assert!(default.insert(Mode::Normal, ['z', 'a'], 2).is_none());
+    assert!(default.remove(Mode::Normal, ['z']));
+    assert_eq!(default.on_key(Mode::Normal, 'z'), (Nothing, vec!['z']));
+}
@@ -42,6 +42,9 @@ pub struct KnownFileTypes {
     pub python: FileType,
     pub yaml: FileType,
     pub nix: FileType,
+    pub html: FileType,
+    pub css: FileType,
+    pub sh: FileType,
 }
 
 fn ft(ft: &str) -> FileType {
@@ -77,6 +80,9 @@ impl FileType {
             python: ft("python"),
             yaml: ft("yaml"),
             nix: ft("nix"),
+            html: ft("html"),
+            css: ft("css"),
+            sh: ft("sh"),
         })
     }
 
@@ -101,6 +107,9 @@ impl FileType {
                 Some("py") => filetype!(python),
                 Some("yaml") | Some("yml") => filetype!(yaml),
                 Some("nix") => filetype!(nix),
+                Some("html") | Some("htm") => filetype!(html),
+                Some("css") => filetype!(css),
+                Some("sh") | Some("bash") | Some("zsh") => filetype!(sh),
                 _ => filetype!(text),
             },
             None => filetype!(text),
@@ -110,6 +119,45 @@ impl FileType {
     pub fn as_str(&self) -> &str {
         &self.0
     }
+
+    /// The comment syntax of the language, used to toggle comments.
+    pub fn comment_tokens(&self) -> CommentTokens {
+        let known = Self::known();
+        let (line, block) = match *self {
+            ft if ft == known.c
+                || ft == known.rust
+                || ft == known.go
+                || ft == known.javascript
+                || ft == known.typescript =>
+            {
+                (Some("//"), Some(("/*", "*/")))
+            }
+            ft if ft == known.zig => (Some("//"), None),
+            ft if ft == known.fsharp => (Some("//"), Some(("(*", "*)"))),
+            ft if ft == known.haskell => (Some("--"), Some(("{-", "-}"))),
+            ft if ft == known.nix => (Some("#"), Some(("/*", "*/"))),
+            ft if ft == known.toml
+                || ft == known.python
+                || ft == known.yaml
+                || ft == known.sh
+                || ft == known.gqlt =>
+            {
+                (Some("#"), None)
+            }
+            ft if ft == known.css => (None, Some(("/*", "*/"))),
+            ft if ft == known.html => (None, Some(("<!--", "-->"))),
+            _ => (None, None),
+        };
+        CommentTokens { line, block }
+    }
+}
+
+/// The tokens a language uses for comments, either may be missing (e.g. CSS has no line comments).
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct CommentTokens {
+    pub line: Option<&'static str>,
+    /// The opening and closing tokens of a block comment.
+    pub block: Option<(&'static str, &'static str)>,
 }
 
 impl AsRef<Path> for FileType {
@@ -189,10 +237,33 @@ impl Config {
 #[derive(Debug, Default)]
 pub struct LanguageConfig {
     pub language_services: Box<[LanguageServiceId]>,
+    /// An external formatter to use instead of the language services, e.g. `gofmt`.
+    pub formatter: Option<Formatter>,
 }
 
 impl LanguageConfig {
     pub fn new(language_servers: impl IntoIterator<Item = LanguageServiceId>) -> Self {
-        Self { language_services: language_servers.into_iter().collect() }
+        Self { language_services: language_servers.into_iter().collect(), formatter: None }
+    }
+
+    pub fn with_formatter(mut self, formatter: Formatter) -> Self {
+        self.formatter = Some(formatter);
+        self
+    }
+}
+
+/// A command that reads the text to format from stdin and writes the formatted text to stdout.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Formatter {
+    pub command: String,
+    pub args: Vec<String>,
+}
+
+impl Formatter {
+    pub fn new(
+        command: impl Into<String>,
+        args: impl IntoIterator<Item = impl Into<String>>,
+    ) -> Self {
+        Self { command: command.into(), args: args.into_iter().map(Into::into).collect() }
     }
 }
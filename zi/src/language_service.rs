@@ -105,7 +105,7 @@ pub trait LanguageService {
         None
     }
 
-    fn completion_capabilities(&self) -> Option<()> {
+    fn completion_capabilities(&self) -> Option<lstypes::CompletionCapabilities> {
         None
     }
 
@@ -125,6 +125,10 @@ pub trait LanguageService {
         None
     }
 
+    fn hover_capabilities(&self) -> Option<()> {
+        None
+    }
+
     /// Initialize the language service.
     /// This must be called before any other method and should only be called exactly once.
     fn initialize(&mut self, params: lstypes::InitializeParams) -> ResponseFuture<()> {
@@ -136,6 +140,14 @@ pub trait LanguageService {
         Ok(())
     }
 
+    /// Notify this service of an open document.
+    /// Used to sync documents that were opened before the service was initialized,
+    /// later opens are handled via the event system.
+    fn did_open(&mut self, params: lstypes::DidOpenParams) -> Result<()> {
+        let _ = params;
+        Ok(())
+    }
+
     fn format(
         &mut self,
         params: lstypes::DocumentFormattingParams,
@@ -184,6 +196,11 @@ pub trait LanguageService {
         unimplemented!()
     }
 
+    fn hover(&mut self, params: lstypes::HoverParams) -> ResponseFuture<Option<lstypes::Hover>> {
+        let _ = params;
+        unimplemented!()
+    }
+
     fn semantic_tokens_full(
         &mut self,
         // Bit of a hack parameter, find another cleaner way
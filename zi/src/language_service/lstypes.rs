@@ -20,6 +20,14 @@ pub struct WorkspaceFolder {
     pub name: String,
 }
 
+#[derive(Debug, Clone, PartialEq)]
+pub struct DidOpenParams {
+    pub url: Url,
+    pub language_id: String,
+    pub version: u32,
+    pub text: String,
+}
+
 #[derive(Debug, Clone, PartialEq)]
 pub struct DocumentFormattingParams {
     pub url: Url,
@@ -112,6 +120,12 @@ pub struct EncodedPoint {
     encoding: PositionEncoding,
 }
 
+impl fmt::Display for EncodedPoint {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}", self.point)
+    }
+}
+
 impl From<Point> for EncodedPoint {
     #[inline]
     fn from(point: Point) -> Self {
@@ -162,6 +176,12 @@ pub enum Severity {
     Error,
 }
 
+#[derive(Debug, Eq, PartialEq, Clone, Default)]
+pub struct CompletionCapabilities {
+    /// Characters that open completion when typed, e.g. `.`.
+    pub trigger_characters: Vec<char>,
+}
+
 #[derive(Debug, Eq, PartialEq, Clone)]
 pub struct CompletionParams {
     pub at: TextDocumentPointParams,
@@ -172,6 +192,18 @@ pub struct CompletionResponse {
     pub items: Vec<CompletionItem>,
 }
 
+#[derive(Debug, Eq, PartialEq, Clone)]
+pub struct HoverParams {
+    pub at: TextDocumentPointParams,
+}
+
+#[derive(Debug, Eq, PartialEq, Clone)]
+pub struct Hover {
+    /// The hover contents as markdown.
+    pub contents: String,
+    pub range: Option<EncodedRange>,
+}
+
 #[derive(Debug, Eq, PartialEq, Clone)]
 pub struct SemanticTokensParams {
     pub url: Url,
@@ -5,6 +5,11 @@ use tui::{Constraint, Layout, Rect, Widget as _};
 
 use crate::{Direction, Editor, Size, ViewId};
 
+/// Views smaller than this aren't rendered, there isn't room for the line numbers and any text.
+/// Resizing a view never makes it or its neighbours smaller than this.
+const MIN_VIEW_WIDTH: u16 = 8;
+const MIN_VIEW_HEIGHT: u16 = 1;
+
 pub(crate) struct ViewTree {
     size: Size,
     layers: Vec<Layer>,
@@ -99,6 +104,19 @@ impl ViewTree {
         self.top_mut().focus(view)
     }
 
+    /// Grow the view by `delta` cells along `direction`, or shrink it if `delta` is negative.
+    /// The space comes from the views next to it in the nearest split in that direction.
+    /// Returns `false` if there is no such split.
+    pub fn resize_view(&mut self, view: ViewId, direction: tui::Direction, delta: i32) -> bool {
+        let area = self.area();
+        self.top_mut().resize_view(area, view, direction, delta)
+    }
+
+    /// Give every view in each split the same amount of space.
+    pub fn equalize(&mut self) {
+        self.top_mut().root.equalize()
+    }
+
     pub fn views(&self) -> impl Iterator<Item = ViewId> + '_ {
         self.layers.iter().flat_map(|layer| layer.views())
     }
@@ -118,6 +136,48 @@ impl ViewTree {
     pub(crate) fn view_only(&mut self, view: ViewId) {
         self.layers = vec![Layer::new(view)];
     }
+
+    /// The splits of the bottom layer and its active view, the layers above it are transient such as pickers.
+    pub(crate) fn splits(&self) -> (Splits<ViewId>, ViewId) {
+        let layer = self.layers.first().expect("layers empty");
+        (layer.root.splits(), layer.active)
+    }
+
+    /// Replace all the layers with a single layer laid out as `splits`.
+    pub(crate) fn set_splits(&mut self, splits: Splits<ViewId>, active: ViewId) {
+        let root = Node::from_splits(splits);
+        assert!(root.views().any(|v| v == active), "active view is not in the splits");
+        self.layers = vec![Layer { active, root, compute_area: Box::new(|area| area) }];
+    }
+}
+
+/// The layout of a layer with each view replaced by a `T`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) enum Splits<T> {
+    View(T),
+    Split { direction: tui::Direction, children: Vec<(Constraint, Splits<T>)> },
+}
+
+impl<T> Splits<T> {
+    /// The views in order, depth first.
+    pub(crate) fn views(&self) -> Vec<&T> {
+        match self {
+            Splits::View(view) => vec![view],
+            Splits::Split { children, .. } => {
+                children.iter().flat_map(|(_, child)| child.views()).collect()
+            }
+        }
+    }
+
+    pub(crate) fn map<U>(self, f: &mut impl FnMut(T) -> U) -> Splits<U> {
+        match self {
+            Splits::View(view) => Splits::View(f(view)),
+            Splits::Split { direction, children } => Splits::Split {
+                direction,
+                children: children.into_iter().map(|(c, child)| (c, child.map(f))).collect(),
+            },
+        }
+    }
 }
 
 pub struct Layer {
@@ -186,6 +246,19 @@ impl Layer {
         self.active
     }
 
+    fn resize_view(
+        &mut self,
+        area: Rect,
+        view: ViewId,
+        direction: tui::Direction,
+        delta: i32,
+    ) -> bool {
+        match &mut self.root {
+            Node::View(_) => false,
+            Node::Container(c) => c.resize_view((self.compute_area)(area), view, direction, delta),
+        }
+    }
+
     fn focus(&mut self, view: ViewId) {
         assert!(
             self.views().any(|v| v == view),
@@ -202,6 +275,31 @@ enum Node {
 }
 
 impl Node {
+    fn from_splits(splits: Splits<ViewId>) -> Self {
+        match splits {
+            Splits::View(view) => Node::View(view),
+            Splits::Split { direction, children } => Node::Container(Container::new(
+                direction,
+                children.into_iter().map(|(c, child)| (c, Node::from_splits(child))),
+            )),
+        }
+    }
+
+    fn splits(&self) -> Splits<ViewId> {
+        match self {
+            Node::View(view) => Splits::View(*view),
+            Node::Container(c) => Splits::Split {
+                direction: c.direction,
+                children: c
+                    .constraints
+                    .iter()
+                    .copied()
+                    .zip(c.children.iter().map(Node::splits))
+                    .collect(),
+            },
+        }
+    }
+
     fn view_area(&self, area: Rect, view: ViewId) -> Option<Rect> {
         match self {
             Node::View(id) if *id == view => Some(area),
@@ -212,6 +310,8 @@ impl Node {
 
     fn render(&self, editor: &Editor, area: Rect, surface: &mut tui::Buffer) {
         match self {
+            // Too small to show anything useful, the area is left blank.
+            Node::View(_) if area.width < MIN_VIEW_WIDTH || area.height < MIN_VIEW_HEIGHT => {}
             Node::View(view) => editor.render_view(area, surface, *view),
             Node::Container(container) => container.render(editor, area, surface),
         }
@@ -236,6 +336,13 @@ impl Node {
         }
     }
 
+    fn equalize(&mut self) {
+        if let Node::Container(c) = self {
+            c.constraints.fill(Constraint::Fill(1));
+            c.children.iter_mut().for_each(Node::equalize);
+        }
+    }
+
     fn views(&self) -> impl Iterator<Item = ViewId> + '_ {
         match self {
             Node::View(id) => Box::new(std::iter::once(*id)) as Box<dyn Iterator<Item = ViewId>>,
@@ -292,9 +399,7 @@ impl Container {
     }
 
     fn area(&self, area: Rect, view: ViewId) -> Option<Rect> {
-        let areas = self.layout().split(area);
-        assert_eq!(areas.len(), self.children.len());
-        for (&area, child) in areas.iter().zip(&self.children) {
+        for ((area, _), child) in self.areas(area).into_iter().zip(&self.children) {
             if let Some(area) = child.view_area(area, view) {
                 return Some(area);
             }
@@ -304,13 +409,40 @@ impl Container {
     }
 
     fn render(&self, editor: &Editor, area: Rect, surface: &mut tui::Buffer) {
-        let areas = self.layout().split(area);
-        assert_eq!(areas.len(), self.children.len());
-        for (&area, child) in areas.iter().zip(&self.children) {
+        for ((area, border), child) in self.areas(area).into_iter().zip(&self.children) {
             child.render(editor, area, surface);
+            if let Some(border) = border {
+                editor.render_split_border(border, self.direction, surface);
+            }
         }
     }
 
+    /// The area of each child and the border after it.
+    /// Every child but the last gives up its last column (or row) to the border between it and the next child.
+    fn areas(&self, area: Rect) -> Vec<(Rect, Option<Rect>)> {
+        let areas = self.layout().split(area);
+        assert_eq!(areas.len(), self.children.len());
+        areas
+            .iter()
+            .enumerate()
+            .map(|(i, &area)| {
+                let last = i + 1 == areas.len();
+                match self.direction {
+                    _ if last => (area, None),
+                    tui::Direction::Horizontal if area.width > 0 => (
+                        Rect { width: area.width - 1, ..area },
+                        Some(Rect { x: area.right() - 1, width: 1, ..area }),
+                    ),
+                    tui::Direction::Vertical if area.height > 0 => (
+                        Rect { height: area.height - 1, ..area },
+                        Some(Rect { y: area.bottom() - 1, height: 1, ..area }),
+                    ),
+                    _ => (area, None),
+                }
+            })
+            .collect()
+    }
+
     fn layout(&self) -> Layout {
         assert_eq!(self.constraints.len(), self.children.len());
         Layout::new(self.direction, self.constraints.clone())
@@ -368,6 +500,65 @@ impl Container {
         self.children.iter().flat_map(|child| child.views())
     }
 
+    fn resize_view(
+        &mut self,
+        area: Rect,
+        view: ViewId,
+        direction: tui::Direction,
+        delta: i32,
+    ) -> bool {
+        let Some(i) = self.children.iter().position(|child| child.views().any(|v| v == view))
+        else {
+            return false;
+        };
+
+        let areas = self.layout().split(area);
+        // The innermost split in the direction is the one resized.
+        let (child_area, _) = self.areas(area)[i];
+        if let Node::Container(c) = &mut self.children[i] {
+            if c.resize_view(child_area, view, direction, delta) {
+                return true;
+            }
+        }
+
+        if self.direction != direction || self.children.len() == 1 {
+            return false;
+        }
+
+        let (mut sizes, min) = match direction {
+            tui::Direction::Horizontal => {
+                (areas.iter().map(|area| i32::from(area.width)).collect::<Vec<_>>(), MIN_VIEW_WIDTH)
+            }
+            tui::Direction::Vertical => {
+                (areas.iter().map(|area| i32::from(area.height)).collect(), MIN_VIEW_HEIGHT)
+            }
+        };
+        // The border after a view is part of its size, but not of its minimum.
+        let len = sizes.len();
+        let min = |j: usize| i32::from(min) + i32::from(j + 1 < len);
+
+        // Take the space from, or give it to, the views after this one first and then the ones before it.
+        let neighbours = (i + 1..sizes.len()).chain((0..i).rev()).collect::<Vec<_>>();
+        // Shrinking stops at the minimum size, a view that is already smaller than that is left as is.
+        let mut remaining = delta.max((min(i) - sizes[i]).min(0));
+        for j in neighbours {
+            if remaining == 0 {
+                break;
+            }
+            // A neighbour that is already smaller than the minimum has nothing to give, rather than taking space back.
+            let n =
+                if remaining > 0 { remaining.min((sizes[j] - min(j)).max(0)) } else { remaining };
+            sizes[j] -= n;
+            sizes[i] += n;
+            remaining -= n;
+        }
+
+        // Keep the sizes as weights so the views keep their proportions when the terminal is resized.
+        self.constraints =
+            sizes.into_iter().map(|size| Constraint::Fill(size.max(1) as u16)).collect();
+        true
+    }
+
     fn close_view(&mut self, view: ViewId) -> TraverseResult<ViewId> {
         for i in 0..self.children.len() {
             let child = &mut self.children[i];
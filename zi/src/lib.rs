@@ -1,38 +1,46 @@
 pub use zi_input as input;
 
 pub mod buffer;
+pub mod clipboard;
 pub mod command;
 mod completion;
 mod config;
+mod digraph;
 pub mod dirs;
 mod editor;
+mod encoding;
 pub mod event;
+mod fileformat;
 mod jump;
 mod keymap;
 mod language;
 mod language_service;
 mod layout;
+mod listchars;
 mod location;
 mod namespace;
 mod operator;
 pub mod plugin;
 mod private;
+mod snippet;
+mod statusline;
 mod syntax;
+mod terminal;
 mod undo;
 pub mod view;
 
 pub use location::Location;
 pub use tokio::sync::Notify;
 pub use tree_sitter;
-pub use tui::{Constraint, LineNumberStyle};
+pub use tui::{Constraint, LineNumberStyle, Rect};
 pub use url::Url;
 pub use zi_core::{
     BufferId, Col, CompletionItem, Direction, Line, Mode, NamespaceId, Offset, Operator, Point,
     PointRange, Size, ViewGroupId, ViewId,
 };
 pub use zi_text::{
-    AnyText, AnyTextMut, AnyTextSlice, Delta, Deltas, Rope, RopeBuilder, Text, TextBase, TextMut,
-    TextSlice, deltas,
+    AnyText, AnyTextMut, AnyTextSlice, Delta, Deltas, PieceText, Rope, RopeBuilder, Text, TextBase,
+    TextMut, TextSlice, deltas,
 };
 pub use zi_textobject::motion;
 
@@ -42,12 +50,15 @@ pub use self::completion::CompletionProvider;
 pub use self::config::Setting;
 pub use self::editor::visual::Selection;
 pub use self::editor::{
-    Active, Backend, Client, DummyBackend, EditError, Editor, Match, OpenFlags, Register,
-    RegisterKind, Resource, SaveFlags, Tasks,
+    Active, Backend, Client, DummyBackend, EditError, Editor, Hunk, HunkKind, Match, OpenFlags,
+    QuickfixEntry, Register, RegisterKind, Resource, SaveFlags, Tasks,
 };
+pub use self::encoding::Encoding;
+pub use self::fileformat::FileFormat;
 pub(crate) use self::jump::JumpList;
-pub use self::language::{FileType, LanguageConfig, LanguageServiceId};
+pub use self::language::{CommentTokens, FileType, Formatter, LanguageConfig, LanguageServiceId};
 pub use self::language_service::{LanguageClient, LanguageService, LanguageServiceConfig, lstypes};
+pub use self::listchars::ListChars;
 pub use self::namespace::Namespace;
 #[doc(hidden)]
 pub use self::syntax::HighlightName;
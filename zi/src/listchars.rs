@@ -0,0 +1,131 @@
+//! The glyphs whitespace is shown with in list mode (`:set list`), named after vim's `listchars`.
+//! For example `tab:→ ,trail:·,nbsp:␣,eol:¶`, whitespace without a glyph is shown as usual.
+
+use std::fmt;
+use std::str::FromStr;
+
+use anyhow::{anyhow, bail};
+use unicode_width::UnicodeWidthChar;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ListChars {
+    /// The glyph of the first cell of a tab, the glyph filling the rest of its cells and the glyph of its last cell.
+    /// Only the first is required, the rest of a tab is filled with spaces by default.
+    pub tab: Option<(char, char, Option<char>)>,
+    /// Spaces at the end of a line.
+    pub trail: Option<char>,
+    /// Non-breaking spaces.
+    pub nbsp: Option<char>,
+    /// Shown after the end of each line.
+    pub eol: Option<char>,
+}
+
+impl Default for ListChars {
+    fn default() -> Self {
+        Self { tab: Some(('→', ' ', None)), trail: Some('·'), nbsp: Some('␣'), eol: None }
+    }
+}
+
+impl ListChars {
+    /// The glyphs of a tab taking up `width` cells, so it still takes up as many cells as it would otherwise.
+    pub(crate) fn tab(&self, width: usize) -> Option<String> {
+        let (first, fill, last) = self.tab?;
+        let tab = match (width, last) {
+            (0, _) => String::new(),
+            (1, Some(last)) => last.to_string(),
+            (_, Some(last)) => std::iter::once(first)
+                .chain(std::iter::repeat_n(fill, width - 2))
+                .chain([last])
+                .collect(),
+            (_, None) => {
+                std::iter::once(first).chain(std::iter::repeat_n(fill, width - 1)).collect()
+            }
+        };
+        Some(tab)
+    }
+}
+
+impl fmt::Display for ListChars {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let mut parts = vec![];
+        if let Some((first, fill, last)) = self.tab {
+            parts.push(format!("tab:{first}{fill}{}", last.map(String::from).unwrap_or_default()));
+        }
+        for (name, glyph) in [("trail", self.trail), ("nbsp", self.nbsp), ("eol", self.eol)] {
+            if let Some(glyph) = glyph {
+                parts.push(format!("{name}:{glyph}"));
+            }
+        }
+        write!(f, "{}", parts.join(","))
+    }
+}
+
+impl FromStr for ListChars {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let mut listchars = ListChars { tab: None, trail: None, nbsp: None, eol: None };
+        for part in s.split(',').filter(|part| !part.is_empty()) {
+            let (name, glyphs) = part
+                .split_once(':')
+                .ok_or_else(|| anyhow!("expected `name:glyph`, found `{part}`"))?;
+            let glyphs = glyphs.chars().collect::<Vec<_>>();
+            // Anything wider than a cell would shift the text after it.
+            if let Some(&c) = glyphs.iter().find(|c| c.width() != Some(1)) {
+                bail!("`{c}` is not a single cell wide");
+            }
+
+            let glyph = || match glyphs[..] {
+                [glyph] => Ok(glyph),
+                _ => Err(anyhow!("`{name}` takes a single glyph")),
+            };
+            match name {
+                "tab" => {
+                    listchars.tab = match glyphs[..] {
+                        [first] => Some((first, ' ', None)),
+                        [first, fill] => Some((first, fill, None)),
+                        [first, fill, last] => Some((first, fill, Some(last))),
+                        _ => bail!("`tab` takes one to three glyphs"),
+                    }
+                }
+                "trail" => listchars.trail = Some(glyph()?),
+                "nbsp" => listchars.nbsp = Some(glyph()?),
+                "eol" => listchars.eol = Some(glyph()?),
+                _ => {
+                    bail!("unknown listchars: `{name}` (expected `tab`, `trail`, `nbsp`, or `eol`)")
+                }
+            }
+        }
+        Ok(listchars)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::ListChars;
+
+    #[test]
+    fn parse_listchars() {
+        let listchars = "tab:→ ,trail:·,eol:¶".parse::<ListChars>().unwrap();
+        assert_eq!(listchars.tab, Some(('→', ' ', None)));
+        assert_eq!(listchars.trail, Some('·'));
+        assert_eq!(listchars.nbsp, None);
+        assert_eq!(listchars.eol, Some('¶'));
+        assert_eq!(listchars.to_string(), "tab:→ ,trail:·,eol:¶");
+
+        assert_eq!("tab:>".parse::<ListChars>().unwrap().tab, Some(('>', ' ', None)));
+        assert!("tab:".parse::<ListChars>().is_err());
+        assert!("trail:ab".parse::<ListChars>().is_err());
+        assert!("eol:日".parse::<ListChars>().is_err());
+        assert!("space:.".parse::<ListChars>().is_err());
+    }
+
+    #[test]
+    fn tab_glyphs() {
+        let listchars = "tab:<->".parse::<ListChars>().unwrap();
+        assert_eq!(listchars.tab(4).unwrap(), "<-->");
+        assert_eq!(listchars.tab(2).unwrap(), "<>");
+        assert_eq!(listchars.tab(1).unwrap(), ">");
+        assert_eq!(ListChars::default().tab(4).unwrap(), "→   ");
+    }
+}
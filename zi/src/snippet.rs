@@ -0,0 +1,289 @@
+//! Snippets in the LSP format, the same as vscode's.
+//! `$1` and `${1:default}` are tabstops visited in order, `$0` is where the cursor ends up.
+//! A tabstop that appears more than once mirrors the text of the first one.
+
+use std::collections::HashMap;
+use std::iter::Peekable;
+use std::ops::Range;
+use std::path::Path;
+use std::str::Chars;
+
+use anyhow::{anyhow, bail};
+
+use crate::Result;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Snippet {
+    pub text: String,
+    /// The ranges of the tabstops in the order they're visited, ending with `$0` or the end of the snippet.
+    /// Each tabstop has a range for the tabstop itself followed by its mirrors.
+    pub tabstops: Vec<Vec<Range<usize>>>,
+}
+
+#[derive(Debug)]
+enum Node {
+    Text(String),
+    Tabstop { n: usize, placeholder: Vec<Node> },
+}
+
+impl Snippet {
+    pub fn parse(snippet: &str) -> Self {
+        let nodes = parse(&mut snippet.chars().peekable(), false);
+
+        // Mirrors without a placeholder of their own take the placeholder of the tabstop.
+        let mut placeholders = HashMap::new();
+        collect_placeholders(&nodes, &mut placeholders);
+
+        let mut text = String::with_capacity(snippet.len());
+        let mut ranges = vec![];
+        render(&nodes, &placeholders, &mut text, &mut ranges, 0);
+
+        let mut numbers = ranges.iter().map(|&(n, _)| n).collect::<Vec<_>>();
+        // `$0` is the final tabstop.
+        numbers.sort_by_key(|&n| (n == 0, n));
+        numbers.dedup();
+        let mut tabstops = numbers
+            .into_iter()
+            .map(|n| {
+                ranges.iter().filter(|&&(m, _)| m == n).map(|(_, range)| range.clone()).collect()
+            })
+            .collect::<Vec<Vec<_>>>();
+
+        if !ranges.iter().any(|&(n, _)| n == 0) {
+            tabstops.push(vec![text.len()..text.len()]);
+        }
+
+        Self { text, tabstops }
+    }
+
+    /// Plain text without any tabstops, the cursor ends up after it.
+    pub fn plain(text: String) -> Self {
+        let end = text.len();
+        Self { text, tabstops: vec![vec![end..end]] }
+    }
+
+    /// Indent every line after the first, so the snippet lines up with the line it's inserted on.
+    pub fn indent(&mut self, indent: &str) {
+        if indent.is_empty() {
+            return;
+        }
+
+        let newlines = self.text.match_indices('\n').map(|(i, _)| i).collect::<Vec<_>>();
+        // A byte moves right by the indent once for each newline before it.
+        let shift = |byte: usize| byte + newlines.partition_point(|&i| i < byte) * indent.len();
+        for range in self.tabstops.iter_mut().flatten() {
+            *range = shift(range.start)..shift(range.end);
+        }
+        self.text = self.text.replace('\n', &format!("\n{indent}"));
+    }
+}
+
+fn parse(chars: &mut Peekable<Chars<'_>>, nested: bool) -> Vec<Node> {
+    fn number(chars: &mut Peekable<Chars<'_>>) -> Option<usize> {
+        let mut n = None;
+        while let Some(digit) = chars.peek().and_then(|c| c.to_digit(10)) {
+            chars.next();
+            n = Some(n.unwrap_or(0) * 10 + digit as usize);
+        }
+        n
+    }
+
+    fn name(chars: &mut Peekable<Chars<'_>>) {
+        while chars.next_if(|&c| c.is_alphanumeric() || c == '_').is_some() {}
+    }
+
+    let mut nodes = vec![];
+    let mut text = String::new();
+    while let Some(c) = chars.next() {
+        match c {
+            '\\' => match chars.next_if(|&c| matches!(c, '$' | '}' | '\\')) {
+                Some(c) => text.push(c),
+                None => text.push('\\'),
+            },
+            '}' if nested => break,
+            '$' => {
+                let node = match chars.peek() {
+                    Some(c) if c.is_ascii_digit() => {
+                        let n = number(chars).expect("just checked there is a digit");
+                        Some(Node::Tabstop { n, placeholder: vec![] })
+                    }
+                    Some('{') => {
+                        chars.next();
+                        let n = number(chars);
+                        if n.is_none() {
+                            name(chars);
+                        }
+
+                        let placeholder = match chars.next() {
+                            // `${1:default}` or `${VAR:default}`
+                            Some(':') => parse(chars, true),
+                            // `${1|one,two|}`, the first choice is the default.
+                            Some('|') => {
+                                let mut choice = String::new();
+                                while let Some(c) = chars.next_if(|&c| c != ',' && c != '|') {
+                                    choice.push(c);
+                                }
+                                while chars.next_if(|&c| c != '}').is_some() {}
+                                chars.next();
+                                vec![Node::Text(choice)]
+                            }
+                            _ => vec![],
+                        };
+
+                        match n {
+                            Some(n) => Some(Node::Tabstop { n, placeholder }),
+                            // Variables expand to their default.
+                            None => {
+                                nodes.push(Node::Text(std::mem::take(&mut text)));
+                                nodes.extend(placeholder);
+                                None
+                            }
+                        }
+                    }
+                    // Variables without a default expand to nothing.
+                    Some(c) if c.is_alphabetic() || *c == '_' => {
+                        name(chars);
+                        None
+                    }
+                    _ => {
+                        text.push('$');
+                        None
+                    }
+                };
+
+                if let Some(node) = node {
+                    nodes.push(Node::Text(std::mem::take(&mut text)));
+                    nodes.push(node);
+                }
+            }
+            _ => text.push(c),
+        }
+    }
+
+    nodes.push(Node::Text(text));
+    nodes
+}
+
+fn collect_placeholders<'a>(nodes: &'a [Node], placeholders: &mut HashMap<usize, &'a [Node]>) {
+    for node in nodes {
+        if let Node::Tabstop { n, placeholder } = node {
+            if !placeholder.is_empty() {
+                placeholders.entry(*n).or_insert(placeholder);
+            }
+            collect_placeholders(placeholder, placeholders);
+        }
+    }
+}
+
+/// Render the nodes and record the range of each tabstop.
+/// Tabstops within a mirrored placeholder aren't recorded, only the mirror itself is.
+fn render(
+    nodes: &[Node],
+    placeholders: &HashMap<usize, &[Node]>,
+    out: &mut String,
+    ranges: &mut Vec<(usize, Range<usize>)>,
+    depth: usize,
+) {
+    // Guards against a placeholder that mirrors itself, e.g. `${1:$1}`.
+    const MAX_DEPTH: usize = 16;
+    if depth > MAX_DEPTH {
+        return;
+    }
+
+    for node in nodes {
+        match node {
+            Node::Text(text) => out.push_str(text),
+            Node::Tabstop { n, placeholder } => {
+                let start = out.len();
+                // Record the tabstop before its placeholder so an outer tabstop comes before the ones nested in it.
+                let idx = ranges.len();
+                ranges.push((*n, start..start));
+                if placeholder.is_empty() {
+                    if let Some(placeholder) = placeholders.get(n) {
+                        let mut mirrored = vec![];
+                        render(placeholder, placeholders, out, &mut mirrored, depth + 1);
+                    }
+                } else {
+                    render(placeholder, placeholders, out, ranges, depth + 1);
+                }
+                ranges[idx].1.end = out.len();
+            }
+        }
+    }
+}
+
+/// User-defined snippets for a language, keyed by the word that expands to them.
+/// The file maps each trigger to its snippet, either a string or an array of lines.
+///
+/// ```toml
+/// fn = "fn ${1:name}($2) {\n    $0\n}"
+/// test = ["#[test]", "fn ${1:name}() {", "    $0", "}"]
+/// ```
+pub(crate) fn load_snippets(path: &Path) -> Result<HashMap<String, String>> {
+    let src = match std::fs::read_to_string(path) {
+        Ok(src) => src,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => return Ok(HashMap::new()),
+        Err(err) => bail!("failed to read snippets {}: {err}", path.display()),
+    };
+
+    let table = toml::from_str::<toml::Table>(&src)
+        .map_err(|err| anyhow!("invalid snippets {}: {err}", path.display()))?;
+    table
+        .into_iter()
+        .map(|(trigger, value)| {
+            let body = match value {
+                toml::Value::String(body) => body,
+                toml::Value::Array(lines) => lines
+                    .iter()
+                    .map(|line| {
+                        line.as_str().ok_or_else(|| anyhow!("`{trigger}`: expected a string"))
+                    })
+                    .collect::<Result<Vec<_>>>()?
+                    .join("\n"),
+                _ => bail!("`{trigger}`: expected a string or an array of lines"),
+            };
+            Ok((trigger, body))
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::Snippet;
+
+    #[track_caller]
+    fn check(snippet: &str, text: &str, tabstops: &[&[std::ops::Range<usize>]]) {
+        let snippet = Snippet::parse(snippet);
+        assert_eq!(snippet.text, text);
+        assert_eq!(snippet.tabstops, tabstops);
+    }
+
+    #[test]
+    fn parse_snippets() {
+        check("foo", "foo", &[&[3..3]]);
+        check("foo($1)$0", "foo()", &[&[4..4], &[5..5]]);
+        check("foo(${1:x}, ${2:y})", "foo(x, y)", &[&[4..5], &[7..8], &[9..9]]);
+        check("${2:b} ${1:a}", "b a", &[&[2..3], &[0..1], &[3..3]]);
+        check("if ${1:cond} {\n\t$0\n}", "if cond {\n\t\n}", &[&[3..7], &[11..11]]);
+        check("${1:outer ${2:inner}}", "outer inner", &[&[0..11], &[6..11], &[11..11]]);
+        check("${1|one,two|}!", "one!", &[&[0..3], &[4..4]]);
+        check("$TM_FILENAME ${VAR:x}", " x", &[&[2..2]]);
+        check("\\$1 \\} $", "$1 } $", &[&[6..6]]);
+    }
+
+    #[test]
+    fn parse_mirrors() {
+        check("${1:a} = $1;$0 $1", "a = a; a", &[&[0..1, 4..5, 7..8], &[6..6]]);
+        // The mirror comes first, it still gets the placeholder.
+        check("$1 ${1:x}", "x x", &[&[0..1, 2..3], &[3..3]]);
+        check("${1:$1}", "", &[&[0..0, 0..0], &[0..0]]);
+    }
+
+    #[test]
+    fn indent_snippet() {
+        let mut snippet = Snippet::parse("if $1 {\n\t$0\n}");
+        snippet.indent("  ");
+        assert_eq!(snippet.text, "if  {\n  \t\n  }");
+        assert_eq!(snippet.tabstops, [vec![3..3], vec![9..9]]);
+    }
+}
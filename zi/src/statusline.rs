@@ -0,0 +1,219 @@
+//! The status line is described by a format string such as `{mode} {file}{modified} %= {lsp} {line}:{col}`.
+//! Segments are written in braces and everything else is literal text, `%=` separates the left aligned part from
+//! the right aligned part.
+//! Whitespace separates the format into groups, a group is shown or dropped as a whole.
+
+use std::str::FromStr;
+
+use anyhow::bail;
+use unicode_width::UnicodeWidthStr;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub(crate) enum Segment {
+    /// The current mode, e.g. `NORMAL` or `INSERT`.
+    Mode,
+    /// The path of the buffer or its url if it has no path.
+    File,
+    /// `[+]` if the buffer has unsaved changes and `[deleted]` if its file was deleted on disk.
+    Modified,
+    /// The 1-indexed cursor line.
+    Line,
+    /// The 0-indexed cursor column.
+    Col,
+    /// The encoding of the file, e.g. `utf-8` or `latin1`.
+    Encoding,
+    /// The line ending of the file, `unix`, `dos` or `mac`.
+    FileFormat,
+    /// The checked out git branch, this is read once and refreshed when the terminal regains focus.
+    Branch,
+    /// The language services attached to the buffer.
+    Lsp,
+}
+
+impl Segment {
+    /// Segments with a lower priority are dropped first when the status line doesn't fit.
+    fn priority(self) -> u8 {
+        match self {
+            Segment::File => 7,
+            Segment::Line | Segment::Col => 6,
+            Segment::Modified => 5,
+            Segment::Mode => 4,
+            Segment::Lsp => 3,
+            Segment::Branch => 2,
+            Segment::Encoding | Segment::FileFormat => 1,
+        }
+    }
+}
+
+impl FromStr for Segment {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "mode" => Ok(Self::Mode),
+            "file" => Ok(Self::File),
+            "modified" => Ok(Self::Modified),
+            "line" => Ok(Self::Line),
+            "col" => Ok(Self::Col),
+            "encoding" => Ok(Self::Encoding),
+            "fileformat" => Ok(Self::FileFormat),
+            "branch" => Ok(Self::Branch),
+            "lsp" => Ok(Self::Lsp),
+            _ => bail!(
+                "unknown status line segment: {s} (expected `mode`, `file`, `modified`, `line`, `col`, `encoding`, `fileformat`, `branch`, or `lsp`)"
+            ),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Item {
+    Literal(String),
+    Segment(Segment),
+}
+
+/// A whitespace separated part of the format, e.g. `{line}:{col}`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Group {
+    items: Vec<Item>,
+}
+
+impl Group {
+    /// Groups are as important as their most important segment, groups of only literal text are dropped first.
+    fn priority(&self) -> u8 {
+        self.segments().map(Segment::priority).max().unwrap_or(0)
+    }
+
+    fn segments(&self) -> impl Iterator<Item = Segment> + '_ {
+        self.items.iter().filter_map(|item| match item {
+            Item::Segment(segment) => Some(*segment),
+            Item::Literal(_) => None,
+        })
+    }
+
+    /// Returns `None` if every segment in the group is empty, there is no point showing just its decoration.
+    fn render(&self, value: &impl Fn(Segment) -> String) -> Option<String> {
+        let mut empty = self.segments().next().is_some();
+        let mut s = String::new();
+        for item in &self.items {
+            match item {
+                Item::Literal(text) => s.push_str(text),
+                Item::Segment(segment) => {
+                    let value = value(*segment);
+                    empty &= value.is_empty();
+                    s.push_str(&value);
+                }
+            }
+        }
+
+        (!empty).then_some(s)
+    }
+}
+
+impl FromStr for Group {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let mut items = vec![];
+        let mut rest = s;
+        while !rest.is_empty() {
+            match rest.find('{') {
+                Some(0) => {
+                    let Some(end) = rest.find('}') else {
+                        bail!("unclosed `{{` in status line: {s}")
+                    };
+                    items.push(Item::Segment(rest[1..end].parse()?));
+                    rest = &rest[end + 1..];
+                }
+                Some(i) => {
+                    items.push(Item::Literal(rest[..i].to_string()));
+                    rest = &rest[i..];
+                }
+                None => {
+                    items.push(Item::Literal(rest.to_string()));
+                    rest = "";
+                }
+            }
+        }
+
+        Ok(Self { items })
+    }
+}
+
+/// The format of the status line, set with `:set statusline <format>`.
+/// The default shows the file and the cursor position, `{file}:{line}:{col}`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct StatusLine {
+    left: Vec<Group>,
+    right: Vec<Group>,
+}
+
+impl Default for StatusLine {
+    fn default() -> Self {
+        "{file}:{line}:{col}".parse().expect("default status line is valid")
+    }
+}
+
+impl FromStr for StatusLine {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let parse = |s: &str| s.split_whitespace().map(str::parse).collect::<Result<Vec<_>, _>>();
+        let (left, right) = match s.split_once("%=") {
+            Some((_, right)) if right.contains("%=") => {
+                bail!("status line can only be split once with `%=`: {s}")
+            }
+            Some((left, right)) => (parse(left)?, parse(right)?),
+            None => (parse(s)?, vec![]),
+        };
+
+        Ok(Self { left, right })
+    }
+}
+
+impl StatusLine {
+    /// Render the left and right aligned parts of the status line given the value of each segment.
+    /// The lowest priority groups are dropped until both parts fit within `width` with a space between them.
+    /// The most important group is always kept, it's left to the caller to truncate it if it still doesn't fit.
+    pub(crate) fn render(
+        &self,
+        width: usize,
+        value: impl Fn(Segment) -> String,
+    ) -> (String, String) {
+        // (is on the right, priority, text)
+        let mut groups = self
+            .left
+            .iter()
+            .map(|group| (false, group))
+            .chain(self.right.iter().map(|group| (true, group)))
+            .filter_map(|(right, group)| Some((right, group.priority(), group.render(&value)?)))
+            .collect::<Vec<_>>();
+
+        let required = |groups: &[(bool, u8, String)]| {
+            let text = groups.iter().map(|(_, _, text)| text.width()).sum::<usize>();
+            // Every group is separated by a space, including the last on the left from the first on the right.
+            text + groups.len().saturating_sub(1)
+        };
+
+        while groups.len() > 1 && required(&groups) > width {
+            // Of the least important groups, drop the rightmost first.
+            let (i, _) = groups
+                .iter()
+                .enumerate()
+                .min_by_key(|(i, (_, priority, _))| (*priority, std::cmp::Reverse(*i)))
+                .expect("groups is non-empty");
+            groups.remove(i);
+        }
+
+        let join = |right: bool| {
+            groups
+                .iter()
+                .filter(|(r, _, _)| *r == right)
+                .map(|(_, _, text)| text.as_str())
+                .collect::<Vec<_>>()
+                .join(" ")
+        };
+
+        (join(false), join(true))
+    }
+}
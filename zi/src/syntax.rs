@@ -1,5 +1,7 @@
 mod highlight;
 
+use std::ops::{Range, RangeInclusive};
+
 use tree_sitter::{Query, QueryCapture, QueryCursor, Tree};
 use zi_core::PointRange;
 use zi_text::{AnyText, AnyTextMut, Deltas};
@@ -31,6 +33,30 @@ pub trait Syntax: Send + Sync + 'static {
         range: PointRange,
     ) -> Box<dyn Iterator<Item = QueryCapture<'tree>> + 'a>;
 
+    /// The syntax trees of any languages injected into this one (e.g. SQL in a Go raw string).
+    /// This includes nested injections, and the captures of each are relative to its own highlights query.
+    fn injections(&self) -> Box<dyn Iterator<Item = &dyn Syntax> + '_> {
+        Box::new(std::iter::empty())
+    }
+
+    /// The lines (inclusive) of the nodes that can be folded, e.g. functions and blocks, ordered by start line.
+    fn fold_ranges(&self) -> Vec<RangeInclusive<usize>> {
+        vec![]
+    }
+
+    /// The byte ranges of the strings and comments that overlap the byte range, ordered by start.
+    /// Brackets within them aren't matched with the brackets of the code around them.
+    fn literal_ranges(&self, _byte_range: Range<usize>) -> Vec<Range<usize>> {
+        vec![]
+    }
+
+    /// The number of levels the line is indented by according to the language's indent query.
+    /// Returns `None` if there is no indent query or the tree around the line has errors (e.g. a block that isn't closed
+    /// yet), it's left to the caller to guess the indentation instead.
+    fn indent_level(&self, _text: &dyn AnyText, _line: usize) -> Option<usize> {
+        None
+    }
+
     fn capture_names(&self) -> &[&str] {
         self.highlights_query().capture_names()
     }
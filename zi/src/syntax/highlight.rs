@@ -1,10 +1,16 @@
+use std::collections::HashMap;
+use std::str::FromStr;
 use std::sync::Arc;
 
-use zi_core::style::{Style, style};
+use anyhow::bail;
+use ustr::Ustr;
+use zi_core::style::{Color, Modifier, Style, style};
 
+/// The styles of the highlight scopes, e.g. `keyword.control` or `ui.statusline`.
+/// Scopes the theme doesn't style fall back to their parent scope.
 #[derive(Clone)]
 pub struct Theme {
-    highlights: Vec<(HighlightName, Style)>,
+    styles: HashMap<&'static str, Style>,
     default_style: Style,
 }
 
@@ -33,17 +39,36 @@ macro_rules! declare_highlights {
 
 impl HighlightName {
     declare_highlights! {
-        BACKGROUND = "background",
-        CURSORLINE = "cursorline",
-        DIRECTORY = "directory",
-        CURRENT_SEARCH = "search.current",
-        SEARCH = "search",
-        VISUAL = "visual",
-
-        ERROR = "error",
-        WARNING = "warning",
-        INFO = "info",
-        HINT = "hint",
+        BACKGROUND = "ui.background",
+        CURSORLINE = "ui.cursorline",
+        SECONDARY_CURSOR = "ui.cursor.secondary",
+        MATCHING_BRACKET = "ui.cursor.match",
+        DIRECTORY = "ui.directory",
+        CURRENT_SEARCH = "ui.search.current",
+        SEARCH = "ui.search",
+        VISUAL = "ui.visual",
+        FOLDED = "ui.folded",
+        WINDOW_SEPARATOR = "ui.window",
+        WHITESPACE = "ui.virtual.whitespace",
+        STATUSLINE = "ui.statusline",
+        STATUSLINE_ERROR = "ui.statusline.error",
+        STATUSLINE_MESSAGE = "ui.statusline.message",
+        CMDLINE = "ui.cmdline",
+        MENU = "ui.menu",
+        MENU_SELECTED = "ui.menu.selected",
+        HOVER = "ui.hover",
+
+        ERROR = "diagnostic.error",
+        WARNING = "diagnostic.warning",
+        INFO = "diagnostic.info",
+        HINT = "diagnostic.hint",
+        ERROR_SIGN = "ui.sign.error",
+        WARNING_SIGN = "ui.sign.warning",
+        INFO_SIGN = "ui.sign.info",
+        HINT_SIGN = "ui.sign.hint",
+        GIT_ADDED_SIGN = "ui.sign.git.added",
+        GIT_CHANGED_SIGN = "ui.sign.git.changed",
+        GIT_DELETED_SIGN = "ui.sign.git.deleted",
 
         NAMESPACE = "namespace",
         MODULE = "module",
@@ -84,18 +109,167 @@ impl Theme {
     }
 
     pub fn highlight_id_by_name(&self, name: impl AsRef<str>) -> HighlightId {
-        let name = name.as_ref();
-        self.highlights
-            .iter()
-            .position(|(key, _)| key.as_ref() == name)
-            .map(|i| HighlightId(i as u32))
-            .unwrap_or_default()
+        HighlightId::new(name.as_ref())
+    }
+
+    /// The style of the scope, falling back to its parent scopes if the theme doesn't style it,
+    /// e.g. `keyword.control` falls back to `keyword`.
+    pub fn style(&self, scope: &str) -> Option<Style> {
+        self.resolve(scope).map(|(_, style)| style)
+    }
+
+    /// The scope the theme styles `scope` with and its style.
+    fn resolve(&self, mut scope: &str) -> Option<(&'static str, Style)> {
+        loop {
+            if let Some((&name, &style)) = self.styles.get_key_value(scope) {
+                return Some((name, style));
+            }
+            scope = &scope[..scope.rfind('.')?];
+        }
+    }
+}
+
+/// Themes are written in TOML as a table of scopes to styles.
+/// A style is either just the foreground color or a table with any of `fg`, `bg` and `modifiers`.
+/// Colors can be written in hex or refer to the `palette` table, and `ui.text` is the style of unhighlighted text.
+///
+/// ```toml
+/// "ui.text" = { fg = "#839496" }
+/// "ui.statusline" = { fg = "#888888", bg = "base02" }
+/// keyword = { fg = "#527bd2", modifiers = ["bold"] }
+/// comment = "#586e75"
+///
+/// [palette]
+/// base02 = "#073642"
+/// ```
+///
+/// Dotted keys and nested tables are scopes too, so `keyword.control = "#859900"` is the same as `"keyword.control"`.
+impl FromStr for Theme {
+    type Err = anyhow::Error;
+
+    fn from_str(src: &str) -> Result<Self, Self::Err> {
+        let mut table = toml::from_str::<toml::Table>(src)?;
+        let mut errors = vec![];
+
+        let mut palette = HashMap::new();
+        match table.remove("palette") {
+            Some(toml::Value::Table(colors)) => {
+                for (name, color) in colors {
+                    match color.as_str().map(str::parse::<Color>) {
+                        Some(Ok(color)) => {
+                            palette.insert(name, color);
+                        }
+                        _ => errors.push(format!("`palette.{name}` must be a hex color")),
+                    }
+                }
+            }
+            Some(_) => errors.push("`palette` must be a table".to_string()),
+            None => {}
+        }
+
+        let mut styles = HashMap::new();
+        for (scope, value) in &table {
+            parse_scope(scope, value, &palette, &mut styles, &mut errors);
+        }
+
+        if !errors.is_empty() {
+            bail!("{}", errors.join("; "));
+        }
+
+        let default_style = styles.remove("ui.text").unwrap_or_else(Style::none);
+        Ok(Self { styles, default_style })
+    }
+}
+
+fn parse_scope(
+    scope: &str,
+    value: &toml::Value,
+    palette: &HashMap<String, Color>,
+    styles: &mut HashMap<&'static str, Style>,
+    errors: &mut Vec<String>,
+) {
+    let color = |key: &str, value: &toml::Value, errors: &mut Vec<String>| {
+        let color = value.as_str().and_then(|color| match palette.get(color) {
+            Some(&color) => Some(color),
+            None => color.parse().ok(),
+        });
+        if color.is_none() {
+            errors.push(format!("`{key}` must be a hex color or the name of a palette color"));
+        }
+        color
+    };
+
+    let table = match value {
+        toml::Value::String(_) => {
+            if let Some(fg) = color(scope, value, errors) {
+                styles.insert(Ustr::from(scope).as_str(), Style::none().with_fg(fg));
+            }
+            return;
+        }
+        toml::Value::Table(table) => table,
+        _ => {
+            errors.push(format!("`{scope}` must be a color or a table"));
+            return;
+        }
+    };
+
+    let mut style = None::<Style>;
+    for (key, value) in table {
+        let path = format!("{scope}.{key}");
+        match key.as_str() {
+            "fg" => {
+                if let Some(fg) = color(&path, value, errors) {
+                    style = Some(style.unwrap_or_else(Style::none).with_fg(fg));
+                }
+            }
+            "bg" => {
+                if let Some(bg) = color(&path, value, errors) {
+                    style = Some(style.unwrap_or_else(Style::none).with_bg(bg));
+                }
+            }
+            "modifiers" => {
+                let Some(names) = value.as_array() else {
+                    errors.push(format!("`{path}` must be an array"));
+                    continue;
+                };
+
+                let mut modifier = Modifier::empty();
+                for name in names {
+                    match name.as_str().and_then(parse_modifier) {
+                        Some(m) => modifier |= m,
+                        None => errors.push(format!("unknown modifier {name} in `{path}`")),
+                    }
+                }
+                style = Some(style.unwrap_or_else(Style::none).with_modifier(modifier));
+            }
+            // Anything else is a nested scope.
+            _ => parse_scope(&path, value, palette, styles, errors),
+        }
+    }
+
+    if let Some(style) = style {
+        styles.insert(Ustr::from(scope).as_str(), style);
     }
 }
 
+fn parse_modifier(name: &str) -> Option<Modifier> {
+    Some(match name {
+        "bold" => Modifier::BOLD,
+        "dim" => Modifier::DIM,
+        "italic" => Modifier::ITALIC,
+        "underline" | "underlined" => Modifier::UNDERLINED,
+        "slow_blink" => Modifier::SLOW_BLINK,
+        "rapid_blink" => Modifier::RAPID_BLINK,
+        "reverse" | "reversed" => Modifier::REVERSED,
+        "hidden" => Modifier::HIDDEN,
+        "crossed_out" => Modifier::CROSSED_OUT,
+        _ => return None,
+    })
+}
+
 macro_rules! hi {
     ($name:expr => $($tt:tt)*) => {
-        ($name.into(), style!($($tt)*))
+        ($name.as_ref(), style!($($tt)*))
     };
 }
 
@@ -105,17 +279,36 @@ impl Default for Theme {
         use HighlightName as Hl;
         Self {
             default_style: style!(fg = 0x83949600),
-            highlights: [
+            styles: [
                 hi!(Hl::BACKGROUND => bg=0x002b3600),
                 hi!(Hl::CURSORLINE => bg=0x07364200),
+                hi!(Hl::SECONDARY_CURSOR => fg=0x002b3600 bg=0x83949600),
+                hi!(Hl::MATCHING_BRACKET => bg=0x586e7500),
                 hi!(Hl::DIRECTORY => fg=0x268bd200),
                 hi!(Hl::SEARCH => bg=0x00445400),
                 hi!(Hl::CURRENT_SEARCH => fg=0xeb773400 bg=0x00445400),
                 hi!(Hl::VISUAL => bg=0x28485800),
+                hi!(Hl::FOLDED => fg=0x586e7500),
+                hi!(Hl::WINDOW_SEPARATOR => fg=0x586e7500 bg=0x002b3600),
+                hi!(Hl::WHITESPACE => fg=0x586e7500),
+                hi!(Hl::STATUSLINE => fg=0x88888800 bg=0x07364200),
+                hi!(Hl::STATUSLINE_ERROR => fg=0xff000000 bg=0x07364200),
+                hi!(Hl::STATUSLINE_MESSAGE => fg=0xb5890000 bg=0x07364200),
+                hi!(Hl::CMDLINE => fg=0x88888800 bg=0x002b3600),
+                hi!(Hl::MENU => fg=0x88888800 bg=0x07364200),
+                hi!(Hl::MENU_SELECTED => fg=0x88888800 bg=0x002b3600),
                 hi!(Hl::ERROR => underline),
                 hi!(Hl::WARNING => underline),
                 hi!(Hl::INFO => underline),
                 hi!(Hl::HINT => underline),
+                hi!(Hl::ERROR_SIGN => fg=0xdc322f00),
+                hi!(Hl::WARNING_SIGN => fg=0xb5890000),
+                hi!(Hl::INFO_SIGN => fg=0x268bd200),
+                hi!(Hl::HINT_SIGN => fg=0x2aa19800),
+                hi!(Hl::GIT_ADDED_SIGN => fg=0x85990000),
+                hi!(Hl::GIT_CHANGED_SIGN => fg=0xb5890000),
+                hi!(Hl::GIT_DELETED_SIGN => fg=0xdc322f00),
+                hi!(Hl::HOVER => fg=0x93a1a100 bg=0x07364200),
                 hi!(Hl::NAMESPACE => fg=0x39a6b900),
                 hi!(Hl::MODULE => fg=0x39a6b900),
                 hi!(Hl::MACRO => fg=0x298cba00),
@@ -149,11 +342,17 @@ impl Default for Theme {
     }
 }
 
+/// The id of a highlight scope.
+/// This doesn't depend on the theme, the scope is resolved to a style against the current theme when rendered.
 #[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
-pub struct HighlightId(u32);
+pub struct HighlightId(Option<Ustr>);
 
 impl HighlightId {
-    pub const DEFAULT: HighlightId = HighlightId(u32::MAX);
+    pub const DEFAULT: HighlightId = HighlightId(None);
+
+    pub(crate) fn new(scope: &str) -> Self {
+        Self(Some(Ustr::from(scope)))
+    }
 }
 
 impl HighlightId {
@@ -162,15 +361,15 @@ impl HighlightId {
     }
 
     pub fn style(self, theme: &Theme) -> Option<Style> {
-        if self.is_default() {
-            return Some(theme.default_style);
+        match self.0 {
+            None => Some(theme.default_style),
+            Some(scope) => theme.style(&scope),
         }
-
-        theme.highlights.get(self.0 as usize).map(|(_, style)| style).copied()
     }
 
+    /// The scope of the theme the highlight resolves to.
     pub fn name(self, theme: &Theme) -> Option<&str> {
-        theme.highlights.get(self.0 as usize).map(|name| name.0.as_ref())
+        theme.resolve(&self.0?).map(|(name, _)| name)
     }
 }
 
@@ -185,37 +384,11 @@ impl Default for HighlightId {
 pub struct HighlightMap(Arc<[HighlightId]>);
 
 impl HighlightMap {
-    pub(crate) fn new(
-        capture_names: impl IntoIterator<Item = impl AsRef<str>>,
-        theme: &Theme,
-    ) -> Self {
-        // For each capture name in the highlight query, find the longest
-        // key in the theme's syntax styles that matches all of the
-        // dot-separated components of the capture name.
+    /// Captures are highlighted as the scope of their name, so `@keyword.control.rust` is styled as `keyword.control`
+    /// by themes that don't style rust keywords specifically.
+    pub(crate) fn new(capture_names: impl IntoIterator<Item = impl AsRef<str>>) -> Self {
         HighlightMap(
-            capture_names
-                .into_iter()
-                .map(|capture_name| {
-                    theme
-                        .highlights
-                        .iter()
-                        .enumerate()
-                        .filter_map(|(i, (key, _))| {
-                            let mut len = 0;
-                            let mut capture_parts = capture_name.as_ref().split('.');
-                            for key_part in key.as_ref().split('.') {
-                                if capture_parts.any(|part| part == key_part) {
-                                    len += 1;
-                                } else {
-                                    return None;
-                                }
-                            }
-                            Some((i, len))
-                        })
-                        .max_by_key(|(_, len)| *len)
-                        .map_or(HighlightId::DEFAULT, |(i, _)| HighlightId(i as u32))
-                })
-                .collect(),
+            capture_names.into_iter().map(|name| HighlightId::new(name.as_ref())).collect(),
         )
     }
 
@@ -233,7 +406,7 @@ mod tests {
     fn highlight_map() {
         let theme = Theme {
             default_style: Style::none(),
-            highlights: [
+            styles: [
                 ("function", Style::none()),
                 ("function.method", Style::none()),
                 ("function.async", Style::none()),
@@ -242,15 +415,68 @@ mod tests {
                 ("variable", Style::none()),
             ]
             .into_iter()
-            .map(|(name, color)| (name.into(), color))
             .collect(),
         };
 
         let capture_names = &["function.special", "function.async.rust", "variable.builtin.self"];
 
-        let map = HighlightMap::new(capture_names, &theme);
+        let map = HighlightMap::new(capture_names);
         assert_eq!(map.get(0).name(&theme), Some("function"));
         assert_eq!(map.get(1).name(&theme), Some("function.async"));
         assert_eq!(map.get(2).name(&theme), Some("variable.builtin"));
     }
+
+    #[test]
+    fn parse_theme() -> anyhow::Result<()> {
+        let theme = r##"
+"ui.text" = "#839496"
+"ui.statusline" = { fg = "#888888", bg = "base02" }
+keyword = { fg = "#527bd2", modifiers = ["bold", "italic"] }
+"keyword.control.import" = "#859900"
+
+[diagnostic.error]
+modifiers = ["underline"]
+
+[palette]
+base02 = "#073642"
+"##
+        .parse::<Theme>()?;
+
+        assert_eq!(theme.default_style(), style!(fg = 0x83949600));
+        assert_eq!(theme.style("ui.statusline"), Some(style!(fg=0x88888800 bg=0x07364200)));
+        assert_eq!(theme.style("diagnostic.error"), Some(style!(underline)));
+        assert_eq!(theme.style("ui.text"), None);
+
+        // Scopes fall back to their parents.
+        let keyword = style!(fg=0x527bd200 bold italic);
+        assert_eq!(theme.style("keyword"), Some(keyword));
+        assert_eq!(theme.style("keyword.control"), Some(keyword));
+        assert_eq!(theme.style("keyword.control.import"), Some(style!(fg = 0x85990000)));
+        assert_eq!(theme.style("keyword.control.import.rust"), Some(style!(fg = 0x85990000)));
+        assert_eq!(theme.style("ui.statusline.error"), theme.style("ui.statusline"));
+        assert_eq!(theme.style("function"), None);
+        assert_eq!(theme.style("keywords"), None);
+
+        let id = theme.highlight_id_by_name("keyword.control.repeat");
+        assert_eq!(id.name(&theme), Some("keyword"));
+        assert_eq!(id.style(&theme), Some(keyword));
+        Ok(())
+    }
+
+    #[test]
+    fn parse_invalid_theme() {
+        let err = r##"
+keyword = "red"
+string = { fg = "#2aa198", modifiers = ["blinking"] }
+comment = 1
+[palette]
+base03 = 42
+"##
+        .parse::<Theme>()
+        .err()
+        .expect("theme is invalid");
+
+        expect_test::expect![[r#"`palette.base03` must be a hex color; `comment` must be a color or a table; `keyword` must be a hex color or the name of a palette color; unknown modifier "blinking" in `string.modifiers`"#]]
+            .assert_eq(&err.to_string());
+    }
 }
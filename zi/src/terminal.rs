@@ -0,0 +1,641 @@
+//! A small vt100/xterm emulator for terminal buffers, the output of the process is parsed into a grid of cells.
+//! Only the escape sequences that shells and line oriented programs commonly use are supported, styling is parsed
+//! but discarded.
+//! The processes run in a pty, which is only implemented for unix.
+
+#![cfg_attr(not(unix), allow(dead_code))]
+
+#[cfg(unix)]
+mod pty;
+
+use std::collections::VecDeque;
+use std::mem;
+
+use unicode_width::UnicodeWidthChar;
+use zi_input::{KeyCode, KeyEvent, KeyModifiers};
+
+#[cfg(unix)]
+pub(crate) use self::pty::Pty;
+use crate::Point;
+
+/// The number of lines kept after they scroll off the top of the screen.
+const SCROLLBACK: usize = 10_000;
+
+const BLANK: char = ' ';
+
+/// The cell after a double width character.
+const WIDE: char = '\0';
+
+type Grid = Vec<Vec<char>>;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum State {
+    Ground,
+    Escape,
+    /// Designating a character set, `ESC ( B`, the next character is ignored.
+    Charset,
+    Csi,
+    /// Operating system commands (e.g. setting the title) are ignored until they're terminated.
+    Osc,
+    OscEscape,
+}
+
+pub(crate) struct Terminal {
+    rows: usize,
+    cols: usize,
+    grid: Grid,
+    scrollback: VecDeque<String>,
+    /// The main screen and cursor while the alternate screen is active.
+    primary: Option<(Grid, (usize, usize))>,
+    row: usize,
+    col: usize,
+    /// A character was written to the last column, the next one wraps onto the next line.
+    wrap_pending: bool,
+    saved: (usize, usize),
+    /// The first and last rows of the scrolling region.
+    top: usize,
+    bottom: usize,
+    state: State,
+    params: String,
+    /// The start of a utf-8 sequence that was split across reads.
+    partial: Vec<u8>,
+    /// Responses to queries, e.g. the cursor position, to be written back to the process.
+    replies: Vec<u8>,
+}
+
+impl Terminal {
+    pub fn new(rows: usize, cols: usize) -> Self {
+        let (rows, cols) = (rows.max(1), cols.max(1));
+        Self {
+            rows,
+            cols,
+            grid: vec![vec![BLANK; cols]; rows],
+            scrollback: Default::default(),
+            primary: None,
+            row: 0,
+            col: 0,
+            wrap_pending: false,
+            saved: (0, 0),
+            top: 0,
+            bottom: rows - 1,
+            state: State::Ground,
+            params: String::new(),
+            partial: vec![],
+            replies: vec![],
+        }
+    }
+
+    pub fn size(&self) -> (usize, usize) {
+        (self.rows, self.cols)
+    }
+
+    /// Parse the output of the process.
+    pub fn advance(&mut self, output: &[u8]) {
+        let mut bytes = mem::take(&mut self.partial);
+        bytes.extend_from_slice(output);
+
+        let mut rest = &bytes[..];
+        while !rest.is_empty() {
+            let (valid, invalid) = match std::str::from_utf8(rest) {
+                Ok(s) => (s, None),
+                Err(err) => {
+                    let (valid, invalid) = rest.split_at(err.valid_up_to());
+                    (std::str::from_utf8(valid).unwrap(), Some((invalid, err.error_len())))
+                }
+            };
+            valid.chars().for_each(|c| self.process(c));
+
+            rest = match invalid {
+                None => &[],
+                Some((invalid, Some(len))) => {
+                    self.process(char::REPLACEMENT_CHARACTER);
+                    &invalid[len..]
+                }
+                // The rest of the sequence is in the next read.
+                Some((invalid, None)) => {
+                    self.partial = invalid.to_vec();
+                    &[]
+                }
+            };
+        }
+    }
+
+    pub fn take_replies(&mut self) -> Vec<u8> {
+        mem::take(&mut self.replies)
+    }
+
+    pub fn resize(&mut self, rows: usize, cols: usize) {
+        let (rows, cols) = (rows.max(1), cols.max(1));
+        if (rows, cols) == (self.rows, self.cols) {
+            return;
+        }
+
+        for line in &mut self.grid {
+            line.resize(cols, BLANK);
+        }
+
+        // Keep the cursor on screen by moving the lines above it into the scrollback if the screen got shorter.
+        while self.grid.len() > rows {
+            if self.row + 1 < self.grid.len() {
+                self.grid.pop();
+            } else {
+                let line = self.grid.remove(0);
+                self.push_scrollback(&line);
+                self.row -= 1;
+            }
+        }
+        self.grid.resize(rows, vec![BLANK; cols]);
+
+        if let Some((grid, (row, col))) = &mut self.primary {
+            grid.iter_mut().for_each(|line| line.resize(cols, BLANK));
+            grid.resize(rows, vec![BLANK; cols]);
+            *row = (*row).min(rows - 1);
+            *col = (*col).min(cols - 1);
+        }
+
+        self.rows = rows;
+        self.cols = cols;
+        self.top = 0;
+        self.bottom = rows - 1;
+        self.row = self.row.min(rows - 1);
+        self.col = self.col.min(cols - 1);
+        self.wrap_pending = false;
+    }
+
+    /// The scrollback followed by the screen, and the position of the cursor in that text.
+    /// Blanks at the end of lines and blank lines after the cursor are not included.
+    pub fn render(&self) -> (String, Point) {
+        let mut text = String::new();
+        for line in &self.scrollback {
+            text.push_str(line);
+            text.push('\n');
+        }
+
+        let cursor_line = self.scrollback.len() + self.row;
+        let mut cursor = Point::new(cursor_line, 0);
+        let last = self
+            .grid
+            .iter()
+            .rposition(|line| line.iter().any(|&c| c != BLANK))
+            .map_or(self.row, |last| last.max(self.row));
+
+        for (row, line) in self.grid[..=last].iter().enumerate() {
+            let mut s = line_to_string(line);
+            if row == self.row {
+                let col =
+                    line[..self.col].iter().filter(|&&c| c != WIDE).map(|c| c.len_utf8()).sum();
+                // Keep the blanks before the cursor so it's shown where the process put it.
+                if s.len() < col {
+                    s.push_str(&BLANK.to_string().repeat(col - s.len()));
+                }
+                cursor = Point::new(cursor_line, col);
+            }
+            text.push_str(&s);
+            text.push('\n');
+        }
+
+        (text, cursor)
+    }
+
+    fn process(&mut self, c: char) {
+        match self.state {
+            State::Ground => match c {
+                '\x1b' => self.state = State::Escape,
+                '\r' => self.set_col(0),
+                '\n' | '\x0b' | '\x0c' => self.linefeed(),
+                '\x08' => self.set_col(self.col.saturating_sub(1)),
+                '\t' => self.set_col((self.col / 8 + 1) * 8),
+                _ if c.is_control() => {}
+                _ => self.print(c),
+            },
+            State::Escape => {
+                self.state = State::Ground;
+                match c {
+                    '[' => {
+                        self.params.clear();
+                        self.state = State::Csi;
+                    }
+                    ']' => self.state = State::Osc,
+                    '(' | ')' | '*' | '+' => self.state = State::Charset,
+                    '7' => self.saved = (self.row, self.col),
+                    '8' => self.restore_cursor(),
+                    'D' => self.linefeed(),
+                    'E' => {
+                        self.set_col(0);
+                        self.linefeed();
+                    }
+                    'M' => self.reverse_index(),
+                    'c' => self.reset(),
+                    _ => {}
+                }
+            }
+            State::Charset => self.state = State::Ground,
+            State::Csi => match c {
+                '\x30'..='\x3f' => self.params.push(c),
+                // Intermediate bytes aren't used by any of the supported sequences.
+                '\x20'..='\x2f' => {}
+                '\x40'..='\x7e' => {
+                    self.state = State::Ground;
+                    let params = mem::take(&mut self.params);
+                    self.csi(&params, c);
+                }
+                '\x1b' => self.state = State::Escape,
+                _ => {}
+            },
+            State::Osc => match c {
+                '\x07' => self.state = State::Ground,
+                '\x1b' => self.state = State::OscEscape,
+                _ => {}
+            },
+            // The string terminator is `ESC \`.
+            State::OscEscape => self.state = State::Ground,
+        }
+    }
+
+    fn csi(&mut self, params: &str, c: char) {
+        let private = params.starts_with(['?', '>', '=', '<']);
+        let args = params
+            .trim_start_matches(['?', '>', '=', '<'])
+            .split(';')
+            .map(|arg| arg.parse::<usize>().unwrap_or(0))
+            .collect::<Vec<_>>();
+        let arg = |i: usize| args.get(i).copied().unwrap_or(0);
+        // Most sequences treat a missing or zero count as one.
+        let n = arg(0).max(1);
+
+        if private {
+            if matches!(c, 'h' | 'l') && args.iter().any(|arg| matches!(arg, 47 | 1047 | 1049)) {
+                self.alternate_screen(c == 'h');
+            }
+            return;
+        }
+
+        match c {
+            'A' => self.set_row(self.row.saturating_sub(n)),
+            'B' | 'e' => self.set_row(self.row.saturating_add(n)),
+            'C' | 'a' => self.set_col(self.col.saturating_add(n)),
+            'D' => self.set_col(self.col.saturating_sub(n)),
+            'E' => {
+                self.set_row(self.row.saturating_add(n));
+                self.set_col(0);
+            }
+            'F' => {
+                self.set_row(self.row.saturating_sub(n));
+                self.set_col(0);
+            }
+            'G' | '`' => self.set_col(n - 1),
+            'd' => self.set_row(n - 1),
+            'H' | 'f' => {
+                self.set_row(arg(0).max(1) - 1);
+                self.set_col(arg(1).max(1) - 1);
+            }
+            'J' => self.erase_display(arg(0)),
+            'K' => self.erase_line(arg(0)),
+            '@' => {
+                let line = &mut self.grid[self.row];
+                for _ in 0..n.min(self.cols - self.col) {
+                    line.pop();
+                    line.insert(self.col, BLANK);
+                }
+            }
+            'P' => {
+                let line = &mut self.grid[self.row];
+                line.drain(self.col..self.col.saturating_add(n).min(self.cols));
+                line.resize(self.cols, BLANK);
+            }
+            'X' => {
+                self.grid[self.row][self.col..self.col.saturating_add(n).min(self.cols)].fill(BLANK)
+            }
+            'L' if (self.top..=self.bottom).contains(&self.row) => {
+                for _ in 0..n.min(self.bottom - self.row + 1) {
+                    self.grid.remove(self.bottom);
+                    self.grid.insert(self.row, vec![BLANK; self.cols]);
+                }
+            }
+            'M' if (self.top..=self.bottom).contains(&self.row) => {
+                for _ in 0..n.min(self.bottom - self.row + 1) {
+                    self.grid.remove(self.row);
+                    self.grid.insert(self.bottom, vec![BLANK; self.cols]);
+                }
+            }
+            'S' => self.scroll_up(n),
+            'T' => self.scroll_down(n),
+            'r' => {
+                let bottom = if arg(1) == 0 { self.rows } else { arg(1).min(self.rows) };
+                let top = arg(0).max(1) - 1;
+                (self.top, self.bottom) =
+                    if top < bottom - 1 { (top, bottom - 1) } else { (0, self.rows - 1) };
+                self.set_row(0);
+                self.set_col(0);
+            }
+            's' => self.saved = (self.row, self.col),
+            'u' => self.restore_cursor(),
+            // Device status report, only the cursor position is reported.
+            'n' if arg(0) == 6 => {
+                let reply = format!("\x1b[{};{}R", self.row + 1, self.col + 1);
+                self.replies.extend_from_slice(reply.as_bytes());
+            }
+            // Primary device attributes, claim to be a vt102.
+            'c' if arg(0) == 0 => self.replies.extend_from_slice(b"\x1b[?6c"),
+            // Styling (`m`) and everything else is ignored.
+            _ => {}
+        }
+    }
+
+    fn print(&mut self, c: char) {
+        let width = c.width().unwrap_or(0);
+        // Combining characters are dropped.
+        if width == 0 || width > self.cols {
+            return;
+        }
+
+        if self.wrap_pending || self.col + width > self.cols {
+            self.set_col(0);
+            self.linefeed();
+        }
+
+        let (row, col) = (self.row, self.col);
+        let line = &mut self.grid[row];
+        // Don't leave half of a double width character behind.
+        if line[col] == WIDE {
+            line[col - 1] = BLANK;
+        }
+        if line.get(col + width) == Some(&WIDE) {
+            line[col + width] = BLANK;
+        }
+
+        line[col] = c;
+        if width == 2 {
+            line[col + 1] = WIDE;
+        }
+
+        if col + width < self.cols {
+            self.col += width;
+        } else {
+            self.col = self.cols - 1;
+            self.wrap_pending = true;
+        }
+    }
+
+    fn set_row(&mut self, row: usize) {
+        self.row = row.min(self.rows - 1);
+        self.wrap_pending = false;
+    }
+
+    fn set_col(&mut self, col: usize) {
+        self.col = col.min(self.cols - 1);
+        self.wrap_pending = false;
+    }
+
+    fn restore_cursor(&mut self) {
+        let (row, col) = self.saved;
+        self.set_row(row);
+        self.set_col(col);
+    }
+
+    fn linefeed(&mut self) {
+        if self.row == self.bottom {
+            self.scroll_up(1);
+        } else {
+            self.set_row(self.row + 1);
+        }
+    }
+
+    fn reverse_index(&mut self) {
+        if self.row == self.top {
+            self.scroll_down(1);
+        } else {
+            self.set_row(self.row.saturating_sub(1));
+        }
+    }
+
+    fn scroll_up(&mut self, n: usize) {
+        for _ in 0..n.min(self.bottom - self.top + 1) {
+            let line = self.grid.remove(self.top);
+            // Only lines scrolled off the top of the main screen are kept.
+            if self.top == 0 && self.primary.is_none() {
+                self.push_scrollback(&line);
+            }
+            self.grid.insert(self.bottom, vec![BLANK; self.cols]);
+        }
+    }
+
+    fn scroll_down(&mut self, n: usize) {
+        for _ in 0..n.min(self.bottom - self.top + 1) {
+            self.grid.remove(self.bottom);
+            self.grid.insert(self.top, vec![BLANK; self.cols]);
+        }
+    }
+
+    fn push_scrollback(&mut self, line: &[char]) {
+        if self.scrollback.len() == SCROLLBACK {
+            self.scrollback.pop_front();
+        }
+        self.scrollback.push_back(line_to_string(line));
+    }
+
+    fn erase_display(&mut self, mode: usize) {
+        let blank = vec![BLANK; self.cols];
+        match mode {
+            0 => {
+                self.erase_line(0);
+                self.grid[self.row + 1..].fill(blank);
+            }
+            1 => {
+                self.erase_line(1);
+                self.grid[..self.row].fill(blank);
+            }
+            2 | 3 => {
+                self.grid.fill(blank);
+                if mode == 3 {
+                    self.scrollback.clear();
+                }
+            }
+            _ => {}
+        }
+    }
+
+    fn erase_line(&mut self, mode: usize) {
+        let line = &mut self.grid[self.row];
+        match mode {
+            0 => line[self.col..].fill(BLANK),
+            1 => line[..=self.col].fill(BLANK),
+            2 => line.fill(BLANK),
+            _ => {}
+        }
+    }
+
+    fn alternate_screen(&mut self, enter: bool) {
+        if enter && self.primary.is_none() {
+            let grid = mem::replace(&mut self.grid, vec![vec![BLANK; self.cols]; self.rows]);
+            self.primary = Some((grid, (self.row, self.col)));
+        } else if let Some((grid, (row, col))) = self.primary.take().filter(|_| !enter) {
+            self.grid = grid;
+            self.set_row(row);
+            self.set_col(col);
+        }
+    }
+
+    fn reset(&mut self) {
+        self.grid.fill(vec![BLANK; self.cols]);
+        self.primary = None;
+        self.top = 0;
+        self.bottom = self.rows - 1;
+        self.set_row(0);
+        self.set_col(0);
+    }
+}
+
+/// The input a terminal sends for the key, `None` if there is no way to send it.
+pub(crate) fn encode_key(key: &KeyEvent) -> Option<Vec<u8>> {
+    let modifiers = key.modifiers();
+    let input: &[u8] = match key.code() {
+        KeyCode::Char(c) if modifiers.contains(KeyModifiers::CONTROL) => match c {
+            '@'..='_' | 'a'..='z' => &[c as u8 & 0x1f],
+            ' ' => &[0],
+            '?' => &[0x7f],
+            _ => return None,
+        },
+        KeyCode::Char(c) => {
+            let mut input = modifiers
+                .contains(KeyModifiers::ALT)
+                .then_some(b'\x1b')
+                .into_iter()
+                .collect::<Vec<_>>();
+            input.extend_from_slice(c.encode_utf8(&mut [0; 4]).as_bytes());
+            return Some(input);
+        }
+        KeyCode::Enter => b"\r",
+        KeyCode::Backspace => &[0x7f],
+        KeyCode::Tab if modifiers.contains(KeyModifiers::SHIFT) => b"\x1b[Z",
+        KeyCode::Tab => b"\t",
+        KeyCode::Esc => b"\x1b",
+        KeyCode::Up => b"\x1b[A",
+        KeyCode::Down => b"\x1b[B",
+        KeyCode::Right => b"\x1b[C",
+        KeyCode::Left => b"\x1b[D",
+        KeyCode::Home => b"\x1b[H",
+        KeyCode::End => b"\x1b[F",
+        KeyCode::Insert => b"\x1b[2~",
+        KeyCode::Delete => b"\x1b[3~",
+        KeyCode::PageUp => b"\x1b[5~",
+        KeyCode::PageDown => b"\x1b[6~",
+        KeyCode::F(n @ 1..=4) => return Some(vec![0x1b, b'O', b'P' + n - 1]),
+        KeyCode::F(n @ 5..=12) => {
+            let code = [15, 17, 18, 19, 20, 21, 23, 24][n as usize - 5];
+            return Some(format!("\x1b[{code}~").into_bytes());
+        }
+        KeyCode::F(_) => return None,
+    };
+    Some(input.to_vec())
+}
+
+fn line_to_string(line: &[char]) -> String {
+    let mut s = line.iter().filter(|&&c| c != WIDE).collect::<String>();
+    s.truncate(s.trim_end_matches(BLANK).len());
+    s
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[track_caller]
+    fn check(rows: usize, cols: usize, output: &[u8], expected: &str, cursor: (usize, usize)) {
+        let mut term = Terminal::new(rows, cols);
+        term.advance(output);
+        let (text, point) = term.render();
+        assert_eq!(text, expected);
+        assert_eq!(point, Point::from(cursor));
+    }
+
+    #[test]
+    fn terminal_print() {
+        check(3, 10, b"hello\r\nworld", "hello\nworld\n", (1, 5));
+        check(3, 10, b"abc\x08\x08x", "axc\n", (0, 2));
+        check(3, 10, b"a\tb", "a       b\n", (0, 9));
+        // Blanks before the cursor are kept.
+        check(3, 10, b"a   ", "a   \n", (0, 4));
+        check(3, 10, "日本".as_bytes(), "日本\n", (0, 6));
+        check(3, 10, b"\xff", "\u{fffd}\n", (0, 3));
+    }
+
+    #[test]
+    fn terminal_wrap_and_scrollback() {
+        check(2, 4, b"abcdef", "abcd\nef\n", (1, 2));
+        // The cursor stays on the last column until the next character is written.
+        check(2, 4, b"abcd", "abcd\n", (0, 3));
+        check(2, 4, b"1\r\n2\r\n3\r\n4", "1\n2\n3\n4\n", (3, 1));
+
+        let mut term = Terminal::new(2, 4);
+        for _ in 0..SCROLLBACK + 10 {
+            term.advance(b"x\r\n");
+        }
+        assert_eq!(term.scrollback.len(), SCROLLBACK);
+    }
+
+    #[test]
+    fn terminal_escape_sequences() {
+        check(3, 10, b"hello\x1b[2D\x1b[K", "hel\n", (0, 3));
+        check(3, 10, b"hello\x1b[1;2Hi", "hillo\n", (0, 2));
+        check(3, 10, b"abc\r\ndef\x1b[2J\x1b[H", "\n", (0, 0));
+        check(3, 10, b"abcdef\x1b[1;3H\x1b[2P", "abef\n", (0, 2));
+        check(3, 10, b"abc\x1b[1;2H\x1b[2@", "a  bc\n", (0, 1));
+        // Styling and titles are ignored.
+        check(3, 10, b"\x1b[1;31mred\x1b[0m\x1b]0;title\x07!", "red!\n", (0, 4));
+        check(3, 10, b"\x1b]0;title\x1b\\\x1b(Bok", "ok\n", (0, 2));
+        // The alternate screen is discarded when it's left.
+        check(3, 10, b"main\x1b[?1049hfull\x1b[?1049l", "main\n", (0, 4));
+    }
+
+    #[test]
+    fn terminal_huge_counts() {
+        // Counts are clamped to the screen rather than overflowing.
+        let max = usize::MAX;
+        check(3, 10, format!("ab\x1b[{max}C").as_bytes(), "ab       \n", (0, 9));
+        check(3, 10, format!("ab\x1b[{max}a").as_bytes(), "ab       \n", (0, 9));
+        check(3, 10, format!("ab\x1b[{max}B").as_bytes(), "ab\n\n  \n", (2, 2));
+        check(3, 10, format!("ab\x1b[{max}e").as_bytes(), "ab\n\n  \n", (2, 2));
+        check(3, 10, format!("ab\x1b[{max}E").as_bytes(), "ab\n\n\n", (2, 0));
+        check(3, 10, format!("abc\x1b[1;2H\x1b[{max}X").as_bytes(), "a\n", (0, 1));
+        check(3, 10, format!("abc\x1b[1;2H\x1b[{max}P").as_bytes(), "a\n", (0, 1));
+    }
+
+    #[test]
+    fn terminal_split_utf8() {
+        let mut term = Terminal::new(3, 10);
+        let bytes = "é".as_bytes();
+        term.advance(&bytes[..1]);
+        term.advance(&bytes[1..]);
+        assert_eq!(term.render().0, "é\n");
+    }
+
+    #[test]
+    fn terminal_replies() {
+        let mut term = Terminal::new(3, 10);
+        term.advance(b"ab\x1b[6n");
+        assert_eq!(term.take_replies(), b"\x1b[1;3R");
+        assert!(term.take_replies().is_empty());
+    }
+
+    #[test]
+    fn terminal_encode_key() {
+        let encode = |key: &str| encode_key(&key.parse().unwrap());
+        assert_eq!(encode("a").as_deref(), Some(&b"a"[..]));
+        assert_eq!(encode("<C-c>").as_deref(), Some(&[0x03][..]));
+        assert_eq!(encode("<A-x>").as_deref(), Some(&b"\x1bx"[..]));
+        assert_eq!(encode("<CR>").as_deref(), Some(&b"\r"[..]));
+        assert_eq!(encode("<BS>").as_deref(), Some(&[0x7f][..]));
+        assert_eq!(encode("<Up>").as_deref(), Some(&b"\x1b[A"[..]));
+        assert_eq!(encode_key(&KeyCode::Char('é').into()).as_deref(), Some("é".as_bytes()));
+    }
+
+    #[test]
+    fn terminal_resize() {
+        let mut term = Terminal::new(3, 4);
+        term.advance(b"a\r\nb\r\nc");
+        term.resize(2, 2);
+        assert_eq!(term.render(), ("a\nb\nc\n".to_string(), Point::new(2, 1)));
+        assert_eq!(term.size(), (2, 2));
+    }
+}
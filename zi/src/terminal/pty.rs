@@ -0,0 +1,118 @@
+use std::fs::File;
+use std::io::{self, Write as _};
+use std::os::fd::{AsRawFd as _, FromRawFd as _, OwnedFd, RawFd};
+use std::os::unix::process::CommandExt as _;
+use std::process::{Child, Command, ExitStatus};
+use std::{env, ptr};
+
+/// A process running in a pseudo terminal, it is killed when this is dropped.
+pub(crate) struct Pty {
+    master: File,
+    child: Child,
+}
+
+impl Pty {
+    /// Run the command with `sh -c`, or the user's shell if there is no command.
+    pub fn spawn(command: Option<&str>, rows: u16, cols: u16) -> io::Result<Self> {
+        let (master, slave) = openpty(rows, cols)?;
+
+        let mut cmd = match command {
+            Some(command) => {
+                let mut cmd = Command::new("sh");
+                cmd.arg("-c").arg(command);
+                cmd
+            }
+            None => Command::new(env::var_os("SHELL").unwrap_or_else(|| "sh".into())),
+        };
+
+        cmd.stdin(slave.try_clone()?)
+            .stdout(slave.try_clone()?)
+            .stderr(slave)
+            .env("TERM", "xterm-256color")
+            .env_remove("COLUMNS")
+            .env_remove("LINES");
+
+        // SAFETY: only async-signal-safe functions are called between the fork and the exec.
+        unsafe {
+            cmd.pre_exec(|| {
+                // The child has to lead a new session to make the pty its controlling terminal.
+                if libc::setsid() == -1 || libc::ioctl(0, libc::TIOCSCTTY as _, 0) == -1 {
+                    return Err(io::Error::last_os_error());
+                }
+                Ok(())
+            });
+        }
+
+        let child = cmd.spawn()?;
+        // Our copies of the slave must be closed for reads of the master to end when the child exits.
+        drop(cmd);
+
+        Ok(Self { master: File::from(master), child })
+    }
+
+    /// A handle to read the output of the process, reads fail once the process has exited.
+    pub fn reader(&self) -> io::Result<File> {
+        self.master.try_clone()
+    }
+
+    pub fn write(&mut self, input: &[u8]) -> io::Result<()> {
+        self.master.write_all(input)
+    }
+
+    /// Set the size of the terminal, the kernel sends `SIGWINCH` to the foreground process group.
+    pub fn resize(&self, rows: u16, cols: u16) -> io::Result<()> {
+        let size = winsize(rows, cols);
+        // SAFETY: the fd is valid for the lifetime of `self`.
+        if unsafe { libc::ioctl(self.master.as_raw_fd(), libc::TIOCSWINSZ as _, &size) } == -1 {
+            return Err(io::Error::last_os_error());
+        }
+        Ok(())
+    }
+
+    pub fn try_wait(&mut self) -> io::Result<Option<ExitStatus>> {
+        self.child.try_wait()
+    }
+
+    /// Hang up the session and kill the process if it's still running.
+    pub fn kill(&mut self) {
+        if let Ok(Some(_)) = self.child.try_wait() {
+            return;
+        }
+
+        // The child leads its own process group, so this hangs up anything the shell is running too.
+        // SAFETY: the child hasn't been reaped so the pid can't have been reused.
+        unsafe { libc::kill(-(self.child.id() as libc::pid_t), libc::SIGHUP) };
+        let _ = self.child.kill();
+        let _ = self.child.wait();
+    }
+}
+
+impl Drop for Pty {
+    fn drop(&mut self) {
+        self.kill();
+    }
+}
+
+fn winsize(rows: u16, cols: u16) -> libc::winsize {
+    libc::winsize { ws_row: rows, ws_col: cols, ws_xpixel: 0, ws_ypixel: 0 }
+}
+
+fn openpty(rows: u16, cols: u16) -> io::Result<(OwnedFd, OwnedFd)> {
+    let (mut master, mut slave): (RawFd, RawFd) = (-1, -1);
+    let mut size = winsize(rows, cols);
+    // SAFETY: the name and terminal attributes are optional, the fds are ours once it succeeds.
+    unsafe {
+        if libc::openpty(&mut master, &mut slave, ptr::null_mut(), ptr::null_mut(), &raw mut size)
+            == -1
+        {
+            return Err(io::Error::last_os_error());
+        }
+
+        let (master, slave) = (OwnedFd::from_raw_fd(master), OwnedFd::from_raw_fd(slave));
+        // The child only gets the slave as its stdio, neither should leak into it or any other process.
+        for fd in [master.as_raw_fd(), slave.as_raw_fd()] {
+            libc::fcntl(fd, libc::F_SETFD, libc::FD_CLOEXEC);
+        }
+        Ok((master, slave))
+    }
+}
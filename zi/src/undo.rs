@@ -1,42 +1,153 @@
-// Just an undo stack for now
+use std::fmt;
+use std::time::Instant;
+
+/// A tree of revisions where each edit creates a new node as a child of the current one.
+/// Undoing and then making a new edit starts a new branch rather than discarding the undone revisions.
 #[derive(Debug)]
 pub(crate) struct UndoTree<T> {
     // TODO depth limit
-    revisions: Vec<T>,
+    /// `nodes[0]` is the root representing the original state and has no item.
+    /// The index of a node is its sequence number, so nodes are ordered by the time they were created.
+    nodes: Vec<Node<T>>,
     current: usize,
 }
 
+#[derive(Debug)]
+struct Node<T> {
+    item: Option<T>,
+    parent: usize,
+    /// The child that `redo` moves to, the most recently created or visited one.
+    redo: Option<usize>,
+    children: Vec<usize>,
+    time: Instant,
+}
+
+impl<T> Node<T> {
+    fn new(item: Option<T>, parent: usize) -> Self {
+        Self { item, parent, redo: None, children: vec![], time: Instant::now() }
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum UndoStep<T> {
+    Undo(T),
+    Redo(T),
+}
+
+impl<T> UndoStep<T> {
+    pub fn map<U>(self, f: impl FnOnce(T) -> U) -> UndoStep<U> {
+        match self {
+            UndoStep::Undo(item) => UndoStep::Undo(f(item)),
+            UndoStep::Redo(item) => UndoStep::Redo(f(item)),
+        }
+    }
+}
+
 impl<T> UndoTree<T> {
     pub fn push(&mut self, item: T) {
-        self.revisions.truncate(self.current);
-        self.revisions.push(item);
-        self.current += 1;
+        let seq = self.nodes.len();
+        self.nodes.push(Node::new(Some(item), self.current));
+        let parent = &mut self.nodes[self.current];
+        parent.children.push(seq);
+        parent.redo = Some(seq);
+        self.current = seq;
     }
 
+    /// Move to the parent of the current revision.
     pub fn undo(&mut self) -> Option<&T> {
-        self.current = self.current.checked_sub(1)?;
-        self.revisions.get(self.current)
+        if self.current == 0 {
+            return None;
+        }
+
+        let seq = self.current;
+        self.current = self.nodes[seq].parent;
+        self.nodes[self.current].redo = Some(seq);
+        self.nodes[seq].item.as_ref()
     }
 
+    /// Move to the most recent child of the current revision.
     pub fn redo(&mut self) -> Option<&T> {
-        if self.current < self.revisions.len() {
-            let rev = self.revisions.get(self.current);
-            self.current += 1;
-            rev
-        } else {
-            None
+        self.current = self.nodes[self.current].redo?;
+        self.nodes[self.current].item.as_ref()
+    }
+
+    /// Move `count` revisions back in time, regardless of which branch they are on.
+    pub fn earlier(&mut self, count: usize) -> Vec<UndoStep<&T>> {
+        self.goto(self.current.saturating_sub(count))
+    }
+
+    /// Move `count` revisions forward in time, regardless of which branch they are on.
+    pub fn later(&mut self, count: usize) -> Vec<UndoStep<&T>> {
+        self.goto(self.current.saturating_add(count).min(self.nodes.len() - 1))
+    }
+
+    /// Move to the revision with the given sequence number.
+    /// Returns the items to undo and redo to get there, in the order they must be applied.
+    fn goto(&mut self, target: usize) -> Vec<UndoStep<&T>> {
+        let path_to_root = |mut seq: usize| {
+            let mut path = vec![seq];
+            while seq != 0 {
+                seq = self.nodes[seq].parent;
+                path.push(seq);
+            }
+            path
+        };
+
+        let mut ups = path_to_root(self.current);
+        let mut downs = path_to_root(target);
+        // Strip the common ancestors, leaving the lowest common ancestor at the end of one of the paths.
+        while ups.len() > 1 && downs.len() > 1 && ups[ups.len() - 2] == downs[downs.len() - 2] {
+            ups.pop();
+            downs.pop();
         }
+        ups.pop();
+        downs.pop();
+        downs.reverse();
+
+        // Make `redo` retrace the revisions we undo and then follow the branch we're moving to.
+        for &seq in &ups {
+            let parent = self.nodes[seq].parent;
+            self.nodes[parent].redo = Some(seq);
+        }
+        let mut parent = downs.first().map_or(target, |&seq| self.nodes[seq].parent);
+        for &seq in &downs {
+            self.nodes[parent].redo = Some(seq);
+            parent = seq;
+        }
+        self.current = target;
+
+        let item = |seq: usize| self.nodes[seq].item.as_ref().expect("only the root has no item");
+        ups.iter()
+            .map(|&seq| UndoStep::Undo(item(seq)))
+            .chain(downs.iter().map(|&seq| UndoStep::Redo(item(seq))))
+            .collect()
     }
 
     pub fn clear(&mut self) {
-        self.revisions.clear();
-        self.current = 0;
+        *self = Self::default();
     }
 }
 
 impl<T> Default for UndoTree<T> {
     fn default() -> Self {
-        Self { revisions: Default::default(), current: 0 }
+        Self { nodes: vec![Node::new(None, 0)], current: 0 }
+    }
+}
+
+/// Renders the tree with one revision per line, children are indented under their parent.
+/// The current revision is marked with a `*`.
+impl<T> fmt::Display for UndoTree<T> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let now = Instant::now();
+        let mut stack = vec![(0, 0)];
+        while let Some((seq, depth)) = stack.pop() {
+            let node = &self.nodes[seq];
+            let marker = if seq == self.current { "*" } else { " " };
+            let age = now.duration_since(node.time).as_secs();
+            writeln!(f, "{marker}{:indent$}{seq} ({age}s ago)", "", indent = depth * 2)?;
+            stack.extend(node.children.iter().rev().map(|&child| (child, depth + 1)));
+        }
+        Ok(())
     }
 }
 
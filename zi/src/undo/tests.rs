@@ -7,8 +7,64 @@ fn test_undo_tree() {
     t.push(1);
     assert_eq!(t.undo(), Some(&1));
     assert_eq!(t.undo(), Some(&0));
+    assert_eq!(t.undo(), None);
 
     assert_eq!(t.redo(), Some(&0));
     assert_eq!(t.redo(), Some(&1));
     assert_eq!(t.redo(), None);
 }
+
+#[test]
+fn undo_tree_branch() {
+    let mut t = UndoTree::default();
+    t.push(0);
+    t.push(1);
+    assert_eq!(t.undo(), Some(&1));
+    // Start a new branch, the undone revision is kept.
+    t.push(2);
+    assert_eq!(t.redo(), None);
+
+    assert_eq!(t.undo(), Some(&2));
+    // Redo follows the most recent branch.
+    assert_eq!(t.redo(), Some(&2));
+    assert_eq!(t.undo(), Some(&2));
+    assert_eq!(t.undo(), Some(&0));
+    assert_eq!(t.undo(), None);
+}
+
+#[test]
+fn undo_tree_time_travel() {
+    let mut t = UndoTree::default();
+    t.push(0);
+    t.push(1);
+    t.undo();
+    t.push(2);
+
+    // Going back in time from `2` goes to `1` on the other branch.
+    assert_eq!(t.earlier(1), vec![UndoStep::Undo(&2), UndoStep::Redo(&1)]);
+    assert_eq!(t.earlier(1), vec![UndoStep::Undo(&1)]);
+    assert_eq!(t.earlier(5), vec![UndoStep::Undo(&0)]);
+    assert_eq!(t.earlier(1), vec![]);
+
+    assert_eq!(t.later(2), vec![UndoStep::Redo(&0), UndoStep::Redo(&1)]);
+    assert_eq!(t.later(5), vec![UndoStep::Undo(&1), UndoStep::Redo(&2)]);
+    assert_eq!(t.later(1), vec![]);
+
+    // `redo` follows the branch that was last travelled.
+    t.earlier(1);
+    assert_eq!(t.undo(), Some(&1));
+    assert_eq!(t.redo(), Some(&1));
+}
+
+#[test]
+fn undo_tree_display() {
+    let mut t = UndoTree::default();
+    t.push(0);
+    t.push(1);
+    t.undo();
+    t.push(2);
+
+    let s = t.to_string();
+    let lines = s.lines().map(|line| line.split(" (").next().unwrap()).collect::<Vec<_>>();
+    assert_eq!(lines, [" 0", "   1", "     2", "*    3"]);
+}
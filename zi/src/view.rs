@@ -1,14 +1,18 @@
+mod fold;
+
+use std::borrow::Cow;
 use std::cell::Cell;
 
 use slotmap::Key;
 use tui::LineNumberStyle;
+use unicode_segmentation::UnicodeSegmentation;
 use zi_core::{Offset, Size, ViewGroupId, ViewId};
 use zi_text::{self, Text as _, TextSlice};
 
 use crate::buffer::Buffer;
 use crate::config::Setting;
 use crate::editor::{Resource, Selector};
-use crate::{BufferId, Col, Direction, Editor, JumpList, Location, Mode, Point, Url};
+use crate::{BufferId, Col, Direction, Editor, JumpList, ListChars, Location, Mode, Point, Url};
 
 /// View-local configuration
 #[derive(Clone, Debug)]
@@ -16,13 +20,24 @@ pub struct Settings {
     /// The width of the line numbers column including a space between the number and the text
     pub line_number_width: Setting<u8>,
     pub line_number_style: Setting<LineNumberStyle>,
+    /// Show whitespace with the glyphs of `listchars`, `:set list`.
+    pub list: Setting<bool>,
+    pub listchars: Setting<ListChars>,
+    /// The number of rows kept between the cursor and the top and bottom of the view, `:set scrolloff`.
+    pub scrolloff: Setting<usize>,
+    /// Continue lines that are wider than the view on the following rows, `:set wrap`.
+    pub wrap: Setting<bool>,
 }
 
 impl Default for Settings {
     fn default() -> Self {
         Self {
             line_number_width: Setting::new(4),
-            line_number_style: Setting::new(LineNumberStyle::Absolute),
+            line_number_style: Setting::new(LineNumberStyle::default()),
+            list: Setting::new(false),
+            listchars: Setting::new(ListChars::default()),
+            scrolloff: Setting::new(0),
+            wrap: Setting::new(false),
         }
     }
 }
@@ -69,10 +84,13 @@ pub struct View {
     offset: Offset,
     /// The cursor position in the buffer
     cursor: Cursor,
+    /// Any additional cursors sorted by position. These never coincide with the primary cursor or each other.
+    secondary_cursors: Vec<SecondaryCursor>,
     group: Option<ViewGroupId>,
     url: Url,
     jumps: JumpList<Location>,
     settings: Settings,
+    folds: Folds,
 
     /// The actual width of the line numbers column including a space between the number and the text.
     /// This should be at least `config.line_number_width` but can be larger if the line numbers are wider.
@@ -159,6 +177,14 @@ impl Cursor {
     }
 }
 
+/// A secondary cursor and the other end of its selection in visual mode.
+/// The primary cursor's anchor is kept in the visual mode state instead.
+#[derive(Debug, Clone, Copy)]
+struct SecondaryCursor {
+    cursor: Cursor,
+    anchor: Point,
+}
+
 impl View {
     #[inline]
     pub fn id(&self) -> ViewId {
@@ -175,6 +201,16 @@ impl View {
         &self.settings
     }
 
+    #[inline]
+    pub fn folds(&self) -> &Folds {
+        &self.folds
+    }
+
+    #[inline]
+    pub(crate) fn folds_mut(&mut self) -> &mut Folds {
+        &mut self.folds
+    }
+
     #[inline]
     pub fn group(&self) -> Option<ViewGroupId> {
         self.group
@@ -189,6 +225,128 @@ impl View {
         self.cursor.target_col
     }
 
+    /// All cursors in the view, starting with the primary cursor followed by the secondary cursors in order.
+    #[inline]
+    pub fn cursors(&self) -> impl Iterator<Item = Point> + '_ {
+        std::iter::once(self.cursor.point).chain(self.secondary_cursors())
+    }
+
+    #[inline]
+    pub fn secondary_cursors(&self) -> impl Iterator<Item = Point> + '_ {
+        self.secondary_cursors.iter().map(|secondary| secondary.cursor.point)
+    }
+
+    /// The anchor and cursor of each secondary selection in order, only meaningful in visual mode.
+    #[inline]
+    pub(crate) fn secondary_selections(&self) -> impl Iterator<Item = (Point, Point)> + '_ {
+        self.secondary_cursors.iter().map(|secondary| (secondary.anchor, secondary.cursor.point))
+    }
+
+    /// Start the selection of each secondary cursor at the cursor, as entering visual mode does for the primary.
+    pub(crate) fn reset_secondary_anchors(&mut self) {
+        for secondary in &mut self.secondary_cursors {
+            secondary.anchor = secondary.cursor.point;
+        }
+    }
+
+    #[inline]
+    pub(crate) fn clear_secondary_cursors(&mut self) {
+        self.secondary_cursors.clear();
+    }
+
+    /// Replace the secondary cursors, each position is clamped as if it were the primary cursor.
+    /// Cursors that have collapsed onto another cursor are merged.
+    pub(crate) fn set_secondary_cursors(
+        &mut self,
+        mode: Mode,
+        size: impl Into<Size>,
+        buf: &Buffer,
+        cursors: impl IntoIterator<Item = Point>,
+        flags: SetCursorFlags,
+    ) {
+        let size = size.into();
+        self.secondary_cursors.clear();
+        for point in cursors {
+            self.add_cursor(mode, size, buf, point, flags);
+        }
+    }
+
+    /// Replace the secondary selections with the given anchors and cursors, the cursors are clamped as in
+    /// [`View::set_secondary_cursors`].
+    pub(crate) fn set_secondary_selections(
+        &mut self,
+        mode: Mode,
+        size: impl Into<Size>,
+        buf: &Buffer,
+        selections: impl IntoIterator<Item = (Point, Point)>,
+        flags: SetCursorFlags,
+    ) {
+        let size = size.into();
+        self.secondary_cursors.clear();
+        for (anchor, point) in selections {
+            self.add_selection(mode, size, buf, Some(anchor), point, flags);
+        }
+    }
+
+    fn normalize_secondary_cursors(&mut self) {
+        let primary = self.cursor.point;
+        self.secondary_cursors.retain(|secondary| secondary.cursor.point != primary);
+        self.secondary_cursors.sort_by_key(|secondary| secondary.cursor.point);
+        self.secondary_cursors.dedup_by_key(|secondary| secondary.cursor.point);
+    }
+
+    /// Run `f` with each secondary cursor temporarily acting as the primary cursor.
+    /// This allows reusing the cursor movement logic for all cursors.
+    /// The view offset is always determined by the primary cursor.
+    pub(crate) fn for_each_secondary_cursor(&mut self, mut f: impl FnMut(&mut Self)) {
+        if self.secondary_cursors.is_empty() {
+            return;
+        }
+
+        let offset = self.offset;
+        let mut cursors = std::mem::take(&mut self.secondary_cursors);
+        for secondary in &mut cursors {
+            std::mem::swap(&mut self.cursor, &mut secondary.cursor);
+            f(self);
+            std::mem::swap(&mut self.cursor, &mut secondary.cursor);
+        }
+        self.offset = offset;
+        self.secondary_cursors = cursors;
+        self.normalize_secondary_cursors();
+    }
+
+    /// Add a secondary cursor at the given position, the position is clamped as if it were a primary cursor.
+    pub(crate) fn add_cursor(
+        &mut self,
+        mode: Mode,
+        size: impl Into<Size>,
+        buf: &Buffer,
+        pos: Point,
+        flags: SetCursorFlags,
+    ) {
+        self.add_selection(mode, size, buf, None, pos, flags);
+    }
+
+    /// Add a secondary cursor with its selection starting at `anchor`, or at the cursor if there is none.
+    fn add_selection(
+        &mut self,
+        mode: Mode,
+        size: impl Into<Size>,
+        buf: &Buffer,
+        anchor: Option<Point>,
+        pos: Point,
+        flags: SetCursorFlags,
+    ) {
+        let offset = self.offset;
+        let primary = self.cursor;
+        self.set_cursor_linewise(mode, size, buf, pos, flags);
+        let cursor = std::mem::replace(&mut self.cursor, primary);
+        self.offset = offset;
+        let anchor = anchor.unwrap_or(cursor.point);
+        self.secondary_cursors.push(SecondaryCursor { cursor, anchor });
+        self.normalize_secondary_cursors();
+    }
+
     #[inline]
     pub(crate) fn set_group(&mut self, group: ViewGroupId) {
         self.group = Some(group);
@@ -204,7 +362,9 @@ impl View {
         if self.buf != buf {
             self.buf = buf;
             self.cursor = Cursor::default();
+            self.secondary_cursors.clear();
             self.offset = Offset::default();
+            self.folds = Folds::default();
         }
     }
 
@@ -218,21 +378,22 @@ impl View {
         let cursor = self.cursor();
         let size = size.into();
 
-        let line = match alignment {
-            VerticalAlignment::Top => cursor.line(),
-            VerticalAlignment::Center => cursor.line().saturating_sub(size.height as usize / 2),
-            VerticalAlignment::Bottom => {
-                cursor.line().saturating_sub(size.height.saturating_sub(1) as usize)
-            }
+        let scrolloff = self.scrolloff(size);
+        let rows_above = match alignment {
+            VerticalAlignment::Top => scrolloff,
+            VerticalAlignment::Center => size.height as usize / 2,
+            VerticalAlignment::Bottom => (size.height.saturating_sub(1) as usize) - scrolloff,
         };
 
+        let line = self.rows_above(cursor.line(), rows_above);
+
         self.offset = Offset::new(line, 0);
     }
 
     /// Returns the cursor coordinates in the buffer in cells (not characters) relative to the viewport.
     /// For example, '\t' is one character but is 4 cells wide (by default).
     #[inline]
-    pub(crate) fn cursor_viewport_coords(&self, buf: &Buffer) -> (u16, u16) {
+    pub(crate) fn cursor_viewport_coords(&self, buf: &Buffer, size: impl Into<Size>) -> (u16, u16) {
         assert_eq!(buf.id(), self.buf);
         assert!(
             self.offset.line <= self.cursor.point.line(),
@@ -245,15 +406,144 @@ impl View {
             "cursor is to the left of the viewport"
         );
 
+        let width = self.text_width(size.into());
+        let (row, x) = self.cursor_cell(buf, width);
+        let y = self.wrapped_rows_above_cursor(buf, width) + row;
+        (x.try_into().unwrap(), y.try_into().unwrap())
+    }
+
+    /// The row within the cursor's line and the column of the cell the cursor is on.
+    /// The row is always 0 unless `wrap` is set.
+    fn cursor_cell(&self, buf: &Buffer, width: usize) -> (usize, usize) {
         let line_idx = self.cursor.point.line();
+        // A cursor hidden within a closed fold is drawn at the start of the fold's line.
+        if self.folds.row_start(line_idx) != line_idx {
+            return (0, 0);
+        }
+
         let text = buf.text();
-        let line = text.line(line_idx).unwrap_or_else(|| Box::new(""));
-        let byte =
-            line.chars().take(self.cursor.point.col()).map(|c| buf.char_width(c)).sum::<usize>();
-        // TODO need tests for the column adjustment
-        let x = byte - self.offset.col;
-        let y = line_idx - self.offset.line;
-        (x.try_into().unwrap(), y.try_into().unwrap())
+        let line = text.line(line_idx).map_or(Cow::Borrowed(""), |line| line.to_cow());
+        if !*self.settings.wrap.read() {
+            let before = line.get(..self.cursor.point.col()).unwrap_or(&line);
+            let cells = before.graphemes(true).map(|g| buf.grapheme_width(g)).sum::<usize>();
+            // TODO need tests for the column adjustment
+            return (0, cells - self.offset.col);
+        }
+
+        let (graphemes, wrap) = wrap_line(buf, line.trim_end_matches('\n'), width);
+        match graphemes.iter().find(|&&(byte, _)| byte >= self.cursor.point.col()) {
+            Some(&(_, position)) => position,
+            // Past the end of the line the cursor stays on the last row, even if it is full.
+            None => {
+                let (row, col) = wrap.position();
+                (row, col.min(width.saturating_sub(1)))
+            }
+        }
+    }
+
+    /// The number of rows the lines above the cursor take up in the viewport.
+    /// This is the same as [`View::cursor_row`] unless `wrap` is set and some of those lines are wrapped.
+    fn wrapped_rows_above_cursor(&self, buf: &Buffer, width: usize) -> usize {
+        let line = self.folds.row_start(self.cursor.point.line());
+        self.folds
+            .rows(self.offset.line)
+            .take_while(|&row| row < line)
+            .map(|row| self.line_rows(buf, row, width))
+            .sum()
+    }
+
+    /// The number of rows the line displayed on a row takes up, this is only ever more than one if `wrap` is set.
+    fn line_rows(&self, buf: &Buffer, line_idx: usize, width: usize) -> usize {
+        if !*self.settings.wrap.read() {
+            return 1;
+        }
+
+        let text = buf.text();
+        let Some(line) = text.line(line_idx) else { return 1 };
+        wrap_line(buf, line.to_cow().trim_end_matches('\n'), width).1.rows()
+    }
+
+    /// The width of the text in the view, the line numbers take up the rest of it.
+    fn text_width(&self, size: Size) -> usize {
+        (size.width as usize).saturating_sub(self.number_width.get() as usize)
+    }
+
+    /// The row of the viewport the cursor is on, a closed fold takes up a single row.
+    fn cursor_row(&self) -> usize {
+        let line = self.folds.row_start(self.cursor.point.line());
+        self.folds.rows(self.offset.line).take_while(|&row| row < line).count()
+    }
+
+    /// The rows kept between the cursor and the edges of the view.
+    /// Like vim, this is at most half the view so a large `scrolloff` keeps the cursor in the middle.
+    fn scrolloff(&self, size: Size) -> usize {
+        (*self.settings.scrolloff.read()).min(size.height.saturating_sub(1) as usize / 2)
+    }
+
+    /// The line displayed `n` rows above the row of `line`, or the first line if there are fewer rows above.
+    fn rows_above(&self, line: usize, n: usize) -> usize {
+        (0..n)
+            .try_fold(self.folds.row_start(line), |line, _| self.folds.prev_row(line))
+            .unwrap_or(0)
+    }
+
+    /// The inverse of [`View::cursor_viewport_coords`], returns the point of the character in the given cell.
+    /// Cells past the end of a line map to the last character of the line, and cells below the text to the last line.
+    pub(crate) fn viewport_coords_to_point(
+        &self,
+        buf: &Buffer,
+        size: impl Into<Size>,
+        (x, y): (u16, u16),
+    ) -> Point {
+        assert_eq!(buf.id(), self.buf);
+
+        let text = buf.text();
+        let width = self.text_width(size.into());
+        let wrap = *self.settings.wrap.read();
+        // The row within the line that is displayed at `y`.
+        let (line_idx, row) = if wrap {
+            let mut y = y as usize;
+            let mut rows = self.folds.rows(self.offset.line);
+            loop {
+                let line_idx = rows.next().unwrap();
+                let n = self.line_rows(buf, line_idx, width);
+                if y < n {
+                    break (line_idx, y);
+                }
+                y -= n;
+            }
+        } else {
+            (self.folds.rows(self.offset.line).nth(y as usize).unwrap(), 0)
+        };
+        let line_idx = line_idx.min(text.len_lines().saturating_sub(1));
+        let line = text.line(line_idx).map_or(Cow::Borrowed(""), |line| line.to_cow());
+        let line = line.trim_end_matches('\n');
+
+        if wrap {
+            let (graphemes, wrap) = wrap_line(buf, line, width);
+            let target = (row, x as usize);
+            // A click on any cell of a wide character, or past the end of a row it is on, selects that character.
+            return match graphemes.iter().position(|&(_, position)| position > target) {
+                Some(i) => Point::new(line_idx, graphemes[i - 1].0),
+                None if target < wrap.position() => {
+                    Point::new(line_idx, graphemes[graphemes.len() - 1].0)
+                }
+                None => Point::new(line_idx, line.len()),
+            };
+        }
+
+        let target = self.offset.col + x as usize;
+        let mut cells = 0;
+        for (col, g) in line.grapheme_indices(true) {
+            let width = buf.grapheme_width(g);
+            // A click on any cell of a wide character selects that character.
+            if cells + width > target {
+                return Point::new(line_idx, col);
+            }
+            cells += width;
+        }
+
+        Point::new(line_idx, line.len())
     }
 
     /// `amt` is measured in characters or lines depending on the direction.
@@ -268,15 +558,28 @@ impl View {
         assert_eq!(buf.id(), self.buf);
 
         let pos = match direction {
-            Direction::Left => match buf.text().char_before_point(self.cursor.point) {
-                // this is wrong, can't assume all characters are the same width
-                Some(c) => self.cursor.point.left(c.len_utf8() * amt),
-                None => return self.cursor.point,
-            },
-            Direction::Right => match buf.text().char_at_point(self.cursor.point) {
-                Some(c) => self.cursor.point.right(c.len_utf8() * amt),
-                None => return self.cursor.point,
-            },
+            // Horizontal movements move by grapheme clusters within the line.
+            Direction::Left | Direction::Right => {
+                let text = buf.text();
+                let mut byte = text.point_to_byte(self.cursor.point);
+                for _ in 0..amt {
+                    byte = match direction {
+                        Direction::Left => match text.char_before_byte(byte) {
+                            Some(c) if c != '\n' => text.prev_grapheme_boundary(byte),
+                            _ => break,
+                        },
+                        _ => match text.char_at_byte(byte) {
+                            Some(c) if c != '\n' => text.next_grapheme_boundary(byte),
+                            _ => break,
+                        },
+                    };
+                }
+
+                if byte == text.point_to_byte(self.cursor.point) {
+                    return self.cursor.point;
+                }
+                text.byte_to_point(byte)
+            }
             // Horizontal movements set the target column.
             // Vertical movements try to keep moving to the target column.
             Direction::Up => self.cursor.point.up(amt),
@@ -347,7 +650,8 @@ impl View {
             }
         }
 
-        self.ensure_scroll_in_bounds(size);
+        self.ensure_scroll_in_bounds(size, buf);
+        self.normalize_secondary_cursors();
         #[cfg(debug_assertions)]
         std::hint::black_box(text.byte_slice(text.point_to_byte(self.cursor.point)..));
         self.cursor.point
@@ -367,7 +671,7 @@ impl View {
         let size = size.into();
 
         if flags.contains(SetCursorFlags::USE_TARGET_COLUMN) {
-            pos = pos.with_col(self.cursor.target_col);
+            pos = Point::new(self.skip_folds(buf, pos.line()), self.cursor.target_col);
         }
 
         // Check line is in-bounds
@@ -427,6 +731,12 @@ impl View {
             _ => pos.with_col(max_col),
         };
 
+        // The column may be in the middle of a grapheme cluster (e.g. when moving to the target
+        // column on another line) so move it to the start of the cluster.
+        let line_start = text.line_to_byte(line_idx);
+        let new_cursor =
+            new_cursor.with_col(text.grapheme_start(line_start + new_cursor.col()) - line_start);
+
         if self.cursor.target_col != pos.col() && self.cursor.point != new_cursor
             || !flags.contains(SetCursorFlags::NO_FORCE_UPDATE_TARGET)
         {
@@ -440,18 +750,72 @@ impl View {
         #[cfg(debug_assertions)]
         std::hint::black_box(text.byte_slice(text.point_to_byte(self.cursor.point)..));
 
-        self.ensure_scroll_in_bounds(size);
+        self.ensure_scroll_in_bounds(size, buf);
+        self.normalize_secondary_cursors();
 
         self.cursor.point
     }
 
-    fn ensure_scroll_in_bounds(&mut self, size: impl Into<Size>) {
+    /// Vertical movements move over a closed fold as if it were a single line.
+    /// The distance from the cursor to `line` is taken as a number of rows and the line that many rows away is returned.
+    fn skip_folds(&self, buf: &Buffer, line: usize) -> usize {
+        let cursor = self.cursor.point.line();
+        if self.folds.is_empty() || line == cursor {
+            return line;
+        }
+
+        if line < cursor {
+            return self.rows_above(cursor, cursor - line);
+        }
+
+        let text = buf.text();
+        let mut row = cursor;
+        for _ in 0..line - cursor {
+            let next = self.folds.next_row(row);
+            if text.line(next).is_none() {
+                break;
+            }
+            row = next;
+        }
+        row
+    }
+
+    fn ensure_scroll_in_bounds(&mut self, size: impl Into<Size>, buf: &Buffer) {
         let size = size.into();
-        // Scroll the view if the cursor moves out of bounds
-        if self.cursor.point.line() < self.offset.line {
-            self.offset.line = self.cursor.point.line();
-        } else if self.cursor.point.line() >= self.offset.line + size.height as usize {
-            self.offset.line = self.cursor.point.line() - size.height as usize + 1;
+        let height = size.height as usize;
+        let scrolloff = self.scrolloff(size);
+        let line = self.folds.row_start(self.cursor.point.line());
+        // Scroll the view if the cursor moves out of bounds or within `scrolloff` rows of the top
+        let top = self.rows_above(line, scrolloff);
+        if top < self.offset.line {
+            self.offset.line = top;
+            return;
+        }
+
+        // The view isn't scrolled past the end of the text to make room below the last line.
+        let text = buf.text();
+        let below = self
+            .folds
+            .rows(line)
+            .skip(1)
+            .take(scrolloff)
+            .take_while(|&row| text.line(row).is_some())
+            .count();
+        // Only the rows up to the bottom of the view need counting.
+        let rows = self.folds.rows(self.offset.line).take_while(|&row| row < line).take(height);
+        if rows.count() + below >= height {
+            self.offset.line = self.rows_above(line, height.saturating_sub(1 + below));
+        }
+
+        // Wrapped lines take up more than one row each, so it may need to scroll further for the cursor to fit.
+        if *self.settings.wrap.read() {
+            let width = self.text_width(size);
+            let cursor_row = |view: &Self| {
+                view.wrapped_rows_above_cursor(buf, width) + view.cursor_cell(buf, width).0
+            };
+            while self.offset.line < line && cursor_row(self) + below >= height {
+                self.offset.line = self.folds.next_row(self.offset.line);
+            }
         }
     }
 
@@ -465,8 +829,25 @@ impl View {
     ) {
         let size = size.into();
         let prev = self.offset;
+        let row = self.cursor_row();
         // don't need to bounds check the scroll, `move_cursor` handles that
+        let mut rows = 0;
         match direction {
+            // A closed fold is scrolled past as a single line.
+            Direction::Up | Direction::Down if !self.folds.is_empty() => {
+                let text = buf.text();
+                while rows < amt {
+                    let line = match direction {
+                        Direction::Up => self.folds.prev_row(self.offset.line),
+                        _ => Some(self.folds.next_row(self.offset.line))
+                            .filter(|&line| text.line(line).is_some()),
+                    };
+
+                    let Some(line) = line else { break };
+                    self.offset.line = line;
+                    rows += 1;
+                }
+            }
             Direction::Up => self.offset.line = self.offset.line.saturating_sub(amt),
             Direction::Down => self.offset.line = self.offset.line.saturating_add(amt),
             Direction::Left => self.offset.col = self.offset.col.saturating_sub(amt),
@@ -475,16 +856,29 @@ impl View {
 
         // Move the cursor the same amount to match.
         let amt = match direction {
+            Direction::Up | Direction::Down if !self.folds.is_empty() => rows,
             Direction::Up => prev.line - self.offset.line,
             Direction::Down => self.offset.line - prev.line,
             Direction::Left => prev.col - self.offset.col,
             Direction::Right => self.offset.col - prev.col,
         };
 
+        // The cursor keeps its row unless that is within `scrolloff` rows of the edge the view scrolled towards,
+        // e.g. a cursor on the first line moves down with the view rather than the view being scrolled back.
+        let scrolloff = self.scrolloff(size);
+        let amt = match direction {
+            Direction::Down if amt > 0 => amt.saturating_add(scrolloff.saturating_sub(row)),
+            Direction::Up if amt > 0 => {
+                let rows_below = (size.height.saturating_sub(1) as usize).saturating_sub(row);
+                amt.saturating_add(scrolloff.saturating_sub(rows_below))
+            }
+            _ => amt,
+        };
+
         self.move_cursor(mode, size, buf, direction, amt);
         assert!(
-            self.cursor.point.line() >= self.offset.line
-                && self.cursor.point.line() < self.offset.line + size.height as usize,
+            self.folds.row_start(self.cursor.point.line()) >= self.offset.line
+                && self.cursor_row() < size.height as usize,
             "cursor is out of bounds: cursor={} offset={} size={size}",
             self.cursor.point,
             self.offset,
@@ -496,6 +890,12 @@ impl View {
         self.offset
     }
 
+    /// Scroll to the offset, the caller is expected to set the cursor after to bring it back into view.
+    #[inline]
+    pub(crate) fn set_offset(&mut self, offset: Offset) {
+        self.offset = offset;
+    }
+
     pub(crate) fn new(id: ViewId, buf: BufferId) -> Self {
         Self {
             id,
@@ -505,8 +905,10 @@ impl View {
             settings: Default::default(),
             group: Default::default(),
             cursor: Default::default(),
+            secondary_cursors: Default::default(),
             offset: Default::default(),
             jumps: Default::default(),
+            folds: Default::default(),
         }
     }
 
@@ -528,3 +930,26 @@ impl View {
 }
 
 impl View {}
+
+/// Wrap a line at `width` cells as `tui::Lines` does, returning the byte index of each grapheme with the row
+/// and column of its first cell. A tab is expanded to spaces first, so it may be split across rows.
+fn wrap_line(buf: &Buffer, line: &str, width: usize) -> (Vec<(usize, (usize, usize))>, tui::Wrap) {
+    let mut wrap = tui::Wrap::new(width);
+    let graphemes = line
+        .grapheme_indices(true)
+        .map(|(i, grapheme)| {
+            let cells = buf.grapheme_width(grapheme);
+            match grapheme {
+                "\t" => {
+                    let start = wrap.place(cells.min(1));
+                    for _ in 1..cells {
+                        wrap.place(1);
+                    }
+                    (i, start)
+                }
+                _ => (i, wrap.place(cells)),
+            }
+        })
+        .collect::<Vec<_>>();
+    (graphemes, wrap)
+}
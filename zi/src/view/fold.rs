@@ -0,0 +1,226 @@
+use std::ops::RangeInclusive;
+
+use zi_text::{AnyText, Deltas, Text as _, TextSlice as _};
+
+/// Where a fold came from.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum FoldKind {
+    /// Created with `zf`.
+    Manual,
+    /// A node of the syntax tree (e.g. a function or a block).
+    Syntax,
+}
+
+/// A range of lines that can be collapsed into a single line.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Fold {
+    /// The first and last line of the fold (inclusive), a fold always spans at least two lines.
+    start: usize,
+    end: usize,
+    closed: bool,
+    kind: FoldKind,
+}
+
+impl Fold {
+    #[inline]
+    pub fn lines(&self) -> RangeInclusive<usize> {
+        self.start..=self.end
+    }
+
+    #[inline]
+    pub fn is_closed(&self) -> bool {
+        self.closed
+    }
+
+    #[inline]
+    pub fn kind(&self) -> FoldKind {
+        self.kind
+    }
+
+    #[inline]
+    fn contains(&self, line: usize) -> bool {
+        self.lines().contains(&line)
+    }
+
+    #[inline]
+    fn len(&self) -> usize {
+        self.end - self.start
+    }
+}
+
+/// The folds of a view, these are per view rather than per buffer so each view can fold the buffer differently.
+/// Folds may nest, a closed fold hides everything within it regardless of the state of the folds inside it.
+#[derive(Debug, Clone, Default)]
+pub struct Folds {
+    /// Sorted by start line ascending and then by end line descending, so outer folds precede the folds within them.
+    folds: Vec<Fold>,
+}
+
+impl Folds {
+    #[inline]
+    pub fn iter(&self) -> impl ExactSizeIterator<Item = &Fold> {
+        self.folds.iter()
+    }
+
+    #[inline]
+    pub fn is_empty(&self) -> bool {
+        self.folds.is_empty()
+    }
+
+    /// Add a closed fold over the lines, an existing fold over the same lines is replaced.
+    /// Returns `false` if the range is a single line as there is nothing to fold.
+    pub(crate) fn add(&mut self, lines: RangeInclusive<usize>, kind: FoldKind) -> bool {
+        let (start, end) = lines.into_inner();
+        if end <= start {
+            return false;
+        }
+
+        self.folds.retain(|fold| fold.lines() != (start..=end));
+        self.folds.push(Fold { start, end, closed: true, kind });
+        self.sort();
+        true
+    }
+
+    /// Replace the syntax folds with the given ranges.
+    /// Folds over the same lines as before stay closed, so refreshing the folds doesn't open them.
+    pub(crate) fn set_syntax(&mut self, ranges: impl IntoIterator<Item = RangeInclusive<usize>>) {
+        let (syntax, manual) = std::mem::take(&mut self.folds)
+            .into_iter()
+            .partition::<Vec<_>, _>(|fold| fold.kind == FoldKind::Syntax);
+
+        self.folds = manual;
+        for range in ranges {
+            let (start, end) = range.into_inner();
+            if end <= start || self.folds.iter().any(|fold| fold.lines() == (start..=end)) {
+                continue;
+            }
+
+            let closed = syntax.iter().any(|fold| fold.lines() == (start..=end) && fold.closed);
+            self.folds.push(Fold { start, end, closed, kind: FoldKind::Syntax });
+        }
+        self.sort();
+    }
+
+    /// Open the closed fold the line is hidden by, otherwise close the innermost fold containing the line.
+    /// Returns `false` if there is no fold containing the line.
+    pub(crate) fn toggle(&mut self, line: usize) -> bool {
+        // Of the closed folds containing the line, open the outermost as that's the one being displayed.
+        if let Some(fold) = self
+            .folds
+            .iter_mut()
+            .filter(|fold| fold.closed && fold.contains(line))
+            .max_by_key(|fold| fold.len())
+        {
+            fold.closed = false;
+            return true;
+        }
+
+        match self.folds.iter_mut().filter(|fold| fold.contains(line)).min_by_key(|fold| fold.len())
+        {
+            Some(fold) => {
+                fold.closed = true;
+                true
+            }
+            None => false,
+        }
+    }
+
+    pub(crate) fn open_all(&mut self) {
+        self.folds.iter_mut().for_each(|fold| fold.closed = false);
+    }
+
+    pub(crate) fn close_all(&mut self) {
+        self.folds.iter_mut().for_each(|fold| fold.closed = true);
+    }
+
+    /// The lines hidden by the closed folds containing `line` (inclusive), this includes the first line
+    /// of the folded range which is displayed in place of the entire range.
+    /// Overlapping closed folds are merged into one range.
+    pub fn closed_at(&self, line: usize) -> Option<RangeInclusive<usize>> {
+        // Folds are sorted by start, so the overlapping closed folds can be merged in one pass.
+        let mut merged: Option<(usize, usize)> = None;
+        for fold in self.folds.iter().filter(|fold| fold.closed) {
+            match &mut merged {
+                Some((_, end)) if fold.start <= *end => *end = (*end).max(fold.end),
+                Some((start, end)) if (*start..=*end).contains(&line) => break,
+                _ if fold.start > line => break,
+                _ => merged = Some((fold.start, fold.end)),
+            }
+        }
+
+        merged.filter(|&(start, end)| (start..=end).contains(&line)).map(|(start, end)| start..=end)
+    }
+
+    /// The line displayed on the row that `line` is on, i.e. the first line of the closed fold containing it.
+    #[inline]
+    pub fn row_start(&self, line: usize) -> usize {
+        self.closed_at(line).map_or(line, |range| *range.start())
+    }
+
+    /// The line displayed on the row after the row that `line` is on.
+    #[inline]
+    pub fn next_row(&self, line: usize) -> usize {
+        self.closed_at(line).map_or(line, |range| *range.end()) + 1
+    }
+
+    /// The line displayed on the row before the row that `line` is on.
+    #[inline]
+    pub fn prev_row(&self, line: usize) -> Option<usize> {
+        self.row_start(line).checked_sub(1).map(|line| self.row_start(line))
+    }
+
+    /// The lines displayed on each row starting from the row `line` is on.
+    /// This is unbounded, the caller is responsible for stopping at the end of the text.
+    pub fn rows(&self, line: usize) -> impl Iterator<Item = usize> + '_ {
+        std::iter::successors(Some(self.row_start(line)), |&line| Some(self.next_row(line)))
+    }
+
+    /// Adjust the folds for the deltas, `text` is the text before the deltas were applied.
+    /// Edits above a fold move it, edits within a fold grow or shrink it, and a fold is removed if an edit
+    /// crosses one of its boundaries or the fold no longer spans more than one line.
+    pub(crate) fn edit(&mut self, text: &dyn AnyText, deltas: &Deltas<'_>) {
+        if self.folds.is_empty() {
+            return;
+        }
+
+        // The change in the number of lines for each delta, along with its range in the old text.
+        let shifts = deltas
+            .iter()
+            .map(|delta| {
+                let removed = text.byte_slice(delta.range()).chars().filter(|&c| c == '\n').count();
+                let added = delta.text().matches('\n').count();
+                (delta.range(), added as isize - removed as isize)
+            })
+            .collect::<Vec<_>>();
+
+        let len = text.len_bytes();
+        self.folds.retain_mut(|fold| {
+            let Some(start_byte) = text.try_line_to_byte(fold.start) else { return false };
+            let end_byte = text.try_line_to_byte(fold.end + 1).unwrap_or(len);
+            let (mut start, mut end) = (fold.start as isize, fold.end as isize);
+            for (range, shift) in &shifts {
+                if range.end <= start_byte {
+                    start += shift;
+                    end += shift;
+                } else if range.start >= end_byte {
+                    continue;
+                } else if range.start >= start_byte && (range.end < end_byte || range.end == len) {
+                    // Reaching `end_byte` would remove the newline ending the fold and join the next line into it.
+                    end += shift;
+                } else {
+                    return false;
+                }
+            }
+
+            fold.start = start as usize;
+            fold.end = end as usize;
+            end > start
+        });
+        self.sort();
+        self.folds.dedup_by(|a, b| a.lines() == b.lines());
+    }
+
+    fn sort(&mut self) {
+        self.folds.sort_by_key(|fold| (fold.start, std::cmp::Reverse(fold.end)));
+    }
+}
@@ -1,17 +1,44 @@
+mod abbrev;
+mod autoreload;
 mod command;
+mod comment;
 mod completion;
 mod config;
+mod count;
 mod cursor;
+mod diagnostics;
+mod digraph;
 mod dot;
 mod edit;
+mod encoding;
+mod fileformat;
+mod filter;
+mod fold;
+mod format;
+mod git;
+mod indent;
+mod macros;
 mod marks;
+mod matchit;
 mod motion;
+mod multicursor;
 mod open;
+mod paste;
 mod picker;
+mod quickfix;
+mod register;
 mod save;
 mod scroll;
 mod search;
+mod session;
+mod snippet;
+mod sort;
+mod substitute;
+mod surround;
 mod tab;
+#[cfg(unix)]
+mod terminal;
+mod theme;
 mod undo;
 mod view;
 mod visual;
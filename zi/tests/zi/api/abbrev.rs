@@ -0,0 +1,103 @@
+use zi::Active;
+
+use crate::new;
+
+#[tokio::test]
+async fn abbrev_expand() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        editor.execute("iabbrev teh the").unwrap();
+        editor.input("iteh<space>teh.<ESC>").unwrap();
+        // The character typed after the abbreviation is kept.
+        assert_eq!(editor.text(Active).to_string(), "the the.\n");
+
+        // The expansions are undone along with the rest of the insert.
+        editor.input("u").unwrap();
+        assert_eq!(editor.cursor_line(), "");
+
+        editor.input("iteh<CR>x<ESC>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "the\nx\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn abbrev_not_expanded() {
+    let cx = new("foo teh").await;
+
+    cx.with(|editor| {
+        editor.execute("iab teh the").unwrap();
+        // The trigger at the end of a longer word isn't an abbreviation.
+        editor.input("Ostehteh<space><ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "stehteh ");
+
+        // Nor is the start of one, nothing is expanded until the word ends.
+        editor.input("cctehs<space>tehteh!<ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "tehs tehteh!");
+
+        // `<C-v>` inserts the character after the trigger without expanding it.
+        editor.input("cczteh<C-v><space><ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "zteh ");
+        editor.input("ccteh<C-v><space><ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "teh ");
+
+        // Only words typed in the insert are expanded, not text that was already there.
+        editor.input("jA<space><ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "foo teh ");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn abbrev_filetype() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        let ft = editor.buffer(Active).file_type();
+        editor.add_abbreviation(None, "sig", "regards").unwrap();
+        editor.add_abbreviation(Some(ft), "sig", "cheers").unwrap();
+        editor.add_abbreviation(Some(zi::filetype!(rust)), "fm", "fn main() {}").unwrap();
+
+        // The abbreviations of the buffer's file type take precedence.
+        editor.input("isig<space>fm<space><ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "cheers fm ");
+
+        assert!(editor.add_abbreviation(None, "two words", "x").is_err());
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn abbrev_config() -> zi::Result<()> {
+    let cx = new("").await;
+    let ft = cx.with(|editor| editor.buffer(Active).file_type()).await;
+    let path = cx.tempfile(&format!(
+        r#"
+[abbreviations]
+teh = "the"
+
+[abbreviations.{ft}]
+sig = "cheers"
+
+[abbreviations.rust]
+teh = "rust"
+"#
+    ))?;
+
+    cx.with(move |editor| {
+        editor.load_config(path).unwrap();
+        editor.input("iteh<space>sig<space><ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "the cheers ");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
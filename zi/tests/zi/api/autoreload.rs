@@ -0,0 +1,133 @@
+use std::time::Duration;
+
+use zi::{Active, BufferId, OpenFlags};
+use zi_test::TestContext;
+
+use crate::new;
+
+/// Wait for the file watcher to pick up the change.
+async fn wait_until(
+    cx: &TestContext,
+    f: impl Fn(&mut zi::Editor) -> bool + Clone + Send + 'static,
+) {
+    for _ in 0..200 {
+        if cx.with(f.clone()).await {
+            return;
+        }
+        tokio::time::sleep(Duration::from_millis(10)).await;
+    }
+    panic!("timed out waiting for the file watcher")
+}
+
+async fn wait_for_text(cx: &TestContext, buf: BufferId, expected: &'static str) {
+    wait_until(cx, move |editor| editor.text(buf).to_string() == expected).await
+}
+
+#[tokio::test]
+async fn autoreload_unmodified_buffer() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempdir()?.join("a.txt");
+    std::fs::write(&path, "a\nb\nc\nd\n")?;
+    let buf = cx.open(&path, OpenFlags::empty()).await?;
+    cx.with(|editor| editor.set_cursor(Active, (2, 0))).await;
+
+    std::fs::write(&path, "a\nb\nchanged\nd\n")?;
+    wait_for_text(&cx, buf, "a\nb\nchanged\nd\n").await;
+    cx.with(|editor| {
+        assert_eq!(editor.cursor(Active), (2, 0));
+        assert!(editor.get_error().is_none());
+    })
+    .await;
+
+    // Editors tend to write to a temporary file and rename it over the original.
+    let tmp = path.with_file_name(".a.txt.tmp");
+    std::fs::write(&tmp, "a\n")?;
+    std::fs::rename(&tmp, &path)?;
+    wait_for_text(&cx, buf, "a\n").await;
+    // The cursor is kept in bounds of the shorter text.
+    cx.with(|editor| assert_eq!(editor.cursor(Active), (0, 0))).await;
+
+    // Our own writes aren't mistaken for changes.
+    cx.with(|editor| editor.input("ix<Esc>").unwrap()).await;
+    cx.with(|editor| editor.save(Active, zi::SaveFlags::empty())).await.await?;
+    tokio::time::sleep(Duration::from_millis(200)).await;
+    cx.with(|editor| {
+        assert_eq!(editor.text(Active).to_string(), "xa\n");
+        assert!(editor.get_error().is_none());
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn autoreload_keeps_scroll_position() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempdir()?.join("a.txt");
+    let text = (0..30).map(|i| format!("{i}\n")).collect::<String>();
+    std::fs::write(&path, &text)?;
+    let buf = cx.open(&path, OpenFlags::empty()).await?;
+    let cursor = cx
+        .with(|editor| {
+            editor.input("20<C-e>").unwrap();
+            assert_eq!(editor.view(Active).offset(), (20, 0));
+            editor.cursor(Active)
+        })
+        .await;
+
+    std::fs::write(&path, text.replace("25\n", "changed\n"))?;
+    wait_until(&cx, move |editor| editor.text(buf).to_string().contains("changed")).await;
+    cx.with(move |editor| {
+        assert_eq!(editor.view(Active).offset(), (20, 0));
+        assert_eq!(editor.cursor(Active), cursor);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn autoreload_modified_buffer_prompts() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempdir()?.join("a.txt");
+    std::fs::write(&path, "a\n")?;
+    let buf = cx.open(&path, OpenFlags::empty()).await?;
+    cx.with(|editor| editor.input("ix<Esc>").unwrap()).await;
+
+    std::fs::write(&path, "changed\n")?;
+    wait_until(&cx, |editor| {
+        editor.get_message().is_some_and(|msg| msg.contains("changed on disk"))
+    })
+    .await;
+    // Keep the changes.
+    cx.with(|editor| editor.input("n").unwrap()).await;
+    cx.with(move |editor| assert_eq!(editor.text(buf).to_string(), "xa\n")).await;
+
+    std::fs::write(&path, "changed again\n")?;
+    wait_until(&cx, |editor| {
+        editor.get_message().is_some_and(|msg| msg.contains("changed on disk"))
+    })
+    .await;
+    // Throw the changes away.
+    cx.with(|editor| editor.input("y").unwrap()).await;
+    wait_for_text(&cx, buf, "changed again\n").await;
+    cx.with(move |editor| assert!(!editor[buf].flags().contains(zi::BufferFlags::DIRTY))).await;
+
+    // The reload is a single edit, so undoing it gets the changes back.
+    cx.with(move |editor| {
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(buf).to_string(), "xa\n");
+    })
+    .await;
+
+    std::fs::remove_file(&path)?;
+    wait_until(&cx, move |editor| editor.is_deleted_on_disk(buf)).await;
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -28,3 +28,91 @@ async fn cmd_unknown() {
     cx.render().await;
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn cmd_completion_candidates() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let dir = cx.tempdir()?;
+    std::fs::create_dir(dir.join("src"))?;
+    std::fs::write(dir.join("main.rs"), "")?;
+    std::fs::write(dir.join("mod.rs"), "")?;
+    std::fs::write(dir.join(".hidden"), "")?;
+    let dir = dir.display().to_string();
+
+    let a = cx.tempfile("a")?;
+    cx.open(&a, zi::OpenFlags::empty()).await?;
+    let a = a.display().to_string();
+
+    cx.with(move |editor| {
+        let candidates = |input: &str| editor.command_completions(input).1;
+
+        // Aliases complete to the canonical name.
+        assert_eq!(candidates("vs"), ["vsplit"]);
+        assert_eq!(candidates("w"), ["wall", "wq", "write"]);
+        assert!(candidates("").contains(&"quit".to_string()));
+        assert!(candidates("zzz").is_empty());
+
+        assert_eq!(candidates("set cl"), ["clipboard"]);
+        assert_eq!(candidates("set ts"), ["tabstop"]);
+        assert_eq!(candidates("set cb o"), ["osc52"]);
+        assert_eq!(candidates("set numberstyle "), ["absolute", "relative", "hybrid", "none"]);
+        assert!(candidates("set tabstop 4 ").is_empty(), "set only takes two arguments");
+
+        assert_eq!(
+            candidates(&format!("e {dir}/m")),
+            [format!("{dir}/main.rs"), format!("{dir}/mod.rs")]
+        );
+        assert_eq!(
+            candidates(&format!("e {dir}/")),
+            [format!("{dir}/main.rs"), format!("{dir}/mod.rs"), format!("{dir}/src/")]
+        );
+        assert_eq!(candidates(&format!("edit {dir}/.")), [format!("{dir}/.hidden")]);
+
+        assert_eq!(candidates(&format!("b {a}")), [a.clone()]);
+        assert_eq!(editor.command_completions(&format!("b {a}")).0, 2);
+
+        assert_eq!(candidates("config r"), ["reload"]);
+        assert!(candidates("quit ").is_empty());
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn cmd_completion_cycle() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        // A single candidate is accepted straight away, leaving room for the arguments.
+        editor.input(":vs<Tab>").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":vsplit "));
+        editor.input("<ESC>").unwrap();
+
+        editor.input(":set numberstyle <Tab>").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":set numberstyle absolute"));
+        editor.input("<Tab>").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":set numberstyle relative"));
+        editor.input("<S-Tab><S-Tab>").unwrap();
+        assert_eq!(
+            editor.command_buffer(),
+            Some(":set numberstyle "),
+            "cycles back to the typed text"
+        );
+        editor.input("<S-Tab>").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":set numberstyle none"));
+
+        // Typing starts a new completion from the accepted candidate.
+        editor.input("<BS><BS><BS><BS>r<Tab>").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":set numberstyle relative"));
+
+        // Searches don't complete.
+        editor.input("<ESC>/w<Tab>").unwrap();
+        assert_eq!(editor.command_buffer(), Some("/w"));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
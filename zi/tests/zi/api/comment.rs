@@ -0,0 +1,87 @@
+use zi::{Active, Mode, OpenFlags};
+
+use crate::new;
+
+/// Go with a mix of tab and space indentation.
+const SRC: &str = "func main() {\n\tif ok {\n    \t\treturn\n\t}\n\n  x := 1\n}\n";
+
+#[tokio::test]
+async fn toggle_comment() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempdir()?.join("main.go");
+    std::fs::write(&path, SRC)?;
+    cx.open(&path, OpenFlags::empty()).await?;
+
+    cx.with(|editor| {
+        let text = |editor: &zi::Editor| editor.text(Active).to_string();
+
+        editor.set_cursor(Active, (5, 0));
+        editor.input("gcc").unwrap();
+        assert_eq!(
+            text(editor),
+            "func main() {\n\tif ok {\n    \t\treturn\n\t}\n\n  // x := 1\n}\n"
+        );
+        assert_eq!(editor.mode(), Mode::Normal);
+        editor.input("gcc").unwrap();
+        assert_eq!(text(editor), SRC);
+
+        // The comment goes after each line's own indentation.
+        editor.set_cursor(Active, (1, 0));
+        editor.input("gcj").unwrap();
+        assert_eq!(
+            text(editor),
+            "func main() {\n\t// if ok {\n    \t\t// return\n\t}\n\n  x := 1\n}\n"
+        );
+
+        // Partially commented ranges are commented, skipping the blank line.
+        editor.input("ggVGgc").unwrap();
+        assert_eq!(
+            text(editor),
+            "// func main() {\n\t// // if ok {\n    \t\t// // return\n\t// }\n\n  // x := 1\n// }\n"
+        );
+        editor.undo(Active).unwrap();
+
+        editor.set_cursor(Active, (1, 0));
+        editor.input("gcj").unwrap();
+        assert_eq!(text(editor), SRC);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn toggle_block_comment() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempdir()?.join("main.go");
+    std::fs::write(&path, SRC)?;
+    cx.open(&path, OpenFlags::empty()).await?;
+
+    cx.with(|editor| {
+        // A charwise motion uses a block comment, leaving out the trailing whitespace.
+        editor.set_cursor(Active, (5, 2));
+        editor.input("gciw").unwrap();
+        assert_eq!(editor.cursor_line(), "  /* x */ := 1");
+
+        editor.input("vllllllgc").unwrap();
+        assert_eq!(editor.cursor_line(), "  x := 1");
+        assert_eq!(editor.mode(), Mode::Normal);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn toggle_comment_without_syntax() {
+    let cx = new("abc\n").await;
+    cx.with(|editor| {
+        editor.input("gcc").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "abc\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
@@ -120,3 +120,104 @@ async fn tab_completion() -> zi::Result<()> {
     cx.cleanup().await;
     Ok(())
 }
+
+/// Only completes in files named `accept.txt` to not interfere with the other tests.
+struct SnippetCompletions;
+
+impl zi::CompletionProvider for SnippetCompletions {
+    fn completions(
+        &self,
+        _editor: &mut zi::Editor,
+        params: lstypes::CompletionParams,
+    ) -> BoxFuture<'static, zi::Result<lstypes::CompletionResponse>> {
+        let items = if params.at.url.path().ends_with("accept.txt") {
+            vec![zi::CompletionItem {
+                label: "len".to_string(),
+                filter_text: Some("len".to_string()),
+                insert_text: Some("foo.len(${1:n})$0".to_string()),
+                replace_range: Some(zi::PointRange::new((0, 0), (0, 4))),
+                snippet: true,
+            }]
+        } else {
+            vec![]
+        };
+        Box::pin(async move { Ok(lstypes::CompletionResponse { items }) })
+    }
+}
+
+#[tokio::test]
+async fn accept_completion_text_edit() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempdir()?.join("accept.txt");
+    std::fs::write(&path, "")?;
+    cx.open(&path, zi::OpenFlags::empty()).await?;
+
+    cx.with(|editor| {
+        editor.register_completion_provider(SnippetCompletions);
+        editor.set_mode(zi::Mode::Insert);
+        editor.insert(zi::Active, "foo.").unwrap();
+        editor.trigger_completion(None);
+    })
+    .await;
+
+    cx.with(|editor| {
+        editor.insert_char(zi::Active, 'l').unwrap();
+        assert_eq!(
+            completions(editor).iter().map(|item| &item.label[..]).collect::<Vec<_>>(),
+            ["len"]
+        );
+
+        // Selecting the item only completes the word.
+        editor.tab().unwrap();
+        assert_eq!(editor.text(zi::Active), "foo.len\n");
+
+        // Accepting it applies the whole edit, with the cursor on the first placeholder.
+        editor.input("<CR>").unwrap();
+        assert_eq!(editor.text(zi::Active), "foo.len(n)\n");
+        assert_eq!(editor.cursor(zi::Active), (0, 8));
+        assert!(editor.completions().unwrap().next().is_none());
+
+        // Without a selected completion enter inserts a newline as usual.
+        editor.input("<CR>").unwrap();
+        assert_eq!(editor.text(zi::Active), "foo.len(\nn)\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn complete_buffer_words() -> zi::Result<()> {
+    let cx = new("").await;
+    cx.open_tmp("halal beta alpha\n", zi::OpenFlags::empty()).await?;
+    cx.with(|editor| {
+        editor.input("o").unwrap();
+        editor.trigger_completion(None);
+    })
+    .await;
+
+    cx.with(|editor| {
+        let labels = |editor: &mut zi::Editor| {
+            completions(editor).into_iter().map(|item| item.label).collect::<Vec<_>>()
+        };
+
+        editor.insert_char(zi::Active, 'a').unwrap();
+        editor.insert_char(zi::Active, 'l').unwrap();
+        // Words starting with the prefix rank above other matches.
+        assert_eq!(labels(editor), ["alpha", "halal"]);
+
+        editor.insert_char(zi::Active, 'p').unwrap();
+        assert_eq!(labels(editor), ["alpha"]);
+
+        // Deleting past the start of the word ends the completion.
+        for _ in 0..4 {
+            editor.delete_char(zi::Active).unwrap();
+        }
+        assert!(editor.completions().unwrap().next().is_none());
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
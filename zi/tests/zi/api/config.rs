@@ -1,6 +1,7 @@
 use core::fmt;
+use std::time::Duration;
 
-use zi::Editor;
+use zi::{Active, Editor, Mode};
 use zi_test::TestContext;
 
 use crate::new;
@@ -75,3 +76,82 @@ async fn buffer_set_command() {
 
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn keymap_config() -> zi::Result<()> {
+    let cx = new("a\nb\nc\n").await;
+    let path = cx.tempfile(
+        r#"
+[keys]
+timeout = 100
+
+[keys.normal]
+"U" = "undo"
+"u" = "none"
+"g" = "next_line"
+
+[keys.insert]
+"jk" = "normal_mode"
+"#,
+    )?;
+
+    cx.with({
+        let path = path.clone();
+        move |editor| {
+            editor.load_config(path).unwrap();
+            assert_eq!(*editor.settings().key_timeout.read(), Duration::from_millis(100));
+
+            // A default mapping can be overridden and unbound.
+            editor.input("dd").unwrap();
+            editor.input("u").unwrap();
+            assert_eq!(editor.text(Active).to_string(), "b\nc\n");
+            editor.input("U").unwrap();
+            assert_eq!(editor.text(Active).to_string(), "a\nb\nc\n");
+
+            // `g` waits for the rest of `gg` and falls back to its own binding on timeout.
+            editor.input("ggjg").unwrap();
+            assert_eq!(editor.cursor(Active).line(), 1);
+            editor.timeout_pending_keys();
+            assert_eq!(editor.cursor(Active).line(), 2);
+            editor.input("gg").unwrap();
+            assert_eq!(editor.cursor(Active).line(), 0);
+
+            // A prefix without a binding of its own is inserted as text on timeout.
+            editor.input("ij").unwrap();
+            editor.timeout_pending_keys();
+            editor.input("jk").unwrap();
+            assert_eq!(editor.mode(), Mode::Normal);
+            assert_eq!(editor.text(Active).to_string(), "ja\nb\nc\n");
+        }
+    })
+    .await;
+
+    std::fs::write(
+        &path,
+        "[keys.normal]\n\"<space>a\" = \"undo\"\n\" a\" = \"redo\"\n\"x\" = \"nope\"\n",
+    )?;
+    cx.with(|editor| {
+        let err = editor.reload_config().unwrap_err().to_string();
+        assert!(err.contains("conflicting bindings for `<space>a` and ` a`"), "{err}");
+        assert!(err.contains("unknown command `nope`"), "{err}");
+
+        // The previous keymap is kept.
+        editor.input("U").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\nb\nc\n");
+    })
+    .await;
+
+    std::fs::write(&path, "[keys.normal]\n\"U\" = \"redo\"\n")?;
+    cx.with(|editor| editor.execute("config reload").unwrap()).await;
+    cx.with(|editor| {
+        // Reloading starts over from the defaults.
+        editor.input("U").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "ja\nb\nc\n");
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\nb\nc\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -0,0 +1,123 @@
+use zi::Active;
+
+use crate::new;
+
+#[tokio::test]
+async fn count_line_operators() {
+    let cx = new("a\nb\nc\nd\ne").await;
+
+    cx.with(|editor| {
+        editor.input("3dd").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "d\ne\n");
+        editor.input("u").unwrap();
+
+        editor.set_cursor(Active, (0, 0));
+        editor.input("d2j").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "d\ne\n");
+        editor.input("u").unwrap();
+
+        editor.set_cursor(Active, (1, 0));
+        editor.input("d2k").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "c\nd\ne\n");
+        editor.input("u").unwrap();
+
+        // A count past the end of the buffer stops at the last line.
+        editor.set_cursor(Active, (1, 0));
+        editor.input("d999j").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn count_nested() {
+    let cx = new("one two three four five six seven eight").await;
+
+    cx.with(|editor| {
+        editor.input("2d3w").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "seven eight\n");
+        editor.input("u").unwrap();
+
+        editor.set_cursor(Active, (0, 0));
+        // The count after the operator doesn't continue the count before it.
+        editor.input("2dw").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "three four five six seven eight\n");
+        editor.input("d2w").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "five six seven eight\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn count_motions() {
+    let cx = new("0\n1\n2\n3\n4\n5\n6\n7").with_size((10, 4)).await;
+
+    cx.with(|editor| {
+        editor.input("5j").unwrap();
+        assert_eq!(editor.cursor(Active), (5, 0));
+        editor.input("3k").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        editor.input("2<C-e>").unwrap();
+        assert_eq!(editor.view(Active).offset(), (2, 0));
+        editor.input("2<C-y>").unwrap();
+        assert_eq!(editor.view(Active).offset(), (0, 0));
+
+        // An overflowing count is clamped to the end of the buffer.
+        editor.input("99999999999999999999999999j").unwrap();
+        assert_eq!(editor.cursor(Active), (7, 0));
+        editor.input("99999999999999999999999999k").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 0));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn count_zero() {
+    let cx = new("  abcdefghijklmnop").await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 4));
+        // `0` on its own moves to the start of the line.
+        editor.input("0").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 0));
+
+        editor.input("10l").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 10));
+
+        editor.input("d0").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "ijklmnop\n");
+        assert_eq!(editor.cursor(Active), (0, 0));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn count_insert() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        editor.input("3ihi<Esc>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "hihihi\n");
+        assert_eq!(editor.cursor(Active), (0, 5));
+
+        editor.input("2a!<Esc>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "hihihi!!\n");
+        assert_eq!(editor.cursor(Active), (0, 7));
+
+        // The count doesn't outlive the insert.
+        editor.input("ix<Esc>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "hihihi!x!\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
@@ -190,3 +190,56 @@ async fn cursor_trailing_newline() {
     .await;
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn cursor_graphemes() {
+    // A flag, `e` with a combining acute accent, a ZWJ family and a CJK character.
+    let cx = new("a🇯🇵e\u{301}👨\u{200d}👩\u{200d}👧日b\nabcdef\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (0, 0));
+
+        // (byte column, cell) of each grapheme cluster.
+        let mut positions = vec![];
+        for _ in 0..7 {
+            positions.push((editor.cursor(zi::Active).col(), editor.cursor_viewport_coords().0));
+            editor.move_cursor(zi::Active, Right, 1);
+        }
+        assert_eq!(positions, [(0, 0), (1, 1), (9, 3), (12, 4), (30, 6), (33, 8), (33, 8)]);
+
+        let mut positions = vec![];
+        for _ in 0..6 {
+            editor.move_cursor(zi::Active, Left, 1);
+            positions.push((editor.cursor(zi::Active).col(), editor.cursor_viewport_coords().0));
+        }
+        assert_eq!(positions, [(30, 6), (12, 4), (9, 3), (1, 1), (0, 0), (0, 0)]);
+
+        // Moving vertically doesn't land in the middle of a cluster.
+        editor.set_cursor(zi::Active, (1, 5));
+        editor.move_cursor(zi::Active, Up, 1);
+        assert_eq!(editor.cursor(zi::Active), (0, 1));
+        editor.set_cursor(zi::Active, (0, 10));
+        assert_eq!(editor.cursor(zi::Active), (0, 9));
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn delete_graphemes() {
+    let cx = new("a🇯🇵b\ne\u{301}👨\u{200d}👩\u{200d}👧\n").await;
+    cx.with(|editor| {
+        // Deleting a flag removes both regional indicators.
+        editor.set_cursor(zi::Active, (0, 9));
+        editor.input("i<BS><ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "ab");
+
+        // As does deleting forwards.
+        editor.set_cursor(zi::Active, (1, 3));
+        editor.input("dl").unwrap();
+        assert_eq!(editor.cursor_line(), "e\u{301}");
+        editor.input("dl").unwrap();
+        assert_eq!(editor.cursor_line(), "");
+    })
+    .await;
+    cx.cleanup().await;
+}
@@ -0,0 +1,78 @@
+use std::path::PathBuf;
+
+use zi::lstypes::{self, Point, Severity};
+use zi::{Active, OpenFlags};
+
+use crate::new;
+
+fn replace_diagnostics(editor: &mut zi::Editor, path: PathBuf, diags: &[(usize, Severity)]) {
+    let diags = diags
+        .iter()
+        .map(|&(line, severity)| lstypes::Diagnostic {
+            range: lstypes::EncodedRange::new(
+                lstypes::PositionEncoding::Utf8,
+                lstypes::PointRange::new(Point::new(line, 1), Point::new(line, 2)),
+            ),
+            severity,
+            message: format!("{severity:?}"),
+        })
+        .collect();
+    editor.replace_diagnostics(path, None, lstypes::Diagnostics::Full(diags));
+}
+
+#[tokio::test]
+async fn goto_diagnostic_by_severity() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempfile("aa\nbb\ncc\ndd\nee\n")?;
+    cx.open(&path, OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        replace_diagnostics(
+            editor,
+            path.clone(),
+            &[
+                (0, Severity::Warning),
+                (1, Severity::Error),
+                (2, Severity::Hint),
+                (3, Severity::Error),
+                (4, Severity::Warning),
+            ],
+        );
+
+        // The warnings and hints are skipped while there are errors.
+        editor.input("]d").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 1));
+        editor.input("]d").unwrap();
+        assert_eq!(editor.cursor(Active), (3, 1));
+        assert_eq!(
+            editor.goto_next_diagnostic(Active).unwrap_err().to_string(),
+            "no more diagnostics"
+        );
+        assert_eq!(editor.cursor(Active), (3, 1));
+
+        editor.input("[d").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 1));
+        // It's a jump.
+        editor.input("<C-o>").unwrap();
+        assert_eq!(editor.cursor(Active), (3, 1));
+
+        // Once the errors are fixed the warnings are next.
+        replace_diagnostics(
+            editor,
+            path.clone(),
+            &[(0, Severity::Warning), (2, Severity::Hint), (4, Severity::Warning)],
+        );
+        editor.input("[d").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 1));
+        editor.input("]d").unwrap();
+        assert_eq!(editor.cursor(Active), (4, 1));
+
+        replace_diagnostics(editor, path, &[]);
+        assert_eq!(editor.goto_prev_diagnostic(Active).unwrap_err().to_string(), "no diagnostics");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
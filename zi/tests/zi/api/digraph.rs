@@ -0,0 +1,57 @@
+use zi::Active;
+
+use crate::new;
+
+#[tokio::test]
+async fn insert_digraphs() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        editor.input("i<C-k>a:<C-k>e'<C-k>:o<C-k>l*<C-k>Eu").unwrap();
+        assert_eq!(editor.cursor_line(), "äéöλ€");
+        assert_eq!(editor.cursor(Active), (0, "äéöλ€".len()));
+
+        // An unknown digraph inserts nothing.
+        editor.input("<C-k>qq").unwrap();
+        assert_eq!(editor.get_error(), Some("unknown digraph `qq`"));
+        editor.input("<C-k>a<Esc>x").unwrap();
+        assert_eq!(editor.cursor_line(), "äéöλ€x");
+        assert_eq!(editor.mode(), zi::Mode::Insert);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn insert_code_points() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        editor.input("i<C-v>u00e9<C-v>U0001f600<C-v>u4e2d").unwrap();
+        assert_eq!(editor.cursor_line(), "é😀中");
+        assert_eq!(editor.cursor(Active), (0, "é😀中".len()));
+        // The wide characters take two cells each.
+        assert_eq!(editor.cursor_viewport_coords().0, 5);
+
+        // A combining character joins the character before it.
+        editor.input("e<C-v>u0301").unwrap();
+        assert_eq!(editor.cursor_line(), "é😀中e\u{301}");
+        assert_eq!(editor.cursor(Active), (0, "é😀中e\u{301}".len()));
+        assert_eq!(editor.cursor_viewport_coords().0, 6);
+
+        // The next key is inserted as is.
+        editor.input("<C-v><Tab>").unwrap();
+        assert_eq!(editor.cursor_line(), "é😀中e\u{301}\t");
+
+        // A key that isn't a hex digit cancels the sequence, surrogates aren't characters.
+        editor.input("<C-v>u12x").unwrap();
+        assert_eq!(editor.get_error(), Some("expected a hex digit"));
+        editor.input("<C-v>ud800").unwrap();
+        assert_eq!(editor.get_error(), Some("invalid code point U+D800"));
+        assert_eq!(editor.cursor_line(), "é😀中e\u{301}\t");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
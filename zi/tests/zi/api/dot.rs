@@ -327,6 +327,70 @@ async fn dot_repeat_with_count() {
     cx.cleanup().await;
 }
 
+#[tokio::test]
+async fn dot_repeat_with_new_count() {
+    let cx = new("1\n2\n3\n4\n5\n6\n7\n8\n9").await;
+
+    cx.with(|editor| {
+        editor.input("dd").unwrap();
+        assert_eq!(editor.text(zi::Active).to_string(), "2\n3\n4\n5\n6\n7\n8\n9\n");
+
+        // The new count replaces the count of the change rather than continuing it
+        editor.input("3.").unwrap();
+        assert_eq!(editor.text(zi::Active).to_string(), "5\n6\n7\n8\n9\n");
+
+        // and it is used by the next `.`
+        editor.input(".").unwrap();
+        assert_eq!(editor.text(zi::Active).to_string(), "8\n9\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn dot_repeat_with_new_count_after_operator_count() {
+    let cx = new("a b c d e f g h i j").await;
+
+    cx.with(|editor| {
+        editor.input("2d2w").unwrap();
+        assert_eq!(editor.cursor_line(), "e f g h i j");
+
+        // Without a count, the counts before and after the operator are repeated
+        editor.input(".").unwrap();
+        assert_eq!(editor.cursor_line(), "i j");
+        editor.input("u").unwrap();
+
+        // A new count replaces both
+        editor.input("3.").unwrap();
+        assert_eq!(editor.cursor_line(), "h i j");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn dot_repeat_change_inside_word() {
+    let cx = new("one two three").await;
+
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (0, 1));
+        editor.input("ciwfoo<ESC>").unwrap();
+        assert_eq!(editor.cursor_line(), "foo two three");
+
+        // The whole word is changed wherever the cursor is in it
+        editor.input("wl.").unwrap();
+        assert_eq!(editor.cursor_line(), "foo foo three");
+
+        editor.input("w.").unwrap();
+        assert_eq!(editor.cursor_line(), "foo foo foo");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
 #[tokio::test]
 async fn dot_repeat_paste() {
     let cx = new("one two three").await;
@@ -0,0 +1,83 @@
+use std::io;
+
+use tempfile::TempPath;
+use zi::Encoding;
+
+use crate::new;
+
+fn tempfile(bytes: &[u8]) -> io::Result<TempPath> {
+    let path = tempfile::NamedTempFile::new()?.into_temp_path();
+    std::fs::write(&path, bytes)?;
+    Ok(path)
+}
+
+fn utf16le(s: &str) -> Vec<u8> {
+    [0xFF, 0xFE].into_iter().chain(s.encode_utf16().flat_map(u16::to_le_bytes)).collect()
+}
+
+#[tokio::test]
+async fn utf16le_roundtrip() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = tempfile(&utf16le("héllo\nwörld 🦀\n"))?;
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        assert_eq!(editor[buf].text().to_string(), "héllo\nwörld 🦀\n");
+        assert_eq!(*editor[buf].settings().encoding.read(), Encoding::Utf16Le);
+        editor.edit(buf, &zi::Deltas::insert_at(0, "¡".to_string())).unwrap();
+    })
+    .await;
+
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await?;
+    assert_eq!(std::fs::read(&path)?, utf16le("¡héllo\nwörld 🦀\n"));
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn latin1_roundtrip() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = tempfile(b"caf\xe9 cr\xe8me\n")?;
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        assert_eq!(editor[buf].text().to_string(), "café crème\n");
+        assert_eq!(*editor[buf].settings().encoding.read(), Encoding::Latin1);
+        editor.edit(buf, &zi::Deltas::insert_at(0, "½ ".to_string())).unwrap();
+    })
+    .await;
+
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await?;
+    assert_eq!(std::fs::read(&path)?, b"\xbd caf\xe9 cr\xe8me\n");
+
+    // Characters outside of latin-1 can't be saved without changing the encoding.
+    cx.with(move |editor| editor.edit(buf, &zi::Deltas::insert_at(0, "€".to_string())).unwrap())
+        .await;
+    let res = cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await;
+    assert!(res.is_err());
+    assert_eq!(std::fs::read(&path)?, b"\xbd caf\xe9 cr\xe8me\n");
+
+    cx.with(|editor| editor.execute("set encoding utf-8").unwrap()).await;
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await?;
+    assert_eq!(std::fs::read_to_string(&path)?, "€½ café crème\n");
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn invalid_utf8_is_replaced() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = tempfile(b"\xe2\x9c\x93 \xe2\x9c\x93 \xff\n")?;
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        assert_eq!(editor[buf].text().to_string(), "✓ ✓ \u{FFFD}\n");
+        assert_eq!(*editor[buf].settings().encoding.read(), Encoding::Utf8);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -0,0 +1,54 @@
+use zi::FileFormat;
+
+use crate::new;
+
+#[tokio::test]
+async fn crlf_roundtrip() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempfile("a\r\nb\r\n")?;
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        assert_eq!(editor[buf].text().to_string(), "a\nb\n");
+        assert_eq!(*editor[buf].settings().file_format.read(), FileFormat::Dos);
+        assert!(editor.get_message().is_none());
+        editor.edit(buf, &zi::Deltas::insert_at(4, "c\n".to_string())).unwrap();
+    })
+    .await;
+
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await?;
+    assert_eq!(std::fs::read_to_string(&path)?, "a\r\nb\r\nc\r\n");
+
+    cx.with(|editor| editor.execute("set fileformat unix").unwrap()).await;
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::FORCE)).await.await?;
+    assert_eq!(std::fs::read_to_string(&path)?, "a\nb\nc\n");
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn mixed_line_endings_are_normalized() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempfile("a\r\nb\nc\r\n")?;
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        assert_eq!(editor[buf].text().to_string(), "a\nb\nc\n");
+        assert_eq!(*editor[buf].settings().file_format.read(), FileFormat::Dos);
+        assert!(editor[buf].flags().contains(zi::BufferFlags::MIXED_LINE_ENDINGS));
+        assert!(editor.get_message().is_some_and(|msg| msg.contains("mixed line endings")));
+    })
+    .await;
+
+    // The file is written even though it wasn't changed.
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await?;
+    assert_eq!(std::fs::read_to_string(&path)?, "a\r\nb\r\nc\r\n");
+    cx.with(move |editor| {
+        assert!(!editor[buf].flags().contains(zi::BufferFlags::MIXED_LINE_ENDINGS));
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
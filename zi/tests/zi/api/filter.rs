@@ -0,0 +1,117 @@
+use zi::{Active, Mode};
+
+use crate::new;
+
+#[tokio::test]
+async fn filter_lines() -> zi::Result<()> {
+    let cx = new("ab\ncd\nef\ngh").await;
+
+    cx.with(|editor| editor.filter_lines(Active, 0..=2, "tac")).await.await?;
+    cx.with(|editor| {
+        assert_eq!(editor.text(Active).to_string(), "ef\ncd\nab\ngh\n");
+        assert_eq!(editor.cursor(Active), (0, 0));
+
+        // The whole filter is undone at once.
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "ab\ncd\nef\ngh\n");
+    })
+    .await;
+
+    cx.with(|editor| editor.filter_lines(Active, 1..=3, "rev")).await.await?;
+    cx.with(|editor| {
+        assert_eq!(editor.text(Active).to_string(), "ab\ndc\nfe\nhg\n");
+        assert_eq!(editor.cursor(Active), (1, 0));
+    })
+    .await;
+
+    cx.with(|editor| editor.filter_lines(Active, 0..=1, "tr -d '\\n'")).await.await?;
+    // The newline after the lines is kept even though the output doesn't end with one.
+    cx.with(|editor| assert_eq!(editor.text(Active).to_string(), "abdc\nfe\nhg\n")).await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn filter_lines_failure() -> zi::Result<()> {
+    let cx = new("a\nb").await;
+
+    let res =
+        cx.with(|editor| editor.filter_lines(Active, 0..=1, "echo oops >&2; exit 1")).await.await;
+    let err = res.unwrap_err().to_string();
+    assert!(err.contains("oops"), "{err}");
+    cx.with(|editor| assert_eq!(editor.text(Active).to_string(), "a\nb\n")).await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn filter_lines_large() -> zi::Result<()> {
+    let text = (0..100_000).map(|i| format!("{i}\n")).collect::<String>();
+    let cx = new(&text).await;
+
+    cx.with(|editor| editor.filter_lines(Active, 0..=99_999, "tac")).await.await?;
+    let expected = (0..100_000).rev().map(|i| format!("{i}\n")).collect::<String>();
+    cx.with(move |editor| assert_eq!(editor.text(Active).to_string(), expected)).await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn filter_operator() {
+    let cx = new("a\nb\nc\nd").await;
+
+    cx.with(|editor| {
+        editor.input("!!").unwrap();
+        assert_eq!(editor.mode(), Mode::Command);
+        assert_eq!(editor.command_buffer(), Some(":.!"));
+        editor.input("<ESC>").unwrap();
+
+        editor.input("!j").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":.,.+1!"));
+        editor.input("<ESC>").unwrap();
+
+        editor.input("3!!").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":.,.+2!"));
+        editor.input("<ESC>").unwrap();
+
+        editor.set_cursor(Active, (2, 0));
+        editor.input("!k").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":.,.+1!"));
+        assert_eq!(editor.cursor(Active), (1, 0));
+        editor.input("<ESC>").unwrap();
+
+        editor.input("Vj!").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":'<,'>!"));
+        editor.input("<ESC>").unwrap();
+
+        editor.input("vj:").unwrap();
+        assert_eq!(editor.command_buffer(), Some(":'<,'>"));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn filter_command() {
+    let cx = new("a\nb\nc\nd").await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (1, 0));
+        editor.input("Vj<ESC>").unwrap();
+        // Leaving visual mode marks the selection for `:'<,'>`.
+        assert_eq!(editor.mark_location(Active, '<').unwrap().point.line(), 1);
+        assert_eq!(editor.mark_location(Active, '>').unwrap().point.line(), 2);
+        editor.execute("'<,'>s/[a-z]/x/").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\nx\nx\nd\n");
+
+        // There are no lines to filter without a range.
+        assert!(editor.execute("!tac").is_err());
+    })
+    .await;
+
+    cx.cleanup().await;
+}
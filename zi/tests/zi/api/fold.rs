@@ -0,0 +1,167 @@
+use std::ops::RangeInclusive;
+
+use expect_test::expect;
+use zi::{Active, Deltas};
+
+use crate::new;
+
+fn folds(editor: &zi::Editor) -> Vec<(RangeInclusive<usize>, bool)> {
+    editor.folds(Active).iter().map(|fold| (fold.lines(), fold.is_closed())).collect()
+}
+
+#[tokio::test]
+async fn manual_fold() {
+    let cx = new("1\n2\n3\n4\n5\n6\n7").with_size((30, 8)).await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (1, 0));
+        editor.input("zfj").unwrap();
+        assert_eq!(folds(editor), [(1..=2, true)]);
+        assert_eq!(editor.cursor(Active), (1, 0));
+    })
+    .await;
+
+    cx.snapshot(expect![[r#"
+        "   1 1                        "
+        "   2 | ... (2 lines)          "
+        "   4 4                        "
+        "   5 5                        "
+        "   6 6                        "
+        "   7 7                        "
+        "buffer://scratch:2:0          "
+        "                              "
+    "#]])
+        .await;
+
+    cx.with(|editor| {
+        // A closed fold is moved over as if it were one line.
+        editor.input("j").unwrap();
+        assert_eq!(editor.cursor(Active), (3, 0));
+        editor.input("k").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 0));
+        editor.input("2j").unwrap();
+        assert_eq!(editor.cursor(Active), (4, 0));
+        editor.input("2k").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 0));
+
+        editor.input("za").unwrap();
+        assert_eq!(folds(editor), [(1..=2, false)]);
+        editor.input("j").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        // Closing the fold moves the cursor to its first line.
+        editor.input("za").unwrap();
+        assert_eq!(folds(editor), [(1..=2, true)]);
+        assert_eq!(editor.cursor(Active), (1, 0));
+
+        editor.input("zR").unwrap();
+        assert_eq!(folds(editor), [(1..=2, false)]);
+    })
+    .await;
+
+    cx.snapshot(expect![[r#"
+        "   1 1                        "
+        "   2 |                        "
+        "   3 3                        "
+        "   4 4                        "
+        "   5 5                        "
+        "   6 6                        "
+        "buffer://scratch:2:0          "
+        "                              "
+    "#]])
+        .await;
+
+    cx.with(|editor| {
+        editor.input("zM").unwrap();
+        assert_eq!(folds(editor), [(1..=2, true)]);
+
+        editor.set_cursor(Active, (5, 0));
+        editor.input("za").unwrap();
+        assert_eq!(folds(editor), [(1..=2, true)]);
+        assert_eq!(editor.cursor(Active), (5, 0));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn fold_scroll() {
+    let text = (1..=20).map(|n| n.to_string()).collect::<Vec<_>>().join("\n");
+    let cx = new(&text).with_size((30, 8)).await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (2, 0));
+        editor.input("zf8j").unwrap();
+        assert_eq!(folds(editor), [(2..=10, true)]);
+
+        editor.input("j").unwrap();
+        assert_eq!(editor.cursor(Active), (11, 0));
+        assert_eq!(editor.view(Active).offset(), (0, 0));
+
+        // The view only scrolls far enough for the cursor to be on the last row.
+        editor.input("3j").unwrap();
+        assert_eq!(editor.cursor(Active), (14, 0));
+        assert_eq!(editor.view(Active).offset(), (1, 0));
+    })
+    .await;
+
+    cx.snapshot(expect![[r#"
+        "   2 2                        "
+        "   3 3 ... (9 lines)          "
+        "  12 12                       "
+        "  13 13                       "
+        "  14 14                       "
+        "  15 |5                       "
+        "buffer://scratch:15:0         "
+        "                              "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn fold_follows_edits() {
+    let cx = new("1\n2\n3\n4\n5\n6\n7\n").await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (2, 0));
+        editor.input("zfj").unwrap();
+        assert_eq!(folds(editor), [(2..=3, true)]);
+
+        // Edits above the fold move it.
+        editor.edit(Active, &Deltas::insert_at(0, "0\n")).unwrap();
+        assert_eq!(folds(editor), [(3..=4, true)]);
+
+        // Edits within the fold resize it.
+        editor.edit(Active, &Deltas::insert_at(8, "x\n")).unwrap();
+        assert_eq!(folds(editor), [(3..=5, true)]);
+
+        // Edits below the fold don't affect it.
+        editor.edit(Active, &Deltas::insert_at(12, "y\n")).unwrap();
+        assert_eq!(folds(editor), [(3..=5, true)]);
+
+        // Deleting the folded lines removes the fold.
+        editor.edit(Active, &Deltas::delete(6..12)).unwrap();
+        assert!(folds(editor).is_empty());
+
+        // As does joining its lines as there is nothing left to fold.
+        editor.set_cursor(Active, (2, 0));
+        editor.input("zfj").unwrap();
+        assert_eq!(folds(editor), [(2..=3, true)]);
+        editor.edit(Active, &Deltas::delete(5..6)).unwrap();
+        assert!(folds(editor).is_empty());
+
+        editor.set_cursor(Active, (2, 0));
+        editor.input("zfj").unwrap();
+        assert_eq!(folds(editor), [(2..=3, true)]);
+
+        // Edits across the start of the fold remove it.
+        editor.edit(Active, &Deltas::delete(3..5)).unwrap();
+        assert!(folds(editor).is_empty());
+    })
+    .await;
+
+    cx.cleanup().await;
+}
@@ -0,0 +1,109 @@
+use zi::{Active, LanguageConfig, OpenFlags};
+
+use crate::new;
+
+const MAIN_GO: &str = "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n";
+
+/// Stub formatter that uppercases its input, so the tests don't depend on `gofmt` being installed.
+fn use_upcase(editor: &mut zi::Editor) {
+    use_formatter(editor, "tr a-z A-Z");
+}
+
+fn use_formatter(editor: &mut zi::Editor, script: &str) {
+    editor.language_config_mut().add_language(
+        zi::filetype!(go),
+        LanguageConfig::default().with_formatter(zi::Formatter::new("sh", ["-c", script])),
+    );
+}
+
+#[tokio::test]
+async fn format_external() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempdir()?.join("main.go");
+    std::fs::write(&path, MAIN_GO)?;
+    let buf = cx.open(&path, OpenFlags::empty()).await?;
+
+    let last_line = MAIN_GO.lines().count() - 1;
+    cx.with(move |editor| {
+        use_upcase(editor);
+        editor.set_cursor(Active, (last_line, 0));
+        editor.format(buf)
+    })
+    .await
+    .await?;
+
+    let version = cx
+        .with(move |editor| {
+            assert_eq!(editor[buf].text().to_string(), MAIN_GO.to_uppercase());
+            assert_eq!(editor.cursor(Active).line(), last_line, "the cursor should stay put");
+            editor[buf].version()
+        })
+        .await;
+
+    // Formatting is idempotent, the second run shouldn't edit the buffer or add an undo entry.
+    cx.with(move |editor| editor.format(buf)).await.await?;
+    cx.with(move |editor| {
+        assert_eq!(editor[buf].version(), version);
+        assert!(editor.undo(buf).unwrap());
+        assert_eq!(editor[buf].text().to_string(), MAIN_GO);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn format_empty() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempdir()?.join("empty.go");
+    std::fs::write(&path, "")?;
+    let buf = cx.open(&path, OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        use_upcase(editor);
+        editor.format(buf)
+    })
+    .await
+    .await?;
+    cx.with(move |editor| assert_eq!(editor[buf].text().to_string(), "")).await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn format_on_save() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempdir()?.join("main.go");
+    std::fs::write(&path, "package main\n")?;
+    let buf = cx.open(&path, OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        use_upcase(editor);
+        editor.edit(buf, &zi::Deltas::insert_at(13, "func main() {}\n")).unwrap();
+        editor.save(buf, zi::SaveFlags::empty())
+    })
+    .await
+    .await?;
+    assert_eq!(std::fs::read_to_string(&path)?, "PACKAGE MAIN\nFUNC MAIN() {}\n");
+
+    // A failing formatter blocks the write and reports its stderr.
+    let err = cx
+        .with(move |editor| {
+            use_formatter(editor, "cat >/dev/null; echo 'syntax error' >&2; exit 2");
+            editor.edit(buf, &zi::Deltas::insert_at(0, "{")).unwrap();
+            editor.save(buf, zi::SaveFlags::empty())
+        })
+        .await
+        .await
+        .unwrap_err();
+    assert!(err.to_string().contains("syntax error"), "{err}");
+    assert_eq!(std::fs::read_to_string(&path)?, "PACKAGE MAIN\nFUNC MAIN() {}\n");
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -0,0 +1,121 @@
+use std::ops::Range;
+use std::path::Path;
+use std::time::Duration;
+
+use expect_test::expect;
+use zi::{Active, BufferId, Deltas, HunkKind, OpenFlags};
+
+use crate::new;
+
+fn git(dir: &Path, args: &[&str]) {
+    let status = std::process::Command::new("git").args(args).current_dir(dir).status().unwrap();
+    assert!(status.success(), "git {args:?} failed");
+}
+
+fn hunks(editor: &zi::Editor, buf: BufferId) -> Vec<(HunkKind, Range<usize>)> {
+    editor.git_hunks(buf).iter().map(|hunk| (hunk.kind(), hunk.lines())).collect()
+}
+
+#[tokio::test]
+async fn git_signs() {
+    let cx = new("").with_size((20, 9)).await;
+    let dir = cx.tempdir().unwrap();
+    git(&dir, &["init", "-q"]);
+    let path = dir.join("file.txt");
+    std::fs::write(&path, "1\n2\n3\n4\n5\n6\n").unwrap();
+    git(&dir, &["add", "file.txt"]);
+
+    // Change the second line, delete the fourth and add one at the end.
+    std::fs::write(&path, "1\nx\n3\n5\n6\n7\n").unwrap();
+    let buf = cx.open(&path, OpenFlags::empty()).await.unwrap();
+    cx.with(move |editor| editor.refresh_git_diff(buf)).await.await.unwrap();
+
+    cx.with(move |editor| {
+        assert_eq!(
+            hunks(editor, buf),
+            [(HunkKind::Changed, 1..2), (HunkKind::Deleted, 3..3), (HunkKind::Added, 5..6)]
+        );
+        // Keep the temporary path out of the snapshot.
+        zi::command::set_option(editor, "statusline", "{line}:{col}").unwrap();
+    })
+    .await;
+
+    // The deletion is marked on the line above it.
+    cx.snapshot(expect![[r#"
+        "   1 |              "
+        "~  2 x              "
+        "_  3 3              "
+        "   4 5              "
+        "   5 6              "
+        "+  6 7              "
+        "   7                "
+        "1:0                 "
+        "                    "
+    "#]])
+        .await;
+
+    cx.with(move |editor| {
+        editor.input("]c").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 0));
+        editor.input("]c").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+        editor.input("]c").unwrap();
+        assert_eq!(editor.cursor(Active), (5, 0));
+        assert!(editor.goto_next_hunk(Active).is_err());
+        assert_eq!(editor.cursor(Active), (5, 0));
+
+        editor.input("[c").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        // Reverting the deletion brings the line back.
+        editor.revert_hunk(Active).unwrap();
+        assert_eq!(editor.text(buf).to_string(), "1\nx\n3\n4\n5\n6\n7\n");
+        assert_eq!(hunks(editor, buf), [(HunkKind::Changed, 1..2), (HunkKind::Added, 6..7)]);
+
+        editor.set_cursor(Active, (1, 0));
+        editor.revert_hunk(Active).unwrap();
+        assert_eq!(editor.text(buf).to_string(), "1\n2\n3\n4\n5\n6\n7\n");
+        assert!(editor.revert_hunk(Active).is_err(), "there is no hunk on the line anymore");
+
+        editor.edit(buf, &Deltas::delete(0..2)).unwrap();
+    })
+    .await;
+
+    // The diff is updated shortly after an edit.
+    tokio::time::sleep(Duration::from_millis(500)).await;
+    cx.with(move |editor| {
+        assert_eq!(hunks(editor, buf), [(HunkKind::Deleted, 0..0), (HunkKind::Added, 5..6)]);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn git_signs_untracked() {
+    let cx = new("").await;
+    let dir = cx.tempdir().unwrap();
+    git(&dir, &["init", "-q"]);
+    let path = dir.join("untracked.txt");
+    std::fs::write(&path, "a\nb\n").unwrap();
+
+    let buf = cx.open(&path, OpenFlags::empty()).await.unwrap();
+    cx.with(move |editor| editor.refresh_git_diff(buf)).await.await.unwrap();
+    cx.with(move |editor| assert_eq!(hunks(editor, buf), [(HunkKind::Added, 0..2)])).await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn git_signs_outside_repository() {
+    let cx = new("").await;
+    let dir = cx.tempdir().unwrap();
+    let path = dir.join("file.txt");
+    std::fs::write(&path, "a\nb\n").unwrap();
+
+    let buf = cx.open(&path, OpenFlags::empty()).await.unwrap();
+    cx.with(move |editor| editor.refresh_git_diff(buf)).await.await.unwrap();
+    cx.with(move |editor| assert!(editor.git_hunks(buf).is_empty())).await;
+
+    cx.cleanup().await;
+}
@@ -0,0 +1,92 @@
+use zi::buffer::IndentSettings;
+use zi::{Active, Mode, OpenFlags, Point};
+
+use crate::new;
+
+#[tokio::test]
+async fn indent_go_if_block() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempdir()?.join("main.go");
+    std::fs::write(&path, "func main() {\n}\n")?;
+    cx.open(&path, OpenFlags::empty()).await?;
+
+    cx.with(|editor| {
+        let text = |editor: &zi::Editor| editor.text(Active).to_string();
+        editor.buffer(Active).settings().indent.write(IndentSettings::Tabs);
+
+        editor.input("A<CR>").unwrap();
+        assert_eq!(text(editor), "func main() {\n\t\n}\n");
+        assert_eq!(editor.cursor(Active), Point::new(1, 1));
+
+        // The opening brace adds a level.
+        editor.input("if ok {<CR>return<CR>").unwrap();
+        assert_eq!(text(editor), "func main() {\n\tif ok {\n\t\treturn\n\t\t\n}\n");
+
+        // The closing brace dedents to match the line of the opening brace.
+        editor.input("}").unwrap();
+        assert_eq!(text(editor), "func main() {\n\tif ok {\n\t\treturn\n\t}\n}\n");
+        assert_eq!(editor.cursor(Active), Point::new(3, 2));
+
+        editor.input("<ESC>").unwrap();
+        assert_eq!(editor.mode(), Mode::Normal);
+
+        // Splitting a line between braces puts the closing brace on its own line at the indentation of the opening one.
+        editor.set_cursor(Active, (3, 0));
+        editor.input("A else {}<ESC>i<CR>").unwrap();
+        assert_eq!(text(editor), "func main() {\n\tif ok {\n\t\treturn\n\t} else {\n\t}\n}\n");
+        assert_eq!(editor.cursor(Active), Point::new(4, 1));
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn indent_respects_settings() {
+    let cx = new("").await;
+    cx.with(|editor| {
+        let text = |editor: &zi::Editor| editor.text(Active).to_string();
+
+        editor.input("ifoo(<CR>").unwrap();
+        assert_eq!(text(editor), "foo(\n    \n");
+
+        zi::command::set_option(editor, "shiftwidth", "2").unwrap();
+        editor.input("bar(<CR>").unwrap();
+        assert_eq!(text(editor), "foo(\n    bar(\n      \n");
+
+        // Tabs are used where they fit and spaces make up the rest.
+        zi::command::set_option(editor, "expandtab", "false").unwrap();
+        assert!(zi::command::set_option(editor, "shiftwidth", "2").is_err());
+        editor.input("x<CR>").unwrap();
+        assert_eq!(text(editor), "foo(\n    bar(\n      x\n\t  \n");
+        editor.input(")").unwrap();
+        assert_eq!(editor.cursor_line(), "\t)");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn indent_trims_blank_lines() {
+    let cx = new("").await;
+    cx.with(|editor| {
+        let text = |editor: &zi::Editor| editor.text(Active).to_string();
+
+        // The indentation moves to the next line rather than staying behind on the blank one.
+        editor.input("ifn main() {<CR><CR>").unwrap();
+        assert_eq!(text(editor), "fn main() {\n\n    \n");
+
+        editor.input("<ESC>").unwrap();
+        assert_eq!(text(editor), "fn main() {\n\n\n");
+
+        // Opening a line above indents it too.
+        editor.input("ggjO").unwrap();
+        assert_eq!(text(editor), "fn main() {\n    \n\n\n");
+        assert_eq!(editor.cursor(Active), Point::new(1, 4));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
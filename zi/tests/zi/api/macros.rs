@@ -0,0 +1,91 @@
+use zi::Active;
+
+use crate::new;
+
+#[tokio::test]
+async fn macro_replay_across_lines() {
+    let cx = new("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n").await;
+    cx.with(|editor| {
+        editor.input("qaI-<space><ESC>A;<ESC>jq").unwrap();
+        assert_eq!(editor.recording_macro(), None);
+        assert_eq!(editor.register('a').unwrap().content, "I- <esc>A;<esc>j");
+        assert_eq!(editor.text(Active).to_string(), "- 0;\n1\n2\n3\n4\n5\n6\n7\n8\n9\n");
+
+        editor.input("9@a").unwrap();
+        assert_eq!(
+            editor.text(Active).to_string(),
+            "- 0;\n- 1;\n- 2;\n- 3;\n- 4;\n- 5;\n- 6;\n- 7;\n- 8;\n- 9;\n"
+        );
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn macro_replay_last() {
+    let cx = new("a\nb\nc\n").await;
+    cx.with(|editor| {
+        editor.input("qqAx<ESC>jq").unwrap();
+        editor.input("@q@@").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "ax\nbx\ncx\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn macro_recording_status() {
+    let cx = new("").await;
+    cx.with(|editor| {
+        editor.input("qb").unwrap();
+        assert_eq!(editor.recording_macro(), Some('b'));
+        editor.input("q").unwrap();
+        assert_eq!(editor.recording_macro(), None);
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn macro_aborts_on_error() {
+    let cx = new("a\nb\nc\nd\n").await;
+    cx.with(|editor| {
+        // The `:bad` command fails during the recording, but it is still recorded.
+        editor.input("qaAx<ESC>:bad<CR>jq").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "ax\nb\nc\nd\n");
+        assert_eq!(editor.cursor(Active).line(), 1);
+
+        // Only the first iteration gets as far as the failing command, the `j` is never reached.
+        editor.input("3@a").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "ax\nbx\nc\nd\n");
+        assert_eq!(editor.cursor(Active).line(), 1);
+        assert!(editor.get_error().unwrap().contains("aborted"));
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn macro_aborts_on_failed_search() {
+    let cx = new("foo\nbar\n").await;
+    cx.with(|editor| {
+        editor.input("qa/zzz<CR>Ax<ESC>q").unwrap();
+        editor.input("@a").unwrap();
+        // The recording carried on past the failed search, but the replay must not.
+        assert_eq!(editor.text(Active).to_string(), "foox\nbar\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn macro_missing_register() {
+    let cx = new("abc\n").await;
+    cx.with(|editor| {
+        editor.input("@z").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "abc\n");
+        assert!(editor.get_error().is_some());
+    })
+    .await;
+    cx.cleanup().await;
+}
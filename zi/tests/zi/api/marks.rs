@@ -1,6 +1,6 @@
 use std::ops::Range;
 
-use zi::NamespaceId;
+use zi::{Active, NamespaceId};
 
 use crate::new;
 
@@ -33,3 +33,98 @@ async fn marks() {
 
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn named_marks() {
+    let cx = new("abc\ndef\nghi\n").await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (1, 2));
+        editor.input("ma").unwrap();
+
+        // The mark follows the line when lines are inserted above it.
+        editor.edit(Active, &zi::deltas![0..0 => "xyz\n"]).unwrap();
+        editor.set_cursor(Active, (0, 0));
+        editor.input("`a").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 2));
+
+        editor.set_cursor(Active, (0, 0));
+        editor.input("'a").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        editor.execute("'as/e/E/").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "xyz\nabc\ndEf\nghi\n");
+
+        // Setting the mark again moves it.
+        editor.input("ggma").unwrap();
+        editor.input("G`a").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 0));
+
+        assert!(editor.goto_mark('b', false).is_err());
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn global_marks() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        let a = editor.create_readonly_buffer("a.txt", "aa\naa".as_bytes());
+        let b = editor.create_readonly_buffer("b.txt", "bb\nbb".as_bytes());
+
+        editor.set_buffer(Active, a);
+        editor.set_cursor(Active, (1, 1));
+        editor.input("mAma").unwrap();
+
+        // Lowercase marks are local to the buffer, uppercase marks are not.
+        editor.set_buffer(Active, b);
+        assert!(editor.goto_mark('a', false).is_err());
+        editor.input("`A").unwrap();
+        assert_eq!(editor.current_location(), zi::Location::new(a, (1, 1)));
+
+        // Jumping to a mark in another buffer can be jumped back from.
+        editor.input("<C-o>").unwrap();
+        assert_eq!(editor.buffer(Active).id(), b);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn far_motions_are_jumps() {
+    let cx = new("a\nb\nc\nd\n").await;
+
+    cx.with(|editor| {
+        editor.input("G").unwrap();
+        assert_eq!(editor.cursor(Active), (3, 0));
+        editor.input("gg").unwrap();
+        editor.input("/c<CR>").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        // Jumping back visits the most recent jumps first.
+        editor.input("<C-o>").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 0));
+        editor.input("<C-o>").unwrap();
+        assert_eq!(editor.cursor(Active), (3, 0));
+        editor.input("<C-i>").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 0));
+        editor.input("<C-i>").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        // A jump after going back discards the jumps ahead.
+        editor.input("<C-o><C-o>").unwrap();
+        assert_eq!(editor.cursor(Active), (3, 0));
+        editor.input("gg").unwrap();
+        editor.input("<C-i>").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 0));
+        editor.input("<C-o>").unwrap();
+        assert_eq!(editor.cursor(Active), (3, 0));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
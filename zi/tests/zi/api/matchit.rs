@@ -0,0 +1,96 @@
+use zi::{Active, OpenFlags, Point};
+
+use crate::new;
+
+#[tokio::test]
+async fn matchit_nested() {
+    let cx = new("f(a, [b], {c})\n(a").await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 1));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 13));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 1));
+
+        editor.set_cursor(Active, (0, 5));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 7));
+        editor.set_cursor(Active, (0, 12));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 10));
+
+        // Before a bracket, `%` uses the next bracket on the line.
+        editor.set_cursor(Active, (0, 0));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 13));
+
+        // An unmatched bracket goes nowhere.
+        editor.set_cursor(Active, (1, 0));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 0));
+        assert_eq!(editor.matching_brackets(Active), None);
+
+        editor.set_cursor(Active, (0, 0));
+        editor.input("d%").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "\n(a\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn matching_brackets() {
+    let cx = new("f(a, (b))").await;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 5));
+        assert_eq!(editor.matching_brackets(Active), Some((Point::new(0, 5), Point::new(0, 7))));
+        editor.set_cursor(Active, (0, 8));
+        assert_eq!(editor.matching_brackets(Active), Some((Point::new(0, 8), Point::new(0, 1))));
+
+        // Only the bracket under the cursor is highlighted, not the next one on the line.
+        editor.set_cursor(Active, (0, 0));
+        assert_eq!(editor.matching_brackets(Active), None);
+
+        // In insert mode, the bracket just before the cursor counts.
+        editor.input("A").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 9));
+        assert_eq!(editor.matching_brackets(Active), Some((Point::new(0, 8), Point::new(0, 1))));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn matchit_skips_strings() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempdir()?.join("main.go");
+    std::fs::write(&path, "func main() { // }\n\tf(\"(\", x)\n}\n")?;
+    cx.open(&path, OpenFlags::empty()).await?;
+
+    cx.with(|editor| {
+        editor.set_cursor(Active, (1, 2));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 9));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 2));
+
+        // The brace in the comment doesn't count.
+        editor.set_cursor(Active, (0, 11));
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        // The bracket in the string has no match within the string.
+        editor.set_cursor(Active, (1, 4));
+        assert_eq!(editor.matching_brackets(Active), None);
+        editor.input("%").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 4));
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -0,0 +1,164 @@
+use zi::{Active, Mode, Point};
+
+use crate::new;
+
+fn cursors(editor: &zi::Editor) -> Vec<Point> {
+    editor.view(Active).cursors().collect()
+}
+
+#[tokio::test]
+async fn multicursor_insert() {
+    let cx = new("abc\nabc\nabc\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 1));
+        editor.add_cursor_down(Active);
+        editor.add_cursor_down(Active);
+        assert_eq!(cursors(editor), [Point::new(0, 1), Point::new(1, 1), Point::new(2, 1)]);
+
+        editor.input("ix<ESC>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "axbc\naxbc\naxbc\n");
+        assert_eq!(editor.mode(), Mode::Normal);
+        assert_eq!(cursors(editor), [Point::new(0, 1), Point::new(1, 1), Point::new(2, 1)]);
+
+        editor.input("<ESC>").unwrap();
+        assert_eq!(cursors(editor), [Point::new(0, 1)]);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn multicursor_motion() {
+    let cx = new("abc\nab\nabc").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 2));
+        editor.add_cursor_down(Active);
+        editor.add_cursor_down(Active);
+        // The cursor on the shorter line is clamped
+        assert_eq!(cursors(editor), [Point::new(0, 2), Point::new(1, 1), Point::new(2, 2)]);
+
+        editor.input("h").unwrap();
+        assert_eq!(cursors(editor), [Point::new(0, 1), Point::new(1, 0), Point::new(2, 1)]);
+
+        // Cursors that collapse onto the same position are merged
+        editor.input("j").unwrap();
+        assert_eq!(cursors(editor), [Point::new(1, 1), Point::new(2, 0), Point::new(2, 1)]);
+        editor.input("jj").unwrap();
+        assert_eq!(cursors(editor), [Point::new(2, 1), Point::new(2, 0)]);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn multicursor_backspace_merges_cursors() {
+    let cx = new("foo foo foo\n").await;
+    cx.with(|editor| {
+        assert_eq!(editor.search("o").count(), 6);
+        editor.set_mode(Mode::Normal);
+        editor.add_cursors_at_matches(Active);
+        assert_eq!(cursors(editor).len(), 6);
+
+        editor.set_mode(Mode::Insert);
+        editor.input("<BS>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "o o o\n");
+        assert_eq!(cursors(editor), [Point::new(0, 0), Point::new(0, 2), Point::new(0, 4)]);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn multicursor_undo() {
+    let cx = new("abc\nabc\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 1));
+        editor.add_cursor_down(Active);
+        editor.input("ixy<ESC>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "axybc\naxybc\n");
+
+        editor.input("<ESC>").unwrap();
+        editor.set_cursor(Active, (0, 0));
+        assert_eq!(cursors(editor), [Point::new(0, 0)]);
+
+        editor.undo(Active).unwrap();
+        assert_eq!(editor.text(Active).to_string(), "abc\nabc\n");
+        assert_eq!(cursors(editor), [Point::new(0, 1), Point::new(1, 1)]);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn multicursor_visual_delete() {
+    let cx = new("foo bar\nfoo bar\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 0));
+        editor.add_cursor_down(Active);
+        editor.input("ve").unwrap();
+        let selections = editor.visual_selections(Active).unwrap();
+        assert_eq!(selections.len(), 2);
+        assert_eq!(selections.content(editor.text(Active)), "foo\nfoo");
+
+        editor.input("d").unwrap();
+        assert_eq!(editor.text(Active).to_string(), " bar\n bar\n");
+        assert_eq!(editor.mode(), Mode::Normal);
+        assert_eq!(cursors(editor), [Point::new(0, 0), Point::new(1, 0)]);
+
+        // Undo brings back every cursor, not just the primary one.
+        editor.clear_secondary_cursors(Active);
+        editor.undo(Active).unwrap();
+        assert_eq!(editor.text(Active).to_string(), "foo bar\nfoo bar\n");
+        assert_eq!(cursors(editor), [Point::new(0, 0), Point::new(1, 0)]);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn multicursor_visual_overlapping_selections_merge() {
+    let cx = new("ab ab ab x\n").await;
+    cx.with(|editor| {
+        assert_eq!(editor.search("b").count(), 3);
+        editor.set_mode(Mode::Normal);
+        editor.set_cursor(Active, (0, 1));
+        editor.add_cursors_at_matches(Active);
+        assert_eq!(cursors(editor), [Point::new(0, 1), Point::new(0, 4), Point::new(0, 7)]);
+
+        // Each selection reaches the start of the next one, so they all become one selection.
+        editor.input("ve").unwrap();
+        assert_eq!(cursors(editor), [Point::new(0, 9)]);
+        assert_eq!(editor.visual_selections(Active).unwrap().len(), 1);
+
+        editor.input("d").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn multicursor_visual_line_selections_merge() {
+    let cx = new("a\nb\nc\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 0));
+        editor.add_cursor_down(Active);
+        // Selections of neighbouring lines don't overlap.
+        editor.input("V").unwrap();
+        assert_eq!(editor.visual_selections(Active).unwrap().len(), 2);
+
+        editor.input("j").unwrap();
+        assert_eq!(cursors(editor), [Point::new(2, 0)]);
+        let selections = editor.visual_selections(Active).unwrap();
+        assert_eq!(selections.primary(), (Point::new(0, 0), Point::new(2, 0)));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
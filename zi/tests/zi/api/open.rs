@@ -1,5 +1,7 @@
 use std::env;
 
+use zi::TextBase as _;
+
 use crate::new;
 
 #[tokio::test]
@@ -69,3 +71,135 @@ async fn test_open_focus() -> zi::Result<()> {
     cx.cleanup().await;
     Ok(())
 }
+
+#[tokio::test]
+async fn test_open_large_file() -> zi::Result<()> {
+    let cx = new("").await;
+    let content = (0..200_000).map(|i| format!("line {i}\n")).collect::<String>();
+    let path = cx.tempfile(&content)?;
+
+    cx.with(|editor| editor.settings().large_file_threshold.write(1024 * 1024)).await;
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+    cx.with(move |editor| {
+        assert!(editor[buf].flags().contains(zi::BufferFlags::LARGE));
+        editor.input("G").unwrap();
+    })
+    .await;
+    cx.render().await;
+
+    cx.with(move |editor| {
+        assert_eq!(editor.view(zi::Active).cursor().line(), 199_999);
+        assert_eq!(editor.cursor_line(), "line 199999");
+
+        let text = dyn_clone::clone_box(editor.text(buf)).as_boxed_any();
+        let text = text.downcast::<zi::PieceText>().expect("large file should be a piece table");
+        assert!(text.is_loaded(text.len_bytes() - 1));
+        assert!(
+            !text.is_loaded(text.len_bytes() / 2),
+            "jumping to the end shouldn't load the middle"
+        );
+
+        editor.edit(buf, &zi::Deltas::insert_at(0, "x".to_string())).unwrap();
+    })
+    .await;
+
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await?;
+    assert_eq!(std::fs::read_to_string(&path)?, format!("x{content}"));
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn test_open_large_file_invalid_utf8() -> zi::Result<()> {
+    let cx = new("").await;
+    // The invalid byte is past the start of the file that is sniffed for its encoding.
+    let mut content = "line\n".repeat(1024).into_bytes();
+    content.extend_from_slice(b"\xff\n");
+    let path = cx.tempdir()?.join("large.txt");
+    std::fs::write(&path, &content)?;
+
+    cx.with(|editor| editor.settings().large_file_threshold.write(1024)).await;
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+    cx.with(move |editor| {
+        assert!(editor[buf].flags().contains(zi::BufferFlags::LARGE));
+        editor.input("G").unwrap();
+        assert_eq!(editor.cursor_line(), "?");
+        editor.edit(buf, &zi::Deltas::insert_at(0, "x".to_string())).unwrap();
+    })
+    .await;
+
+    // Only the display of the byte is replaced, saving keeps it as it was.
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await?;
+    assert_eq!(std::fs::read(&path)?, [b"x".as_slice(), &content].concat());
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn restore_cursor_on_reopen() -> zi::Result<()> {
+    let cx = new("").await;
+    let dir = cx.tempdir()?;
+    let (a, b) = (dir.join("a.txt"), dir.join("b.txt"));
+    std::fs::write(&a, (0..20).map(|i| format!("line {i}\n")).collect::<String>())?;
+    std::fs::write(&b, "b\n")?;
+    cx.with(move |editor| editor.set_position_file(dir.join("positions.toml"))).await;
+
+    cx.open(&a, zi::OpenFlags::empty()).await?;
+    cx.with(|editor| editor.set_cursor(zi::Active, (12, 3))).await;
+    cx.open(&b, zi::OpenFlags::empty()).await?;
+    cx.with(|editor| assert_eq!(editor.cursor(zi::Active), (0, 0))).await;
+
+    cx.open(&a, zi::OpenFlags::empty()).await?;
+    cx.with(|editor| assert_eq!(editor.cursor(zi::Active), (12, 3))).await;
+
+    // Nothing is saved or restored with the option off.
+    cx.with(|editor| zi::command::set_option(editor, "restorecursor", "false")).await?;
+    cx.open(&b, zi::OpenFlags::empty()).await?;
+    cx.open(&a, zi::OpenFlags::empty()).await?;
+    cx.with(|editor| assert_eq!(editor.cursor(zi::Active), (0, 0))).await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn restore_cursor_after_file_changes() -> zi::Result<()> {
+    let dir = tempfile::tempdir()?;
+    let store = dir.path().join("positions.toml");
+    let (a, b) = (dir.path().join("a.txt"), dir.path().join("b.txt"));
+    std::fs::write(&a, (0..10).map(|i| format!("line {i}\n")).collect::<String>())?;
+    std::fs::write(&b, "b\n")?;
+
+    let open = |store: std::path::PathBuf, path: std::path::PathBuf| async move {
+        let cx = new("").await;
+        cx.with(move |editor| editor.set_position_file(store)).await;
+        cx.open(&path, zi::OpenFlags::empty()).await?;
+        zi::Result::Ok(cx)
+    };
+
+    // The position is saved when the view is closed and picked up by the next editor to open the file.
+    let cx = open(store.clone(), a.clone()).await?;
+    cx.with(|editor| {
+        editor.split(zi::Active, zi::Direction::Right, zi::Constraint::Fill(1));
+        editor.set_cursor(zi::Active, (8, 4));
+        editor.close_view(zi::Active);
+    })
+    .await;
+    cx.cleanup().await;
+
+    // The file has fewer lines but about the same size, the cursor is kept in bounds.
+    std::fs::write(&a, "a line that is longer\n".repeat(3))?;
+    let cx = open(store.clone(), a.clone()).await?;
+    cx.with(|editor| assert_eq!(editor.cursor(zi::Active), (2, 4))).await;
+    cx.open(&b, zi::OpenFlags::empty()).await?;
+    cx.cleanup().await;
+
+    // The file was replaced with something else entirely, the position is forgotten.
+    std::fs::write(&a, "x\n")?;
+    let cx = open(store, a).await?;
+    cx.with(|editor| assert_eq!(editor.cursor(zi::Active), (0, 0))).await;
+    cx.cleanup().await;
+    Ok(())
+}
@@ -0,0 +1,64 @@
+use zi::input::Event;
+use zi::{Active, Mode, Point};
+
+use crate::new;
+
+#[track_caller]
+fn paste(editor: &mut zi::Editor, text: &str) {
+    let seq = format!("\x1b[200~{text}\x1b[201~");
+    editor.handle_input(Event::from_bracketed_paste(&seq).expect("invalid bracketed paste"));
+}
+
+#[tokio::test]
+async fn paste_is_literal() {
+    let cx = new("").await;
+    cx.with(|editor| {
+        editor.set_mode(Mode::Insert);
+        // None of this is interpreted as keys, and the indentation isn't doubled up by auto-indent.
+        paste(editor, "dd:q\r\n    <ESC>ix\n");
+        assert_eq!(editor.mode(), Mode::Insert);
+        assert_eq!(editor.text(Active).to_string(), "dd:q\n    <ESC>ix\n");
+        assert_eq!(editor.cursor(Active), Point::new(2, 0));
+
+        // The whole paste is undone at once.
+        editor.undo(Active).unwrap();
+        assert_eq!(editor.text(Active).to_string(), "");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn paste_at_each_cursor() {
+    let cx = new("abc\nabc\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 1));
+        editor.add_cursor_down(Active);
+        editor.set_mode(Mode::Insert);
+
+        paste(editor, "jk");
+        assert_eq!(editor.text(Active).to_string(), "ajkbc\najkbc\n");
+        let cursors = editor.view(Active).cursors().collect::<Vec<_>>();
+        assert_eq!(cursors, [Point::new(0, 3), Point::new(1, 3)]);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn paste_in_normal_mode() {
+    let cx = new("ab\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (0, 1));
+        paste(editor, "xyz");
+        assert_eq!(editor.mode(), Mode::Normal);
+        assert_eq!(editor.text(Active).to_string(), "axyzb\n");
+        // Rests on the last pasted character.
+        assert_eq!(editor.cursor(Active), Point::new(0, 3));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
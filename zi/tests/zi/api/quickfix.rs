@@ -0,0 +1,191 @@
+use std::path::{Path, PathBuf};
+
+use zi::lstypes::{self, Point};
+use zi::{Active, QuickfixEntry};
+use zi_test::TestContext;
+
+use crate::new;
+
+fn entry(path: &Path, line: usize, col: usize, message: &str) -> QuickfixEntry {
+    QuickfixEntry {
+        path: path.to_path_buf(),
+        point: Point::new(line, col).into(),
+        message: message.to_string(),
+    }
+}
+
+/// Make `:grep` print the file instead of searching so it can be given fake output.
+async fn fake_grep(cx: &TestContext, output: &str) -> zi::Result<PathBuf> {
+    let path = cx.tempfile(output)?;
+    cx.with(|editor| editor.settings().grep_program.write("cat".to_string())).await;
+    Ok(path)
+}
+
+async fn step(cx: &TestContext, next: bool) -> zi::Result<()> {
+    cx.with(move |editor| if next { editor.quickfix_next() } else { editor.quickfix_prev() })
+        .await?
+        .await
+}
+
+#[tokio::test]
+async fn grep_populates_quickfix() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let dir = cx.tempdir()?;
+    let a = dir.join("a.txt");
+    let b = dir.join("b.txt");
+    std::fs::write(&a, "foo\nbar foo\n")?;
+    std::fs::write(&b, "foo\n")?;
+
+    let a_path = a.display();
+    let b_path = b.display();
+    // Lines that aren't matches are skipped and the column is optional as with `grep -n`.
+    let output = fake_grep(
+        &cx,
+        &format!("{a_path}:2:5:bar foo\nnot a match\n{b_path}:1:1:foo\n{a_path}:1:foo\n"),
+    )
+    .await?;
+
+    cx.with(move |editor| editor.grep([output], true)).await?.await?;
+    cx.with({
+        let (a, b) = (a.clone(), b.clone());
+        move |editor| {
+            assert_eq!(
+                editor.quickfix_entries(),
+                [entry(&a, 1, 4, "bar foo"), entry(&b, 0, 0, "foo"), entry(&a, 0, 0, "foo")]
+            );
+            // The first match is jumped to.
+            assert_eq!(editor.quickfix_index(), Some(0));
+            assert_eq!(editor.buffer(Active).file_path(), Some(a));
+            assert_eq!(editor.cursor(Active), (1, 4));
+        }
+    })
+    .await;
+
+    step(&cx, true).await?;
+    cx.with({
+        let b = b.clone();
+        move |editor| {
+            assert_eq!(editor.buffer(Active).file_path(), Some(b));
+            assert_eq!(editor.cursor(Active), (0, 0));
+        }
+    })
+    .await;
+
+    step(&cx, true).await?;
+    let err = step(&cx, true).await.unwrap_err();
+    assert_eq!(err.to_string(), "no more items");
+
+    step(&cx, false).await?;
+    cx.with(move |editor| {
+        assert_eq!(editor.quickfix_index(), Some(1));
+        assert_eq!(editor.buffer(Active).file_path(), Some(b));
+    })
+    .await;
+
+    // `:cc` jumps to an entry by its number.
+    cx.with(|editor| editor.quickfix_goto(0)).await?.await?;
+    cx.with(move |editor| {
+        assert_eq!(editor.buffer(Active).file_path(), Some(a));
+        assert_eq!(editor.cursor(Active), (1, 4));
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn grep_streams_large_output() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let path = cx.tempfile("foo\n")?;
+    let output = (1..=5000).map(|i| format!("{}:1:{i}:foo\n", path.display())).collect::<String>();
+    let output = fake_grep(&cx, &output).await?;
+
+    // Without jumping the list is still filled, the whole output arrives over several batches.
+    cx.with(move |editor| editor.grep([output], false)).await?.await?;
+    cx.with(|editor| {
+        assert_eq!(editor.quickfix_entries().len(), 5000);
+        assert_eq!(editor.quickfix_entries()[4999].point, Point::new(0, 4999).into());
+        assert_eq!(editor.quickfix_index(), None);
+    })
+    .await;
+
+    let empty = fake_grep(&cx, "").await?;
+    let err = cx.with(move |editor| editor.grep([empty], true)).await?.await.unwrap_err();
+    assert_eq!(err.to_string(), "no matches");
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn quickfix_deleted_file() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let a = cx.tempfile("a\n")?;
+    let b = cx.tempfile("b\n")?;
+    let deleted = cx.tempfile("deleted\n")?;
+    std::fs::remove_file(&deleted)?;
+
+    cx.with({
+        let entries = [entry(&a, 0, 0, ""), entry(&deleted, 0, 0, "gone"), entry(&b, 0, 0, "")];
+        move |editor| editor.set_quickfix(entries)
+    })
+    .await;
+
+    step(&cx, true).await?;
+    let err = step(&cx, true).await.unwrap_err();
+    assert!(err.to_string().contains("no longer exists"), "{err}");
+
+    // The deleted entry is stepped past.
+    step(&cx, true).await?;
+    cx.with(move |editor| {
+        assert_eq!(editor.quickfix_index(), Some(2));
+        assert_eq!(editor.buffer(Active).file_path(), Some(b));
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn quickfix_from_diagnostics() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let a = cx.tempfile("a\n")?;
+    cx.with({
+        let a = a.clone();
+        move |editor| {
+            let diag = |line, message: &str| lstypes::Diagnostic {
+                range: lstypes::EncodedRange::new(
+                    lstypes::PositionEncoding::Utf8,
+                    lstypes::PointRange::new(Point::new(line, 1), Point::new(line, 2)),
+                ),
+                severity: lstypes::Severity::Error,
+                message: message.to_string(),
+            };
+            editor.replace_diagnostics(
+                a,
+                None,
+                lstypes::Diagnostics::Full(vec![diag(0, "first\ndetails"), diag(3, "second")]),
+            );
+            editor.set_quickfix_diagnostics();
+        }
+    })
+    .await;
+
+    cx.with(move |editor| {
+        // Only the first line of each message is kept.
+        assert_eq!(
+            editor.quickfix_entries(),
+            [entry(&a, 0, 1, "first"), entry(&a, 3, 1, "second")]
+        );
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
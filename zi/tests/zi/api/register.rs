@@ -0,0 +1,183 @@
+use std::io;
+use std::sync::{Arc, Mutex};
+
+use zi::clipboard::Osc52;
+use zi::{Active, RegisterKind};
+
+use crate::new;
+
+#[tokio::test]
+async fn named_register_yank_and_paste() {
+    let cx = new("a\nb\nc\n").await;
+    cx.with(|editor| {
+        editor.input("\"ayyjyy").unwrap();
+        assert_eq!(editor.register('a').unwrap().content, "a");
+        assert_eq!(editor.register('"').unwrap().content, "b");
+
+        editor.input("\"ap").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\nb\na\nc\n");
+
+        // The register only applies to the command immediately following it.
+        editor.input("p").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\nb\na\nb\nc\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn uppercase_register_appends() {
+    let cx = new("a\nb\nc\n").await;
+    cx.with(|editor| {
+        editor.input("\"ayyj\"Ayy").unwrap();
+        let reg = editor.register('a').unwrap();
+        assert_eq!(reg.content, "a\nb");
+        assert_eq!(reg.kind, RegisterKind::Linewise);
+
+        editor.input("j\"ap").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\nb\nc\na\nb\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn yank_register_is_not_overwritten_by_delete() {
+    let cx = new("a\nb\nc\n").await;
+    cx.with(|editor| {
+        editor.input("yyjdd").unwrap();
+        assert_eq!(editor.register('0').unwrap().content, "a");
+        assert_eq!(editor.register('1').unwrap().content, "b\n");
+        assert_eq!(editor.register('"').unwrap().content, "b\n");
+
+        editor.input("\"0p").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a\nc\na\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn numbered_registers_shift_on_delete() {
+    let cx = new("1\n2\n3\n4\n").await;
+    cx.with(|editor| {
+        editor.input("dddddd").unwrap();
+        assert_eq!(editor.register('1').unwrap().content, "3\n");
+        assert_eq!(editor.register('2').unwrap().content, "2\n");
+        assert_eq!(editor.register('3').unwrap().content, "1\n");
+        assert!(editor.register('4').is_none());
+
+        // Deleting into a named register leaves the numbered registers alone.
+        editor.input("\"add").unwrap();
+        assert_eq!(editor.register('a').unwrap().content, "4\n");
+        assert_eq!(editor.register('1').unwrap().content, "3\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn blackhole_register() {
+    let cx = new("a\nb\n").await;
+    cx.with(|editor| {
+        editor.input("yy\"_dd").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "b\n");
+        assert_eq!(editor.register('"').unwrap().content, "a");
+        assert!(editor.register('1').is_none());
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn registers_survive_mode_switches() {
+    let cx = new("hello world\n").await;
+    cx.with(|editor| {
+        editor.input("\"byw\"ayy").unwrap();
+        editor.input("ifoo <ESC>").unwrap();
+        editor.input("v<ESC>V<ESC>:<ESC>").unwrap();
+
+        let reg = editor.register('a').unwrap();
+        assert_eq!(reg.content, "hello world");
+        assert_eq!(reg.kind, RegisterKind::Linewise);
+
+        let reg = editor.register('b').unwrap();
+        assert_eq!(reg.content, "hello ");
+        assert_eq!(reg.kind, RegisterKind::Charwise);
+
+        editor.input("\"ap").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "foo hello world\nhello world\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn visual_yank_into_named_register() {
+    let cx = new("hello world\n").await;
+    cx.with(|editor| {
+        editor.input("vll\"cy").unwrap();
+        let reg = editor.register('c').unwrap();
+        assert_eq!(reg.content, "hel");
+        assert_eq!(reg.kind, RegisterKind::Charwise);
+        assert_eq!(editor.register('0').map(|reg| reg.content), None);
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn search_register() {
+    let cx = new("abc\n").await;
+    cx.with(|editor| {
+        editor.input("/bc<CR>").unwrap();
+        assert_eq!(editor.register('/').unwrap().content, "bc");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn clipboard_register_osc52() {
+    #[derive(Clone, Default)]
+    struct Terminal(Arc<Mutex<Vec<u8>>>);
+
+    impl io::Write for Terminal {
+        fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+            self.0.lock().unwrap().write(buf)
+        }
+
+        fn flush(&mut self) -> io::Result<()> {
+            Ok(())
+        }
+    }
+
+    let cx = new("hello\nworld\n").await;
+    let term = Terminal::default();
+    cx.with({
+        let term = term.clone();
+        move |editor| {
+            editor.set_clipboard(Osc52::new(term.clone()));
+            editor.input("\"+yy").unwrap();
+            assert_eq!(editor.get_error(), None);
+            assert_eq!(
+                String::from_utf8(term.0.lock().unwrap().clone()).unwrap(),
+                "\x1b]52;c;aGVsbG8=\x07"
+            );
+
+            // OSC 52 can't read the clipboard, so this pastes what was copied.
+            editor.input("j\"+p").unwrap();
+            assert_eq!(editor.text(Active).to_string(), "hello\nworld\nhello\n");
+
+            // Deleting into the clipboard register copies too.
+            term.0.lock().unwrap().clear();
+            editor.input("\"+dd").unwrap();
+            assert_eq!(
+                String::from_utf8(term.0.lock().unwrap().clone()).unwrap(),
+                "\x1b]52;c;aGVsbG8K\x07"
+            );
+        }
+    })
+    .await;
+    cx.cleanup().await;
+}
@@ -26,3 +26,49 @@ async fn save() -> zi::Result<()> {
 
     Ok(())
 }
+
+#[cfg(unix)]
+#[tokio::test]
+async fn sudo_write() -> zi::Result<()> {
+    use std::fs::{self, Permissions};
+    use std::os::unix::fs::PermissionsExt;
+
+    let cx = new("").await;
+    let dir = cx.tempdir()?;
+    let path = dir.join("protected.txt");
+    fs::write(&path, "abc\n")?;
+    fs::set_permissions(&path, Permissions::from_mode(0o444))?;
+
+    // Stands in for `sudo -A tee`, the file is only writable while it's written as if by a privileged user.
+    let writer = dir.join("writer");
+    fs::write(&writer, "#!/bin/sh\nchmod u+w \"$1\" && cat > \"$1\" && chmod u-w \"$1\"\n")?;
+
+    let buf = cx.open(&path, zi::OpenFlags::empty()).await?;
+    cx.with(move |editor| {
+        editor.edit(buf, &zi::Deltas::insert_at(3, "def".to_string())).unwrap();
+        // A failed write leaves the buffer modified.
+        editor.settings().sudo_write_program.write("false".to_string());
+    })
+    .await;
+
+    let res = cx.with(move |editor| editor.save(buf, zi::SaveFlags::empty())).await.await;
+    // The file is readonly whether or not the user could write it anyway, e.g. as root.
+    assert!(res.is_err(), "a plain write should be denied permission");
+    let res = cx.with(move |editor| editor.save(buf, zi::SaveFlags::SUDO)).await.await;
+    assert!(res.is_err(), "the failing program should fail the write");
+    cx.with(move |editor| assert!(editor[buf].flags().contains(zi::BufferFlags::DIRTY))).await;
+    assert_eq!(fs::read_to_string(&path)?, "abc\n");
+
+    cx.with(move |editor| {
+        editor.settings().sudo_write_program.write(format!("sh {}", writer.display()))
+    })
+    .await;
+    cx.with(move |editor| editor.save(buf, zi::SaveFlags::SUDO)).await.await?;
+    cx.with(move |editor| assert!(!editor[buf].flags().contains(zi::BufferFlags::DIRTY))).await;
+    assert_eq!(fs::read_to_string(&path)?, "abcdef\n");
+    // The file was written in place, so it keeps its permissions.
+    assert_eq!(fs::metadata(&path)?.permissions().mode() & 0o777, 0o444);
+
+    cx.cleanup().await;
+    Ok(())
+}
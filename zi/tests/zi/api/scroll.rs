@@ -121,3 +121,82 @@ async fn scroll_bounds_check() {
     .await;
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn scrolloff() {
+    let text = (1..=20).map(|n| n.to_string()).collect::<Vec<_>>().join("\n");
+    // 10 rows are left for the view after the status line and command line.
+    let cx = new(&text).with_size((10, 12)).await;
+    cx.with(|editor| {
+        zi::command::set_option(editor, "scrolloff", "3").unwrap();
+
+        editor.input("6j").unwrap();
+        assert_eq!(editor.view(zi::Active).offset(), (0, 0));
+
+        // The view scrolls while there are still 3 rows below the cursor.
+        editor.input("j").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (7, 0));
+        assert_eq!(editor.view(zi::Active).offset(), (1, 0));
+
+        // The view doesn't scroll past the end of the text, the last line is on the last row.
+        editor.input("12j").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (19, 0));
+        assert_eq!(editor.view(zi::Active).offset(), (10, 0));
+
+        editor.input("6k").unwrap();
+        assert_eq!(editor.view(zi::Active).offset(), (10, 0));
+        editor.input("k").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (12, 0));
+        assert_eq!(editor.view(zi::Active).offset(), (9, 0));
+
+        editor.input("zz").unwrap();
+        assert_eq!(editor.view(zi::Active).offset(), (7, 0));
+        // The rows of context are kept when aligning to the top and bottom too.
+        editor.input("zt").unwrap();
+        assert_eq!(editor.view(zi::Active).offset(), (9, 0));
+        editor.input("zb").unwrap();
+        assert_eq!(editor.view(zi::Active).offset(), (6, 0));
+        assert_eq!(editor.cursor(zi::Active), (12, 0));
+
+        // A cursor too close to the top of the view moves down with the view.
+        editor.set_cursor(zi::Active, (0, 0));
+        editor.input("<C-e>").unwrap();
+        assert_eq!(editor.view(zi::Active).offset(), (1, 0));
+        assert_eq!(editor.cursor(zi::Active), (4, 0));
+
+        // Half the view is the most context there can be, so a large scrolloff keeps the cursor in the middle.
+        zi::command::set_option(editor, "so", "100").unwrap();
+        editor.input("3j").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (7, 0));
+        assert_eq!(editor.view(zi::Active).offset(), (2, 0));
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn scrolloff_folds() {
+    let text = (1..=20).map(|n| n.to_string()).collect::<Vec<_>>().join("\n");
+    let cx = new(&text).with_size((10, 8)).await;
+    cx.with(|editor| {
+        zi::command::set_option(editor, "scrolloff", "2").unwrap();
+        editor.set_cursor(zi::Active, (2, 0));
+        editor.input("zf8j").unwrap();
+
+        // The closed fold takes up a single row of the view.
+        editor.input("j").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (11, 0));
+        assert_eq!(editor.view(zi::Active).offset(), (0, 0));
+
+        editor.input("j").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (12, 0));
+        assert_eq!(editor.view(zi::Active).offset(), (1, 0));
+
+        // Moving up keeps 2 rows above the cursor, one of which is the fold.
+        editor.input("2k").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (2, 0));
+        assert_eq!(editor.view(zi::Active).offset(), (0, 0));
+    })
+    .await;
+    cx.cleanup().await;
+}
@@ -84,3 +84,64 @@ abc
     .await;
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn search_wraparound() {
+    let cx = new("abc\nabc\nabc\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (2, 0));
+        editor.input("/abc<CR>").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+        assert_eq!(editor.get_message(), None);
+
+        editor.input("n").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 0));
+        assert_eq!(editor.get_message(), Some("search hit BOTTOM, continuing at TOP"));
+
+        editor.input("n").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 0));
+        assert_eq!(editor.get_message(), None);
+
+        editor.input("NN").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+        assert_eq!(editor.get_message(), Some("search hit TOP, continuing at BOTTOM"));
+        assert_eq!(editor.register('/').unwrap().content, "abc");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn search_smartcase() {
+    let cx = new("foo Foo FOO\n").await;
+    cx.with(|editor| {
+        assert!(editor.search("foo").map(|m| m.range()).eq([0..3, 4..7, 8..11]));
+        assert!(editor.search("Foo").map(|m| m.range()).eq([4..7]));
+        assert!(editor.search("FOO").map(|m| m.range()).eq([8..11]));
+        assert!(editor.search("fOo").next().is_none());
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn search_cancel_restores_cursor() {
+    let cx = new("abc\ndef\nabc\n").await;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (1, 1));
+        editor.input("/ab").unwrap();
+        // The cursor previews the next match while typing.
+        assert_eq!(editor.cursor(Active), (2, 0));
+        assert_eq!(editor.matches().len(), 2);
+
+        // Refining the query still searches from where the search started.
+        editor.input("c").unwrap();
+        assert_eq!(editor.cursor(Active), (2, 0));
+
+        editor.input("<ESC>").unwrap();
+        assert_eq!(editor.mode(), zi::Mode::Normal);
+        assert_eq!(editor.cursor(Active), (1, 1));
+    })
+    .await;
+    cx.cleanup().await;
+}
@@ -0,0 +1,109 @@
+use zi::{Active, Constraint, Direction, OpenFlags};
+
+use crate::new;
+
+#[tokio::test]
+async fn session_roundtrip() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let a = cx.tempfile(&(0..100).map(|i| format!("{i}\n")).collect::<String>())?;
+    let b = cx.tempfile("b\nbb\n")?;
+    let session = cx.tempdir()?.join("session.toml");
+
+    cx.open(&a, OpenFlags::empty()).await?;
+    cx.with(|editor| {
+        editor.set_cursor(Active, (50, 1));
+        editor.input("ma").unwrap();
+        editor.split(Active, Direction::Right, Constraint::Percentage(30));
+    })
+    .await;
+    cx.open(&b, OpenFlags::empty()).await?;
+
+    let (saved, views) = cx
+        .with({
+            let session = session.clone();
+            move |editor| {
+                editor.set_cursor(Active, (1, 1));
+                editor.save_session(&session).unwrap();
+                let views = editor
+                    .views()
+                    .map(|view| (editor[view.buffer()].file_path(), view.cursor(), view.offset()))
+                    .collect::<Vec<_>>();
+                (std::fs::read_to_string(&session).unwrap(), views)
+            }
+        })
+        .await;
+    assert!(views[0].2.line > 0, "the first view should be scrolled");
+    cx.cleanup().await;
+
+    let cx = new("").await;
+    cx.with({
+        let session = session.clone();
+        move |editor| editor.load_session(session)
+    })
+    .await?
+    .await?;
+
+    cx.with(move |editor| {
+        assert!(editor.get_error().is_none());
+        let restored = editor
+            .views()
+            .map(|view| (editor[view.buffer()].file_path(), view.cursor(), view.offset()))
+            .collect::<Vec<_>>();
+        assert_eq!(restored, views);
+        assert_eq!(editor.buffer(Active).file_path(), views[1].0);
+
+        let mark = editor.mark_location(Active, 'a');
+        assert!(mark.is_none(), "lowercase marks are local to the buffer");
+        let buf = editor.views().next().unwrap().buffer();
+        assert_eq!(editor.mark_location(buf, 'a').unwrap().point, (50, 1).into());
+
+        // Saving the restored session should give back the same session.
+        editor.save_session(&session).unwrap();
+        assert_eq!(std::fs::read_to_string(&session).unwrap(), saved);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn session_skips_missing_files() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let a = cx.tempfile("a\n")?;
+    let b = cx.tempfile("b\n")?;
+    let session = cx.tempdir()?.join("session.toml");
+
+    let a = cx.open(&a, OpenFlags::empty()).await?;
+    cx.with(|editor| editor.split(Active, Direction::Down, Constraint::Fill(1))).await;
+    cx.open(&b, OpenFlags::empty()).await?;
+    let a = cx
+        .with({
+            let session = session.clone();
+            move |editor| {
+                editor.save_session(session).unwrap();
+                editor[a].file_path()
+            }
+        })
+        .await;
+    cx.cleanup().await;
+
+    std::fs::remove_file(&b)?;
+
+    let cx = new("").await;
+    cx.with(move |editor| editor.load_session(session)).await?.await?;
+    cx.with(move |editor| {
+        let error = editor.get_error().unwrap().to_string();
+        assert!(error.contains("skipped missing file"), "{error}");
+
+        let paths =
+            editor.views().map(|view| editor[view.buffer()].file_path()).collect::<Vec<_>>();
+        assert_eq!(paths, [a, None]);
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -0,0 +1,75 @@
+use zi::{Active, Mode, OpenFlags};
+
+use crate::new;
+
+#[tokio::test]
+async fn snippet_tabstops() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        editor.set_mode(Mode::Insert);
+        editor
+            .insert_snippet(Active, 0..0, "let ${1:x}: ${2:T} = ${3:$2::default()};$0 // $1")
+            .unwrap();
+        assert_eq!(editor.cursor_line(), "let x: T = T::default(); // x");
+        assert_eq!(editor.cursor(Active), (0, 4));
+
+        // Typing replaces the placeholder and its mirror.
+        editor.input("value").unwrap();
+        assert_eq!(editor.cursor_line(), "let value: T = T::default(); // value");
+
+        editor.input("<Tab>").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 11));
+        editor.input("u8").unwrap();
+        assert_eq!(editor.cursor_line(), "let value: u8 = u8::default(); // value");
+
+        // The tabstop nested in the placeholder is part of it.
+        editor.input("<Tab>").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 16));
+
+        editor.input("<S-Tab>").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 11));
+        editor.input("i64<Tab>").unwrap();
+        assert_eq!(editor.cursor_line(), "let value: i64 = i64::default(); // value");
+        assert_eq!(editor.cursor(Active), (0, 17));
+
+        // `$0` is last and ends the snippet, `<Tab>` inserts an indent again after it.
+        editor.input("<Tab>").unwrap();
+        assert_eq!(editor.cursor(Active), (0, 32));
+        editor.input("<Tab>").unwrap();
+        assert_eq!(editor.cursor_line(), "let value: i64 = i64::default();     // value");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn user_snippets() -> zi::Result<()> {
+    let cx = new("").await;
+
+    let dir = cx.tempdir()?.join("snippets");
+    std::fs::create_dir(&dir)?;
+    std::fs::write(dir.join("text.toml"), "fn = \"fn ${1:name}() {\\n\\t$0\\n}\"\n")?;
+    cx.open_tmp("", OpenFlags::empty()).await?;
+
+    cx.with(move |editor| {
+        editor.set_snippet_dir(dir);
+        editor.input("i  fn<Tab>").unwrap();
+        // The snippet is indented to line up with the line it's expanded on.
+        assert_eq!(editor.text(Active).to_string(), "  fn name() {\n  \t\n  }\n");
+        assert_eq!(editor.cursor(Active), (0, 5));
+
+        editor.input("main<Tab>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "  fn main() {\n  \t\n  }\n");
+        assert_eq!(editor.cursor(Active), (1, 3));
+
+        // Words without a snippet are left alone.
+        editor.input("nope<Tab>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "  fn main() {\n  \tnope    \n  }\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
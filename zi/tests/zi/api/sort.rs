@@ -0,0 +1,53 @@
+use zi::Active;
+use zi_test::TestContext;
+
+use crate::new;
+
+async fn sort(cx: &TestContext, cmd: &'static str, expected: &'static str) {
+    cx.with(move |editor| editor.execute(cmd).unwrap()).await;
+    cx.with(move |editor| assert_eq!(editor.text(Active).to_string(), expected, "{cmd}")).await;
+}
+
+#[tokio::test]
+async fn sort_numeric_and_lexical() {
+    let cx = new("10 b\n9 a\nx\n100 c\n-3 d\n").await;
+
+    sort(&cx, "sort", "-3 d\n10 b\n100 c\n9 a\nx\n").await;
+    // Lines without a number go first.
+    sort(&cx, "sort n", "x\n-3 d\n9 a\n10 b\n100 c\n").await;
+    sort(&cx, "sort nr", "100 c\n10 b\n9 a\n-3 d\nx\n").await;
+    sort(&cx, "sort!", "x\n9 a\n100 c\n10 b\n-3 d\n").await;
+
+    // Only the lines in the range are sorted.
+    sort(&cx, "2,4sort", "x\n10 b\n100 c\n9 a\n-3 d\n").await;
+
+    cx.with(|editor| {
+        assert_eq!(editor.cursor(Active), (1, 0));
+        // Each sort is a single undo step.
+        editor.undo(Active).unwrap();
+        assert_eq!(editor.text(Active).to_string(), "x\n9 a\n100 c\n10 b\n-3 d\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn sort_unique() {
+    let cx = new("b\nA\na\nb\nB\n").await;
+
+    sort(&cx, "sort u", "A\nB\na\nb\n").await;
+    sort(&cx, "sort iu", "A\nB\n").await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn sort_by_pattern() {
+    let cx = new("x=b 2\ny=a 3\nz=c 1\n").await;
+
+    sort(&cx, r"sort /=(\w+)/", "y=a 3\nx=b 2\nz=c 1\n").await;
+    sort(&cx, r"sort n /\d+$/", "z=c 1\nx=b 2\ny=a 3\n").await;
+
+    cx.cleanup().await;
+}
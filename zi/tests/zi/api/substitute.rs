@@ -0,0 +1,99 @@
+use zi::Active;
+
+use crate::new;
+
+#[tokio::test]
+async fn substitute_capture_groups() {
+    let cx = new("hello world\nfoo bar\n").await;
+    cx.with(|editor| {
+        editor.input(r":%s/(\w+) (\w+)/\2 \1/<CR>").unwrap();
+        assert_eq!(editor.get_error(), None);
+        assert_eq!(editor.text(Active).to_string(), "world hello\nbar foo\n");
+
+        editor.input(r":%s/o/[&]/g<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "w[o]rld hell[o]\nbar f[o][o]\n");
+
+        // All the replacements are undone at once.
+        editor.undo(Active).unwrap();
+        assert_eq!(editor.text(Active).to_string(), "world hello\nbar foo\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn substitute_ranges() {
+    let cx = new("a a\na a\na a\na a\n").await;
+    cx.with(|editor| {
+        editor.input(":2,3s/a/b/<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a a\nb a\nb a\na a\n");
+        // The cursor is left on the line of the last substitution.
+        assert_eq!(editor.cursor(Active).line(), 2);
+
+        editor.input(":.,$s/a/c/g<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a a\nb a\nb c\nc c\n");
+
+        editor.input(":-2s/a/d/<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "a a\nb d\nb c\nc c\n");
+
+        // Smartcase, an uppercase character in the pattern makes it case sensitive unless overridden by `i`.
+        editor.input(":%s/A/e/g<CR>").unwrap();
+        assert!(editor.get_error().unwrap().contains("pattern not found"));
+        editor.input(":%s/A/e/gi<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "e e\nb d\nb c\nc c\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn substitute_zero_width() {
+    let cx = new("a\nbc\n").await;
+    cx.with(|editor| {
+        editor.input(":%s/^/> /<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "> a\n> bc\n");
+
+        editor.input(":%s/$/;/<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "> a;\n> bc;\n");
+
+        // Replacements can span lines.
+        editor.input(r":%s/;\n>/,/<CR>").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "> a, bc;\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn substitute_confirm() {
+    let cx = new("x x x\nx\n").await;
+    cx.with(|editor| {
+        editor.input(":%s/x/y/gc<CR>").unwrap();
+        assert_eq!(editor.get_message(), Some("replace with y (y/n/a/q)?"));
+        assert_eq!(editor.cursor(Active).col(), 0);
+        assert_eq!(editor.text(Active).to_string(), "x x x\nx\n");
+
+        editor.input("y").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "y x x\nx\n");
+        assert_eq!(editor.cursor(Active).col(), 2);
+
+        editor.input("n").unwrap();
+        assert_eq!(editor.cursor(Active).col(), 4);
+
+        editor.input("a").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "y x y\ny\n");
+        assert_eq!(editor.get_message(), None);
+
+        // The keys go back to the keymap once the substitution is done.
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "x x x\nx\n");
+
+        editor.input(":%s/x/z/gc<CR>yq").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "z x x\nx\n");
+        assert_eq!(editor.get_message(), None);
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(Active).to_string(), "x x x\nx\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
@@ -0,0 +1,125 @@
+use zi::{Active, Mode};
+
+use crate::new;
+
+#[tokio::test]
+async fn surround_add() -> zi::Result<()> {
+    let cx = new("foo(bar, baz)").await;
+
+    cx.with(|editor| {
+        let text = |editor: &zi::Editor| editor.text(Active).to_string();
+
+        editor.set_cursor(Active, (0, 4));
+        editor.input("ysiw]").unwrap();
+        assert_eq!(text(editor), "foo([bar], baz)\n");
+        assert_eq!(editor.mode(), Mode::Normal);
+        assert_eq!(editor.cursor(Active), (0, 4));
+
+        editor.input("ysa)}").unwrap();
+        assert_eq!(text(editor), "foo{([bar], baz)}\n");
+        assert_eq!(editor.cursor(Active), (0, 3));
+
+        // The opening bracket pads with spaces.
+        editor.input("yss(").unwrap();
+        assert_eq!(text(editor), "( foo{([bar], baz)} )\n");
+
+        editor.input("u").unwrap();
+        assert_eq!(text(editor), "foo{([bar], baz)}\n");
+
+        editor.set_cursor(Active, (0, 12));
+        editor.input("vllS'").unwrap();
+        assert_eq!(text(editor), "foo{([bar], 'baz')}\n");
+        assert_eq!(editor.mode(), Mode::Normal);
+
+        editor.set_cursor(Active, (0, 6));
+        editor.input("ysiw<lt>em>").unwrap();
+        assert_eq!(text(editor), "foo{([<em>bar</em>], 'baz')}\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn surround_delete() -> zi::Result<()> {
+    let cx = new("foo(bar(baz))").await;
+
+    cx.with(|editor| {
+        let text = |editor: &zi::Editor| editor.text(Active).to_string();
+
+        editor.set_cursor(Active, (0, 8));
+        editor.input("ds)").unwrap();
+        assert_eq!(text(editor), "foo(barbaz)\n");
+        assert_eq!(editor.cursor(Active), (0, 7));
+
+        editor.input("dsb").unwrap();
+        assert_eq!(text(editor), "foobarbaz\n");
+
+        // Nothing to delete.
+        editor.input("ds]").unwrap();
+        assert_eq!(text(editor), "foobarbaz\n");
+        assert!(editor.get_error().is_some());
+
+        // The opening bracket also deletes the whitespace inside.
+        editor.edit(Active, &zi::Deltas::insert_at(0, "{ [ x ] } ".to_string())).unwrap();
+        editor.set_cursor(Active, (0, 4));
+        editor.input("ds]").unwrap();
+        assert_eq!(text(editor), "{  x  } foobarbaz\n");
+        editor.input("ds{").unwrap();
+        assert_eq!(text(editor), "x foobarbaz\n");
+
+        editor.edit(Active, &zi::Deltas::insert_at(0, "<p><b>\"y\"</b></p> ".to_string())).unwrap();
+        editor.set_cursor(Active, (0, 7));
+        editor.input("ds\"").unwrap();
+        assert_eq!(text(editor), "<p><b>y</b></p> x foobarbaz\n");
+        editor.input("dst").unwrap();
+        assert_eq!(text(editor), "<p>y</p> x foobarbaz\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn surround_change() -> zi::Result<()> {
+    let cx = new("[(a), (b)]").await;
+
+    cx.with(|editor| {
+        let text = |editor: &zi::Editor| editor.text(Active).to_string();
+
+        editor.set_cursor(Active, (0, 7));
+        editor.input("cs)]").unwrap();
+        assert_eq!(text(editor), "[(a), [b]]\n");
+        assert_eq!(editor.cursor(Active), (0, 6));
+
+        editor.input("cs]}").unwrap();
+        assert_eq!(text(editor), "[(a), {b}]\n");
+
+        // The cursor is on the inner brace so the outer bracket is the one around it.
+        editor.input("cs]{").unwrap();
+        assert_eq!(text(editor), "{ (a), {b} }\n");
+
+        editor.input("u").unwrap();
+        assert_eq!(text(editor), "[(a), {b}]\n");
+
+        editor.set_cursor(Active, (0, 2));
+        editor.input("cs)'").unwrap();
+        assert_eq!(text(editor), "['a', {b}]\n");
+        editor.input("cs'<lt>div>").unwrap();
+        assert_eq!(text(editor), "[<div>a</div>, {b}]\n");
+
+        editor.input("cstt").unwrap();
+        assert_eq!(editor.get_message(), Some("<"));
+        editor.input("span<BS>n<CR>").unwrap();
+        assert_eq!(text(editor), "[<span>a</span>, {b}]\n");
+
+        editor.input("cstb").unwrap();
+        assert_eq!(text(editor), "[(a), {b}]\n");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
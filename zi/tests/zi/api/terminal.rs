@@ -0,0 +1,70 @@
+use std::time::Duration;
+
+use zi::{Active, BufferId, Mode};
+use zi_test::TestContext;
+
+use crate::new;
+
+/// Wait for the process to write the expected output to the terminal.
+async fn wait_for(cx: &TestContext, buf: BufferId, expected: &'static str) -> String {
+    for _ in 0..200 {
+        let text = cx.with(move |editor| editor.text(buf).to_string()).await;
+        if text.contains(expected) {
+            return text;
+        }
+        tokio::time::sleep(Duration::from_millis(10)).await;
+    }
+
+    let text = cx.with(move |editor| editor.text(buf).to_string()).await;
+    panic!("terminal output {text:?} does not contain {expected:?}")
+}
+
+#[tokio::test]
+async fn terminal_echo() {
+    let cx = new("").await;
+
+    cx.with(|editor| editor.execute("terminal echo hello").unwrap()).await;
+    let buf = cx
+        .with(|editor| {
+            assert_eq!(editor.mode(), Mode::Insert);
+            assert_eq!(editor.views().count(), 2);
+            editor.view(Active).buffer()
+        })
+        .await;
+
+    let text = wait_for(&cx, buf, "[process exited").await;
+    assert_eq!(text, "hello\n[process exited 0]\n");
+    cx.with(|editor| assert_eq!(editor.cursor(Active), (1, 18))).await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn terminal_input_and_close() {
+    let cx = new("").await;
+
+    cx.with(|editor| editor.execute("terminal cat").unwrap()).await;
+    let buf = cx.with(|editor| editor.view(Active).buffer()).await;
+
+    // The line is echoed by the terminal and then by `cat`.
+    cx.with(|editor| editor.input("hi<CR>").unwrap()).await;
+    wait_for(&cx, buf, "hi\nhi\n").await;
+
+    cx.with(|editor| {
+        editor.input("<C-\\>").unwrap();
+        assert_eq!(editor.mode(), Mode::Normal);
+
+        // Normal mode moves around the output instead of sending keys.
+        editor.input("k").unwrap();
+        assert_eq!(editor.cursor(Active), (1, 0));
+        assert!(editor.get_error().is_none());
+
+        editor.close_view(Active);
+    })
+    .await;
+
+    // Closing the terminal kills the process.
+    wait_for(&cx, buf, "[process exited").await;
+
+    cx.cleanup().await;
+}
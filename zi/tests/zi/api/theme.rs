@@ -0,0 +1,51 @@
+use crate::new;
+
+fn fg(editor: &zi::Editor, scope: &str) -> Option<String> {
+    editor.theme().read().style(scope).and_then(|style| style.fg).map(|fg| fg.to_string())
+}
+
+#[tokio::test]
+async fn load_theme() -> zi::Result<()> {
+    let cx = new("").await;
+    let path = cx.tempfile(
+        r##"
+[palette]
+red = "#ff0000"
+
+keyword = "red"
+"ui.statusline" = { fg = "#00ff00", bg = "#000000" }
+"##,
+    )?;
+
+    let cmd = format!("theme {}", path.display());
+    cx.with(move |editor| editor.execute(cmd.as_str()).unwrap()).await;
+    cx.with(|editor| {
+        assert_eq!(fg(editor, "keyword").as_deref(), Some("#ff0000"));
+        // Missing scopes fall back to their parent scope.
+        assert_eq!(fg(editor, "keyword.control.repeat").as_deref(), Some("#ff0000"));
+        assert_eq!(fg(editor, "ui.statusline.error").as_deref(), Some("#00ff00"));
+        assert_eq!(fg(editor, "function"), None);
+    })
+    .await;
+
+    // `:theme` without a name reloads the current theme from disk.
+    std::fs::write(&path, "keyword = \"#0000ff\"\n")?;
+    cx.with(|editor| editor.execute("theme").unwrap()).await;
+    cx.with(|editor| assert_eq!(fg(editor, "keyword.control").as_deref(), Some("#0000ff"))).await;
+
+    // An invalid theme is reported and the current theme is kept.
+    std::fs::write(&path, "keyword = \"blue\"\n")?;
+    cx.with(|editor| {
+        let err = editor.reload_theme().unwrap_err().to_string();
+        assert!(err.contains("invalid theme"), "{err}");
+        assert_eq!(fg(editor, "keyword").as_deref(), Some("#0000ff"));
+
+        editor.set_theme("default").unwrap();
+        let default = zi::Theme::default().style("keyword").and_then(|style| style.fg);
+        assert_eq!(fg(editor, "keyword"), default.map(|fg| fg.to_string()));
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
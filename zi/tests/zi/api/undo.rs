@@ -117,3 +117,43 @@ async fn undo_marks_buffer_dirty() -> zi::Result<()> {
 
     Ok(())
 }
+
+#[tokio::test]
+async fn undo_tree_branches() {
+    let cx = new("").await;
+    cx.with(|editor| {
+        editor.input("iabc<ESC>").unwrap();
+        editor.input("Adef<ESC>").unwrap();
+        assert_eq!(editor.text(zi::Active), "abcdef\n");
+
+        // Undo then make a new change which starts a new branch.
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(zi::Active), "abc\n");
+        editor.input("Axyz<ESC>").unwrap();
+        assert_eq!(editor.text(zi::Active), "abcxyz\n");
+
+        // `u` and `<C-r>` follow the current branch.
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(zi::Active), "abc\n");
+        editor.input("<C-r>").unwrap();
+        assert_eq!(editor.text(zi::Active), "abcxyz\n");
+
+        // `g-` and `g+` move through the revisions in time order across branches.
+        editor.input("g-").unwrap();
+        assert_eq!(editor.text(zi::Active), "abcdef\n");
+        editor.input("g-").unwrap();
+        assert_eq!(editor.text(zi::Active), "abc\n");
+        editor.input("g-").unwrap();
+        assert_eq!(editor.text(zi::Active), "");
+        editor.input("g+g+").unwrap();
+        assert_eq!(editor.text(zi::Active), "abcdef\n");
+        editor.input("g+").unwrap();
+        assert_eq!(editor.text(zi::Active), "abcxyz\n");
+
+        let tree = editor.undo_tree(zi::Active).unwrap();
+        assert_eq!(tree.lines().count(), 4, "{tree}");
+    })
+    .await;
+
+    cx.cleanup().await;
+}
@@ -149,3 +149,94 @@ async fn test_directional_focus() {
     .await;
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn resize_split() {
+    let cx = new("").with_size((80, 10)).await;
+    cx.with(|editor| {
+        let left = editor.view(zi::Active).id();
+        let right = editor.split(zi::Active, Right, Fill(1));
+
+        let mut check = #[track_caller]
+        |editor: &zi::Editor, expected: &[(zi::ViewId, zi::Rect)]| {
+            for &(view, area) in expected {
+                assert_eq!(editor.view_area(view), area);
+            }
+        };
+
+        check(editor, &[(left, zi::Rect::new(0, 0, 39, 8)), (right, zi::Rect::new(40, 0, 40, 8))]);
+
+        editor.input("10<C-w>>").unwrap();
+        check(editor, &[(left, zi::Rect::new(0, 0, 29, 8)), (right, zi::Rect::new(30, 0, 50, 8))]);
+
+        // The views keep their proportions when the terminal is resized.
+        editor.handle_input(zi::input::Event::Resize(160, 10));
+        check(editor, &[(left, zi::Rect::new(0, 0, 59, 8)), (right, zi::Rect::new(60, 0, 100, 8))]);
+
+        // Shrinking stops at the minimum width.
+        editor.input("100<C-w><").unwrap();
+        check(editor, &[(left, zi::Rect::new(0, 0, 151, 8)), (right, zi::Rect::new(152, 0, 8, 8))]);
+
+        editor.input("<C-w>=").unwrap();
+        check(editor, &[(left, zi::Rect::new(0, 0, 79, 8)), (right, zi::Rect::new(80, 0, 80, 8))]);
+
+        // Heights are resized within the nested split, widths by the split it's nested in.
+        editor.input("<C-w>s").unwrap();
+        let bottom = editor.view(zi::Active).id();
+        check(
+            editor,
+            &[(right, zi::Rect::new(80, 0, 80, 3)), (bottom, zi::Rect::new(80, 4, 80, 4))],
+        );
+
+        editor.input("2<C-w>+").unwrap();
+        check(
+            editor,
+            &[(right, zi::Rect::new(80, 0, 80, 1)), (bottom, zi::Rect::new(80, 2, 80, 6))],
+        );
+
+        editor.input("<C-w><").unwrap();
+        check(
+            editor,
+            &[
+                (left, zi::Rect::new(0, 0, 80, 8)),
+                (right, zi::Rect::new(81, 0, 79, 1)),
+                (bottom, zi::Rect::new(81, 2, 79, 6)),
+            ],
+        );
+
+        editor.handle_input(zi::input::Event::Resize(160, 18));
+        check(
+            editor,
+            &[(right, zi::Rect::new(81, 0, 79, 3)), (bottom, zi::Rect::new(81, 4, 79, 12))],
+        );
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn resize_split_below_minimum() {
+    // Both views are already narrower than the minimum width.
+    let cx = new("").with_size((15, 10)).await;
+    cx.with(|editor| {
+        let left = editor.view(zi::Active).id();
+        let right = editor.split(zi::Active, Right, Fill(1));
+
+        let check = #[track_caller]
+        |editor: &zi::Editor| {
+            assert_eq!(editor.view_area(left), zi::Rect::new(0, 0, 7, 8));
+            assert_eq!(editor.view_area(right), zi::Rect::new(8, 0, 7, 8));
+        };
+
+        check(editor);
+
+        // There is no space to take from the left view, it must not take any from the right one either.
+        editor.input("<C-w>>").unwrap();
+        check(editor);
+
+        editor.input("<C-w><").unwrap();
+        check(editor);
+    })
+    .await;
+    cx.cleanup().await;
+}
@@ -54,7 +54,7 @@ async fn visual_block_yank() {
         assert_eq!(editor.mode(), zi::Mode::Normal);
         let reg = editor.register('"').unwrap();
         assert_eq!(reg.content, "ab\nde\ngh");
-        assert_eq!(reg.kind, zi::RegisterKind::Charwise);
+        assert_eq!(reg.kind, zi::RegisterKind::Blockwise);
     })
     .await;
     cx.cleanup().await;
@@ -126,7 +126,7 @@ async fn visual_block_yank_with_empty_lines() {
         assert_eq!(editor.mode(), zi::Mode::Normal);
         let reg = editor.register('"').unwrap();
         assert_eq!(reg.content, "ab\n\ngh");
-        assert_eq!(reg.kind, zi::RegisterKind::Charwise);
+        assert_eq!(reg.kind, zi::RegisterKind::Blockwise);
     })
     .await;
     cx.cleanup().await;
@@ -141,7 +141,7 @@ async fn visual_block_yank_with_short_lines() {
         assert_eq!(editor.mode(), zi::Mode::Normal);
         let reg = editor.register('"').unwrap();
         assert_eq!(reg.content, "bcde\nb\nbcde");
-        assert_eq!(reg.kind, zi::RegisterKind::Charwise);
+        assert_eq!(reg.kind, zi::RegisterKind::Blockwise);
     })
     .await;
     cx.cleanup().await;
@@ -248,3 +248,95 @@ async fn visual_line_change() {
     .await;
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn visual_block_insert() {
+    let cx = new("one\ntwo\nthree\nfour\nfive").await;
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (0, 0));
+        editor.input("<C-v>4jI// ").unwrap();
+        assert_eq!(editor.mode(), zi::Mode::Insert);
+        // The other lines are only changed when leaving insert mode.
+        assert_eq!(editor.text(zi::Active), "// one\ntwo\nthree\nfour\nfive\n");
+
+        editor.input("<ESC>").unwrap();
+        assert_eq!(editor.mode(), zi::Mode::Normal);
+        assert_eq!(editor.text(zi::Active), "// one\n// two\n// three\n// four\n// five\n");
+
+        editor.input("u").unwrap();
+        assert_eq!(editor.text(zi::Active), "one\ntwo\nthree\nfour\nfive\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn visual_block_insert_skips_short_lines() {
+    let cx = new("abc\na\nabc").await;
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (0, 1));
+        editor.input("<C-v>jjlIX<ESC>").unwrap();
+        assert_eq!(editor.text(zi::Active), "aXbc\na\naXbc\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn visual_block_append_pads_short_lines() {
+    let cx = new("abc\na\nabc").await;
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (0, 1));
+        editor.input("<C-v>jjlA!<ESC>").unwrap();
+        assert_eq!(editor.text(zi::Active), "abc!\na  !\nabc!\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn visual_block_change() {
+    let cx = new("abc\ndef").await;
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (0, 0));
+        editor.input("<C-v>jlcX<ESC>").unwrap();
+        assert_eq!(editor.text(zi::Active), "Xc\nXf\n");
+        let reg = editor.register('"').unwrap();
+        assert_eq!(reg.content, "ab\nde");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn visual_block_paste() {
+    let cx = new("ab\ncd\nef").await;
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (1, 0));
+        editor.input("<C-v>jy").unwrap();
+        editor.set_cursor(zi::Active, (0, 0));
+        editor.input("p").unwrap();
+        assert_eq!(editor.text(zi::Active), "acb\nced\nef\n");
+
+        // Lines past the end of the buffer are added.
+        editor.set_cursor(zi::Active, (2, 1));
+        editor.input("p").unwrap();
+        assert_eq!(editor.text(zi::Active), "acb\nced\nefc\n  e\n");
+    })
+    .await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn visual_block_with_tabs() {
+    let cx = new("\tx\n    y").await;
+    cx.with(|editor| {
+        editor.buffer(zi::Active).settings().tab_width.write(4);
+        editor.set_cursor(zi::Active, (0, 0));
+        // The tab is as wide as the four spaces below it.
+        editor.input("<C-v>jy").unwrap();
+        assert_eq!(editor.register('"').unwrap().content, "\t\n    ");
+    })
+    .await;
+    cx.cleanup().await;
+}
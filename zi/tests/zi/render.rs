@@ -1,6 +1,11 @@
 use super::*;
 
+mod diagnostics;
 mod file_picker;
 mod insert;
 mod line_number;
+mod list;
+mod mouse;
 mod split;
+mod statusline;
+mod unicode;
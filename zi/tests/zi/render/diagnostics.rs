@@ -0,0 +1,115 @@
+use std::time::Duration;
+
+use expect_test::expect;
+use zi::lstypes::{self, Point, Severity};
+use zi::{Active, OpenFlags};
+
+use crate::new;
+
+#[tokio::test]
+async fn diagnostic_virtual_text() -> zi::Result<()> {
+    let cx = new("").with_size((40, 6)).await;
+
+    let path = cx.tempfile("let x = 1;\nfn f() {}\nlet n = f(1, 2);\n")?;
+    cx.open(&path, OpenFlags::empty()).await?;
+    cx.with(move |editor| {
+        let diag =
+            |line, cols: std::ops::Range<usize>, severity, message: &str| lstypes::Diagnostic {
+                range: lstypes::EncodedRange::new(
+                    lstypes::PositionEncoding::Utf8,
+                    lstypes::PointRange::new(
+                        Point::new(line, cols.start),
+                        Point::new(line, cols.end),
+                    ),
+                ),
+                severity,
+                message: message.to_string(),
+            };
+        editor.replace_diagnostics(
+            path,
+            None,
+            lstypes::Diagnostics::Full(vec![
+                diag(0, 4..5, Severity::Warning, "unused variable `x`"),
+                diag(0, 8..9, Severity::Error, "expected `u8`\nfound integer"),
+                diag(2, 10..14, Severity::Error, "mismatched types: expected u8"),
+            ]),
+        );
+        // Keep the temporary path out of the snapshot.
+        zi::command::set_option(editor, "statusline", "{line}:{col}").unwrap();
+    })
+    .await;
+    // Wait for the signs to show up.
+    tokio::time::sleep(Duration::from_millis(100)).await;
+
+    // Only the first line of the most severe diagnostic on the cursor line is shown.
+    cx.snapshot(expect![[r#"
+        "E  1 |et x = 1;  expected `u8`          "
+        "   2 fn f() {}                          "
+        "E  3 let n = f(1, 2);                   "
+        "   4                                    "
+        "1:0                                     "
+        "                                        "
+    "#]])
+        .await;
+
+    // The cursor stays on the text it's on and the message is cut short to fit.
+    cx.with(|editor| editor.set_cursor(Active, (2, 10))).await;
+    cx.snapshot(expect![[r#"
+        "E  1 let x = 1;                         "
+        "   2 fn f() {}                          "
+        "E  3 let n = f(|, 2);  mismatched types…"
+        "   4                                    "
+        "3:10                                    "
+        "                                        "
+    "#]])
+        .await;
+
+    cx.with(|editor| {
+        assert_eq!(editor.cursor(Active), (2, 10));
+        assert_eq!(editor.cursor_line(), "let n = f(1, 2);");
+    })
+    .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
+
+#[tokio::test]
+async fn diagnostic_virtual_text_relative_numbers() -> zi::Result<()> {
+    let cx = new("").with_size((40, 6)).await;
+
+    let path = cx.tempfile(&format!("{}\tlet\n", "x\n".repeat(1000)))?;
+    cx.open(&path, OpenFlags::empty()).await?;
+    cx.with(move |editor| {
+        let range = lstypes::PointRange::new(Point::new(1000, 1), Point::new(1000, 4));
+        editor.replace_diagnostics(
+            path,
+            None,
+            lstypes::Diagnostics::Full(vec![lstypes::Diagnostic {
+                range: lstypes::EncodedRange::new(lstypes::PositionEncoding::Utf8, range),
+                severity: Severity::Error,
+                message: "mismatched types: expected".to_string(),
+            }]),
+        );
+        zi::command::set_option(editor, "statusline", "{line}:{col}").unwrap();
+        zi::command::set_option(editor, "numberstyle", "relative").unwrap();
+        editor.set_cursor(Active, (1000, 1));
+    })
+    .await;
+    tokio::time::sleep(Duration::from_millis(100)).await;
+
+    // The relative numbers are narrower than the line number, and the tab is as wide as it's drawn.
+    // The message only just fits if the gutter is measured the same way it's drawn.
+    cx.snapshot(expect![[r#"
+        "   3 x                                  "
+        "   2 x                                  "
+        "   1 x                                  "
+        "E  0     |et  mismatched types: expected"
+        "1001:1                                  "
+        "                                        "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+    Ok(())
+}
@@ -32,3 +32,29 @@ async fn file_picker() {
 
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn file_picker_ranking() {
+    let cx = new("").with_size((100, 8)).await;
+    cx.with(|editor| {
+        editor.settings().file_picker_split_ratio.write((0, 100));
+        editor.open_file_picker("tests/zi/testdirs/ranking");
+        editor.input("fb").unwrap();
+    })
+    .await;
+
+    // Contiguous matches rank first, then matches on word boundaries (camelCase), `main.rs` doesn't match at all.
+    cx.snapshot(expect![[r#"
+        "  fb|                                                                                               "
+        "  tests/zi/testdirs/ranking/src/fb.rs                                                               "
+        "  tests/zi/testdirs/ranking/src/fooBar.rs                                                           "
+        "  tests/zi/testdirs/ranking/src/flub.rs                                                             "
+        "                                                                                                    "
+        "                                                                                                    "
+        "buffer://picker:1:2                                                                                 "
+        "-- INSERT --                                                                                        "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
@@ -21,7 +21,7 @@ async fn line_number_width_grows_and_shrinks_as_required() {
         .await;
 
     cx.with(|editor| {
-        editor.view(zi::Active).settings().line_number_style.write(zi::LineNumberStyle::Relative);
+        editor.view(zi::Active).settings().line_number_style.write(zi::LineNumberStyle::Hybrid);
         editor.move_cursor(zi::Active, zi::Direction::Up, 3);
     })
     .await;
@@ -66,13 +66,13 @@ async fn no_line_number() {
 }
 
 #[tokio::test]
-async fn relative_line_number() {
+async fn hybrid_line_number() {
     let text = (1..13).map(|n| n.to_string()).collect::<Vec<_>>().join("\n");
     let cx = new(&text).with_size((51, 8)).await;
 
     cx.with(|editor| {
         editor.move_cursor(zi::Active, zi::Direction::Up, 3);
-        editor.view(zi::Active).settings().line_number_style.write(zi::LineNumberStyle::Relative)
+        editor.view(zi::Active).settings().line_number_style.write(zi::LineNumberStyle::Hybrid)
     })
     .await;
 
@@ -104,3 +104,140 @@ async fn relative_line_number() {
 
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn relative_line_number() {
+    let text = (1..13).map(|n| n.to_string()).collect::<Vec<_>>().join("\n");
+    let cx = new(&text).with_size((51, 8)).await;
+
+    cx.with(|editor| {
+        editor.move_cursor(zi::Active, zi::Direction::Up, 3);
+        editor.view(zi::Active).settings().line_number_style.write(zi::LineNumberStyle::Relative)
+    })
+    .await;
+
+    cx.snapshot(expect![[r#"
+        "   2 7                                             "
+        "   1 8                                             "
+        "   0 |                                             "
+        "   1 10                                            "
+        "   2 11                                            "
+        "   3 12                                            "
+        "buffer://scratch:9:0                               "
+        "                                                   "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn number_and_relativenumber_settings() {
+    let cx = new("").await;
+
+    cx.with(|editor| {
+        let style = || *editor.view(zi::Active).settings().line_number_style.read();
+        assert_eq!(style(), zi::LineNumberStyle::Absolute);
+
+        zi::command::set_option(editor, "relativenumber", "true").unwrap();
+        assert_eq!(style(), zi::LineNumberStyle::Hybrid);
+        zi::command::set_option(editor, "nu", "false").unwrap();
+        assert_eq!(style(), zi::LineNumberStyle::Relative);
+        zi::command::set_option(editor, "rnu", "false").unwrap();
+        assert_eq!(style(), zi::LineNumberStyle::None);
+        zi::command::set_option(editor, "number", "true").unwrap();
+        assert_eq!(style(), zi::LineNumberStyle::Absolute);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn line_number_gutter_widens_with_the_cursor_line() {
+    let text = (1..=100).map(|n| n.to_string()).collect::<Vec<_>>().join("\n");
+    let cx = new(&text).with_size((20, 5)).await;
+
+    cx.with(|editor| {
+        let settings = editor.view(zi::Active).settings();
+        settings.line_number_width.write(0);
+        settings.line_number_style.write(zi::LineNumberStyle::Hybrid);
+        editor.set_cursor(zi::Active, (98, 0));
+    })
+    .await;
+
+    cx.snapshot(expect![[r#"
+        "  1 98              "
+        " 99 |9              "
+        "  1 100             "
+        "buffer://scratch:99:"
+        "                    "
+    "#]])
+        .await;
+
+    // The current line gains a digit, so the gutter and the text area shift across.
+    cx.with(|editor| editor.input("j").unwrap()).await;
+    cx.snapshot(expect![[r#"
+        "   2 98             "
+        "   1 99             "
+        " 100 |00            "
+        "buffer://scratch:100"
+        "                    "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn relative_line_number_with_folds() {
+    let text = (1..=6).map(|n| n.to_string()).collect::<Vec<_>>().join("\n");
+    let cx = new(&text).with_size((20, 8)).await;
+
+    cx.with(|editor| {
+        editor.view(zi::Active).settings().line_number_style.write(zi::LineNumberStyle::Relative);
+        editor.set_cursor(zi::Active, (1, 0));
+        editor.input("zfj").unwrap();
+    })
+    .await;
+
+    // A closed fold counts as one line, so the numbers are the counts to move by.
+    cx.snapshot(expect![[r#"
+        "   1 1              "
+        "   0 | ... (2 lines)"
+        "   1 4              "
+        "   2 5              "
+        "   3 6              "
+        "                    "
+        "buffer://scratch:2:0"
+        "                    "
+    "#]])
+        .await;
+
+    cx.with(|editor| {
+        editor.input("3j").unwrap();
+        assert_eq!(editor.cursor(zi::Active), (5, 0));
+    })
+    .await;
+
+    // The current line shows its source line rather than its row in hybrid mode.
+    cx.with(|editor| {
+        editor.view(zi::Active).settings().line_number_style.write(zi::LineNumberStyle::Hybrid);
+        editor.input("3k").unwrap();
+    })
+    .await;
+
+    cx.snapshot(expect![[r#"
+        "   1 1              "
+        "   2 | ... (2 lines)"
+        "   1 4              "
+        "   2 5              "
+        "   3 6              "
+        "                    "
+        "buffer://scratch:2:0"
+        "                    "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
@@ -0,0 +1,42 @@
+use expect_test::expect;
+use zi::Active;
+
+use crate::new;
+
+#[tokio::test]
+async fn render_list() {
+    let cx = new("\tab  \nx\u{a0}y").with_size((16, 4)).await;
+    cx.with(|editor| {
+        zi::command::set_option(editor, "statusline", "{line}:{col}").unwrap();
+        editor.execute("set list").unwrap();
+        editor.execute("set listchars tab:>-,trail:.,nbsp:_,eol:$").unwrap();
+        editor.set_cursor(Active, (0, 1));
+    })
+    .await;
+
+    // The tab still takes up its 4 cells, so the cursor on `a` is where it would be without the glyphs.
+    cx.snapshot(expect![[r#"
+        "   1 >---|b..$  "
+        "   2 x_y$       "
+        "1:1             "
+        "                "
+    "#]])
+        .await;
+
+    cx.with(|editor| {
+        assert_eq!(editor.text(Active).to_string(), "\tab  \nx\u{a0}y\n");
+        editor.execute("set listchars tab:>,nbsp:_").unwrap();
+    })
+    .await;
+
+    // Whitespace without a glyph is shown as usual.
+    cx.snapshot(expect![[r#"
+        "   1 >   |b     "
+        "   2 x_y        "
+        "1:1             "
+        "                "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
@@ -0,0 +1,125 @@
+use zi::input::MouseEvent;
+use zi::{Active, Constraint, Direction, Mode, Point};
+
+use crate::new;
+
+/// Send an SGR encoded mouse report, the coordinates are 1-indexed.
+#[track_caller]
+fn sgr(editor: &mut zi::Editor, seq: &str) {
+    editor.handle_input(MouseEvent::from_sgr(seq).expect("invalid sgr sequence"));
+}
+
+#[tokio::test]
+async fn mouse_click() {
+    let cx = new("abc\n日本語\nxyz\n").with_size((30, 6)).await;
+    // Render first so the editor knows where everything is on the screen.
+    cx.render().await;
+
+    cx.with(|editor| {
+        // The gutter is 5 cells wide, so the 9th column is the 4th cell of the text: the second half of `本`.
+        sgr(editor, "\x1b[<0;9;2M");
+        sgr(editor, "\x1b[<0;9;2m");
+        assert_eq!(editor.cursor(Active), Point::new(1, 3));
+
+        // Clicking on the line numbers goes to the start of the line.
+        sgr(editor, "\x1b[<0;2;1M");
+        assert_eq!(editor.cursor(Active), Point::new(0, 0));
+
+        // Past the end of the line goes to the last character.
+        sgr(editor, "\x1b[<0;20;3M");
+        assert_eq!(editor.cursor(Active), Point::new(2, 2));
+        assert_eq!(editor.mode(), Mode::Normal);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn mouse_drag_select() {
+    let cx = new("abc def\nghi\n").with_size((30, 6)).await;
+    cx.render().await;
+
+    cx.with(|editor| {
+        sgr(editor, "\x1b[<0;7;1M");
+        sgr(editor, "\x1b[<32;8;1M");
+        sgr(editor, "\x1b[<32;7;2M");
+        sgr(editor, "\x1b[<0;7;2m");
+        assert_eq!(editor.mode(), Mode::Visual);
+        assert_eq!(
+            editor.visual_selection(Active).unwrap().content(editor.text(Active)),
+            "bc def\ngh"
+        );
+
+        // A single click ends the selection.
+        sgr(editor, "\x1b[<0;6;1M");
+        assert_eq!(editor.mode(), Mode::Normal);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn mouse_multi_click() {
+    let cx = new("foo_bar baz\nqux\n").with_size((30, 6)).await;
+    cx.render().await;
+
+    cx.with(|editor| {
+        // Double click selects the word.
+        sgr(editor, "\x1b[<0;8;1M");
+        sgr(editor, "\x1b[<0;8;1m");
+        sgr(editor, "\x1b[<0;8;1M");
+        assert_eq!(editor.mode(), Mode::Visual);
+        assert_eq!(
+            editor.visual_selection(Active).unwrap().content(editor.text(Active)),
+            "foo_bar"
+        );
+
+        // Triple click selects the line.
+        sgr(editor, "\x1b[<0;8;1M");
+        assert_eq!(editor.mode(), Mode::VisualLine);
+        assert_eq!(
+            editor.visual_selection(Active).unwrap().content(editor.text(Active)),
+            "foo_bar baz\n"
+        );
+    })
+    .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn mouse_focus_and_scroll() {
+    let text = (0..50).map(|i| format!("{i}\n")).collect::<String>();
+    let cx = new(text).with_size((40, 8)).await;
+
+    let (left, right) = cx
+        .with(|editor| {
+            editor.set_cursor(Active, Point::new(0, 0));
+            let left = editor.view(Active).id();
+            let right = editor.split(Active, Direction::Right, Constraint::Fill(1));
+            (left, right)
+        })
+        .await;
+    cx.render().await;
+
+    cx.with(move |editor| {
+        sgr(editor, "\x1b[<0;7;3M");
+        assert_eq!(editor.view(Active).id(), left);
+        assert_eq!(editor.cursor(Active), Point::new(2, 0));
+
+        sgr(editor, "\x1b[<0;27;2M");
+        assert_eq!(editor.view(Active).id(), right);
+
+        // The wheel scrolls the focused view.
+        sgr(editor, "\x1b[<65;7;3M");
+        assert_eq!(editor.view(right).offset().line, 3);
+        assert_eq!(editor.view(left).offset().line, 0);
+        sgr(editor, "\x1b[<64;7;3M");
+        assert_eq!(editor.view(right).offset().line, 0);
+    })
+    .await;
+
+    cx.cleanup().await;
+}
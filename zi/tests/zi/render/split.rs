@@ -61,12 +61,12 @@ async fn close_view() {
     .await;
 
     cx.snapshot(expect![[r#"
-        "   1 1                       1 1                   "
-        "   2 2                       2 2                   "
-        "   3 3                       3 3                   "
-        "   4                         1 1                   "
-        "                             2 2                   "
-        "                             3 3                   "
+        "   1 1                   │   1 1                   "
+        "   2 2                   │   2 2                   "
+        "   3 3                   │─────────────────────────"
+        "   4                     │   1 1                   "
+        "                         │   2 2                   "
+        "                         │   3 3                   "
         "buffer://scratch:4:0           |                   "
         "                                                   "
     "#]])
@@ -74,12 +74,12 @@ async fn close_view() {
 
     cx.with(|editor| editor.close_view(zi::Active)).await;
     cx.snapshot(expect![[r#"
-        "   1 1                       1 1                   "
-        "   2 2                       2 2                   "
-        "   3 3                       3 3                   "
-        "   4                         4 |                   "
-        "                                                   "
-        "                                                   "
+        "   1 1                   │   1 1                   "
+        "   2 2                   │   2 2                   "
+        "   3 3                   │   3 3                   "
+        "   4                     │   4 |                   "
+        "                         │                         "
+        "                         │                         "
         "buffer://scratch:4:0                               "
         "                                                   "
     "#]])
@@ -94,12 +94,12 @@ async fn splits_have_independent_scroll() -> io::Result<()> {
 
     cx.with(|editor| editor.split(zi::Active, Right, Fill(1))).await;
     cx.snapshot(expect![[r#"
-        "   1 1                       1 1                   "
-        "   2 2                       2 2                   "
-        "   3 3                       3 3                   "
-        "   4                         4 |                   "
-        "                                                   "
-        "                                                   "
+        "   1 1                   │   1 1                   "
+        "   2 2                   │   2 2                   "
+        "   3 3                   │   3 3                   "
+        "   4                     │   4 |                   "
+        "                         │                         "
+        "                         │                         "
         "buffer://scratch:4:0                               "
         "                                                   "
     "#]])
@@ -107,12 +107,12 @@ async fn splits_have_independent_scroll() -> io::Result<()> {
 
     cx.with(|editor| editor.scroll(zi::Active, Down, 1)).await;
     cx.snapshot(expect![[r#"
-        "   1 1                       2 2                   "
-        "   2 2                       3 3                   "
-        "   3 3                       4 |                   "
-        "   4                                               "
-        "                                                   "
-        "                                                   "
+        "   1 1                   │   2 2                   "
+        "   2 2                   │   3 3                   "
+        "   3 3                   │   4 |                   "
+        "   4                     │                         "
+        "                         │                         "
+        "                         │                         "
         "buffer://scratch:4:0                               "
         "                                                   "
     "#]])
@@ -131,7 +131,7 @@ async fn split() -> io::Result<()> {
     cx.snapshot(expect![[r#"
         "   1 abc                                          "
         "                                                  "
-        "                                                  "
+        "──────────────────────────────────────────────────"
         "   1 ab|                                          "
         "                                                  "
         "                                                  "
@@ -145,12 +145,12 @@ async fn split() -> io::Result<()> {
     let cx = new("abc").with_size((50, 8)).await;
     cx.with(|editor| editor.split(zi::Active, Right, Fill(1))).await;
     cx.snapshot(expect![[r#"
-        "   1 abc                    1 ab|                 "
-        "                                                  "
-        "                                                  "
-        "                                                  "
-        "                                                  "
-        "                                                  "
+        "   1 abc                │   1 ab|                 "
+        "                        │                         "
+        "                        │                         "
+        "                        │                         "
+        "                        │                         "
+        "                        │                         "
         "buffer://scratch:1:2                              "
         "                                                  "
     "#]])
@@ -158,12 +158,12 @@ async fn split() -> io::Result<()> {
 
     cx.with(|editor| editor.split(zi::Active, Right, Fill(1))).await;
     cx.snapshot(expect![[r#"
-        "   1 abc            1 abc           1 ab|         "
-        "                                                  "
-        "                                                  "
-        "                                                  "
-        "                                                  "
-        "                                                  "
+        "   1 abc        │   1 abc       │   1 ab|         "
+        "                │               │                 "
+        "                │               │                 "
+        "                │               │                 "
+        "                │               │                 "
+        "                │               │                 "
         "buffer://scratch:1:2                              "
         "                                                  "
     "#]])
@@ -171,12 +171,12 @@ async fn split() -> io::Result<()> {
 
     cx.with(|editor| editor.split(zi::Active, Down, Fill(1))).await;
     cx.snapshot(expect![[r#"
-        "   1 abc            1 abc           1 abc         "
-        "                                                  "
-        "                                                  "
-        "                                    1 ab|         "
-        "                                                  "
-        "                                                  "
+        "   1 abc        │   1 abc       │   1 abc         "
+        "                │               │                 "
+        "                │               │─────────────────"
+        "                │               │   1 ab|         "
+        "                │               │                 "
+        "                │               │                 "
         "buffer://scratch:1:2                              "
         "                                                  "
     "#]])
@@ -184,12 +184,12 @@ async fn split() -> io::Result<()> {
 
     cx.with(|editor| editor.split(zi::Active, Left, Fill(1))).await;
     cx.snapshot(expect![[r#"
-        "   1 abc            1 abc           1 abc         "
-        "                                                  "
-        "                                                  "
-        "                                    1 ab|    1 abc"
-        "                                                  "
-        "                                                  "
+        "   1 abc        │   1 abc       │   1 abc         "
+        "                │               │                 "
+        "                │               │─────────────────"
+        "                │               │   1 ab|│   1 abc"
+        "                │               │        │        "
+        "                │               │        │        "
         "buffer://scratch:1:2                              "
         "                                                  "
     "#]])
@@ -197,12 +197,12 @@ async fn split() -> io::Result<()> {
 
     cx.with(|editor| editor.split(zi::Active, Up, Fill(1))).await;
     cx.snapshot(expect![[r#"
-        "   1 abc            1 abc           1 abc         "
-        "                                                  "
-        "                                                  "
-        "                                    1 ab|    1 abc"
-        "                                                  "
-        "                                    1 abc         "
+        "   1 abc        │   1 abc       │   1 abc         "
+        "                │               │                 "
+        "                │               │─────────────────"
+        "                │               │   1 ab|│   1 abc"
+        "                │               │────────│        "
+        "                │               │   1 abc│        "
         "buffer://scratch:1:2                              "
         "                                                  "
     "#]])
@@ -226,12 +226,12 @@ async fn more_splits() {
     .await;
 
     cx.snapshot(expect![[r#"
-        "   1 abc     1 abc  "
-        "                    "
-        "   1 abc            "
-        "             1 abc  "
-        "   1 ab|            "
-        "                    "
+        "   1 abc │   1 abc  "
+        "─────────│          "
+        "   1 abc │──────────"
+        "─────────│   1 abc  "
+        "   1 ab| │          "
+        "         │          "
         "buffer://scratch:1:2"
         "                    "
     "#]])
@@ -254,10 +254,10 @@ async fn test_directional_focus() {
         .await;
 
     cx.snapshot(expect![[r#"
-        "   1 abc       1 ab|    "
-        "                        "
-        "                        "
-        "                        "
+        "   1 abc   │   1 ab|    "
+        "           │            "
+        "           │            "
+        "           │            "
         "buffer://scratch:1:2    "
         "                        "
     "#]])
@@ -266,10 +266,10 @@ async fn test_directional_focus() {
     cx.with(move |editor| assert_eq!(editor.focus_direction(Left), a)).await;
 
     cx.snapshot(expect![[r#"
-        "   1 ab|       1 abc    "
-        "                        "
-        "                        "
-        "                        "
+        "   1 ab|   │   1 abc    "
+        "           │            "
+        "           │            "
+        "           │            "
         "buffer://scratch:1:2    "
         "                        "
     "#]])
@@ -277,10 +277,10 @@ async fn test_directional_focus() {
 
     cx.with(|editor| editor.split(zi::Active, Down, Fill(1))).await;
     cx.snapshot(expect![[r#"
-        "   1 abc       1 abc    "
-        "                        "
-        "   1 ab|                "
-        "                        "
+        "   1 abc   │   1 abc    "
+        "───────────│            "
+        "   1 ab|   │            "
+        "           │            "
         "buffer://scratch:1:2    "
         "                        "
     "#]])
@@ -289,10 +289,10 @@ async fn test_directional_focus() {
     cx.with(move |editor| assert_eq!(editor.focus_direction(Right), b)).await;
 
     cx.snapshot(expect![[r#"
-        "   1 abc       1 ab|    "
-        "                        "
-        "   1 abc                "
-        "                        "
+        "   1 abc   │   1 ab|    "
+        "───────────│            "
+        "   1 abc   │            "
+        "           │            "
         "buffer://scratch:1:2    "
         "                        "
     "#]])
@@ -317,10 +317,10 @@ async fn test_multiple_views_into_same_buffer() {
     cx.with(|editor| editor.split(zi::Active, Right, Fill(1))).await;
 
     cx.snapshot(expect![[r#"
-        "   1 abcdefg   1 abcdef|"
-        "                        "
-        "                        "
-        "                        "
+        "   1 abcdef│   1 abcdef|"
+        "           │            "
+        "           │            "
+        "           │            "
         "buffer://scratch:1:6    "
         "                        "
     "#]])
@@ -330,10 +330,10 @@ async fn test_multiple_views_into_same_buffer() {
     cx.with(|editor| editor.input("db").unwrap()).await;
 
     cx.snapshot(expect![[r#"
-        "   1 g         1 |      "
-        "                        "
-        "                        "
-        "                        "
+        "   1 g     │   1 |      "
+        "           │            "
+        "           │            "
+        "           │            "
         "buffer://scratch:1:0    "
         "                        "
     "#]])
@@ -342,10 +342,10 @@ async fn test_multiple_views_into_same_buffer() {
     cx.with(|editor| editor.focus_direction(Left)).await;
 
     cx.snapshot(expect![[r#"
-        "   1 |         1 g      "
-        "                        "
-        "                        "
-        "                        "
+        "   1 |     │   1 g      "
+        "           │            "
+        "           │            "
+        "           │            "
         "buffer://scratch:1:0    "
         "                        "
     "#]])
@@ -358,7 +358,7 @@ async fn test_multiple_views_into_same_buffer() {
 async fn test_directional_focus_propagation() {
     // regression test for cb801c66734ff16be921087a982b53fa626a976a
 
-    let cx = new("ab").with_size((32, 6)).await;
+    let cx = new("ab").with_size((34, 6)).await;
     cx.with(|editor| {
         editor.split(zi::Active, Right, Fill(1));
         editor.split(zi::Active, Down, Fill(1));
@@ -367,24 +367,24 @@ async fn test_directional_focus_propagation() {
     .await;
 
     cx.snapshot(expect![[r#"
-        "   1 ab            1 ab         "
-        "                                "
-        "                   1 ab    1 a| "
-        "                                "
-        "buffer://scratch:1:1            "
-        "                                "
+        "   1 ab         │   1 ab          "
+        "                │─────────────────"
+        "                │   1 ab │   1 a| "
+        "                │        │        "
+        "buffer://scratch:1:1              "
+        "                                  "
     "#]])
         .await;
 
     cx.with(|editor| editor.focus_direction(Left)).await;
 
     cx.snapshot(expect![[r#"
-        "   1 ab            1 ab         "
-        "                                "
-        "                   1 a|    1 ab "
-        "                                "
-        "buffer://scratch:1:1            "
-        "                                "
+        "   1 ab         │   1 ab          "
+        "                │─────────────────"
+        "                │   1 a| │   1 ab "
+        "                │        │        "
+        "buffer://scratch:1:1              "
+        "                                  "
     "#]])
         .await;
 
@@ -392,14 +392,51 @@ async fn test_directional_focus_propagation() {
     cx.with(|editor| editor.focus_direction(Left)).await;
 
     cx.snapshot(expect![[r#"
-        "   1 a|            1 ab         "
-        "                                "
-        "                   1 ab    1 ab "
-        "                                "
-        "buffer://scratch:1:1            "
-        "                                "
+        "   1 a|         │   1 ab          "
+        "                │─────────────────"
+        "                │   1 ab │   1 ab "
+        "                │        │        "
+        "buffer://scratch:1:1              "
+        "                                  "
     "#]])
         .await;
 
     cx.cleanup().await;
 }
+
+#[tokio::test]
+async fn edit_shifts_other_views() {
+    let cx = new("a\nb\nc\n").with_size((24, 8)).await;
+
+    let left = cx
+        .with(|editor| {
+            editor.set_cursor(zi::Active, (2, 0));
+            let left = editor.view(zi::Active).id();
+            editor.split(zi::Active, Right, Fill(1));
+            left
+        })
+        .await;
+
+    // Insert lines above the cursor of the left view from the right view.
+    cx.with(|editor| editor.input("ggOx<CR>y<ESC>").unwrap()).await;
+    cx.snapshot(expect![[r#"
+        "   1 x     │   1 x      "
+        "   2 y     │   2 |      "
+        "   3 a     │   3 a      "
+        "   4 b     │   4 b      "
+        "   5 c     │   5 c      "
+        "   6       │   6        "
+        "buffer://scratch:2:0    "
+        "                        "
+    "#]])
+        .await;
+
+    cx.with(move |editor| {
+        assert_eq!(editor.view(left).cursor(), zi::Point::new(4, 0));
+        editor.focus(left);
+        assert_eq!(editor.cursor_char(), Some('c'));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
@@ -0,0 +1,87 @@
+use expect_test::{Expect, expect};
+
+use crate::new;
+
+const FORMAT: &str = "{mode} {file}{modified} %= {lsp} {encoding} {line}:{col}";
+
+#[tokio::test]
+async fn statusline_segments() {
+    let cx = new("abc").with_size((40, 3)).await;
+    cx.with(|editor| zi::command::set_option(editor, "statusline", FORMAT)).await.unwrap();
+
+    // The `{lsp}` group is omitted as there are no language services running.
+    cx.snapshot(expect![[r#"
+        "   1 ab|                                "
+        "NORMAL buffer://scratch        utf-8 1:2"
+        "                                        "
+    "#]])
+        .await;
+
+    // The status line reflects the mode as soon as it changes.
+    cx.with(|editor| editor.input("ix").unwrap()).await;
+    cx.snapshot(expect![[r#"
+        "   1 abx|                               "
+        "INSERT buffer://scratch[+]     utf-8 1:3"
+        "-- INSERT --                            "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
+
+async fn snapshot_at_width(width: u16, expect: Expect) {
+    let cx = new("abc").with_size((width, 3)).await;
+    cx.with(|editor| zi::command::set_option(editor, "statusline", FORMAT)).await.unwrap();
+    cx.snapshot(expect).await;
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn statusline_truncation() {
+    // The encoding is the first to go, then the mode, then the cursor position.
+    snapshot_at_width(
+        30,
+        expect![[r#"
+            "   1 ab|                      "
+            "NORMAL buffer://scratch    1:2"
+            "                              "
+        "#]],
+    )
+    .await;
+
+    snapshot_at_width(
+        24,
+        expect![[r#"
+            "   1 ab|                "
+            "buffer://scratch     1:2"
+            "                        "
+        "#]],
+    )
+    .await;
+
+    // The file is never dropped, it's cut off instead.
+    snapshot_at_width(
+        12,
+        expect![[r#"
+            "   1 ab|    "
+            "buffer://scr"
+            "            "
+        "#]],
+    )
+    .await;
+}
+
+#[tokio::test]
+async fn statusline_invalid_format() {
+    let cx = new("").await;
+    cx.with(|editor| {
+        assert!(zi::command::set_option(editor, "statusline", "{file} {nope}").is_err());
+        assert!(zi::command::set_option(editor, "statusline", "{file").is_err());
+        assert!(
+            zi::command::set_option(editor, "statusline", "{file} %= {mode} %= {line}").is_err()
+        );
+    })
+    .await;
+
+    cx.cleanup().await;
+}
@@ -0,0 +1,51 @@
+use expect_test::expect;
+
+use crate::new;
+
+#[tokio::test]
+async fn render_wide_characters() {
+    let cx = new("ab\n日本語\na日本語\n").with_size((10, 5)).await;
+    cx.with(|editor| editor.set_cursor(zi::Active, (0, 0))).await;
+
+    // Each wide character takes two cells, the second of which is hidden by it.
+    // There is only room for one more cell after `本`, so `語` is not split in half and the last column is padded instead.
+    // On the next line `本` ends exactly at the edge, so there is nothing to pad.
+    cx.snapshot(expect![[r#"
+        "   1 |b   "
+        "   2 日本>" Hidden by multi-width symbols: [(6, " "), (8, " ")]
+        "   3 a日本" Hidden by multi-width symbols: [(7, " "), (9, " ")]
+        "buffer://s"
+        "          "
+    "#]])
+        .await;
+
+    cx.cleanup().await;
+}
+
+#[tokio::test]
+async fn render_wide_character_wraps() {
+    let cx = new("ab\n日本語\n").with_size((10, 5)).await;
+    cx.with(|editor| {
+        zi::command::set_option(editor, "wrap", "true").unwrap();
+        editor.set_cursor(zi::Active, (0, 0));
+    })
+    .await;
+
+    // `語` doesn't fit in the last column, so it moves to the next row and the gap it leaves is marked.
+    cx.snapshot(expect![[r#"
+        "   1 |b   "
+        "   2 日本>" Hidden by multi-width symbols: [(6, " "), (8, " ")]
+        "     語   " Hidden by multi-width symbols: [(6, " ")]
+        "buffer://s"
+        "          "
+    "#]])
+        .await;
+
+    cx.with(|editor| {
+        editor.set_cursor(zi::Active, (1, 6));
+        assert_eq!(editor.cursor_viewport_coords(), (0, 2));
+    })
+    .await;
+
+    cx.cleanup().await;
+}
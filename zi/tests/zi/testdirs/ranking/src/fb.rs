@@ -0,0 +1 @@
+// fb
@@ -0,0 +1 @@
+// flub
@@ -0,0 +1 @@
+// fooBar